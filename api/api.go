@@ -5,38 +5,295 @@
 package api
 
 import (
+	"time"
+
 	"github.com/harness/lite-engine/engine/spec"
 )
 
 type (
 	HealthResponse struct {
-		Version string `json:"version"`
-		OK      bool   `json:"ok"`
+		Version string               `json:"version"`
+		OK      bool                 `json:"ok"`
+		Retries map[string]RetryStat `json:"retries,omitempty"` // retry counters of the engine operations
+		Steps   *StepMetrics         `json:"steps,omitempty"`   // step counters of the metrics lifecycle hook
+		// PublicKey is the base64 curve25519 key the secrets of the requests
+		// are sealed with, see SealedEnvs.
+		PublicKey string `json:"public_key,omitempty"`
+		// Logs are the counters of the log streams, they tell whether the
+		// log service falls behind.
+		Logs *LogMetrics `json:"logs,omitempty"`
+	}
+
+	LogMetrics struct {
+		Batches int64 `json:"batches"`
+		Lines   int64 `json:"lines"`
+		Failed  int64 `json:"failed"`
+		Stalls  int64 `json:"stalls"` // the flushes which found the queue of batches full
+		Dropped int64 `json:"dropped"`
+		Queued  int64 `json:"queued"`
+	}
+
+	StepMetrics struct {
+		Started    int64 `json:"started"`
+		Running    int64 `json:"running"`
+		Succeeded  int64 `json:"succeeded"`
+		Failed     int64 `json:"failed"`
+		OOMKilled  int64 `json:"oom_killed"`
+		DurationMs int64 `json:"duration_ms"`
+	}
+
+	RetryStat struct {
+		Calls    int64 `json:"calls"`
+		Retries  int64 `json:"retries"`
+		Failures int64 `json:"failures"`
+	}
+
+	// ErrorResponse is the error response of the v2 api.
+	ErrorResponse struct {
+		Error Error `json:"error"`
+	}
+
+	Error struct {
+		Code    ErrorCode `json:"code"`
+		Message string    `json:"message"`
+		Issues  []string  `json:"issues,omitempty"` // individual validation issues, if any
 	}
 
 	SetupRequest struct {
-		Envs              map[string]string `json:"envs,omitempty"`
-		Network           spec.Network      `json:"network"`
-		Volumes           []*spec.Volume    `json:"volumes,omitempty"`
-		Secrets           []string          `json:"secrets,omitempty"`
-		LogConfig         LogConfig         `json:"log_config,omitempty"`
-		TIConfig          TIConfig          `json:"ti_config,omitempty"`
-		Files             []*spec.File      `json:"files,omitempty"`
-		MountDockerSocket *bool             `json:"mount_docker_socket,omitempty"`
-		TTY               bool              `json:"tty,omitempty" default:"false"`
+		Envs              map[string]string    `json:"envs,omitempty"`
+		Network           spec.Network         `json:"network"`
+		Volumes           []*spec.Volume       `json:"volumes,omitempty"`
+		Secrets           []string             `json:"secrets,omitempty"`
+		SealedEnvs        map[string]string    `json:"sealed_envs,omitempty"` // envs sealed with the public key of the engine, added to the envs and secrets
+		LogConfig         LogConfig            `json:"log_config,omitempty"`
+		TIConfig          TIConfig             `json:"ti_config,omitempty"`
+		Files             []*spec.File         `json:"files,omitempty"`
+		MountDockerSocket *bool                `json:"mount_docker_socket,omitempty"`
+		TTY               bool                 `json:"tty,omitempty" default:"false"`
+		EnvPassthrough    *spec.EnvPassthrough `json:"env_passthrough,omitempty"`
+		ImageCache        *ImageCache          `json:"image_cache,omitempty"` // images imported from the cache at setup
+		StageRuntimeID    string               `json:"stage_runtime_id,omitempty"`
+		Compatibility     *Compatibility       `json:"compatibility,omitempty"` // checked before the stage is set up
+		Budget            *StageBudget         `json:"budget,omitempty"`        // the steps are not started once the budget is exhausted
+		// TelemetrySampling is the share of the steps returning their
+		// telemetry, all of them if not set.
+		TelemetrySampling *TelemetrySampling `json:"telemetry_sampling,omitempty"`
+		// Backend runs the container steps of the stage, docker if not set
+		// or kubernetes to run them as pods.
+		Backend string `json:"backend,omitempty"`
+		// Runtime runs the containers, the container runtime of the engine
+		// if not set or containerd on the hosts without docker.
+		Runtime string `json:"runtime,omitempty"`
+		// OCIRuntimes are the OCI runtimes the steps of the stage run with,
+		// eg. runsc. The setup fails if one is not registered with the
+		// docker daemon, instead of the first step using it.
+		OCIRuntimes []string `json:"oci_runtimes,omitempty"`
+		// EgressProxy starts a forward proxy for the stage, set as the
+		// proxy of the steps. Their outbound destinations are returned by
+		// the destroy.
+		EgressProxy bool `json:"egress_proxy,omitempty"`
+		// UserNamespace runs the steps on a docker daemon remapping the
+		// users of the containers, rootless or with userns-remap: the host
+		// volumes are created 0770 and owned by the remapped user instead
+		// of being writable by all the users.
+		UserNamespace *spec.UserNamespace `json:"user_namespace,omitempty"`
+		// Notify posts the test summaries of the steps to a chat webhook.
+		Notify *Notify `json:"notify,omitempty"`
+		// OutputKey is the base64 AES-256 key the SECRET outputs of the
+		// steps are encrypted with, see the envelope package. The values
+		// of the secret outputs are returned in plain text if not set.
+		OutputKey string `json:"output_key,omitempty"`
+		// SecretFiles are the files and the directories of the secrets
+		// mounted on the host by an external agent, eg. a vault agent.
+		// Their contents are masked in the logs like the secrets, the
+		// files are watched during the stage for rendered or rotated
+		// secrets.
+		SecretFiles []string `json:"secret_files,omitempty"`
+		// Nudges is the catalog of the known failure patterns of the steps
+		// and their resolutions, in addition to the nudges of the engine.
+		Nudges *NudgeCatalog `json:"nudges,omitempty"`
+		// Registries are the credentials and the client certificates of
+		// the registries the ImageOp steps of the stage access. Their
+		// passwords and client keys are masked in the logs like the
+		// secrets.
+		Registries []*Registry `json:"registries,omitempty"`
+	}
+
+	// Registry is a container registry accessed by the ImageOp steps, with
+	// a password or a token, and a client certificate for mTLS.
+	Registry struct {
+		Address    string `json:"address"` // eg. registry.example.com:5000, or index.docker.io for the docker hub
+		Username   string `json:"username,omitempty"`
+		Password   string `json:"password,omitempty"`
+		CACert     string `json:"ca_cert,omitempty"`     // PEM, trusted in addition to the system certificates
+		ClientCert string `json:"client_cert,omitempty"` // PEM, with the client key
+		ClientKey  string `json:"client_key,omitempty"`  // PEM
+		Insecure   bool   `json:"insecure,omitempty"`    // the tls certificate is not verified, or the registry is served over http
+	}
+
+	// NudgeCatalog is the https url of a catalog of nudges, fetched at setup
+	// and cached by the engine. The catalog is verified with the public key
+	// against the signature of its X-Signature header.
+	NudgeCatalog struct {
+		URL       string `json:"url"`
+		PublicKey string `json:"public_key,omitempty"` // base64 ed25519 public key
+	}
+
+	// Notify is the chat webhook the test summary of a step is posted to
+	// once its reports are collected.
+	Notify struct {
+		WebhookURL   string `json:"webhook_url"`
+		Kind         string `json:"kind,omitempty"`          // slack or teams, slack if not set
+		OnlyFailures bool   `json:"only_failures,omitempty"` // post the summaries with failed tests only
+	}
+
+	// Compatibility is the engine version and features a runner expects.
+	// The setup fails with the incompatibilities if the engine does not
+	// match, eg. after a partial upgrade.
+	Compatibility struct {
+		MinVersion string   `json:"min_version,omitempty"`
+		Features   []string `json:"features,omitempty"`
 	}
 
-	SetupResponse struct{}
+	// ImageCache is a directory of image archives shared by the stages of a
+	// pipeline, eg. on a network share or a persistent disk.
+	ImageCache struct {
+		Dir    string   `json:"dir"`
+		Images []string `json:"images,omitempty"` // images exported to the cache at destroy
+	}
+
+	SetupResponse struct {
+		Fingerprint *spec.HostFingerprint `json:"fingerprint,omitempty"`
+		Version     string                `json:"version,omitempty"`  // engine version
+		Features    []string              `json:"features,omitempty"` // features supported by the engine
+	}
 
 	DestroyRequest struct {
 		LogDrone       bool   `json:"log_drone,omitempty"`
 		LogKey         string `json:"log_key,omitempty"`          // key to write the lite engine logs (optional)
 		LiteEnginePath string `json:"lite_engine_path,omitempty"` // where to find the lite engine logs
 		StageRuntimeID string `json:"stage_runtime_id,omitempty"`
+
+		// ImageCache exports the images to the cache directory before the
+		// stage resources are destroyed.
+		ImageCache *ImageCache `json:"image_cache,omitempty"`
 	}
 
 	DestroyResponse struct {
-		OSStats *spec.OSStats `json:"os_stats,omitempty"`
+		OSStats *spec.OSStats        `json:"os_stats,omitempty"`
+		Egress  []*EgressDestination `json:"egress,omitempty"` // outbound destinations of the steps, with the egress proxy
+	}
+
+	// EgressDestination is the outbound traffic of the steps to a host
+	// through the egress proxy of the stage.
+	EgressDestination struct {
+		Host          string      `json:"host"` // host:port
+		Requests      int         `json:"requests"`
+		BytesSent     int64       `json:"bytes_sent"`
+		BytesReceived int64       `json:"bytes_received"`
+		StatusCodes   map[int]int `json:"status_codes,omitempty"` // responses by status code, 200 for the HTTPS tunnels
+		Errors        int         `json:"errors,omitempty"`       // requests the proxy could not forward
+	}
+
+	// ResourcesResponse lists the docker resources created by the engine.
+	ResourcesResponse struct {
+		Containers []Resource `json:"containers,omitempty"`
+		Volumes    []Resource `json:"volumes,omitempty"`
+		Networks   []Resource `json:"networks,omitempty"`
+	}
+
+	Resource struct {
+		ID     string            `json:"id"`
+		Name   string            `json:"name,omitempty"`
+		Labels map[string]string `json:"labels,omitempty"`
+		State  string            `json:"state,omitempty"` // containers only
+	}
+
+	// TimelineResponse is the timeline of the steps of the current or of
+	// the last stage, to see where the wall-clock time of the stage went.
+	TimelineResponse struct {
+		StartedAt  time.Time       `json:"started_at"`
+		EndedAt    *time.Time      `json:"ended_at,omitempty"` // once the stage is destroyed
+		DurationMs int64           `json:"duration_ms"`
+		Steps      []*TimelineStep `json:"steps"`
+	}
+
+	TimelineStep struct {
+		ID          string           `json:"id"`
+		Name        string           `json:"name,omitempty"`
+		Image       string           `json:"image,omitempty"`
+		ContainerID string           `json:"container_id,omitempty"`
+		DependsOn   []string         `json:"depends_on,omitempty"`
+		StartedAt   time.Time        `json:"started_at"`
+		EndedAt     *time.Time       `json:"ended_at,omitempty"` // once the step completed
+		DurationMs  int64            `json:"duration_ms"`
+		Status      string           `json:"status"` // running, succeeded or failed
+		Phases      []*TimelinePhase `json:"phases,omitempty"`
+	}
+
+	// TimelinePhase is the time spent in a phase of a step: pull, create,
+	// execute or post_process.
+	TimelinePhase struct {
+		Name       string `json:"name"`
+		DurationMs int64  `json:"duration_ms"`
+	}
+
+	// ArtifactsResponse lists the reports and the artifacts of the steps
+	// retained by the engine, see the ARTIFACT_RETENTION_DIR config.
+	ArtifactsResponse struct {
+		Entries []*ArtifactEntry `json:"entries"`
+	}
+
+	// ArtifactEntry is the files retained of an execution of a step. The
+	// entry is fetched as a tar.gz archive at /artifacts/<name> and its
+	// files at /artifacts/<name>/<path>.
+	ArtifactEntry struct {
+		Name       string          `json:"name"`
+		StepID     string          `json:"step_id"`
+		RetainedAt time.Time       `json:"retained_at"`
+		Size       int64           `json:"size"`
+		Files      []*ArtifactFile `json:"files"`
+	}
+
+	ArtifactFile struct {
+		Path string `json:"path"` // relative to the working directory of the step
+		Size int64  `json:"size"`
+	}
+
+	// DrainRequest stops the engine from accepting new steps and shuts it
+	// down once the running steps completed, eg. before a spot instance is
+	// terminated.
+	DrainRequest struct {
+		Timeout int `json:"timeout,omitempty"` // seconds to wait for the running steps, 120 if not set
+	}
+
+	DrainResponse struct {
+		Drained bool `json:"drained"`           // all the running steps completed before the timeout
+		Running int  `json:"running,omitempty"` // steps still running at the timeout
+	}
+
+	// PauseRequest pauses the running step containers of the stage, eg.
+	// before an idle VM hibernates.
+	PauseRequest struct {
+		Checkpoint bool   `json:"checkpoint,omitempty"` // checkpoint the containers with CRIU instead of freezing them, if the daemon supports it
+		StageID    string `json:"stage_id,omitempty"`   // write the engine state to the state dir of the engine under this id, to resume the stage after an engine restart
+	}
+
+	PauseResponse struct {
+		Containers []PausedContainer `json:"containers,omitempty"`
+	}
+
+	PausedContainer struct {
+		ID           string `json:"id"`
+		Checkpointed bool   `json:"checkpointed,omitempty"`
+	}
+
+	ResumeRequest struct {
+		StageID string `json:"stage_id,omitempty"` // id of the engine state written by the pause, read if the engine restarted
+	}
+
+	ResumeResponse struct {
+		Containers []string `json:"containers,omitempty"` // ids of the resumed containers
 	}
 
 	StartStepRequest struct {
@@ -46,14 +303,22 @@ type (
 		Envs           map[string]string `json:"environment,omitempty"`
 		Name           string            `json:"name,omitempty"`
 		LogKey         string            `json:"log_key,omitempty"`
+		ReuseLogKey    bool              `json:"reuse_log_key,omitempty"` // write to the log key even if another step of the stage used it
 		LogDrone       bool              `json:"log_drone"`
 		Secrets        []string          `json:"secrets,omitempty"`
+		SealedEnvs     map[string]string `json:"sealed_envs,omitempty"` // envs sealed with the public key of the engine, added to the envs and secrets
 		WorkingDir     string            `json:"working_dir,omitempty"`
 		Kind           StepType          `json:"kind,omitempty"`
 		Run            RunConfig         `json:"run,omitempty"`
 		RunTest        RunTestConfig     `json:"run_test,omitempty"`
 		RunTestsV2     RunTestsV2Config  `json:"run_test_v2,omitempty"`
+		Terraform      TerraformConfig   `json:"terraform,omitempty"`
+		Cache          CacheConfig       `json:"cache,omitempty"`
+		Upload         UploadConfig      `json:"upload,omitempty"`
+		Audit          AuditConfig       `json:"audit,omitempty"`
+		ImageOp        ImageOpConfig     `json:"image_op,omitempty"`
 		SoftStop       bool              `json:"soft_stop,omitempty"`
+		DependsOn      []string          `json:"depends_on,omitempty"` // ids of the steps the step waited for, shown in the stage timeline
 
 		// Configs for log service and test intelligence (currently provided in setup and maintained as state)
 		// TODO (Vistaar): LogConfig might be moved out from here.
@@ -66,6 +331,17 @@ type (
 		MountDockerSocket *bool       `json:"mount_docker_socket"`
 		Outputs           []*OutputV2 `json:"outputs,omitempty"`
 
+		// Timeout in seconds of the post-processing of the step output, eg. the report
+		// parsing and the call graph upload. If set, the step timeout only covers the
+		// execution of the command and a post-processing overrun is reported as a
+		// warning instead of failing the step.
+		PostProcessingTimeout int `json:"post_processing_timeout,omitempty"`
+
+		// Readiness is checked once a detached step started, the start of the
+		// step returns once it succeeds so that the next steps do not race
+		// against a slow starting service.
+		Readiness *ReadinessProbe `json:"readiness,omitempty"`
+
 		// File to read from to fetch output variables. Note: If this is set, we ignore
 		// output_vars and instead read directly from the file to fetch output variables.
 		OutputVarFile string `json:"output_var_file,omitempty"`
@@ -100,18 +376,80 @@ type (
 		Privileged   bool                 `json:"privileged,omitempty"`
 		Pull         spec.PullPolicy      `json:"pull,omitempty"`
 		ShmSize      int64                `json:"shm_size,omitempty"`
-		User         string               `json:"user,omitempty"`
+		User         string               `json:"user,omitempty"`      // user or uid[:gid] of the step container
+		GroupAdd     []string             `json:"group_add,omitempty"` // supplemental groups of the step container
+		HostUser     bool                 `json:"host_user,omitempty"` // run the container as the uid, gid and groups of the engine, eg. for bind mount permissions
 		Volumes      []*spec.VolumeMount  `json:"volumes,omitempty"`
 		Files        []*spec.File         `json:"files,omitempty"`
 		StepStatus   StepStatusConfig     `json:"step_status,omitempty"`
+		Clock        *spec.Clock          `json:"clock,omitempty"`
+		Umask        string               `json:"umask,omitempty"` // octal umask of the step files and of the sh and bash commands, eg. 0027
+		// OCIRuntime runs the container of the step, eg. runsc to sandbox
+		// the step with gVisor or kata, while the other steps of the stage
+		// use the default runtime of the daemon. default or not set for the
+		// default runtime.
+		OCIRuntime string `json:"oci_runtime,omitempty"`
+		// SecurityContext drops the capabilities, confines the syscalls and
+		// makes the root filesystem of the container of the step read-only,
+		// eg. to run the untrusted builds.
+		SecurityContext *spec.SecurityContext `json:"security_context,omitempty"`
+		// Platform of the image of the step, os and arch with the optional
+		// variant, eg. linux/amd64 emulated on an arm64 host. The image is
+		// pulled for the platform unless the local image matches it.
+		Platform *spec.Platform `json:"platform,omitempty"`
+		// Isolation of the windows container of the step: process, hyperv
+		// or hostprocess, the default of the daemon if not set or default.
+		// HostProcess containers are only supported by the kubernetes
+		// backend.
+		Isolation string `json:"isolation,omitempty"`
+		// GPUs reserves the GPUs of the host for the container of the step,
+		// eg. "all" for the ML test suites on the GPU hosted VMs. Only
+		// supported by the docker backend.
+		GPUs *spec.GPUs `json:"gpus,omitempty"`
+
+		// WorkspaceClone runs the step in its own copy-on-write clone of the
+		// workspace, eg. for the parallel test shards mutating it. The clone
+		// is removed with the stage.
+		WorkspaceClone bool `json:"workspace_clone,omitempty"`
+
+		// WarmContainer runs the command of the test step in the container
+		// of the stage with the name, created by the first step using it
+		// and kept running until the stage is destroyed, so the gradle
+		// daemon or mvnd started by a step is reused by the next ones. The
+		// steps sharing it run the same image, its volumes and resources
+		// are the ones of the first step, eg. the mounted caches.
+		WarmContainer string `json:"warm_container,omitempty"`
+
+		// IsolatedHome runs the step with its own empty HOME directory, so
+		// the files written to the home by the step, eg. a .bazelrc, do not
+		// leak to the next steps or to the VM. It is removed once the step
+		// completes, or with the stage for the detached steps.
+		IsolatedHome bool `json:"isolated_home,omitempty"`
+
+		// Checkpoint snapshots the checkpoint paths of the step while it
+		// runs and restores the last snapshot when it starts, eg. on retry.
+		Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	}
+
+	// Checkpoint is the object storage the checkpoint paths of a step are
+	// snapshotted to, as tar.gz archives.
+	Checkpoint struct {
+		Paths       []string          `json:"paths"`                  // relative to the working directory
+		Interval    int               `json:"interval,omitempty"`     // seconds between the snapshots, 300 if not set
+		UploadURL   string            `json:"upload_url"`             // the snapshots are PUT to the url, eg. a pre-signed url
+		DownloadURL string            `json:"download_url,omitempty"` // the url of the snapshot restored, the upload url if not set
+		Headers     map[string]string `json:"headers,omitempty"`      // eg. the authorization of the storage
 	}
 	OutputV2 struct {
-		Key   string     `json:"key,omitempty"`
-		Value string     `json:"value"`
-		Type  OutputType `json:"type,omitempty"`
+		Key       string     `json:"key,omitempty"`
+		Value     string     `json:"value"`
+		Type      OutputType `json:"type,omitempty"`
+		Encrypted bool       `json:"encrypted,omitempty"` // the value is sealed with the output key of the stage
 	}
 
-	StartStepResponse struct{}
+	StartStepResponse struct {
+		LogKey string `json:"log_key,omitempty"` // log key the step output is written to
+	}
 
 	PollStepRequest struct {
 		ID string `json:"id,omitempty"`
@@ -127,6 +465,59 @@ type (
 		Artifact          []byte            `json:"artifact,omitempty"`
 		OutputV2          []*OutputV2       `json:"outputV2,omitempty"`
 		OptimizationState string            `json:"optimization_state,omitempty"`
+		CommandStatus     []*CommandStatus  `json:"command_status,omitempty"`
+		Errors            []*StepError      `json:"errors,omitempty"` // errors by the part of the step execution which failed
+		Annotations       []*Annotation     `json:"annotations,omitempty"`
+		Telemetry         *TelemetryData    `json:"telemetry,omitempty"`
+		LogKey            string            `json:"log_key,omitempty"` // log key the step output is written to
+	}
+
+	// TelemetryData is the resources consumed by the container or the host
+	// process of a step, for the attribution of the cost of the builds and
+	// the diagnosis of the steps killed out of memory. The memory and the
+	// network egress over time are only metered for the containers.
+	TelemetryData struct {
+		CPUSeconds      float64 `json:"cpu_seconds"`
+		MemoryGBSeconds float64 `json:"memory_gb_seconds"`
+		NetworkEgressGB float64 `json:"network_egress_gb"`
+		PeakMemoryBytes uint64  `json:"peak_memory_bytes,omitempty"`
+		IOReadBytes     uint64  `json:"io_read_bytes,omitempty"`
+		IOWriteBytes    uint64  `json:"io_write_bytes,omitempty"`
+
+		TestSelection   *TestSelectionTelemetry `json:"test_selection,omitempty"` // change since the previous run of the step
+		TestRegressions []*TestRegression       `json:"test_regressions,omitempty"`
+	}
+
+	// TestRegression is a test that took significantly longer than its
+	// historical average.
+	TestRegression struct {
+		Name         string  `json:"name"`
+		DurationMs   int64   `json:"duration_ms"`
+		HistoricalMs int64   `json:"historical_ms"`
+		IncreasePct  float64 `json:"increase_pct"`
+	}
+
+	// TestSelectionTelemetry is the change of the tests selected by test
+	// intelligence since the previous run of the step.
+	TestSelectionTelemetry struct {
+		Selected      int  `json:"selected"`
+		NewlySelected int  `json:"newly_selected"`
+		NewlySkipped  int  `json:"newly_skipped"`
+		SelectAll     bool `json:"select_all,omitempty"`
+		PrevSelectAll bool `json:"prev_select_all,omitempty"`
+	}
+
+	// Annotation is a markdown summary of the step to be published in the pipeline summary.
+	Annotation struct {
+		Context  string          `json:"context"` // identifies the annotation within the step
+		Style    AnnotationStyle `json:"style,omitempty"`
+		Markdown string          `json:"markdown"`
+	}
+
+	StepError struct {
+		Stage     StepErrorStage `json:"stage"`
+		Message   string         `json:"message"`
+		Retryable bool           `json:"retryable,omitempty"`
 	}
 
 	StreamOutputRequest struct {
@@ -137,6 +528,27 @@ type (
 	RunConfig struct {
 		Command    []string `json:"commands,omitempty"`
 		Entrypoint []string `json:"entrypoint,omitempty"`
+		// Shell used to execute the commands. If set, it takes precedence over
+		// inferring the shell from the entrypoint.
+		Shell Shell `json:"shell,omitempty"`
+		// Sequence of commands executed one after the other. The exit status and
+		// timing of each command is reported back in the poll response.
+		// Command must be empty if this is set.
+		Sequence []*RunCommand `json:"sequence,omitempty"`
+	}
+
+	RunCommand struct {
+		Command         string `json:"command,omitempty"`
+		ContinueOnError bool   `json:"continue_on_error,omitempty"`
+	}
+
+	CommandStatus struct {
+		Index      int    `json:"index"`
+		Command    string `json:"command,omitempty"`
+		ExitCode   int    `json:"exit_code"`
+		Skipped    bool   `json:"skipped,omitempty"`
+		StartedAt  int64  `json:"started_at,omitempty"` // unix time in seconds
+		DurationMs int64  `json:"duration_ms"`
 	}
 
 	RunTestsV2Config struct {
@@ -144,6 +556,120 @@ type (
 		Entrypoint       []string `json:"entrypoint,omitempty"`
 		TestGlobs        []string `json:"test_globs,omitempty"`
 		IntelligenceMode bool     `json:"intelligence_mode,omitempty"`
+		// InstrPackages are the packages instrumented by the java and .net
+		// agents, eg. com.acme.billing, instead of the packages inferred
+		// from the sources. ExcludePackages are never instrumented.
+		InstrPackages   []string `json:"instr_packages,omitempty"`
+		ExcludePackages []string `json:"exclude_packages,omitempty"`
+		// DebugBundle exports the context of the test selection, the
+		// changed files, the TI request and response, the filter files and
+		// the final command, into a bundle retained with the reports.
+		DebugBundle bool `json:"debug_bundle,omitempty"`
+	}
+
+	// TerraformConfig runs terraform validate or plan, or the go tests of a
+	// terraform module, eg. with terratest, and parses their results into
+	// the step outputs and an annotation.
+	TerraformConfig struct {
+		Command    TerraformCommand `json:"command,omitempty"` // plan if not set
+		Dir        string           `json:"dir,omitempty"`     // root module, relative to the working dir
+		Args       string           `json:"args,omitempty"`    // appended to the command, eg. -var-file=prod.tfvars
+		Binary     string           `json:"binary,omitempty"`  // terraform if not set, eg. tofu
+		Entrypoint []string         `json:"entrypoint,omitempty"`
+	}
+
+	// CacheConfig restores or saves the cache of a CacheRestore or a
+	// CacheSave step. The steps run in the engine, the paths are extracted
+	// to and archived from the working directory on the host.
+	CacheConfig struct {
+		// Key is the template of the cache key, eg. go-{{ os }}-{{ checksum "go.sum" }}.
+		Key string `json:"key,omitempty"`
+		// RestoreKeys are the templates of the keys restored if the key
+		// misses, tried in order.
+		RestoreKeys []string `json:"restore_keys,omitempty"`
+		Paths       []string `json:"paths,omitempty"`    // saved, relative to the working directory
+		Override    bool     `json:"override,omitempty"` // save even if the key exists
+		Backend     Storage  `json:"backend,omitempty"`  // stores the caches as tar.zst archives
+	}
+
+	// ReadinessProbe checks a detached step is ready with one of a tcp
+	// connection, an http request or a command exiting with 0.
+	ReadinessProbe struct {
+		TCP      *TCPProbe  `json:"tcp,omitempty"`
+		HTTP     *HTTPProbe `json:"http,omitempty"`
+		Command  []string   `json:"command,omitempty"`  // run in the container of the step, or on the host for the host steps
+		Interval int        `json:"interval,omitempty"` // seconds between the probes, 1 if not set
+		Timeout  int        `json:"timeout,omitempty"`  // seconds until the step is not ready, 60 if not set
+	}
+
+	TCPProbe struct {
+		Host string `json:"host,omitempty"` // localhost if not set
+		Port int    `json:"port"`
+	}
+
+	// HTTPProbe is ready once the GET request returns a 2xx or 3xx status.
+	HTTPProbe struct {
+		Scheme string `json:"scheme,omitempty"` // http if not set
+		Host   string `json:"host,omitempty"`   // localhost if not set
+		Port   int    `json:"port"`
+		Path   string `json:"path,omitempty"`
+	}
+
+	// UploadConfig uploads the files of an Upload step. The step runs in
+	// the engine, the links of the uploaded files are set as the artifact
+	// of the step.
+	UploadConfig struct {
+		Paths   []string `json:"paths,omitempty"`  // globs of the files, relative to the working directory
+		Target  string   `json:"target,omitempty"` // prefix of the files in the storage, eg. builds/42
+		Storage Storage  `json:"storage,omitempty"`
+	}
+
+	// AuditConfig audits the dependencies pinned by the lockfiles of an
+	// Audit step against the OSV database. The step runs in the engine,
+	// the counts of the findings by severity are set as its outputs.
+	AuditConfig struct {
+		// Lockfiles are the globs of the lockfiles, relative to the working
+		// directory. The supported lockfiles of the working directory if
+		// not set, see audit.Lockfiles.
+		Lockfiles []string `json:"lockfiles,omitempty"`
+		URL       string   `json:"url,omitempty"`     // of the OSV API, eg. a mirror, https://api.osv.dev if not set
+		FailOn    string   `json:"fail_on,omitempty"` // fails the step on the findings of the severity or more severe, eg. high
+		// Report is the findings report written to the working directory,
+		// dependency-audit.json if not set. It is uploaded to the storage
+		// and set as the artifact of the step if the storage is set.
+		Report  string   `json:"report,omitempty"`
+		Target  string   `json:"target,omitempty"` // prefix of the report in the storage
+		Storage *Storage `json:"storage,omitempty"`
+	}
+
+	// ImageOpConfig copies, inspects or tags an image of a registry in an
+	// ImageOp step. The step runs in the engine with the registries of the
+	// stage, without docker. The digest and the media type of the image,
+	// and the platforms of an inspected image, are set as its outputs.
+	ImageOpConfig struct {
+		Operation ImageOperation `json:"operation,omitempty"` // copy if not set
+		Source    string         `json:"source"`              // eg. registry.example.com/app:1.2 or app@sha256:...
+		// Targets are the images the source is copied to, with all its
+		// platforms, or the tags the source is tagged with in its
+		// repository.
+		Targets []string `json:"targets,omitempty"`
+	}
+
+	// Storage is a directory of the host or an object storage.
+	Storage struct {
+		Kind         StorageKind `json:"kind,omitempty"`
+		Path         string      `json:"path,omitempty"`     // directory of the local storage
+		Bucket       string      `json:"bucket,omitempty"`   // the container with azure
+		Prefix       string      `json:"prefix,omitempty"`   // of the objects in the bucket
+		Region       string      `json:"region,omitempty"`   // us-east-1 if not set, auto with gcs
+		Endpoint     string      `json:"endpoint,omitempty"` // eg. a minio server, the endpoint of the kind if not set
+		PathStyle    bool        `json:"path_style,omitempty"`
+		AccessKey    string      `json:"access_key,omitempty"` // the HMAC keys with gcs
+		SecretKey    string      `json:"secret_key,omitempty"`
+		SessionToken string      `json:"session_token,omitempty"`
+		Account      string      `json:"account,omitempty"`     // azure storage account
+		AccountKey   string      `json:"account_key,omitempty"` // azure shared key, base64 encoded
+		SASToken     string      `json:"sas_token,omitempty"`   // azure shared access signature, instead of the account key
 	}
 
 	RunTestConfig struct {
@@ -159,6 +685,25 @@ type (
 		TestSplitStrategy    string   `json:"test_split_strategy,omitempty"`
 		ParallelizeTests     bool     `json:"parallelize_tests,omitempty"`
 		TestGlobs            string   `json:"test_globs,omitempty"`
+		DebugBundle          bool     `json:"debug_bundle,omitempty"` // exports the context of the test selection into a retained bundle
+	}
+
+	// StageBudget limits the time of a stage beyond the timeouts of its
+	// steps: the wall clock since the setup and the sum of the durations of
+	// the steps, in seconds. Unlimited if not set.
+	StageBudget struct {
+		MaxDuration     int64 `json:"max_duration,omitempty"`
+		MaxStepDuration int64 `json:"max_step_duration,omitempty"`
+	}
+
+	// TelemetrySampling is the percentage of the steps returning their
+	// telemetry, for the account and the pipeline of the TI config. The
+	// percentage of the pipeline takes precedence over the one of the
+	// account and the default. The failed steps always return it.
+	TelemetrySampling struct {
+		Percent   *float64           `json:"percent,omitempty"` // 100 if not set
+		Accounts  map[string]float64 `json:"accounts,omitempty"`
+		Pipelines map[string]float64 `json:"pipelines,omitempty"`
 	}
 
 	LogConfig struct {
@@ -167,6 +712,67 @@ type (
 		URL               string `json:"url,omitempty"`
 		Token             string `json:"token,omitempty"`
 		TrimNewLineSuffix bool   `json:"trim_new_line_suffix,omitempty"`
+		// MaxPendingLines is the number of lines waiting to be streamed
+		// above which the log service is considered to fall behind. The
+		// informational lines are then dropped from the live log, the
+		// error lines and the tail of the step are kept. 5000 if not set.
+		MaxPendingLines int `json:"max_pending_lines,omitempty"`
+		// StructuredLogs parses the lines written as JSON objects by the
+		// tools, their level and fields are forwarded to the log service.
+		StructuredLogs bool `json:"structured_logs,omitempty"`
+		// Sinks are the destinations of the step logs in addition to the
+		// log service.
+		Sinks []LogSink `json:"sinks,omitempty"`
+		// MaskPatterns are the regular expressions whose matches are masked
+		// in the logs of all the steps, eg. <password>(.*?)</password>. The
+		// groups are masked instead of the match if the pattern has any.
+		MaskPatterns []string `json:"mask_patterns,omitempty"`
+		// MaskPatternsFile is a file of the host with a mask pattern per
+		// line, in addition to the mask patterns.
+		MaskPatternsFile string `json:"mask_patterns_file,omitempty"`
+		// MaskHighEntropy masks the strings which look like credentials in
+		// no known format, see logstream.EntropyDetector. The min length
+		// and the threshold, in bits per character, are the defaults of the
+		// detector if not set.
+		MaskHighEntropy      bool    `json:"mask_high_entropy,omitempty"`
+		HighEntropyMinLength int     `json:"high_entropy_min_length,omitempty"`
+		HighEntropyThreshold float64 `json:"high_entropy_threshold,omitempty"`
+		// BatchSize is the number of lines written to the log service at
+		// once, all the lines buffered if not set. The lines are flushed as
+		// soon as a batch is full, or every FlushIntervalMs (1000).
+		BatchSize       int `json:"batch_size,omitempty"`
+		FlushIntervalMs int `json:"flush_interval_ms,omitempty"`
+		// UploadWorkers is the number of batches written concurrently, 1 if
+		// not set. The batches of concurrent workers can reach the log
+		// service out of order.
+		UploadWorkers int `json:"upload_workers,omitempty"`
+		// CompressUpload gzips the full logs uploaded through the log
+		// service, see IndirectUpload.
+		CompressUpload bool `json:"compress_upload,omitempty"`
+	}
+
+	// LogSink is a destination of the step logs: a local rotating file,
+	// stdout, a Grafana Loki server or a CloudWatch Logs log group.
+	LogSink struct {
+		Kind LogSinkKind `json:"kind"`
+
+		Path     string `json:"path,omitempty"`      // the log file of the file sink
+		MaxSize  int64  `json:"max_size,omitempty"`  // the size above which the file is rotated, 10MiB if not set
+		MaxFiles int    `json:"max_files,omitempty"` // the number of rotated files kept, 5 if not set
+
+		URL      string            `json:"url,omitempty"`       // the base url of the loki server
+		Labels   map[string]string `json:"labels,omitempty"`    // the labels of the loki streams, in addition to the log key and level
+		TenantID string            `json:"tenant_id,omitempty"` // the loki tenant, if multi-tenant
+		Username string            `json:"username,omitempty"`  // the basic auth credentials of the loki server
+		Password string            `json:"password,omitempty"`
+		Token    string            `json:"token,omitempty"` // the bearer token of the loki server, instead of basic auth
+
+		LogGroup     string `json:"log_group,omitempty"` // the cloudwatch log group, a log stream is created per log key
+		Region       string `json:"region,omitempty"`    // us-east-1 if not set
+		Endpoint     string `json:"endpoint,omitempty"`  // the endpoint of the region if not set
+		AccessKey    string `json:"access_key,omitempty"`
+		SecretKey    string `json:"secret_key,omitempty"`
+		SessionToken string `json:"session_token,omitempty"`
 	}
 
 	TIConfig struct {
@@ -188,11 +794,42 @@ type (
 	}
 
 	TestReport struct {
-		Kind  ReportType  `json:"kind,omitempty"`
-		Junit JunitReport `json:"junit,omitempty"`
+		Kind ReportType `json:"kind,omitempty"`
+		// Junit sets the report files of all the kinds, eg. the TAP files
+		// for the tap kind. The streaming applies to the junit kind only.
+		Junit   JunitReport     `json:"junit,omitempty"`
+		Quality []QualityReport `json:"quality,omitempty"`
+		Sarif   *SarifReport    `json:"sarif,omitempty"`
 	}
 
 	JunitReport struct {
+		Paths  []string `json:"paths,omitempty"`
+		Ignore []string `json:"ignore,omitempty"` // globs of the files which are not test reports
+		// Language selects the default paths of the reports if no paths are
+		// set, eg. java for the surefire and gradle reports. All the XML and
+		// TRX files are collected if not set.
+		Language string `json:"language,omitempty"`
+		// Streaming parses the reports test case by test case and uploads
+		// the tests by batches of BatchSize, 1000 if not set, for the
+		// report sets too large to be held in memory. The test summary
+		// annotations, the regressions and the attachments are not
+		// collected in the streaming mode.
+		Streaming bool `json:"streaming,omitempty"`
+		BatchSize int  `json:"batch_size,omitempty"`
+		// MaxTests caps the number of parsed test cases, no limit if not set.
+		MaxTests int `json:"max_tests,omitempty"`
+	}
+
+	// QualityReport are static analysis reports, eg. of lint steps. The format
+	// is detected from the content of the files if not set.
+	QualityReport struct {
+		Format string   `json:"format,omitempty"` // checkstyle, eslint or spotbugs
+		Paths  []string `json:"paths,omitempty"`
+	}
+
+	// SarifReport are the SARIF files of the step, eg. of security scanners.
+	// The *.sarif and *.sarif.json files are collected if no paths are set.
+	SarifReport struct {
 		Paths []string `json:"paths,omitempty"`
 	}
 
@@ -213,6 +850,11 @@ type (
 		Artifact               []byte                 `json:"artifact,omitempty"`
 		Outputs                []*OutputV2            `json:"outputs,omitempty"`
 		OptimizationState      string                 `json:"optimization_state,omitempty"`
+		CommandStatus          []*CommandStatus       `json:"command_status,omitempty"`
+		Errors                 []*StepError           `json:"errors,omitempty"`
+		Annotations            []*Annotation          `json:"annotations,omitempty"`
+		Telemetry              *TelemetryData         `json:"telemetry,omitempty"`
+		LogKey                 string                 `json:"log_key,omitempty"` // log key the step output is written to
 	}
 )
 
@@ -224,9 +866,92 @@ const (
 	Timeout CommandExecutionStatus = "TIMEOUT"
 )
 
+// StepErrorStage is the part of the step execution an error occurred in.
+type StepErrorStage string
+
+const (
+	StepErrorStageRun          StepErrorStage = "run"
+	StepErrorStageLogClose     StepErrorStage = "log-close"
+	StepErrorStageReportUpload StepErrorStage = "report-upload"
+	StepErrorStageCgUpload     StepErrorStage = "cg-upload"
+
+	StepErrorStagePostProcessing StepErrorStage = "post-processing"
+	StepErrorStageReadiness      StepErrorStage = "readiness" // the detached step never became ready
+)
+
+type AnnotationStyle string
+
+const (
+	AnnotationStyleInfo    AnnotationStyle = "info"
+	AnnotationStyleSuccess AnnotationStyle = "success"
+	AnnotationStyleError   AnnotationStyle = "error"
+)
+
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest  ErrorCode = "BAD_REQUEST"
+	ErrorCodeNotFound    ErrorCode = "NOT_FOUND"
+	ErrorCodeTooLarge    ErrorCode = "REQUEST_TOO_LARGE"
+	ErrorCodeUnavailable ErrorCode = "UNAVAILABLE" // the engine is draining
+	ErrorCodeInternal    ErrorCode = "INTERNAL"
+
+	ErrorCodeBudgetExceeded ErrorCode = "BUDGET_EXCEEDED" // the budget of the stage is exhausted
+)
+
 type OutputType string
 
 const (
 	OutputTypeString OutputType = "STRING"
 	OutputTypeSecret OutputType = "SECRET"
 )
+
+// Shell defines the shell used to execute the step commands.
+type Shell string
+
+const (
+	ShellSh         Shell = "sh"
+	ShellBash       Shell = "bash"
+	ShellPwsh       Shell = "pwsh"
+	ShellPowershell Shell = "powershell"
+	ShellCmd        Shell = "cmd"
+	ShellPython     Shell = "python"
+)
+
+// StorageKind defines the kind of a storage.
+type StorageKind string
+
+const (
+	StorageLocal StorageKind = "local" // a directory of the host, eg. a shared volume
+	StorageS3    StorageKind = "s3"    // an s3 compatible bucket
+	StorageGCS   StorageKind = "gcs"   // a gcs bucket through its s3 compatible api
+	StorageAzure StorageKind = "azure" // an azure blob storage container
+)
+
+// LogSinkKind defines the kind of a log sink.
+type LogSinkKind string
+
+const (
+	LogSinkFile       LogSinkKind = "file"       // a rotating file of JSON lines on the host
+	LogSinkStdout     LogSinkKind = "stdout"     // the stdout of the engine
+	LogSinkLoki       LogSinkKind = "loki"       // a grafana loki server
+	LogSinkCloudWatch LogSinkKind = "cloudwatch" // a cloudwatch logs log group
+)
+
+// TerraformCommand defines the command of a terraform step.
+type TerraformCommand string
+
+const (
+	TerraformValidate  TerraformCommand = "validate"
+	TerraformPlan      TerraformCommand = "plan"
+	TerraformTerratest TerraformCommand = "terratest" // go test of the module tests
+)
+
+// ImageOperation defines the operation of an image step.
+type ImageOperation string
+
+const (
+	ImageCopy    ImageOperation = "copy"
+	ImageInspect ImageOperation = "inspect"
+	ImageTag     ImageOperation = "tag" // the source is pushed with the tags of the targets
+)
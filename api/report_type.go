@@ -15,6 +15,10 @@ type ReportType int
 // ReportType enumeration.
 const (
 	Junit ReportType = iota
+	Tap
+	GoTest // the output of go test -json
+	NUnit  // the NUnit 3 XML reports
+	XUnit  // the xUnit.net v2 XML reports
 )
 
 func (s ReportType) String() string {
@@ -22,12 +26,24 @@ func (s ReportType) String() string {
 }
 
 var reportTypeID = map[ReportType]string{
-	Junit: "Junit",
+	Junit:  "Junit",
+	Tap:    "Tap",
+	GoTest: "GoTest",
+	NUnit:  "NUnit",
+	XUnit:  "XUnit",
 }
 
 var reportTypeName = map[string]ReportType{
-	"":      Junit,
-	"Junit": Junit,
+	"":       Junit,
+	"Junit":  Junit,
+	"Tap":    Tap,
+	"tap":    Tap,
+	"GoTest": GoTest,
+	"gotest": GoTest,
+	"NUnit":  NUnit,
+	"nunit":  NUnit,
+	"XUnit":  XUnit,
+	"xunit":  XUnit,
 }
 
 // MarshalJSON marshals the string representation of the
@@ -17,6 +17,12 @@ const (
 	Run StepType = iota
 	RunTest
 	RunTestsV2
+	Terraform
+	CacheRestore
+	CacheSave
+	Upload
+	Audit
+	ImageOp
 )
 
 func (s StepType) String() string {
@@ -27,6 +33,13 @@ var stepTypeID = map[StepType]string{
 	Run:        "Run",
 	RunTest:    "RunTest",
 	RunTestsV2: "RunTestsV2",
+	Terraform:  "Terraform",
+
+	CacheRestore: "CacheRestore",
+	CacheSave:    "CacheSave",
+	Upload:       "Upload",
+	Audit:        "Audit",
+	ImageOp:      "ImageOp",
 }
 
 var stepTypeName = map[string]StepType{
@@ -34,6 +47,13 @@ var stepTypeName = map[string]StepType{
 	"Run":        Run,
 	"RunTest":    RunTest,
 	"RunTestsV2": RunTestsV2,
+	"Terraform":  Terraform,
+
+	"CacheRestore": CacheRestore,
+	"CacheSave":    CacheSave,
+	"Upload":       Upload,
+	"Audit":        Audit,
+	"ImageOp":      ImageOp,
 }
 
 // MarshalJSON marshals the string representation of the
@@ -0,0 +1,146 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package audit audits the dependencies pinned by the lockfiles of the
+// workspace against the OSV database, without a scanner plugin image.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/tarball"
+)
+
+// Severity is the qualitative severity of a vulnerability.
+type Severity string
+
+// Severity enumeration, from the most severe.
+const (
+	Critical Severity = "CRITICAL"
+	High     Severity = "HIGH"
+	Medium   Severity = "MEDIUM"
+	Low      Severity = "LOW"
+	Unknown  Severity = "UNKNOWN"
+)
+
+// Severities are the severities from the most severe.
+var Severities = []Severity{Critical, High, Medium, Low, Unknown}
+
+// rank returns the rank of the severity, 0 for the most severe.
+func (s Severity) rank() int {
+	for i, v := range Severities {
+		if v == s {
+			return i
+		}
+	}
+	return len(Severities)
+}
+
+const requestTimeout = time.Minute
+
+// Finding is a vulnerability of a package.
+type Finding struct {
+	Package
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity Severity `json:"severity"`
+	Fixed    []string `json:"fixed,omitempty"` // the versions fixing the vulnerability
+}
+
+// Report is the findings report of the audit of the lockfiles.
+type Report struct {
+	Lockfiles []string         `json:"lockfiles"`
+	Packages  int              `json:"packages"`
+	Counts    map[Severity]int `json:"counts"`
+	Findings  []*Finding       `json:"findings"`
+}
+
+// Validate returns the issues of the audit configuration of a step.
+func Validate(cfg *api.AuditConfig) []string {
+	var issues []string
+	for _, p := range cfg.Lockfiles {
+		if !tarball.Local(p) {
+			issues = append(issues, fmt.Sprintf("audit lockfile %q needs to be relative to the working directory", p))
+		}
+	}
+	if cfg.Report != "" && !tarball.Local(cfg.Report) {
+		issues = append(issues, fmt.Sprintf("audit report %q needs to be relative to the working directory", cfg.Report))
+	}
+	if cfg.FailOn != "" && Severity(strings.ToUpper(cfg.FailOn)).rank() == len(Severities) {
+		issues = append(issues, fmt.Sprintf("unsupported audit severity %q", cfg.FailOn))
+	}
+	return issues
+}
+
+// Run audits the lockfiles of the directory matching the globs, or all of
+// them if no glob is set, against the OSV API at url.
+func Run(ctx context.Context, dir string, globs []string, url string) (*Report, error) {
+	lockfiles, err := Lockfiles(dir, globs)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, l := range lockfiles {
+		p, err := Parse(dir, l)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p...)
+	}
+	report := &Report{Lockfiles: lockfiles, Packages: len(pkgs), Counts: make(map[Severity]int), Findings: []*Finding{}}
+	if len(pkgs) == 0 {
+		return report, nil
+	}
+
+	if url == "" {
+		url = DefaultURL
+	}
+	c := &osvClient{url: url, client: &http.Client{Timeout: requestTimeout}}
+	ids, err := c.query(ctx, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	vulns := make(map[string]*osvVuln)
+	for i := range pkgs {
+		for _, id := range ids[i] {
+			v, ok := vulns[id]
+			if !ok {
+				if v, err = c.vuln(ctx, id); err != nil {
+					return nil, err
+				}
+				vulns[id] = v
+			}
+			f := &Finding{Package: pkgs[i], ID: id, Aliases: v.Aliases, Summary: v.Summary,
+				Severity: v.severity(), Fixed: v.fixed(&pkgs[i])}
+			report.Findings = append(report.Findings, f)
+			report.Counts[f.Severity]++
+		}
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Severity.rank() < report.Findings[j].Severity.rank()
+	})
+	return report, nil
+}
+
+// Exceeds returns whether the report has findings of the severity or more
+// severe, never if the severity is not set.
+func (r *Report) Exceeds(severity string) bool {
+	if severity == "" {
+		return false
+	}
+	limit := Severity(strings.ToUpper(severity)).rank()
+	for _, f := range r.Findings {
+		if f.Severity.rank() <= limit {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, []byte(data), 0o600))
+}
+
+func TestLockfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module x\n")
+	writeFile(t, dir, "web/package-lock.json", "{}")
+	writeFile(t, dir, "web/node_modules/dep/package-lock.json", "{}")
+	writeFile(t, dir, "README.md", "")
+
+	files, err := Lockfiles(dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go.mod", "web/package-lock.json"}, files)
+	files, err = Lockfiles(dir, []string{"web/*.json"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web/package-lock.json"}, files)
+	_, err = Lockfiles(dir, []string{"*.md"})
+	assert.EqualError(t, err, "unsupported lockfile README.md")
+}
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", `module x
+
+require github.com/pkg/errors v0.9.1
+require (
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/net v0.17.0
+)
+`)
+	writeFile(t, dir, "package-lock.json", `{"packages": {"": {"version": "1.0.0"},
+		"node_modules/lodash": {"version": "4.17.20"},
+		"node_modules/a/node_modules/@scope/b": {"version": "2.0.0"},
+		"node_modules/local": {"link": true}}}`)
+	writeFile(t, dir, "v1/package-lock.json", `{"dependencies": {"a": {"version": "1.0.0", "dependencies": {"b": {"version": "2.0.0"}}}}}`)
+	writeFile(t, dir, "requirements.txt", "# deps\nDjango==3.2.0\nrequests[socks] == 2.25.0 ; python_version > '3'\nflask>=2\n-r other.txt\n")
+	writeFile(t, dir, "Cargo.lock", "version = 3\n\n[[package]]\nname = \"regex\"\nversion = \"1.5.4\"\n\n[[package]]\nname = \"serde\"\nversion = \"1.0.0\"\n")
+	writeFile(t, dir, "poetry.lock", "[[package]]\nname = \"django\"\nversion = \"3.2.0\"\n\n[package.dependencies]\nsqlparse = \">=0.2.2\"\n")
+	writeFile(t, dir, "yarn.lock", `# yarn lockfile v1
+
+"@babel/core@^7.0.0", "@babel/core@^7.1.0":
+  version "7.12.3"
+  dependencies:
+    debug "^4.1.0"
+
+lodash@^4.17.20:
+  version "4.17.20"
+`)
+	writeFile(t, dir, "berry/yarn.lock", `__metadata:
+  version: 6
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+
+"lodash@npm:^4.17.20":
+  version: 4.17.21
+`)
+	writeFile(t, dir, "pnpm-lock.yaml", `lockfileVersion: '6.0'
+packages:
+  /@babel/core@7.12.3(supports-color@8.0.0):
+    resolution: {integrity: sha512-x}
+  /lodash@4.17.20:
+    resolution: {integrity: sha512-y}
+`)
+	writeFile(t, dir, "v5/pnpm-lock.yaml", "lockfileVersion: 5.4\npackages:\n  /@babel/core/7.12.3_@types+node@14.0.0:\n    dev: false\n  /lodash/4.17.20_@types+node@14.0.0:\n    dev: true\n")
+	writeFile(t, dir, "Pipfile.lock", `{"default": {"Django": {"version": "==3.2.0"}}, "develop": {"pytest": {"version": "==6.0.0"}}}`)
+	writeFile(t, dir, "Gemfile.lock", `GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.13.0-x86_64-linux)
+      racc (~> 1.4)
+    racc (1.6.0)
+
+PLATFORMS
+  x86_64-linux
+`)
+	writeFile(t, dir, "composer.lock", `{"packages": [{"name": "monolog/monolog", "version": "v2.3.0"}], "packages-dev": [{"name": "phpunit/phpunit", "version": "9.5.0"}]}`)
+	writeFile(t, dir, "gradle.lockfile", "# gradle lockfile\ncom.google.guava:guava:30.0-jre=compileClasspath,runtimeClasspath\nempty=annotationProcessor\n")
+	writeFile(t, dir, "pom.xml", `<project>
+  <version>1.0.0</version>
+  <properties><jackson.version>2.12.0</jackson.version></properties>
+  <dependencies>
+    <dependency><groupId>com.fasterxml.jackson.core</groupId><artifactId>jackson-databind</artifactId><version>${jackson.version}</version></dependency>
+    <dependency><groupId>org.example</groupId><artifactId>inherited</artifactId></dependency>
+    <dependency><groupId>org.example</groupId><artifactId>ranged</artifactId><version>[1.0,2.0)</version></dependency>
+  </dependencies>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>log4j</groupId><artifactId>log4j</artifactId><version>1.2.17</version></dependency>
+  </dependencies></dependencyManagement>
+</project>`)
+
+	for lockfile, want := range map[string][][2]string{
+		"go.mod":               {{"github.com/pkg/errors", "0.9.1"}, {"golang.org/x/net", "0.17.0"}},
+		"package-lock.json":    {{"@scope/b", "2.0.0"}, {"lodash", "4.17.20"}},
+		"v1/package-lock.json": {{"a", "1.0.0"}, {"b", "2.0.0"}},
+		"requirements.txt":     {{"django", "3.2.0"}, {"requests", "2.25.0"}},
+		"Cargo.lock":           {{"regex", "1.5.4"}, {"serde", "1.0.0"}},
+		"poetry.lock":          {{"django", "3.2.0"}},
+		"yarn.lock":            {{"@babel/core", "7.12.3"}, {"lodash", "4.17.20"}},
+		"berry/yarn.lock":      {{"lodash", "4.17.21"}},
+		"pnpm-lock.yaml":       {{"@babel/core", "7.12.3"}, {"lodash", "4.17.20"}},
+		"v5/pnpm-lock.yaml":    {{"@babel/core", "7.12.3"}, {"lodash", "4.17.20"}},
+		"Pipfile.lock":         {{"django", "3.2.0"}, {"pytest", "6.0.0"}},
+		"Gemfile.lock":         {{"nokogiri", "1.13.0"}, {"racc", "1.6.0"}},
+		"composer.lock":        {{"monolog/monolog", "2.3.0"}, {"phpunit/phpunit", "9.5.0"}},
+		"gradle.lockfile":      {{"com.google.guava:guava", "30.0-jre"}},
+		"pom.xml":              {{"com.fasterxml.jackson.core:jackson-databind", "2.12.0"}, {"log4j:log4j", "1.2.17"}},
+	} {
+		pkgs, err := Parse(dir, lockfile)
+		require.NoError(t, err, lockfile)
+		var got [][2]string
+		for _, p := range pkgs {
+			assert.Equal(t, lockfile, p.Lockfile)
+			got = append(got, [2]string{p.Name, p.Version})
+		}
+		assert.Equal(t, want, got, lockfile)
+	}
+}
+
+func TestCVSSScore(t *testing.T) {
+	for vector, want := range map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N": 6.1,
+		"CVSS:3.0/AV:L/AC:H/PR:H/UI:N/S:U/C:L/I:N/A:N": 1.9,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N": 0,
+	} {
+		score, ok := cvssScore(vector)
+		assert.True(t, ok, vector)
+		assert.Equal(t, want, score, vector)
+	}
+	_, ok := cvssScore("CVSS:4.0/AV:N")
+	assert.False(t, ok)
+}
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/querybatch":
+			var req struct {
+				Queries []osvQuery `json:"queries"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Len(t, req.Queries, 2)
+			_, _ = w.Write([]byte(`{"results": [{"vulns": [{"id": "GO-2022-0001"}]}, {"vulns": [{"id": "GHSA-x"}]}]}`))
+		case "/v1/vulns/GO-2022-0001":
+			_, _ = w.Write([]byte(`{"id": "GO-2022-0001", "summary": "bad", "severity": [{"type": "CVSS_V3",
+				"score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}], "affected": [{"package": {"name": "a.io/a",
+				"ecosystem": "Go"}, "ranges": [{"events": [{"introduced": "0"}, {"fixed": "1.2.0"}]}]}]}`))
+		case "/v1/vulns/GHSA-x":
+			_, _ = w.Write([]byte(`{"id": "GHSA-x", "aliases": ["CVE-1"], "database_specific": {"severity": "MODERATE"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module x\n\nrequire (\n\ta.io/a v1.0.0\n\tb.io/b v2.0.0\n)\n")
+
+	report, err := Run(context.Background(), dir, nil, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Packages)
+	assert.Equal(t, map[Severity]int{Critical: 1, Medium: 1}, report.Counts)
+	require.Len(t, report.Findings, 2)
+	assert.Equal(t, &Finding{Package: Package{Name: "a.io/a", Version: "1.0.0", Ecosystem: "Go", Lockfile: "go.mod"},
+		ID: "GO-2022-0001", Summary: "bad", Severity: Critical, Fixed: []string{"1.2.0"}}, report.Findings[0])
+	assert.Equal(t, []string{"CVE-1"}, report.Findings[1].Aliases)
+	assert.True(t, report.Exceeds("high"))
+	assert.False(t, (&Report{Findings: []*Finding{report.Findings[1]}}).Exceeds("high"))
+	assert.False(t, report.Exceeds(""))
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate(&api.AuditConfig{FailOn: "high", Lockfiles: []string{"**/go.mod"}}))
+	assert.Equal(t, []string{
+		`audit lockfile "/go.mod" needs to be relative to the working directory`,
+		`audit report "../report.json" needs to be relative to the working directory`,
+		`unsupported audit severity "severe"`,
+	}, Validate(&api.AuditConfig{Lockfiles: []string{"/go.mod"}, Report: "../report.json", FailOn: "severe"}))
+}
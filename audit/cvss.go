@@ -0,0 +1,99 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"math"
+	"strings"
+)
+
+// the weights of the base metrics of CVSS v3.
+var cvssWeights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvssScore returns the base score of the CVSS v3 vector, eg.
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H, false if it is invalid.
+func cvssScore(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, false
+	}
+	metrics := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, ":"); ok {
+			metrics[k] = v
+		}
+	}
+	changed := metrics["S"] == "C"
+	values := make(map[string]float64)
+	for k, weights := range cvssWeights {
+		w, ok := weights[metrics[k]]
+		if !ok {
+			return 0, false
+		}
+		values[k] = w
+	}
+	switch metrics["PR"] {
+	case "N":
+		values["PR"] = 0.85
+	case "L":
+		values["PR"] = 0.62
+		if changed {
+			values["PR"] = 0.68
+		}
+	case "H":
+		values["PR"] = 0.27
+		if changed {
+			values["PR"] = 0.5
+		}
+	default:
+		return 0, false
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * values["AV"] * values["AC"] * values["PR"] * values["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// roundUp returns the smallest number with one decimal equal to or higher
+// than x, as specified by CVSS v3.1.
+func roundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// cvssSeverity returns the qualitative severity of the base score.
+func cvssSeverity(score float64) Severity {
+	switch {
+	case score >= 9:
+		return Critical
+	case score >= 7:
+		return High
+	case score >= 4:
+		return Medium
+	case score > 0:
+		return Low
+	}
+	return Unknown
+}
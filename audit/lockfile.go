@@ -0,0 +1,473 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/mattn/go-zglob"
+	"gopkg.in/yaml.v2"
+)
+
+// Package is a dependency pinned by a lockfile.
+type Package struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Ecosystem string `json:"ecosystem"` // of the OSV database, eg. npm
+	Lockfile  string `json:"lockfile"`  // slash separated, relative to the working directory
+}
+
+// the parsers of the lockfiles by base name, with the ecosystem of their
+// packages.
+var parsers = map[string]struct {
+	ecosystem string
+	parse     func(data []byte) ([][2]string, error)
+}{
+	"go.mod":            {"Go", parseGoMod},
+	"package-lock.json": {"npm", parsePackageLock},
+	"yarn.lock":         {"npm", parseYarnLock},
+	"pnpm-lock.yaml":    {"npm", parsePnpmLock},
+	"requirements.txt":  {"PyPI", parseRequirements},
+	"poetry.lock":       {"PyPI", parsePackageTables},
+	"Pipfile.lock":      {"PyPI", parsePipfileLock},
+	"Cargo.lock":        {"crates.io", parsePackageTables},
+	"Gemfile.lock":      {"RubyGems", parseGemfileLock},
+	"composer.lock":     {"Packagist", parseComposerLock},
+	"gradle.lockfile":   {"Maven", parseGradleLockfile},
+	"pom.xml":           {"Maven", parsePom},
+}
+
+// the directories of the vendored dependencies are not audited, their
+// packages are in the lockfiles of the workspace.
+var skippedDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true}
+
+// Lockfiles returns the sorted slash separated paths, relative to the
+// directory, of the lockfiles matching the globs, or of all the supported
+// lockfiles of the directory if no glob is set.
+func Lockfiles(dir string, globs []string) ([]string, error) {
+	if len(globs) == 0 {
+		return detect(dir)
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, g := range globs {
+		matches, err := zglob.Glob(filepath.Join(dir, g))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, m := range matches {
+			if _, err := safepath.Confine(m, dir); err != nil {
+				continue
+			}
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				continue
+			}
+			if _, ok := parsers[filepath.Base(m)]; !ok {
+				return nil, fmt.Errorf("unsupported lockfile %s", filepath.ToSlash(rel))
+			}
+			if rel = filepath.ToSlash(rel); !seen[rel] {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func detect(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := parsers[d.Name()]; ok && d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Parse returns the packages pinned by the lockfile, relative to the
+// directory.
+func Parse(dir, lockfile string) ([]Package, error) {
+	p, ok := parsers[filepath.Base(lockfile)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported lockfile %s", lockfile)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(lockfile)))
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := p.parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", lockfile, err)
+	}
+	seen := make(map[[2]string]bool)
+	pkgs := make([]Package, 0, len(pinned))
+	for _, nv := range pinned {
+		if seen[nv] || nv[0] == "" || nv[1] == "" {
+			continue
+		}
+		seen[nv] = true
+		pkgs = append(pkgs, Package{Name: nv[0], Version: nv[1], Ecosystem: p.ecosystem, Lockfile: lockfile})
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Version < pkgs[j].Version
+	})
+	return pkgs, nil
+}
+
+// parseGoMod returns the required modules, the versions without their v
+// prefix as in the OSV database.
+func parseGoMod(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	block := false
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case block && fields[0] == ")":
+			block = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			block = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !block:
+			continue
+		}
+		if len(fields) == 2 {
+			pkgs = append(pkgs, [2]string{fields[0], strings.TrimPrefix(fields[1], "v")})
+		}
+	}
+	return pkgs, s.Err()
+}
+
+// parsePackageLock returns the packages of the lockfile versions 2 and 3,
+// or the nested dependencies of the version 1.
+func parsePackageLock(data []byte) ([][2]string, error) {
+	type dependency struct {
+		Version      string                 `json:"version"`
+		Link         bool                   `json:"link"`
+		Dependencies map[string]*dependency `json:"dependencies"`
+	}
+	var lock struct {
+		Packages     map[string]*dependency `json:"packages"`
+		Dependencies map[string]*dependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs [][2]string
+	if len(lock.Packages) > 0 {
+		for p, d := range lock.Packages {
+			i := strings.LastIndex(p, "node_modules/")
+			if i < 0 || d.Link {
+				continue
+			}
+			pkgs = append(pkgs, [2]string{p[i+len("node_modules/"):], d.Version})
+		}
+		return pkgs, nil
+	}
+	var walk func(deps map[string]*dependency)
+	walk = func(deps map[string]*dependency) {
+		for name, d := range deps {
+			pkgs = append(pkgs, [2]string{name, d.Version})
+			walk(d.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return pkgs, nil
+}
+
+var requirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*===?\s*([^\s;#]+)`)
+
+// parseRequirements returns the requirements pinned to a version, the
+// others cannot be audited.
+func parseRequirements(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		if m := requirement.FindStringSubmatch(strings.TrimSpace(s.Text())); m != nil {
+			pkgs = append(pkgs, [2]string{strings.ToLower(m[1]), m[3]})
+		}
+	}
+	return pkgs, s.Err()
+}
+
+// parsePackageTables returns the name and the version of the [[package]]
+// tables of the Cargo.lock and poetry.lock files.
+func parsePackageTables(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	var cur *[2]string
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			if cur != nil {
+				pkgs = append(pkgs, *cur)
+				cur = nil
+			}
+			if line == "[[package]]" {
+				cur = &[2]string{}
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if cur == nil || !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			cur[0] = value
+		case "version":
+			cur[1] = value
+		}
+	}
+	if cur != nil {
+		pkgs = append(pkgs, *cur)
+	}
+	return pkgs, s.Err()
+}
+
+// parseYarnLock returns the resolved packages of the yarn.lock files of the
+// yarn versions 1 and 2+, without the packages of the workspace.
+func parseYarnLock(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	name := ""
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			// the first specifier of the entry, eg. "@babel/core@^7.0.0", b@npm:^1.0.0:
+			spec := strings.TrimSpace(strings.Split(strings.TrimSuffix(line, ":"), ",")[0])
+			spec = strings.Trim(spec, `"`)
+			name = ""
+			if spec == "" {
+				continue
+			}
+			// the name ends at the first @ after the one of its scope
+			if i := strings.Index(spec[1:], "@") + 1; i > 0 && !strings.Contains(spec[i:], "workspace:") {
+				name = spec[:i]
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if name != "" && len(fields) == 2 && (fields[0] == "version" || fields[0] == "version:") {
+			pkgs = append(pkgs, [2]string{name, strings.Trim(fields[1], `"`)})
+			name = ""
+		}
+	}
+	return pkgs, s.Err()
+}
+
+// parsePnpmLock returns the packages of the pnpm-lock.yaml files, keyed by
+// /name/version_peers up to the version 5 of the lockfile, and by
+// /name@version(peers) or name@version(peers) since.
+func parsePnpmLock(data []byte) ([][2]string, error) {
+	var lock struct {
+		Version  interface{}            `yaml:"lockfileVersion"`
+		Packages map[string]interface{} `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	v5 := strings.HasPrefix(fmt.Sprint(lock.Version), "5")
+	pkgs := make([][2]string, 0, len(lock.Packages))
+	for key := range lock.Packages {
+		key = strings.TrimPrefix(key, "/")
+		if v5 {
+			// the peers may be scoped, the version follows the name
+			n := 2
+			if strings.HasPrefix(key, "@") {
+				n = 3
+			}
+			if parts := strings.SplitN(key, "/", n); len(parts) == n {
+				version, _, _ := strings.Cut(parts[n-1], "_")
+				pkgs = append(pkgs, [2]string{strings.Join(parts[:n-1], "/"), version})
+			}
+			continue
+		}
+		key, _, _ = strings.Cut(key, "(")
+		if i := strings.LastIndex(key, "@"); i > 0 {
+			pkgs = append(pkgs, [2]string{key[:i], key[i+1:]})
+		}
+	}
+	return pkgs, nil
+}
+
+// parsePipfileLock returns the default and the development packages pinned
+// by the Pipfile.lock.
+func parsePipfileLock(data []byte) ([][2]string, error) {
+	type packages map[string]struct {
+		Version string `json:"version"`
+	}
+	var lock struct {
+		Default packages `json:"default"`
+		Develop packages `json:"develop"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs [][2]string
+	for _, p := range []packages{lock.Default, lock.Develop} {
+		for name, d := range p {
+			pkgs = append(pkgs, [2]string{strings.ToLower(name), strings.TrimPrefix(d.Version, "==")})
+		}
+	}
+	return pkgs, nil
+}
+
+var gemSpec = regexp.MustCompile(`^    ([^\s(]+) \(([^)-]+)(-[^)]*)?\)$`)
+
+// parseGemfileLock returns the gems of the specs of the Gemfile.lock, the
+// gems are indented by four spaces and their dependencies by six, the
+// platform suffix of the versions is ignored.
+func parseGemfileLock(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	specs := false
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.TrimSpace(line) == "specs:":
+			specs = true
+		case !strings.HasPrefix(line, "    "):
+			specs = false
+		case specs:
+			if m := gemSpec.FindStringSubmatch(line); m != nil {
+				pkgs = append(pkgs, [2]string{m[1], m[2]})
+			}
+		}
+	}
+	return pkgs, s.Err()
+}
+
+// parseComposerLock returns the packages and the development packages of
+// the composer.lock, the versions without their v prefix.
+func parseComposerLock(data []byte) ([][2]string, error) {
+	type pkg struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	var lock struct {
+		Packages    []pkg `json:"packages"`
+		PackagesDev []pkg `json:"packages-dev"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs [][2]string
+	for _, p := range append(lock.Packages, lock.PackagesDev...) {
+		pkgs = append(pkgs, [2]string{p.Name, strings.TrimPrefix(p.Version, "v")})
+	}
+	return pkgs, nil
+}
+
+// parseGradleLockfile returns the group:artifact:version=configurations
+// entries of the gradle.lockfile.
+func parseGradleLockfile(data []byte) ([][2]string, error) {
+	var pkgs [][2]string
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "empty=") {
+			continue
+		}
+		coordinates, _, _ := strings.Cut(line, "=")
+		if parts := strings.Split(coordinates, ":"); len(parts) == 3 {
+			pkgs = append(pkgs, [2]string{parts[0] + ":" + parts[1], parts[2]})
+		}
+	}
+	return pkgs, s.Err()
+}
+
+var property = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// parsePom returns the dependencies and the managed dependencies declared
+// by the pom.xml with a pinned version, the properties of the pom are
+// expanded.
+// The pom is not a lockfile: the transitive dependencies and the versions
+// inherited from the parent poms cannot be audited.
+func parsePom(data []byte) ([][2]string, error) {
+	type dependency struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+	}
+	var pom struct {
+		Version    string `xml:"version"`
+		Properties struct {
+			Entries []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"properties"`
+		Dependencies []dependency `xml:"dependencies>dependency"`
+		Managed      []dependency `xml:"dependencyManagement>dependencies>dependency"`
+	}
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, err
+	}
+	props := map[string]string{"project.version": pom.Version}
+	for _, e := range pom.Properties.Entries {
+		props[e.XMLName.Local] = strings.TrimSpace(e.Value)
+	}
+	expand := func(s string) string {
+		return property.ReplaceAllStringFunc(strings.TrimSpace(s), func(p string) string {
+			if v, ok := props[p[2:len(p)-1]]; ok {
+				return v
+			}
+			return p
+		})
+	}
+	var pkgs [][2]string
+	for _, d := range append(pom.Dependencies, pom.Managed...) {
+		version := expand(d.Version)
+		if version == "" || strings.ContainsAny(version, "$[(") { // unresolved or a range
+			continue
+		}
+		pkgs = append(pkgs, [2]string{expand(d.GroupID) + ":" + expand(d.ArtifactID), version})
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultURL is the OSV API queried if the URL of the step is not set.
+	DefaultURL = "https://api.osv.dev"
+	// DefaultReport is the findings report of the step if it is not set.
+	DefaultReport = "dependency-audit.json"
+	// the maximum number of queries of a batch of the OSV API.
+	queryBatchSize = 1000
+)
+
+// osvClient queries the OSV API for the vulnerabilities of the packages.
+type osvClient struct {
+	url    string
+	client *http.Client
+}
+
+type osvQuery struct {
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Version string `json:"version"`
+}
+
+// osvVuln is the subset of a vulnerability of the OSV schema in the
+// report.
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Aliases  []string `json:"aliases"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+// query returns the ids of the vulnerabilities of each package.
+func (c *osvClient) query(ctx context.Context, pkgs []Package) ([][]string, error) {
+	ids := make([][]string, 0, len(pkgs))
+	for start := 0; start < len(pkgs); start += queryBatchSize {
+		end := start + queryBatchSize
+		if end > len(pkgs) {
+			end = len(pkgs)
+		}
+		req := struct {
+			Queries []osvQuery `json:"queries"`
+		}{Queries: make([]osvQuery, end-start)}
+		for i, p := range pkgs[start:end] {
+			req.Queries[i].Package.Name = p.Name
+			req.Queries[i].Package.Ecosystem = p.Ecosystem
+			req.Queries[i].Version = p.Version
+		}
+		var resp struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+			} `json:"results"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/v1/querybatch", req, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != end-start {
+			return nil, fmt.Errorf("osv returned %d results for %d queries", len(resp.Results), end-start)
+		}
+		for _, r := range resp.Results {
+			var vulns []string
+			for _, v := range r.Vulns {
+				vulns = append(vulns, v.ID)
+			}
+			ids = append(ids, vulns)
+		}
+	}
+	return ids, nil
+}
+
+// vuln returns the vulnerability with the id.
+func (c *osvClient) vuln(ctx context.Context, id string) (*osvVuln, error) {
+	v := new(osvVuln)
+	if err := c.do(ctx, http.MethodGet, "/v1/vulns/"+url.PathEscape(id), nil, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *osvClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.url, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:gomnd
+		return fmt.Errorf("osv %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// severity returns the severity of the vulnerability: the severity of the
+// database, eg. of the GitHub advisories, or of its CVSS v3 vector.
+func (v *osvVuln) severity() Severity {
+	switch strings.ToUpper(v.DatabaseSpecific.Severity) {
+	case "CRITICAL":
+		return Critical
+	case "HIGH":
+		return High
+	case "MODERATE", "MEDIUM":
+		return Medium
+	case "LOW":
+		return Low
+	}
+	best := -1.0
+	for _, s := range v.Severity {
+		if score, ok := cvssScore(s.Score); ok && s.Type == "CVSS_V3" && score > best {
+			best = score
+		}
+	}
+	return cvssSeverity(best)
+}
+
+// fixed returns the versions fixing the vulnerability of the package.
+func (v *osvVuln) fixed(p *Package) []string {
+	var versions []string
+	for _, a := range v.Affected {
+		if a.Package.Name != p.Name || !strings.EqualFold(a.Package.Ecosystem, p.Ecosystem) {
+			continue
+		}
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed != "" {
+					versions = append(versions, e.Fixed)
+				}
+			}
+		}
+	}
+	return versions
+}
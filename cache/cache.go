@@ -0,0 +1,208 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package cache restores and saves the caches of the steps, eg. the
+// dependencies of the builds, without a cache plugin. The caches are the
+// tar.zst archives of paths of the working directory, stored by key in a
+// directory of the host or in an object storage.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/harness/lite-engine/internal/tarball"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mattn/go-zglob"
+)
+
+const (
+	archiveExt  = ".tar.zst"
+	contentType = "application/zstd"
+)
+
+var validKey = regexp.MustCompile(`^[A-Za-z0-9._\-/]+$`)
+
+// Validate returns the issues of the cache configuration of a step, save is
+// set for the CacheSave steps.
+func Validate(cfg *api.CacheConfig, save bool) []string {
+	var issues []string
+	if cfg.Key == "" {
+		issues = append(issues, "cache key needs to be set")
+	}
+	for _, t := range append([]string{cfg.Key}, cfg.RestoreKeys...) {
+		if _, err := parse(t); err != nil {
+			issues = append(issues, fmt.Sprintf("invalid cache key template %q: %s", t, err))
+		}
+	}
+	if save && len(cfg.Paths) == 0 {
+		issues = append(issues, "cache paths need to be set")
+	}
+	for _, p := range cfg.Paths {
+		if !tarball.Local(p) {
+			issues = append(issues, fmt.Sprintf("cache path %q needs to be relative to the working directory", p))
+		}
+	}
+	return append(issues, objstore.Validate(&cfg.Backend, "cache backend")...)
+}
+
+// Key returns the cache key of the template. The templates are evaluated
+// with the functions:
+//
+//	checksum "glob"...  sha256 of the matching files of the directory
+//	env "NAME"          environment variable of the step
+//	os, arch            platform of the engine
+func Key(tmpl, dir string, envs map[string]string) (string, error) {
+	t, err := parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Funcs(template.FuncMap{
+		"checksum": func(globs ...string) (string, error) { return checksum(dir, globs) },
+		"env":      func(name string) string { return envs[name] },
+	}).Execute(&buf, nil)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(buf.String())
+	if !validKey.MatchString(key) || !tarball.Local(key) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return key, nil
+}
+
+func parse(tmpl string) (*template.Template, error) {
+	return template.New("key").Option("missingkey=error").Funcs(template.FuncMap{
+		"checksum": func(...string) (string, error) { return "", nil },
+		"env":      func(string) string { return "" },
+		"os":       func() string { return runtime.GOOS },
+		"arch":     func() string { return runtime.GOARCH },
+	}).Parse(tmpl)
+}
+
+// checksum returns the sha256 of the names and of the contents of the files
+// of the directory matching the globs.
+func checksum(dir string, globs []string) (string, error) {
+	var files []string
+	for _, g := range globs {
+		matches, err := zglob.Glob(filepath.Join(dir, g))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	n := 0
+	for i, f := range files {
+		if i > 0 && f == files[i-1] {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		rel, _ := filepath.Rel(dir, f)
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+		if err = hashFile(h, f); err != nil {
+			return "", err
+		}
+		n++
+	}
+	if n == 0 {
+		return "", fmt.Errorf("no file matches %s", strings.Join(globs, ", "))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Restore extracts the cache of the first key found in the directory. It
+// returns the key restored, empty if none was found.
+func Restore(ctx context.Context, s objstore.Store, keys []string, dir string) (string, error) {
+	for _, key := range keys {
+		rc, err := s.Get(ctx, key+archiveExt)
+		if errors.Is(err, objstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		err = extract(rc, dir)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("cannot extract the cache %s: %w", key, err)
+		}
+		return key, nil
+	}
+	return "", nil
+}
+
+func extract(r io.Reader, dir string) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return tarball.Extract(zr, dir)
+}
+
+// Exists returns true if the cache of the key exists.
+func Exists(ctx context.Context, s objstore.Store, key string) (bool, error) {
+	return s.Exists(ctx, key+archiveExt)
+}
+
+// Save archives the paths of the directory and stores the archive by key.
+// It returns the size of the archive.
+func Save(ctx context.Context, s objstore.Store, key, dir string, paths []string) (int64, error) {
+	f, err := os.CreateTemp("", "cache-*.tar.zst")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return 0, err
+	}
+	if err = tarball.Write(zw, dir, paths); err != nil {
+		zw.Close()
+		return 0, err
+	}
+	if err = zw.Close(); err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, s.Put(ctx, key+archiveExt, f, size, contentType)
+}
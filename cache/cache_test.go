@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "svc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), []byte("a v1.0.0"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "svc", "go.sum"), []byte("b v1.0.0"), 0o600))
+	envs := map[string]string{"DRONE_BRANCH": "main"}
+
+	key, err := Key(`go-{{ os }}-{{ arch }}-{{ env "DRONE_BRANCH" }}`, dir, envs)
+	require.NoError(t, err)
+	assert.Equal(t, "go-"+runtime.GOOS+"-"+runtime.GOARCH+"-main", key)
+
+	first, err := Key(`go-{{ checksum "**/go.sum" }}`, dir, envs)
+	require.NoError(t, err)
+	assert.Len(t, first, len("go-")+64)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "svc", "go.sum"), []byte("b v1.1.0"), 0o600))
+	second, err := Key(`go-{{ checksum "**/go.sum" }}`, dir, envs)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	_, err = Key(`go-{{ checksum "go.mod" }}`, dir, envs)
+	assert.EqualError(t, err, `template: key:1:6: executing "key" at <checksum "go.mod">: error calling checksum: no file matches go.mod`)
+	_, err = Key(`../{{ env "DRONE_BRANCH" }}`, dir, envs)
+	assert.EqualError(t, err, `invalid cache key "../main"`)
+	_, err = Key(`go {{ env "DRONE_BRANCH" }}`, dir, envs)
+	assert.EqualError(t, err, `invalid cache key "go main"`)
+}
+
+func TestSaveRestore(t *testing.T) {
+	b, err := objstore.New(&api.Storage{Kind: api.StorageLocal, Path: t.TempDir()})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "node_modules", "left-pad"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "node_modules", "left-pad", "index.js"), []byte("pad"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "main.js"), []byte("main"), 0o644))
+	size, err := Save(ctx, b, "npm/v1", src, []string{"node_modules"})
+	require.NoError(t, err)
+	assert.Positive(t, size)
+	ok, err := Exists(ctx, b, "npm/v1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	dst := t.TempDir()
+	key, err := Restore(ctx, b, []string{"npm/v2", "npm/v1"}, dst)
+	require.NoError(t, err)
+	assert.Equal(t, "npm/v1", key)
+	data, err := os.ReadFile(filepath.Join(dst, "node_modules", "left-pad", "index.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "pad", string(data))
+	assert.NoFileExists(t, filepath.Join(dst, "main.js"))
+
+	key, err = Restore(ctx, b, []string{"npm/v3"}, t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, key)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate(&api.CacheConfig{
+		Key:     `go-{{ checksum "go.sum" }}`,
+		Paths:   []string{".cache/go"},
+		Backend: api.Storage{Kind: api.StorageS3, Bucket: "ci-cache"},
+	}, true))
+	assert.Equal(t, []string{
+		"cache key needs to be set",
+		"cache paths need to be set",
+		"cache backend path needs to be an absolute path",
+	}, Validate(&api.CacheConfig{Backend: api.Storage{Kind: api.StorageLocal}}, true))
+	assert.Equal(t, []string{
+		`invalid cache key template "go-{{ checksum": template: key:1: unclosed action`,
+		`cache path "/root/.m2" needs to be relative to the working directory`,
+		`unsupported cache backend "ftp"`,
+	}, Validate(&api.CacheConfig{Key: "go-{{ checksum", Paths: []string{"/root/.m2"}, Backend: api.Storage{Kind: "ftp"}}, false))
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package checkpoint snapshots the checkpoint paths of a running step to an
+// object storage and restores the last snapshot when the step is retried,
+// so that a long training or ETL step resumes from its last checkpoint
+// instead of starting from zero. The snapshots are tar.gz archives PUT to
+// an url, eg. a pre-signed url of the bucket.
+package checkpoint
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/tarball"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is the interval of the snapshots if not set.
+const DefaultInterval = 5 * time.Minute
+
+var httpClient = &http.Client{}
+
+// Validate returns the issues of the checkpoint configuration.
+func Validate(cfg *api.Checkpoint) []string {
+	var issues []string
+	if len(cfg.Paths) == 0 {
+		issues = append(issues, "checkpoint paths need to be set")
+	}
+	for _, p := range cfg.Paths {
+		if !tarball.Local(p) {
+			issues = append(issues, fmt.Sprintf("checkpoint path %q needs to be relative to the working directory", p))
+		}
+	}
+	if !isHTTP(cfg.UploadURL) {
+		issues = append(issues, "checkpoint upload_url needs to be an http or https url")
+	}
+	if cfg.DownloadURL != "" && !isHTTP(cfg.DownloadURL) {
+		issues = append(issues, "checkpoint download_url needs to be an http or https url")
+	}
+	if cfg.Interval < 0 {
+		issues = append(issues, fmt.Sprintf("checkpoint interval cannot be negative: %d", cfg.Interval))
+	}
+	return issues
+}
+
+// Run snapshots the paths of the directory at each interval until the
+// context is done. The failures are logged.
+func Run(ctx context.Context, cfg *api.Checkpoint, dir string, log logrus.FieldLogger) {
+	interval := DefaultInterval
+	if cfg.Interval > 0 {
+		interval = time.Duration(cfg.Interval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Snapshot(ctx, cfg, dir); err != nil && ctx.Err() == nil {
+				log.WithError(err).Warnln("failed to snapshot the checkpoint")
+			}
+		}
+	}
+}
+
+// Restore extracts the last snapshot in the directory. It returns false if
+// there is no snapshot, eg. on the first attempt of the step.
+func Restore(ctx context.Context, cfg *api.Checkpoint, dir string) (bool, error) {
+	location := cfg.DownloadURL
+	if location == "" {
+		location = cfg.UploadURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return false, err
+	}
+	setHeaders(req, cfg)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, unwrap(err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("cannot download the checkpoint: %s", resp.Status)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	defer gz.Close()
+	return true, tarball.Extract(gz, dir)
+}
+
+// Snapshot archives the checkpoint paths of the directory and uploads the
+// archive. The paths which do not exist yet are skipped. The files written
+// meanwhile may be captured partially, the steps should write their
+// checkpoints to a temporary file renamed once complete.
+func Snapshot(ctx context.Context, cfg *api.Checkpoint, dir string) error {
+	f, err := os.CreateTemp("", "checkpoint-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if err = tarball.Write(gz, dir, cfg.Paths); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// the content length is set, the pre-signed urls reject the chunked uploads
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, cfg.UploadURL, io.NopCloser(f))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	setHeaders(req, cfg)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return unwrap(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		return fmt.Errorf("cannot upload the checkpoint: %s", resp.Status)
+	}
+	return nil
+}
+
+func setHeaders(req *http.Request, cfg *api.Checkpoint) {
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// unwrap returns the error without the url, the pre-signed urls hold a
+// signature.
+func unwrap(err error) error {
+	if uerr, ok := err.(*url.Error); ok {
+		return uerr.Err
+	}
+	return err
+}
+
+func isHTTP(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,99 @@
+package checkpoint
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// store is an object storage holding a single object.
+type store struct {
+	mu     sync.Mutex
+	object []byte
+	auth   string
+}
+
+func (s *store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = r.Header.Get("Authorization")
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		s.object, _ = io.ReadAll(r.Body)
+	case http.MethodGet:
+		if s.object == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(s.object)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	st := &store{}
+	srv := httptest.NewServer(st)
+	defer srv.Close()
+	cfg := &api.Checkpoint{
+		Paths:     []string{"models", "state.json", "missing"},
+		UploadURL: srv.URL + "/ckpt.tar.gz",
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+	}
+	ctx := context.Background()
+
+	fresh := t.TempDir()
+	ok, err := Restore(ctx, cfg, fresh)
+	require.NoError(t, err)
+	assert.False(t, ok, "no snapshot yet")
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "models", "epoch-3"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "models", "epoch-3", "weights.bin"), []byte("weights"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "state.json"), []byte(`{"epoch":3}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "data.csv"), []byte("not a checkpoint"), 0o644))
+	require.NoError(t, Snapshot(ctx, cfg, src))
+	assert.Equal(t, "Bearer token", st.auth)
+
+	ok, err = Restore(ctx, cfg, fresh)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	data, err := os.ReadFile(filepath.Join(fresh, "models", "epoch-3", "weights.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, "weights", string(data))
+	data, err = os.ReadFile(filepath.Join(fresh, "state.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"epoch":3}`, string(data))
+	assert.NoFileExists(t, filepath.Join(fresh, "data.csv"))
+}
+
+func TestRestore_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	_, err := Restore(context.Background(), &api.Checkpoint{UploadURL: srv.URL + "/ckpt?X-Amz-Signature=secret"}, t.TempDir())
+	assert.EqualError(t, err, "cannot download the checkpoint: 403 Forbidden")
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate(&api.Checkpoint{Paths: []string{"models/ckpt"}, UploadURL: "https://bucket.s3.amazonaws.com/ckpt"}))
+	assert.Equal(t, []string{
+		"checkpoint paths need to be set",
+		"checkpoint upload_url needs to be an http or https url",
+		"checkpoint interval cannot be negative: -1",
+	}, Validate(&api.Checkpoint{Interval: -1}))
+	assert.Equal(t, []string{`checkpoint path "/data" needs to be relative to the working directory`},
+		Validate(&api.Checkpoint{Paths: []string{"/data"}, UploadURL: "http://minio:9000/ckpt"}))
+}
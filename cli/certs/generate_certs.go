@@ -11,12 +11,16 @@ import (
 
 	"github.com/harness/godotenv/v3"
 	"github.com/harness/lite-engine/config"
+	"github.com/harness/lite-engine/internal/fileperm"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-const certPermissions = os.FileMode(0600)
+const (
+	certPermissions    = os.FileMode(0600)
+	certDirPermissions = os.FileMode(0700)
+)
 
 type certCommand struct {
 	certPath string
@@ -34,26 +38,26 @@ func generateCert(serverName, relPath string) error {
 		return errors.Wrap(err, "failed to generate certificate")
 	}
 
-	err = os.MkdirAll(relPath, os.ModePerm)
+	err = os.MkdirAll(relPath, fileperm.Mode(certDirPermissions))
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to create directory at path: %s", relPath))
 	}
 
 	caCertFilePath := filepath.Join(relPath, "ca-cert.pem")
 	caKeyFilePath := filepath.Join(relPath, "ca-key.pem")
-	if err := os.WriteFile(caCertFilePath, ca.Cert, certPermissions); err != nil {
+	if err := os.WriteFile(caCertFilePath, ca.Cert, fileperm.Mode(certPermissions)); err != nil {
 		return errors.Wrap(err, "failed to write CA cert file")
 	}
-	if err := os.WriteFile(caKeyFilePath, ca.Key, certPermissions); err != nil {
+	if err := os.WriteFile(caKeyFilePath, ca.Key, fileperm.Mode(certPermissions)); err != nil {
 		return errors.Wrap(err, "failed to write CA key file")
 	}
 
 	certFilePath := filepath.Join(relPath, "server-cert.pem")
 	keyFilePath := filepath.Join(relPath, "server-key.pem")
-	if err := os.WriteFile(certFilePath, tlsCert.Cert, certPermissions); err != nil {
+	if err := os.WriteFile(certFilePath, tlsCert.Cert, fileperm.Mode(certPermissions)); err != nil {
 		return errors.Wrap(err, "failed to write server cert file")
 	}
-	if err := os.WriteFile(keyFilePath, tlsCert.Key, certPermissions); err != nil {
+	if err := os.WriteFile(keyFilePath, tlsCert.Key, fileperm.Mode(certPermissions)); err != nil {
 		return errors.Wrap(err, "failed to write server key file")
 	}
 	return nil
@@ -73,6 +77,13 @@ func (c *certCommand) run(*kingpin.ParseContext) error {
 			Errorln("cannot load the service configuration")
 		return err
 	}
+	if loadedConfig.Server.FileUmask != "" {
+		umask, err := fileperm.Parse(loadedConfig.Server.FileUmask)
+		if err != nil {
+			return err
+		}
+		fileperm.SetUmask(umask)
+	}
 
 	return generateCert(loadedConfig.ServerName, c.certPath)
 }
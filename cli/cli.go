@@ -9,7 +9,11 @@ import (
 
 	"github.com/harness/lite-engine/cli/certs"
 	"github.com/harness/lite-engine/cli/client"
+	"github.com/harness/lite-engine/cli/imagecache"
+	"github.com/harness/lite-engine/cli/replay"
+	"github.com/harness/lite-engine/cli/runstep"
 	"github.com/harness/lite-engine/cli/server"
+	"github.com/harness/lite-engine/cli/upgrade"
 	"github.com/harness/lite-engine/version"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -25,6 +29,10 @@ func Command() {
 	server.Register(app)
 	certs.Register(app)
 	client.Register(app)
+	upgrade.Register(app)
+	runstep.Register(app)
+	replay.Register(app)
+	imagecache.Register(app)
 
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 }
@@ -0,0 +1,72 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package imagecache
+
+import (
+	"context"
+
+	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/docker"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type exportCommand struct {
+	dir    string
+	images []string
+}
+
+func (c *exportCommand) run(*kingpin.ParseContext) error {
+	e, err := engine.NewEnv(docker.Opts{})
+	if err != nil {
+		return err
+	}
+	n, err := e.ExportImages(context.Background(), c.dir, c.images)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("dir", c.dir).WithField("images", n).Infoln("exported the images to the cache")
+	return nil
+}
+
+type importCommand struct {
+	dir string
+}
+
+func (c *importCommand) run(*kingpin.ParseContext) error {
+	e, err := engine.NewEnv(docker.Opts{})
+	if err != nil {
+		return err
+	}
+	n, err := e.ImportImages(context.Background(), c.dir)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("dir", c.dir).WithField("archives", n).Infoln("imported the cached images")
+	return nil
+}
+
+// Register the image-cache commands.
+func Register(app *kingpin.Application) {
+	cmd := app.Command("image-cache", "export or import the images cached between stages")
+
+	exp := new(exportCommand)
+	expCmd := cmd.Command("export", "save the images to archives in the cache directory").
+		Action(exp.run)
+	expCmd.Arg("dir", "cache directory").
+		Required().
+		StringVar(&exp.dir)
+	expCmd.Arg("images", "images to export").
+		Required().
+		StringsVar(&exp.images)
+
+	imp := new(importCommand)
+	impCmd := cmd.Command("import", "load the image archives of the cache directory").
+		Action(imp.run)
+	impCmd.Arg("dir", "cache directory").
+		Required().
+		StringVar(&imp.dir)
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/cli/runstep"
+	preplay "github.com/harness/lite-engine/pipeline/replay"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type replayCommand struct {
+	bundle    string
+	output    string
+	envs      map[string]string
+	pinImages bool
+}
+
+func (c *replayCommand) run(*kingpin.ParseContext) error {
+	b, err := preplay.ReadBundle(c.bundle)
+	if err != nil {
+		return err
+	}
+	s, r := Requests(b, c.envs, c.pinImages)
+
+	resp, err := runstep.Execute(s, r)
+	if err != nil {
+		return err
+	}
+	if err = runstep.WriteResponse(c.output, resp); err != nil {
+		return err
+	}
+	if b.Result != nil && (b.Result.ExitCode != resp.ExitCode || b.Result.OOMKilled != resp.OOMKilled) {
+		logrus.WithField("recorded_exit_code", b.Result.ExitCode).
+			WithField("exit_code", resp.ExitCode).
+			WithField("recorded_oom_killed", b.Result.OOMKilled).
+			WithField("oom_killed", resp.OOMKilled).
+			Warnln("replayed step outcome differs from the recorded one")
+	}
+	return nil
+}
+
+// Requests returns the setup and step requests of the bundle. The variables
+// in envs override the recorded ones, eg. to set the redacted secrets, and
+// the step image is replaced by its recorded digest if pinImages is set.
+func Requests(b *preplay.Bundle, envs map[string]string, pinImages bool) (*api.SetupRequest, *api.StartStepRequest) {
+	s := b.Setup
+	if s == nil {
+		s = new(api.SetupRequest)
+	}
+	r := b.Step
+	if len(envs) > 0 && r.Envs == nil {
+		r.Envs = make(map[string]string)
+	}
+	for k, v := range envs {
+		r.Envs[k] = v
+	}
+	if pinImages {
+		for _, img := range b.Images {
+			if img.Name == r.Image && img.Digest != "" {
+				r.Image = img.Digest
+			}
+		}
+	}
+	return s, r
+}
+
+// Register the replay command.
+func Register(app *kingpin.Application) {
+	c := new(replayCommand)
+
+	cmd := app.Command("replay", "re-execute a recorded step bundle locally").
+		Action(c.run)
+
+	cmd.Arg("bundle", "file of the recorded step bundle").
+		Required().
+		StringVar(&c.bundle)
+	cmd.Flag("output", "file to write the poll step response json to").
+		Default("step-response.json").
+		StringVar(&c.output)
+	cmd.Flag("env", "environment variable of the step, eg. to set a redacted secret").
+		StringMapVar(&c.envs)
+	cmd.Flag("pin-images", "run the step with the image digest of the recording").
+		BoolVar(&c.pinImages)
+}
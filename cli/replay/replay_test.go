@@ -0,0 +1,24 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	preplay "github.com/harness/lite-engine/pipeline/replay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequests(t *testing.T) {
+	b := &preplay.Bundle{
+		Step:   &api.StartStepRequest{ID: "step1", Image: "golang:1.20"},
+		Images: []preplay.Image{{Name: "golang:1.20", Digest: "golang@sha256:abc"}},
+	}
+	s, r := Requests(b, map[string]string{"TOKEN": "secret"}, true)
+	assert.NotNil(t, s)
+	assert.Equal(t, "golang@sha256:abc", r.Image)
+	assert.Equal(t, "secret", r.Envs["TOKEN"])
+
+	b.Step.Image = "golang:1.20"
+	_, r = Requests(b, nil, false)
+	assert.Equal(t, "golang:1.20", r.Image)
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runstep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/docker"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/logstream/stdout"
+	"github.com/harness/lite-engine/osstats"
+	"github.com/harness/lite-engine/pipeline"
+	pruntime "github.com/harness/lite-engine/pipeline/runtime"
+	"github.com/harness/lite-engine/ti"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const responsePermissions = 0644
+
+type runStepCommand struct {
+	request string
+	setup   string
+	output  string
+}
+
+func (c *runStepCommand) run(*kingpin.ParseContext) error {
+	s := new(api.SetupRequest)
+	if c.setup != "" {
+		if err := readJSON(c.setup, s); err != nil {
+			return err
+		}
+	}
+	r := new(api.StartStepRequest)
+	if err := readJSON(c.request, r); err != nil {
+		return err
+	}
+	resp, err := Execute(s, r)
+	if err != nil {
+		return err
+	}
+	return WriteResponse(c.output, resp)
+}
+
+// Execute sets up the stage of the setup request, executes the step with
+// its logs printed to stdout and returns the step response. The stage
+// resources are destroyed once the step completes.
+func Execute(s *api.SetupRequest, r *api.StartStepRequest) (*api.PollStepResponse, error) {
+	if r.ID == "" {
+		r.ID = "step"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	e, err := engine.NewEnv(docker.Opts{})
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("failed to initialize engine")
+		return nil, err
+	}
+
+	state := pipeline.GetState()
+	state.Set(s.Secrets, s.LogConfig, ti.NewConfig(&s.TIConfig), &osstats.StatsCollector{})
+	state.SetLogStreamClient(stdout.New())
+	state.WatchSecretFiles(s.SecretFiles)
+	defer state.StopSecretFiles()
+
+	if err = e.Setup(ctx, pipelineConfig(s, e.SocketPath())); err != nil {
+		logrus.WithError(err).
+			Errorln("failed to setup the stage")
+		return nil, err
+	}
+	defer func() {
+		if derr := e.Destroy(context.Background()); derr != nil {
+			logrus.WithError(derr).Warnln("failed to destroy the stage resources")
+		}
+	}()
+
+	return RunStep(ctx, pruntime.NewStepExecutor(e), r)
+}
+
+// WriteResponse writes the step response to the file at path.
+func WriteResponse(path string, resp *api.PollStepResponse) error {
+	data, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, data, responsePermissions); err != nil {
+		return err
+	}
+	logrus.WithField("output", path).
+		WithField("exit_code", resp.ExitCode).
+		Infoln("step completed")
+	return nil
+}
+
+// RunStep starts the step with the executor and waits for its response.
+func RunStep(ctx context.Context, e *pruntime.StepExecutor, r *api.StartStepRequest) (*api.PollStepResponse, error) {
+	if r.MountDockerSocket == nil || *r.MountDockerSocket {
+		r.Volumes = appendMount(r.Volumes, &spec.VolumeMount{Name: engine.DockerSockVolName, Path: dockerSockPath()})
+	}
+	r.Volumes = appendMount(r.Volumes, &spec.VolumeMount{Name: pipeline.SharedVolName, Path: pipeline.SharedVolPath})
+
+	if err := e.StartStep(ctx, r); err != nil {
+		return nil, err
+	}
+	return e.PollStep(ctx, &api.PollStepRequest{ID: r.ID})
+}
+
+// pipelineConfig returns the stage configuration of the setup request,
+// with the volumes the server mounts on every stage. The socket of the
+// container engine at socketPath is mounted as the docker socket.
+func pipelineConfig(s *api.SetupRequest, socketPath string) *spec.PipelineConfig {
+	volumes := s.Volumes
+	if s.MountDockerSocket == nil || *s.MountDockerSocket {
+		volumes = appendVolume(volumes, &spec.Volume{
+			HostPath: &spec.VolumeHostPath{Name: engine.DockerSockVolName, Path: socketPath, ID: "docker"},
+		})
+	}
+	volumes = appendVolume(volumes, &spec.Volume{
+		HostPath: &spec.VolumeHostPath{Name: pipeline.SharedVolName, Path: pipeline.SharedVolPath, ID: "engine"},
+	})
+	return &spec.PipelineConfig{
+		Envs:    s.Envs,
+		Network: s.Network,
+		Platform: spec.Platform{
+			OS:   runtime.GOOS,
+			Arch: runtime.GOARCH,
+		},
+		Volumes:           volumes,
+		Files:             s.Files,
+		EnableDockerSetup: s.MountDockerSocket,
+		TTY:               s.TTY,
+		EnvPassthrough:    s.EnvPassthrough,
+		Labels:            labels.ForStage(s.TIConfig.AccountID, s.TIConfig.PipelineID, s.StageRuntimeID),
+	}
+}
+
+// appendVolume appends the host volume unless a volume with the same name
+// exists, eg. in the requests recorded by the server.
+func appendVolume(volumes []*spec.Volume, v *spec.Volume) []*spec.Volume {
+	for _, vol := range volumes {
+		if vol != nil && vol.HostPath != nil && vol.HostPath.Name == v.HostPath.Name {
+			return volumes
+		}
+	}
+	return append(volumes, v)
+}
+
+func appendMount(mounts []*spec.VolumeMount, m *spec.VolumeMount) []*spec.VolumeMount {
+	for _, mount := range mounts {
+		if mount != nil && mount.Name == m.Name {
+			return mounts
+		}
+	}
+	return append(mounts, m)
+}
+
+func dockerSockPath() string {
+	if runtime.GOOS == "windows" {
+		return engine.DockerSockWinPath
+	}
+	return engine.DockerSockUnixPath
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("cannot decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// Register the run-step command.
+func Register(app *kingpin.Application) {
+	c := new(runStepCommand)
+
+	cmd := app.Command("run-step", "execute a step request locally and write its response to a file").
+		Action(c.run)
+
+	cmd.Arg("request", "file with the start step request json").
+		Required().
+		StringVar(&c.request)
+	cmd.Flag("setup", "file with the setup request json of the stage").
+		StringVar(&c.setup)
+	cmd.Flag("output", "file to write the poll step response json to").
+		Default("step-response.json").
+		StringVar(&c.output)
+}
@@ -0,0 +1,39 @@
+package runstep
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "step.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"id": "step1", "name": "build", "run": {"commands": ["go build"]}}`), 0600))
+
+	r := new(api.StartStepRequest)
+	assert.Nil(t, readJSON(path, r))
+	assert.Equal(t, "step1", r.ID)
+	assert.Equal(t, []string{"go build"}, r.Run.Command)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"id":`), 0600))
+	assert.ErrorContains(t, readJSON(path, r), "cannot decode")
+}
+
+func TestPipelineConfig(t *testing.T) {
+	mount := false
+	cfg := pipelineConfig(&api.SetupRequest{
+		Envs: map[string]string{"CI": "true"}, MountDockerSocket: &mount,
+	}, engine.DockerSockUnixPath)
+	assert.Equal(t, "true", cfg.Envs["CI"])
+	assert.Len(t, cfg.Volumes, 1)
+	assert.Equal(t, pipeline.SharedVolPath, cfg.Volumes[0].HostPath.Path)
+
+	cfg = pipelineConfig(&api.SetupRequest{}, "/run/podman/podman.sock")
+	assert.Len(t, cfg.Volumes, 2)
+	assert.Equal(t, "/run/podman/podman.sock", cfg.Volumes[0].HostPath.Path)
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/config"
+	"github.com/harness/lite-engine/internal/nudges"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/version"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// effectiveConfig is the configuration printed by the print-effective-config
+// command: the loaded configuration followed by the data directories, the
+// feature defaults and the garbage collection policies derived from it. An
+// empty directory disables the feature using it.
+type effectiveConfig struct {
+	Config   config.Config `yaml:",inline"`
+	DataDirs struct {
+		SharedVolume      string `yaml:"shared_volume"`
+		Certs             string `yaml:"certs"`
+		Results           string `yaml:"results"`
+		Record            string `yaml:"record"`
+		StepLogBuffer     string `yaml:"step_log_buffer"`
+		TISelection       string `yaml:"ti_selection"`
+		StepState         string `yaml:"step_state"`
+		ArtifactRetention string `yaml:"artifact_retention"`
+	} `yaml:"data_dirs"`
+	Features struct {
+		Supported            []string `yaml:"supported"`
+		LifecycleHooks       []string `yaml:"lifecycle_hooks"`
+		ContainerRuntime     string   `yaml:"container_runtime"`
+		Standalone           bool     `yaml:"standalone"`
+		StrictDecoding       bool     `yaml:"strict_decoding"`
+		LogPrefix            bool     `yaml:"log_prefix"`
+		AllowUnconfinedPaths bool     `yaml:"allow_unconfined_paths"`
+		FaultInjection       bool     `yaml:"fault_injection"`
+	} `yaml:"features"`
+	GC struct {
+		ArtifactRetentionSize int64  `yaml:"artifact_retention_size"` // the least recently used files are evicted above the size
+		StepLogRetention      int    `yaml:"step_log_retention"`      // the whole output is kept if zero
+		StepLogBufferSize     int64  `yaml:"step_log_buffer_size"`
+		NudgesCatalogTTL      string `yaml:"nudges_catalog_ttl"`
+	} `yaml:"gc"`
+}
+
+func newEffectiveConfig(c *config.Config) *effectiveConfig {
+	e := &effectiveConfig{Config: *c}
+
+	e.DataDirs.SharedVolume = pipeline.SharedVolPath
+	e.DataDirs.Certs = filepath.Dir(c.Server.CertFile)
+	if c.Server.Standalone {
+		e.DataDirs.Results = c.Server.ResultsDir
+	}
+	e.DataDirs.Record = c.Server.RecordDir
+	e.DataDirs.StepLogBuffer = c.Server.StepLogBufferDir
+	e.DataDirs.TISelection = c.Server.TISelectionDir
+	e.DataDirs.StepState = c.Server.StepStateDir
+	e.DataDirs.ArtifactRetention = c.Server.ArtifactRetentionDir
+
+	e.Features.Supported = version.Features
+	e.Features.LifecycleHooks = c.Server.LifecycleHooks
+	e.Features.ContainerRuntime = c.Server.ContainerRuntime
+	e.Features.Standalone = c.Server.Standalone
+	e.Features.StrictDecoding = c.Server.StrictDecoding
+	e.Features.LogPrefix = c.Server.LogPrefix
+	e.Features.AllowUnconfinedPaths = c.Server.AllowUnconfinedPaths
+	e.Features.FaultInjection = c.Server.FaultInjection != ""
+
+	if c.Server.ArtifactRetentionDir != "" {
+		e.GC.ArtifactRetentionSize = c.Server.ArtifactRetentionSize
+	}
+	e.GC.StepLogRetention = c.Server.StepLogRetention
+	if c.Server.StepLogBufferDir != "" {
+		e.GC.StepLogBufferSize = c.Server.StepLogBufferSize
+	}
+	e.GC.NudgesCatalogTTL = nudges.DefaultTTL.String()
+	return e
+}
+
+type printConfigCommand struct {
+	envfile    string
+	configFile string
+}
+
+func (c *printConfigCommand) run(*kingpin.ParseContext) error {
+	loadedConfig, err := loadConfig(c.envfile, c.configFile)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(newEffectiveConfig(&loadedConfig))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func registerPrintConfig(app *kingpin.Application) {
+	c := new(printConfigCommand)
+
+	cmd := app.Command("print-effective-config", "print the configuration after applying the config file and environment").
+		Action(c.run)
+
+	cmd.Flag("env-file", "environment file").
+		Default(".env").
+		StringVar(&c.envfile)
+	cmd.Flag("config", "yaml configuration file, values set in the environment take precedence").
+		Envar("LITE_ENGINE_CONFIG").
+		StringVar(&c.configFile)
+}
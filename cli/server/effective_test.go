@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/config"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	t.Setenv("ARTIFACT_RETENTION_DIR", "/var/lib/lite-engine/artifacts")
+	cfg, err := config.Load()
+	assert.Nil(t, err)
+
+	e := newEffectiveConfig(&cfg)
+	assert.Equal(t, pipeline.SharedVolPath, e.DataDirs.SharedVolume)
+	assert.Equal(t, "/tmp/certs", e.DataDirs.Certs)
+	assert.Equal(t, "/var/lib/lite-engine/artifacts", e.DataDirs.ArtifactRetention)
+	// the results directory is only used in standalone mode
+	assert.Empty(t, e.DataDirs.Results)
+	assert.Equal(t, []string{"metrics"}, e.Features.LifecycleHooks)
+	assert.Equal(t, int64(1073741824), e.GC.ArtifactRetentionSize)
+	assert.Zero(t, e.GC.StepLogBufferSize)
+
+	out, err := yaml.Marshal(e)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "server_name: drone\n")
+	assert.Contains(t, string(out), "\ndata_dirs:\n")
+	assert.Contains(t, string(out), "\nfeatures:\n")
+	assert.Contains(t, string(out), "\ngc:\n")
+}
@@ -0,0 +1,28 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReexec relays the signal sent by the upgrade command to c.
+func notifyReexec(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
+
+// reexec replaces the running process with the current executable,
+// keeping the command line arguments and the environment.
+func reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
@@ -0,0 +1,18 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build windows
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+func notifyReexec(chan<- os.Signal) {}
+
+func reexec() error {
+	return errors.New("re-executing the server is not supported on windows")
+}
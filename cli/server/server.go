@@ -10,15 +10,30 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 
 	"github.com/harness/lite-engine/config"
 	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/containerd"
 	"github.com/harness/lite-engine/engine/docker"
+	"github.com/harness/lite-engine/engine/kubernetes"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/harness/lite-engine/engine/podman"
 	"github.com/harness/lite-engine/handler"
+	"github.com/harness/lite-engine/internal/fault"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/internal/sealed"
 	"github.com/harness/lite-engine/logger"
+	"github.com/harness/lite-engine/osstats"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/pipeline/replay"
+	"github.com/harness/lite-engine/pipeline/retention"
 	"github.com/harness/lite-engine/pipeline/runtime"
 	"github.com/harness/lite-engine/server"
 	"github.com/harness/lite-engine/setup"
+	"github.com/harness/lite-engine/ti/instrumentation"
+	"github.com/harness/lite-engine/version"
 
 	"github.com/harness/godotenv/v3"
 	"github.com/sirupsen/logrus"
@@ -26,37 +41,149 @@ import (
 )
 
 type serverCommand struct {
-	envfile string
+	envfile    string
+	configFile string
 }
 
-func (c *serverCommand) run(*kingpin.ParseContext) error {
-	if c.envfile != "" {
-		loadEnvErr := godotenv.Overload(c.envfile)
+// loadConfig loads the system configuration from the config file and the
+// environment, after loading the env file.
+func loadConfig(envfile, configFile string) (config.Config, error) {
+	if envfile != "" {
+		loadEnvErr := godotenv.Overload(envfile)
 		if loadEnvErr != nil {
 			logrus.
 				WithError(loadEnvErr).
 				Errorln("cannot load env file")
 		}
 	}
-	// load the system configuration from the environment.
-	loadedConfig, err := config.Load()
+	loadedConfig, err := config.LoadFile(configFile)
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("cannot load the service configuration")
+	}
+	return loadedConfig, err
+}
+
+func (c *serverCommand) run(*kingpin.ParseContext) error {
+	loadedConfig, err := loadConfig(c.envfile, c.configFile)
+	if err != nil {
 		return err
 	}
+	setProxyEnvs(&loadedConfig)
 
 	// init the system logging.
 	initLogging(&loadedConfig)
 
-	engine, err := engine.NewEnv(docker.Opts{})
+	logrus.WithField("version", version.Version).
+		WithField("features", strings.Join(version.Features, ",")).
+		Infoln("starting lite engine")
+
+	if loadedConfig.Server.AllowUnconfinedPaths {
+		logrus.Warnln("path confinement checks are disabled")
+	}
+	safepath.AllowUnconfined(loadedConfig.Server.AllowUnconfinedPaths)
+
+	if loadedConfig.Server.FileUmask != "" {
+		umask, uerr := fileperm.Parse(loadedConfig.Server.FileUmask)
+		if uerr != nil {
+			logrus.WithError(uerr).
+				Errorln("failed to configure the file umask")
+			return uerr
+		}
+		fileperm.SetUmask(umask)
+	}
+
+	if err := sealed.Configure(loadedConfig.Server.SealedSecretsKeyFile); err != nil {
+		logrus.WithError(err).
+			Errorln("failed to configure the key of the sealed secrets")
+		return err
+	}
+
+	if err := fault.Configure(loadedConfig.Server.FaultInjection, loadedConfig.Server.FaultInjectionSeed); err != nil {
+		logrus.WithError(err).
+			Errorln("failed to configure the fault injection")
+		return err
+	}
+	if loadedConfig.Server.FaultInjection != "" {
+		logrus.WithField("rules", loadedConfig.Server.FaultInjection).
+			WithField("seed", loadedConfig.Server.FaultInjectionSeed).
+			Warnln("fault injection is enabled")
+	}
+
+	if loadedConfig.Server.Standalone {
+		if err := pipeline.EnableStandalone(loadedConfig.Server.ResultsDir); err != nil {
+			logrus.WithError(err).
+				Errorln("failed to create the results directory")
+			return err
+		}
+		logrus.WithField("dir", loadedConfig.Server.ResultsDir).Infoln("running in standalone mode")
+	}
+
+	if err := lifecycle.Configure(loadedConfig.Server.LifecycleHooks, loadedConfig.Server.LifecyclePlugins); err != nil {
+		logrus.WithError(err).
+			Errorln("failed to configure the lifecycle hooks")
+		return err
+	}
+
+	engine, err := newEngine(loadedConfig.Server.ContainerRuntime, loadedConfig.Server.PodmanSocket,
+		loadedConfig.Server.DockerSocket)
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("failed to initialize engine")
 		return err
 	}
 
+	engine.ConfigureKubernetes(kubernetes.Opts{
+		Namespace:      loadedConfig.Server.Kubernetes.Namespace,
+		NodeName:       loadedConfig.Server.Kubernetes.NodeName,
+		ServiceAccount: loadedConfig.Server.Kubernetes.ServiceAccount,
+		VolumeDir:      loadedConfig.Server.Kubernetes.VolumeDir,
+		Tolerations:    loadedConfig.Server.Kubernetes.Tolerations,
+	})
+	engine.ConfigureContainerd(containerd.Opts{
+		Binary:    loadedConfig.Server.Containerd.Nerdctl,
+		Address:   loadedConfig.Server.Containerd.Address,
+		Namespace: loadedConfig.Server.Containerd.Namespace,
+	})
+
+	lifecycle.Register(lifecycle.NewTimelineHook(engine))
+	if loadedConfig.Server.RecordDir != "" {
+		lifecycle.Register(replay.NewRecorder(loadedConfig.Server.RecordDir, engine))
+		logrus.WithField("dir", loadedConfig.Server.RecordDir).Infoln("recording the step executions")
+	}
+	if dir := loadedConfig.Server.ArtifactRetentionDir; dir != "" {
+		store, err := retention.New(dir, loadedConfig.Server.ArtifactRetentionSize)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("failed to create the artifact retention directory")
+			return err
+		}
+		lifecycle.Register(store)
+		logrus.WithField("dir", dir).Infoln("retaining the artifacts of the steps")
+	}
+
+	runtime.SetImageInspector(engine)
+	runtime.SetContainerExecer(engine)
+	instrumentation.SetSelectionDir(loadedConfig.Server.TISelectionDir)
+	runtime.SetLogPrefix(loadedConfig.Server.LogPrefix, loadedConfig.Server.LogPrefixColor)
+	runtime.SetStepLogRetention(loadedConfig.Server.StepLogRetention)
+	if dir := loadedConfig.Server.StepLogBufferDir; dir != "" {
+		if err := os.MkdirAll(dir, fileperm.Mode(os.ModePerm)); err != nil {
+			logrus.WithError(err).
+				Errorln("failed to create the step log buffer directory")
+			return err
+		}
+	}
+	runtime.SetStepLogBuffer(loadedConfig.Server.StepLogBufferDir, loadedConfig.Server.StepLogBufferSize)
 	stepExecutor := runtime.NewStepExecutor(engine)
+	if dir := loadedConfig.Server.StepStateDir; dir != "" {
+		engine.SetStateDir(dir)
+		if err := stepExecutor.PersistState(context.Background(), dir, engine); err != nil {
+			logrus.WithError(err).
+				Errorln("failed to restore the step state")
+			return err
+		}
+	}
 
 	// create the http serverInstance.
 	serverInstance := server.Server{
@@ -82,11 +209,24 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 		case val := <-s:
 			logrus.Infof("received OS Signal to exit server: %s", val)
 			cancel()
+		case <-stepExecutor.Drained():
+			logrus.Infoln("the engine is drained, exiting server")
+			cancel()
 		case <-ctx.Done():
 			logrus.Infoln("received a done signal to exit server")
 		}
 	}()
 
+	// restart with the upgraded binary on request of the upgrade command.
+	reexecCh := make(chan os.Signal, 1)
+	notifyReexec(reexecCh)
+	defer signal.Stop(reexecCh)
+	go func() {
+		for range reexecCh {
+			restart(stepExecutor)
+		}
+	}()
+
 	logrus.Infof(fmt.Sprintf("server listening at port %s", loadedConfig.Server.Bind))
 	// run the setup checks / installation
 	if loadedConfig.Server.SkipPrepareServer {
@@ -94,6 +234,8 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 	} else {
 		setup.PrepareSystem()
 	}
+	// probe the host in the background so the first setup does not wait.
+	go osstats.Fingerprint()
 	// starts the http server.
 	err = serverInstance.Start(ctx)
 	if err == context.Canceled {
@@ -108,6 +250,26 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 	return err
 }
 
+// restart re-executes the server binary right away, the new steps are
+// refused until then. The new process re-attaches to the running steps from
+// the step state, so without it the restart is refused while steps are
+// running. The steps are started again if the restart fails.
+func restart(stepExecutor *runtime.StepExecutor) {
+	// a canceled drain only stops the new steps, it does not wait.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n := stepExecutor.Drain(ctx); n > 0 && !stepExecutor.Checkpoint() {
+		logrus.Warnf("not restarting the server, %d steps are running and the step state is not kept", n)
+		stepExecutor.Resume()
+		return
+	}
+	logrus.Infoln("restarting the server with the upgraded binary")
+	if err := reexec(); err != nil {
+		logrus.WithError(err).Errorln("failed to restart the server")
+		stepExecutor.Resume()
+	}
+}
+
 // Register the server commands.
 func Register(app *kingpin.Application) {
 	c := new(serverCommand)
@@ -118,6 +280,11 @@ func Register(app *kingpin.Application) {
 	cmd.Flag("env-file", "environment file").
 		Default(".env").
 		StringVar(&c.envfile)
+	cmd.Flag("config", "yaml configuration file, values set in the environment take precedence").
+		Envar("LITE_ENGINE_CONFIG").
+		StringVar(&c.configFile)
+
+	registerPrintConfig(app)
 }
 
 // Get stackdriver to display logs correctly https://github.com/sirupsen/logrus/issues/403
@@ -141,4 +308,45 @@ func initLogging(c *config.Config) {
 	if c.Trace {
 		l.SetLevel(logrus.TraceLevel)
 	}
+	if c.LogLevel != "" {
+		level, err := logrus.ParseLevel(c.LogLevel)
+		if err != nil {
+			logrus.WithError(err).Warnln("ignoring invalid log level")
+			return
+		}
+		l.SetLevel(level)
+	}
+}
+
+// helper function exports the proxy configuration to the environment so
+// that it is used by the http clients of the engine.
+func setProxyEnvs(c *config.Config) {
+	proxyEnvs := map[string]string{
+		"HTTP_PROXY":  c.Proxy.HTTP,
+		"HTTPS_PROXY": c.Proxy.HTTPS,
+		"NO_PROXY":    c.Proxy.NoProxy,
+	}
+	for k, v := range proxyEnvs {
+		if v != "" {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+// newEngine returns the engine running the container steps with the
+// container runtime.
+func newEngine(containerRuntime, podmanSocket, dockerSocket string) (*engine.Engine, error) {
+	switch strings.ToLower(containerRuntime) {
+	case "", "docker":
+		return engine.NewEnv(docker.Opts{Socket: dockerSocket})
+	case "podman":
+		e, err := engine.NewPodmanEnv(podman.Opts{Socket: podmanSocket})
+		if err != nil {
+			return nil, err
+		}
+		logrus.WithField("socket", e.SocketPath()).Infoln("running the container steps with podman")
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q", containerRuntime)
+	}
 }
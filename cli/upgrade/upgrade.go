@@ -0,0 +1,154 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	binaryPermissions = 0755
+	downloadTimeout   = 10 * time.Minute
+)
+
+type upgradeCommand struct {
+	url      string
+	checksum string
+	path     string
+	pid      int
+}
+
+func (c *upgradeCommand) run(*kingpin.ParseContext) error {
+	path := c.path
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if path, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	if err := Upgrade(ctx, http.DefaultClient, c.url, c.checksum, path); err != nil {
+		logrus.WithError(err).Errorln("upgrade failed")
+		return err
+	}
+	logrus.WithField("path", path).Infoln("lite engine binary upgraded")
+
+	if c.pid == 0 {
+		return nil
+	}
+	// the server re-executes the upgraded binary on SIGHUP.
+	p, err := os.FindProcess(c.pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGHUP)
+}
+
+// Upgrade downloads the binary from the https url, verifies it against the
+// pinned sha256 checksum and atomically replaces the binary at path with it.
+func Upgrade(ctx context.Context, client *http.Client, binaryURL, checksum, path string) error {
+	want, err := hex.DecodeString(strings.TrimSpace(checksum))
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid sha256 checksum %q", checksum)
+	}
+	if u, perr := url.Parse(binaryURL); perr != nil || u.Scheme != "https" {
+		return fmt.Errorf("the binary url %q is not an https url", binaryURL)
+	}
+
+	body, err := get(ctx, client, binaryURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// the temporary file is created next to the binary so that the rename is atomic.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".upgrade-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %s: %w", binaryURL, err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("checksum mismatch: expected %x, got %x", want, got)
+	}
+
+	if err = os.Chmod(tmp.Name(), binaryPermissions); err != nil {
+		return err
+	}
+	// a running executable cannot be replaced on windows, but it can be renamed.
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		_ = os.Remove(old)
+		if err = os.Rename(path, old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func get(ctx context.Context, client *http.Client, binaryURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, binaryURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot download %s: %s", binaryURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Register the upgrade command.
+func Register(app *kingpin.Application) {
+	c := new(upgradeCommand)
+
+	cmd := app.Command("upgrade", "upgrade the lite engine binary").
+		Action(c.run)
+
+	cmd.Flag("url", "https url of the new lite engine binary").
+		Required().
+		StringVar(&c.url)
+	cmd.Flag("checksum", "pinned sha256 checksum of the binary").
+		Required().
+		StringVar(&c.checksum)
+	cmd.Flag("path", "path of the binary to replace, defaults to the running executable").
+		StringVar(&c.path)
+	cmd.Flag("pid", "pid of the lite engine server to restart with the upgraded binary").
+		IntVar(&c.pid)
+}
@@ -0,0 +1,51 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgrade(t *testing.T) {
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lite-engine" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(binary)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "lite-engine")
+	assert.Nil(t, os.WriteFile(path, []byte("old binary"), 0600))
+
+	// the binary is only downloaded over https
+	err := Upgrade(context.Background(), srv.Client(), "http"+srv.URL[len("https"):]+"/lite-engine", checksum, path)
+	assert.ErrorContains(t, err, "not an https url")
+
+	err = Upgrade(context.Background(), srv.Client(), srv.URL+"/lite-engine", "00"+checksum[2:], path)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "old binary", string(data))
+
+	err = Upgrade(context.Background(), srv.Client(), srv.URL+"/missing", checksum, path)
+	assert.ErrorContains(t, err, "404")
+
+	assert.Nil(t, Upgrade(context.Background(), srv.Client(), srv.URL+"/lite-engine", checksum, path))
+	data, _ = os.ReadFile(path)
+	assert.Equal(t, binary, data)
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	assert.Len(t, entries, 1)
+}
@@ -5,36 +5,168 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
 	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v2"
 )
 
 // Config provides the system configuration.
 type Config struct {
-	Debug      bool   `envconfig:"DEBUG"`
-	Trace      bool   `envconfig:"TRACE"`
-	ServerName string `envconfig:"SERVER_NAME" default:"drone"`
+	Debug      bool   `envconfig:"DEBUG" yaml:"debug"`
+	Trace      bool   `envconfig:"TRACE" yaml:"trace"`
+	LogLevel   string `envconfig:"LOG_LEVEL" yaml:"log_level"` // one of the logrus levels, takes precedence over debug and trace
+	ServerName string `envconfig:"SERVER_NAME" default:"drone" yaml:"server_name"`
 
 	Server struct {
-		Bind              string `envconfig:"HTTPS_BIND" default:":9079"`
-		CertFile          string `envconfig:"SERVER_CERT_FILE" default:"/tmp/certs/server-cert.pem"` // Server certificate PEM file
-		KeyFile           string `envconfig:"SERVER_KEY_FILE" default:"/tmp/certs/server-key.pem"`   // Server key PEM file
-		CACertFile        string `envconfig:"CLIENT_CERT_FILE" default:"/tmp/certs/ca-cert.pem"`     // CA certificate file
-		SkipPrepareServer bool   `envconfig:"SKIP_PREPARE_SERVER" default:"false"`                   // skip prepare server, install docker / git
-		Insecure          bool   `envconfig:"SERVER_INSECURE" default:"false"`                       // run in insecure mode
-	}
+		Bind              string `envconfig:"HTTPS_BIND" default:":9079" yaml:"bind"`
+		CertFile          string `envconfig:"SERVER_CERT_FILE" default:"/tmp/certs/server-cert.pem" yaml:"cert_file"` // Server certificate PEM file
+		KeyFile           string `envconfig:"SERVER_KEY_FILE" default:"/tmp/certs/server-key.pem" yaml:"key_file"`    // Server key PEM file
+		CACertFile        string `envconfig:"CLIENT_CERT_FILE" default:"/tmp/certs/ca-cert.pem" yaml:"ca_cert_file"`  // CA certificate file
+		SkipPrepareServer bool   `envconfig:"SKIP_PREPARE_SERVER" default:"false" yaml:"skip_prepare_server"`         // skip prepare server, install docker / git
+		Insecure          bool   `envconfig:"SERVER_INSECURE" default:"false" yaml:"insecure"`                        // run in insecure mode
+		// AllowUnconfinedPaths allows steps to expose their output and secret variable files and their
+		// test reports outside of the workspace or shared volume to the engine
+		AllowUnconfinedPaths bool `envconfig:"ALLOW_UNCONFINED_PATHS" default:"false" yaml:"allow_unconfined_paths"`
+		// MaxRequestBodySize is the maximum size in bytes of an api request body
+		MaxRequestBodySize int64 `envconfig:"MAX_REQUEST_BODY_SIZE" default:"52428800" yaml:"max_request_body_size"`
+		// StrictDecoding rejects the api requests with unknown fields instead of ignoring them.
+		// Off by default, the runners newer than the engine send the fields it does not know,
+		// eg. the compatibility of the setup.
+		StrictDecoding bool `envconfig:"STRICT_REQUEST_DECODING" default:"false" yaml:"strict_decoding"`
+		// LifecycleHooks are the built-in step lifecycle hooks to enable: metrics, audit
+		LifecycleHooks []string `envconfig:"LIFECYCLE_HOOKS" default:"metrics" yaml:"lifecycle_hooks"`
+		// LifecyclePlugins are the paths of Go plugins exporting step lifecycle hooks
+		LifecyclePlugins []string `envconfig:"LIFECYCLE_PLUGINS" yaml:"lifecycle_plugins"`
+		// Standalone writes the step results, logs and test reports to ResultsDir
+		// instead of sending them to the delegate, log service and TI service
+		Standalone bool   `envconfig:"STANDALONE" default:"false" yaml:"standalone"`
+		ResultsDir string `envconfig:"STANDALONE_RESULTS_DIR" default:"/tmp/lite-engine/results" yaml:"results_dir"`
+		// LogPrefix prefixes the log lines of the steps running in drone mode with the step name and shard
+		LogPrefix      bool `envconfig:"LOG_PREFIX" default:"false" yaml:"log_prefix"`
+		LogPrefixColor bool `envconfig:"LOG_PREFIX_COLOR" default:"false" yaml:"log_prefix_color"`
+		// RecordDir is the directory the replay bundles of the steps are written to, recording is disabled if not set
+		RecordDir string `envconfig:"RECORD_DIR" yaml:"record_dir"`
+		// StepLogRetention is the number of bytes of each step output kept in memory for the output
+		// streaming, eg. for long running daemon steps. The whole output is kept if zero, the older
+		// output is streamed from the ring buffer of the step if StepLogBufferDir is set
+		StepLogRetention int `envconfig:"STEP_LOG_RETENTION" default:"0" yaml:"step_log_retention"`
+		// StepLogBufferDir keeps the last StepLogBufferSize bytes of each step output in a file in the dir, so the
+		// output can be streamed after the engine restarts. Disabled if not set
+		StepLogBufferDir  string `envconfig:"STEP_LOG_BUFFER_DIR" yaml:"step_log_buffer_dir"`
+		StepLogBufferSize int64  `envconfig:"STEP_LOG_BUFFER_SIZE" default:"8388608" yaml:"step_log_buffer_size"`
+		// TISelectionDir keeps the last test selection of the steps to log how the selection changed
+		// between consecutive runs, eg. a directory persisted across the VMs of the pipeline. Disabled if not set
+		TISelectionDir string `envconfig:"TI_SELECTION_DIR" yaml:"ti_selection_dir"`
+		// StepStateDir keeps the state of the steps so that a restarted engine re-attaches to the containers
+		// of the running steps. Disabled if not set
+		StepStateDir string `envconfig:"STEP_STATE_DIR" yaml:"step_state_dir"`
+		// ArtifactRetentionDir keeps the reports and the uploaded files of the steps, fetched from the
+		// /artifacts endpoints when their upload failed. Disabled if not set
+		ArtifactRetentionDir  string `envconfig:"ARTIFACT_RETENTION_DIR" yaml:"artifact_retention_dir"`
+		ArtifactRetentionSize int64  `envconfig:"ARTIFACT_RETENTION_SIZE" default:"1073741824" yaml:"artifact_retention_size"` // the least recently used files are evicted above the size
+		// SealedSecretsKeyFile keeps the private key opening the sealed envs of the requests, created if it
+		// does not exist. A new key is generated at each start if not set
+		SealedSecretsKeyFile string `envconfig:"SEALED_SECRETS_KEY_FILE" yaml:"sealed_secrets_key_file"`
+		// FaultInjection injects failures and delays into the docker, log service and TI calls, eg.
+		// docker:0.2,logstream:0:2s,ti:1. Only available in binaries built with the faultinject tag
+		FaultInjection     string `envconfig:"FAULT_INJECTION" yaml:"fault_injection"`
+		FaultInjectionSeed int64  `envconfig:"FAULT_INJECTION_SEED" default:"1" yaml:"fault_injection_seed"`
+		// FileUmask is the octal umask of the files and directories created by the engine, eg. the
+		// host volumes, the step files and the certificates, eg. 0027. 0022 if not set
+		FileUmask string `envconfig:"FILE_UMASK" yaml:"file_umask"`
+		// ContainerRuntime is the engine running the container steps, docker or podman
+		ContainerRuntime string `envconfig:"CONTAINER_RUNTIME" default:"docker" yaml:"container_runtime"`
+		PodmanSocket     string `envconfig:"PODMAN_SOCKET" yaml:"podman_socket"` // the socket of the podman service, from CONTAINER_HOST or the default socket if not set
+		// DockerSocket is the socket of the docker daemon mounted in the steps, eg. the socket
+		// $XDG_RUNTIME_DIR/docker.sock of a rootless daemon, from DOCKER_HOST or the default socket if not set
+		DockerSocket string `envconfig:"DOCKER_SOCKET" yaml:"docker_socket"`
+		// Kubernetes configures the pods of the stages running their container steps on kubernetes
+		Kubernetes struct {
+			Namespace      string   `envconfig:"KUBERNETES_NAMESPACE" yaml:"namespace"` // the namespace of the engine if not set
+			NodeName       string   `envconfig:"KUBERNETES_NODE_NAME" yaml:"node_name"` // the node of the engine, eg. from the downward API
+			ServiceAccount string   `envconfig:"KUBERNETES_SERVICE_ACCOUNT" yaml:"service_account"`
+			VolumeDir      string   `envconfig:"KUBERNETES_VOLUME_DIR" yaml:"volume_dir"`   // the node directory of the temporary volumes
+			Tolerations    []string `envconfig:"KUBERNETES_TOLERATIONS" yaml:"tolerations"` // key:effect
+		} `yaml:"kubernetes"`
+		// Containerd configures the stages running their container steps with containerd
+		Containerd struct {
+			Nerdctl   string `envconfig:"NERDCTL_PATH" yaml:"nerdctl"`           // nerdctl from PATH if not set
+			Address   string `envconfig:"CONTAINERD_ADDRESS" yaml:"address"`     // eg. /run/k3s/containerd/containerd.sock
+			Namespace string `envconfig:"CONTAINERD_NAMESPACE" yaml:"namespace"` // the nerdctl default if not set
+		} `yaml:"containerd"`
+	} `yaml:"server"`
 
 	Client struct {
-		Bind       string `envconfig:"HTTPS_BIND" default:":9079"`
-		CertFile   string `envconfig:"CLIENT_CERT_FILE" default:"/tmp/certs/server-cert.pem"` // Server certificate PEM file
-		KeyFile    string `envconfig:"CLIENT_KEY_FILE" default:"/tmp/certs/server-key.pem"`   // Server Key PEM file
-		CaCertFile string `envconfig:"CA_CERT_FILE" default:"/tmp/certs/ca-cert.pem"`         // CA certificate file
-		Insecure   bool   `envconfig:"CLIENT_INSECURE" default:"false"`                       // dont check server certificate
-	}
+		Bind       string `envconfig:"HTTPS_BIND" default:":9079" yaml:"bind"`
+		CertFile   string `envconfig:"CLIENT_CERT_FILE" default:"/tmp/certs/server-cert.pem" yaml:"cert_file"` // Server certificate PEM file
+		KeyFile    string `envconfig:"CLIENT_KEY_FILE" default:"/tmp/certs/server-key.pem" yaml:"key_file"`    // Server Key PEM file
+		CaCertFile string `envconfig:"CA_CERT_FILE" default:"/tmp/certs/ca-cert.pem" yaml:"ca_cert_file"`      // CA certificate file
+		Insecure   bool   `envconfig:"CLIENT_INSECURE" default:"false" yaml:"insecure"`                        // dont check server certificate
+	} `yaml:"client"`
+
+	// Proxy used by the engine for outbound requests eg. log and TI service calls.
+	Proxy struct {
+		HTTP    string `envconfig:"HTTP_PROXY" yaml:"http"`
+		HTTPS   string `envconfig:"HTTPS_PROXY" yaml:"https"`
+		NoProxy string `envconfig:"NO_PROXY" yaml:"no_proxy"`
+	} `yaml:"proxy"`
 }
 
 // Load loads the configuration from the environment.
 func Load() (Config, error) {
+	return LoadFile("")
+}
+
+// LoadFile loads the configuration from the yaml file at path, if set.
+// Values set in the environment take precedence over the file.
+func LoadFile(path string) (Config, error) {
 	cfg := Config{}
-	err := envconfig.Process("", &cfg)
-	return cfg, err
+	if err := envconfig.Process("", &cfg); err != nil || path == "" {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	fileCfg := cfg
+	if err := yaml.UnmarshalStrict(data, &fileCfg); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	overrideFromEnv(reflect.ValueOf(&fileCfg).Elem(), reflect.ValueOf(&cfg).Elem(), "")
+	return fileCfg, nil
+}
+
+// overrideFromEnv copies the fields which are explicitly set in the environment
+// from src to dst. Environment keys are looked up the same way as envconfig does.
+func overrideFromEnv(dst, src reflect.Value, prefix string) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("envconfig")
+		key := strings.ToUpper(f.Name)
+		if tag != "" {
+			key = strings.ToUpper(tag)
+		}
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + "_" + key
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			overrideFromEnv(dst.Field(i), src.Field(i), fullKey)
+			continue
+		}
+		_, ok := os.LookupEnv(fullKey)
+		if !ok && tag != "" {
+			_, ok = os.LookupEnv(key)
+		}
+		if ok {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
 }
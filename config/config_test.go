@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+log_level: warn
+server:
+  bind: ":9090"
+  insecure: true
+proxy:
+  https: http://proxy:3128
+`
+	assert.Nil(t, os.WriteFile(path, []byte(data), 0600))
+	t.Setenv("SERVER_INSECURE", "false")
+
+	cfg, err := LoadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, ":9090", cfg.Server.Bind)
+	assert.Equal(t, "http://proxy:3128", cfg.Proxy.HTTPS)
+	// set in the environment so it takes precedence over the file
+	assert.False(t, cfg.Server.Insecure)
+	// not set in the file so the default is used
+	assert.Equal(t, "/tmp/certs/server-cert.pem", cfg.Server.CertFile)
+}
+
+func TestLoadFileUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("unknown: true\n"), 0600))
+
+	_, err := LoadFile(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,397 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package egress provides the forward proxy of a stage, it records the
+// outbound destinations of the steps. Only the hosts are recorded, the
+// paths, queries and headers of the requests are not, they may hold
+// credentials.
+package egress
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	dialTimeout = 30 * time.Second
+	// the user of the credential of the proxy, the password is random
+	proxyUser = "harness"
+	// the bridge network of docker, the gateway of the containers
+	dockerBridge = "docker0"
+)
+
+// the hop-by-hop headers, removed from the forwarded requests.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Proxy forwards the HTTP requests and tunnels the HTTPS connections of the
+// steps. The requests go through the proxy of the engine environment if
+// set, eg. a corporate proxy. The steps authenticate with the credential
+// of the proxy, the other clients are rejected.
+type Proxy struct {
+	lns       []net.Listener
+	password  string
+	srv       *http.Server
+	upstream  func(*url.URL) (*url.URL, error)
+	transport *http.Transport
+
+	mu    sync.Mutex
+	hosts map[string]*api.EgressDestination
+	conns map[net.Conn]struct{} // the open tunnels, closed with the proxy
+}
+
+// New returns a proxy listening on the address, eg. "127.0.0.1:0" for a
+// random port on the loopback, and on the same port of the other hosts, eg.
+// the gateway of the containers.
+func New(addr string, hosts ...string) (*Proxy, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	lns := []net.Listener{ln}
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	for _, h := range hosts {
+		l, err := net.Listen("tcp", net.JoinHostPort(h, port))
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, l)
+	}
+	b := make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	upstream := httpproxy.FromEnvironment().ProxyFunc()
+	p := &Proxy{
+		lns:      lns,
+		password: hex.EncodeToString(b),
+		upstream: upstream,
+		hosts:    make(map[string]*api.EgressDestination),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.transport = &http.Transport{
+		Proxy:               func(r *http.Request) (*url.URL, error) { return upstream(r.URL) },
+		DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSHandshakeTimeout: dialTimeout,
+		MaxIdleConns:        100, //nolint:gomnd
+		IdleConnTimeout:     90 * time.Second,
+	}
+	p.srv = &http.Server{Handler: p, ReadHeaderTimeout: dialTimeout}
+	return p, nil
+}
+
+// Port returns the port the proxy listens on.
+func (p *Proxy) Port() int {
+	return p.lns[0].Addr().(*net.TCPAddr).Port
+}
+
+// Credential returns the credential of the proxy, user:password, set in the
+// proxy url of the steps.
+func (p *Proxy) Credential() string {
+	return proxyUser + ":" + p.password
+}
+
+// Start serves the requests until the proxy is closed.
+func (p *Proxy) Start() {
+	for _, ln := range p.lns {
+		go p.srv.Serve(ln) //nolint:errcheck
+	}
+}
+
+// BridgeGateway returns the address of the host on the bridge network of
+// docker, the gateway of the containers, empty if there is no bridge.
+func BridgeGateway() (string, error) {
+	iface, err := net.InterfaceByName(dockerBridge)
+	if err != nil {
+		return "", nil //nolint:nilerr
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+			return n.IP.String(), nil
+		}
+	}
+	return "", errors.New("the docker bridge has no ipv4 address")
+}
+
+// Close stops the proxy and closes the open tunnels.
+func (p *Proxy) Close() error {
+	err := p.srv.Close()
+	p.transport.CloseIdleConnections()
+	p.mu.Lock()
+	for c := range p.conns {
+		c.Close()
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// Summary returns the destinations of the requests, sorted by host.
+func (p *Proxy) Summary() []*api.EgressDestination {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	summary := make([]*api.EgressDestination, 0, len(p.hosts))
+	for _, d := range p.hosts {
+		c := *d
+		c.StatusCodes = make(map[int]int, len(d.StatusCodes))
+		for k, v := range d.StatusCodes {
+			c.StatusCodes[k] = v
+		}
+		summary = append(summary, &c)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Host < summary[j].Host })
+	return summary
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="lite-engine"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+	host := hostPort(r.URL.Scheme, r.URL.Host)
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	var sent int64
+	if r.Body != nil && r.Body != http.NoBody {
+		out.Body = &countingReader{r: r.Body, n: &sent}
+	}
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		p.record(host, 0, atomic.LoadInt64(&sent), 0)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	received, _ := io.Copy(w, resp.Body)
+	p.record(host, resp.StatusCode, atomic.LoadInt64(&sent), received)
+}
+
+// authorized returns true if the request has the credential of the proxy.
+func (p *Proxy) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Proxy-Authorization")
+	if len(auth) < len("Basic ") || !strings.EqualFold(auth[:len("Basic ")], "Basic ") {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(auth[len("Basic "):])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(b, []byte(p.Credential())) == 1
+}
+
+// tunnel connects the client to the host of the CONNECT request.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	host := hostPort("https", r.Host)
+	upstream, err := p.dial(r.Context(), host)
+	if err != nil {
+		p.record(host, 0, 0, 0)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	p.track(client, upstream)
+	defer p.untrack(client, upstream)
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	var sent int64
+	done := make(chan struct{})
+	go func() {
+		// the client may have sent data with the request, eg. the TLS
+		// client hello, it is buffered
+		sent, _ = io.Copy(upstream, io.MultiReader(io.LimitReader(buf, int64(buf.Reader.Buffered())), client))
+		closeWrite(upstream)
+		close(done)
+	}()
+	received, _ := io.Copy(client, upstream)
+	closeWrite(client)
+	<-done
+	p.record(host, http.StatusOK, sent, received)
+}
+
+// dial connects to the host, through the proxy of the engine if set.
+func (p *Proxy) dial(ctx context.Context, host string) (net.Conn, error) {
+	proxyURL, err := p.upstream(&url.URL{Scheme: "https", Host: host})
+	if err != nil {
+		return nil, err
+	}
+	d := &net.Dialer{Timeout: dialTimeout}
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", host)
+	}
+	conn, err := d.DialContext(ctx, "tcp", hostPort(proxyURL.Scheme, proxyURL.Host))
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: host},
+		Host:   host,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", proxyURL.Host, resp.Status)
+	}
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// record adds a request to the summary of the host, the status is 0 if the
+// request failed.
+func (p *Proxy) record(host string, status int, sent, received int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.hosts[host]
+	if d == nil {
+		d = &api.EgressDestination{Host: host, StatusCodes: make(map[int]int)}
+		p.hosts[host] = d
+	}
+	d.Requests++
+	d.BytesSent += sent
+	d.BytesReceived += received
+	if status == 0 {
+		d.Errors++
+	} else {
+		d.StatusCodes[status]++
+	}
+}
+
+func (p *Proxy) track(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+}
+
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+		delete(p.conns, c)
+	}
+}
+
+// hostPort returns the host with the default port of the scheme if it has
+// none.
+func hostPort(scheme, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := 80
+	if scheme == "https" {
+		port = 443
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
+func closeWrite(c net.Conn) {
+	if b, ok := c.(*bufferedConn); ok {
+		c = b.Conn
+	}
+	if tcp, ok := c.(*net.TCPConn); ok {
+		tcp.CloseWrite() //nolint:errcheck
+		return
+	}
+	c.Close()
+}
+
+type countingReader struct {
+	r io.ReadCloser
+	n *int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// bufferedConn reads the data buffered while reading the response of the
+// proxy first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
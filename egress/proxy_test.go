@@ -0,0 +1,119 @@
+package egress
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProxy(t *testing.T) (*Proxy, *http.Client) {
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("HTTPS_PROXY", "")
+	p, err := New("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	t.Cleanup(func() { p.Close() })
+	proxyURL, _ := url.Parse(fmt.Sprintf("http://%s@127.0.0.1:%d", p.Credential(), p.Port()))
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+	}}
+	return p, client
+}
+
+func TestProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.Copy(io.Discard, r.Body) //nolint:errcheck
+		io.WriteString(w, "hello")  //nolint:errcheck
+	}))
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure") //nolint:errcheck
+	}))
+	defer tlsSrv.Close()
+
+	p, client := newProxy(t)
+	resp, err := client.Post(srv.URL+"/upload?token=secret", "text/plain", strings.NewReader("data"))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+
+	resp, err = client.Get(srv.URL + "/missing")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = client.Get(tlsSrv.URL)
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "secure", string(body))
+	client.CloseIdleConnections() // ends the tunnel
+
+	// a closed port
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+	_, err = client.Get("http://" + closed)
+	assert.Nil(t, err)
+
+	srvHost := strings.TrimPrefix(srv.URL, "http://")
+	tlsHost := strings.TrimPrefix(tlsSrv.URL, "https://")
+	assert.Eventually(t, func() bool { return len(p.Summary()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	summary := map[string]*api.EgressDestination{}
+	for _, d := range p.Summary() {
+		summary[d.Host] = d
+	}
+	assert.Equal(t, 2, summary[srvHost].Requests)
+	assert.Equal(t, int64(4), summary[srvHost].BytesSent)
+	assert.Equal(t, map[int]int{200: 1, 404: 1}, summary[srvHost].StatusCodes)
+	assert.Equal(t, map[int]int{200: 1}, summary[tlsHost].StatusCodes)
+	assert.Greater(t, summary[tlsHost].BytesReceived, int64(len("secure")))
+	assert.Equal(t, 1, summary[closed].Errors)
+}
+
+func TestProxyAuthentication(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello") //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	p, _ := newProxy(t)
+	for _, user := range []*url.Userinfo{nil, url.UserPassword("harness", "wrong")} {
+		proxyURL := &url.URL{Scheme: "http", User: user, Host: fmt.Sprintf("127.0.0.1:%d", p.Port())}
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Get(srv.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+
+		// the tunnels are rejected too
+		_, err = client.Get(strings.Replace(srv.URL, "http://", "https://", 1))
+		assert.NotNil(t, err)
+	}
+	assert.Empty(t, p.Summary())
+}
+
+func TestHostPort(t *testing.T) {
+	assert.Equal(t, "example.com:80", hostPort("http", "example.com"))
+	assert.Equal(t, "example.com:443", hostPort("https", "example.com"))
+	assert.Equal(t, "example.com:8080", hostPort("https", "example.com:8080"))
+	assert.Equal(t, "[::1]:443", hostPort("https", "[::1]"))
+}
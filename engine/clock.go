@@ -0,0 +1,28 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+// setClockEnvs sets the timezone and fake time variables of the step. Values
+// set explicitly in the step environment are left untouched.
+func setClockEnvs(clock *spec.Clock, envs map[string]string) {
+	if clock == nil {
+		return
+	}
+	setEnvIfUnset(envs, "TZ", clock.Timezone)
+	setEnvIfUnset(envs, "FAKETIME", clock.FakeTime)
+	if clock.FakeTime != "" {
+		setEnvIfUnset(envs, "LD_PRELOAD", clock.FakeTimeLib)
+	}
+}
+
+func setEnvIfUnset(envs map[string]string, k, v string) {
+	if _, ok := envs[k]; !ok && v != "" {
+		envs[k] = v
+	}
+}
@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetClockEnvs(t *testing.T) {
+	envs := map[string]string{"TZ": "UTC"}
+	setClockEnvs(&spec.Clock{
+		Timezone:    "Asia/Kolkata",
+		FakeTime:    "@2024-01-01 10:00:00",
+		FakeTimeLib: "/usr/lib/faketime/libfaketime.so.1",
+	}, envs)
+	assert.Equal(t, map[string]string{
+		"TZ":         "UTC",
+		"FAKETIME":   "@2024-01-01 10:00:00",
+		"LD_PRELOAD": "/usr/lib/faketime/libfaketime.so.1",
+	}, envs)
+
+	envs = map[string]string{}
+	setClockEnvs(&spec.Clock{Timezone: "Asia/Kolkata", FakeTimeLib: "/lib/libfaketime.so.1"}, envs)
+	assert.Equal(t, map[string]string{"TZ": "Asia/Kolkata"}, envs)
+}
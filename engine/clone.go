@@ -0,0 +1,230 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	osruntime "runtime"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/sirupsen/logrus"
+)
+
+// The methods cloning a workspace, tried in order.
+const (
+	cloneOverlay = "overlay" // an overlayfs mount with the workspace as lower directory
+	cloneReflink = "reflink" // a copy sharing the blocks of the workspace, eg. on btrfs or xfs
+	cloneRsync   = "rsync"   // a full copy
+)
+
+var cloneMethods = []string{cloneOverlay, cloneReflink, cloneRsync}
+
+// workspaceClone is the copy-on-write clone of the workspace of a step.
+type workspaceClone struct {
+	dir     string // the directory of the clone, removed with it
+	path    string // the root of the cloned workspace
+	method  string
+	mounted bool // if the overlayfs of the clone is mounted
+}
+
+// cloneWorkspace clones the workspace src in dir with the first method
+// supported by the host.
+func cloneWorkspace(ctx context.Context, src, dir string) (*workspaceClone, error) {
+	var failures []string
+	for _, method := range cloneMethods {
+		c := &workspaceClone{dir: dir, path: filepath.Join(dir, "workspace"), method: method}
+		err := c.create(ctx, src)
+		if err == nil {
+			return c, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", method, err))
+		if err := c.remove(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to clone the workspace %s: %s", src, strings.Join(failures, "; "))
+}
+
+func (c *workspaceClone) create(ctx context.Context, src string) error {
+	if c.method == cloneOverlay {
+		for _, d := range []string{"upper", "work", "workspace"} {
+			if err := os.MkdirAll(filepath.Join(c.dir, d), fileperm.Mode(permissions)); err != nil {
+				return err
+			}
+		}
+	} else if err := os.MkdirAll(c.dir, fileperm.Mode(permissions)); err != nil {
+		return err
+	}
+	args, err := cloneArgs(osruntime.GOOS, c.method, src, c.dir)
+	if err != nil {
+		return err
+	}
+	if out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	c.mounted = c.method == cloneOverlay
+	return nil
+}
+
+// remove unmounts the clone if mounted and removes its directory. The
+// directory of a clone which cannot be unmounted is kept, removing it would
+// remove the files of the workspace through the mount.
+func (c *workspaceClone) remove() error {
+	if c.mounted {
+		if out, err := exec.Command("umount", c.path).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to unmount the workspace clone %s: %w: %s", c.path, err, strings.TrimSpace(string(out)))
+		}
+		c.mounted = false
+	}
+	if err := os.RemoveAll(c.dir); err != nil {
+		return err
+	}
+	// the directory of the clones of the workspace, if it was the last one
+	_ = os.Remove(filepath.Dir(c.dir))
+	return nil
+}
+
+// cloneArgs returns the command cloning the workspace src in the directory
+// of the clone dir, the clone is the workspace subdirectory.
+func cloneArgs(goos, method, src, dir string) ([]string, error) {
+	dst := filepath.Join(dir, "workspace")
+	switch {
+	case method == cloneOverlay && goos == "linux":
+		opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", src, filepath.Join(dir, "upper"), filepath.Join(dir, "work"))
+		return []string{"mount", "-t", "overlay", "overlay", "-o", opts, dst}, nil
+	case method == cloneReflink && goos == "linux":
+		return []string{"cp", "-a", "--reflink=always", src, dst}, nil
+	case method == cloneReflink && goos == "darwin":
+		// clonefile(2) on apfs
+		return []string{"cp", "-c", "-R", "-p", src, dst}, nil
+	case method == cloneRsync && goos != "windows":
+		return []string{"rsync", "-a", src + "/", dst + "/"}, nil
+	}
+	return nil, fmt.Errorf("not supported on %s", goos)
+}
+
+// workspaceVolume returns the host volume holding the working directory of
+// the step and the path of the working directory relative to the volume.
+// The volume of the longest mount path wins for the container steps.
+func workspaceVolume(cfg *spec.PipelineConfig, step *spec.Step) (*spec.Volume, string, bool) {
+	var found *spec.Volume
+	var rel string
+	longest := -1
+	match := func(vol *spec.Volume, path string) {
+		r, err := filepath.Rel(path, step.WorkingDir)
+		if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			return
+		}
+		if len(path) > longest {
+			found, rel, longest = vol, r, len(path)
+		}
+	}
+	for _, vol := range cfg.Volumes {
+		if vol == nil || vol.HostPath == nil || vol.HostPath.Path == "" {
+			continue
+		}
+		if step.Image == "" {
+			match(vol, vol.HostPath.Path)
+			continue
+		}
+		for _, mount := range step.Volumes {
+			if mount.Name == vol.HostPath.Name {
+				match(vol, mount.Path)
+			}
+		}
+	}
+	return found, rel, found != nil
+}
+
+// cloneStepWorkspace clones the workspace of the step, it returns the
+// pipeline config with the clone in place of the workspace volume. The
+// step running on the host is moved to the clone.
+func (e *Engine) cloneStepWorkspace(ctx context.Context, cfg *spec.PipelineConfig, step *spec.Step) (*spec.PipelineConfig, error) {
+	vol, rel, ok := workspaceVolume(cfg, step)
+	if !ok {
+		return nil, fmt.Errorf("no host volume holds the working directory %s of the step", step.WorkingDir)
+	}
+	src := filepath.Clean(vol.HostPath.Path)
+	// next to the workspace, on the same filesystem for the reflinks
+	dir := filepath.Join(filepath.Dir(src), "."+filepath.Base(src)+"-clones", step.ID)
+
+	e.mu.Lock()
+	prev := e.clones[step.ID]
+	delete(e.clones, step.ID)
+	e.mu.Unlock()
+	if prev != nil {
+		if err := prev.remove(); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	clone, err := cloneWorkspace(ctx, src, dir)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.clones == nil {
+		e.clones = make(map[string]*workspaceClone)
+	}
+	e.clones[step.ID] = clone
+	e.mu.Unlock()
+	logrus.WithField("step_id", step.ID).WithField("method", clone.method).
+		WithField("duration", time.Since(start).String()).Infoln("cloned the workspace of the step")
+
+	hostPath := *vol.HostPath
+	hostPath.Path = clone.path
+	hostPath.Remove = false
+	clonedCfg := *cfg
+	clonedCfg.Volumes = make([]*spec.Volume, len(cfg.Volumes))
+	for i, v := range cfg.Volumes {
+		if v == vol {
+			v = &spec.Volume{HostPath: &hostPath}
+		}
+		clonedCfg.Volumes[i] = v
+	}
+	step.CloneWorkingDir = filepath.Join(clone.path, rel)
+	if step.Image == "" {
+		step.WorkingDir = step.CloneWorkingDir
+	}
+	return &clonedCfg, nil
+}
+
+// ReleaseClone removes the workspace clone of a step once its reports are
+// collected if it is a full copy of the workspace, the copy-on-write clones
+// share the blocks of the workspace and are removed with the stage.
+func (e *Engine) ReleaseClone(stepID string) {
+	e.mu.Lock()
+	c, ok := e.clones[stepID]
+	if !ok || c.method != cloneRsync {
+		e.mu.Unlock()
+		return
+	}
+	delete(e.clones, stepID)
+	e.mu.Unlock()
+	if err := c.remove(); err != nil {
+		logrus.WithField("step_id", stepID).WithError(err).Warnln("failed to remove the workspace clone")
+	}
+}
+
+// removeClones removes the workspace clones of the steps.
+func (e *Engine) removeClones() {
+	e.mu.Lock()
+	clones := e.clones
+	e.clones = nil
+	e.mu.Unlock()
+	for id, c := range clones {
+		if err := c.remove(); err != nil {
+			logrus.WithField("step_id", id).WithError(err).Warnln("failed to remove the workspace clone")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneArgs(t *testing.T) {
+	args, err := cloneArgs("linux", cloneOverlay, "/tmp/harness", "/tmp/.harness-clones/step")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mount", "-t", "overlay", "overlay", "-o",
+		"lowerdir=/tmp/harness,upperdir=/tmp/.harness-clones/step/upper,workdir=/tmp/.harness-clones/step/work",
+		"/tmp/.harness-clones/step/workspace"}, args)
+
+	args, err = cloneArgs("linux", cloneReflink, "/tmp/harness", "/tmp/.harness-clones/step")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cp", "-a", "--reflink=always", "/tmp/harness", "/tmp/.harness-clones/step/workspace"}, args)
+
+	args, err = cloneArgs("darwin", cloneRsync, "/tmp/harness", "/tmp/.harness-clones/step")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rsync", "-a", "/tmp/harness/", "/tmp/.harness-clones/step/workspace/"}, args)
+
+	_, err = cloneArgs("darwin", cloneOverlay, "/tmp/harness", "/tmp/.harness-clones/step")
+	assert.Error(t, err)
+}
+
+func TestWorkspaceVolume(t *testing.T) {
+	workspace := &spec.Volume{HostPath: &spec.VolumeHostPath{Name: "harness", Path: "/tmp/harness"}}
+	cache := &spec.Volume{HostPath: &spec.VolumeHostPath{Name: "cache", Path: "/tmp/cache"}}
+	cfg := &spec.PipelineConfig{Volumes: []*spec.Volume{workspace, cache}}
+
+	vol, rel, ok := workspaceVolume(cfg, &spec.Step{
+		Image:      "golang",
+		WorkingDir: "/harness/src",
+		Volumes:    []*spec.VolumeMount{{Name: "harness", Path: "/harness"}, {Name: "cache", Path: "/cache"}},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, workspace, vol)
+	assert.Equal(t, "src", rel)
+
+	vol, rel, ok = workspaceVolume(cfg, &spec.Step{WorkingDir: "/tmp/cache"})
+	assert.True(t, ok)
+	assert.Equal(t, cache, vol)
+	assert.Equal(t, ".", rel)
+
+	_, _, ok = workspaceVolume(cfg, &spec.Step{WorkingDir: "/tmp/harness-other"})
+	assert.False(t, ok)
+}
+
+func TestCloneStepWorkspace(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "harness")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "src"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "src", "gen.go"), []byte("package src"), 0600))
+	cfg := &spec.PipelineConfig{Volumes: []*spec.Volume{{HostPath: &spec.VolumeHostPath{Name: "harness", Path: src, Remove: true}}}}
+	step := &spec.Step{ID: "shard1", WorkingDir: filepath.Join(src, "src"), WorkspaceClone: true}
+
+	e := &Engine{}
+	cloned, err := e.cloneStepWorkspace(context.Background(), cfg, step)
+	if err != nil {
+		t.Skipf("no clone method on this host: %s", err)
+	}
+	assert.Equal(t, step.CloneWorkingDir, step.WorkingDir)
+	assert.NotEqual(t, src, cloned.Volumes[0].HostPath.Path)
+	assert.False(t, cloned.Volumes[0].HostPath.Remove)
+	assert.Equal(t, src, cfg.Volumes[0].HostPath.Path)
+
+	// the changes in the clone are not visible in the workspace
+	assert.NoError(t, os.WriteFile(filepath.Join(step.WorkingDir, "gen.go"), []byte("package changed"), 0600))
+	data, err := os.ReadFile(filepath.Join(src, "src", "gen.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, "package src", string(data))
+
+	e.removeClones()
+	_, err = os.Stat(filepath.Dir(cloned.Volumes[0].HostPath.Path))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReleaseClone(t *testing.T) {
+	for _, method := range []string{cloneRsync, cloneReflink} {
+		dir := filepath.Join(t.TempDir(), ".harness-clones", "shard1")
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "workspace"), 0755))
+		e := &Engine{clones: map[string]*workspaceClone{"shard1": {dir: dir, path: filepath.Join(dir, "workspace"), method: method}}}
+
+		e.ReleaseClone("shard1")
+		_, err := os.Stat(dir)
+		// the full copies are removed once the step completes
+		assert.Equal(t, method == cloneRsync, os.IsNotExist(err), method)
+		assert.Equal(t, method != cloneRsync, e.clones["shard1"] != nil, method)
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package containerd runs the container steps with containerd, eg. on the
+// hosts which only run containerd like the k3s nodes or bottlerocket. The
+// containers are managed with nerdctl, the docker compatible CLI of
+// containerd, so the stage network, volumes and host paths work like with
+// docker.
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	osruntime "runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/sirupsen/logrus"
+)
+
+// Opts configures the containerd engine.
+type Opts struct {
+	// Binary is the nerdctl binary, looked up in PATH if not set.
+	Binary string
+	// Address of the containerd socket, the nerdctl default if not set,
+	// eg. /run/k3s/containerd/containerd.sock on k3s.
+	Address string
+	// Namespace of the containers, the nerdctl default if not set.
+	Namespace string
+}
+
+// Containerd runs the container steps of a stage with containerd.
+type Containerd struct {
+	binary string
+	opts   Opts
+
+	mu         sync.Mutex
+	containers []string          // the containers of the stage, in creation order
+	names      map[string]string // the container of the last attempt of a step, by step id
+	volumes    []string
+	networks   []string
+}
+
+// New returns the containerd engine, it fails if nerdctl is not installed.
+func New(opts Opts) (*Containerd, error) {
+	if osruntime.GOOS == "windows" {
+		return nil, errors.New("the containerd runtime is not supported on windows")
+	}
+	binary := opts.Binary
+	if binary == "" {
+		binary = "nerdctl"
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl is required by the containerd runtime: %w", err)
+	}
+	return &Containerd{binary: path, opts: opts, names: make(map[string]string)}, nil
+}
+
+// Setup creates the temporary volumes and the network of the stage.
+func (c *Containerd) Setup(ctx context.Context, cfg *spec.PipelineConfig) error {
+	if _, err := c.run(ctx, nil, "version"); err != nil {
+		return fmt.Errorf("cannot connect to containerd: %w", err)
+	}
+	for _, vol := range cfg.Volumes {
+		if vol == nil {
+			continue
+		}
+		if vol.NetworkShare != nil && vol.NetworkShare.Path == "" {
+			return fmt.Errorf("network share %s must be mounted on the host with the containerd runtime", vol.NetworkShare.Name)
+		}
+		if vol.EmptyDir == nil || vol.EmptyDir.Medium == mediumMemory {
+			continue
+		}
+		args := append([]string{"volume", "create"}, labelArgs(labels.Merge(cfg.Labels, vol.EmptyDir.Labels))...)
+		if _, err := c.run(ctx, nil, append(args, vol.EmptyDir.ID)...); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.volumes = append(c.volumes, vol.EmptyDir.ID)
+		c.mu.Unlock()
+	}
+	if cfg.Network.ID == "" {
+		return nil
+	}
+	args := append([]string{"network", "create"}, labelArgs(labels.Merge(cfg.Labels, cfg.Network.Labels))...)
+	for k, v := range cfg.Network.Options {
+		args = append(args, "--opt", k+"="+v)
+	}
+	if _, err := c.run(ctx, nil, append(args, cfg.Network.ID)...); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.networks = append(c.networks, cfg.Network.ID)
+	c.mu.Unlock()
+	return nil
+}
+
+// Run creates and starts the container of the step and streams its logs to
+// output until it exits. The container of a detached step is left running.
+func (c *Containerd) Run(ctx context.Context, cfg *spec.PipelineConfig, step *spec.Step, output io.Writer, isDrone bool) (*runtime.State, error) {
+	if auth := step.Auth; auth != nil && auth.Address != "" && auth.Username != "" {
+		if _, err := c.run(ctx, strings.NewReader(auth.Password),
+			"login", "--username", auth.Username, "--password-stdin", auth.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	envFile, err := writeEnvFile(step)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(envFile)
+
+	name := c.newContainer(step.ID)
+	if _, err = c.runEnv(ctx, nil, multilineEnvs(step), toCreateArgs(cfg, step, name, envFile)...); err != nil {
+		return nil, err
+	}
+	if _, err = c.run(ctx, nil, "start", name); err != nil {
+		return nil, err
+	}
+
+	if !isDrone && step.Detach {
+		go c.logs(context.Background(), name, output)
+		return &runtime.State{Exited: false}, nil
+	}
+	c.logs(ctx, name, output)
+	return c.wait(ctx, name)
+}
+
+// newContainer returns the name of the container of a new attempt of the
+// step, the step id suffixed with the attempt after the first one so that
+// a retried step does not collide with the container of its last attempt.
+func (c *Containerd) newContainer(stepID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := stepID
+	for i := 2; c.used(name); i++ {
+		name = stepID + "-" + strconv.Itoa(i)
+	}
+	c.containers = append(c.containers, name)
+	c.names[stepID] = name
+	return name
+}
+
+func (c *Containerd) used(name string) bool {
+	for _, n := range c.containers {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// container returns the container of the last attempt of the step.
+func (c *Containerd) container(stepID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[stepID]; ok {
+		return name
+	}
+	return stepID
+}
+
+// Exec runs the command in the running container of the step, with its
+// output written to output, and returns the exit code of the command.
+func (c *Containerd) Exec(ctx context.Context, stepID string, command []string, output io.Writer) (int, error) {
+	cmd := c.command(ctx, append([]string{"exec", c.container(stepID)}, command...)...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// ContainerIP returns the IP address of the container of the step, empty if
+// it has none, eg. on the host network.
+func (c *Containerd) ContainerIP(ctx context.Context, stepID string) (string, error) {
+	out, err := c.run(ctx, nil, "inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}", c.container(stepID))
+	if err != nil {
+		return "", err
+	}
+	if fields := strings.Fields(out); len(fields) > 0 {
+		return fields[0], nil
+	}
+	return "", nil
+}
+
+// Kill kills the container of the step.
+func (c *Containerd) Kill(ctx context.Context, stepID string) error {
+	_, err := c.run(ctx, nil, "kill", c.container(stepID))
+	return err
+}
+
+// Destroy removes the containers, volumes and network of the stage.
+func (c *Containerd) Destroy(ctx context.Context, _ *spec.PipelineConfig) error {
+	c.mu.Lock()
+	containers, volumes, networks := c.containers, c.volumes, c.networks
+	c.containers, c.volumes, c.networks = nil, nil, nil
+	c.names = make(map[string]string)
+	c.mu.Unlock()
+
+	var lastErr error
+	remove := func(args ...string) {
+		if _, err := c.run(ctx, nil, args...); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("resource", args[len(args)-1]).
+				Warnln("cannot remove the stage resource")
+			lastErr = err
+		}
+	}
+	if len(containers) > 0 {
+		remove(append([]string{"rm", "--force", "--volumes"}, containers...)...)
+	}
+	for _, name := range volumes {
+		remove("volume", "rm", "--force", name)
+	}
+	for _, name := range networks {
+		remove("network", "rm", name)
+	}
+	return lastErr
+}
+
+// logs streams the logs of the container to output until it exits.
+func (c *Containerd) logs(ctx context.Context, id string, output io.Writer) {
+	cmd := c.command(ctx, "logs", "--follow", id)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("container", id).Warnln("cannot stream the container logs")
+	}
+}
+
+// wait waits for the container to exit and returns its state.
+func (c *Containerd) wait(ctx context.Context, id string) (*runtime.State, error) {
+	out, err := c.run(ctx, nil, "wait", id)
+	if err != nil {
+		return nil, err
+	}
+	code, err := strconv.Atoi(out)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected exit code %q of container %s", out, id)
+	}
+	state := &runtime.State{Exited: true, ExitCode: code}
+	if out, err := c.run(ctx, nil, "inspect", "--format", "{{.State.OOMKilled}}", id); err == nil {
+		state.OOMKilled = out == "true"
+	}
+	return state, nil
+}
+
+// run runs nerdctl and returns its trimmed standard output.
+func (c *Containerd) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	return c.runEnv(ctx, stdin, nil, args...)
+}
+
+// runEnv runs nerdctl with the variables added to its environment.
+func (c *Containerd) runEnv(ctx context.Context, stdin io.Reader, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := c.command(ctx, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("nerdctl %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (c *Containerd) command(ctx context.Context, args ...string) *exec.Cmd {
+	var global []string
+	if c.opts.Address != "" {
+		global = append(global, "--address", c.opts.Address)
+	}
+	if c.opts.Namespace != "" {
+		global = append(global, "--namespace", c.opts.Namespace)
+	}
+	return exec.CommandContext(ctx, c.binary, append(global, args...)...) //nolint:gosec
+}
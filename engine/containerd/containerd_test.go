@@ -0,0 +1,167 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNerdctl writes a nerdctl script recording its arguments, a line per
+// call, and returns the engine running it.
+func fakeNerdctl(t *testing.T) (c *Containerd, calls func() []string) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$*" >> '` + record + `'
+case "$3" in
+wait) echo 2 ;;
+logs) echo hello ;;
+inspect) echo false ;;
+esac
+`
+	binary := filepath.Join(dir, "nerdctl")
+	if err := os.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Opts{Binary: binary, Namespace: "k8s.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() []string {
+		data, _ := os.ReadFile(record)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+func TestContainerd(t *testing.T) {
+	c, calls := fakeNerdctl(t)
+	cfg := &spec.PipelineConfig{
+		Network: spec.Network{ID: "stage-net"},
+		Volumes: []*spec.Volume{{EmptyDir: &spec.VolumeEmptyDir{ID: "stage-vol", Name: "tmp"}}},
+	}
+	assert.NoError(t, c.Setup(context.Background(), cfg))
+
+	var out bytes.Buffer
+	state, err := c.Run(context.Background(), cfg, &spec.Step{ID: "step1", Image: "alpine:3.18"}, &out, false)
+	assert.NoError(t, err)
+	assert.True(t, state.Exited)
+	assert.Equal(t, 2, state.ExitCode)
+	assert.False(t, state.OOMKilled)
+	assert.Equal(t, "hello\n", out.String())
+
+	// a retry of the step runs in another container
+	_, err = c.Run(context.Background(), cfg, &spec.Step{ID: "step1", Image: "alpine:3.18"}, &out, false)
+	assert.NoError(t, err)
+	_, err = c.Exec(context.Background(), "step1", []string{"true"}, &out)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Destroy(context.Background(), cfg))
+	got := calls()
+	assert.Equal(t, []string{
+		"--namespace k8s.io version",
+		"--namespace k8s.io volume create stage-vol",
+		"--namespace k8s.io network create stage-net",
+	}, got[:3])
+	assert.True(t, strings.HasPrefix(got[3], "--namespace k8s.io create --name step1 --pull missing"))
+	assert.True(t, strings.HasPrefix(got[8], "--namespace k8s.io create --name step1-2 --pull missing"))
+	assert.Equal(t, []string{
+		"--namespace k8s.io start step1",
+		"--namespace k8s.io logs --follow step1",
+		"--namespace k8s.io wait step1",
+		"--namespace k8s.io inspect --format {{.State.OOMKilled}} step1",
+	}, got[4:8])
+	assert.Equal(t, []string{
+		"--namespace k8s.io start step1-2",
+		"--namespace k8s.io logs --follow step1-2",
+		"--namespace k8s.io wait step1-2",
+		"--namespace k8s.io inspect --format {{.State.OOMKilled}} step1-2",
+		"--namespace k8s.io exec step1-2 true",
+		"--namespace k8s.io rm --force --volumes step1 step1-2",
+		"--namespace k8s.io volume rm --force stage-vol",
+		"--namespace k8s.io network rm stage-net",
+	}, got[9:])
+}
+
+func TestToCreateArgs(t *testing.T) {
+	cfg := &spec.PipelineConfig{
+		Network: spec.Network{ID: "stage-net"},
+		Volumes: []*spec.Volume{
+			{EmptyDir: &spec.VolumeEmptyDir{ID: "stage-vol", Name: "tmp"}},
+			{EmptyDir: &spec.VolumeEmptyDir{ID: "stage-mem", Name: "mem", Medium: "memory", SizeLimit: 1024}},
+			{HostPath: &spec.VolumeHostPath{Name: "cache", Path: "/var/cache", ReadOnly: true}},
+		},
+	}
+	step := &spec.Step{
+		ID:         "step1",
+		Image:      "alpine",
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"echo hi"},
+		WorkingDir: "/harness",
+		MemLimit:   1 << 20,
+		Pull:       spec.PullNever,
+		OCIRuntime: "runsc",
+		Platform:   &spec.Platform{OS: "linux", Arch: "arm", Variant: "v7"},
+		Volumes: []*spec.VolumeMount{
+			{Name: "tmp", Path: "/tmp"},
+			{Name: "mem", Path: "/mem"},
+			{Name: "cache", Path: "/cache"},
+		},
+	}
+	assert.Equal(t, []string{
+		"create", "--name", "step1", "--pull", "never",
+		"--platform", "linux/arm/v7",
+		"--label", "io.harness.lite-engine.step=step1",
+		"--env-file", "/tmp/env",
+		"--workdir", "/harness",
+		"--runtime", "runsc",
+		"--network", "stage-net",
+		"--memory", "1048576",
+		"--volume", "stage-vol:/tmp",
+		"--tmpfs", "/mem:mode=0700,size=1024",
+		"--volume", "/var/cache:/cache:ro",
+		"--entrypoint", "sh", "alpine", "-c", "echo hi",
+	}, toCreateArgs(cfg, step, "step1", "/tmp/env"))
+
+	// the multiline variables are read from the environment of nerdctl
+	step = &spec.Step{ID: "step1", Image: "alpine", Envs: map[string]string{"CERT": "line1\nline2"}}
+	args := toCreateArgs(&spec.PipelineConfig{}, step, "step1-2", "/tmp/env")
+	assert.Equal(t, []string{"create", "--name", "step1-2"}, args[:3])
+	assert.Contains(t, strings.Join(args, " "), "--env-file /tmp/env --env CERT alpine")
+	assert.NotContains(t, strings.Join(args, " "), "line1")
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	step := &spec.Step{
+		Envs:    map[string]string{"FOO": "bar", "CERT": "line1\nline2"},
+		Secrets: []*spec.Secret{{Env: "TOKEN", Data: []byte("s3cr3t")}},
+	}
+	path, err := writeEnvFile(step)
+	assert.NoError(t, err)
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "FOO=bar\nTOKEN=s3cr3t\n", string(data))
+	assert.Equal(t, []string{"CERT=line1\nline2"}, multilineEnvs(step))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestToSecurityArgs(t *testing.T) {
+	assert.Nil(t, toSecurityArgs(nil))
+	assert.Equal(t, []string{
+		"--cap-add", "NET_BIND_SERVICE", "--cap-drop", "ALL",
+		"--security-opt", "seccomp=/etc/seccomp/ci.json",
+		"--security-opt", "no-new-privileges",
+		"--read-only",
+	}, toSecurityArgs(&spec.SecurityContext{CapAdd: []string{"NET_BIND_SERVICE"}, CapDrop: []string{"ALL"},
+		Seccomp: "/etc/seccomp/ci.json", AppArmor: spec.ProfileRuntimeDefault, NoNewPrivileges: true, ReadOnlyRootfs: true}))
+}
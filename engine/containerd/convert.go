@@ -0,0 +1,290 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package containerd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/engine/docker/image"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+const mediumMemory = "memory"
+
+// toCreateArgs returns the arguments of nerdctl create for the container of
+// the step, the environment of the step is read from envFile and the
+// multiline variables from the environment of nerdctl.
+func toCreateArgs(cfg *spec.PipelineConfig, step *spec.Step, name, envFile string) []string { //nolint:gocyclo
+	args := []string{"create", "--name", name, "--pull", toPullPolicy(step)}
+	if p := step.Platform; p != nil {
+		platform := p.OS + "/" + p.Arch
+		if p.Variant != "" {
+			platform += "/" + p.Variant
+		}
+		args = append(args, "--platform", platform)
+	}
+	args = append(args, labelArgs(labels.Merge(cfg.Labels, step.Labels, map[string]string{labels.Step: step.ID}))...)
+	args = append(args, "--env-file", envFile)
+	for _, kv := range multilineEnvs(step) {
+		// the value is read from the environment of nerdctl, it is not in
+		// its arguments
+		k, _, _ := strings.Cut(kv, "=")
+		args = append(args, "--env", k)
+	}
+	if step.WorkingDir != "" {
+		args = append(args, "--workdir", step.WorkingDir)
+	}
+	if user := toUser(step); user != "" {
+		args = append(args, "--user", user)
+	}
+	for _, group := range toGroupAdd(step) {
+		args = append(args, "--group-add", group)
+	}
+	if step.Privileged {
+		args = append(args, "--privileged")
+	}
+	args = append(args, toSecurityArgs(step.SecurityContext)...)
+	if step.OCIRuntime != "" && step.OCIRuntime != spec.OCIRuntimeDefault {
+		args = append(args, "--runtime", step.OCIRuntime)
+	}
+	if cfg.TTY {
+		args = append(args, "--tty")
+	}
+	switch {
+	case step.Network != "":
+		args = append(args, "--network", step.Network)
+	case cfg.Network.ID != "":
+		args = append(args, "--network", cfg.Network.ID)
+	}
+	for _, dns := range step.DNS {
+		args = append(args, "--dns", dns)
+	}
+	for _, search := range step.DNSSearch {
+		args = append(args, "--dns-search", search)
+	}
+	for _, host := range step.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+	args = append(args, toResourceArgs(step)...)
+	args = append(args, toVolumeArgs(cfg, step)...)
+	for hostPort, ctrPort := range step.PortBindings {
+		args = append(args, "--publish", hostPort+":"+ctrPort)
+	}
+
+	// nerdctl takes the executable of the entrypoint, its arguments are
+	// passed before the command like docker does.
+	if len(step.Entrypoint) != 0 {
+		args = append(args, "--entrypoint", step.Entrypoint[0], step.Image)
+		args = append(args, step.Entrypoint[1:]...)
+	} else {
+		args = append(args, step.Image)
+	}
+	return append(args, step.Command...)
+}
+
+func toPullPolicy(step *spec.Step) string {
+	switch {
+	case step.Pull == spec.PullAlways, step.Pull == spec.PullDefault && image.IsLatest(step.Image):
+		return "always"
+	case step.Pull == spec.PullNever:
+		return "never"
+	default:
+		return "missing"
+	}
+}
+
+// returns the user of the step container, the uid and gid of the engine if
+// the step matches the host user.
+func toUser(step *spec.Step) string {
+	if !step.HostUser {
+		return step.User
+	}
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
+
+func toGroupAdd(step *spec.Step) []string {
+	if !step.HostUser {
+		return step.GroupAdd
+	}
+	groups := append([]string{}, step.GroupAdd...)
+	hostGroups, _ := os.Getgroups()
+	for _, gid := range hostGroups {
+		groups = append(groups, strconv.Itoa(gid))
+	}
+	return groups
+}
+
+func toResourceArgs(step *spec.Step) []string {
+	var args []string
+	if step.CPUPeriod != 0 {
+		args = append(args, "--cpu-period", strconv.FormatInt(step.CPUPeriod, 10))
+	}
+	if step.CPUQuota != 0 {
+		args = append(args, "--cpu-quota", strconv.FormatInt(step.CPUQuota, 10))
+	}
+	if step.CPUShares != 0 {
+		args = append(args, "--cpu-shares", strconv.FormatInt(step.CPUShares, 10))
+	}
+	if len(step.CPUSet) != 0 {
+		args = append(args, "--cpuset-cpus", strings.Join(step.CPUSet, ","))
+	}
+	if step.MemLimit != 0 {
+		args = append(args, "--memory", strconv.FormatInt(step.MemLimit, 10))
+	}
+	if step.MemSwapLimit != 0 {
+		args = append(args, "--memory-swap", strconv.FormatInt(step.MemSwapLimit, 10))
+	}
+	if step.ShmSize != 0 {
+		args = append(args, "--shm-size", strconv.FormatInt(step.ShmSize, 10))
+	}
+	return args
+}
+
+// toVolumeArgs returns the mounts of the volumes and devices of the step.
+// The network shares are mounted on the host at setup and bound from there.
+func toVolumeArgs(cfg *spec.PipelineConfig, step *spec.Step) []string {
+	var args []string
+	for _, mount := range step.Volumes {
+		vol, ok := lookupVolume(cfg, mount.Name)
+		if !ok {
+			continue
+		}
+		switch {
+		case vol.EmptyDir != nil && vol.EmptyDir.Medium == mediumMemory:
+			opts := "mode=0700"
+			if vol.EmptyDir.SizeLimit != 0 {
+				opts += ",size=" + strconv.FormatInt(vol.EmptyDir.SizeLimit, 10)
+			}
+			args = append(args, "--tmpfs", mount.Path+":"+opts)
+		case vol.EmptyDir != nil:
+			args = append(args, "--volume", vol.EmptyDir.ID+":"+mount.Path)
+		case vol.HostPath != nil && strings.HasPrefix(vol.HostPath.Path, "/dev/"):
+			continue
+		case vol.HostPath != nil:
+			bind := vol.HostPath.Path + ":" + mount.Path
+			if vol.HostPath.ReadOnly {
+				bind += ":ro"
+			}
+			args = append(args, "--volume", bind)
+		case vol.NetworkShare != nil:
+			bind := vol.NetworkShare.Path + ":" + mount.Path
+			if vol.NetworkShare.ReadOnly {
+				bind += ":ro"
+			}
+			args = append(args, "--volume", bind)
+		}
+	}
+	for _, device := range step.Devices {
+		vol, ok := lookupVolume(cfg, device.Name)
+		if !ok || vol.HostPath == nil {
+			continue
+		}
+		args = append(args, "--device", vol.HostPath.Path+":"+device.DevicePath+":rwm")
+	}
+	return args
+}
+
+func lookupVolume(cfg *spec.PipelineConfig, name string) (*spec.Volume, bool) {
+	for _, v := range cfg.Volumes {
+		if v.HostPath != nil && v.HostPath.Name == name ||
+			v.EmptyDir != nil && v.EmptyDir.Name == name ||
+			v.NetworkShare != nil && v.NetworkShare.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// labelArgs returns the label flags, sorted so the arguments are stable.
+func labelArgs(l map[string]string) []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+l[k])
+	}
+	return args
+}
+
+// writeEnvFile writes the single line environment variables and secrets of
+// the step to a private file, so the secrets are not in the arguments of
+// nerdctl.
+func writeEnvFile(step *spec.Step) (string, error) {
+	f, err := os.CreateTemp("", "lite-engine-env-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var sb strings.Builder
+	for _, kv := range spec.ToEnv(step.Envs) {
+		if !strings.Contains(kv, "\n") {
+			sb.WriteString(kv + "\n")
+		}
+	}
+	for _, sec := range step.Secrets {
+		if !strings.Contains(string(sec.Data), "\n") {
+			sb.WriteString(sec.Env + "=" + string(sec.Data) + "\n")
+		}
+	}
+	if _, err = f.WriteString(sb.String()); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// multilineEnvs returns the environment variables and secrets which cannot
+// be written to the env file, they are passed in the environment of
+// nerdctl.
+func multilineEnvs(step *spec.Step) []string {
+	var envs []string
+	for _, kv := range spec.ToEnv(step.Envs) {
+		if strings.Contains(kv, "\n") {
+			envs = append(envs, kv)
+		}
+	}
+	for _, sec := range step.Secrets {
+		if strings.Contains(string(sec.Data), "\n") {
+			envs = append(envs, sec.Env+"="+string(sec.Data))
+		}
+	}
+	return envs
+}
+
+// toSecurityArgs returns the arguments of the security context of the step,
+// nerdctl reads the seccomp profile from its path.
+func toSecurityArgs(sc *spec.SecurityContext) []string {
+	if sc == nil {
+		return nil
+	}
+	var args []string
+	for _, c := range sc.CapAdd {
+		args = append(args, "--cap-add", c)
+	}
+	for _, c := range sc.CapDrop {
+		args = append(args, "--cap-drop", c)
+	}
+	if sc.Seccomp != "" && sc.Seccomp != spec.ProfileRuntimeDefault {
+		args = append(args, "--security-opt", "seccomp="+sc.Seccomp)
+	}
+	if sc.AppArmor != "" && sc.AppArmor != spec.ProfileRuntimeDefault {
+		args = append(args, "--security-opt", "apparmor="+sc.AppArmor)
+	}
+	if sc.NoNewPrivileges {
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	if sc.ReadOnlyRootfs {
+		args = append(args, "--read-only")
+	}
+	return args
+}
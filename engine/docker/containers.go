@@ -0,0 +1,186 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ContainerState is the lifecycle state of a container created by the
+// engine.
+type ContainerState int
+
+// ContainerState enumeration.
+const (
+	ContainerCreated ContainerState = iota
+	ContainerRunning
+	ContainerStopped
+	ContainerPaused
+)
+
+func (s ContainerState) String() string {
+	switch s {
+	case ContainerRunning:
+		return "running"
+	case ContainerStopped:
+		return "stopped"
+	case ContainerPaused:
+		return "paused"
+	default:
+		return "created"
+	}
+}
+
+// containerStore tracks the containers created by the engine. It is safe
+// for concurrent use by the steps executing in parallel and the destroy
+// of the stage.
+type containerStore struct {
+	mu         sync.Mutex
+	ids        []string // in creation order, the containers are destroyed in the same order
+	containers map[string]*Container
+	paused     map[string]*pause
+}
+
+// pause releases the step waiting for a checkpointed container once the
+// stage resumes.
+type pause struct {
+	checkpoint string
+	done       chan struct{}
+	resumed    bool
+	resumedAt  time.Time
+}
+
+func newContainerStore() *containerStore {
+	return &containerStore{
+		containers: make(map[string]*Container),
+		paused:     make(map[string]*pause),
+	}
+}
+
+// add tracks the container, replacing a container with the same id.
+func (s *containerStore) add(c Container) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.containers[c.ID]; !ok {
+		s.ids = append(s.ids, c.ID)
+	}
+	s.containers[c.ID] = &c
+}
+
+// setState updates the state of the container. It returns false if the
+// container is not tracked, eg. it was already removed.
+func (s *containerStore) setState(id string, state ContainerState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.containers[id]
+	if !ok {
+		return false
+	}
+	c.State = state
+	return true
+}
+
+// pause marks the container paused, before it is frozen or checkpointed
+// so the step waiting for a checkpointed container does not complete when
+// the container exits.
+func (s *containerStore) pause(id, checkpoint string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.containers[id]
+	if !ok {
+		return false
+	}
+	c.State = ContainerPaused
+	c.Checkpoint = checkpoint
+	if p, ok := s.paused[id]; ok && !p.resumed {
+		p.checkpoint = checkpoint
+	} else {
+		s.paused[id] = &pause{checkpoint: checkpoint, done: make(chan struct{})}
+	}
+	return true
+}
+
+// resume marks the container running again and releases the step waiting
+// for it. The resume of a checkpointed container is kept until its step
+// consumes it, the step may only notice the container exited afterwards.
+func (s *containerStore) resume(id string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.containers[id]; ok {
+		c.State = ContainerRunning
+		c.Checkpoint = ""
+	}
+	p, ok := s.paused[id]
+	if !ok || p.resumed {
+		return
+	}
+	p.resumed, p.resumedAt = true, at
+	close(p.done)
+	if p.checkpoint == "" {
+		delete(s.paused, id)
+	}
+}
+
+// waitResume blocks while the container is checkpointed. It returns the
+// time the container resumed, or false if the container is not
+// checkpointed, was removed or ctx is done.
+func (s *containerStore) waitResume(ctx context.Context, id string) (time.Time, bool) {
+	s.mu.Lock()
+	p, ok := s.paused[id]
+	checkpointed := ok && p.checkpoint != ""
+	s.mu.Unlock()
+	if !checkpointed {
+		return time.Time{}, false
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return time.Time{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused[id] == p {
+		delete(s.paused, id)
+	}
+	_, ok = s.containers[id]
+	return p.resumedAt, ok
+}
+
+// remove stops tracking the container.
+func (s *containerStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.containers[id]; !ok {
+		return
+	}
+	delete(s.containers, id)
+	if p, ok := s.paused[id]; ok {
+		if !p.resumed {
+			p.resumed = true
+			close(p.done)
+		}
+		delete(s.paused, id)
+	}
+	for i := range s.ids {
+		if s.ids[i] == id {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// list returns a copy of the containers in creation order.
+func (s *containerStore) list() []Container {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Container, 0, len(s.ids))
+	for _, id := range s.ids {
+		out = append(out, *s.containers[id])
+	}
+	return out
+}
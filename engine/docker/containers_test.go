@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerStore(t *testing.T) {
+	s := newContainerStore()
+	s.add(Container{ID: "a"})
+	s.add(Container{ID: "b", SoftStop: true})
+	s.add(Container{ID: "c"})
+
+	assert.True(t, s.setState("b", ContainerRunning))
+	assert.False(t, s.setState("x", ContainerRunning))
+
+	s.remove("a")
+	s.remove("x")
+	assert.Equal(t, []Container{
+		{ID: "b", SoftStop: true, State: ContainerRunning},
+		{ID: "c"},
+	}, s.list())
+
+	// re-adding a container replaces it in place
+	s.add(Container{ID: "b"})
+	assert.Equal(t, []Container{{ID: "b"}, {ID: "c"}}, s.list())
+}
+
+func TestContainerStoreConcurrent(t *testing.T) {
+	s := newContainerStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("step-%d", i)
+			s.add(Container{ID: id})
+			s.setState(id, ContainerRunning)
+			_ = s.list()
+			s.setState(id, ContainerStopped)
+			if i%2 == 0 {
+				s.remove(id)
+			}
+		}(i)
+	}
+	// list for the destroy while the steps are running
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_ = s.list()
+		}
+	}()
+	wg.Wait()
+
+	containers := s.list()
+	assert.Len(t, containers, 25)
+	for _, c := range containers {
+		assert.Equal(t, ContainerStopped, c.State)
+	}
+}
+
+func TestContainerStateString(t *testing.T) {
+	assert.Equal(t, "created", ContainerCreated.String())
+	assert.Equal(t, "running", ContainerRunning.String())
+	assert.Equal(t, "stopped", ContainerStopped.String())
+	assert.Equal(t, "paused", ContainerPaused.String())
+}
+
+func TestContainerStorePauseResume(t *testing.T) {
+	s := newContainerStore()
+	s.add(Container{ID: "frozen", State: ContainerRunning})
+	s.add(Container{ID: "checkpointed", State: ContainerRunning})
+
+	assert.True(t, s.pause("frozen", ""))
+	assert.True(t, s.pause("checkpointed", "cp"))
+	assert.False(t, s.pause("missing", "cp"))
+
+	// frozen containers do not exit, their steps never wait for the resume
+	_, ok := s.waitResume(context.Background(), "frozen")
+	assert.False(t, ok)
+
+	at := time.Now()
+	done := make(chan time.Time)
+	go func() {
+		resumedAt, ok := s.waitResume(context.Background(), "checkpointed")
+		assert.True(t, ok)
+		done <- resumedAt
+	}()
+	s.resume("checkpointed", at)
+	assert.Equal(t, at, <-done)
+	assert.Equal(t, []Container{
+		{ID: "frozen", State: ContainerPaused},
+		{ID: "checkpointed", State: ContainerRunning},
+	}, s.list())
+
+	// the steps of removed containers are released
+	s.pause("checkpointed", "cp")
+	go func() {
+		_, ok := s.waitResume(context.Background(), "checkpointed")
+		done <- time.Time{}
+		assert.False(t, ok)
+	}()
+	s.remove("checkpointed")
+	<-done
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.pause("frozen", "cp")
+	_, ok = s.waitResume(ctx, "frozen")
+	assert.False(t, ok)
+}
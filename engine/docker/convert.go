@@ -9,8 +9,13 @@
 package docker
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/harness/lite-engine/engine/labels"
 	"github.com/harness/lite-engine/engine/spec"
 
 	"github.com/docker/docker/api/types/container"
@@ -19,13 +24,51 @@ import (
 	"github.com/docker/go-connections/nat"
 )
 
+const (
+	zoneinfoPath = "/usr/share/zoneinfo"
+	// the docker socket mounted in the linux containers, and the named
+	// pipe of the daemon it is mapped to in the windows containers.
+	dockerSocket = "/var/run/docker.sock"
+	dockerPipe   = `\\.\pipe\docker_engine`
+)
+
+// returns the security options of the step container. The docker api takes
+// the content of the seccomp profile, not its path.
+func toSecurityOpt(pipelineConfig *spec.PipelineConfig, step *spec.Step) ([]string, error) {
+	sc := step.SecurityContext
+	if sc == nil || pipelineConfig.Platform.OS == "windows" {
+		return nil, nil
+	}
+	var opts []string
+	switch sc.Seccomp {
+	case "", spec.ProfileRuntimeDefault:
+	case spec.ProfileUnconfined:
+		opts = append(opts, "seccomp=unconfined")
+	default:
+		profile, err := os.ReadFile(sc.Seccomp)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the seccomp profile: %w", err)
+		}
+		opts = append(opts, "seccomp="+string(profile))
+	}
+	switch sc.AppArmor {
+	case "", spec.ProfileRuntimeDefault:
+	default:
+		opts = append(opts, "apparmor="+sc.AppArmor)
+	}
+	if sc.NoNewPrivileges {
+		opts = append(opts, "no-new-privileges")
+	}
+	return opts, nil
+}
+
 // returns a container configuration.
 func toConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step, image string) *container.Config {
 	config := &container.Config{
 		Image:        image,
-		Labels:       step.Labels,
+		Labels:       labels.Merge(pipelineConfig.Labels, step.Labels, map[string]string{labels.Step: step.ID}),
 		WorkingDir:   step.WorkingDir,
-		User:         step.User,
+		User:         toUser(pipelineConfig, step),
 		AttachStdin:  false,
 		AttachStdout: true,
 		AttachStderr: true,
@@ -69,11 +112,21 @@ func toHostConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step) *contain
 		},
 		Privileged: step.Privileged,
 		ShmSize:    step.ShmSize,
+		GroupAdd:   toGroupAdd(pipelineConfig, step),
+		Runtime:    ociRuntime(step),
+	}
+	if userns := pipelineConfig.UserNamespace; userns != nil {
+		config.UsernsMode = container.UsernsMode(userns.Mode)
 	}
 	// windows does not support privileged so we hard-code
 	// this value to false.
 	if pipelineConfig.Platform.OS == "windows" {
 		config.Privileged = false
+		config.Isolation = toIsolation(step)
+	} else if sc := step.SecurityContext; sc != nil {
+		config.CapAdd = sc.CapAdd
+		config.CapDrop = sc.CapDrop
+		config.ReadonlyRootfs = sc.ReadOnlyRootfs
 	}
 	if len(step.Network) > 0 {
 		config.NetworkMode = container.NetworkMode(step.Network)
@@ -97,6 +150,9 @@ func toHostConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step) *contain
 			MemorySwap: step.MemSwapLimit,
 		}
 	}
+	if step.GPUs != nil {
+		config.DeviceRequests = toDeviceRequests(step.GPUs)
+	}
 
 	if len(step.Volumes) != 0 {
 		config.Devices = toDeviceSlice(pipelineConfig, step)
@@ -104,6 +160,10 @@ func toHostConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step) *contain
 		config.Mounts = toVolumeMounts(pipelineConfig, step)
 	}
 
+	if bind := toLocaltimeBind(pipelineConfig, step); bind != "" {
+		config.Binds = append(config.Binds, bind)
+	}
+
 	if len(step.PortBindings) != 0 {
 		portBinding := make(nat.PortMap)
 		for hostPort, ctrPort := range step.PortBindings {
@@ -123,6 +183,45 @@ func toHostConfig(pipelineConfig *spec.PipelineConfig, step *spec.Step) *contain
 	return config
 }
 
+// returns the user of the step container, the uid and gid of the engine
+// if the step matches the host user.
+func toUser(pipelineConfig *spec.PipelineConfig, step *spec.Step) string {
+	if !step.HostUser || pipelineConfig.Platform.OS == "windows" {
+		return step.User
+	}
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
+
+// returns the supplemental groups of the step container, including the
+// groups of the engine if the step matches the host user.
+func toGroupAdd(pipelineConfig *spec.PipelineConfig, step *spec.Step) []string {
+	if !step.HostUser || pipelineConfig.Platform.OS == "windows" {
+		return step.GroupAdd
+	}
+	hostGroups, err := os.Getgroups()
+	if err != nil {
+		return step.GroupAdd
+	}
+	groups := append([]string{}, step.GroupAdd...)
+	for _, gid := range hostGroups {
+		groups = append(groups, strconv.Itoa(gid))
+	}
+	return groups
+}
+
+// returns a read only bind of the host zoneinfo file of the step timezone
+// to /etc/localtime, if available on the host.
+func toLocaltimeBind(pipelineConfig *spec.PipelineConfig, step *spec.Step) string {
+	if step.Clock == nil || step.Clock.Timezone == "" || pipelineConfig.Platform.OS == "windows" {
+		return ""
+	}
+	source := filepath.Join(zoneinfoPath, filepath.FromSlash(step.Clock.Timezone))
+	if _, err := os.Stat(source); err != nil {
+		return ""
+	}
+	return source + ":/etc/localtime:ro"
+}
+
 // helper function returns the container network configuration.
 func toNetConfig(pipelineConfig *spec.PipelineConfig, proc *spec.Step) *network.NetworkingConfig {
 	// if the user overrides the default network we do not
@@ -140,6 +239,17 @@ func toNetConfig(pipelineConfig *spec.PipelineConfig, proc *spec.Step) *network.
 	}
 }
 
+// helper function that converts the GPUs of the step to the device request
+// of the gpu capability, as docker run --gpus.
+func toDeviceRequests(gpus *spec.GPUs) []container.DeviceRequest {
+	return []container.DeviceRequest{{
+		Driver:       gpus.Driver,
+		Count:        gpus.Count,
+		DeviceIDs:    gpus.DeviceIDs,
+		Capabilities: [][]string{append([]string{"gpu"}, gpus.Capabilities...)},
+	}}
+}
+
 // helper function that converts a slice of device paths to a slice of
 // container.DeviceMapping.
 func toDeviceSlice(pipelineConfig *spec.PipelineConfig, step *spec.Step) []container.DeviceMapping {
@@ -164,9 +274,26 @@ func toDeviceSlice(pipelineConfig *spec.PipelineConfig, step *spec.Step) []conta
 	return to
 }
 
+// helper function returns the isolation of the windows container of the
+// step, the default of the daemon if not set. HostProcess containers are
+// not supported by docker.
+func toIsolation(step *spec.Step) container.Isolation {
+	switch step.Isolation {
+	case spec.IsolationProcess:
+		return container.IsolationProcess
+	case spec.IsolationHyperV:
+		return container.IsolationHyperV
+	}
+	return ""
+}
+
 // helper function that converts a slice of volume paths to a set
 // of unique volume names.
 func toVolumeSet(pipelineConfig *spec.PipelineConfig, step *spec.Step) map[string]struct{} {
+	// the bind mounts of the windows containers are mounts
+	if pipelineConfig.Platform.OS == windowsOS {
+		return nil
+	}
 	set := map[string]struct{}{}
 	for _, mount := range step.Volumes {
 		volume, ok := lookupVolume(pipelineConfig, mount.Name)
@@ -205,10 +332,19 @@ func toVolumeSlice(pipelineConfig *spec.PipelineConfig, step *spec.Step) []strin
 			path := volume.EmptyDir.ID + ":" + mount.Path
 			to = append(to, path)
 		}
-		if isBindMount(volume) {
+		// the drive letters of the windows paths are ambiguous with the
+		// separator, the bind mounts are mounts.
+		if isBindMount(volume) && pipelineConfig.Platform.OS != windowsOS {
 			path := volume.HostPath.Path + ":" + mount.Path
 			to = append(to, path)
 		}
+		if isNetworkShare(volume) {
+			path := volume.NetworkShare.ID + ":" + mount.Path
+			if volume.NetworkShare.ReadOnly {
+				path += ":ro"
+			}
+			to = append(to, path)
+		}
 	}
 	return to
 }
@@ -223,7 +359,9 @@ func toVolumeMounts(pipelineConfig *spec.PipelineConfig, step *spec.Step) []moun
 			continue
 		}
 
-		if isBindMount(source) && !isDevice(source) {
+		if pipelineConfig.Platform.OS == windowsOS {
+			source, target = toWindowsVolume(source, target)
+		} else if isBindMount(source) && !isDevice(source) {
 			continue
 		}
 
@@ -231,7 +369,7 @@ func toVolumeMounts(pipelineConfig *spec.PipelineConfig, step *spec.Step) []moun
 		// toVolumeSlice has been fully replaced. at this
 		// time, I cannot figure out how to get mounts
 		// working with data volumes :(
-		if isDataVolume(source) {
+		if isDataVolume(source) || isNetworkShare(source) {
 			continue
 		}
 		mounts = append(mounts, toMount(source, target))
@@ -262,6 +400,30 @@ func toMount(source *spec.Volume, target *spec.VolumeMount) mount.Mount {
 	return to
 }
 
+// helper function returns the options of the local volume
+// driver mounting the network share.
+func toShareDriverOpts(share *spec.VolumeNetworkShare) (map[string]string, error) {
+	fsType, err := share.FSType()
+	if err != nil {
+		return nil, err
+	}
+	o := "addr=" + share.Server
+	if opts := share.MountOptions(); opts != "" {
+		o += "," + opts
+	}
+	device := share.Device()
+	if fsType == "nfs" {
+		// the server address of nfs is passed with the addr
+		// option, the device is only the export path.
+		device = ":/" + strings.TrimPrefix(share.Share, "/")
+	}
+	return map[string]string{
+		"type":   fsType,
+		"o":      o,
+		"device": device,
+	}, nil
+}
+
 // helper function returns the docker volume enumeration
 // for the given volume.
 func toVolumeType(from *spec.Volume) mount.Type {
@@ -287,9 +449,37 @@ func isUnlimited(res *spec.Step) bool {
 		res.MemSwapLimit == 0
 }
 
+// helper function returns the host volume and its mount in a windows
+// container with windows paths, the docker socket is the named pipe of the
+// daemon.
+func toWindowsVolume(source *spec.Volume, target *spec.VolumeMount) (*spec.Volume, *spec.VolumeMount) {
+	if source.HostPath == nil {
+		return source, target
+	}
+	hostPath := *source.HostPath
+	hostPath.Path = toWindowsPath(hostPath.Path)
+	mnt := *target
+	mnt.Path = toWindowsPath(target.Path)
+	return &spec.Volume{HostPath: &hostPath}, &mnt
+}
+
+// helper function converts the path to a windows path, with the C drive
+// if it has no drive. The docker socket is mapped to the named pipe.
+func toWindowsPath(s string) string {
+	switch {
+	case s == dockerSocket:
+		return dockerPipe
+	case strings.HasPrefix(s, `\\`):
+		return s
+	case len(s) >= 2 && s[1] == ':':
+		return strings.ReplaceAll(s, "/", `\`)
+	}
+	return `c:` + strings.ReplaceAll(s, "/", `\`)
+}
+
 // returns true if the volume is a bind mount.
 func isBindMount(volume *spec.Volume) bool {
-	return volume.HostPath != nil
+	return volume.HostPath != nil && !isNamedPipe(volume)
 }
 
 // returns true if the volume is in-memory.
@@ -302,6 +492,11 @@ func isDataVolume(volume *spec.Volume) bool {
 	return volume.EmptyDir != nil && volume.EmptyDir.Medium != "memory"
 }
 
+// returns true if the volume is a network share.
+func isNetworkShare(volume *spec.Volume) bool {
+	return volume.NetworkShare != nil
+}
+
 // returns true if the volume is a device
 func isDevice(volume *spec.Volume) bool {
 	return volume.HostPath != nil && strings.HasPrefix(volume.HostPath.Path, "/dev/")
@@ -322,6 +517,9 @@ func lookupVolume(pipelineConfig *spec.PipelineConfig, name string) (*spec.Volum
 		if v.EmptyDir != nil && v.EmptyDir.Name == name {
 			return v, true
 		}
+		if v.NetworkShare != nil && v.NetworkShare.Name == name {
+			return v, true
+		}
 	}
 	return nil, false
 }
@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHostConfigSecurityContext(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "seccomp.json")
+	assert.NoError(t, os.WriteFile(profile, []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0o600))
+	step := &spec.Step{SecurityContext: &spec.SecurityContext{CapAdd: []string{"NET_ADMIN"}, CapDrop: []string{"ALL"},
+		Seccomp: profile, AppArmor: "ci-builds", NoNewPrivileges: true, ReadOnlyRootfs: true}}
+	cfg := &spec.PipelineConfig{}
+
+	hc := toHostConfig(cfg, step)
+	assert.Equal(t, strslice.StrSlice{"NET_ADMIN"}, hc.CapAdd)
+	assert.Equal(t, strslice.StrSlice{"ALL"}, hc.CapDrop)
+	assert.True(t, hc.ReadonlyRootfs)
+	opts, err := toSecurityOpt(cfg, step)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "apparmor=ci-builds", "no-new-privileges"}, opts)
+
+	step.SecurityContext = &spec.SecurityContext{Seccomp: spec.ProfileUnconfined, AppArmor: spec.ProfileRuntimeDefault}
+	opts, err = toSecurityOpt(cfg, step)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"seccomp=unconfined"}, opts)
+
+	step.SecurityContext.Seccomp = filepath.Join(t.TempDir(), "missing.json")
+	_, err = toSecurityOpt(cfg, step)
+	assert.Error(t, err)
+
+	// windows does not support the security options
+	opts, err = toSecurityOpt(&spec.PipelineConfig{Platform: spec.Platform{OS: "windows"}}, step)
+	assert.NoError(t, err)
+	assert.Nil(t, opts)
+}
+
+func TestToHostConfigGPUs(t *testing.T) {
+	step := &spec.Step{GPUs: &spec.GPUs{Count: spec.GPUCountAll, Capabilities: []string{"compute", "utility"}}, MemLimit: 1 << 30}
+
+	hc := toHostConfig(&spec.PipelineConfig{}, step)
+	assert.Equal(t, int64(1<<30), hc.Memory)
+	assert.Equal(t, []container.DeviceRequest{{Count: -1, Capabilities: [][]string{{"gpu", "compute", "utility"}}}}, hc.DeviceRequests)
+
+	step.GPUs = &spec.GPUs{DeviceIDs: []string{"GPU-3a1b"}, Driver: "nvidia"}
+	hc = toHostConfig(&spec.PipelineConfig{}, step)
+	assert.Equal(t, []container.DeviceRequest{{Driver: "nvidia", DeviceIDs: []string{"GPU-3a1b"}, Capabilities: [][]string{{"gpu"}}}}, hc.DeviceRequests)
+}
+
+func TestToHostConfigWindows(t *testing.T) {
+	cfg := &spec.PipelineConfig{Platform: spec.Platform{OS: "windows"}, Volumes: []*spec.Volume{
+		{HostPath: &spec.VolumeHostPath{Name: "harness", Path: `c:\harness`}},
+		{HostPath: &spec.VolumeHostPath{Name: "_docker", Path: "/var/run/docker.sock"}},
+		{HostPath: &spec.VolumeHostPath{Name: "cache", Path: "/cache", ReadOnly: true}},
+		{EmptyDir: &spec.VolumeEmptyDir{Name: "scratch", ID: "scratch-id"}},
+	}}
+	step := &spec.Step{Isolation: spec.IsolationProcess, Privileged: true, Volumes: []*spec.VolumeMount{
+		{Name: "harness", Path: "/harness"}, {Name: "_docker", Path: "/var/run/docker.sock"},
+		{Name: "cache", Path: `d:/cache`}, {Name: "scratch", Path: `c:\scratch`}}}
+
+	hc := toHostConfig(cfg, step)
+	assert.False(t, hc.Privileged)
+	assert.Equal(t, container.IsolationProcess, hc.Isolation)
+	assert.Equal(t, []string{`scratch-id:c:\scratch`}, hc.Binds)
+	assert.Equal(t, []mount.Mount{
+		{Type: mount.TypeBind, Source: `c:\harness`, Target: `c:\harness`},
+		{Type: mount.TypeNamedPipe, Source: `\\.\pipe\docker_engine`, Target: `\\.\pipe\docker_engine`},
+		{Type: mount.TypeBind, Source: `c:\cache`, Target: `d:\cache`, ReadOnly: true},
+	}, hc.Mounts)
+	assert.Nil(t, toConfig(cfg, step, "mcr.microsoft.com/windows/servercore").Volumes)
+
+	// the named pipes are mounted, not bound
+	cfg.Platform.OS = "linux"
+	cfg.Volumes[1].HostPath.Path = `\\.\pipe\docker_engine`
+	hc = toHostConfig(cfg, step)
+	assert.Empty(t, hc.Isolation)
+	assert.Equal(t, []string{"c:\\harness:/harness", "/cache:d:/cache", `scratch-id:c:\scratch`}, hc.Binds)
+	assert.Equal(t, []mount.Mount{{Type: mount.TypeNamedPipe, Source: `\\.\pipe\docker_engine`, Target: "/var/run/docker.sock"}}, hc.Mounts)
+}
@@ -14,14 +14,19 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/harness/lite-engine/engine/docker/image"
+	"github.com/harness/lite-engine/engine/labels"
 	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/clock"
 	"github.com/harness/lite-engine/internal/docker/errors"
 	"github.com/harness/lite-engine/internal/docker/jsonmessage"
 	"github.com/harness/lite-engine/internal/docker/stdcopy"
+	"github.com/harness/lite-engine/internal/fault"
+	"github.com/harness/lite-engine/internal/metrics"
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker/docker/api/types"
@@ -34,16 +39,17 @@ import (
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/pipeline/runtime"
 	"github.com/drone/runner-go/registry/auths"
+	"github.com/harness/lite-engine/internal/retry"
 	"github.com/harness/lite-engine/logstream"
 )
 
 const (
 	imageMaxRetries                  = 3
-	imageRetrySleepDuration          = 50
+	imageRetrySleepDuration          = 50 * time.Millisecond
 	startContainerRetries            = 10
-	startContainerRetrySleepDuration = 5
+	startContainerRetrySleepDuration = 5 * time.Second
 	networkMaxRetries                = 3
-	networkRetrySleepDuration        = 50
+	networkRetrySleepDuration        = 50 * time.Millisecond
 	harnessHTTPSProxy                = "HARNESS_HTTPS_PROXY"
 	harnessNoProxy                   = "HARNESS_NO_PROXY"
 	dockerServiceDir                 = "/etc/systemd/system/docker.service.d"
@@ -53,42 +59,75 @@ const (
 	windowsOS                        = "windows"
 	removing                         = "removing"
 	running                          = "running"
+	pauseCheckpointID                = "lite-engine-pause"
 )
 
+var imagePullDuration = metrics.NewHistogram("lite_engine_image_pull_duration_seconds",
+	"The duration of the image pulls of the steps, by status.", metrics.DurationBuckets, "status")
+
 // Opts configures the Docker engine.
 type Opts struct {
 	HidePull bool
+	// Socket is the path of the docker daemon socket, eg. the socket of a
+	// rootless daemon, from DOCKER_HOST or the default socket if not set.
+	Socket string
 }
 
 // Docker implements a Docker pipeline engine.
 type Docker struct {
 	client   client.APIClient
 	hidePull bool
-	mu       sync.Mutex
 	// We should refactor this out to upper layers and make this stateless.
 	// The Docker engine should just be a simple wrapper around docker which does
 	// not keep track of the containers it creates.
-	containers []Container
+	containers *containerStore
+
+	usageMu sync.Mutex
+	usage   map[string]*usageMeter // the usage of the containers of the steps
+
+	runtimesMu sync.Mutex
+	runtimes   map[string]bool // the oci runtimes registered with the daemon, once probed
+
+	phasesMu sync.Mutex
+	phases   map[string]*StepPhases // the phases of the containers of the steps, until read
+
+	stepsMu sync.Mutex
+	steps   map[string]*stepContainer // the containers of the steps, to re-attach to them after a restart
+
+	warmMu sync.Mutex
+	warm   map[string]*warmContainer // the warm containers of the stage by name
+
+	clock clock.Clock // measures the retries and waits, the wall clock unless in tests
 }
 
 type Container struct {
-	ID       string
-	SoftStop bool
+	ID         string         `json:"id"`
+	SoftStop   bool           `json:"soft_stop,omitempty"`
+	State      ContainerState `json:"state"`
+	Checkpoint string         `json:"checkpoint,omitempty"` // checkpoint of a paused container, if it was checkpointed
 }
 
 // New returns a new engine.
 func New(client client.APIClient, opts Opts) *Docker {
+	if fault.Enabled(fault.Docker) {
+		client = &faultClient{APIClient: client}
+	}
 	return &Docker{
 		client:     client,
 		hidePull:   opts.HidePull,
-		mu:         sync.Mutex{},
-		containers: make([]Container, 0),
+		containers: newContainerStore(),
+		usage:      make(map[string]*usageMeter),
+		clock:      clock.Real,
 	}
 }
 
 // NewEnv returns a new Engine from the environment.
 func NewEnv(opts Opts) (*Docker, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	clientOpts := []client.Opt{client.FromEnv}
+	if opts.Socket != "" {
+		clientOpts = append(clientOpts, client.WithHost("unix://"+opts.Socket))
+	}
+	cli, err := client.NewClientWithOpts(clientOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,23 +140,90 @@ func (e *Docker) Ping(ctx context.Context) error {
 	return err
 }
 
+// Version returns the version of the Docker daemon.
+func (e *Docker) Version(ctx context.Context) (string, error) {
+	v, err := e.client.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
+
+// ImageDigest returns the repository digest of the local image, eg.
+// golang@sha256:abc..., or an empty string if the image was not pulled
+// from a registry.
+func (e *Docker) ImageDigest(ctx context.Context, image string) (string, error) {
+	info, _, err := e.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if len(info.RepoDigests) == 0 {
+		return "", nil
+	}
+	return info.RepoDigests[0], nil
+}
+
+// ImageID returns the id of the local image.
+func (e *Docker) ImageID(ctx context.Context, image string) (string, error) {
+	info, _, err := e.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+// SaveImages writes the tar archive of the local images to w.
+func (e *Docker) SaveImages(ctx context.Context, images []string, w io.Writer) error {
+	rc, err := e.client.ImageSave(ctx, images)
+	if err != nil {
+		return errors.TrimExtraInfo(err)
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// LoadImages loads the images of the tar archive r.
+func (e *Docker) LoadImages(ctx context.Context, r io.Reader) error {
+	resp, err := e.client.ImageLoad(ctx, r, true)
+	if err != nil {
+		return errors.TrimExtraInfo(err)
+	}
+	defer resp.Body.Close()
+	if !resp.JSON {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return jsonmessage.Copy(resp.Body, io.Discard)
+}
+
 // Setup the pipeline environment.
 func (e *Docker) Setup(ctx context.Context, pipelineConfig *spec.PipelineConfig) error {
 	// creates the default temporary (local) volumes
 	// that are mounted into each container step.
 
+	if err := e.checkOCIRuntimes(ctx, pipelineConfig.OCIRuntimes); err != nil {
+		return err
+	}
+
 	if _, ok := pipelineConfig.Envs[harnessHTTPSProxy]; ok {
 		e.setProxyInDockerDaemon(ctx, pipelineConfig)
 	}
 
 	for _, vol := range pipelineConfig.Volumes {
+		if vol.NetworkShare != nil {
+			if err := e.createShareVolume(ctx, vol.NetworkShare, pipelineConfig.Labels); err != nil {
+				return err
+			}
+			continue
+		}
 		if vol.EmptyDir == nil {
 			continue
 		}
 		_, err := e.client.VolumeCreate(ctx, volume.VolumeCreateBody{
 			Name:   vol.EmptyDir.ID,
 			Driver: "local",
-			Labels: vol.EmptyDir.Labels,
+			Labels: labels.Merge(pipelineConfig.Labels, vol.EmptyDir.Labels),
 		})
 		if err != nil {
 			return errors.TrimExtraInfo(err)
@@ -158,14 +264,80 @@ func (e *Docker) Setup(ctx context.Context, pipelineConfig *spec.PipelineConfig)
 	return errors.TrimExtraInfo(err)
 }
 
+// Resource is a container, volume or network created by the engine.
+type Resource struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+	State  string // containers only
+}
+
+// Resources are the docker resources created by the engine.
+type Resources struct {
+	Containers []Resource
+	Volumes    []Resource
+	Networks   []Resource
+}
+
+// ListResources returns the containers, volumes and networks created by
+// the engine which have all the labels of the selectors. A selector is a
+// label key, or a key=value pair.
+func (e *Docker) ListResources(ctx context.Context, selectors []string) (*Resources, error) {
+	args := filters.NewArgs(filters.Arg("label", labels.Version))
+	for _, s := range selectors {
+		if _, _, err := labels.ParseSelector(s); err != nil {
+			return nil, err
+		}
+		args.Add("label", s)
+	}
+
+	res := new(Resources)
+	ctrs, err := e.client.ContainerList(ctx, types.ContainerListOptions{Filters: args, All: true})
+	if err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	for i := range ctrs {
+		var name string
+		if len(ctrs[i].Names) > 0 {
+			name = strings.TrimPrefix(ctrs[i].Names[0], "/")
+		}
+		res.Containers = append(res.Containers, Resource{
+			ID:     ctrs[i].ID,
+			Name:   name,
+			Labels: ctrs[i].Labels,
+			State:  ctrs[i].State,
+		})
+	}
+	vols, err := e.client.VolumeList(ctx, args)
+	if err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	for _, v := range vols.Volumes {
+		res.Volumes = append(res.Volumes, Resource{ID: v.Name, Name: v.Name, Labels: v.Labels})
+	}
+	nets, err := e.client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+	if err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	for i := range nets {
+		res.Networks = append(res.Networks, Resource{ID: nets[i].ID, Name: nets[i].Name, Labels: nets[i].Labels})
+	}
+	return res, nil
+}
+
 // DestroyContainersByLabel destroys a pipeline config and cleans up all containers with
 // a if specified. This should be used in favor of the old Destroy() which is stateful.
+// If no label is specified, the containers with the stage label of the pipeline config
+// are destroyed, or all the containers if it has none.
 func (e *Docker) DestroyContainersByLabel(
 	ctx context.Context,
 	pipelineConfig *spec.PipelineConfig,
 	labelKey string,
 	labelValue string,
 ) error {
+	if stage, ok := pipelineConfig.Labels[labels.Stage]; ok && labelKey == "" {
+		labelKey, labelValue = labels.Stage, stage
+	}
 	args := filters.NewArgs()
 	if labelKey != "" {
 		args.Add("label", fmt.Sprintf("%s=%s", labelKey, labelValue))
@@ -199,8 +371,12 @@ func (e *Docker) destroyContainers(
 		RemoveVolumes: true,
 	}
 
-	// stop all containers
+	// stop all containers, the ones which already exited
+	// only need to be removed.
 	for _, ctr := range containers {
+		if ctr.State == ContainerStopped {
+			continue
+		}
 		if ctr.SoftStop {
 			e.softStop(ctx, ctr.ID)
 		} else {
@@ -219,6 +395,14 @@ func (e *Docker) destroyContainers(
 
 	// cleanup all volumes
 	for _, vol := range pipelineConfig.Volumes {
+		// removing the volume of a network share only
+		// removes the docker volume, not the share data.
+		if vol.NetworkShare != nil {
+			if err := e.client.VolumeRemove(ctx, vol.NetworkShare.ID, true); err != nil {
+				logrus.WithContext(ctx).WithField("volume", vol.NetworkShare.ID).WithField("error", err).Warnln("failed to remove volume")
+			}
+			continue
+		}
 		if vol.EmptyDir == nil {
 			continue
 		}
@@ -244,13 +428,128 @@ func (e *Docker) destroyContainers(
 	return nil
 }
 
+// createShareVolume creates a local driver volume mounting the network
+// share in the containers.
+func (e *Docker) createShareVolume(ctx context.Context, share *spec.VolumeNetworkShare, stageLabels map[string]string) error {
+	opts, err := toShareDriverOpts(share)
+	if err != nil {
+		return err
+	}
+	_, err = e.client.VolumeCreate(ctx, volume.VolumeCreateBody{
+		Name:       share.ID,
+		Driver:     "local",
+		DriverOpts: opts,
+		Labels:     labels.Merge(stageLabels, share.Labels),
+	})
+	if err != nil {
+		return errors.TrimExtraInfo(err)
+	}
+	return nil
+}
+
+// Pause freezes the running containers, eg. before the VM hibernates. If
+// checkpoint is set, the containers are checkpointed with CRIU instead and
+// exit, the ones the daemon cannot checkpoint are frozen. It returns the
+// paused containers.
+func (e *Docker) Pause(ctx context.Context, checkpoint bool) ([]Container, error) {
+	var paused []Container
+	for _, ctr := range e.containers.list() {
+		if ctr.State != ContainerRunning {
+			continue
+		}
+		if checkpoint {
+			// mark the container first, so its step does not
+			// complete when the checkpointed container exits.
+			e.containers.pause(ctr.ID, pauseCheckpointID)
+			err := e.client.CheckpointCreate(ctx, ctr.ID, types.CheckpointCreateOptions{
+				CheckpointID: pauseCheckpointID,
+				Exit:         true,
+			})
+			if err == nil {
+				ctr.State, ctr.Checkpoint = ContainerPaused, pauseCheckpointID
+				paused = append(paused, ctr)
+				continue
+			}
+			logrus.WithContext(ctx).WithField("container", ctr.ID).WithError(err).
+				Warnln("cannot checkpoint the container, freezing it instead")
+		}
+		e.containers.pause(ctr.ID, "")
+		if err := e.client.ContainerPause(ctx, ctr.ID); err != nil {
+			e.containers.resume(ctr.ID, time.Now())
+			return paused, errors.TrimExtraInfo(err)
+		}
+		ctr.State = ContainerPaused
+		paused = append(paused, ctr)
+	}
+	return paused, nil
+}
+
+// Resume unfreezes the paused containers, or restores them from their
+// checkpoint. It returns the resumed containers.
+func (e *Docker) Resume(ctx context.Context) ([]Container, error) {
+	var resumed []Container
+	for _, ctr := range e.containers.list() {
+		if ctr.State != ContainerPaused {
+			continue
+		}
+		at := time.Now()
+		var err error
+		if ctr.Checkpoint != "" {
+			err = e.client.ContainerStart(ctx, ctr.ID, types.ContainerStartOptions{CheckpointID: ctr.Checkpoint})
+		} else {
+			err = e.client.ContainerUnpause(ctx, ctr.ID)
+		}
+		if err != nil {
+			return resumed, errors.TrimExtraInfo(err)
+		}
+		e.containers.resume(ctr.ID, at)
+		if ctr.Checkpoint != "" {
+			err = e.client.CheckpointDelete(ctx, ctr.ID, types.CheckpointDeleteOptions{CheckpointID: ctr.Checkpoint})
+			if err != nil {
+				logrus.WithContext(ctx).WithField("container", ctr.ID).WithError(err).
+					Warnln("failed to delete the checkpoint of the resumed container")
+			}
+		}
+		ctr.State, ctr.Checkpoint = ContainerRunning, ""
+		resumed = append(resumed, ctr)
+	}
+	return resumed, nil
+}
+
+// Containers returns the containers created by the engine.
+func (e *Docker) Containers() []Container {
+	return e.containers.list()
+}
+
+// RestoreContainers tracks the containers of a paused stage snapshot, eg.
+// after the engine restarted, so they can be resumed and destroyed.
+func (e *Docker) RestoreContainers(containers []Container) {
+	for _, ctr := range containers {
+		e.containers.add(ctr)
+		if ctr.State == ContainerPaused {
+			e.containers.pause(ctr.ID, ctr.Checkpoint)
+		}
+	}
+}
+
 // Destroy the pipeline environment.
 func (e *Docker) Destroy(ctx context.Context, pipelineConfig *spec.PipelineConfig) error {
-	e.mu.Lock()
-	containers := e.containers
-	e.mu.Unlock()
-
-	return e.destroyContainers(ctx, pipelineConfig, containers)
+	e.stopUsage()
+	e.phasesMu.Lock()
+	e.phases = nil
+	e.phasesMu.Unlock()
+	e.stepsMu.Lock()
+	e.steps = nil
+	e.stepsMu.Unlock()
+	e.warmMu.Lock()
+	e.warm = nil
+	e.warmMu.Unlock()
+	containers := e.containers.list()
+	err := e.destroyContainers(ctx, pipelineConfig, containers)
+	for _, ctr := range containers {
+		e.containers.remove(ctr.ID)
+	}
+	return err
 }
 
 // Run runs the pipeline step.
@@ -277,6 +576,7 @@ func (e *Docker) Run(ctx context.Context, pipelineConfig *spec.PipelineConfig, s
 		}()
 		return &runtime.State{Exited: false}, nil
 	}
+	e.meterUsage(ctx, step.ID, pipelineConfig.Platform.OS == windowsOS)
 	return e.startContainer(ctx, step.ID, pipelineConfig.TTY, output)
 }
 
@@ -284,27 +584,43 @@ func (e *Docker) startContainer(ctx context.Context, stepID string, tty bool, ou
 	// start the container
 	startTime := time.Now()
 	logrus.WithContext(ctx).Infoln(fmt.Sprintf("Starting command on container for step %s", stepID))
-	var err error
-	for i := 0; i < startContainerRetries; i++ {
-		err = e.start(ctx, stepID)
-		if err != nil {
-			logrus.WithContext(ctx).WithError(err).Errorln(fmt.Sprintf("Error while starting container for the step %s, retry number %d", stepID, i+1))
-			time.Sleep(time.Second * startContainerRetrySleepDuration)
-		} else {
-			break
-		}
-	}
-
+	attempt := 0
+	err := retry.Do(ctx, "docker_start_container", e.retryPolicy(startContainerRetries, startContainerRetrySleepDuration),
+		func(ctx context.Context) error {
+			attempt++
+			err := e.start(ctx, stepID)
+			if err != nil {
+				logrus.WithContext(ctx).WithError(err).Errorln(fmt.Sprintf("Error while starting container for the step %s, retry number %d", stepID, attempt))
+			}
+			return err
+		})
 	if err != nil {
 		return nil, errors.TrimExtraInfo(err)
 	}
+	e.containers.setState(stepID, ContainerRunning)
+	output = e.countLogs(stepID, output)
 	// grab the logs from the container execution
-	err = e.logs(ctx, stepID, tty, output)
+	err = e.logs(ctx, stepID, tty, output, time.Time{})
 	if err != nil {
 		return nil, errors.TrimExtraInfo(err)
 	}
 	// wait for the response
 	state, err := e.waitRetry(ctx, stepID)
+	// a checkpointed container exits while the stage is paused,
+	// the step completes once the restored container exits.
+	for err == nil {
+		resumedAt, ok := e.containers.waitResume(ctx, stepID)
+		if !ok {
+			break
+		}
+		if err = e.logs(ctx, stepID, tty, output, resumedAt); err != nil {
+			return nil, errors.TrimExtraInfo(err)
+		}
+		state, err = e.waitRetry(ctx, stepID)
+	}
+	if err == nil && state.Exited {
+		e.containers.setState(stepID, ContainerStopped)
+	}
 	logrus.WithContext(ctx).Infoln(fmt.Sprintf("Completed command on container for step %s, took %.2f seconds", stepID, time.Since(startTime).Seconds()))
 	return state, err
 }
@@ -314,6 +630,10 @@ func (e *Docker) startContainer(ctx context.Context, stepID string, tty bool, ou
 //
 
 func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step, output io.Writer, isHosted bool) error { //nolint:gocyclo
+	if err := e.checkOCIRuntimes(ctx, []string{step.OCIRuntime}); err != nil {
+		return err
+	}
+
 	// create pull options with encoded authorization credentials.
 	pullopts := types.ImagePullOptions{}
 	if step.Auth != nil {
@@ -322,6 +642,9 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 			step.Auth.Password,
 		)
 	}
+	if step.Platform != nil {
+		pullopts.Platform = formatPlatform(step.Platform)
+	}
 
 	originalImage := step.Image
 	overriddenImage := originalImage
@@ -334,17 +657,47 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 	}
 
 	selectedImage := overriddenImage
+	pullImage := func(image string) error {
+		start := time.Now()
+		err := e.pullImageWithRetries(ctx, image, pullopts, output)
+		e.addPhase(step.ID, func(p *StepPhases) { p.Pull += time.Since(start) })
+		imagePullDuration.Observe(time.Since(start).Seconds(), metrics.Status(err))
+		return err
+	}
+	hostConfig := toHostConfig(pipelineConfig, step)
+	securityOpt, err := toSecurityOpt(pipelineConfig, step)
+	if err != nil {
+		return err
+	}
+	hostConfig.SecurityOpt = securityOpt
+	createContainer := func() (container.ContainerCreateCreatedBody, error) {
+		start := time.Now()
+		body, err := e.client.ContainerCreate(ctx,
+			toConfig(pipelineConfig, step, selectedImage),
+			hostConfig,
+			toNetConfig(pipelineConfig, step),
+			step.ID,
+		)
+		e.addPhase(step.ID, func(p *StepPhases) {
+			p.Create += time.Since(start)
+			p.ContainerID = body.ID
+		})
+		if err == nil {
+			e.trackStep(step.ID, body.ID)
+		}
+		return body, err
+	}
 
 	// automatically pull the latest version of the image if requested
 	// by the process configuration, or if the image is :latest
 	if step.Pull == spec.PullAlways ||
 		(step.Pull == spec.PullDefault && image.IsLatest(overriddenImage)) {
-		pullerr := e.pullImageWithRetries(ctx, overriddenImage, pullopts, output)
+		pullerr := pullImage(overriddenImage)
 		if pullerr != nil {
 			// if for some reason overridden image does not work then fallback
 			if overriddenImage != originalImage {
 				selectedImage = originalImage
-				pullerr = e.pullImageWithRetries(ctx, originalImage, pullopts, output)
+				pullerr = pullImage(originalImage)
 			}
 			if pullerr != nil {
 				return pullerr
@@ -352,12 +705,13 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 		}
 	}
 
-	containerCreateBody, err := e.client.ContainerCreate(ctx,
-		toConfig(pipelineConfig, step, selectedImage),
-		toHostConfig(pipelineConfig, step),
-		toNetConfig(pipelineConfig, step),
-		step.ID,
-	)
+	if step.Platform != nil {
+		if err := e.ensurePlatform(ctx, step, selectedImage, pullImage); err != nil {
+			return err
+		}
+	}
+
+	containerCreateBody, err := createContainer()
 	if err == nil {
 		logrus.WithContext(ctx).WithField("step", step.Name).WithField("body", containerCreateBody).Infoln("Created container for the step")
 	}
@@ -365,12 +719,12 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 	// automatically pull and try to re-create the image if the
 	// failure is caused because the image does not exist.
 	if client.IsErrNotFound(err) && step.Pull != spec.PullNever {
-		pullerr := e.pullImageWithRetries(ctx, overriddenImage, pullopts, output)
+		pullerr := pullImage(overriddenImage)
 		if pullerr != nil {
 			// if for some reason overridden image does not work then fallback
 			if overriddenImage != originalImage {
 				selectedImage = originalImage
-				pullerr = e.pullImageWithRetries(ctx, originalImage, pullopts, output)
+				pullerr = pullImage(originalImage)
 			}
 			if pullerr != nil {
 				return pullerr
@@ -379,12 +733,7 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 
 		// once the image is successfully pulled we attempt to
 		// re-create the container.
-		containerCreateBody, err = e.client.ContainerCreate(ctx,
-			toConfig(pipelineConfig, step, selectedImage),
-			toHostConfig(pipelineConfig, step),
-			toNetConfig(pipelineConfig, step),
-			step.ID,
-		)
+		containerCreateBody, err = createContainer()
 		if err == nil {
 			logrus.WithContext(ctx).WithField("step", step.Name).WithField("body", containerCreateBody).Infoln("Created container for the step")
 		}
@@ -406,12 +755,11 @@ func (e *Docker) create(ctx context.Context, pipelineConfig *spec.PipelineConfig
 		}
 	}
 
-	e.mu.Lock()
-	e.containers = append(e.containers, Container{
+	e.containers.add(Container{
 		ID:       step.ID,
 		SoftStop: step.SoftStop,
+		State:    ContainerCreated,
 	})
-	e.mu.Unlock()
 
 	return nil
 }
@@ -467,7 +815,7 @@ func (e *Docker) wait(ctx context.Context, id string) (*runtime.State, error) {
 
 // helper function which emulates the docker logs command and writes the log output to
 // the writer
-func (e *Docker) logs(ctx context.Context, id string, tty bool, output io.Writer) error {
+func (e *Docker) logs(ctx context.Context, id string, tty bool, output io.Writer, since time.Time) error {
 	opts := types.ContainerLogsOptions{
 		Follow:     true,
 		ShowStdout: true,
@@ -475,6 +823,9 @@ func (e *Docker) logs(ctx context.Context, id string, tty bool, output io.Writer
 		Details:    false,
 		Timestamps: false,
 	}
+	if !since.IsZero() {
+		opts.Since = since.Format(time.RFC3339Nano)
+	}
 
 	logs, err := e.client.ContainerLogs(ctx, id, opts)
 	if err != nil {
@@ -528,32 +879,37 @@ func (e *Docker) pullImage(ctx context.Context, image string, pullOpts types.Ima
 
 func (e *Docker) pullImageWithRetries(ctx context.Context, image string,
 	pullOpts types.ImagePullOptions, output io.Writer) error {
-	var err error
-	for i := 1; i <= imageMaxRetries; i++ {
-		err = e.pullImage(ctx, image, pullOpts, output)
-		if err == nil {
-			return nil
-		}
-		logrus.WithContext(ctx).WithError(err).
-			WithField("image", image).
-			Warnln("failed to pull image")
-
-		switch {
-		case errdefs.IsNotFound(err),
-			errdefs.IsUnauthorized(err),
-			errdefs.IsInvalidParameter(err),
-			errdefs.IsForbidden(err),
-			errdefs.IsCancelled(err),
-			errdefs.IsDeadline(err):
-			return err
-		default:
-			if i < imageMaxRetries {
+	return retry.Do(ctx, "docker_pull_image", e.retryPolicy(imageMaxRetries, imageRetrySleepDuration),
+		func(ctx context.Context) error {
+			err := e.pullImage(ctx, image, pullOpts, output)
+			if err == nil {
+				return nil
+			}
+			logrus.WithContext(ctx).WithError(err).
+				WithField("image", image).
+				Warnln("failed to pull image")
+
+			switch {
+			case errdefs.IsNotFound(err),
+				errdefs.IsUnauthorized(err),
+				errdefs.IsInvalidParameter(err),
+				errdefs.IsForbidden(err),
+				errdefs.IsCancelled(err),
+				errdefs.IsDeadline(err):
+				return retry.Permanent(err)
+			default:
 				logrus.WithContext(ctx).WithField("image", image).Infoln("retrying image pull")
 			}
-		}
-		time.Sleep(time.Millisecond * imageRetrySleepDuration)
-	}
-	return err
+			return err
+		})
+}
+
+// retryPolicy returns the policy making at most attempts attempts, waiting
+// interval between each of them.
+func (e *Docker) retryPolicy(attempts int, interval time.Duration) retry.Policy {
+	p := retry.Constant(attempts, interval)
+	p.Clock = e.clock
+	return p
 }
 
 func (e *Docker) createNetworkWithRetries(ctx context.Context,
@@ -565,20 +921,15 @@ func (e *Docker) createNetworkWithRetries(ctx context.Context,
 		driver = "nat"
 	}
 
-	var err error
-	for i := 1; i <= networkMaxRetries; i++ {
-		_, err = e.client.NetworkCreate(ctx, pipelineConfig.Network.ID, types.NetworkCreate{
-			Driver:  driver,
-			Options: pipelineConfig.Network.Options,
-			Labels:  pipelineConfig.Network.Labels,
+	return retry.Do(ctx, "docker_create_network", e.retryPolicy(networkMaxRetries, networkRetrySleepDuration),
+		func(ctx context.Context) error {
+			_, err := e.client.NetworkCreate(ctx, pipelineConfig.Network.ID, types.NetworkCreate{
+				Driver:  driver,
+				Options: pipelineConfig.Network.Options,
+				Labels:  labels.Merge(pipelineConfig.Labels, pipelineConfig.Network.Labels),
+			})
+			return err
 		})
-		if err == nil {
-			return nil
-		}
-
-		time.Sleep(time.Millisecond * networkMaxRetries)
-	}
-	return err
 }
 
 func (e *Docker) setProxyInDockerDaemon(ctx context.Context, pipelineConfig *spec.PipelineConfig) {
@@ -637,12 +988,12 @@ func (e *Docker) softStop(ctx context.Context, name string) {
 	}
 
 	// Before removing the container we want to be sure that it's in a healthy state to be removed.
-	now := time.Now()
+	now := e.clock.Now()
 	for {
-		if time.Since(now) > timeout {
+		if e.clock.Since(now) > timeout {
 			break
 		}
-		time.Sleep(1 * time.Second)
+		e.clock.Sleep(1 * time.Second)
 		containerStatus, err := e.client.ContainerInspect(ctx, name)
 		if err != nil {
 			logrus.WithContext(ctx).WithField("container", name).WithField("error", err).Warnln("failed to retrieve container stats")
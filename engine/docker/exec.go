@@ -0,0 +1,49 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Exec runs the command in the running container of the step, with its
+// output written to output, and returns the exit code of the command.
+func (e *Docker) Exec(ctx context.Context, stepID string, command []string, output io.Writer) (int, error) {
+	return e.exec(ctx, stepID, &types.ExecConfig{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, output)
+}
+
+// ContainerIP returns the IP address of the container of the step on the
+// network, or on its first network if it is not on it. It is empty if the
+// container has none, eg. on the host network.
+func (e *Docker) ContainerIP(ctx context.Context, stepID, network string) (string, error) {
+	info, err := e.client.ContainerInspect(ctx, stepID)
+	if err != nil {
+		return "", err
+	}
+	if info.NetworkSettings == nil {
+		return "", nil
+	}
+	if n, ok := info.NetworkSettings.Networks[network]; ok && n != nil && n.IPAddress != "" {
+		return n.IPAddress, nil
+	}
+	for _, n := range info.NetworkSettings.Networks {
+		if n != nil && n.IPAddress != "" {
+			return n.IPAddress, nil
+		}
+	}
+	return "", nil
+}
+
+// Kill kills the container of the step, eg. a service which is not ready.
+func (e *Docker) Kill(ctx context.Context, stepID string) error {
+	return e.client.ContainerKill(ctx, stepID, "9")
+}
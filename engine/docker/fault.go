@@ -0,0 +1,66 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/internal/fault"
+)
+
+// faultClient injects faults into the docker calls the engine retries or
+// falls back from.
+type faultClient struct {
+	client.APIClient
+}
+
+func (c *faultClient) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return nil, err
+	}
+	return c.APIClient.ImagePull(ctx, ref, options)
+}
+
+func (c *faultClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig, containerName string) (container.ContainerCreateCreatedBody, error) {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	return c.APIClient.ContainerCreate(ctx, config, hostConfig, networkingConfig, containerName)
+}
+
+func (c *faultClient) ContainerStart(ctx context.Context, id string, options types.ContainerStartOptions) error {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return err
+	}
+	return c.APIClient.ContainerStart(ctx, id, options)
+}
+
+func (c *faultClient) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return c.APIClient.ContainerInspect(ctx, id)
+}
+
+func (c *faultClient) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return types.NetworkCreateResponse{}, err
+	}
+	return c.APIClient.NetworkCreate(ctx, name, options)
+}
+
+func (c *faultClient) VolumeCreate(ctx context.Context, options volume.VolumeCreateBody) (types.Volume, error) {
+	if err := fault.Inject(ctx, fault.Docker); err != nil {
+		return types.Volume{}, err
+	}
+	return c.APIClient.VolumeCreate(ctx, options)
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import "time"
+
+// StepPhases is the time spent by the engine in the phases of a step, for
+// the timeline of the stage.
+type StepPhases struct {
+	ContainerID string
+	Pull        time.Duration // pulling the image, with the retries
+	Create      time.Duration // creating the container
+	Run         time.Duration // running the step in the engine, the pull and create included
+}
+
+// addPhase adds the time spent in a phase of the container of the step.
+func (e *Docker) addPhase(stepID string, add func(p *StepPhases)) {
+	e.phasesMu.Lock()
+	defer e.phasesMu.Unlock()
+	if e.phases == nil {
+		e.phases = make(map[string]*StepPhases)
+	}
+	p, ok := e.phases[stepID]
+	if !ok {
+		p = &StepPhases{}
+		e.phases[stepID] = p
+	}
+	add(p)
+}
+
+// Phases returns the phases of the container of the step, nil if the step
+// did not run in a docker container. It is only available once.
+func (e *Docker) Phases(stepID string) *StepPhases {
+	e.phasesMu.Lock()
+	defer e.phasesMu.Unlock()
+	p, ok := e.phases[stepID]
+	if !ok {
+		return nil
+	}
+	delete(e.phases, stepID)
+	return p
+}
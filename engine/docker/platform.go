@@ -0,0 +1,73 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+// the architectures reported by the images under another name.
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"aarch64": "arm64",
+	"armhf":   "arm",
+}
+
+// formatPlatform returns the os/arch[/variant] of the platform, as the
+// --platform of docker pull.
+func formatPlatform(p *spec.Platform) string {
+	s := p.OS + "/" + p.Arch
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+func normalizeArch(arch string) string {
+	if a, ok := archAliases[strings.ToLower(arch)]; ok {
+		return a
+	}
+	return strings.ToLower(arch)
+}
+
+// ensurePlatform makes the local image the one of the platform of the step,
+// pulled unless the local image matches it. The docker client does not pass
+// the platform to the creation of the container, which uses the local image.
+func (e *Docker) ensurePlatform(ctx context.Context, step *spec.Step, image string, pullImage func(string) error) error {
+	p := step.Platform
+	info, _, err := e.client.ImageInspectWithRaw(ctx, image)
+	switch {
+	case err == nil && info.Os == p.OS && normalizeArch(info.Architecture) == normalizeArch(p.Arch):
+		return nil
+	case err != nil && !client.IsErrNotFound(err):
+		return err
+	case step.Pull == spec.PullNever:
+		return fmt.Errorf("the local image %s is not available for the platform %s and the pull policy is Never", image, formatPlatform(p))
+	}
+
+	if err := pullImage(image); err != nil {
+		if strings.Contains(err.Error(), "no matching manifest") {
+			return fmt.Errorf("the image %s has no manifest for the platform %s: %w", image, formatPlatform(p), err)
+		}
+		return err
+	}
+	// the pull succeeds with the manifest of another platform if the image
+	// has a single one
+	info, _, err = e.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return err
+	}
+	if info.Os != p.OS || normalizeArch(info.Architecture) != normalizeArch(p.Arch) {
+		return fmt.Errorf("the image %s has no manifest for the platform %s, it is built for %s/%s",
+			image, formatPlatform(p), info.Os, info.Architecture)
+	}
+	return nil
+}
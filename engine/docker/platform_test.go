@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+type platformClient struct {
+	client.APIClient
+	local *types.ImageInspect // the local image, nil if it is not pulled
+}
+
+func (c *platformClient) ImageInspectWithRaw(context.Context, string) (types.ImageInspect, []byte, error) {
+	if c.local == nil {
+		return types.ImageInspect{}, nil, errdefs.NotFound(errors.New("no such image"))
+	}
+	return *c.local, nil, nil
+}
+
+func TestEnsurePlatform(t *testing.T) {
+	amd64 := &spec.Platform{OS: "linux", Arch: "amd64"}
+	c := &platformClient{local: &types.ImageInspect{Os: "linux", Architecture: "x86_64"}}
+	e := &Docker{client: c}
+	pulls := 0
+	pull := func(string) error {
+		pulls++
+		c.local = &types.ImageInspect{Os: "linux", Architecture: "amd64"}
+		return nil
+	}
+
+	// the local image matches the platform
+	assert.NoError(t, e.ensurePlatform(context.Background(), &spec.Step{Platform: amd64}, "golang", pull))
+	assert.Equal(t, 0, pulls)
+
+	// the local image of another platform is replaced
+	c.local = &types.ImageInspect{Os: "linux", Architecture: "arm64"}
+	assert.NoError(t, e.ensurePlatform(context.Background(), &spec.Step{Platform: amd64}, "golang", pull))
+	assert.Equal(t, 1, pulls)
+
+	c.local = nil
+	err := e.ensurePlatform(context.Background(), &spec.Step{Platform: amd64, Pull: spec.PullNever}, "golang", pull)
+	assert.EqualError(t, err, "the local image golang is not available for the platform linux/amd64 and the pull policy is Never")
+
+	// the image has a single manifest of another platform
+	err = e.ensurePlatform(context.Background(), &spec.Step{Platform: &spec.Platform{OS: "linux", Arch: "arm", Variant: "v7"}}, "golang", pull)
+	assert.EqualError(t, err, "the image golang has no manifest for the platform linux/arm/v7, it is built for linux/amd64")
+
+	err = e.ensurePlatform(context.Background(), &spec.Step{Platform: &spec.Platform{OS: "windows", Arch: "amd64"}}, "golang",
+		func(string) error {
+			return errors.New("no matching manifest for windows/amd64 in the manifest list entries")
+		})
+	assert.EqualError(t, err, "the image golang has no manifest for the platform windows/amd64: "+
+		"no matching manifest for windows/amd64 in the manifest list entries")
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/internal/docker/errors"
+)
+
+// stepContainer is the container of a step and the number of bytes of its
+// logs copied to the output of the step.
+type stepContainer struct {
+	id      string
+	written int64
+}
+
+func (e *Docker) trackStep(stepID, containerID string) {
+	e.stepsMu.Lock()
+	defer e.stepsMu.Unlock()
+	if e.steps == nil {
+		e.steps = make(map[string]*stepContainer)
+	}
+	e.steps[stepID] = &stepContainer{id: containerID}
+}
+
+// countLogs returns the output of the step counting the bytes of the logs
+// of its container.
+func (e *Docker) countLogs(stepID string, output io.Writer) io.Writer {
+	e.stepsMu.Lock()
+	defer e.stepsMu.Unlock()
+	c, ok := e.steps[stepID]
+	if !ok {
+		return output
+	}
+	return &countingWriter{w: output, n: &c.written}
+}
+
+// StepContainer returns the id of the container of the step and the number
+// of bytes of its logs copied so far, ok is false if the step has no
+// container.
+func (e *Docker) StepContainer(stepID string) (id string, logOffset int64, ok bool) {
+	e.stepsMu.Lock()
+	defer e.stepsMu.Unlock()
+	c, ok := e.steps[stepID]
+	if !ok {
+		return "", 0, false
+	}
+	return c.id, atomic.LoadInt64(&c.written), true
+}
+
+// Reattach follows the container of a step started by a previous engine
+// process, eg. before the engine restarted. The container is found by its
+// id, or by the step label if the id is not set. The logs of the container
+// after the first logOffset bytes are copied to output, and the state of
+// the container is returned once it exits.
+func (e *Docker) Reattach(ctx context.Context, stepID, containerID string, logOffset int64, output io.Writer) (*runtime.State, error) {
+	if containerID == "" {
+		args := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", labels.Step, stepID)))
+		ctrs, err := e.client.ContainerList(ctx, types.ContainerListOptions{Filters: args, All: true})
+		if err != nil {
+			return nil, errors.TrimExtraInfo(err)
+		}
+		if len(ctrs) == 0 {
+			return nil, fmt.Errorf("no container found for the step %s", stepID)
+		}
+		containerID = ctrs[0].ID
+	}
+	info, err := e.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	state := ContainerStopped
+	if info.State.Running {
+		state = ContainerRunning
+	}
+	e.containers.add(Container{ID: containerID, State: state})
+	e.trackStep(stepID, containerID)
+	e.stepsMu.Lock()
+	atomic.StoreInt64(&e.steps[stepID].written, logOffset)
+	e.stepsMu.Unlock()
+
+	tty := info.Config != nil && info.Config.Tty
+	output = &skipWriter{w: e.countLogs(stepID, output), skip: logOffset}
+	if err = e.logs(ctx, containerID, tty, output, time.Time{}); err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	exited, err := e.waitRetry(ctx, containerID)
+	if err == nil && exited.Exited {
+		e.containers.setState(containerID, ContainerStopped)
+	}
+	return exited, err
+}
+
+// countingWriter counts the bytes written to the writer.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// skipWriter discards the first bytes written to the writer.
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	if s.skip >= int64(total) {
+		s.skip -= int64(total)
+		return total, nil
+	}
+	p = p[s.skip:]
+	s.skip = 0
+	if _, err := s.w.Write(p); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,21 @@
+package docker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var n int64
+	w := &skipWriter{w: &countingWriter{w: &buf, n: &n}, skip: 5}
+	for _, s := range []string{"abc", "defg", "hij"} {
+		written, err := w.Write([]byte(s))
+		assert.NoError(t, err)
+		assert.Equal(t, len(s), written)
+	}
+	assert.Equal(t, "fghij", buf.String())
+	assert.Equal(t, int64(5), n)
+}
@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingClient struct {
+	client.APIClient
+	starts   int
+	networks int
+}
+
+func (c *failingClient) ContainerStart(context.Context, string, types.ContainerStartOptions) error {
+	c.starts++
+	return errors.New("cannot start")
+}
+
+func (c *failingClient) NetworkCreate(context.Context, string, types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	c.networks++
+	if c.networks < networkMaxRetries {
+		return types.NetworkCreateResponse{}, errors.New("cannot create")
+	}
+	return types.NetworkCreateResponse{}, nil
+}
+
+func TestStartContainerRetries(t *testing.T) {
+	c := &failingClient{}
+	clk := clock.NewFake(time.Unix(0, 0))
+	e := &Docker{client: c, containers: newContainerStore(), clock: clk}
+
+	done := make(chan error)
+	go func() {
+		_, err := e.startContainer(context.Background(), "step", false, nil)
+		done <- err
+	}()
+	for i := 1; i < startContainerRetries; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(startContainerRetrySleepDuration)
+	}
+	assert.EqualError(t, <-done, "cannot start")
+	assert.Equal(t, startContainerRetries, c.starts)
+	assert.Equal(t, time.Duration(startContainerRetries-1)*startContainerRetrySleepDuration, clk.Since(time.Unix(0, 0)))
+}
+
+func TestStartContainerCanceled(t *testing.T) {
+	c := &failingClient{}
+	clk := clock.NewFake(time.Unix(0, 0))
+	e := &Docker{client: c, containers: newContainerStore(), clock: clk}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := e.startContainer(ctx, "step", false, nil)
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	cancel()
+	assert.EqualError(t, <-done, "cannot start")
+	assert.Equal(t, 1, c.starts)
+}
+
+func TestCreateNetworkRetries(t *testing.T) {
+	c := &failingClient{}
+	clk := clock.NewFake(time.Unix(0, 0))
+	e := &Docker{client: c, clock: clk}
+
+	done := make(chan error)
+	go func() {
+		done <- e.createNetworkWithRetries(context.Background(), &spec.PipelineConfig{})
+	}()
+	for i := 1; i < networkMaxRetries; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(networkRetrySleepDuration)
+	}
+	assert.NoError(t, <-done)
+	assert.Equal(t, networkMaxRetries, c.networks)
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/docker/errors"
+)
+
+// ociRuntime returns the OCI runtime of the container of the step, empty
+// for the default runtime of the daemon.
+func ociRuntime(step *spec.Step) string {
+	if step.OCIRuntime == spec.OCIRuntimeDefault {
+		return ""
+	}
+	return step.OCIRuntime
+}
+
+// ociRuntimes returns the OCI runtimes registered with the daemon. They are
+// probed once.
+func (e *Docker) ociRuntimes(ctx context.Context) (map[string]bool, error) {
+	e.runtimesMu.Lock()
+	defer e.runtimesMu.Unlock()
+	if e.runtimes != nil {
+		return e.runtimes, nil
+	}
+	info, err := e.client.Info(ctx)
+	if err != nil {
+		return nil, errors.TrimExtraInfo(err)
+	}
+	e.runtimes = make(map[string]bool, len(info.Runtimes))
+	for name := range info.Runtimes {
+		e.runtimes[name] = true
+	}
+	return e.runtimes, nil
+}
+
+// checkOCIRuntimes returns an error if one of the OCI runtimes is not
+// registered with the daemon.
+func (e *Docker) checkOCIRuntimes(ctx context.Context, names []string) error {
+	var missing []string
+	for _, name := range names {
+		if name == "" || name == spec.OCIRuntimeDefault {
+			continue
+		}
+		available, err := e.ociRuntimes(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot probe the oci runtimes of the daemon: %w", err)
+		}
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	available, _ := e.ociRuntimes(ctx)
+	registered := make([]string, 0, len(available))
+	for name := range available {
+		registered = append(registered, name)
+	}
+	sort.Strings(registered)
+	return fmt.Errorf("the oci runtimes %s are not registered with the docker daemon, the registered runtimes are %s",
+		strings.Join(missing, ", "), strings.Join(registered, ", "))
+}
@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+type infoClient struct {
+	client.APIClient
+	calls int
+}
+
+func (c *infoClient) Info(context.Context) (types.Info, error) {
+	c.calls++
+	return types.Info{Runtimes: map[string]types.Runtime{"runc": {Path: "runc"}, "runsc": {Path: "/usr/local/bin/runsc"}}}, nil
+}
+
+func TestCheckOCIRuntimes(t *testing.T) {
+	c := &infoClient{}
+	e := &Docker{client: c}
+	ctx := context.Background()
+
+	assert.NoError(t, e.checkOCIRuntimes(ctx, []string{"", spec.OCIRuntimeDefault}))
+	assert.Equal(t, 0, c.calls)
+	assert.NoError(t, e.checkOCIRuntimes(ctx, []string{"runsc"}))
+	assert.EqualError(t, e.checkOCIRuntimes(ctx, []string{"runsc", "kata"}),
+		"the oci runtimes kata are not registered with the docker daemon, the registered runtimes are runc, runsc")
+	assert.Equal(t, 1, c.calls)
+}
+
+func TestToHostConfigRuntime(t *testing.T) {
+	cfg := &spec.PipelineConfig{}
+	assert.Equal(t, "runsc", toHostConfig(cfg, &spec.Step{OCIRuntime: "runsc"}).Runtime)
+	assert.Equal(t, "", toHostConfig(cfg, &spec.Step{OCIRuntime: spec.OCIRuntimeDefault}).Runtime)
+}
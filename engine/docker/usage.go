@@ -0,0 +1,182 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+)
+
+const bytesPerGB = 1e9
+
+// Usage is the resources consumed by the container of a step, for the cost
+// attribution of the steps and the diagnosis of the steps running out of
+// memory.
+type Usage struct {
+	CPUSeconds      float64 `json:"cpu_seconds"`
+	MemoryGBSeconds float64 `json:"memory_gb_seconds"`
+	NetworkEgressGB float64 `json:"network_egress_gb"`
+	PeakMemoryBytes uint64  `json:"peak_memory_bytes"`
+	IOReadBytes     uint64  `json:"io_read_bytes"`
+	IOWriteBytes    uint64  `json:"io_write_bytes"`
+}
+
+// usageMeter accumulates the docker stats of a container.
+type usageMeter struct {
+	windows bool
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	mu      sync.Mutex
+	usage   Usage
+	read    time.Time // of the last stats
+	memory  float64   // usage of the last stats, in GB
+	started bool
+}
+
+func newUsageMeter(windows bool, stop context.CancelFunc) *usageMeter {
+	return &usageMeter{windows: windows, stop: stop, done: make(chan struct{})}
+}
+
+// add accumulates the stats, the cpu and network counters are cumulative and
+// the memory is integrated over the time between the stats. The empty stats
+// of a container which is not running are skipped.
+func (m *usageMeter) add(s *types.StatsJSON) {
+	if s.Read.IsZero() {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cpu := float64(s.CPUStats.CPUUsage.TotalUsage)
+	if m.windows {
+		cpu *= 100 // in 100ns units
+	}
+	m.usage.CPUSeconds = cpu / float64(time.Second)
+
+	var tx uint64
+	for _, n := range s.Networks {
+		tx += n.TxBytes
+	}
+	m.usage.NetworkEgressGB = float64(tx) / bytesPerGB
+
+	m.usage.IOReadBytes, m.usage.IOWriteBytes = ioUsage(s, m.windows)
+
+	used := memoryUsage(&s.MemoryStats, m.windows)
+	if used > m.usage.PeakMemoryBytes {
+		m.usage.PeakMemoryBytes = used
+	}
+	memory := float64(used) / bytesPerGB
+	if m.started && s.Read.After(m.read) {
+		m.usage.MemoryGBSeconds += (m.memory + memory) / 2 * s.Read.Sub(m.read).Seconds()
+	}
+	m.started = true
+	m.read = s.Read
+	m.memory = memory
+}
+
+func (m *usageMeter) get() *Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.usage
+	return &u
+}
+
+// memoryUsage returns the memory used by the container without the page
+// cache, like docker stats.
+func memoryUsage(s *types.MemoryStats, windows bool) uint64 {
+	if windows {
+		return s.PrivateWorkingSet
+	}
+	cache := s.Stats["inactive_file"] // cgroup v2
+	if v, ok := s.Stats["total_inactive_file"]; ok {
+		cache = v // cgroup v1
+	}
+	if cache > s.Usage {
+		return 0
+	}
+	return s.Usage - cache
+}
+
+// ioUsage returns the bytes read and written by the container, the block io
+// counters are cumulative.
+func ioUsage(s *types.StatsJSON, windows bool) (read, write uint64) {
+	if windows {
+		return s.StorageStats.ReadSizeBytes, s.StorageStats.WriteSizeBytes
+	}
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) { // Read with cgroup v1, read with cgroup v2
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	return read, write
+}
+
+// meterUsage reads the stats of the container of the step until its usage is
+// read or the stage is destroyed.
+func (e *Docker) meterUsage(ctx context.Context, stepID string, windows bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	m := newUsageMeter(windows, cancel)
+	e.usageMu.Lock()
+	e.usage[stepID] = m
+	e.usageMu.Unlock()
+
+	go func() {
+		defer close(m.done)
+		stats, err := e.client.ContainerStats(ctx, stepID, true)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("step", stepID).Debugln("cannot read the container stats")
+			return
+		}
+		defer stats.Body.Close()
+		dec := json.NewDecoder(stats.Body)
+		for {
+			s := new(types.StatsJSON)
+			if err := dec.Decode(s); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					logrus.WithContext(ctx).WithError(err).WithField("step", stepID).Debugln("cannot decode the container stats")
+				}
+				return
+			}
+			m.add(s)
+		}
+	}()
+}
+
+// Usage returns the resources consumed by the container of the step once it
+// exited, nil if the usage of the step was not metered. It is only
+// available once.
+func (e *Docker) Usage(stepID string) *Usage {
+	e.usageMu.Lock()
+	m, ok := e.usage[stepID]
+	delete(e.usage, stepID)
+	e.usageMu.Unlock()
+	if !ok {
+		return nil
+	}
+	m.stop()
+	<-m.done
+	return m.get()
+}
+
+// stopUsage stops metering the containers whose usage was not read.
+func (e *Docker) stopUsage() {
+	e.usageMu.Lock()
+	defer e.usageMu.Unlock()
+	for id, m := range e.usage {
+		m.stop()
+		delete(e.usage, id)
+	}
+}
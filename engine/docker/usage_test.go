@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func stats(read time.Time, cpuNanos, memory, cache, tx uint64) *types.StatsJSON {
+	s := new(types.StatsJSON)
+	s.Read = read
+	s.CPUStats.CPUUsage.TotalUsage = cpuNanos
+	s.MemoryStats.Usage = memory
+	s.MemoryStats.Stats = map[string]uint64{"inactive_file": cache}
+	s.Networks = map[string]types.NetworkStats{"eth0": {TxBytes: tx / 2}, "eth1": {TxBytes: tx / 2}}
+	s.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Major: 8, Op: "read", Value: tx}, {Major: 8, Op: "write", Value: tx / 2}, {Major: 8, Op: "Total", Value: tx * 3 / 2}}
+	return s
+}
+
+func TestUsageMeter(t *testing.T) {
+	m := newUsageMeter(false, func() {})
+	start := time.Now()
+	m.add(stats(start, 1e9, 2e9, 1e9, 0))
+	m.add(stats(start.Add(2*time.Second), 3e9, 4e9, 1e9, 2e9))
+	m.add(new(types.StatsJSON)) // the container exited
+
+	u := m.get()
+	assert.Equal(t, 3.0, u.CPUSeconds)
+	assert.Equal(t, 4.0, u.MemoryGBSeconds) // (1GB + 3GB) / 2 * 2s
+	assert.Equal(t, 2.0, u.NetworkEgressGB)
+	assert.Equal(t, uint64(3e9), u.PeakMemoryBytes)
+	assert.Equal(t, uint64(2e9), u.IOReadBytes)
+	assert.Equal(t, uint64(1e9), u.IOWriteBytes)
+}
+
+func TestIOUsage(t *testing.T) {
+	s := new(types.StatsJSON)
+	s.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Major: 8, Op: "Read", Value: 10}, {Major: 9, Op: "Read", Value: 5}, {Major: 8, Op: "Write", Value: 7}}
+	s.StorageStats.ReadSizeBytes = 100
+	s.StorageStats.WriteSizeBytes = 50
+
+	read, write := ioUsage(s, false)
+	assert.Equal(t, uint64(15), read)
+	assert.Equal(t, uint64(7), write)
+	read, write = ioUsage(s, true)
+	assert.Equal(t, uint64(100), read)
+	assert.Equal(t, uint64(50), write)
+}
+
+func TestMemoryUsage(t *testing.T) {
+	s := &types.MemoryStats{Usage: 100, Stats: map[string]uint64{"total_inactive_file": 30, "inactive_file": 10}}
+	assert.Equal(t, uint64(70), memoryUsage(s, false))
+	assert.Equal(t, uint64(0), memoryUsage(&types.MemoryStats{Usage: 10, Stats: map[string]uint64{"inactive_file": 20}}, false))
+	assert.Equal(t, uint64(50), memoryUsage(&types.MemoryStats{Usage: 100, PrivateWorkingSet: 50}, true))
+}
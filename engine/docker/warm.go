@@ -0,0 +1,187 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/docker/stdcopy"
+	"github.com/sirupsen/logrus"
+)
+
+const warmContainerPrefix = "lite-engine-warm-"
+
+// the warm containers idle until the commands of the steps are run in them.
+var warmEntrypoint = []string{"tail", "-f", "/dev/null"}
+
+// warmContainer is a container shared by the steps of the stage, eg. to
+// reuse the gradle daemon or mvnd started by the previous steps.
+type warmContainer struct {
+	id     string
+	config string // the container configuration of the steps running in it
+}
+
+// RunWarm runs the command of the step in the warm container of the stage,
+// created from the first step using it with its image, volumes and
+// resources, and without its variables and secrets which are set per
+// command. The step runs in its own container if its container
+// configuration differs from the one of the warm container, eg. another
+// image, security context or volumes. The warm container is removed with
+// the stage, or when a step is canceled since its command cannot be
+// stopped otherwise.
+func (e *Docker) RunWarm(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step,
+	output io.Writer, isHosted bool) (*runtime.State, error) {
+	c, err := e.warmContainer(ctx, pipelineConfig, step, output, isHosted)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		logrus.WithContext(ctx).WithField("warm_container", step.WarmContainer).
+			Infoln(fmt.Sprintf("The container of step %s differs from the warm container, running it in its own container", step.ID))
+		return e.Run(ctx, pipelineConfig, step, output, false, isHosted)
+	}
+	env := spec.ToEnv(step.Envs)
+	for _, sec := range step.Secrets {
+		env = append(env, sec.Env+"="+string(sec.Data))
+	}
+	logrus.WithContext(ctx).WithField("container", c.id).
+		Infoln(fmt.Sprintf("Starting command in the warm container for step %s", step.ID))
+	code, err := e.exec(ctx, c.id, &types.ExecConfig{
+		Cmd:          append(append([]string{}, step.Entrypoint...), step.Command...),
+		Env:          env,
+		WorkingDir:   step.WorkingDir,
+		User:         toUser(pipelineConfig, step),
+		Tty:          pipelineConfig.TTY,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, output)
+	if ctx.Err() != nil {
+		e.removeWarmContainer(c)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.State{Exited: true, ExitCode: code}, nil
+}
+
+// warmContainer returns the running warm container of the step, created
+// if it is the first step using it, nil if the container configuration of
+// the step differs from the one of the warm container.
+func (e *Docker) warmContainer(ctx context.Context, pipelineConfig *spec.PipelineConfig, step *spec.Step,
+	output io.Writer, isHosted bool) (*warmContainer, error) {
+	config, err := warmConfig(step)
+	if err != nil {
+		return nil, err
+	}
+	e.warmMu.Lock()
+	defer e.warmMu.Unlock()
+	if c, ok := e.warm[step.WarmContainer]; ok {
+		if c.config != config {
+			return nil, nil
+		}
+		return c, nil
+	}
+
+	warm := *step
+	warm.ID = warmContainerPrefix + step.WarmContainer
+	warm.Name = warm.ID
+	warm.Entrypoint = warmEntrypoint
+	warm.Command = nil
+	warm.Envs = nil
+	warm.Secrets = nil
+	if err := e.create(ctx, pipelineConfig, &warm, output, isHosted); err != nil {
+		return nil, err
+	}
+	// the warm container is not the container of a step to re-attach to
+	e.stepsMu.Lock()
+	delete(e.steps, warm.ID)
+	e.stepsMu.Unlock()
+	if err := e.start(ctx, warm.ID); err != nil {
+		return nil, err
+	}
+	e.containers.setState(warm.ID, ContainerRunning)
+
+	c := &warmContainer{id: warm.ID, config: config}
+	if e.warm == nil {
+		e.warm = make(map[string]*warmContainer)
+	}
+	e.warm[step.WarmContainer] = c
+	logrus.WithContext(ctx).WithField("container", c.id).Infoln("Started the warm container")
+	return c, nil
+}
+
+// warmConfig returns the configuration of the container of the step, all
+// of its fields but the ones of its command which are set per exec.
+func warmConfig(step *spec.Step) (string, error) {
+	c := *step
+	c.ID, c.Name, c.Labels = "", "", nil
+	c.Entrypoint, c.Command, c.Envs, c.Secrets = nil, nil, nil, nil
+	c.WorkingDir, c.User = "", ""
+	c.Auth, c.Pull = nil, spec.PullDefault
+	c.IgnoreStdout, c.IgnoreStderr, c.SoftStop = false, false, false
+	b, err := json.Marshal(&c)
+	return string(b), err
+}
+
+// removeWarmContainer removes the warm container, the next step using it
+// creates it again.
+func (e *Docker) removeWarmContainer(c *warmContainer) {
+	e.warmMu.Lock()
+	for name, w := range e.warm {
+		if w == c {
+			delete(e.warm, name)
+		}
+	}
+	e.warmMu.Unlock()
+	err := e.client.ContainerRemove(context.Background(), c.id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+	if err != nil {
+		logrus.WithField("container", c.id).WithError(err).Warnln("failed to remove the warm container")
+	}
+	e.containers.remove(c.id)
+}
+
+// exec runs the command in the running container, with its output written
+// to output, and returns the exit code of the command.
+func (e *Docker) exec(ctx context.Context, id string, cfg *types.ExecConfig, output io.Writer) (int, error) {
+	exec, err := e.client.ContainerExecCreate(ctx, id, *cfg)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := e.client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: cfg.Tty})
+	if err != nil {
+		return 0, err
+	}
+	// the output is read until the command exits or the step is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Close()
+		case <-done:
+		}
+	}()
+	if cfg.Tty {
+		_, err = io.Copy(output, resp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(output, output, resp.Reader)
+	}
+	resp.Close()
+	if err != nil {
+		return 0, err
+	}
+	inspect, err := e.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+type warmClient struct {
+	client.APIClient
+	created []*container.Config
+	execs   []types.ExecConfig
+	removed []string
+}
+
+func (c *warmClient) ContainerCreate(_ context.Context, cfg *container.Config, _ *container.HostConfig,
+	_ *network.NetworkingConfig, name string) (container.ContainerCreateCreatedBody, error) {
+	c.created = append(c.created, cfg)
+	return container.ContainerCreateCreatedBody{ID: name}, nil
+}
+
+func (c *warmClient) ContainerStart(context.Context, string, types.ContainerStartOptions) error {
+	return nil
+}
+
+func (c *warmClient) ContainerExecCreate(_ context.Context, _ string, cfg types.ExecConfig) (types.IDResponse, error) {
+	c.execs = append(c.execs, cfg)
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+func (c *warmClient) ContainerExecAttach(context.Context, string, types.ExecStartCheck) (types.HijackedResponse, error) {
+	conn, _ := net.Pipe()
+	out := strings.Join(c.execs[len(c.execs)-1].Cmd, " ")
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(strings.NewReader(out))}, nil
+}
+
+func (c *warmClient) ContainerExecInspect(context.Context, string) (types.ContainerExecInspect, error) {
+	return types.ContainerExecInspect{ExitCode: len(c.execs) - 1}, nil
+}
+
+func (c *warmClient) ContainerRemove(_ context.Context, id string, _ types.ContainerRemoveOptions) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func TestRunWarm(t *testing.T) {
+	c := &warmClient{}
+	e := &Docker{client: c, containers: newContainerStore()}
+	cfg := &spec.PipelineConfig{TTY: true}
+	step := func(id, image, cmd string) *spec.Step {
+		return &spec.Step{ID: id, Image: image, WarmContainer: "gradle", Entrypoint: []string{"sh", "-c"},
+			Command: []string{cmd}, Envs: map[string]string{"STEP": id}}
+	}
+
+	var out bytes.Buffer
+	state, err := e.RunWarm(context.Background(), cfg, step("test1", "gradle:8", "gradle test"), &out, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, state.ExitCode)
+	state, err = e.RunWarm(context.Background(), cfg, step("test2", "gradle:8", "gradle check"), &out, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.ExitCode)
+	assert.Equal(t, "sh -c gradle testsh -c gradle check", out.String())
+
+	// the container is created once, the commands of the steps run in it
+	assert.Len(t, c.created, 1)
+	assert.Equal(t, warmEntrypoint, []string(c.created[0].Entrypoint))
+	assert.Equal(t, []string{"STEP=test2"}, c.execs[1].Env)
+	assert.Equal(t, []Container{{ID: "lite-engine-warm-gradle", State: ContainerRunning}}, e.Containers())
+
+	// the variables of the first step are not set in the container
+	assert.Empty(t, c.created[0].Env)
+
+	// a canceled step removes the container
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = e.RunWarm(ctx, cfg, step("test4", "gradle:8", "gradle test"), &out, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"lite-engine-warm-gradle"}, c.removed)
+	assert.Empty(t, e.Containers())
+}
+
+func TestWarmContainerConfig(t *testing.T) {
+	e := &Docker{client: &warmClient{}, containers: newContainerStore()}
+	cfg := &spec.PipelineConfig{}
+	step := func(update func(s *spec.Step)) *spec.Step {
+		s := &spec.Step{ID: "test", Image: "gradle:8", WarmContainer: "gradle", Command: []string{"gradle test"},
+			Volumes: []*spec.VolumeMount{{Name: "_workspace", Path: "/harness"}}}
+		update(s)
+		return s
+	}
+	var out bytes.Buffer
+	c, err := e.warmContainer(context.Background(), cfg, step(func(*spec.Step) {}), &out, false)
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+
+	// the command, the variables, the secrets and the user are set per exec
+	same, err := e.warmContainer(context.Background(), cfg, step(func(s *spec.Step) {
+		s.ID, s.Command, s.User = "check", []string{"gradle check"}, "1000"
+		s.Envs = map[string]string{"TOKEN": "token"}
+		s.Secrets = []*spec.Secret{{Env: "PASSWORD", Data: []byte("password")}}
+	}), &out, false)
+	assert.NoError(t, err)
+	assert.Same(t, c, same)
+
+	for _, update := range []func(s *spec.Step){
+		func(s *spec.Step) { s.Image = "maven:3" },
+		func(s *spec.Step) { s.Privileged = true },
+		func(s *spec.Step) { s.SecurityContext = &spec.SecurityContext{CapAdd: []string{"SYS_ADMIN"}} },
+		func(s *spec.Step) {
+			s.Volumes = append(s.Volumes, &spec.VolumeMount{Name: "docker", Path: "/var/run/docker.sock"})
+		},
+		func(s *spec.Step) { s.MemLimit = 1 << 30 },
+	} {
+		other, err := e.warmContainer(context.Background(), cfg, step(update), &out, false)
+		assert.NoError(t, err)
+		assert.Nil(t, other)
+	}
+}
@@ -13,11 +13,16 @@ import (
 	osruntime "runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/containerd"
 	"github.com/harness/lite-engine/engine/docker"
 	"github.com/harness/lite-engine/engine/exec"
+	"github.com/harness/lite-engine/engine/kubernetes"
+	"github.com/harness/lite-engine/engine/podman"
 	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -26,14 +31,42 @@ const (
 	DockerSockVolName  = "_docker"
 	DockerSockUnixPath = "/var/run/docker.sock"
 	DockerSockWinPath  = `\\.\pipe\docker_engine`
-	permissions        = 0777
+	permissions        = 0777 // the mode of the host volumes, before the umask of the engine
+	remappedPerms      = 0770 // the host volumes of the containers with the users remapped
 	boldYellowColor    = "\u001b[33;1m"
 )
 
 type Engine struct {
 	pipelineConfig *spec.PipelineConfig
 	docker         *docker.Docker
+	socketPath     string // the host path of the container engine socket, the docker socket if not set
 	mu             sync.Mutex
+
+	// the pods of the container steps, if the stage runs on kubernetes.
+	kubeOpts   kubernetes.Opts
+	kubernetes *kubernetes.Kubernetes
+
+	// the containers of the container steps, if the stage runs on containerd.
+	containerdOpts containerd.Opts
+	containerd     *containerd.Containerd
+
+	// the workspace clones of the steps by step id, removed with the stage.
+	clones map[string]*workspaceClone
+
+	// the isolated homes of the steps by step id, removed once the step
+	// completes or with the stage.
+	homes map[string]string
+
+	// the usage of the processes of the steps on the host by step id, until
+	// it is read.
+	hostUsage map[string]*exec.Usage
+
+	// the time spent running the steps in the engine by step id, until it
+	// is read.
+	runTime map[string]time.Duration
+
+	// the directory the engine state of the paused stages is written to.
+	stateDir string
 }
 
 func NewEnv(opts docker.Opts) (*Engine, error) {
@@ -44,82 +77,385 @@ func NewEnv(opts docker.Opts) (*Engine, error) {
 	return &Engine{
 		pipelineConfig: &spec.PipelineConfig{},
 		docker:         d,
+		socketPath:     opts.Socket,
 	}, nil
 }
 
-func setupHelper(pipelineConfig *spec.PipelineConfig) error {
+// NewPodmanEnv returns an engine running the container steps with Podman,
+// through the docker compatible API of the podman service.
+func NewPodmanEnv(opts podman.Opts) (*Engine, error) {
+	d, err := podman.NewEnv(opts)
+	if err != nil {
+		return nil, err
+	}
+	socketPath := opts.Socket
+	if socketPath == "" {
+		socketPath = podman.SocketPath()
+	}
+	return &Engine{
+		pipelineConfig: &spec.PipelineConfig{},
+		docker:         d,
+		socketPath:     socketPath,
+	}, nil
+}
+
+// SocketPath returns the host path of the socket of the container engine,
+// which is mounted in the steps as the docker socket.
+func (e *Engine) SocketPath() string {
+	if e.socketPath != "" {
+		return e.socketPath
+	}
+	if osruntime.GOOS == "windows" {
+		return DockerSockWinPath
+	}
+	return DockerSockUnixPath
+}
+
+// ConfigureKubernetes sets the options of the pods of the stages running
+// their container steps on kubernetes.
+func (e *Engine) ConfigureKubernetes(opts kubernetes.Opts) {
+	e.mu.Lock()
+	e.kubeOpts = opts
+	e.mu.Unlock()
+}
+
+// ConfigureContainerd sets the options of the stages running their
+// container steps with containerd.
+func (e *Engine) ConfigureContainerd(opts containerd.Opts) {
+	e.mu.Lock()
+	e.containerdOpts = opts
+	e.mu.Unlock()
+}
+
+func setupHelper(ctx context.Context, pipelineConfig *spec.PipelineConfig) error {
 	// create global files and folders
-	if err := createFiles(pipelineConfig.Files); err != nil {
+	if err := createFiles(pipelineConfig.Files, fileperm.Umask()); err != nil {
 		return errors.Wrap(err,
 			fmt.Sprintf("failed to create files/folders for pipeline %v", pipelineConfig.Files))
 	}
+	perms := fileperm.Mode(permissions)
+	userns := pipelineConfig.UserNamespace
+	if userns != nil {
+		perms = fileperm.Mode(remappedPerms)
+	}
 	// create volumes
 	for _, vol := range pipelineConfig.Volumes {
+		if vol != nil && vol.NetworkShare != nil && vol.NetworkShare.Path != "" {
+			if err := mountShare(ctx, vol.NetworkShare); err != nil {
+				return errors.Wrap(err,
+					fmt.Sprintf("failed to mount network share at host path: %q", vol.NetworkShare.Path))
+			}
+			continue
+		}
 		if vol == nil || vol.HostPath == nil {
 			continue
 		}
 		path := vol.HostPath.Path
 		vol.HostPath.Path = pathConverter(path)
 
-		if _, err := os.Stat(path); err == nil {
-			_ = os.Chmod(path, permissions)
-			continue
+		if _, err := os.Stat(path); err != nil {
+			if err := os.MkdirAll(path, perms); err != nil {
+				return errors.Wrap(err,
+					fmt.Sprintf("failed to create directory for host volume path: %q", path))
+			}
 		}
+		_ = os.Chmod(path, perms)
 
-		if err := os.MkdirAll(path, permissions); err != nil {
-			return errors.Wrap(err,
-				fmt.Sprintf("failed to create directory for host volume path: %q", path))
+		seed := vol.HostPath.Seed
+		if seed != nil {
+			if err := seedVolume(ctx, path, seed); err != nil {
+				return errors.Wrap(err,
+					fmt.Sprintf("failed to seed host volume path: %q", path))
+			}
+		}
+		if userns != nil {
+			if err := chownVolume(path, userns, seed != nil); err != nil {
+				return errors.Wrap(err,
+					fmt.Sprintf("failed to change the owner of host volume path: %q", path))
+			}
 		}
-		_ = os.Chmod(path, permissions)
 	}
 	return nil
 }
 
 func (e *Engine) Setup(ctx context.Context, pipelineConfig *spec.PipelineConfig) error {
-	if err := setupHelper(pipelineConfig); err != nil {
+	if err := setupHelper(ctx, pipelineConfig); err != nil {
 		return err
 	}
+	var k *kubernetes.Kubernetes
+	var c *containerd.Containerd
+	switch {
+	case pipelineConfig.Backend == spec.BackendKubernetes:
+		e.mu.Lock()
+		opts := e.kubeOpts
+		e.mu.Unlock()
+		var err error
+		if k, err = kubernetes.NewInCluster(opts); err != nil {
+			return err
+		}
+		if err = k.Setup(ctx, pipelineConfig); err != nil {
+			return err
+		}
+	case pipelineConfig.Runtime == spec.RuntimeContainerd:
+		e.mu.Lock()
+		opts := e.containerdOpts
+		e.mu.Unlock()
+		var err error
+		if c, err = containerd.New(opts); err != nil {
+			return err
+		}
+		if err = c.Setup(ctx, pipelineConfig); err != nil {
+			return err
+		}
+	}
 	e.mu.Lock()
 	e.pipelineConfig = pipelineConfig
+	e.kubernetes = k
+	e.containerd = c
 	e.mu.Unlock()
+	if _, filtered := hostEnvs(pipelineConfig.EnvPassthrough); len(filtered) > 0 {
+		logrus.WithField("envs", filtered).
+			Infoln("engine environment variables will not be passed to steps running on the host")
+	}
 	// required to support m1 where docker isn't installed.
-	if e.pipelineConfig.EnableDockerSetup == nil || *e.pipelineConfig.EnableDockerSetup {
+	if k == nil && c == nil && (pipelineConfig.EnableDockerSetup == nil || *pipelineConfig.EnableDockerSetup) {
 		return e.docker.Setup(ctx, pipelineConfig)
 	}
 	return nil
 }
 
+// DockerVersion returns the version of the Docker daemon used by the engine.
+func (e *Engine) DockerVersion(ctx context.Context) (string, error) {
+	return e.docker.Version(ctx)
+}
+
+// ImageDigest returns the repository digest of the image used by the steps.
+func (e *Engine) ImageDigest(ctx context.Context, image string) (string, error) {
+	return e.docker.ImageDigest(ctx, image)
+}
+
+// StepUsage returns the resources consumed by the container or the host
+// process of the step once it exited, nil if the step did not run in a
+// docker container or on the host. It is only available once.
+func (e *Engine) StepUsage(stepID string) *docker.Usage {
+	if u := e.docker.Usage(stepID); u != nil {
+		return u
+	}
+	e.mu.Lock()
+	u, ok := e.hostUsage[stepID]
+	delete(e.hostUsage, stepID)
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return &docker.Usage{CPUSeconds: u.CPUSeconds, PeakMemoryBytes: u.PeakMemoryBytes,
+		IOReadBytes: u.IOReadBytes, IOWriteBytes: u.IOWriteBytes}
+}
+
+// StepPhases returns the time spent by the engine in the phases of the
+// step once it ran, nil if the step did not run. It is only available once.
+func (e *Engine) StepPhases(stepID string) *docker.StepPhases {
+	e.mu.Lock()
+	d, ok := e.runTime[stepID]
+	delete(e.runTime, stepID)
+	e.mu.Unlock()
+	p := e.docker.Phases(stepID)
+	if !ok {
+		return p
+	}
+	if p == nil {
+		p = &docker.StepPhases{}
+	}
+	p.Run = d
+	return p
+}
+
+// Exec runs the command in the running container of the step, with its
+// output written to output, and returns the exit code of the command.
+func (e *Engine) Exec(ctx context.Context, stepID string, command []string, output io.Writer) (int, error) {
+	e.mu.Lock()
+	k := e.kubernetes
+	c := e.containerd
+	e.mu.Unlock()
+	if k != nil {
+		return 0, errors.New("commands cannot be run in the containers of the kubernetes backend")
+	}
+	if c != nil {
+		return c.Exec(ctx, stepID, command, output)
+	}
+	return e.docker.Exec(ctx, stepID, command, output)
+}
+
+// ContainerIP returns the IP address of the running container of the step on
+// the network of the stage, empty if it has none, eg. on the host network.
+func (e *Engine) ContainerIP(ctx context.Context, stepID string) (string, error) {
+	e.mu.Lock()
+	cfg := e.pipelineConfig
+	k := e.kubernetes
+	c := e.containerd
+	e.mu.Unlock()
+	switch {
+	case k != nil:
+		return k.ContainerIP(ctx, stepID)
+	case c != nil:
+		return c.ContainerIP(ctx, stepID)
+	}
+	var network string
+	if cfg != nil {
+		network = cfg.Network.ID
+	}
+	return e.docker.ContainerIP(ctx, stepID, network)
+}
+
+// Kill kills the container of the step, the container is removed with the
+// stage.
+func (e *Engine) Kill(ctx context.Context, stepID string) error {
+	e.mu.Lock()
+	k := e.kubernetes
+	c := e.containerd
+	e.mu.Unlock()
+	switch {
+	case k != nil:
+		return k.Kill(ctx, stepID)
+	case c != nil:
+		return c.Kill(ctx, stepID)
+	}
+	return e.docker.Kill(ctx, stepID)
+}
+
+// ListResources returns the docker resources created by the engine which
+// match all the label selectors.
+func (e *Engine) ListResources(ctx context.Context, selectors []string) (*docker.Resources, error) {
+	return e.docker.ListResources(ctx, selectors)
+}
+
 func (e *Engine) Destroy(ctx context.Context) error {
 	e.mu.Lock()
 	cfg := e.pipelineConfig
+	k := e.kubernetes
+	c := e.containerd
 	e.mu.Unlock()
 	destroyHelper(cfg)
+	e.mu.Lock()
+	e.hostUsage = nil
+	e.runTime = nil
+	e.mu.Unlock()
 
-	return e.docker.Destroy(ctx, cfg)
+	var err error
+	switch {
+	case k != nil:
+		err = k.Destroy(ctx, cfg)
+	case c != nil:
+		err = c.Destroy(ctx, cfg)
+	default:
+		err = e.docker.Destroy(ctx, cfg)
+	}
+	// the clones and homes are mounted in the containers, they are removed
+	// once the containers are
+	e.removeClones()
+	e.removeHomes()
+	return err
 }
 
 func (e *Engine) Run(ctx context.Context, step *spec.Step, output io.Writer, isDrone bool, isHosted bool) (*runtime.State, error) {
+	defer e.addRunTime(step.ID, time.Now())
 	e.mu.Lock()
 	cfg := e.pipelineConfig
+	k := e.kubernetes
+	c := e.containerd
 	e.mu.Unlock()
 
 	if err := runHelper(cfg, step); err != nil {
 		return nil, err
 	}
 
+	if step.WorkspaceClone {
+		if step.Image != "" && k != nil {
+			return nil, errors.New("workspace clones are not supported by the kubernetes backend")
+		}
+		var err error
+		if cfg, err = e.cloneStepWorkspace(ctx, cfg, step); err != nil {
+			return nil, err
+		}
+	}
+
+	if step.IsolatedHome {
+		if step.Image != "" && k != nil {
+			return nil, errors.New("isolated homes are not supported by the kubernetes backend")
+		}
+		var err error
+		if cfg, err = e.isolateHome(cfg, step); err != nil {
+			return nil, err
+		}
+		if !step.Detach {
+			defer e.removeHome(step.ID)
+		}
+	}
+
 	if !isDrone && len(step.Command) > 0 {
 		printCommand(step, output)
 	}
 
+	if step.Image != "" && step.WarmContainer != "" {
+		if k != nil || c != nil {
+			return nil, errors.New("warm containers are only supported by the docker backend")
+		}
+		return e.docker.RunWarm(ctx, cfg, step, output, isHosted)
+	}
+	if step.GPUs != nil && step.Image != "" && (k != nil || c != nil) {
+		return nil, errors.New("gpus are only supported by the docker backend")
+	}
+	if step.Platform != nil && step.Image != "" && k != nil {
+		return nil, errors.New("image platforms are not supported by the kubernetes backend")
+	}
+	if step.Isolation == spec.IsolationHostProcess && step.Image != "" && k == nil {
+		return nil, errors.New("HostProcess containers are only supported by the kubernetes backend")
+	}
+	if step.Image != "" && k != nil {
+		return k.Run(ctx, cfg, step, output)
+	}
+	if step.Image != "" && c != nil {
+		return c.Run(ctx, cfg, step, output, isDrone)
+	}
 	if step.Image != "" {
 		return e.docker.Run(ctx, cfg, step, output, isDrone, isHosted)
 	}
 
-	return exec.Run(ctx, step, output)
+	state, usage, err := exec.RunWithUsage(ctx, step, output)
+	if usage != nil && step.ID != "" {
+		e.mu.Lock()
+		if e.hostUsage == nil {
+			e.hostUsage = make(map[string]*exec.Usage)
+		}
+		e.hostUsage[step.ID] = usage
+		e.mu.Unlock()
+	}
+	return state, err
+}
+
+// addRunTime adds the time spent running the step since start, the steps
+// retried in the engine run several times.
+func (e *Engine) addRunTime(stepID string, start time.Time) {
+	if stepID == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.runTime == nil {
+		e.runTime = make(map[string]time.Duration)
+	}
+	e.runTime[stepID] += time.Since(start)
 }
 
 func destroyHelper(cfg *spec.PipelineConfig) {
 	for _, vol := range cfg.Volumes {
+		if vol != nil && vol.NetworkShare != nil && vol.NetworkShare.Path != "" {
+			if err := unmountShare(vol.NetworkShare); err != nil {
+				logrus.WithField("path", vol.NetworkShare.Path).WithError(err).
+					Warnln("failed to unmount network share")
+			}
+			continue
+		}
 		if vol == nil || vol.HostPath == nil {
 			continue
 		}
@@ -138,23 +474,37 @@ func runHelper(cfg *spec.PipelineConfig, step *spec.Step) error {
 	if step.Image == "" {
 		// Set parent process envs in case step is executed directly on the VM.
 		// This sets the PATH environment variable (in case it is set on parent process) on sub-process executing the step.
-		for _, e := range os.Environ() {
-			if i := strings.Index(e, "="); i >= 0 {
-				envs[e[:i]] = e[i+1:]
-			}
+		// Sensitive variables of the engine process are filtered out.
+		var filtered []string
+		envs, filtered = hostEnvs(cfg.EnvPassthrough)
+		if len(filtered) > 0 {
+			logrus.WithField("step_id", step.ID).WithField("envs", filtered).
+				Debugln("filtered engine environment variables for the step")
 		}
 	}
 	for k, v := range cfg.Envs {
 		envs[k] = v
 	}
+	if cfg.EgressProxyPort != 0 {
+		setEgressProxy(cfg.EgressProxyPort, cfg.EgressProxyCredential, step, envs)
+	}
 	for k, v := range step.Envs {
 		envs[k] = v
 	}
+	setClockEnvs(step.Clock, envs)
 	step.Envs = envs
 	step.WorkingDir = pathConverter(step.WorkingDir)
 
 	// create files or folders specific to the step
-	if err := createFiles(step.Files); err != nil {
+	umask := fileperm.Umask()
+	if step.Umask != "" {
+		m, err := fileperm.Parse(step.Umask)
+		if err != nil {
+			return err
+		}
+		umask = m
+	}
+	if err := createFiles(step.Files, umask); err != nil {
 		return err
 	}
 
@@ -175,7 +525,9 @@ func printCommand(step *spec.Step, output io.Writer) {
 	}
 }
 
-func createFiles(paths []*spec.File) error {
+// createFiles creates the files of the step with their modes, the umask
+// applied.
+func createFiles(paths []*spec.File, umask fs.FileMode) error {
 	for _, f := range paths {
 		if f.Path == "" {
 			continue
@@ -185,7 +537,7 @@ func createFiles(paths []*spec.File) error {
 
 		// make the file writable (if it exists)
 		if _, err := os.Stat(path); err == nil {
-			if err = os.Chmod(path, 0644); err != nil {
+			if err = os.Chmod(path, fileperm.Apply(0644, umask)); err != nil {
 				logrus.Error(errors.Wrap(err,
 					fmt.Sprintf("failed to set permissions for file on host path: %q", path)))
 				continue
@@ -194,7 +546,7 @@ func createFiles(paths []*spec.File) error {
 
 		if f.IsDir {
 			// create a folder
-			if err := os.MkdirAll(path, fs.FileMode(f.Mode)); err != nil {
+			if err := os.MkdirAll(path, fileperm.Apply(fs.FileMode(f.Mode), umask)); err != nil {
 				return errors.Wrap(err,
 					fmt.Sprintf("failed to create directory for host path: %q", path))
 			}
@@ -216,7 +568,7 @@ func createFiles(paths []*spec.File) error {
 
 		_ = file.Close()
 
-		if err = os.Chmod(path, fs.FileMode(f.Mode)); err != nil {
+		if err = os.Chmod(path, fileperm.Apply(fs.FileMode(f.Mode), umask)); err != nil {
 			return errors.Wrap(err,
 				fmt.Sprintf("failed to change permissions for file on host path: %q", path))
 		}
@@ -2,9 +2,15 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	osruntime "runtime"
 	"strings"
 	"testing"
 
+	"github.com/harness/lite-engine/engine/docker"
 	"github.com/harness/lite-engine/engine/spec"
 )
 
@@ -55,3 +61,53 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestStepUsageHost(t *testing.T) {
+	if osruntime.GOOS == "windows" {
+		t.Skip("the step runs a shell script")
+	}
+	e := &Engine{pipelineConfig: &spec.PipelineConfig{}, docker: docker.New(nil, docker.Opts{})}
+	step := &spec.Step{ID: "step1", Entrypoint: []string{"sh", "-c"}, Command: []string{"head -c 1000000 /dev/zero > /dev/null"}}
+	state, err := e.Run(context.Background(), step, io.Discard, true, false)
+	if err != nil || state.ExitCode != 0 {
+		t.Fatalf("unexpected result %v %v", state, err)
+	}
+
+	u := e.StepUsage("step1")
+	if u == nil {
+		t.Fatal("expected the usage of the host step")
+	}
+	if u.PeakMemoryBytes == 0 {
+		t.Errorf("expected the peak memory of the host step")
+	}
+	if e.StepUsage("step1") != nil {
+		t.Errorf("expected the usage to be read once")
+	}
+}
+
+func TestCreateFilesUmask(t *testing.T) {
+	dir := t.TempDir()
+	files := []*spec.File{
+		{Path: filepath.Join(dir, "cache"), IsDir: true, Mode: 0777},
+		{Path: filepath.Join(dir, "script.sh"), Mode: 0777, Data: "echo hi"},
+	}
+	if err := createFiles(files, 0027); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cache", "script.sh"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got&0027 != 0 {
+			t.Errorf("%s: got mode %o, want the umask 0027 applied", name, got)
+		}
+	}
+}
+
+func TestRunHelperInvalidUmask(t *testing.T) {
+	step := &spec.Step{ID: "step1", Umask: "0027; rm -rf /"}
+	if err := runHelper(&spec.PipelineConfig{}, step); err == nil {
+		t.Error("want an error for the invalid umask of the step")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+// defaultDenyEnvs lists the engine process variables which are never passed
+// to steps running on the host unless they are explicitly allowed by name.
+var defaultDenyEnvs = []string{
+	"*TOKEN*",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*CREDENTIAL*",
+	"*PRIVATE_KEY*",
+	"*ACCESS_KEY*",
+	"*API_KEY*",
+	"SERVER_CERT_FILE",
+	"SERVER_KEY_FILE",
+	"CLIENT_CERT_FILE",
+	"CLIENT_KEY_FILE",
+	"CA_CERT_FILE",
+	"LITE_ENGINE_CONFIG",
+}
+
+// hostEnvs returns the engine process environment filtered as per the
+// passthrough configuration, along with the sorted names of the variables
+// which were filtered out.
+func hostEnvs(passthrough *spec.EnvPassthrough) (envs map[string]string, filtered []string) {
+	envs = make(map[string]string)
+	for _, e := range os.Environ() {
+		i := strings.Index(e, "=")
+		if i < 0 {
+			continue
+		}
+		k, v := e[:i], e[i+1:]
+		if passEnv(passthrough, k) {
+			envs[k] = v
+		} else {
+			filtered = append(filtered, k)
+		}
+	}
+	sort.Strings(filtered)
+	return envs, filtered
+}
+
+func passEnv(passthrough *spec.EnvPassthrough, name string) bool {
+	var allow, deny []string
+	if passthrough != nil {
+		allow, deny = passthrough.Allow, passthrough.Deny
+	}
+	if matchEnv(deny, name) {
+		return false
+	}
+	for _, a := range allow {
+		if a == name {
+			return true
+		}
+	}
+	if matchEnv(defaultDenyEnvs, name) {
+		return false
+	}
+	return len(allow) == 0 || matchEnv(allow, name)
+}
+
+func matchEnv(patterns []string, name string) bool {
+	upper := strings.ToUpper(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(p), upper); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayHost is the name of the host in the containers, mapped to the
+// gateway of the docker network.
+const gatewayHost = "host.docker.internal"
+
+// setEgressProxy sets the egress proxy of the stage as the proxy of the
+// step, with the credential of the stage. The containers reach it through
+// the gateway of the network. The proxy variables of the step, if any, take
+// precedence.
+func setEgressProxy(port int, credential string, step *spec.Step, envs map[string]string) {
+	host := "127.0.0.1"
+	if step.Image != "" {
+		host = gatewayHost
+		mapped := false
+		for _, h := range step.ExtraHosts {
+			mapped = mapped || strings.HasPrefix(h, gatewayHost+":")
+		}
+		if !mapped {
+			step.ExtraHosts = append(step.ExtraHosts, gatewayHost+":host-gateway")
+		}
+	}
+	proxy := "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+	if credential != "" {
+		proxy = "http://" + credential + "@" + net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	for _, k := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		envs[k] = proxy
+	}
+	noProxy := []string{"localhost", "127.0.0.1"}
+	v := envs["NO_PROXY"]
+	if v == "" {
+		v = envs["no_proxy"]
+	}
+	if v != "" {
+		noProxy = append([]string{v}, noProxy...)
+	}
+	envs["NO_PROXY"] = strings.Join(noProxy, ",")
+	envs["no_proxy"] = envs["NO_PROXY"]
+}
@@ -20,12 +20,20 @@ import (
 
 type cmdResult struct {
 	state *runtime.State
+	usage *Usage
 	err   error
 }
 
 func Run(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State, error) {
+	state, _, err := RunWithUsage(ctx, step, output)
+	return state, err
+}
+
+// RunWithUsage runs the step on the host like Run, and returns the resources
+// consumed by its process once it exited.
+func RunWithUsage(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State, *Usage, error) {
 	if len(step.Entrypoint) == 0 {
-		return nil, errors.New("step entrypoint cannot be empty")
+		return nil, nil, errors.New("step entrypoint cannot be empty")
 	}
 
 	cmdArgs := step.Entrypoint[1:]
@@ -47,7 +55,7 @@ func Run(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State
 	startTime := time.Now()
 	logrus.WithContext(ctx).Infoln(fmt.Sprintf("Starting command on host for step %s %s", step.ID, step.Name))
 	if err := cmd.Start(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	cmdSignal := make(chan cmdResult, 1)
@@ -57,25 +65,25 @@ func Run(ctx context.Context, step *spec.Step, output io.Writer) (*runtime.State
 	case <-ctx.Done():
 		if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			logrus.WithContext(ctx).Infoln(fmt.Sprintf("Execution canceled for step %s with error %v, took %.2f seconds", step.ID, ctx.Err(), time.Since(startTime).Seconds()))
-			return nil, ctx.Err()
+			return nil, nil, ctx.Err()
 		} else {
 			logrus.WithContext(ctx).Infoln(fmt.Sprintf("Context of command completed for step %s with error %v, took %.2f seconds", step.ID, ctx.Err(), time.Since(startTime).Seconds()))
-			return nil, fmt.Errorf("command context completed with error %v", ctx.Err())
+			return nil, nil, fmt.Errorf("command context completed with error %v", ctx.Err())
 		}
 	case result := <-cmdSignal:
 		logrus.WithContext(ctx).Infoln(fmt.Sprintf("Completed command on host for step %s, took %.2f seconds", step.ID, time.Since(startTime).Seconds()))
-		return result.state, result.err
+		return result.state, result.usage, result.err
 	}
 }
 
 func waitForCmd(cmd *exec.Cmd, cmdSignal chan<- cmdResult) {
 	err := cmd.Wait()
 	if err == nil {
-		cmdSignal <- cmdResult{state: &runtime.State{ExitCode: 0, Exited: true}, err: nil}
+		cmdSignal <- cmdResult{state: &runtime.State{ExitCode: 0, Exited: true}, usage: processUsage(cmd.ProcessState), err: nil}
 		return
 	}
 	if exitErr, ok := err.(*exec.ExitError); ok {
-		cmdSignal <- cmdResult{state: &runtime.State{ExitCode: exitErr.ExitCode(), Exited: true}, err: nil}
+		cmdSignal <- cmdResult{state: &runtime.State{ExitCode: exitErr.ExitCode(), Exited: true}, usage: processUsage(cmd.ProcessState), err: nil}
 		return
 	}
 	cmdSignal <- cmdResult{state: nil, err: err}
@@ -0,0 +1,28 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"os"
+)
+
+// Usage is the resources consumed by the process of a step on the host, and
+// by its descendants it waited for.
+type Usage struct {
+	CPUSeconds      float64
+	PeakMemoryBytes uint64
+	IOReadBytes     uint64
+	IOWriteBytes    uint64
+}
+
+// processUsage returns the resources consumed by the exited process.
+func processUsage(ps *os.ProcessState) *Usage {
+	if ps == nil {
+		return nil
+	}
+	u := &Usage{CPUSeconds: (ps.UserTime() + ps.SystemTime()).Seconds()}
+	addRusage(u, ps)
+	return u
+}
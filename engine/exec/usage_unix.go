@@ -0,0 +1,31 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+const blockSize = 512 // the unit of the block io counters of rusage
+
+// addRusage adds the peak resident memory and the block io of the rusage of
+// the process.
+func addRusage(u *Usage, ps *os.ProcessState) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return
+	}
+	maxrss := uint64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxrss *= 1024 // in kilobytes but on darwin
+	}
+	u.PeakMemoryBytes = maxrss
+	u.IOReadBytes = uint64(ru.Inblock) * blockSize
+	u.IOWriteBytes = uint64(ru.Oublock) * blockSize
+}
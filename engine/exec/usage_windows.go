@@ -0,0 +1,14 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build windows
+
+package exec
+
+import (
+	"os"
+)
+
+// addRusage is a no-op, only the cpu time of the process is available.
+func addRusage(u *Usage, ps *os.ProcessState) {}
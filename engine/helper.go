@@ -28,7 +28,7 @@ func SetupPipeline(
 	if err != nil {
 		return err
 	}
-	if err := setupHelper(pipelineConfig); err != nil {
+	if err := setupHelper(ctx, pipelineConfig); err != nil {
 		return err
 	}
 
@@ -0,0 +1,98 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"os"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	homeVolName = "_home"
+	// the isolated home of the container steps.
+	containerHomePath        = "/tmp/lite-engine-home"
+	windowsContainerHomePath = `C:\lite-engine-home`
+	// the home is writable by the user of the container, unknown to the
+	// engine.
+	containerHomePerms = 0o777
+)
+
+// isolateHome creates the isolated home of the step on the host, its HOME,
+// mounted in the container of the step. The home of a step run again
+// replaces the previous one, it is removed once the step completes, or with
+// the stage for the detached steps.
+func (e *Engine) isolateHome(cfg *spec.PipelineConfig, step *spec.Step) (*spec.PipelineConfig, error) {
+	e.removeHome(step.ID)
+	dir, err := os.MkdirTemp("", "lite-engine-home-")
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.homes == nil {
+		e.homes = make(map[string]string)
+	}
+	e.homes[step.ID] = dir
+	e.mu.Unlock()
+
+	if step.Image == "" {
+		setHomeEnvs(step, dir, cfg.Platform.OS)
+		return cfg, nil
+	}
+	if err := os.Chmod(dir, containerHomePerms); err != nil {
+		return nil, err
+	}
+	if userns := cfg.UserNamespace; userns != nil {
+		if err := chownVolume(dir, userns, false); err != nil {
+			return nil, err
+		}
+	}
+	path := containerHomePath
+	if cfg.Platform.OS == "windows" {
+		path = windowsContainerHomePath
+	}
+	homeCfg := *cfg
+	homeCfg.Volumes = append(append([]*spec.Volume{}, cfg.Volumes...), &spec.Volume{
+		HostPath: &spec.VolumeHostPath{ID: "home-" + step.ID, Name: homeVolName, Path: dir},
+	})
+	step.Volumes = append(step.Volumes, &spec.VolumeMount{Name: homeVolName, Path: path})
+	setHomeEnvs(step, path, cfg.Platform.OS)
+	return &homeCfg, nil
+}
+
+func setHomeEnvs(step *spec.Step, path, goos string) {
+	step.Envs["HOME"] = path
+	if goos == "windows" {
+		step.Envs["USERPROFILE"] = path
+	}
+}
+
+// removeHome removes the isolated home of the step, if any.
+func (e *Engine) removeHome(stepID string) {
+	e.mu.Lock()
+	dir, ok := e.homes[stepID]
+	delete(e.homes, stepID)
+	e.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logrus.WithField("step_id", stepID).WithError(err).Warnln("failed to remove the isolated home")
+	}
+}
+
+// removeHomes removes the isolated homes of the steps.
+func (e *Engine) removeHomes() {
+	e.mu.Lock()
+	homes := e.homes
+	e.homes = nil
+	e.mu.Unlock()
+	for id, dir := range homes {
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.WithField("step_id", id).WithError(err).Warnln("failed to remove the isolated home")
+		}
+	}
+}
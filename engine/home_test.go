@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsolateHomeHostStep(t *testing.T) {
+	cfg := &spec.PipelineConfig{}
+	step := &spec.Step{ID: "bazel", Envs: map[string]string{"HOME": "/root"}, IsolatedHome: true}
+
+	e := &Engine{}
+	homeCfg, err := e.isolateHome(cfg, step)
+	assert.NoError(t, err)
+	assert.Same(t, cfg, homeCfg)
+	home := step.Envs["HOME"]
+	assert.NotEqual(t, "/root", home)
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".bazelrc"), []byte("build --jobs=4"), 0600))
+
+	// the step run again gets an empty home
+	_, err = e.isolateHome(cfg, step)
+	assert.NoError(t, err)
+	_, err = os.Stat(home)
+	assert.True(t, os.IsNotExist(err))
+
+	home = step.Envs["HOME"]
+	e.removeHome(step.ID)
+	_, err = os.Stat(home)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIsolateHomeContainerStep(t *testing.T) {
+	cfg := &spec.PipelineConfig{Volumes: []*spec.Volume{{HostPath: &spec.VolumeHostPath{Name: "harness", Path: "/harness"}}}}
+	step := &spec.Step{ID: "bazel", Image: "bazel", Envs: map[string]string{}, IsolatedHome: true,
+		Volumes: []*spec.VolumeMount{{Name: "harness", Path: "/harness"}}}
+
+	e := &Engine{}
+	homeCfg, err := e.isolateHome(cfg, step)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Volumes, 1)
+	assert.Len(t, homeCfg.Volumes, 2)
+	dir := homeCfg.Volumes[1].HostPath.Path
+	assert.Equal(t, []*spec.VolumeMount{{Name: "harness", Path: "/harness"}, {Name: homeVolName, Path: containerHomePath}}, step.Volumes)
+	assert.Equal(t, containerHomePath, step.Envs["HOME"])
+	info, err := os.Stat(dir)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	e.removeHomes()
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	imageArchiveExt    = ".tar"
+	imageIDExt         = ".id"
+	imageIDPermissions = 0644
+)
+
+// imageStore saves and loads the images of the docker daemon.
+type imageStore interface {
+	ImageID(ctx context.Context, image string) (string, error)
+	SaveImages(ctx context.Context, images []string, w io.Writer) error
+	LoadImages(ctx context.Context, r io.Reader) error
+}
+
+// ImageCacheSupported returns whether the images of the stage can be
+// cached: the stage runs its containers on the docker daemon of the host,
+// with its socket mounted.
+func (e *Engine) ImageCacheSupported() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cfg := e.pipelineConfig
+	return cfg != nil && e.kubernetes == nil && e.containerd == nil &&
+		(cfg.EnableDockerSetup == nil || *cfg.EnableDockerSetup)
+}
+
+// ExportImages saves each image to an archive in the cache directory, eg.
+// at the end of a stage, so the next stage can import them instead of
+// pulling them. The archive of an image is only rewritten if the image
+// changed. It returns the number of exported images.
+func (e *Engine) ExportImages(ctx context.Context, dir string, images []string) (int, error) {
+	return exportImages(ctx, e.docker, dir, images)
+}
+
+// ImportImages loads the image archives of the cache directory, eg. at
+// the setup of a stage. It returns the number of imported archives.
+func (e *Engine) ImportImages(ctx context.Context, dir string) (int, error) {
+	return importImages(ctx, e.docker, dir)
+}
+
+// exportImages saves the images to the cache directory. The images which
+// cannot be saved are logged and skipped, the cache is best effort.
+func exportImages(ctx context.Context, store imageStore, dir string, images []string) (int, error) {
+	if err := os.MkdirAll(dir, fileperm.Mode(os.ModePerm)); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, image := range images {
+		log := logrus.WithContext(ctx).WithField("image", image).WithField("dir", dir)
+		id, err := store.ImageID(ctx, image)
+		if err != nil {
+			log.WithError(err).Warnln("cannot inspect the image to cache")
+			continue
+		}
+		path := filepath.Join(dir, imageArchiveName(image))
+		if cached, _ := os.ReadFile(path + imageIDExt); string(cached) == id {
+			if _, err = os.Stat(path); err == nil {
+				log.Debugln("image archive is up to date")
+				continue
+			}
+		}
+		if err = saveImage(ctx, store, image, path); err != nil {
+			log.WithError(err).Warnln("cannot export the image to the cache")
+			continue
+		}
+		if err = os.WriteFile(path+imageIDExt, []byte(id), fileperm.Mode(imageIDPermissions)); err != nil {
+			log.WithError(err).Warnln("cannot write the id of the cached image")
+		}
+		n++
+	}
+	return n, nil
+}
+
+// saveImage writes the image archive to a temporary file first, so an
+// interrupted export never leaves a truncated archive in the cache.
+func saveImage(ctx context.Context, store imageStore, image, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = store.SaveImages(ctx, []string{image}, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// importImages loads the image archives of the cache directory. The
+// archives which cannot be loaded are logged and skipped.
+func importImages(ctx context.Context, store imageStore, dir string) (int, error) {
+	archives, err := filepath.Glob(filepath.Join(dir, "*"+imageArchiveExt))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, path := range archives {
+		if err := loadImage(ctx, store, path); err != nil {
+			logrus.WithContext(ctx).WithField("archive", path).WithError(err).
+				Warnln("cannot import the cached image archive")
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+func loadImage(ctx context.Context, store imageStore, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.LoadImages(ctx, f)
+}
+
+// imageArchiveName returns the archive file name of the image, the hash of
+// its reference so that the names of distinct images never collide.
+func imageArchiveName(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return hex.EncodeToString(sum[:]) + imageArchiveExt
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeImageStore struct {
+	ids    map[string]string
+	saved  []string
+	loaded []string
+}
+
+func (s *fakeImageStore) ImageID(_ context.Context, image string) (string, error) {
+	id, ok := s.ids[image]
+	if !ok {
+		return "", errors.New("no such image")
+	}
+	return id, nil
+}
+
+func (s *fakeImageStore) SaveImages(_ context.Context, images []string, w io.Writer) error {
+	s.saved = append(s.saved, images...)
+	_, err := io.WriteString(w, s.ids[images[0]])
+	return err
+}
+
+func (s *fakeImageStore) LoadImages(_ context.Context, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.loaded = append(s.loaded, string(b))
+	return nil
+}
+
+func TestExportImportImages(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "cache")
+	store := &fakeImageStore{ids: map[string]string{
+		"golang:1.19":                 "sha256:aaa",
+		"registry.io/team/node:18.04": "sha256:bbb",
+	}}
+
+	n, err := exportImages(ctx, store, dir, []string{"golang:1.19", "registry.io/team/node:18.04", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.FileExists(t, filepath.Join(dir, imageArchiveName("golang:1.19")))
+	assert.FileExists(t, filepath.Join(dir, imageArchiveName("registry.io/team/node:18.04")))
+
+	// unchanged images are not saved again
+	n, err = exportImages(ctx, store, dir, []string{"golang:1.19"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// changed images are
+	store.ids["golang:1.19"] = "sha256:ccc"
+	n, err = exportImages(ctx, store, dir, []string{"golang:1.19"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"golang:1.19", "registry.io/team/node:18.04", "golang:1.19"}, store.saved)
+
+	n, err = importImages(ctx, store, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"sha256:ccc", "sha256:bbb"}, store.loaded)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestImageArchiveName(t *testing.T) {
+	assert.NotEqual(t, imageArchiveName("team/node:18"), imageArchiveName("team_node:18"))
+	assert.Equal(t, imageArchiveName("team/node:18"), imageArchiveName("team/node:18"))
+}
+
+func TestImageCacheSupported(t *testing.T) {
+	disabled := false
+	assert.False(t, (&Engine{}).ImageCacheSupported())
+	assert.True(t, (&Engine{pipelineConfig: &spec.PipelineConfig{}}).ImageCacheSupported())
+	assert.False(t, (&Engine{pipelineConfig: &spec.PipelineConfig{EnableDockerSetup: &disabled}}).ImageCacheSupported())
+}
+
+func TestImportImagesMissingDir(t *testing.T) {
+	n, err := importImages(context.Background(), &fakeImageStore{}, filepath.Join(t.TempDir(), "none"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
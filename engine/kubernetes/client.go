@@ -0,0 +1,142 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// client is a minimal client of the Kubernetes REST API, for the pods and
+// secrets of the steps.
+type client struct {
+	base      string
+	tokenFile string // re-read on every request, the service account token is rotated
+	http      *http.Client
+}
+
+// apiError is the status returned by the API server on a failed request.
+type apiError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("kubernetes: %s (%d %s)", e.Message, e.Code, e.Reason)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError) //nolint:errorlint
+	return ok && apiErr.Code == http.StatusNotFound
+}
+
+// newInClusterClient returns a client authenticated with the service
+// account of the pod the engine runs in.
+func newInClusterClient() (*client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("kubernetes: the engine is not running in a cluster")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: cannot read the cluster certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("kubernetes: invalid cluster certificate")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &client{
+		base:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		http:      &http.Client{Transport: transport},
+	}, nil
+}
+
+// inClusterNamespace returns the namespace of the pod the engine runs in.
+func inClusterNamespace() string {
+	data, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return "default"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (c *client) request(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: cannot read the service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		apiErr := &apiError{Code: resp.StatusCode}
+		if data, _ := io.ReadAll(resp.Body); json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.Code = resp.StatusCode
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends the request with the json of in and decodes the response into
+// out if not nil.
+func (c *client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := c.request(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream returns the body of the response, eg. the logs of a container.
+func (c *client) stream(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package kubernetes runs the container steps as pods, eg. when the engine
+// runs in a cluster without a docker daemon. Each step is a pod on the
+// node of the engine, the host paths of the stage are mounted from the node
+// so the engine needs them mounted at the same paths.
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/sirupsen/logrus"
+)
+
+// the interval the pods are polled at while they start and run.
+var pollInterval = time.Second
+
+// the timeout of the deletion of the resources of a canceled step.
+var deleteTimeout = 30 * time.Second
+
+// the waiting reasons of a container which cannot start.
+var fatalReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"ErrImageNeverPull":          true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// Opts configures the Kubernetes engine.
+type Opts struct {
+	// Namespace of the step pods, the namespace of the engine if not set.
+	Namespace string
+	// NodeName is the node the step pods are scheduled on, it should be the
+	// node of the engine so the steps share the host paths of the stage.
+	NodeName       string
+	ServiceAccount string
+	// VolumeDir is the directory of the temporary volumes of the stage on
+	// the node.
+	VolumeDir string
+	// Tolerations of the step pods, in the key:effect format.
+	Tolerations []string
+}
+
+// Kubernetes runs the container steps of a stage as pods.
+type Kubernetes struct {
+	client *client
+	opts   Opts
+
+	mu       sync.Mutex
+	stage    string
+	pods     []string       // the pods of the stage, in creation order
+	attempts map[string]int // the pods created for each step
+	follows  []context.CancelFunc
+}
+
+// NewInCluster returns the engine running the steps in the cluster of the
+// engine pod, with its service account.
+func NewInCluster(opts Opts) (*Kubernetes, error) {
+	c, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = inClusterNamespace()
+	}
+	return newKubernetes(c, opts), nil
+}
+
+func newKubernetes(c *client, opts Opts) *Kubernetes {
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	if opts.VolumeDir == "" {
+		opts.VolumeDir = "/tmp/lite-engine/volumes"
+	}
+	return &Kubernetes{client: c, opts: opts, attempts: make(map[string]int)}
+}
+
+// Setup checks the engine can manage the pods of the namespace.
+func (k *Kubernetes) Setup(ctx context.Context, cfg *spec.PipelineConfig) error {
+	stage := cfg.Labels[labels.Stage]
+	if stage == "" {
+		stage = randomID()
+	}
+	k.mu.Lock()
+	k.stage = stage
+	k.mu.Unlock()
+
+	if err := k.client.do(ctx, http.MethodGet, k.path("pods")+"?limit=1", nil, nil); err != nil {
+		return fmt.Errorf("cannot list the pods of namespace %s: %w", k.opts.Namespace, err)
+	}
+	return nil
+}
+
+// Run creates the pod of the step and streams its logs to output until it
+// exits. The pod of a detached step is left running, the pod of a step
+// canceled before it exits is deleted.
+func (k *Kubernetes) Run(ctx context.Context, cfg *spec.PipelineConfig, step *spec.Step, output io.Writer) (*runtime.State, error) {
+	k.mu.Lock()
+	k.attempts[step.ID]++
+	name := podName(k.stage, step.ID, k.attempts[step.ID])
+	k.pods = append(k.pods, name)
+	k.mu.Unlock()
+
+	state, err := k.run(ctx, cfg, step, name, output)
+	if err != nil && ctx.Err() != nil {
+		// the step context is done, the resources are deleted with a fresh one
+		deleteCtx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+		defer cancel()
+		_ = k.deleteStep(deleteCtx, name)
+	}
+	return state, err
+}
+
+func (k *Kubernetes) run(ctx context.Context, cfg *spec.PipelineConfig, step *spec.Step, name string, output io.Writer) (*runtime.State, error) {
+	p := k.toPod(cfg, step, name)
+	if len(step.Secrets) > 0 {
+		s := toSecret(k.opts.Namespace, name, p.Metadata.Labels, step.Secrets)
+		if err := k.client.do(ctx, http.MethodPost, k.path("secrets"), s, nil); err != nil {
+			return nil, err
+		}
+	}
+	if step.Auth != nil && step.Auth.Address != "" {
+		s := toPullSecret(k.opts.Namespace, name+"-pull", p.Metadata.Labels, step.Auth)
+		if err := k.client.do(ctx, http.MethodPost, k.path("secrets"), s, nil); err != nil {
+			return nil, err
+		}
+		p.Spec.ImagePullSecrets = []objectRef{{Name: s.Metadata.Name}}
+	}
+	if err := k.client.do(ctx, http.MethodPost, k.path("pods"), p, nil); err != nil {
+		return nil, err
+	}
+
+	if err := k.waitStarted(ctx, name); err != nil {
+		return nil, err
+	}
+	if step.Detach {
+		// the logs of a detached step are followed until the stage is destroyed
+		followCtx, cancel := context.WithCancel(context.Background())
+		k.mu.Lock()
+		k.follows = append(k.follows, cancel)
+		k.mu.Unlock()
+		go k.followLogs(followCtx, name, output)
+		return &runtime.State{Exited: false}, nil
+	}
+	k.followLogs(ctx, name, output)
+	return k.waitExited(ctx, name)
+}
+
+// Destroy deletes the pods and secrets of the steps and the temporary
+// volumes of the stage.
+func (k *Kubernetes) Destroy(ctx context.Context, cfg *spec.PipelineConfig) error {
+	k.mu.Lock()
+	pods, follows := k.pods, k.follows
+	k.pods, k.follows = nil, nil
+	k.attempts = make(map[string]int)
+	k.mu.Unlock()
+
+	for _, cancel := range follows {
+		cancel()
+	}
+	var lastErr error
+	for _, name := range pods {
+		if err := k.deleteStep(ctx, name); err != nil {
+			lastErr = err
+		}
+	}
+	for _, vol := range cfg.Volumes {
+		if vol != nil && vol.EmptyDir != nil {
+			_ = os.RemoveAll(k.emptyDirPath(vol.EmptyDir))
+		}
+	}
+	return lastErr
+}
+
+// ContainerIP returns the IP address of the pod of the last attempt of the
+// step.
+func (k *Kubernetes) ContainerIP(ctx context.Context, stepID string) (string, error) {
+	p := new(pod)
+	if err := k.client.do(ctx, http.MethodGet, k.path("pods", k.lastPod(stepID)), nil, p); err != nil {
+		return "", err
+	}
+	return p.Status.PodIP, nil
+}
+
+// Kill deletes the pod and the secrets of the last attempt of the step.
+func (k *Kubernetes) Kill(ctx context.Context, stepID string) error {
+	return k.deleteStep(ctx, k.lastPod(stepID))
+}
+
+func (k *Kubernetes) lastPod(stepID string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return podName(k.stage, stepID, k.attempts[stepID])
+}
+
+// deleteStep deletes the pod and the secrets of a step, the resources not
+// found are already deleted.
+func (k *Kubernetes) deleteStep(ctx context.Context, name string) error {
+	var lastErr error
+	for _, path := range []string{k.path("pods", name), k.path("secrets", name), k.path("secrets", name+"-pull")} {
+		if err := k.client.do(ctx, http.MethodDelete, path, nil, nil); err != nil && !isNotFound(err) {
+			logrus.WithContext(ctx).WithError(err).WithField("path", path).Warnln("cannot delete the step resource")
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// waitStarted polls the pod until the step container runs or exits.
+func (k *Kubernetes) waitStarted(ctx context.Context, name string) error {
+	return k.poll(ctx, name, func(p *pod) (bool, error) {
+		if p.Status.Phase == "Failed" {
+			return false, fmt.Errorf("step pod %s failed: %s", name, p.Status.Message)
+		}
+		st := p.Status.step()
+		if st == nil {
+			return false, nil
+		}
+		if w := st.State.Waiting; w != nil && fatalReasons[w.Reason] {
+			return false, fmt.Errorf("step pod %s cannot start: %s: %s", name, w.Reason, w.Message)
+		}
+		return st.State.Running != nil || st.State.Terminated != nil, nil
+	})
+}
+
+// waitExited polls the pod until the step container exits.
+func (k *Kubernetes) waitExited(ctx context.Context, name string) (*runtime.State, error) {
+	state := &runtime.State{}
+	err := k.poll(ctx, name, func(p *pod) (bool, error) {
+		st := p.Status.step()
+		if st == nil || st.State.Terminated == nil {
+			return false, nil
+		}
+		state.Exited = true
+		state.ExitCode = st.State.Terminated.ExitCode
+		state.OOMKilled = st.State.Terminated.Reason == "OOMKilled"
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (k *Kubernetes) poll(ctx context.Context, name string, done func(*pod) (bool, error)) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		p := new(pod)
+		if err := k.client.do(ctx, http.MethodGet, k.path("pods", name), nil, p); err != nil {
+			return err
+		}
+		if ok, err := done(p); ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// followLogs copies the logs of the step container to output until the
+// container exits.
+func (k *Kubernetes) followLogs(ctx context.Context, name string, output io.Writer) {
+	q := url.Values{"container": {stepContainer}, "follow": {"true"}}
+	logs, err := k.client.stream(ctx, k.path("pods", name, "log")+"?"+q.Encode())
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("pod", name).Warnln("cannot follow the step logs")
+		return
+	}
+	defer logs.Close()
+	_, _ = io.Copy(output, logs)
+}
+
+// path returns the API path of the namespaced resource.
+func (k *Kubernetes) path(resource string, elems ...string) string {
+	p := "/api/v1/namespaces/" + url.PathEscape(k.opts.Namespace) + "/" + resource
+	for _, e := range elems {
+		p += "/" + url.PathEscape(e)
+	}
+	return p
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+func randomID() string {
+	b := make([]byte, 8) //nolint:gomnd
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,235 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves the pods of the steps, the step container starts on the
+// second poll and exits on the fourth.
+type fakeAPI struct {
+	mu      sync.Mutex
+	pods    map[string]*pod
+	polls   map[string]int
+	secrets []string
+	deleted []string
+	reason  string // the waiting reason of the step containers, if set
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/ci/")
+	switch {
+	case r.Method == http.MethodGet && path == "pods":
+		fmt.Fprint(w, `{"items":[]}`)
+	case r.Method == http.MethodPost && path == "pods":
+		p := new(pod)
+		_ = json.NewDecoder(r.Body).Decode(p)
+		f.pods[p.Metadata.Name] = p
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodPost && path == "secrets":
+		s := new(secret)
+		_ = json.NewDecoder(r.Body).Decode(s)
+		f.secrets = append(f.secrets, s.Metadata.Name)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/log"):
+		fmt.Fprint(w, "hello\n")
+	case r.Method == http.MethodGet:
+		name := strings.TrimPrefix(path, "pods/")
+		p, ok := f.pods[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"reason":"NotFound","message":"pod not found"}`)
+			return
+		}
+		f.polls[name]++
+		state := `{"waiting":{"reason":"ContainerCreating"}}`
+		switch n := f.polls[name]; {
+		case f.reason != "":
+			state = fmt.Sprintf(`{"waiting":{"reason":%q,"message":"back-off pulling image"}}`, f.reason)
+		case n >= 4:
+			state = `{"terminated":{"exitCode":2,"reason":"Error"}}`
+		case n >= 2:
+			state = `{"running":{}}`
+		}
+		fmt.Fprintf(w, `{"metadata":{"name":%q},"status":{"phase":"Running","containerStatuses":[{"name":"step","state":%s}]}}`, p.Metadata.Name, state)
+	case r.Method == http.MethodDelete:
+		f.deleted = append(f.deleted, path)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":404}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestKubernetes(t *testing.T) (*Kubernetes, *fakeAPI) {
+	pollInterval = time.Millisecond
+	api := &fakeAPI{pods: make(map[string]*pod), polls: make(map[string]int)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return newKubernetes(&client{base: srv.URL, http: srv.Client()}, Opts{Namespace: "ci", NodeName: "node-1"}), api
+}
+
+func TestRun(t *testing.T) {
+	k, api := newTestKubernetes(t)
+	ctx := context.Background()
+	cfg := &spec.PipelineConfig{Labels: map[string]string{labels.Stage: "stage1"}}
+	assert.Nil(t, k.Setup(ctx, cfg))
+
+	step := &spec.Step{
+		ID:      "step1",
+		Image:   "alpine",
+		Command: []string{"echo hello"},
+		Secrets: []*spec.Secret{{Env: "TOKEN", Data: []byte("secret")}},
+	}
+	var out bytes.Buffer
+	state, err := k.Run(ctx, cfg, step, &out)
+	assert.Nil(t, err)
+	assert.True(t, state.Exited)
+	assert.Equal(t, 2, state.ExitCode)
+	assert.Equal(t, "hello\n", out.String())
+
+	name := podName("stage1", "step1", 1)
+	assert.Equal(t, []string{name}, api.secrets)
+	p := api.pods[name]
+	assert.Equal(t, "node-1", p.Spec.NodeName)
+	assert.Equal(t, "Never", p.Spec.RestartPolicy)
+	assert.Equal(t, "step1", p.Metadata.Labels[labels.Step])
+	assert.Equal(t, []envVar{{Name: "TOKEN", ValueFrom: &envSource{SecretKeyRef: &secretKeyRef{Name: name, Key: "TOKEN"}}}}, p.Spec.Containers[0].Env)
+
+	// not found resources are already deleted
+	assert.Nil(t, k.Destroy(ctx, cfg))
+	assert.Equal(t, []string{"pods/" + name, "secrets/" + name, "secrets/" + name + "-pull"}, api.deleted)
+}
+
+func TestRunImagePullError(t *testing.T) {
+	k, api := newTestKubernetes(t)
+	api.reason = "ImagePullBackOff"
+	ctx := context.Background()
+	cfg := &spec.PipelineConfig{}
+	assert.Nil(t, k.Setup(ctx, cfg))
+
+	_, err := k.Run(ctx, cfg, &spec.Step{ID: "step1", Image: "missing"}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "ImagePullBackOff: back-off pulling image")
+}
+
+func TestToPod(t *testing.T) {
+	k := newKubernetes(&client{}, Opts{Namespace: "ci", VolumeDir: "/tmp/volumes", Tolerations: []string{"ci:NoSchedule"}})
+	cfg := &spec.PipelineConfig{
+		Volumes: []*spec.Volume{
+			{HostPath: &spec.VolumeHostPath{Name: "harness", Path: "/harness"}},
+			{HostPath: &spec.VolumeHostPath{Name: "_docker", Path: "/var/run/docker.sock"}},
+			{EmptyDir: &spec.VolumeEmptyDir{ID: "cache-1", Name: "cache"}},
+		},
+	}
+	step := &spec.Step{
+		ID:         "a very long step identifier which is not a valid label value at all, really",
+		Image:      "golang",
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"go test"},
+		User:       "1000:1000",
+		MemLimit:   1 << 30,
+		CPUQuota:   150000,
+		ExtraHosts: []string{"registry:10.0.0.1"},
+		Pull:       spec.PullIfNotExists,
+		OCIRuntime: "gvisor",
+		Volumes: []*spec.VolumeMount{
+			{Name: "harness", Path: "/harness"},
+			{Name: "_docker", Path: "/var/run/docker.sock"},
+			{Name: "cache", Path: "/cache"},
+		},
+	}
+	p := k.toPod(cfg, step, "pod1")
+	c := p.Spec.Containers[0]
+	assert.Equal(t, []string{"sh", "-c"}, c.Command)
+	assert.Equal(t, []string{"go test"}, c.Args)
+	assert.Equal(t, "IfNotPresent", c.ImagePullPolicy)
+	assert.Equal(t, int64(1000), *c.SecurityContext.RunAsUser)
+	assert.Equal(t, map[string]string{"memory": "1073741824", "cpu": "1500m"}, c.Resources.Limits)
+	assert.Equal(t, []podHostAlias{{IP: "10.0.0.1", Hostnames: []string{"registry"}}}, p.Spec.HostAliases)
+	assert.Equal(t, []podToleration{{Key: "ci", Operator: "Exists", Effect: "NoSchedule"}}, p.Spec.Tolerations)
+	assert.NotContains(t, p.Metadata.Labels, labels.Step)
+	assert.Equal(t, "gvisor", p.Spec.RuntimeClassName)
+
+	// the docker socket is not mounted
+	assert.Equal(t, []volumeMount{{Name: "volume-0", MountPath: "/harness"}, {Name: "volume-2", MountPath: "/cache"}}, c.VolumeMounts)
+	assert.Equal(t, "/tmp/volumes/cache-1", p.Spec.Volumes[1].HostPath.Path)
+}
+
+func TestPodName(t *testing.T) {
+	name := podName("Stage_1", strings.Repeat("step", 20), 1)
+	assert.LessOrEqual(t, len(name), 63)
+	assert.True(t, strings.HasPrefix(name, "lite-engine-stage-1-step"))
+	assert.NotEqual(t, name, podName("Stage_1", strings.Repeat("step", 21), 1))
+
+	retry := podName("Stage_1", strings.Repeat("step", 20), 12)
+	assert.LessOrEqual(t, len(retry), 63)
+	assert.True(t, strings.HasSuffix(retry, "-12"))
+}
+
+func TestRunCanceled(t *testing.T) {
+	k, api := newTestKubernetes(t)
+	api.reason = "ContainerCreating"
+	cfg := &spec.PipelineConfig{Labels: map[string]string{labels.Stage: "stage1"}}
+	assert.Nil(t, k.Setup(context.Background(), cfg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := k.Run(ctx, cfg, &spec.Step{ID: "step1", Image: "alpine"}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	name := podName("stage1", "step1", 1)
+	api.mu.Lock()
+	assert.Equal(t, []string{"pods/" + name, "secrets/" + name, "secrets/" + name + "-pull"}, api.deleted)
+	api.reason = ""
+	api.mu.Unlock()
+
+	// the retry of the step does not reuse the pod name
+	_, err = k.Run(context.Background(), cfg, &spec.Step{ID: "step1", Image: "alpine"}, &bytes.Buffer{})
+	assert.Nil(t, err)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	assert.Contains(t, api.pods, podName("stage1", "step1", 2))
+}
+
+func TestToPodSecurityContext(t *testing.T) {
+	k := newKubernetes(&client{}, Opts{Namespace: "ci"})
+	step := &spec.Step{ID: "step1", Image: "golang", SecurityContext: &spec.SecurityContext{
+		CapAdd: []string{"cap_net_admin"}, CapDrop: []string{"ALL"}, Seccomp: "profiles/ci.json",
+		AppArmor: spec.ProfileRuntimeDefault, NoNewPrivileges: true, ReadOnlyRootfs: true}}
+	sc := k.toPod(&spec.PipelineConfig{}, step, "pod1").Spec.Containers[0].SecurityContext
+	assert.Equal(t, &capabilities{Add: []string{"NET_ADMIN"}, Drop: []string{"ALL"}}, sc.Capabilities)
+	assert.Equal(t, &securityProfile{Type: "Localhost", LocalhostProfile: "profiles/ci.json"}, sc.SeccompProfile)
+	assert.Equal(t, &securityProfile{Type: "RuntimeDefault"}, sc.AppArmorProfile)
+	assert.False(t, *sc.AllowPrivilegeEscalation)
+	assert.True(t, *sc.ReadOnlyRootFilesystem)
+}
+
+func TestToPodHostProcess(t *testing.T) {
+	k := newKubernetes(&client{}, Opts{Namespace: "ci"})
+	step := &spec.Step{ID: "step1", Image: "mcr.microsoft.com/oss/kubernetes/windows-host-process-containers-base-image",
+		Isolation: spec.IsolationHostProcess}
+	p := k.toPod(&spec.PipelineConfig{}, step, "pod1")
+	assert.True(t, p.Spec.HostNetwork)
+	assert.True(t, *p.Spec.Containers[0].SecurityContext.WindowsOptions.HostProcess)
+
+	step.Isolation = spec.IsolationProcess
+	p = k.toPod(&spec.PipelineConfig{}, step, "pod1")
+	assert.False(t, p.Spec.HostNetwork)
+	assert.Nil(t, p.Spec.Containers[0].SecurityContext)
+}
@@ -0,0 +1,528 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+const (
+	stepContainer = "step"
+	dockerSocket  = "/var/run/docker.sock"
+	// the label value of a step pod name, the step ids can be longer than
+	// the 63 characters of a label value.
+	podLabel = labels.Prefix + "pod"
+)
+
+// The subset of the Kubernetes API objects used by the engine.
+type (
+	objectMeta struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+	}
+
+	pod struct {
+		APIVersion string     `json:"apiVersion"`
+		Kind       string     `json:"kind"`
+		Metadata   objectMeta `json:"metadata"`
+		Spec       podSpec    `json:"spec"`
+		Status     podStatus  `json:"status,omitempty"`
+	}
+
+	podSpec struct {
+		NodeName           string          `json:"nodeName,omitempty"`
+		ServiceAccountName string          `json:"serviceAccountName,omitempty"`
+		RestartPolicy      string          `json:"restartPolicy"`
+		Containers         []podContainer  `json:"containers"`
+		Volumes            []podVolume     `json:"volumes,omitempty"`
+		ImagePullSecrets   []objectRef     `json:"imagePullSecrets,omitempty"`
+		DNSConfig          *podDNSConfig   `json:"dnsConfig,omitempty"`
+		HostAliases        []podHostAlias  `json:"hostAliases,omitempty"`
+		SecurityContext    *podSecContext  `json:"securityContext,omitempty"`
+		Tolerations        []podToleration `json:"tolerations,omitempty"`
+		RuntimeClassName   string          `json:"runtimeClassName,omitempty"`
+		HostNetwork        bool            `json:"hostNetwork,omitempty"`
+	}
+
+	podContainer struct {
+		Name            string            `json:"name"`
+		Image           string            `json:"image"`
+		ImagePullPolicy string            `json:"imagePullPolicy,omitempty"`
+		Command         []string          `json:"command,omitempty"`
+		Args            []string          `json:"args,omitempty"`
+		WorkingDir      string            `json:"workingDir,omitempty"`
+		Env             []envVar          `json:"env,omitempty"`
+		VolumeMounts    []volumeMount     `json:"volumeMounts,omitempty"`
+		Resources       *resources        `json:"resources,omitempty"`
+		SecurityContext *containerContext `json:"securityContext,omitempty"`
+		TTY             bool              `json:"tty,omitempty"`
+	}
+
+	envVar struct {
+		Name      string     `json:"name"`
+		Value     string     `json:"value,omitempty"`
+		ValueFrom *envSource `json:"valueFrom,omitempty"`
+	}
+
+	envSource struct {
+		SecretKeyRef *secretKeyRef `json:"secretKeyRef,omitempty"`
+	}
+
+	secretKeyRef struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	}
+
+	volumeMount struct {
+		Name      string `json:"name"`
+		MountPath string `json:"mountPath"`
+		ReadOnly  bool   `json:"readOnly,omitempty"`
+	}
+
+	podVolume struct {
+		Name     string        `json:"name"`
+		HostPath *hostPathSrc  `json:"hostPath,omitempty"`
+		NFS      *nfsVolumeSrc `json:"nfs,omitempty"`
+	}
+
+	hostPathSrc struct {
+		Path string `json:"path"`
+		Type string `json:"type,omitempty"`
+	}
+
+	nfsVolumeSrc struct {
+		Server   string `json:"server"`
+		Path     string `json:"path"`
+		ReadOnly bool   `json:"readOnly,omitempty"`
+	}
+
+	resources struct {
+		Limits map[string]string `json:"limits,omitempty"`
+	}
+
+	containerContext struct {
+		Privileged *bool  `json:"privileged,omitempty"`
+		RunAsUser  *int64 `json:"runAsUser,omitempty"`
+		RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+
+		Capabilities             *capabilities    `json:"capabilities,omitempty"`
+		SeccompProfile           *securityProfile `json:"seccompProfile,omitempty"`
+		AppArmorProfile          *securityProfile `json:"appArmorProfile,omitempty"`
+		AllowPrivilegeEscalation *bool            `json:"allowPrivilegeEscalation,omitempty"`
+		ReadOnlyRootFilesystem   *bool            `json:"readOnlyRootFilesystem,omitempty"`
+		WindowsOptions           *windowsOptions  `json:"windowsOptions,omitempty"`
+	}
+
+	windowsOptions struct {
+		HostProcess *bool `json:"hostProcess,omitempty"`
+	}
+
+	capabilities struct {
+		Add  []string `json:"add,omitempty"`
+		Drop []string `json:"drop,omitempty"`
+	}
+
+	securityProfile struct {
+		Type             string `json:"type"`
+		LocalhostProfile string `json:"localhostProfile,omitempty"`
+	}
+
+	podSecContext struct {
+		SupplementalGroups []int64 `json:"supplementalGroups,omitempty"`
+	}
+
+	podDNSConfig struct {
+		Nameservers []string `json:"nameservers,omitempty"`
+		Searches    []string `json:"searches,omitempty"`
+	}
+
+	podHostAlias struct {
+		IP        string   `json:"ip"`
+		Hostnames []string `json:"hostnames"`
+	}
+
+	podToleration struct {
+		Key      string `json:"key,omitempty"`
+		Operator string `json:"operator,omitempty"`
+		Value    string `json:"value,omitempty"`
+		Effect   string `json:"effect,omitempty"`
+	}
+
+	objectRef struct {
+		Name string `json:"name"`
+	}
+
+	podStatus struct {
+		Phase             string            `json:"phase,omitempty"`
+		PodIP             string            `json:"podIP,omitempty"`
+		Message           string            `json:"message,omitempty"`
+		ContainerStatuses []containerStatus `json:"containerStatuses,omitempty"`
+	}
+
+	containerStatus struct {
+		Name  string         `json:"name"`
+		State containerState `json:"state"`
+	}
+
+	containerState struct {
+		Waiting *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"waiting,omitempty"`
+		Running *struct {
+			StartedAt string `json:"startedAt"`
+		} `json:"running,omitempty"`
+		Terminated *struct {
+			ExitCode int    `json:"exitCode"`
+			Reason   string `json:"reason"`
+			Message  string `json:"message"`
+		} `json:"terminated,omitempty"`
+	}
+
+	secret struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Metadata   objectMeta        `json:"metadata"`
+		Type       string            `json:"type"`
+		Data       map[string]string `json:"data"`
+	}
+)
+
+// step returns the status of the step container.
+func (s *podStatus) step() *containerStatus {
+	for i := range s.ContainerStatuses {
+		if s.ContainerStatuses[i].Name == stepContainer {
+			return &s.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// podName returns a valid pod name for the attempt of the step, unique per
+// stage, so a retried step does not conflict with the pod of the previous
+// attempt while it terminates.
+func podName(stage, step string, attempt int) string {
+	suffix := ""
+	if attempt > 1 {
+		suffix = fmt.Sprintf("-%d", attempt)
+	}
+	name := strings.Trim(invalidName.ReplaceAllString(strings.ToLower(stage+"-"+step), "-"), "-")
+	if max := 40 - len(suffix); len(name) > max { //nolint:gomnd
+		name = strings.Trim(name[:max], "-")
+	}
+	return fmt.Sprintf("lite-engine-%s-%s%s", name, shortHash(stage+"/"+step), suffix)
+}
+
+// toPod returns the pod of the step. The host paths and empty dirs of the
+// stage are mounted from the node of the engine, so the steps share the
+// workspace like the containers on the docker daemon.
+func (k *Kubernetes) toPod(cfg *spec.PipelineConfig, step *spec.Step, name string) *pod {
+	p := &pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: objectMeta{
+			Name:      name,
+			Namespace: k.opts.Namespace,
+			Labels:    labelValues(labels.Merge(cfg.Labels, step.Labels, map[string]string{labels.Step: step.ID, podLabel: name})),
+		},
+		Spec: podSpec{
+			NodeName:           k.opts.NodeName,
+			ServiceAccountName: k.opts.ServiceAccount,
+			RestartPolicy:      "Never",
+			Tolerations:        k.tolerations(),
+		},
+	}
+	if step.OCIRuntime != spec.OCIRuntimeDefault {
+		p.Spec.RuntimeClassName = step.OCIRuntime
+	}
+
+	c := podContainer{
+		Name:            stepContainer,
+		Image:           step.Image,
+		ImagePullPolicy: toPullPolicy(step.Pull),
+		Command:         step.Entrypoint,
+		Args:            step.Command,
+		WorkingDir:      step.WorkingDir,
+		Env:             toEnv(step, name),
+		TTY:             cfg.TTY,
+	}
+	if step.Privileged {
+		c.SecurityContext = &containerContext{Privileged: &step.Privileged}
+	}
+	if uid, gid, ok := toUser(step.User); ok {
+		if c.SecurityContext == nil {
+			c.SecurityContext = &containerContext{}
+		}
+		c.SecurityContext.RunAsUser, c.SecurityContext.RunAsGroup = uid, gid
+	}
+	if sc := step.SecurityContext; sc != nil {
+		if c.SecurityContext == nil {
+			c.SecurityContext = &containerContext{}
+		}
+		setSecurityContext(c.SecurityContext, sc)
+	}
+	// a HostProcess container runs in the network of the windows node
+	if step.Isolation == spec.IsolationHostProcess {
+		if c.SecurityContext == nil {
+			c.SecurityContext = &containerContext{}
+		}
+		hostProcess := true
+		c.SecurityContext.WindowsOptions = &windowsOptions{HostProcess: &hostProcess}
+		p.Spec.HostNetwork = true
+	}
+	if limits := toLimits(step); len(limits) > 0 {
+		c.Resources = &resources{Limits: limits}
+	}
+	if groups := toGroups(step.GroupAdd); len(groups) > 0 {
+		p.Spec.SecurityContext = &podSecContext{SupplementalGroups: groups}
+	}
+	if len(step.DNS) > 0 || len(step.DNSSearch) > 0 {
+		p.Spec.DNSConfig = &podDNSConfig{Nameservers: step.DNS, Searches: step.DNSSearch}
+	}
+	p.Spec.HostAliases = toHostAliases(step.ExtraHosts)
+
+	for i, m := range step.Volumes {
+		vol, readOnly, ok := k.toVolume(cfg, m.Name)
+		if !ok {
+			continue
+		}
+		vol.Name = fmt.Sprintf("volume-%d", i)
+		p.Spec.Volumes = append(p.Spec.Volumes, vol)
+		c.VolumeMounts = append(c.VolumeMounts, volumeMount{Name: vol.Name, MountPath: m.Path, ReadOnly: readOnly})
+	}
+	p.Spec.Containers = []podContainer{c}
+	return p
+}
+
+// toVolume returns the pod volume of the stage volume with the name. The
+// docker socket is not mounted, there is no docker daemon on the nodes.
+func (k *Kubernetes) toVolume(cfg *spec.PipelineConfig, name string) (vol podVolume, readOnly, ok bool) {
+	for _, v := range cfg.Volumes {
+		switch {
+		case v == nil:
+		case v.HostPath != nil && v.HostPath.Name == name:
+			if v.HostPath.Path == dockerSocket {
+				return vol, false, false
+			}
+			vol.HostPath = &hostPathSrc{Path: v.HostPath.Path, Type: "DirectoryOrCreate"}
+			return vol, v.HostPath.ReadOnly, true
+		case v.EmptyDir != nil && v.EmptyDir.Name == name:
+			vol.HostPath = &hostPathSrc{Path: k.emptyDirPath(v.EmptyDir), Type: "DirectoryOrCreate"}
+			return vol, false, true
+		case v.NetworkShare != nil && v.NetworkShare.Name == name:
+			if !strings.EqualFold(v.NetworkShare.Type, spec.ShareNFS) {
+				return vol, false, false
+			}
+			vol.NFS = &nfsVolumeSrc{
+				Server:   v.NetworkShare.Server,
+				Path:     "/" + strings.TrimPrefix(v.NetworkShare.Share, "/"),
+				ReadOnly: v.NetworkShare.ReadOnly,
+			}
+			return vol, v.NetworkShare.ReadOnly, true
+		}
+	}
+	return vol, false, false
+}
+
+// emptyDirPath returns the directory of the empty dir volume on the node.
+func (k *Kubernetes) emptyDirPath(v *spec.VolumeEmptyDir) string {
+	return filepath.Join(k.opts.VolumeDir, v.ID)
+}
+
+func (k *Kubernetes) tolerations() []podToleration {
+	var out []podToleration
+	for _, t := range k.opts.Tolerations {
+		key, effect, _ := strings.Cut(t, ":")
+		out = append(out, podToleration{Key: key, Operator: "Exists", Effect: effect})
+	}
+	return out
+}
+
+// toEnv returns the environment of the step, the secrets are read from the
+// step secret so they are not visible in the pod spec.
+func toEnv(step *spec.Step, secretName string) []envVar {
+	env := make([]envVar, 0, len(step.Envs)+len(step.Secrets))
+	for k, v := range step.Envs {
+		env = append(env, envVar{Name: k, Value: v})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+	for _, sec := range step.Secrets {
+		env = append(env, envVar{Name: sec.Env, ValueFrom: &envSource{
+			SecretKeyRef: &secretKeyRef{Name: secretName, Key: sec.Env},
+		}})
+	}
+	return env
+}
+
+// toSecret returns the secret holding the secrets of the step.
+func toSecret(namespace, name string, podLabels map[string]string, secrets []*spec.Secret) *secret {
+	data := make(map[string]string, len(secrets))
+	for _, sec := range secrets {
+		data[sec.Env] = base64.StdEncoding.EncodeToString(sec.Data)
+	}
+	return &secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   objectMeta{Name: name, Namespace: namespace, Labels: podLabels},
+		Type:       "Opaque",
+		Data:       data,
+	}
+}
+
+func toPullPolicy(p spec.PullPolicy) string {
+	switch p {
+	case spec.PullAlways:
+		return "Always"
+	case spec.PullNever:
+		return "Never"
+	case spec.PullIfNotExists:
+		return "IfNotPresent"
+	default:
+		return ""
+	}
+}
+
+// toUser returns the numeric uid and gid of the user, the user names of
+// the image cannot be resolved by Kubernetes.
+func toUser(user string) (uid, gid *int64, ok bool) {
+	if user == "" {
+		return nil, nil, false
+	}
+	u, g, hasGroup := strings.Cut(user, ":")
+	id, err := strconv.ParseInt(u, 10, 64)
+	if err != nil {
+		return nil, nil, false
+	}
+	uid = &id
+	if hasGroup {
+		if id, err := strconv.ParseInt(g, 10, 64); err == nil {
+			gid = &id
+		}
+	}
+	return uid, gid, true
+}
+
+func toGroups(groups []string) []int64 {
+	var out []int64
+	for _, g := range groups {
+		if id, err := strconv.ParseInt(g, 10, 64); err == nil {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// toLimits returns the resource limits of the step, the cpu quota of
+// docker is converted to millicores.
+func toLimits(step *spec.Step) map[string]string {
+	limits := make(map[string]string)
+	if step.MemLimit > 0 {
+		limits["memory"] = strconv.FormatInt(step.MemLimit, 10)
+	}
+	if step.CPUQuota > 0 {
+		period := step.CPUPeriod
+		if period == 0 {
+			period = 100000 //nolint:gomnd // the default cfs period of docker
+		}
+		limits["cpu"] = fmt.Sprintf("%dm", step.CPUQuota*1000/period) //nolint:gomnd
+	}
+	return limits
+}
+
+// toHostAliases converts the extra hosts, in the host:ip format of docker.
+func toHostAliases(hosts []string) []podHostAlias {
+	var out []podHostAlias
+	for _, h := range hosts {
+		host, ip, ok := strings.Cut(h, ":")
+		if !ok {
+			continue
+		}
+		out = append(out, podHostAlias{IP: ip, Hostnames: []string{host}})
+	}
+	return out
+}
+
+// labelValues drops the labels which are not valid label values, eg. the
+// long step ids.
+func labelValues(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		if len(v) <= 63 && validLabelValue.MatchString(v) { //nolint:gomnd
+			out[k] = v
+		}
+	}
+	return out
+}
+
+var validLabelValue = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+
+// toPullSecret returns the docker config secret of the registry auth.
+func toPullSecret(namespace, name string, podLabels map[string]string, auth *spec.Auth) *secret {
+	creds := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	config, _ := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			auth.Address: map[string]string{"auth": creds},
+		},
+	})
+	return &secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   objectMeta{Name: name, Namespace: namespace, Labels: podLabels},
+		Type:       "kubernetes.io/dockerconfigjson",
+		Data:       map[string]string{".dockerconfigjson": base64.StdEncoding.EncodeToString(config)},
+	}
+}
+
+// setSecurityContext sets the security context of the step on the security
+// context of its container.
+func setSecurityContext(c *containerContext, sc *spec.SecurityContext) {
+	if len(sc.CapAdd) > 0 || len(sc.CapDrop) > 0 {
+		c.Capabilities = &capabilities{Add: trimCapPrefix(sc.CapAdd), Drop: trimCapPrefix(sc.CapDrop)}
+	}
+	c.SeccompProfile = toSecurityProfile(sc.Seccomp)
+	c.AppArmorProfile = toSecurityProfile(sc.AppArmor)
+	if sc.NoNewPrivileges {
+		allow := false
+		c.AllowPrivilegeEscalation = &allow
+	}
+	if sc.ReadOnlyRootfs {
+		c.ReadOnlyRootFilesystem = &sc.ReadOnlyRootfs
+	}
+}
+
+// trimCapPrefix returns the capabilities without their CAP_ prefix, as
+// named by kubernetes.
+func trimCapPrefix(caps []string) []string {
+	var out []string
+	for _, c := range caps {
+		out = append(out, strings.TrimPrefix(strings.ToUpper(c), "CAP_"))
+	}
+	return out
+}
+
+func toSecurityProfile(profile string) *securityProfile {
+	switch profile {
+	case "":
+		return nil
+	case spec.ProfileUnconfined:
+		return &securityProfile{Type: "Unconfined"}
+	case spec.ProfileRuntimeDefault:
+		return &securityProfile{Type: "RuntimeDefault"}
+	}
+	return &securityProfile{Type: "Localhost", LocalhostProfile: profile}
+}
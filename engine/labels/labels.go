@@ -0,0 +1,61 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package labels defines the labels applied to the docker resources created
+// by the engine, so they can be queried and cleaned up by external tools.
+package labels
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harness/lite-engine/version"
+)
+
+// The labels applied to all the containers, volumes and networks.
+const (
+	Prefix   = "io.harness.lite-engine."
+	Account  = Prefix + "account"
+	Pipeline = Prefix + "pipeline"
+	Stage    = Prefix + "stage"
+	Step     = Prefix + "step" // containers only
+	Version  = Prefix + "version"
+)
+
+// ForStage returns the labels of the resources of a stage. Empty values
+// are omitted.
+func ForStage(account, pipeline, stage string) map[string]string {
+	labels := map[string]string{Version: version.Version}
+	for k, v := range map[string]string{Account: account, Pipeline: pipeline, Stage: stage} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// Merge returns the union of the labels, the values of the later maps
+// take precedence. It returns nil if all the maps are empty.
+func Merge(maps ...map[string]string) map[string]string {
+	var out map[string]string
+	for _, m := range maps {
+		for k, v := range m {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// ParseSelector parses a label selector of the form key=value, or key to
+// match the resources with the label set to any value.
+func ParseSelector(s string) (key, value string, err error) {
+	key, value, _ = strings.Cut(s, "=")
+	if strings.TrimSpace(key) == "" {
+		return "", "", fmt.Errorf("invalid label selector %q", s)
+	}
+	return key, value, nil
+}
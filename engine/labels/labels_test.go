@@ -0,0 +1,37 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/version"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForStage(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		Account: "acct",
+		Stage:   "stage-1",
+		Version: version.Version,
+	}, ForStage("acct", "", "stage-1"))
+}
+
+func TestMerge(t *testing.T) {
+	assert.Nil(t, Merge(nil, map[string]string{}))
+	assert.Equal(t, map[string]string{"a": "1", "b": "3", Step: "s"},
+		Merge(map[string]string{"a": "1", "b": "2"}, nil, map[string]string{"b": "3", Step: "s"}))
+}
+
+func TestParseSelector(t *testing.T) {
+	key, value, err := ParseSelector(Stage + "=abc")
+	assert.NoError(t, err)
+	assert.Equal(t, Stage, key)
+	assert.Equal(t, "abc", value)
+
+	key, value, err = ParseSelector(Step)
+	assert.NoError(t, err)
+	assert.Equal(t, Step, key)
+	assert.Empty(t, value)
+
+	_, _, err = ParseSelector("=abc")
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditHook writes an audit log entry for each lifecycle event.
+type AuditHook struct{}
+
+// NewAuditHook returns a new AuditHook.
+func NewAuditHook() *AuditHook {
+	return &AuditHook{}
+}
+
+func (a *AuditHook) Name() string { return "audit" }
+
+func (a *AuditHook) OnSetup(ctx context.Context, r *api.SetupRequest) error {
+	audit(ctx, "setup").
+		WithField("network", r.Network.ID).
+		WithField("volumes", len(r.Volumes)).
+		Infoln("audit: stage setup")
+	return nil
+}
+
+func (a *AuditHook) OnStepStart(ctx context.Context, r *api.StartStepRequest) error {
+	audit(ctx, "step_start").
+		WithField("id", r.ID).
+		WithField("name", r.Name).
+		WithField("kind", r.Kind.String()).
+		WithField("image", r.Image).
+		WithField("stage_runtime_id", r.StageRuntimeID).
+		Infoln("audit: step started")
+	return nil
+}
+
+func (a *AuditHook) OnStepEnd(ctx context.Context, r *api.StartStepRequest, res *StepResult) error {
+	entry := audit(ctx, "step_end").
+		WithField("id", r.ID).
+		WithField("name", r.Name).
+		WithField("exit_code", res.ExitCode).
+		WithField("oom_killed", res.OOMKilled).
+		WithField("duration", res.Duration)
+	if res.Err != nil {
+		entry = entry.WithError(res.Err)
+	}
+	entry.Infoln("audit: step completed")
+	return nil
+}
+
+func (a *AuditHook) OnDestroy(ctx context.Context, r *api.DestroyRequest) error {
+	audit(ctx, "destroy").
+		WithField("stage_runtime_id", r.StageRuntimeID).
+		Infoln("audit: stage destroyed")
+	return nil
+}
+
+func audit(ctx context.Context, event string) *logrus.Entry {
+	return logrus.WithContext(ctx).WithField("audit", true).WithField("event", event)
+}
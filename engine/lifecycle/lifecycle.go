@@ -0,0 +1,134 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package lifecycle runs the hooks registered for the stage and step
+// lifecycle events of the engine.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/sirupsen/logrus"
+)
+
+// StepLifecycleHook is notified of the lifecycle events of the stages and
+// steps executed by the engine. Errors returned by the hooks are logged and
+// do not affect the execution.
+type StepLifecycleHook interface {
+	// Name returns the name of the hook used in the logs.
+	Name() string
+	// OnSetup is called once the stage is set up.
+	OnSetup(ctx context.Context, r *api.SetupRequest) error
+	// OnStepStart is called before the step is executed.
+	OnStepStart(ctx context.Context, r *api.StartStepRequest) error
+	// OnStepEnd is called once the step completed.
+	OnStepEnd(ctx context.Context, r *api.StartStepRequest, res *StepResult) error
+	// OnDestroy is called before the stage resources are destroyed.
+	OnDestroy(ctx context.Context, r *api.DestroyRequest) error
+}
+
+// StepResult is the outcome of a step.
+type StepResult struct {
+	Exited    bool
+	ExitCode  int
+	OOMKilled bool
+	Err       error
+	Duration  time.Duration
+}
+
+// Failed returns whether the step failed.
+func (r *StepResult) Failed() bool {
+	return r.Err != nil || r.ExitCode != 0 || r.OOMKilled
+}
+
+// BaseHook implements StepLifecycleHook with no-op methods. It can be
+// embedded by the hooks which need only some of the events.
+type BaseHook struct{}
+
+func (BaseHook) OnSetup(context.Context, *api.SetupRequest) error { return nil }
+
+func (BaseHook) OnStepStart(context.Context, *api.StartStepRequest) error { return nil }
+
+func (BaseHook) OnStepEnd(context.Context, *api.StartStepRequest, *StepResult) error { return nil }
+
+func (BaseHook) OnDestroy(context.Context, *api.DestroyRequest) error { return nil }
+
+var (
+	mu    sync.RWMutex
+	hooks []StepLifecycleHook
+)
+
+// Register registers the hook. Hooks are called in the order of registration.
+func Register(h StepLifecycleHook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// Lookup returns the registered hook with the name, nil if none.
+func Lookup(name string) StepLifecycleHook {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range hooks {
+		if h.Name() == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// Reset removes all the registered hooks.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = nil
+}
+
+// Setup notifies the hooks that the stage is set up.
+func Setup(ctx context.Context, r *api.SetupRequest) {
+	notify(ctx, "setup", func(h StepLifecycleHook) error { return h.OnSetup(ctx, r) })
+}
+
+// StepStart notifies the hooks that the step starts.
+func StepStart(ctx context.Context, r *api.StartStepRequest) {
+	notify(ctx, "step_start", func(h StepLifecycleHook) error { return h.OnStepStart(ctx, r) })
+}
+
+// StepEnd notifies the hooks that the step completed.
+func StepEnd(ctx context.Context, r *api.StartStepRequest, res *StepResult) {
+	notify(ctx, "step_end", func(h StepLifecycleHook) error { return h.OnStepEnd(ctx, r, res) })
+}
+
+// Destroy notifies the hooks that the stage resources are destroyed.
+func Destroy(ctx context.Context, r *api.DestroyRequest) {
+	notify(ctx, "destroy", func(h StepLifecycleHook) error { return h.OnDestroy(ctx, r) })
+}
+
+func notify(ctx context.Context, event string, fn func(StepLifecycleHook) error) {
+	mu.RLock()
+	registered := hooks
+	mu.RUnlock()
+	for _, h := range registered {
+		if err := call(h, fn); err != nil {
+			logrus.WithContext(ctx).WithError(err).
+				WithField("hook", h.Name()).
+				WithField("event", event).
+				Warnln("lifecycle hook failed")
+		}
+	}
+}
+
+// call runs the hook, recovering from its panics.
+func call(h StepLifecycleHook, fn func(StepLifecycleHook) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(h)
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/docker"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHook struct {
+	BaseHook
+	events []string
+}
+
+func (h *recordingHook) Name() string { return "recording" }
+
+func (h *recordingHook) OnStepStart(_ context.Context, r *api.StartStepRequest) error {
+	h.events = append(h.events, "start:"+r.ID)
+	return nil
+}
+
+func (h *recordingHook) OnStepEnd(_ context.Context, r *api.StartStepRequest, _ *StepResult) error {
+	h.events = append(h.events, "end:"+r.ID)
+	return errors.New("failed")
+}
+
+type panickingHook struct{ BaseHook }
+
+func (panickingHook) Name() string { return "panicking" }
+
+func (panickingHook) OnStepStart(context.Context, *api.StartStepRequest) error { panic("boom") }
+
+func TestNotify(t *testing.T) {
+	defer Reset()
+	rec := &recordingHook{}
+	Register(panickingHook{})
+	Register(rec)
+
+	ctx := context.Background()
+	r := &api.StartStepRequest{ID: "step1"}
+	StepStart(ctx, r)
+	StepEnd(ctx, r, &StepResult{})
+	Setup(ctx, &api.SetupRequest{})
+	Destroy(ctx, &api.DestroyRequest{})
+	assert.Equal(t, []string{"start:step1", "end:step1"}, rec.events)
+}
+
+func TestMetricsHook(t *testing.T) {
+	defer Reset()
+	assert.Nil(t, Metrics())
+	assert.NoError(t, Configure([]string{"metrics", "audit"}, nil))
+
+	ctx := context.Background()
+	r := &api.StartStepRequest{ID: "step1"}
+	for _, res := range []*StepResult{
+		{Exited: true, Duration: time.Second},
+		{Exited: true, ExitCode: 1, Duration: time.Second},
+		{Exited: true, ExitCode: 137, OOMKilled: true},
+		{Err: errors.New("timeout")},
+	} {
+		StepStart(ctx, r)
+		StepEnd(ctx, r, res)
+	}
+	StepStart(ctx, r)
+
+	assert.Equal(t, &api.StepMetrics{Started: 5, Running: 1, Succeeded: 1, Failed: 3, OOMKilled: 1, DurationMs: 2000}, Metrics())
+}
+
+func TestConfigure(t *testing.T) {
+	defer Reset()
+	assert.Error(t, Configure([]string{"unknown"}, nil))
+	assert.Error(t, Configure(nil, []string{"/does/not/exist.so"}))
+}
+
+type fakePhases map[string]*docker.StepPhases
+
+func (f fakePhases) StepPhases(stepID string) *docker.StepPhases { return f[stepID] }
+
+func TestTimelineHook(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	h := NewTimelineHook(fakePhases{"build": {ContainerID: "c1", Pull: 2 * time.Second, Create: time.Second, Run: 8 * time.Second}})
+	h.now = func() time.Time { return now }
+	ctx := context.Background()
+	assert.Nil(t, h.Timeline())
+
+	assert.NoError(t, h.OnSetup(ctx, &api.SetupRequest{}))
+	build := &api.StartStepRequest{ID: "build", Name: "Build", Image: "golang"}
+	test := &api.StartStepRequest{ID: "test", DependsOn: []string{"build"}}
+	assert.NoError(t, h.OnStepStart(ctx, build))
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, h.OnStepEnd(ctx, build, &StepResult{Exited: true, Duration: 10 * time.Second}))
+	assert.NoError(t, h.OnStepStart(ctx, test))
+	now = now.Add(5 * time.Second)
+
+	tl := h.Timeline()
+	assert.Nil(t, tl.EndedAt)
+	assert.Equal(t, int64(15000), tl.DurationMs)
+	assert.Len(t, tl.Steps, 2)
+	assert.Equal(t, "c1", tl.Steps[0].ContainerID)
+	assert.Equal(t, "succeeded", tl.Steps[0].Status)
+	assert.Equal(t, []*api.TimelinePhase{
+		{Name: "pull", DurationMs: 2000},
+		{Name: "create", DurationMs: 1000},
+		{Name: "execute", DurationMs: 5000},
+		{Name: "post_process", DurationMs: 2000},
+	}, tl.Steps[0].Phases)
+	assert.Equal(t, "running", tl.Steps[1].Status)
+	assert.Equal(t, int64(5000), tl.Steps[1].DurationMs)
+
+	assert.NoError(t, h.OnStepEnd(ctx, test, &StepResult{Exited: true, ExitCode: 1, Duration: 5 * time.Second}))
+	assert.NoError(t, h.OnDestroy(ctx, &api.DestroyRequest{}))
+	now = now.Add(time.Minute)
+	tl = h.Timeline()
+	assert.NotNil(t, tl.EndedAt)
+	assert.Equal(t, int64(15000), tl.DurationMs)
+	assert.Equal(t, "failed", tl.Steps[1].Status)
+	assert.Equal(t, []string{"build"}, tl.Steps[1].DependsOn)
+
+	// the steps of the next stage start a new timeline
+	assert.NoError(t, h.OnStepStart(ctx, test))
+	assert.Len(t, h.Timeline().Steps, 1)
+}
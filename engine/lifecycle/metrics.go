@@ -0,0 +1,91 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/metrics"
+)
+
+var (
+	stepsTotal = metrics.NewCounter("lite_engine_steps_total",
+		"The steps executed by the engine, by kind and status.", "kind", "status")
+	stepDuration = metrics.NewHistogram("lite_engine_step_duration_seconds",
+		"The duration of the steps, by kind and status.", metrics.DurationBuckets, "kind", "status")
+	stepsInFlight = metrics.NewGauge("lite_engine_steps_in_flight",
+		"The steps running, by kind.", "kind")
+)
+
+// MetricsHook counts the steps executed by the engine.
+type MetricsHook struct {
+	BaseHook
+
+	mu      sync.Mutex
+	metrics api.StepMetrics
+}
+
+// NewMetricsHook returns a new MetricsHook.
+func NewMetricsHook() *MetricsHook {
+	return &MetricsHook{}
+}
+
+func (m *MetricsHook) Name() string { return "metrics" }
+
+func (m *MetricsHook) OnStepStart(_ context.Context, r *api.StartStepRequest) error {
+	stepsInFlight.Add(1, r.Kind.String())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics.Started++
+	m.metrics.Running++
+	return nil
+}
+
+func (m *MetricsHook) OnStepEnd(_ context.Context, r *api.StartStepRequest, res *StepResult) error {
+	status := "succeeded"
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics.Running--
+	switch {
+	case res.OOMKilled:
+		m.metrics.OOMKilled++
+		m.metrics.Failed++
+		status = "oom_killed"
+	case res.Failed():
+		m.metrics.Failed++
+		status = "failed"
+	default:
+		m.metrics.Succeeded++
+	}
+	m.metrics.DurationMs += res.Duration.Milliseconds()
+
+	kind := r.Kind.String()
+	stepsInFlight.Add(-1, kind)
+	stepsTotal.Inc(kind, status)
+	stepDuration.Observe(res.Duration.Seconds(), kind, status)
+	return nil
+}
+
+// Metrics returns the step counters.
+func (m *MetricsHook) Metrics() api.StepMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.metrics
+}
+
+// Metrics returns the step counters of the registered metrics hook, if any.
+func Metrics() *api.StepMetrics {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range hooks {
+		if m, ok := h.(*MetricsHook); ok {
+			metrics := m.Metrics()
+			return &metrics
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// pluginSymbol is the name of the variable exported by the hook plugins.
+const pluginSymbol = "Hook"
+
+// builtins are the hooks shipped with the engine.
+var builtins = map[string]func() StepLifecycleHook{
+	"metrics": func() StepLifecycleHook { return NewMetricsHook() },
+	"audit":   func() StepLifecycleHook { return NewAuditHook() },
+}
+
+// Configure registers the built-in hooks with the given names and the hooks
+// of the Go plugins at the given paths. A plugin must export a variable named
+// Hook implementing StepLifecycleHook, eg.
+//
+//	var Hook lifecycle.StepLifecycleHook = &myHook{}
+func Configure(names, plugins []string) error {
+	for _, name := range names {
+		newHook, ok := builtins[name]
+		if !ok {
+			return fmt.Errorf("unknown lifecycle hook %q", name)
+		}
+		Register(newHook())
+	}
+	for _, path := range plugins {
+		h, err := load(path)
+		if err != nil {
+			return fmt.Errorf("failed to load lifecycle hook plugin %s: %w", path, err)
+		}
+		Register(h)
+	}
+	return nil
+}
+
+func load(path string) (StepLifecycleHook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	switch h := sym.(type) {
+	case *StepLifecycleHook:
+		return *h, nil
+	case StepLifecycleHook:
+		return h, nil
+	}
+	return nil, fmt.Errorf("symbol %s of type %T does not implement StepLifecycleHook", pluginSymbol, sym)
+}
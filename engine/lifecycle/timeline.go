@@ -0,0 +1,169 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/docker"
+)
+
+const (
+	timelineRunning   = "running"
+	timelineSucceeded = "succeeded"
+	timelineFailed    = "failed"
+)
+
+// PhaseSource returns the time spent by the engine in the phases of a step
+// once it ran.
+type PhaseSource interface {
+	StepPhases(stepID string) *docker.StepPhases
+}
+
+// TimelineHook records the timeline of the steps of the current stage. The
+// timeline of a stage is kept once it is destroyed, until the next setup.
+type TimelineHook struct {
+	BaseHook
+
+	phases PhaseSource
+	now    func() time.Time
+
+	mu    sync.Mutex
+	stage *api.TimelineResponse
+	steps map[string]*api.TimelineStep // the last execution of the steps by id
+}
+
+// NewTimelineHook returns a new TimelineHook, the phases of the steps are
+// not recorded if phases is nil.
+func NewTimelineHook(phases PhaseSource) *TimelineHook {
+	return &TimelineHook{phases: phases, now: time.Now}
+}
+
+func (t *TimelineHook) Name() string { return "timeline" }
+
+func (t *TimelineHook) OnSetup(context.Context, *api.SetupRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset()
+	return nil
+}
+
+// reset starts the timeline of a new stage.
+func (t *TimelineHook) reset() {
+	t.stage = &api.TimelineResponse{StartedAt: t.now()}
+	t.steps = make(map[string]*api.TimelineStep)
+}
+
+func (t *TimelineHook) OnStepStart(_ context.Context, r *api.StartStepRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start(r, t.now())
+	return nil
+}
+
+func (t *TimelineHook) start(r *api.StartStepRequest, at time.Time) *api.TimelineStep {
+	if t.stage == nil || t.stage.EndedAt != nil {
+		t.reset()
+	}
+	s := &api.TimelineStep{ID: r.ID, Name: r.Name, Image: r.Image, DependsOn: r.DependsOn,
+		StartedAt: at, Status: timelineRunning}
+	t.stage.Steps = append(t.stage.Steps, s)
+	t.steps[r.ID] = s
+	return s
+}
+
+func (t *TimelineHook) OnStepEnd(_ context.Context, r *api.StartStepRequest, res *StepResult) error {
+	var phases *docker.StepPhases
+	if t.phases != nil {
+		phases = t.phases.StepPhases(r.ID)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s, ok := t.steps[r.ID]
+	if !ok || s.EndedAt != nil {
+		s = t.start(r, now.Add(-res.Duration))
+	}
+	s.EndedAt = &now
+	s.DurationMs = res.Duration.Milliseconds()
+	s.Status = timelineSucceeded
+	if res.Failed() {
+		s.Status = timelineFailed
+	}
+	if phases != nil {
+		s.ContainerID = phases.ContainerID
+		s.Phases = stepPhases(phases, res.Duration)
+	}
+	return nil
+}
+
+// stepPhases splits the duration of the step in the phases of the engine,
+// the post-processing is the time spent outside of the engine.
+func stepPhases(p *docker.StepPhases, total time.Duration) []*api.TimelinePhase {
+	var phases []*api.TimelinePhase
+	add := func(name string, d time.Duration) {
+		if d > 0 {
+			phases = append(phases, &api.TimelinePhase{Name: name, DurationMs: d.Milliseconds()})
+		}
+	}
+	add("pull", p.Pull)
+	add("create", p.Create)
+	add("execute", p.Run-p.Pull-p.Create)
+	add("post_process", total-p.Run)
+	return phases
+}
+
+func (t *TimelineHook) OnDestroy(context.Context, *api.DestroyRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stage != nil && t.stage.EndedAt == nil {
+		now := t.now()
+		t.stage.EndedAt = &now
+	}
+	return nil
+}
+
+// Timeline returns a copy of the timeline of the current or of the last
+// stage, nil if no stage was set up. The durations of the running steps and
+// of the running stage are up to now.
+func (t *TimelineHook) Timeline() *api.TimelineResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stage == nil {
+		return nil
+	}
+	now := t.now()
+	out := *t.stage
+	out.Steps = make([]*api.TimelineStep, len(t.stage.Steps))
+	for i, s := range t.stage.Steps {
+		c := *s
+		if c.EndedAt == nil {
+			c.DurationMs = now.Sub(c.StartedAt).Milliseconds()
+		}
+		out.Steps[i] = &c
+	}
+	end := now
+	if out.EndedAt != nil {
+		end = *out.EndedAt
+	}
+	out.DurationMs = end.Sub(out.StartedAt).Milliseconds()
+	return &out
+}
+
+// Timeline returns the timeline of the registered timeline hook, if any.
+func Timeline() *api.TimelineResponse {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range hooks {
+		if t, ok := h.(*TimelineHook); ok {
+			return t.Timeline()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/harness/lite-engine/engine/docker"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
+)
+
+const snapshotPermissions = 0600
+
+// stageIDPattern matches the stage ids the snapshots are named after.
+var stageIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// stageSnapshot is the engine state of a paused stage.
+type stageSnapshot struct {
+	PipelineConfig *spec.PipelineConfig `json:"pipeline_config"`
+	Containers     []docker.Container   `json:"containers"`
+}
+
+// SetStateDir sets the directory the engine state of the paused stages is
+// written to. The snapshots are not written if not set.
+func (e *Engine) SetStateDir(dir string) {
+	e.mu.Lock()
+	e.stateDir = dir
+	e.mu.Unlock()
+}
+
+// snapshotFile returns the file the engine state of the paused stage is
+// written to, empty if the engine has no state dir or no stage id is set.
+func (e *Engine) snapshotFile(stageID string) (string, error) {
+	e.mu.Lock()
+	dir := e.stateDir
+	e.mu.Unlock()
+	if dir == "" || stageID == "" {
+		return "", nil
+	}
+	if !stageIDPattern.MatchString(stageID) {
+		return "", fmt.Errorf("invalid stage id %q", stageID)
+	}
+	return filepath.Join(dir, "paused-"+stageID+".json"), nil
+}
+
+// Pause pauses the running step containers of the stage, eg. before an
+// idle VM hibernates. If the engine has a state dir and stageID is set, the
+// engine state is written to it so the stage can be resumed by a restarted
+// engine.
+func (e *Engine) Pause(ctx context.Context, checkpoint bool, stageID string) ([]docker.Container, error) {
+	stateFile, err := e.snapshotFile(stageID)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := e.docker.Pause(ctx, checkpoint)
+	if err != nil {
+		return paused, err
+	}
+	if stateFile == "" {
+		return paused, nil
+	}
+	e.mu.Lock()
+	cfg := e.pipelineConfig
+	e.mu.Unlock()
+	if err = writeSnapshot(stateFile, &stageSnapshot{PipelineConfig: cfg, Containers: e.docker.Containers()}); err != nil {
+		return paused, fmt.Errorf("cannot write the stage snapshot: %w", err)
+	}
+	return paused, nil
+}
+
+// Resume resumes the paused step containers of the stage. If the engine
+// has no containers, eg. it restarted while the stage was paused, the
+// engine state written by the pause of stageID is restored first. The steps
+// of a restored state are not polled, their containers are only resumed and
+// destroyed with the stage.
+func (e *Engine) Resume(ctx context.Context, stageID string) ([]docker.Container, error) {
+	stateFile, err := e.snapshotFile(stageID)
+	if err != nil {
+		return nil, err
+	}
+	if stateFile != "" && len(e.docker.Containers()) == 0 {
+		snapshot, err := readSnapshot(stateFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the stage snapshot: %w", err)
+		}
+		e.restore(snapshot)
+	}
+	resumed, err := e.docker.Resume(ctx)
+	if err != nil {
+		return resumed, err
+	}
+	if stateFile != "" {
+		_ = os.Remove(stateFile)
+	}
+	return resumed, nil
+}
+
+func writeSnapshot(path string, snapshot *stageSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), fileperm.Mode(0700)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, snapshotPermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readSnapshot(path string) (*stageSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := new(stageSnapshot)
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
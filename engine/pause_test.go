@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/docker"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "paused.json")
+	snapshot := &stageSnapshot{
+		PipelineConfig: &spec.PipelineConfig{Network: spec.Network{ID: "net"}},
+		Containers: []docker.Container{
+			{ID: "step1", State: docker.ContainerPaused, Checkpoint: "cp"},
+			{ID: "step2", State: docker.ContainerStopped, SoftStop: true},
+		},
+	}
+	assert.NoError(t, writeSnapshot(path, snapshot))
+
+	got, err := readSnapshot(path)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, got)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = readSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestSnapshotFile(t *testing.T) {
+	e := &Engine{}
+	path, err := e.snapshotFile("stage1")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	dir := t.TempDir()
+	e.SetStateDir(dir)
+	path, err = e.snapshotFile("stage1")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "paused-stage1.json"), path)
+
+	path, err = e.snapshotFile("")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	for _, id := range []string{"../stage1", "/etc/passwd", "a/b", ".."} {
+		_, err = e.snapshotFile(id)
+		assert.Error(t, err, id)
+	}
+}
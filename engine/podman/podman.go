@@ -0,0 +1,70 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package podman runs the container steps with Podman, eg. on the hosts
+// where docker is not allowed. The engine talks to the docker compatible
+// REST API of the podman system service, so the steps, volumes and networks
+// are handled by the docker engine implementation.
+package podman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/harness/lite-engine/engine/docker"
+)
+
+const (
+	containerHostEnv = "CONTAINER_HOST"
+	rootfulSocket    = "/run/podman/podman.sock"
+)
+
+// Opts configures the Podman engine.
+type Opts struct {
+	docker.Opts
+	// Socket is the path of the podman service socket, see SocketPath if not set.
+	Socket string
+}
+
+// NewEnv returns a docker engine using the podman service listening on the
+// socket of the options.
+func NewEnv(opts Opts) (*docker.Docker, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("podman engine is not supported on windows")
+	}
+	socket := opts.Socket
+	if socket == "" {
+		socket = SocketPath()
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return nil, fmt.Errorf("podman service socket is not available, is the podman.socket unit enabled: %w", err)
+	}
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("unix://"+socket),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return docker.New(cli, opts.Opts), nil
+}
+
+// SocketPath returns the path of the podman service socket: the unix socket
+// of CONTAINER_HOST if set, the socket of the user service for a rootless
+// engine, or the socket of the system service.
+func SocketPath() string {
+	if host := os.Getenv(containerHostEnv); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	if os.Geteuid() != 0 {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			return filepath.Join(dir, "podman", "podman.sock")
+		}
+	}
+	return rootfulSocket
+}
@@ -0,0 +1,27 @@
+package podman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketPath(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	assert.Equal(t, "/tmp/podman.sock", SocketPath())
+
+	t.Setenv("CONTAINER_HOST", "ssh://core@host/run/podman/podman.sock")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if os.Geteuid() == 0 {
+		assert.Equal(t, rootfulSocket, SocketPath())
+	} else {
+		assert.Equal(t, filepath.Join("/run/user/1000", "podman", "podman.sock"), SocketPath())
+	}
+}
+
+func TestNewEnvMissingSocket(t *testing.T) {
+	_, err := NewEnv(Opts{Socket: filepath.Join(t.TempDir(), "podman.sock")})
+	assert.Error(t, err)
+}
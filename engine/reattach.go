@@ -0,0 +1,63 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"io"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/pkg/errors"
+)
+
+// StepContainer returns the id of the container of the step and the number
+// of bytes of its logs copied so far, ok is false if the step has no
+// docker container.
+func (e *Engine) StepContainer(stepID string) (id string, logOffset int64, ok bool) {
+	return e.docker.StepContainer(stepID)
+}
+
+// Reattach follows the container of a step started before the engine
+// restarted until it exits, copying its logs after the first logOffset
+// bytes to output. Only the docker backend supports it.
+func (e *Engine) Reattach(ctx context.Context, stepID, containerID string, logOffset int64, output io.Writer) (*runtime.State, error) {
+	e.mu.Lock()
+	k := e.kubernetes
+	c := e.containerd
+	e.mu.Unlock()
+	if k != nil || c != nil {
+		return nil, errors.New("the steps can only be re-attached with the docker backend")
+	}
+	return e.docker.Reattach(ctx, stepID, containerID, logOffset, output)
+}
+
+// SaveState writes the pipeline config and the containers of the stage to
+// the file, so a restarted engine can destroy the stage.
+func (e *Engine) SaveState(stateFile string) error {
+	e.mu.Lock()
+	cfg := e.pipelineConfig
+	e.mu.Unlock()
+	return writeSnapshot(stateFile, &stageSnapshot{PipelineConfig: cfg, Containers: e.docker.Containers()})
+}
+
+// RestoreState restores the pipeline config and the containers of the
+// stage written by SaveState.
+func (e *Engine) RestoreState(stateFile string) error {
+	snapshot, err := readSnapshot(stateFile)
+	if err != nil {
+		return err
+	}
+	e.restore(snapshot)
+	return nil
+}
+
+func (e *Engine) restore(snapshot *stageSnapshot) {
+	e.mu.Lock()
+	if snapshot.PipelineConfig != nil {
+		e.pipelineConfig = snapshot.PipelineConfig
+	}
+	e.mu.Unlock()
+	e.docker.RestoreContainers(snapshot.Containers)
+}
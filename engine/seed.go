@@ -0,0 +1,246 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
+)
+
+const (
+	seedDownloadTimeout = 10 * time.Minute
+	maxSeedSize         = 4 << 30 // 4 GiB
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// seedVolume downloads or decodes the archive of the seed, verifies its
+// checksum and extracts it into the volume directory.
+func seedVolume(ctx context.Context, dir string, seed *spec.VolumeSeed) error {
+	f, err := os.CreateTemp("", "volume-seed-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	src, err := openSeed(ctx, seed)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(src, maxSeedSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxSeedSize {
+		return fmt.Errorf("seed archive exceeds %d bytes", int64(maxSeedSize))
+	}
+	if seed.SHA256 != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, strings.TrimSpace(seed.SHA256)) {
+			return fmt.Errorf("seed checksum mismatch: expected %s, got %s", seed.SHA256, got)
+		}
+	}
+
+	magic := make([]byte, len(zipMagic))
+	if _, err = f.ReadAt(magic, 0); err != nil {
+		return fmt.Errorf("cannot read seed archive: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return extractTarGz(f, dir)
+	case bytes.Equal(magic, zipMagic):
+		return extractZip(f, n, dir)
+	}
+	return fmt.Errorf("seed is neither a tar.gz nor a zip archive")
+}
+
+func openSeed(ctx context.Context, seed *spec.VolumeSeed) (io.ReadCloser, error) {
+	switch {
+	case seed.URL != "" && seed.Data != "":
+		return nil, fmt.Errorf("seed url and data cannot both be set")
+	case seed.Data != "":
+		return io.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(seed.Data))), nil
+	case seed.URL == "":
+		return nil, fmt.Errorf("seed url or data needs to be set")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, seedDownloadTimeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, seed.URL, http.NoBody)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("cannot download seed %s: %s", seed.URL, resp.Status)
+	}
+	return &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	// the symlinks are created last so that no entry is written through them.
+	symlinks := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target, err := seedPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, fileperm.Mode(mode.Perm()|0700)) //nolint:gomnd
+		case tar.TypeReg:
+			err = writeSeedFile(target, tr, mode.Perm())
+		case tar.TypeSymlink:
+			symlinks[target] = hdr.Linkname
+		default:
+			// devices, fifos and hard links are not seeded.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for path, target := range symlinks {
+		if err := writeSeedSymlink(dir, path, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZip(r io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		target, err := seedPath(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if err = os.MkdirAll(target, fileperm.Mode(mode.Perm()|0700)); err != nil { //nolint:gomnd
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeSeedFile(target, rc, mode.Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedPath returns the path of an archive entry in the volume directory,
+// rejecting the entries outside of it.
+func seedPath(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !withinDir(dir, target) {
+		return "", fmt.Errorf("illegal path in seed archive: %s", name)
+	}
+	return target, nil
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writeSeedFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), fileperm.Mode(permissions)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileperm.Mode(perm))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSeedSymlink creates the symlink, if its target is in the volume.
+func writeSeedSymlink(dir, path, target string) error {
+	resolved := target
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(filepath.Dir(path), target)
+	}
+	if filepath.IsAbs(target) || !withinDir(dir, resolved) {
+		return fmt.Errorf("illegal symlink in seed archive: %s -> %s", path, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), fileperm.Mode(permissions)); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	return os.Symlink(target, path)
+}
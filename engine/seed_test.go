@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	name, body, link string
+}
+
+func tarGz(t *testing.T, entries ...tarEntry) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(e.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestSeedVolume(t *testing.T) {
+	archive := tarGz(t,
+		tarEntry{name: "fixtures/data.json", body: `{"ok":true}`},
+		tarEntry{name: "current", link: "fixtures"},
+	)
+	sum := sha256.Sum256(archive)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	err := seedVolume(context.Background(), dir, &spec.VolumeSeed{URL: srv.URL, SHA256: hex.EncodeToString(sum[:])})
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "current", "data.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(data))
+
+	err = seedVolume(context.Background(), t.TempDir(), &spec.VolumeSeed{URL: srv.URL, SHA256: "00"})
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	err = seedVolume(context.Background(), t.TempDir(), &spec.VolumeSeed{URL: srv.URL + "/missing", Data: "x"})
+	assert.ErrorContains(t, err, "cannot both be set")
+}
+
+func TestSeedVolumeZip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("deps/lib.txt")
+	require.NoError(t, err)
+	_, _ = w.Write([]byte("lib"))
+	require.NoError(t, zw.Close())
+
+	dir := t.TempDir()
+	err = seedVolume(context.Background(), dir, &spec.VolumeSeed{Data: base64.StdEncoding.EncodeToString(buf.Bytes())})
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "deps", "lib.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "lib", string(data))
+}
+
+func TestSeedVolumeIllegalPaths(t *testing.T) {
+	for _, entry := range []tarEntry{
+		{name: "../escape.txt", body: "x"},
+		{name: "link", link: "../../etc"},
+		{name: "abs", link: "/etc/passwd"},
+	} {
+		archive := tarGz(t, entry)
+		err := seedVolume(context.Background(), t.TempDir(), &spec.VolumeSeed{Data: base64.StdEncoding.EncodeToString(archive)})
+		assert.ErrorContains(t, err, "illegal", entry.name)
+	}
+
+	err := seedVolume(context.Background(), t.TempDir(), &spec.VolumeSeed{Data: base64.StdEncoding.EncodeToString([]byte("plain text"))})
+	assert.ErrorContains(t, err, "neither a tar.gz nor a zip")
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	osruntime "runtime"
+	"strings"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
+)
+
+// mountShare mounts the network share at its path on the host, for the
+// steps executing directly on the host.
+func mountShare(ctx context.Context, share *spec.VolumeNetworkShare) error {
+	args, err := mountArgs(osruntime.GOOS, share)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(share.Path, fileperm.Mode(permissions)); err != nil {
+		return err
+	}
+	if out, err := exec.CommandContext(ctx, "mount", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// unmountShare unmounts the network share from the host.
+func unmountShare(share *spec.VolumeNetworkShare) error {
+	if out, err := exec.Command("umount", share.Path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// mountArgs returns the arguments of mount(8) for the share.
+func mountArgs(goos string, share *spec.VolumeNetworkShare) ([]string, error) {
+	fsType, err := share.FSType()
+	if err != nil {
+		return nil, err
+	}
+	switch goos {
+	case "linux":
+	case "darwin":
+		if fsType == "cifs" {
+			fsType = "smbfs"
+		}
+	default:
+		return nil, fmt.Errorf("network shares cannot be mounted on the host on %s", goos)
+	}
+	args := []string{"-t", fsType}
+	if opts := share.MountOptions(); opts != "" {
+		args = append(args, "-o", opts)
+	}
+	return append(args, share.Device(), share.Path), nil
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountArgs(t *testing.T) {
+	nfs := &spec.VolumeNetworkShare{
+		Type:     "nfs",
+		Server:   "files.example.com",
+		Share:    "/exports/data",
+		Options:  []string{"vers=4.1"},
+		Path:     "/mnt/data",
+		ReadOnly: true,
+	}
+	args, err := mountArgs("linux", nfs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-t", "nfs", "-o", "vers=4.1,ro", "files.example.com:/exports/data", "/mnt/data"}, args)
+
+	smb := &spec.VolumeNetworkShare{
+		Type:   "smb",
+		Server: "account.file.core.windows.net",
+		Share:  "data",
+		Path:   "/mnt/data",
+	}
+	args, err = mountArgs("linux", smb)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-t", "cifs", "//account.file.core.windows.net/data", "/mnt/data"}, args)
+
+	args, err = mountArgs("darwin", smb)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-t", "smbfs", "//account.file.core.windows.net/data", "/mnt/data"}, args)
+
+	_, err = mountArgs("windows", smb)
+	assert.Error(t, err)
+
+	_, err = mountArgs("linux", &spec.VolumeNetworkShare{Type: "ftp"})
+	assert.Error(t, err)
+}
@@ -65,3 +65,35 @@ func (p *PullPolicy) UnmarshalJSON(b []byte) error {
 	*p = pullPolicyName[s]
 	return nil
 }
+
+// Backends running the container steps.
+const (
+	BackendDocker     = "docker"
+	BackendKubernetes = "kubernetes"
+)
+
+// Container runtimes of the docker backend.
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+)
+
+// OCIRuntimeDefault runs the container of a step with the default OCI
+// runtime of the container engine, eg. runc.
+const OCIRuntimeDefault = "default"
+
+// Isolation modes of the windows container steps.
+const (
+	IsolationDefault     = "default"
+	IsolationProcess     = "process"
+	IsolationHyperV      = "hyperv"
+	IsolationHostProcess = "hostprocess" // a HostProcess container, with the network and the filesystem of the host
+)
+
+// Profiles of the seccomp and apparmor options of the security context of
+// a step, besides the path of a seccomp profile or the name of a loaded
+// apparmor profile.
+const (
+	ProfileUnconfined     = "unconfined"
+	ProfileRuntimeDefault = "runtime/default"
+)
@@ -11,6 +11,7 @@ package spec
 import (
 	"bytes"
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -124,3 +125,29 @@ func TestPullPolicy_String(t *testing.T) {
 		}
 	}
 }
+
+func TestGPUs_Unmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		gpus GPUs
+	}{
+		{data: `"all"`, gpus: GPUs{Count: GPUCountAll}},
+		{data: `"2"`, gpus: GPUs{Count: 2}},
+		{data: `1`, gpus: GPUs{Count: 1}},
+		{data: `{"device_ids":["0","1"],"capabilities":["compute"]}`, gpus: GPUs{DeviceIDs: []string{"0", "1"}, Capabilities: []string{"compute"}}},
+	}
+	for _, test := range tests {
+		var gpus GPUs
+		if err := json.Unmarshal([]byte(test.data), &gpus); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := gpus, test.gpus; !reflect.DeepEqual(got, want) {
+			t.Errorf("Want gpus %+v, got %+v", want, got)
+		}
+	}
+	var gpus GPUs
+	if err := json.Unmarshal([]byte(`"some"`), &gpus); err == nil {
+		t.Error("Want an error for invalid gpus")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// GPUCountAll requests all the GPUs of the host.
+const GPUCountAll = -1
+
+// GPUs reserves the GPUs of the host for the container of a step, eg. with
+// the NVIDIA container runtime. It is unmarshaled from "all", a count or
+// the object.
+type GPUs struct {
+	Count     int      `json:"count,omitempty"`      // GPUCountAll for all the GPUs
+	DeviceIDs []string `json:"device_ids,omitempty"` // eg. 0 or GPU-<uuid>, instead of the count
+	Driver    string   `json:"driver,omitempty"`     // eg. nvidia, picked by the capabilities if not set
+	// Capabilities of the driver requested besides gpu, eg. compute and
+	// utility.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// UnmarshalJSON unmarshals the GPUs from "all", a count or the object.
+func (g *GPUs) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s == "all" {
+			*g = GPUs{Count: GPUCountAll}
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid gpus %q", s)
+		}
+		*g = GPUs{Count: n}
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*g = GPUs{Count: n}
+		return nil
+	}
+	type gpus GPUs
+	return json.Unmarshal(b, (*gpus)(g))
+}
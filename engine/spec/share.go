@@ -0,0 +1,46 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Network share types.
+const (
+	ShareNFS = "nfs"
+	ShareSMB = "smb"
+)
+
+// FSType returns the file system type of the share for mount(8).
+func (s *VolumeNetworkShare) FSType() (string, error) {
+	switch strings.ToLower(s.Type) {
+	case ShareNFS:
+		return "nfs", nil
+	case ShareSMB, "cifs":
+		return "cifs", nil
+	default:
+		return "", fmt.Errorf("unsupported network share type %q", s.Type)
+	}
+}
+
+// Device returns the remote location of the share, eg. server:/export
+// for nfs and //server/share for smb.
+func (s *VolumeNetworkShare) Device() string {
+	if strings.ToLower(s.Type) == ShareNFS {
+		return s.Server + ":/" + strings.TrimPrefix(s.Share, "/")
+	}
+	return "//" + s.Server + "/" + strings.TrimPrefix(s.Share, "/")
+}
+
+// MountOptions returns the comma separated mount options of the share.
+func (s *VolumeNetworkShare) MountOptions() string {
+	opts := append([]string{}, s.Options...)
+	if s.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	return strings.Join(opts, ",")
+}
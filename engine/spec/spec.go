@@ -20,6 +20,47 @@ type (
 		Files             []*File           `json:"files,omitempty"`
 		EnableDockerSetup *bool             `json:"mount_docker_socket"`
 		TTY               bool              `json:"tty,omitempty" default:"false"`
+		EnvPassthrough    *EnvPassthrough   `json:"env_passthrough,omitempty"`
+		Labels            map[string]string `json:"labels,omitempty"` // applied to all the resources of the stage
+		// Backend runs the container steps, BackendDocker if not set.
+		Backend string `json:"backend,omitempty"`
+		// Runtime runs the containers of the docker backend, the container
+		// runtime of the engine if not set.
+		Runtime string `json:"runtime,omitempty"`
+		// EgressProxyPort is the port of the egress proxy of the stage on
+		// the host, set as the proxy of the steps. No proxy if 0.
+		EgressProxyPort int `json:"egress_proxy_port,omitempty"`
+		// EgressProxyCredential is the user:password the steps authenticate
+		// to the egress proxy with.
+		EgressProxyCredential string `json:"egress_proxy_credential,omitempty"`
+		// OCIRuntimes are the OCI runtimes the steps of the stage run with,
+		// checked at setup to be registered with the docker daemon.
+		OCIRuntimes []string `json:"oci_runtimes,omitempty"`
+		// UserNamespace runs the containers with the users remapped by the
+		// docker daemon, the host volumes are then not writable by all the
+		// users. Not supported by the kubernetes and containerd backends.
+		UserNamespace *UserNamespace `json:"user_namespace,omitempty"`
+	}
+
+	// UserNamespace configures the stages running on a docker daemon which
+	// remaps the users of the containers, with userns-remap or rootless.
+	UserNamespace struct {
+		// Mode is the user namespace of the containers, "host" runs them
+		// without the remapping, eg. for the privileged steps.
+		Mode string `json:"mode,omitempty"`
+		// UID and GID own the host volumes, eg. the subordinate ids the root
+		// of the containers is remapped to. The volumes are owned by the
+		// engine user if not set, eg. the user of a rootless daemon.
+		UID int `json:"uid,omitempty"`
+		GID int `json:"gid,omitempty"`
+	}
+
+	// EnvPassthrough controls which environment variables of the engine
+	// process are passed to steps executed directly on the host. Patterns
+	// follow the path.Match syntax eg. AWS_*.
+	EnvPassthrough struct {
+		Allow []string `json:"allow,omitempty"` // if set, only the matching variables are passed
+		Deny  []string `json:"deny,omitempty"`  // matching variables are never passed
 	}
 
 	// Step defines a pipeline step.
@@ -53,10 +94,64 @@ type (
 		Secrets      []*Secret         `json:"secrets,omitempty"`
 		ShmSize      int64             `json:"shm_size,omitempty"`
 		User         string            `json:"user,omitempty"`
+		GroupAdd     []string          `json:"group_add,omitempty"` // supplemental groups
+		HostUser     bool              `json:"host_user,omitempty"` // run as the user of the engine on the host
 		Volumes      []*VolumeMount    `json:"volumes,omitempty"`
 		Files        []*File           `json:"files,omitempty"`
 		WorkingDir   string            `json:"working_dir,omitempty"`
 		SoftStop     bool              `json:"soft_stop,omitempty"`
+		Clock        *Clock            `json:"clock,omitempty"`
+		Umask        string            `json:"umask,omitempty"` // octal umask of the step files, the umask of the engine if not set
+		// OCIRuntime runs the container of the step, eg. runsc for gVisor
+		// or kata, the default runtime of the daemon if not set or
+		// OCIRuntimeDefault. It is the runtime class with kubernetes.
+		OCIRuntime string `json:"oci_runtime,omitempty"`
+		// SecurityContext restricts the container of the step beyond the
+		// defaults of the container runtime.
+		SecurityContext *SecurityContext `json:"security_context,omitempty"`
+		// Platform of the image of the step, eg. linux/amd64 emulated on an
+		// arm64 host, the platform of the host if not set.
+		Platform *Platform `json:"platform,omitempty"`
+		// Isolation is the isolation of the windows container of the step,
+		// one of the Isolation modes, the default of the daemon if not set.
+		Isolation string `json:"isolation,omitempty"`
+		// GPUs reserves the GPUs of the host for the container of the step.
+		GPUs *GPUs `json:"gpus,omitempty"`
+		// WorkspaceClone runs the step in a copy-on-write clone of the host
+		// volume holding its working directory.
+		WorkspaceClone bool `json:"workspace_clone,omitempty"`
+		// IsolatedHome runs the step with its own empty HOME directory,
+		// removed once the step completes.
+		IsolatedHome bool `json:"isolated_home,omitempty"`
+		// WarmContainer runs the command of the step in the container of
+		// the stage with the name, kept running between the steps.
+		WarmContainer string `json:"warm_container,omitempty"`
+		// CloneWorkingDir is the working directory of the step in the clone
+		// on the host, set by the engine.
+		CloneWorkingDir string `json:"-"`
+	}
+
+	// SecurityContext restricts the container of a step, eg. of the builds
+	// of the untrusted pull requests.
+	SecurityContext struct {
+		CapAdd  []string `json:"cap_add,omitempty"`
+		CapDrop []string `json:"cap_drop,omitempty"` // eg. ALL
+		// Seccomp is the path of the seccomp profile on the host, relative
+		// to the seccomp directory of the kubelet with kubernetes, or one
+		// of ProfileUnconfined and ProfileRuntimeDefault.
+		Seccomp string `json:"seccomp,omitempty"`
+		// AppArmor is the name of an apparmor profile loaded on the host,
+		// or one of ProfileUnconfined and ProfileRuntimeDefault.
+		AppArmor        string `json:"apparmor,omitempty"`
+		NoNewPrivileges bool   `json:"no_new_privileges,omitempty"`
+		ReadOnlyRootfs  bool   `json:"read_only_rootfs,omitempty"`
+	}
+
+	// Clock configures the timezone and the optional fake time of a step.
+	Clock struct {
+		Timezone    string `json:"timezone,omitempty"`      // IANA timezone name eg. Asia/Kolkata
+		FakeTime    string `json:"fake_time,omitempty"`     // libfaketime timestamp spec eg. "@2024-01-01 10:00:00"
+		FakeTimeLib string `json:"fake_time_lib,omitempty"` // path of libfaketime in the image, preloaded if set
 	}
 
 	// Secret represents a secret variable.
@@ -79,6 +174,9 @@ type (
 	Volume struct {
 		EmptyDir *VolumeEmptyDir `json:"temp,omitempty"`
 		HostPath *VolumeHostPath `json:"host,omitempty"`
+		// NetworkShare is an nfs or smb share, eg. a cloud file
+		// share, mounted instead of copying its content.
+		NetworkShare *VolumeNetworkShare `json:"network_share,omitempty"`
 	}
 
 	// files or folder created on the host as part of setup or a step.
@@ -126,6 +224,35 @@ type (
 		Remove   bool              `json:"remove,omitempty"`
 		Labels   map[string]string `json:"labels,omitempty"`
 		ReadOnly bool              `json:"read_only,omitempty"`
+		// Seed is the initial content of the volume, extracted
+		// into it at setup before any step runs.
+		Seed *VolumeSeed `json:"seed,omitempty"`
+	}
+
+	// VolumeSeed is a tar.gz or zip archive, either downloaded
+	// from a url or embedded base64 encoded in the request.
+	VolumeSeed struct {
+		URL    string `json:"url,omitempty"`
+		Data   string `json:"data,omitempty"`
+		SHA256 string `json:"sha256,omitempty"` // expected checksum of the archive, verified if set
+	}
+
+	// VolumeNetworkShare mounts a network file share into the
+	// containers. It is created as a docker volume with the
+	// local driver, and it is also mounted at Path on the host
+	// if set, for the steps executing directly on the host.
+	VolumeNetworkShare struct {
+		ID     string `json:"id,omitempty"`
+		Name   string `json:"name,omitempty"`
+		Type   string `json:"type,omitempty"`   // nfs or smb
+		Server string `json:"server,omitempty"` // host name or address of the file server
+		Share  string `json:"share,omitempty"`  // export path of nfs, share name of smb
+		// Options are the mount options, eg. vers=4.1 for nfs or
+		// username=user,password=pass for smb.
+		Options  []string          `json:"options,omitempty"`
+		Path     string            `json:"path,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		ReadOnly bool              `json:"read_only,omitempty"`
 	}
 
 	// VolumeDevice describes a mapping of a raw block
@@ -160,6 +287,19 @@ type (
 		CPUGraph       *Graph  `json:"cpu_graph"` // downsampled cpu statistics as a percentage
 	}
 
+	// HostFingerprint describes the host the engine is running on.
+	HostFingerprint struct {
+		OS              string            `json:"os"`
+		Arch            string            `json:"arch"`
+		Platform        string            `json:"platform,omitempty"` // distribution eg. ubuntu
+		PlatformVersion string            `json:"platform_version,omitempty"`
+		KernelVersion   string            `json:"kernel_version,omitempty"`
+		CPUCores        int               `json:"cpu_cores"`
+		TotalMemMB      float64           `json:"total_mem_mb"`
+		DockerVersion   string            `json:"docker_version,omitempty"`
+		Runtimes        map[string]string `json:"runtimes,omitempty"` // version of the language runtimes on the path
+	}
+
 	Graph struct {
 		Points  []Point `json:"points"`  // should be used as a sampled set of points
 		Xmetric string  `json:"xmetric"` // string to label x metric
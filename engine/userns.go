@@ -0,0 +1,38 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+// chownVolume changes the owner of the host volume to the user the root of
+// the containers is remapped to, with the files seeded in it if recursive.
+// The volume is left to the engine user if the ids are not set.
+func chownVolume(path string, userns *spec.UserNamespace, recursive bool) error {
+	if userns.UID <= 0 && userns.GID <= 0 {
+		return nil
+	}
+	uid, gid := -1, -1
+	if userns.UID > 0 {
+		uid = userns.UID
+	}
+	if userns.GID > 0 {
+		gid = userns.GID
+	}
+	if !recursive {
+		return os.Chown(path, uid, gid)
+	}
+	return filepath.WalkDir(path, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, uid, gid)
+	})
+}
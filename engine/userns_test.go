@@ -0,0 +1,40 @@
+//go:build !windows
+
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+func TestSetupUserNamespace(t *testing.T) {
+	dir := t.TempDir()
+	vol := filepath.Join(dir, "vol")
+	cfg := &spec.PipelineConfig{
+		Volumes:       []*spec.Volume{{HostPath: &spec.VolumeHostPath{Name: "vol", Path: vol}}},
+		UserNamespace: &spec.UserNamespace{},
+	}
+	if os.Geteuid() == 0 {
+		cfg.UserNamespace.UID, cfg.UserNamespace.GID = 100000, 100000
+	}
+	if err := setupHelper(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got&0007 != 0 {
+		t.Errorf("got mode %o, want the volume not accessible by the other users", got)
+	}
+	if os.Geteuid() == 0 {
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && (st.Uid != 100000 || st.Gid != 100000) {
+			t.Errorf("got owner %d:%d, want the remapped user", st.Uid, st.Gid)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package envelope encrypts the secret outputs of the steps with the key of
+// the stage before they leave the engine. Each value is encrypted with its
+// own random data key, itself encrypted with the key of the stage, using
+// AES-256-GCM. The name of the output is authenticated along with the value
+// so an encrypted value cannot be swapped with the one of another output.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeySize is the size of the keys in bytes.
+const KeySize = 32
+
+// prefix is the version of the format of the sealed values:
+//
+//	v1.<base64 encrypted data key>.<base64 encrypted value>
+//
+// The encrypted data key and the encrypted value are prefixed with their
+// nonce, the base64 encoding is the unpadded url encoding.
+const prefix = "v1"
+
+var (
+	errFormat = errors.New("the sealed value is malformed")
+	encoding  = base64.RawURLEncoding
+)
+
+// ParseKey decodes the base64 key of a stage.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("the key needs to be base64 encoded")
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the key needs to be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Seal encrypts the value of the named output with the key.
+func Seal(key []byte, name, value string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := encrypt(key, dataKey, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := encrypt(dataKey, []byte(value), []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{prefix, encoding.EncodeToString(wrapped), encoding.EncodeToString(sealed)}, "."), nil
+}
+
+// Open decrypts the value of the named output sealed with the key.
+func Open(key []byte, name, sealed string) (string, error) {
+	parts := strings.Split(sealed, ".")
+	if len(parts) != 3 || parts[0] != prefix { //nolint:gomnd
+		return "", errFormat
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errFormat
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errFormat
+	}
+	dataKey, err := decrypt(key, wrapped, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	value, err := decrypt(dataKey, ciphertext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// encrypt returns the nonce followed by the ciphertext.
+func encrypt(key, plaintext, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+func decrypt(key, sealed, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errFormat
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, data)
+	if err != nil {
+		return nil, errors.New("the sealed value cannot be decrypted with the key")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,61 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := newKey(t)
+	sealed, err := Seal(key, "token", "s3cr3t")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v1."))
+	assert.NotContains(t, sealed, "s3cr3t")
+
+	value, err := Open(key, "token", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	again, err := Seal(key, "token", "s3cr3t")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+}
+
+func TestOpen_Errors(t *testing.T) {
+	key := newKey(t)
+	sealed, err := Seal(key, "token", "s3cr3t")
+	require.NoError(t, err)
+
+	_, err = Open(newKey(t), "token", sealed)
+	assert.Error(t, err, "another key")
+	_, err = Open(key, "password", sealed)
+	assert.Error(t, err, "another output")
+	_, err = Open(key, "token", "s3cr3t")
+	assert.Error(t, err, "not sealed")
+	_, err = Open(key, "token", sealed[:len(sealed)-4])
+	assert.Error(t, err, "truncated")
+}
+
+func TestParseKey(t *testing.T) {
+	key := newKey(t)
+	parsed, err := ParseKey(base64.StdEncoding.EncodeToString(key))
+	require.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = ParseKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(key[:16]))
+	assert.EqualError(t, err, "the key needs to be 32 bytes, got 16")
+}
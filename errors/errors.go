@@ -4,11 +4,19 @@
 
 package errors
 
+import "strings"
+
 type BadRequestError struct {
-	Msg string // description of error
+	Msg    string   // description of error
+	Issues []string // individual validation issues, if any
 }
 
-func (e *BadRequestError) Error() string { return e.Msg }
+func (e *BadRequestError) Error() string {
+	if len(e.Issues) == 0 {
+		return e.Msg
+	}
+	return e.Msg + ": " + strings.Join(e.Issues, "; ")
+}
 
 type NotFoundError struct {
 	Msg string // description of error
@@ -16,6 +24,22 @@ type NotFoundError struct {
 
 func (e *NotFoundError) Error() string { return e.Msg }
 
+// UnavailableError is returned when the engine does not accept the request
+// anymore, eg. while it drains before shutting down.
+type UnavailableError struct {
+	Msg string // description of error
+}
+
+func (e *UnavailableError) Error() string { return e.Msg }
+
+// BudgetExceededError is returned when the budget of the stage is
+// exhausted, the engine does not start its steps anymore.
+type BudgetExceededError struct {
+	Msg string // description of error
+}
+
+func (e *BudgetExceededError) Error() string { return e.Msg }
+
 type InternalServerError struct {
 	Msg string // description of error
 }
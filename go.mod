@@ -6,7 +6,7 @@ replace github.com/docker/docker => github.com/moby/moby v17.12.0-ce-rc1.0.20200
 
 require (
 	github.com/bmatcuk/doublestar v1.3.4
-	github.com/cenkalti/backoff/v4 v4.2.0
+	github.com/cenkalti/backoff/v4 v4.2.0 // indirect
 	github.com/docker/distribution v2.8.1+incompatible
 	// this is fake as we are using github.com/docker/engine, this makes the security warning go away
 	github.com/docker/docker v23.0.1+incompatible
@@ -19,6 +19,7 @@ require (
 	github.com/harness/ti-client v0.0.0-20240617230757-1e90e7e3ada2
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.16.3
 	github.com/linkedin/goavro/v2 v2.12.0
 	github.com/mattn/go-zglob v0.0.4
 	github.com/mholt/archiver/v3 v3.5.1
@@ -33,11 +34,16 @@ require (
 
 require (
 	github.com/dgryski/go-lttb v0.0.0-20230207170358-f8fc36cdbff1
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/harness/godotenv/v2 v2.0.0
 	github.com/harness/godotenv/v3 v3.0.1
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.1.0-rc2.0.20221005185240-3a7f492d3f1b
 	github.com/shirou/gopsutil/v3 v3.23.5
 	github.com/wings-software/dlite v1.0.0-rc.13
+	golang.org/x/crypto v0.14.0
 	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
 )
 
 require (
@@ -63,15 +69,12 @@ require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
-	github.com/klauspost/compress v1.16.3 // indirect
 	github.com/klauspost/pgzip v1.2.5 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/natessilva/dag v0.0.0-20180124060714-7194b8dcc5c4 // indirect
 	github.com/nwaples/rardecode v1.1.3 // indirect
-	github.com/opencontainers/go-digest v1.0.0 // indirect
-	github.com/opencontainers/image-spec v1.1.0-rc2.0.20221005185240-3a7f492d3f1b // indirect
 	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
 	github.com/pierrec/lz4/v4 v4.1.17 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -82,7 +85,6 @@ require (
 	github.com/ulikunitz/xz v0.5.11 // indirect
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
-	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/exp v0.0.0-20220927162542-c76eaa363f9d // indirect
 	golang.org/x/mod v0.11.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,74 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/logger"
+	"github.com/harness/lite-engine/pipeline/retention"
+)
+
+var errRetentionDisabled = &errors.NotFoundError{Msg: "artifact retention is disabled"}
+
+// HandleListArtifacts returns an http.HandlerFunc that lists the retained
+// artifacts of the steps, of the step of ?step=<id> if set.
+func HandleListArtifacts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := retention.Registered()
+		if store == nil {
+			WriteNotFound(w, r, errRetentionDisabled)
+			return
+		}
+		WriteJSON(w, api.ArtifactsResponse{Entries: store.List(r.URL.Query().Get("step"))}, http.StatusOK)
+	}
+}
+
+// HandleFetchArtifacts returns an http.HandlerFunc that returns the tar.gz
+// archive of the files of a retained entry, or one of its files.
+func HandleFetchArtifacts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := retention.Registered()
+		if store == nil {
+			WriteNotFound(w, r, errRetentionDisabled)
+			return
+		}
+		name := chi.URLParam(r, "entry")
+		file := chi.URLParam(r, "*")
+		for k, val := range noCacheHeaders {
+			w.Header().Set(k, val)
+		}
+		if file == "" {
+			// the archive is streamed, an error can only be logged once
+			// it started
+			if !store.Has(name) {
+				WriteNotFound(w, r, &errors.NotFoundError{Msg: retention.ErrNotFound.Error()})
+				return
+			}
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.tar.gz"`)
+			if err := store.WriteArchive(w, name); err != nil {
+				logger.FromRequest(r).WithError(err).WithField("entry", name).
+					Errorln("api: cannot write the archive of the artifacts")
+			}
+			return
+		}
+		f, err := store.Open(name, file)
+		if err != nil {
+			WriteNotFound(w, r, &errors.NotFoundError{Msg: retention.ErrNotFound.Error()})
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(file)+`"`)
+		io.Copy(w, f) //nolint:errcheck
+	}
+}
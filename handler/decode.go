@@ -0,0 +1,53 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const defaultMaxRequestBodySize = 50 << 20 // 50 MiB
+
+type strictDecodingKey struct{}
+
+// withRequestLimits returns a middleware which limits the size of the request
+// body and sets whether unknown fields are rejected while decoding it.
+func withRequestLimits(maxBodySize int64, strict bool) func(http.Handler) http.Handler {
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxRequestBodySize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+			ctx := context.WithValue(r.Context(), strictDecodingKey{}, strict)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// decodeRequest decodes the json request body into v. Unknown fields are
+// ignored unless strict decoding is enabled for the request. It writes the
+// error response and returns false if the body could not be decoded.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	if strict, _ := r.Context().Value(strictDecodingKey{}).(bool); strict {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(v)
+	if err == nil {
+		return true
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, r, err, http.StatusRequestEntityTooLarge)
+	} else {
+		WriteBadRequest(w, r, err)
+	}
+	return false
+}
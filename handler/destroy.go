@@ -6,7 +6,6 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,10 +14,12 @@ import (
 
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/lifecycle"
 	"github.com/harness/lite-engine/engine/spec"
 	"github.com/harness/lite-engine/logger"
 	"github.com/harness/lite-engine/logstream"
 	"github.com/harness/lite-engine/pipeline"
+	pruntime "github.com/harness/lite-engine/pipeline/runtime"
 )
 
 var (
@@ -49,7 +50,7 @@ func convert(logs string) []*logstream.Line {
 }
 
 // HandleDestroy returns an http.HandlerFunc that destroy the stage resources
-func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
+func HandleDestroy(engine *engine.Engine, stepExecutor *pruntime.StepExecutor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		st := time.Now()
 		state := pipeline.GetState()
@@ -59,15 +60,22 @@ func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
 
 		// Upload lite engine logs if key is set
 		var d api.DestroyRequest
-		err := json.NewDecoder(r.Body).Decode(&d)
-		if err != nil {
-			WriteBadRequest(w, err)
+		if !decodeRequest(w, r, &d) {
 			return
 		}
 
+		lifecycle.Destroy(r.Context(), &d)
+		if d.ImageCache != nil && len(d.ImageCache.Images) > 0 && engine.ImageCacheSupported() {
+			exportCachedImages(r, engine, d.ImageCache)
+		}
 		destroyErr := engine.Destroy(r.Context())
+		stepExecutor.ClearState()
+		egress := stopEgressProxy(r)
+		state.StopSecretFiles()
+		pruntime.SetStageBudget(nil)
+		pruntime.SetTelemetrySampling(nil, "", "")
 		if destroyErr != nil || logErr != nil {
-			WriteError(w, fmt.Errorf("destroy error: %w, lite engine log error: %s", destroyErr, logErr))
+			WriteError(w, r, fmt.Errorf("destroy error: %w, lite engine log error: %s", destroyErr, logErr))
 		}
 
 		// upload engine logs
@@ -77,7 +85,7 @@ func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
 				logs, logErr = GetLiteEngineLog(d.LiteEnginePath)
 				if logErr != nil {
 					logger.FromRequest(r).WithField("time", time.Now().
-						Format(time.RFC3339)).WithError(err).Errorln("could not fetch lite engine logs")
+						Format(time.RFC3339)).WithError(logErr).Errorln("could not fetch lite engine logs")
 				} else {
 					// error out if logs don't upload in a minute so that the VM can be destroyed
 					ctx, cancel := context.WithTimeout(r.Context(), 1*time.Minute)
@@ -85,7 +93,7 @@ func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
 					logErr = client.Upload(ctx, d.LogKey, convert(logs))
 					if logErr != nil {
 						logger.FromRequest(r).WithField("time", time.Now().
-							Format(time.RFC3339)).WithError(err).Errorln("could not upload lite engine logs")
+							Format(time.RFC3339)).WithError(logErr).Errorln("could not upload lite engine logs")
 					}
 				}
 				if d.StageRuntimeID != "" {
@@ -106,7 +114,7 @@ func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
 			stats = collector.Stats()
 		}
 
-		WriteJSON(w, api.DestroyResponse{OSStats: stats}, http.StatusOK)
+		WriteJSON(w, api.DestroyResponse{OSStats: stats, Egress: egress}, http.StatusOK)
 
 		logger.FromRequest(r).
 			WithField("latency", time.Since(st)).
@@ -114,3 +122,41 @@ func HandleDestroy(engine *engine.Engine) http.HandlerFunc {
 			Infoln("api: successfully destroyed the stage resources")
 	}
 }
+
+// stopEgressProxy closes the egress proxy of the stage, if any, and returns
+// the destinations of the steps.
+func stopEgressProxy(r *http.Request) []*api.EgressDestination {
+	state := pipeline.GetState()
+	proxy := state.GetEgressProxy()
+	if proxy == nil {
+		return nil
+	}
+	proxy.Close()
+	state.SetEgressProxy(nil)
+	summary := proxy.Summary()
+	hosts := make([]string, len(summary))
+	for i, d := range summary {
+		hosts[i] = d.Host
+	}
+	logger.FromRequest(r).
+		WithField("destinations", hosts).
+		Infoln("api: closed the egress proxy")
+	return summary
+}
+
+// exportCachedImages saves the images for the next stages. A failure is
+// only logged, the next stages pull the images instead.
+func exportCachedImages(r *http.Request, engine *engine.Engine, c *api.ImageCache) {
+	st := time.Now()
+	n, err := engine.ExportImages(r.Context(), c.Dir, c.Images)
+	if err != nil {
+		logger.FromRequest(r).WithError(err).WithField("dir", c.Dir).
+			Warnln("api: cannot export the images to the cache")
+		return
+	}
+	logger.FromRequest(r).
+		WithField("latency", time.Since(st)).
+		WithField("dir", c.Dir).
+		WithField("images", n).
+		Infoln("api: exported the images to the cache")
+}
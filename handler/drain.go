@@ -0,0 +1,46 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logger"
+	"github.com/harness/lite-engine/pipeline/runtime"
+)
+
+const defaultDrainTimeout = 2 * time.Minute
+
+// HandleDrain returns an http.HandlerFunc that stops the engine from
+// starting new steps, waits for the running steps to complete and then
+// shuts the engine down.
+func HandleDrain(stepExecutor *runtime.StepExecutor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := time.Now()
+
+		var d api.DrainRequest
+		if !decodeRequest(w, r, &d) {
+			return
+		}
+		timeout := defaultDrainTimeout
+		if d.Timeout > 0 {
+			timeout = time.Second * time.Duration(d.Timeout)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		running := stepExecutor.Drain(ctx)
+		WriteJSON(w, api.DrainResponse{Drained: running == 0, Running: running}, http.StatusOK)
+		stepExecutor.Shutdown()
+
+		logger.FromRequest(r).
+			WithField("latency", time.Since(st)).
+			WithField("running", running).
+			Infoln("api: drained the engine, shutting down")
+	}
+}
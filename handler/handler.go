@@ -17,11 +17,30 @@ import (
 )
 
 // Handler returns an http.Handler that exposes the service resources.
+// The unversioned routes are kept for backward compatibility and serve
+// the same responses as the /v1 routes. The /v2 routes only differ by their
+// typed error responses so far.
 func Handler(config *config.Config, engine *engine.Engine, stepExecutor *runtime.StepExecutor) http.Handler {
 	r := chi.NewRouter()
 	r.Use(logger.Middleware)
 	r.Use(middleware.Recoverer)
+	r.Use(withRequestLimits(config.Server.MaxRequestBodySize, config.Server.StrictDecoding))
 
+	r.Group(func(r chi.Router) {
+		routes(r, engine, stepExecutor)
+	})
+	r.Route("/v1", func(r chi.Router) {
+		routes(r, engine, stepExecutor)
+	})
+	r.Route("/v2", func(r chi.Router) {
+		r.Use(withAPIVersion(apiV2))
+		routes(r, engine, stepExecutor)
+	})
+
+	return r
+}
+
+func routes(r chi.Router, engine *engine.Engine, stepExecutor *runtime.StepExecutor) {
 	// Setup stage endpoint
 	r.Mount("/setup", func() http.Handler {
 		sr := chi.NewRouter()
@@ -32,7 +51,51 @@ func Handler(config *config.Config, engine *engine.Engine, stepExecutor *runtime
 	// Destroy stage endpoint
 	r.Mount("/destroy", func() http.Handler {
 		sr := chi.NewRouter()
-		sr.Post("/", HandleDestroy(engine))
+		sr.Post("/", HandleDestroy(engine, stepExecutor))
+		return sr
+	}())
+
+	// Pause stage endpoint
+	r.Mount("/pause", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Post("/", HandlePause(engine))
+		return sr
+	}())
+
+	// Resume stage endpoint
+	r.Mount("/resume", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Post("/", HandleResume(engine))
+		return sr
+	}())
+
+	// List the resources by label endpoint
+	r.Mount("/resources", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Get("/", HandleListResources(engine))
+		return sr
+	}())
+
+	// Drain and shut down the engine endpoint
+	r.Mount("/drain", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Post("/", HandleDrain(stepExecutor))
+		return sr
+	}())
+
+	// Timeline of the steps of the stage endpoint
+	r.Mount("/timeline", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Get("/", HandleTimeline())
+		return sr
+	}())
+
+	// Retained artifacts of the steps endpoints
+	r.Mount("/artifacts", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Get("/", HandleListArtifacts())
+		sr.Get("/{entry}", HandleFetchArtifacts())
+		sr.Get("/{entry}/*", HandleFetchArtifacts())
 		return sr
 	}())
 
@@ -64,5 +127,10 @@ func Handler(config *config.Config, engine *engine.Engine, stepExecutor *runtime
 		return sr
 	}())
 
-	return r
+	// Prometheus metrics endpoint
+	r.Mount("/metrics", func() http.Handler {
+		sr := chi.NewRouter()
+		sr.Get("/", HandleMetrics())
+		return sr
+	}())
 }
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/config"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/internal/sealed"
+	"github.com/harness/lite-engine/pipeline/retention"
+	"github.com/harness/lite-engine/pipeline/runtime"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestHandlerVersionedErrors(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	for _, path := range []string{"/poll_step", "/v1/poll_step"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error_msg": "ID needs to be set"}`, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/poll_step", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp api.ErrorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api.ErrorCodeBadRequest, resp.Error.Code)
+	assert.Equal(t, "ID needs to be set", resp.Error.Message)
+}
+
+func TestHandlerHealthVersions(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	for _, path := range []string{"/healthz", "/v1/healthz", "/v2/healthz"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestHandlerRequestDecoding(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.StrictDecoding = true
+	h := Handler(cfg, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/poll_step", bytes.NewBufferString(`{"id": "step", "unknown": 1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown field \"unknown\"`)
+
+	// the unknown fields are ignored by default
+	cfg = &config.Config{}
+	cfg.Server.MaxRequestBodySize = 16
+	h = Handler(cfg, nil, runtime.NewStepExecutor(nil))
+
+	for _, path := range []string{"/poll_step", "/v1/poll_step", "/v2/poll_step"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"unknown": 1}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "ID needs to be set", path)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/poll_step", bytes.NewBufferString(`{"id": "a-long-step-id"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var resp api.ErrorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api.ErrorCodeTooLarge, resp.Error.Code)
+}
+
+func TestHandlerListResourcesInvalidSelector(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resources?label==abc", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlerSetupIncompatible(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	body := `{"compatibility": {"features": ["api_v2", "unknown_feature"]}}`
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/setup", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp api.ErrorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "engine is incompatible with the runner", resp.Error.Message)
+	assert.Len(t, resp.Error.Issues, 1)
+}
+
+func TestHandlerSetupUnsupportedBackend(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/setup", bytes.NewBufferString(`{"backend": "nomad"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlerSetupUnsupportedRuntime(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	for _, body := range []string{`{"runtime": "cri-o"}`, `{"backend": "kubernetes", "runtime": "containerd"}`,
+		`{"backend": "kubernetes", "egress_proxy": true}`, `{"notify": {"webhook_url": "hooks.slack.com/x"}}`,
+		`{"notify": {"webhook_url": "https://hooks.slack.com/x", "kind": "discord"}}`,
+		`{"output_key": "not base64"}`, `{"output_key": "c2hvcnQ="}`,
+		`{"runtime": "containerd", "user_namespace": {}}`, `{"user_namespace": {"mode": "private"}}`,
+		`{"user_namespace": {"uid": -1}}`} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/setup", bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestTimelineDOT(t *testing.T) {
+	dot := timelineDOT(&api.TimelineResponse{DurationMs: 15000, Steps: []*api.TimelineStep{
+		{ID: "build", Name: "Build", ContainerID: "0123456789abcdef", DurationMs: 10000, Status: "succeeded",
+			Phases: []*api.TimelinePhase{{Name: "pull", DurationMs: 2500}}},
+		{ID: "test", DependsOn: []string{"build"}, DurationMs: 5000, Status: "failed"},
+	}})
+	assert.Equal(t, `digraph stage {
+	rankdir=LR;
+	node [shape=box];
+	label="stage 15.0s";
+	"build" [label="Build\nsucceeded, 10.0s\ncontainer 0123456789ab\npull 2.5s"];
+	"test" [label="test\nfailed, 5.0s"];
+	"build" -> "test";
+}
+`, dot)
+}
+
+func TestHandlerTimeline(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/timeline?format=svg", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/timeline", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlerDrain(t *testing.T) {
+	e := runtime.NewStepExecutor(nil)
+	h := Handler(&config.Config{}, nil, e)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/drain", bytes.NewBufferString(`{"timeout": 1}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"drained": true}`, w.Body.String())
+	select {
+	case <-e.Drained():
+	default:
+		t.Error("the engine is not shut down once drained")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/start_step", bytes.NewBufferString(`{"id": "step", "kind": "Run", "run": {"commands": ["make"], "shell": "sh"}}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp api.ErrorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api.ErrorCodeUnavailable, resp.Error.Code)
+}
+
+func TestHandlerArtifacts(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	workDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(workDir, "unit.xml"), []byte("<testsuite/>"), 0600))
+	store, err := retention.New(t.TempDir(), 1024)
+	assert.Nil(t, err)
+	lifecycle.Register(store)
+	defer lifecycle.Reset()
+	r := &api.StartStepRequest{ID: "build", WorkingDir: workDir}
+	r.TestReport.Junit.Paths = []string{"*.xml"}
+	assert.Nil(t, store.OnStepEnd(context.Background(), r, &lifecycle.StepResult{}))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts?step=build", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp api.ArtifactsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Entries, 1) {
+		name := resp.Entries[0].Name
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts/"+name+"/unit.xml", http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "<testsuite/>", w.Body.String())
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts/"+name, http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts/unknown", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlerSealedEnvs(t *testing.T) {
+	assert.Nil(t, sealed.Configure(""))
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+	var health api.HealthResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, sealed.PublicKey(), health.PublicKey)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/start_step", bytes.NewBufferString(`{"id": "step", "sealed_envs": {"TOKEN": "invalid"}}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid sealed envs")
+
+	token, err := sealed.Seal(health.PublicKey, "secret-token")
+	assert.Nil(t, err)
+	envs := map[string]string{"USER": "ci"}
+	var secrets []string
+	assert.Empty(t, openSealedEnvs(&envs, &secrets, map[string]string{"TOKEN": token}))
+	assert.Equal(t, map[string]string{"USER": "ci", "TOKEN": "secret-token"}, envs)
+	assert.Equal(t, []string{"secret-token"}, secrets)
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	h := Handler(&config.Config{}, nil, runtime.NewStepExecutor(nil))
+	hook := lifecycle.NewMetricsHook()
+	r := &api.StartStepRequest{Kind: api.RunTest}
+	assert.Nil(t, hook.OnStepStart(context.Background(), r))
+	assert.Nil(t, hook.OnStepEnd(context.Background(), r, &lifecycle.StepResult{Exited: true, ExitCode: 1}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	assert.Contains(t, w.Body.String(), `lite_engine_steps_total{kind="RunTest",status="failed"} 1`)
+	assert.Contains(t, w.Body.String(), `lite_engine_steps_in_flight{kind="RunTest"} 0`)
+	assert.Contains(t, w.Body.String(), `lite_engine_step_duration_seconds_count{kind="RunTest",status="failed"} 1`)
+}
+
+func TestAPIVersionWrappedWriter(t *testing.T) {
+	// a middleware wrapping the response writer keeps the v2 error shape
+	h := withAPIVersion(apiV2)(middleware.Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, &errors.NotFoundError{Msg: "not found"})
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var resp api.ErrorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api.ErrorCodeNotFound, resp.Error.Code)
+}
+
+func TestRedactedConfig(t *testing.T) {
+	cfg := &spec.PipelineConfig{EgressProxyPort: 3128, EgressProxyCredential: "harness:secret"}
+	redacted := redactedConfig(cfg)
+	assert.NotContains(t, redacted.EgressProxyCredential, "secret")
+	assert.Equal(t, 3128, redacted.EgressProxyPort)
+	assert.Equal(t, "harness:secret", cfg.EgressProxyCredential)
+}
@@ -13,6 +13,10 @@ import (
 	"time"
 
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/harness/lite-engine/internal/retry"
+	"github.com/harness/lite-engine/internal/sealed"
+	"github.com/harness/lite-engine/livelog"
 	"github.com/harness/lite-engine/version"
 	"github.com/sirupsen/logrus"
 )
@@ -22,8 +26,12 @@ func HandleHealth() http.HandlerFunc {
 		logrus.Infoln("handler: HandleHealth()")
 		version := version.Version
 		response := api.HealthResponse{
-			Version: version,
-			OK:      true,
+			Version:   version,
+			OK:        true,
+			Retries:   retryStats(),
+			Steps:     lifecycle.Metrics(),
+			PublicKey: sealed.PublicKey(),
+			Logs:      logMetrics(),
 		}
 		status := http.StatusOK
 
@@ -31,7 +39,7 @@ func HandleHealth() http.HandlerFunc {
 		if performDNSLookup {
 			err := checkInternetConnectivity()
 			if err != nil {
-				WriteError(w, err)
+				WriteError(w, r, err)
 				return
 			}
 		}
@@ -40,6 +48,29 @@ func HandleHealth() http.HandlerFunc {
 	}
 }
 
+func retryStats() map[string]api.RetryStat {
+	stats := retry.Stats()
+	if len(stats) == 0 {
+		return nil
+	}
+	out := make(map[string]api.RetryStat, len(stats))
+	for name, s := range stats {
+		out[name] = api.RetryStat{Calls: s.Calls, Retries: s.Retries, Failures: s.Failures}
+	}
+	return out
+}
+
+// logMetrics returns the counters of the log streams, nil if no lines were
+// streamed yet.
+func logMetrics() *api.LogMetrics {
+	s := livelog.Stats()
+	if s == (livelog.Counters{}) {
+		return nil
+	}
+	return &api.LogMetrics{Batches: s.Batches, Lines: s.Lines, Failed: s.Failed,
+		Stalls: s.Stalls, Dropped: s.Dropped, Queued: s.Queued}
+}
+
 func checkInternetConnectivity() error {
 	dialer := net.Dialer{
 		Timeout: 2 * time.Second,
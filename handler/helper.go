@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -24,36 +25,46 @@ var noCacheHeaders = map[string]string{
 	"X-Accel-Expires": "0",
 }
 
-func WriteError(w http.ResponseWriter, err error) {
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
 	if _, ok := err.(*errors.BadRequestError); ok {
-		WriteBadRequest(w, err)
+		WriteBadRequest(w, r, err)
 		return
 	}
 
 	if _, ok := err.(*errors.NotFoundError); ok {
-		WriteNotFound(w, err)
+		WriteNotFound(w, r, err)
 		return
 	}
 
-	WriteInternalError(w, err)
+	if _, ok := err.(*errors.UnavailableError); ok {
+		writeError(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	if _, ok := err.(*errors.BudgetExceededError); ok {
+		writeError(w, r, err, http.StatusForbidden)
+		return
+	}
+
+	WriteInternalError(w, r, err)
 }
 
 // writeBadRequest writes the json-encoded error message
 // to the response with a 400 bad request status code.
-func WriteBadRequest(w http.ResponseWriter, err error) {
-	writeError(w, err, http.StatusBadRequest)
+func WriteBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, http.StatusBadRequest)
 }
 
 // writeNotFound writes the json-encoded error message to
 // the response with a 404 not found status code.
-func WriteNotFound(w http.ResponseWriter, err error) {
-	writeError(w, err, http.StatusNotFound)
+func WriteNotFound(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, http.StatusNotFound)
 }
 
 // writeInternalError writes the json-encoded error message
 // to the response with a 500 internal server error.
-func WriteInternalError(w http.ResponseWriter, err error) {
-	writeError(w, err, http.StatusInternalServerError)
+func WriteInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, http.StatusInternalServerError)
 }
 
 // writeJSON writes the json-encoded representation of v to
@@ -73,9 +84,37 @@ func WriteJSON(w http.ResponseWriter, v interface{}, status int) {
 
 // writeError writes the json-encoded error message to the
 // response.
-func writeError(w http.ResponseWriter, err error, status int) {
+func writeError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if apiVersion(r) >= apiV2 {
+		writeTypedError(w, r, err, status)
+		return
+	}
 	out := struct {
 		Message string `json:"error_msg"`
 	}{err.Error()}
 	WriteJSON(w, &out, status)
 }
+
+// writeTypedError writes the error using the typed error response of the v2 api.
+func writeTypedError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	out := api.ErrorResponse{
+		Error: api.Error{Code: api.ErrorCodeInternal, Message: err.Error()},
+	}
+	switch status {
+	case http.StatusBadRequest:
+		out.Error.Code = api.ErrorCodeBadRequest
+	case http.StatusNotFound:
+		out.Error.Code = api.ErrorCodeNotFound
+	case http.StatusRequestEntityTooLarge:
+		out.Error.Code = api.ErrorCodeTooLarge
+	case http.StatusServiceUnavailable:
+		out.Error.Code = api.ErrorCodeUnavailable
+	case http.StatusForbidden:
+		out.Error.Code = api.ErrorCodeBudgetExceeded
+	}
+	if e, ok := err.(*errors.BadRequestError); ok {
+		out.Error.Message = e.Msg
+		out.Error.Issues = e.Issues
+	}
+	WriteJSON(w, &out, status)
+}
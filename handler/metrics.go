@@ -0,0 +1,23 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/harness/lite-engine/internal/metrics"
+	"github.com/harness/lite-engine/logger"
+)
+
+// HandleMetrics returns an http.HandlerFunc that writes the metrics of the
+// engine in the Prometheus text exposition format.
+func HandleMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		if err := metrics.Write(w); err != nil {
+			logger.FromRequest(r).WithError(err).Errorln("api: cannot write the metrics")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/logger"
+	pruntime "github.com/harness/lite-engine/pipeline/runtime"
+)
+
+// HandlePause returns an http.HandlerFunc that pauses the running step
+// containers of the stage. The timeouts of the steps are suspended until
+// the stage is resumed.
+func HandlePause(engine *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := time.Now()
+
+		var p api.PauseRequest
+		if !decodeRequest(w, r, &p) {
+			return
+		}
+
+		pruntime.PauseDeadlines()
+		paused, err := engine.Pause(r.Context(), p.Checkpoint, p.StageID)
+		if err != nil {
+			pruntime.ResumeDeadlines()
+			logger.FromRequest(r).
+				WithField("latency", time.Since(st)).
+				WithError(err).
+				Errorln("api: failed to pause the stage")
+			WriteError(w, r, err)
+			return
+		}
+
+		resp := api.PauseResponse{}
+		for _, c := range paused {
+			resp.Containers = append(resp.Containers, api.PausedContainer{ID: c.ID, Checkpointed: c.Checkpoint != ""})
+		}
+		WriteJSON(w, resp, http.StatusOK)
+
+		logger.FromRequest(r).
+			WithField("latency", time.Since(st)).
+			WithField("containers", len(paused)).
+			Infoln("api: successfully paused the stage")
+	}
+}
+
+// HandleResume returns an http.HandlerFunc that resumes the paused step
+// containers of the stage.
+func HandleResume(engine *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := time.Now()
+
+		var p api.ResumeRequest
+		if !decodeRequest(w, r, &p) {
+			return
+		}
+
+		resumed, err := engine.Resume(r.Context(), p.StageID)
+		pruntime.ResumeDeadlines()
+		if err != nil {
+			logger.FromRequest(r).
+				WithField("latency", time.Since(st)).
+				WithError(err).
+				Errorln("api: failed to resume the stage")
+			WriteError(w, r, err)
+			return
+		}
+
+		resp := api.ResumeResponse{}
+		for _, c := range resumed {
+			resp.Containers = append(resp.Containers, c.ID)
+		}
+		WriteJSON(w, resp, http.StatusOK)
+
+		logger.FromRequest(r).
+			WithField("latency", time.Since(st)).
+			WithField("containers", len(resumed)).
+			Infoln("api: successfully resumed the stage")
+	}
+}
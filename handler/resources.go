@@ -0,0 +1,49 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/docker"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/logger"
+)
+
+// HandleListResources returns an http.HandlerFunc that lists the docker
+// resources created by the engine. The resources are filtered with the
+// label query parameters, eg. ?label=io.harness.lite-engine.stage=abc.
+func HandleListResources(engine *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		selectors := r.URL.Query()["label"]
+		for _, s := range selectors {
+			if _, _, err := labels.ParseSelector(s); err != nil {
+				WriteBadRequest(w, r, err)
+				return
+			}
+		}
+		res, err := engine.ListResources(r.Context(), selectors)
+		if err != nil {
+			logger.FromRequest(r).WithError(err).Errorln("api: failed to list the resources")
+			WriteError(w, r, err)
+			return
+		}
+		WriteJSON(w, api.ResourcesResponse{
+			Containers: toResources(res.Containers),
+			Volumes:    toResources(res.Volumes),
+			Networks:   toResources(res.Networks),
+		}, http.StatusOK)
+	}
+}
+
+func toResources(in []docker.Resource) []api.Resource {
+	var out []api.Resource
+	for _, r := range in {
+		out = append(out, api.Resource{ID: r.ID, Name: r.Name, Labels: r.Labels, State: r.State})
+	}
+	return out
+}
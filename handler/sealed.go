@@ -0,0 +1,26 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"github.com/harness/lite-engine/internal/sealed"
+)
+
+// openSealedEnvs opens the sealed envs of a request and adds them to its
+// envs and secrets, so that the values are masked in the logs.
+func openSealedEnvs(envs *map[string]string, secrets *[]string, sealedEnvs map[string]string) []string {
+	opened, issues := sealed.OpenEnvs(sealedEnvs)
+	if len(issues) > 0 {
+		return issues
+	}
+	for k, v := range opened {
+		if *envs == nil {
+			*envs = make(map[string]string, len(opened))
+		}
+		(*envs)[k] = v
+		*secrets = append(*secrets, v)
+	}
+	return nil
+}
@@ -6,24 +6,43 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/egress"
 	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/labels"
+	"github.com/harness/lite-engine/engine/lifecycle"
 	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/envelope"
+	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/internal/nudges"
+	"github.com/harness/lite-engine/internal/secretfile"
 	"github.com/harness/lite-engine/logger"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/logstream/sink"
+	"github.com/harness/lite-engine/notify"
 	"github.com/harness/lite-engine/osstats"
 	"github.com/harness/lite-engine/pipeline"
-	tiCfg "github.com/harness/lite-engine/ti/config"
+	pruntime "github.com/harness/lite-engine/pipeline/runtime"
+	"github.com/harness/lite-engine/registry"
+	"github.com/harness/lite-engine/ti"
+	"github.com/harness/lite-engine/version"
 )
 
 var (
 	statsInterval          = 30 * time.Second
 	harnessEnableDebugLogs = "HARNESS_ENABLE_DEBUG_LOGS"
+	// the egress proxy listens on the loopback, and on the gateway of the
+	// containers to be reachable from them
+	egressProxyAddr = "127.0.0.1:0"
+	// the setup waits at most for the nudges catalog
+	nudgesTimeout = 5 * time.Second
 )
 
 // HandleExecuteStep returns an http.HandlerFunc that executes a step
@@ -32,11 +51,111 @@ func HandleSetup(engine *engine.Engine) http.HandlerFunc {
 		st := time.Now()
 
 		var s api.SetupRequest
-		err := json.NewDecoder(r.Body).Decode(&s)
-		if err != nil {
-			WriteBadRequest(w, err)
+		if !decodeRequest(w, r, &s) {
+			return
+		}
+		if issues := openSealedEnvs(&s.Envs, &s.Secrets, s.SealedEnvs); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid sealed envs", Issues: issues})
+			return
+		}
+		s.SealedEnvs = nil
+		if s.Compatibility != nil {
+			if issues := version.Check(s.Compatibility.MinVersion, s.Compatibility.Features); len(issues) > 0 {
+				logger.FromRequest(r).
+					WithField("issues", issues).
+					Errorln("api: engine is incompatible with the runner")
+				WriteError(w, r, &errors.BadRequestError{Msg: "engine is incompatible with the runner", Issues: issues})
+				return
+			}
+		}
+		switch s.Backend {
+		case "", spec.BackendDocker:
+		case spec.BackendKubernetes: // the steps run as pods, there is no docker daemon to mount
+			mount := false
+			s.MountDockerSocket = &mount
+		default:
+			WriteError(w, r, &errors.BadRequestError{Msg: fmt.Sprintf("unsupported backend %q", s.Backend)})
+			return
+		}
+		switch s.Runtime {
+		case "", spec.RuntimeDocker:
+		case spec.RuntimeContainerd: // there is no docker daemon to mount
+			if s.Backend == spec.BackendKubernetes {
+				WriteError(w, r, &errors.BadRequestError{Msg: "the runtime cannot be set with the kubernetes backend"})
+				return
+			}
+			mount := false
+			s.MountDockerSocket = &mount
+		default:
+			WriteError(w, r, &errors.BadRequestError{Msg: fmt.Sprintf("unsupported runtime %q", s.Runtime)})
+			return
+		}
+		if s.EgressProxy && s.Backend == spec.BackendKubernetes {
+			WriteError(w, r, &errors.BadRequestError{Msg: "the egress proxy is not supported with the kubernetes backend"})
+			return
+		}
+		if s.UserNamespace != nil {
+			if issues := validateUserNamespace(&s); len(issues) > 0 {
+				WriteError(w, r, &errors.BadRequestError{Msg: "invalid user namespace", Issues: issues})
+				return
+			}
+		}
+		if s.Notify != nil {
+			if issues := notify.Validate(s.Notify); len(issues) > 0 {
+				WriteError(w, r, &errors.BadRequestError{Msg: "invalid notification", Issues: issues})
+				return
+			}
+		}
+		if issues := sink.Validate(s.LogConfig.Sinks); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid log sinks", Issues: issues})
+			return
+		}
+		if issues := logstream.ValidatePatterns(s.LogConfig.MaskPatterns, s.LogConfig.MaskPatternsFile); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid mask patterns", Issues: issues})
 			return
 		}
+		if s.LogConfig.HighEntropyMinLength < 0 || s.LogConfig.HighEntropyThreshold < 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "the high entropy min length and threshold cannot be negative"})
+			return
+		}
+		if s.LogConfig.BatchSize < 0 || s.LogConfig.FlushIntervalMs < 0 || s.LogConfig.UploadWorkers < 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "the log batch size, flush interval and upload workers cannot be negative"})
+			return
+		}
+		if s.Nudges != nil {
+			if issues := nudges.Validate(s.Nudges); len(issues) > 0 {
+				WriteError(w, r, &errors.BadRequestError{Msg: "invalid nudges catalog", Issues: issues})
+				return
+			}
+		}
+		if issues := registry.Validate(s.Registries); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid registries", Issues: issues})
+			return
+		}
+		for _, r := range s.Registries {
+			s.Secrets = append(s.Secrets, r.Password, r.ClientKey)
+		}
+		if issues := secretfile.Validate(s.SecretFiles); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid secret files", Issues: issues})
+			return
+		}
+		if issues := pruntime.ValidateStageBudget(s.Budget); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid stage budget", Issues: issues})
+			return
+		}
+		if issues := pruntime.ValidateTelemetrySampling(s.TelemetrySampling); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid telemetry sampling", Issues: issues})
+			return
+		}
+		var outputKey []byte
+		if s.OutputKey != "" {
+			key, err := envelope.ParseKey(s.OutputKey)
+			if err != nil {
+				WriteError(w, r, &errors.BadRequestError{Msg: "invalid output key", Issues: []string{err.Error()}})
+				return
+			}
+			outputKey = key
+		}
 		logProcess := false
 		if val, ok := s.Envs[harnessEnableDebugLogs]; ok && val == "true" {
 			logProcess = true
@@ -45,10 +164,17 @@ func HandleSetup(engine *engine.Engine) http.HandlerFunc {
 
 		setProxyEnvs(s.Envs)
 		state := pipeline.GetState()
-		state.Set(s.Secrets, s.LogConfig, getTiCfg(&s.TIConfig), collector)
+		state.Set(s.Secrets, s.LogConfig, ti.NewConfig(&s.TIConfig), collector)
+		state.SetNotify(s.Notify)
+		state.SetRegistries(s.Registries)
+		state.SetOutputKey(outputKey)
+		state.WatchSecretFiles(s.SecretFiles)
+		state.SetNudges(fetchNudges(r, s.Nudges))
+		pruntime.SetStageBudget(s.Budget)
+		pruntime.SetTelemetrySampling(s.TelemetrySampling, s.TIConfig.AccountID, s.TIConfig.PipelineID)
 
 		if s.MountDockerSocket == nil || *s.MountDockerSocket { // required to support m1 where docker isn't installed.
-			s.Volumes = append(s.Volumes, getDockerSockVolume())
+			s.Volumes = append(s.Volumes, getDockerSockVolume(engine.SocketPath()))
 		}
 		s.Volumes = append(s.Volumes, getSharedVolume())
 		cfg := &spec.PipelineConfig{
@@ -62,6 +188,25 @@ func HandleSetup(engine *engine.Engine) http.HandlerFunc {
 			Files:             s.Files,
 			EnableDockerSetup: s.MountDockerSocket,
 			TTY:               s.TTY,
+			EnvPassthrough:    s.EnvPassthrough,
+			Labels:            getStageLabels(&s),
+			Backend:           s.Backend,
+			Runtime:           s.Runtime,
+			OCIRuntimes:       s.OCIRuntimes,
+			UserNamespace:     s.UserNamespace,
+		}
+		proxy, err := startEgressProxy(s.EgressProxy)
+		if err != nil {
+			logger.FromRequest(r).WithError(err).Errorln("api: cannot start the egress proxy")
+			WriteError(w, r, err)
+			return
+		}
+		if proxy != nil {
+			cfg.EgressProxyPort = proxy.Port()
+			cfg.EgressProxyCredential = proxy.Credential()
+			// the credential is in the proxy envs of the steps.
+			_, password, _ := strings.Cut(cfg.EgressProxyCredential, ":")
+			state.AddSecrets(cfg.EgressProxyCredential, password)
 		}
 		collector.Start()
 		if err := engine.Setup(r.Context(), cfg); err != nil {
@@ -69,12 +214,26 @@ func HandleSetup(engine *engine.Engine) http.HandlerFunc {
 				WithField("latency", time.Since(st)).
 				WithField("time", time.Now().Format(time.RFC3339)).
 				WithField("error", err).
-				WithField("cfg", cfg).
+				WithField("cfg", redactedConfig(cfg)).
 				Infoln("api: failed stage setup")
-			WriteError(w, err)
+			WriteError(w, r, err)
 			return
 		}
-		WriteJSON(w, api.SetupResponse{}, http.StatusOK)
+		if s.ImageCache != nil && engine.ImageCacheSupported() {
+			importCachedImages(r, engine, s.ImageCache.Dir)
+		}
+		lifecycle.Setup(r.Context(), &s)
+		fingerprint := osstats.Fingerprint()
+		if s.MountDockerSocket == nil || *s.MountDockerSocket {
+			if v, err := engine.DockerVersion(r.Context()); err == nil {
+				fingerprint.DockerVersion = v
+			}
+		}
+		WriteJSON(w, api.SetupResponse{
+			Fingerprint: fingerprint,
+			Version:     version.Version,
+			Features:    version.Features,
+		}, http.StatusOK)
 		logger.FromRequest(r).
 			WithField("latency", time.Since(st)).
 			WithField("time", time.Now().Format(time.RFC3339)).
@@ -82,6 +241,101 @@ func HandleSetup(engine *engine.Engine) http.HandlerFunc {
 	}
 }
 
+// startEgressProxy starts the egress proxy of the stage if enabled. The
+// proxy of a previous stage which was not destroyed is closed.
+// redactedConfig returns a copy of the pipeline config to log, without the
+// credential of the egress proxy.
+func redactedConfig(cfg *spec.PipelineConfig) *spec.PipelineConfig {
+	c := *cfg
+	c.EgressProxyCredential = logstream.Redact(c.EgressProxyCredential, []string{c.EgressProxyCredential})
+	return &c
+}
+
+func startEgressProxy(enabled bool) (*egress.Proxy, error) {
+	state := pipeline.GetState()
+	if prev := state.GetEgressProxy(); prev != nil {
+		prev.Close()
+		state.SetEgressProxy(nil)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	gateway, err := egress.BridgeGateway()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	if gateway != "" {
+		hosts = append(hosts, gateway)
+	}
+	proxy, err := egress.New(egressProxyAddr, hosts...)
+	if err != nil {
+		return nil, err
+	}
+	proxy.Start()
+	state.SetEgressProxy(proxy)
+	return proxy, nil
+}
+
+// importCachedImages loads the images cached by the previous stages. A
+// failure is only logged, the images are pulled by the steps instead.
+func importCachedImages(r *http.Request, engine *engine.Engine, dir string) {
+	st := time.Now()
+	n, err := engine.ImportImages(r.Context(), dir)
+	if err != nil {
+		logger.FromRequest(r).WithError(err).WithField("dir", dir).
+			Warnln("api: cannot import the cached images")
+		return
+	}
+	logger.FromRequest(r).
+		WithField("latency", time.Since(st)).
+		WithField("dir", dir).
+		WithField("archives", n).
+		Infoln("api: imported the cached images")
+}
+
+// fetchNudges returns the nudges of the catalog, if any. A failure is only
+// logged, the nudges of the catalog fetched last are used, if any.
+func fetchNudges(r *http.Request, cfg *api.NudgeCatalog) []logstream.Nudge {
+	if cfg == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), nudgesTimeout)
+	defer cancel()
+	catalog, err := nudges.Default.Fetch(ctx, cfg)
+	if err != nil {
+		logger.FromRequest(r).WithError(err).WithField("nudges", len(catalog)).
+			Warnln("api: cannot fetch the nudges catalog")
+	}
+	return catalog
+}
+
+// validateUserNamespace returns the issues of the user namespace of the
+// stage, only supported by the docker backend on linux.
+func validateUserNamespace(s *api.SetupRequest) []string {
+	var issues []string
+	if s.Backend == spec.BackendKubernetes || s.Runtime == spec.RuntimeContainerd || runtime.GOOS == "windows" {
+		issues = append(issues, "the user namespace is only supported by the docker backend on linux")
+	}
+	if m := s.UserNamespace.Mode; m != "" && m != "host" {
+		issues = append(issues, fmt.Sprintf("unsupported user namespace mode %q", m))
+	}
+	if s.UserNamespace.UID < 0 || s.UserNamespace.GID < 0 {
+		issues = append(issues, "the uid and gid cannot be negative")
+	}
+	return issues
+}
+
+// getStageLabels returns the labels applied to the docker resources of
+// the stage.
+func getStageLabels(s *api.SetupRequest) map[string]string {
+	stage := s.StageRuntimeID
+	if stage == "" {
+		stage = s.TIConfig.StageID
+	}
+	return labels.ForStage(s.TIConfig.AccountID, s.TIConfig.PipelineID, stage)
+}
+
 func getSharedVolume() *spec.Volume {
 	return &spec.Volume{
 		HostPath: &spec.VolumeHostPath{
@@ -92,11 +346,7 @@ func getSharedVolume() *spec.Volume {
 	}
 }
 
-func getDockerSockVolume() *spec.Volume {
-	path := engine.DockerSockUnixPath
-	if runtime.GOOS == "windows" {
-		path = engine.DockerSockWinPath
-	}
+func getDockerSockVolume(path string) *spec.Volume {
 	return &spec.Volume{
 		HostPath: &spec.VolumeHostPath{
 			Name: engine.DockerSockVolName,
@@ -112,9 +362,3 @@ func setProxyEnvs(environment map[string]string) {
 		os.Setenv(v, environment[v])
 	}
 }
-
-func getTiCfg(t *api.TIConfig) tiCfg.Cfg {
-	cfg := tiCfg.New(t.URL, t.Token, t.AccountID, t.OrgID, t.ProjectID, t.PipelineID, t.BuildID, t.StageID, t.Repo,
-		t.Sha, t.CommitLink, t.SourceBranch, t.TargetBranch, t.CommitBranch, pipeline.SharedVolPath, t.ParseSavings, false)
-	return cfg
-}
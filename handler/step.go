@@ -5,7 +5,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"io"
 	"net/http"
 	"runtime"
@@ -14,6 +13,7 @@ import (
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/engine"
 	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/errors"
 	"github.com/harness/lite-engine/logger"
 	"github.com/harness/lite-engine/pipeline"
 	pruntime "github.com/harness/lite-engine/pipeline/runtime"
@@ -25,11 +25,14 @@ func HandleStartStep(e *pruntime.StepExecutor) http.HandlerFunc {
 		st := time.Now()
 
 		var s api.StartStepRequest
-		err := json.NewDecoder(r.Body).Decode(&s)
-		if err != nil {
-			WriteBadRequest(w, err)
+		if !decodeRequest(w, r, &s) {
+			return
+		}
+		if issues := openSealedEnvs(&s.Envs, &s.Secrets, s.SealedEnvs); len(issues) > 0 {
+			WriteError(w, r, &errors.BadRequestError{Msg: "invalid sealed envs", Issues: issues})
 			return
 		}
+		s.SealedEnvs = nil
 
 		if s.MountDockerSocket == nil || *s.MountDockerSocket { // required to support m1 where docker isn't installed.
 			s.Volumes = append(s.Volumes, getDockerSockVolumeMount())
@@ -37,6 +40,7 @@ func HandleStartStep(e *pruntime.StepExecutor) http.HandlerFunc {
 
 		s.Volumes = append(s.Volumes, getSharedVolumeMount())
 
+		var err error
 		// Stage runtime id will only flow when distributed dlite is enabled
 		if s.StageRuntimeID != "" {
 			err = e.StartStepWithStatusUpdate(r.Context(), &s)
@@ -45,9 +49,9 @@ func HandleStartStep(e *pruntime.StepExecutor) http.HandlerFunc {
 		}
 
 		if err != nil {
-			WriteError(w, err)
+			WriteError(w, r, err)
 		} else {
-			WriteJSON(w, api.StartStepResponse{}, http.StatusOK)
+			WriteJSON(w, api.StartStepResponse{LogKey: s.LogKey}, http.StatusOK)
 		}
 
 		logger.FromRequest(r).
@@ -63,14 +67,12 @@ func HandlePollStep(e *pruntime.StepExecutor) http.HandlerFunc {
 		st := time.Now()
 
 		var s api.PollStepRequest
-		err := json.NewDecoder(r.Body).Decode(&s)
-		if err != nil {
-			WriteBadRequest(w, err)
+		if !decodeRequest(w, r, &s) {
 			return
 		}
 
 		if response, err := e.PollStep(r.Context(), &s); err != nil {
-			WriteError(w, err)
+			WriteError(w, r, err)
 		} else {
 			WriteJSON(w, response, http.StatusOK)
 		}
@@ -87,9 +89,7 @@ func HandleStreamOutput(e *pruntime.StepExecutor) http.HandlerFunc {
 		st := time.Now()
 
 		var s api.StreamOutputRequest
-		err := json.NewDecoder(r.Body).Decode(&s)
-		if err != nil {
-			WriteBadRequest(w, err)
+		if !decodeRequest(w, r, &s) {
 			return
 		}
 
@@ -100,15 +100,15 @@ func HandleStreamOutput(e *pruntime.StepExecutor) http.HandlerFunc {
 
 		oldData, newData, err := e.StreamOutput(r.Context(), &s)
 		if err != nil {
-			WriteError(w, err)
+			WriteError(w, r, err)
 			return
 		}
 
 		flusher, _ := w.(http.Flusher)
 		output = w
 
-		_, _ = output.Write(oldData)
-		count += len(oldData)
+		n, _ := io.Copy(output, oldData)
+		count += int(n)
 		if flusher != nil {
 			flusher.Flush()
 		}
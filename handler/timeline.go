@@ -0,0 +1,82 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/harness/lite-engine/errors"
+)
+
+const shortContainerID = 12
+
+// HandleTimeline returns an http.HandlerFunc that returns the timeline of
+// the steps of the current or of the last stage, in json or, with
+// ?format=dot, as a graphviz graph.
+func HandleTimeline() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "dot" {
+			WriteBadRequest(w, r, fmt.Errorf("unsupported timeline format %q", format))
+			return
+		}
+		t := lifecycle.Timeline()
+		if t == nil {
+			WriteNotFound(w, r, &errors.NotFoundError{Msg: "no stage timeline"})
+			return
+		}
+		if format != "dot" {
+			WriteJSON(w, t, http.StatusOK)
+			return
+		}
+		for k, val := range noCacheHeaders {
+			w.Header().Set(k, val)
+		}
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(timelineDOT(t))) //nolint:errcheck
+	}
+}
+
+// timelineDOT returns the graphviz graph of the timeline, the steps are
+// labelled with their durations and linked to the steps they depend on.
+func timelineDOT(t *api.TimelineResponse) string {
+	var b strings.Builder
+	b.WriteString("digraph stage {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf("stage %s", formatMs(t.DurationMs)))
+	for _, s := range t.Steps {
+		name := s.Name
+		if name == "" {
+			name = s.ID
+		}
+		lines := []string{name, fmt.Sprintf("%s, %s", s.Status, formatMs(s.DurationMs))}
+		if s.ContainerID != "" {
+			id := s.ContainerID
+			if len(id) > shortContainerID {
+				id = id[:shortContainerID]
+			}
+			lines = append(lines, "container "+id)
+		}
+		for _, p := range s.Phases {
+			lines = append(lines, fmt.Sprintf("%s %s", p.Name, formatMs(p.DurationMs)))
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", s.ID, strings.Join(lines, "\n"))
+	}
+	for _, s := range t.Steps {
+		for _, dep := range s.DependsOn {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", dep, s.ID)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func formatMs(ms int64) string {
+	return fmt.Sprintf("%.1fs", float64(ms)/1000) //nolint:gomnd
+}
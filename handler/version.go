@@ -0,0 +1,36 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+type apiVersionKey struct{}
+
+// withAPIVersion returns a middleware which serves the requests with the given api version.
+func withAPIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), apiVersionKey{}, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiVersion returns the api version the request is served with. Responses
+// are written using the v1 shapes unless a version is set explicitly.
+func apiVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return apiV1
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package charset transcodes the output and the reports of the steps
+// written in legacy encodings, eg. Shift-JIS or GBK, to UTF-8.
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Env overrides the charset of the output and the reports of a step, the
+// charset of the locale of the step is used if not set.
+const Env = "HARNESS_OUTPUT_CHARSET"
+
+// localeEnvs are the variables of the locale, in order of precedence.
+var localeEnvs = []string{"LC_ALL", "LC_CTYPE", "LANG"}
+
+// aliases are the names of the charsets used by the locales and unknown
+// to the WHATWG encoding standard.
+var aliases = map[string]string{
+	"utf8":   "utf-8",
+	"eucjp":  "euc-jp",
+	"euckr":  "euc-kr",
+	"euccn":  "gb2312",
+	"euctw":  "big5",
+	"cp936":  "gbk",
+	"cp932":  "shift_jis",
+	"cp949":  "euc-kr",
+	"cp950":  "big5",
+	"cp1252": "windows-1252",
+}
+
+// xmlEncoding matches the encoding of the XML declaration.
+var xmlEncoding = regexp.MustCompile(`^(\s*<\?xml[^>]*\sencoding\s*=\s*["'])([A-Za-z0-9._:-]+)(["'])`)
+
+// Lookup returns the encoding of the charset name, eg. shift_jis or gbk. It
+// returns nil for UTF-8, which needs no transcoding.
+func Lookup(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", name)
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// FromEnvs returns the encoding of the output of a step with the envs:
+// the charset of Env if set, else the charset of the locale, eg. SJIS for
+// ja_JP.SJIS. It returns nil for UTF-8 and for an unknown locale charset.
+func FromEnvs(envs map[string]string) (encoding.Encoding, error) {
+	if name := envs[Env]; name != "" {
+		return Lookup(name)
+	}
+	for _, k := range localeEnvs {
+		locale := envs[k]
+		if locale == "" {
+			continue
+		}
+		// language_territory.charset@modifier
+		if i := strings.IndexByte(locale, '@'); i >= 0 {
+			locale = locale[:i]
+		}
+		i := strings.IndexByte(locale, '.')
+		if i < 0 {
+			return nil, nil
+		}
+		enc, err := Lookup(locale[i+1:])
+		if err != nil {
+			return nil, nil
+		}
+		return enc, nil
+	}
+	return nil, nil
+}
+
+// writer transcodes the data written to UTF-8.
+type writer struct {
+	mu sync.Mutex
+	w  *transform.Writer
+}
+
+// NewWriter returns a writer transcoding the data written in the encoding
+// to UTF-8. The sequences split across writes are buffered, Close writes
+// the end of the data. Close does not close w.
+func NewWriter(w io.Writer, enc encoding.Encoding) io.WriteCloser {
+	return &writer{w: transform.NewWriter(w, enc.NewDecoder())}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func (w *writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Close()
+}
+
+// NewXMLReader returns a reader of the XML document in UTF-8. The encoding
+// of the document is detected from its byte order mark or its declaration,
+// the document is transcoded and its declaration rewritten to UTF-8. A
+// document with neither is transcoded from the fallback encoding, if any,
+// unless it is valid UTF-8.
+func NewXMLReader(r io.Reader, fallback encoding.Encoding) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(512) //nolint:gomnd
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	var enc encoding.Encoding
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		enc = unicode.UTF8BOM
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	default:
+		if m := xmlEncoding.FindSubmatch(head); m != nil {
+			if enc, err = Lookup(string(m[2])); err != nil {
+				return nil, err
+			}
+			if enc == nil {
+				return br, nil
+			}
+		} else if fallback != nil {
+			data, rerr := io.ReadAll(br)
+			if rerr != nil {
+				return nil, rerr
+			}
+			if utf8.Valid(data) {
+				return bytes.NewReader(data), nil
+			}
+			return transform.NewReader(bytes.NewReader(data), fallback.NewDecoder()), nil
+		} else {
+			return br, nil
+		}
+	}
+	return &declReader{r: transform.NewReader(br, enc.NewDecoder())}, nil
+}
+
+// declReader rewrites the encoding of the XML declaration of the
+// transcoded document to UTF-8.
+type declReader struct {
+	r    io.Reader
+	head *bytes.Reader
+}
+
+func (d *declReader) Read(p []byte) (int, error) {
+	if d.head == nil {
+		buf := make([]byte, 512) //nolint:gomnd
+		n, err := io.ReadFull(d.r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		d.head = bytes.NewReader(xmlEncoding.ReplaceAll(buf[:n], []byte("${1}UTF-8${3}")))
+	}
+	if d.head.Len() > 0 {
+		return d.head.Read(p)
+	}
+	return d.r.Read(p)
+}
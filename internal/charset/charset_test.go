@@ -0,0 +1,96 @@
+package charset
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	data, err := enc.NewEncoder().Bytes([]byte(s))
+	require.NoError(t, err)
+	return data
+}
+
+func TestLookup(t *testing.T) {
+	enc, err := Lookup("Shift_JIS")
+	assert.NoError(t, err)
+	assert.Equal(t, japanese.ShiftJIS, enc)
+	enc, err = Lookup("eucJP")
+	assert.NoError(t, err)
+	assert.Equal(t, japanese.EUCJP, enc)
+	enc, err = Lookup("UTF8")
+	assert.NoError(t, err)
+	assert.Nil(t, enc)
+	_, err = Lookup("klingon")
+	assert.EqualError(t, err, `unknown charset "klingon"`)
+}
+
+func TestFromEnvs(t *testing.T) {
+	tests := []struct {
+		envs map[string]string
+		enc  encoding.Encoding
+		err  bool
+	}{
+		{envs: nil},
+		{envs: map[string]string{"LANG": "en_US.UTF-8"}},
+		{envs: map[string]string{"LANG": "C"}},
+		{envs: map[string]string{"LANG": "ja_JP.SJIS"}, enc: japanese.ShiftJIS},
+		{envs: map[string]string{"LANG": "ja_JP.SJIS", "LC_ALL": "zh_CN.GBK"}, enc: simplifiedchinese.GBK},
+		{envs: map[string]string{"LANG": "de_DE.unknown@euro"}},
+		{envs: map[string]string{"LANG": "ja_JP.SJIS", Env: "utf-8"}},
+		{envs: map[string]string{Env: "gbk"}, enc: simplifiedchinese.GBK},
+		{envs: map[string]string{Env: "unknown"}, err: true},
+	}
+	for _, test := range tests {
+		enc, err := FromEnvs(test.envs)
+		assert.Equal(t, test.err, err != nil, test.envs)
+		assert.Equal(t, test.enc, enc, test.envs)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	data := encode(t, japanese.ShiftJIS, "テスト成功\n")
+	var out bytes.Buffer
+	w := NewWriter(&out, japanese.ShiftJIS)
+	// a character split across writes
+	for _, b := range data {
+		_, err := w.Write([]byte{b})
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, "テスト成功\n", out.String())
+}
+
+func TestNewXMLReader(t *testing.T) {
+	read := func(data []byte, fallback encoding.Encoding) string {
+		r, err := NewXMLReader(bytes.NewReader(data), fallback)
+		require.NoError(t, err)
+		out, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	declared := encode(t, japanese.ShiftJIS, `<?xml version="1.0" encoding="Shift_JIS"?><testcase name="テスト"/>`)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?><testcase name="テスト"/>`, read(declared, nil))
+
+	utf16 := encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), `<?xml version="1.0" encoding="UTF-16"?><a>é</a>`)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?><a>é</a>`, read(utf16, nil))
+
+	undeclared := encode(t, simplifiedchinese.GBK, `<testcase name="测试"/>`)
+	assert.Equal(t, `<testcase name="测试"/>`, read(undeclared, simplifiedchinese.GBK))
+	assert.Equal(t, string(undeclared), read(undeclared, nil))
+
+	valid := `<?xml version="1.0"?><testcase name="测试"/>`
+	assert.Equal(t, valid, read([]byte(valid), simplifiedchinese.GBK))
+
+	_, err := NewXMLReader(bytes.NewReader([]byte(`<?xml version="1.0" encoding="klingon"?><a/>`)), nil)
+	assert.Error(t, err)
+}
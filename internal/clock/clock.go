@@ -0,0 +1,96 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package clock abstracts the time functions used by the timeouts, polls
+// and retries, so they can be tested with a fake clock.
+package clock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time and waits.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+	Sleep(d time.Duration)
+}
+
+// Timer is a timer of a clock.
+type Timer interface {
+	C() <-chan time.Time // nil for the timers of AfterFunc
+	Stop() bool
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// WithTimeout is context.WithTimeout with the timeout measured by the
+// clock.
+func WithTimeout(parent context.Context, c Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, c, c.Now().Add(timeout))
+}
+
+// WithDeadline is context.WithDeadline with the deadline measured by the
+// clock. The context returns context.DeadlineExceeded once the deadline
+// passed.
+func WithDeadline(parent context.Context, c Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+	ctx, cancel := context.WithCancel(parent)
+	d := &deadlineCtx{Context: ctx, deadline: deadline}
+	t := c.AfterFunc(deadline.Sub(c.Now()), func() {
+		d.expire()
+		cancel()
+	})
+	return d, func() {
+		t.Stop()
+		cancel()
+	}
+}
+
+// deadlineCtx is a context canceled by a clock at its deadline.
+type deadlineCtx struct {
+	context.Context
+	deadline time.Time
+	expired  int32
+}
+
+func (d *deadlineCtx) Deadline() (time.Time, bool) { return d.deadline, true }
+
+func (d *deadlineCtx) expire() { atomic.StoreInt32(&d.expired, 1) }
+
+func (d *deadlineCtx) Err() error {
+	err := d.Context.Err()
+	if err == context.Canceled && atomic.LoadInt32(&d.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock whose time only moves when advanced, for deterministic
+// tests of the timeouts, polls and retries.
+type Fake struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake returns a fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+type fakeTimer struct {
+	f  *Fake
+	at time.Time
+	c  chan time.Time
+	fn func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	for i, w := range t.f.timers {
+		if w == t {
+			t.f.timers = append(t.f.timers[:i], t.f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+
+func (f *Fake) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C() }
+
+func (f *Fake) Sleep(d time.Duration) { <-f.After(d) }
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(d, &fakeTimer{f: f, c: make(chan time.Time, 1)})
+}
+
+// AfterFunc calls fn from Advance once the time reaches d, or right away
+// if d is not positive.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(d, &fakeTimer{f: f, fn: fn})
+}
+
+func (f *Fake) add(d time.Duration, t *fakeTimer) Timer {
+	f.mu.Lock()
+	t.at = f.now.Add(d)
+	if d <= 0 {
+		now := f.now
+		f.mu.Unlock()
+		t.fire(now)
+		return t
+	}
+	f.timers = append(f.timers, t)
+	f.cond.Broadcast()
+	f.mu.Unlock()
+	return t
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	t.c <- now
+}
+
+// Advance moves the time forward by d, firing the timers due in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.timers, func(i, j int) bool { return f.timers[i].at.Before(f.timers[j].at) })
+		if len(f.timers) == 0 || f.timers[0].at.After(end) {
+			break
+		}
+		t := f.timers[0]
+		f.timers = f.timers[1:]
+		if t.at.After(f.now) {
+			f.now = t.at
+		}
+		now := f.now
+		f.mu.Unlock()
+		t.fire(now)
+		f.mu.Lock()
+	}
+	f.now = end
+	f.mu.Unlock()
+}
+
+// BlockUntil waits until n timers are pending, eg. until the goroutines
+// under test wait on the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeTimers(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewFake(start)
+
+	first := f.NewTimer(time.Second)
+	second := f.NewTimer(2 * time.Second)
+	fired := false
+	f.AfterFunc(3*time.Second, func() { fired = true })
+
+	f.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-first.C())
+	assert.True(t, second.Stop())
+	assert.False(t, second.Stop())
+	assert.False(t, fired)
+
+	f.Advance(5 * time.Second)
+	assert.True(t, fired)
+	assert.Equal(t, 6*time.Second, f.Since(start))
+	select {
+	case <-second.C():
+		t.Error("a stopped timer fired")
+	default:
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	done := make(chan struct{})
+	go func() {
+		f.Sleep(time.Minute)
+		close(done)
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	<-done
+}
+
+func TestWithDeadline(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+
+	ctx, cancel := WithTimeout(context.Background(), f, time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(60, 0), deadline)
+	f.Advance(59 * time.Second)
+	assert.Nil(t, ctx.Err())
+	f.Advance(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	ctx, cancel = WithTimeout(context.Background(), f, time.Minute)
+	cancel()
+	assert.Equal(t, context.Canceled, ctx.Err())
+	f.Advance(time.Hour)
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package fault injects failures and delays into the calls of the engine
+// to the docker daemon, the log service and the TI service, to test the
+// retries and fallbacks deterministically. It is only available in the
+// binaries built with the faultinject tag.
+package fault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The targets of the fault injection.
+const (
+	Docker    = "docker"
+	LogStream = "logstream"
+	TI        = "ti"
+)
+
+// Rule is the fault injected into the calls to a target.
+type Rule struct {
+	Probability float64       // of a call to fail
+	Delay       time.Duration // added to every call
+}
+
+// Error is an injected failure.
+type Error struct {
+	Target string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("fault injected into the %s call", e.Target)
+}
+
+var (
+	mu    sync.Mutex
+	rules map[string]Rule
+	rnd   *rand.Rand
+)
+
+// Configure enables the fault injection with the rules of the spec, a
+// comma separated list of target:probability[:delay], eg.
+// docker:0.2,logstream:0:2s,ti:1. The failures are drawn from a random
+// source with the seed, so a run is reproducible. An empty spec disables
+// the fault injection.
+func Configure(spec string, seed int64) error {
+	parsed, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	if len(parsed) > 0 && !available {
+		return fmt.Errorf("fault injection is not available, the engine must be built with the faultinject tag")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	rules = parsed
+	rnd = rand.New(rand.NewSource(seed)) //nolint:gosec
+	return nil
+}
+
+// Parse parses the rules of a spec.
+func Parse(spec string) (map[string]Rule, error) {
+	out := make(map[string]Rule)
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid fault rule %q, expected target:probability[:delay]", s)
+		}
+		switch parts[0] {
+		case Docker, LogStream, TI:
+		default:
+			return nil, fmt.Errorf("invalid fault target %q", parts[0])
+		}
+		p, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("invalid fault probability %q", parts[1])
+		}
+		rule := Rule{Probability: p}
+		if len(parts) == 3 {
+			if rule.Delay, err = time.ParseDuration(parts[2]); err != nil {
+				return nil, fmt.Errorf("invalid fault delay %q", parts[2])
+			}
+		}
+		out[parts[0]] = rule
+	}
+	return out, nil
+}
+
+// Enabled returns true if faults are injected into the calls to target.
+func Enabled(target string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := rules[target]
+	return ok
+}
+
+// Inject delays the call to target by the delay of its rule, and returns
+// an *Error if the call is drawn to fail.
+func Inject(ctx context.Context, target string) error {
+	mu.Lock()
+	rule, ok := rules[target]
+	fail := ok && rnd.Float64() < rule.Probability
+	mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if rule.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rule.Delay):
+		}
+	}
+	if fail {
+		return &Error{Target: target}
+	}
+	return nil
+}
+
+// HTTPClient returns a copy of the client injecting the faults of target
+// as 500 responses, or the client itself if target has no rule.
+func HTTPClient(target string, c *http.Client) *http.Client {
+	if !Enabled(target) {
+		return c
+	}
+	out := *c
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	out.Transport = &transport{target: target, base: base}
+	return &out
+}
+
+type transport struct {
+	target string
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := Inject(req.Context(), t.target); err != nil {
+		if _, ok := err.(*Error); !ok {
+			return nil, err
+		}
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		msg := err.Error()
+		return &http.Response{
+			Status:        "500 Internal Server Error",
+			StatusCode:    http.StatusInternalServerError,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain"}},
+			Body:          io.NopCloser(bytes.NewBufferString(msg)),
+			ContentLength: int64(len(msg)),
+			Request:       req,
+		}, nil
+	}
+	return t.base.RoundTrip(req)
+}
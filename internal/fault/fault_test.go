@@ -0,0 +1,105 @@
+package fault
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setRules enables the rules regardless of the build tags.
+func setRules(t *testing.T, r map[string]Rule, seed int64) {
+	mu.Lock()
+	rules, rnd = r, rand.New(rand.NewSource(seed)) //nolint:gosec
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		rules = nil
+		mu.Unlock()
+	})
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse("docker:0.2, logstream:0:2s,ti:1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Rule{
+		Docker:    {Probability: 0.2},
+		LogStream: {Delay: 2 * time.Second},
+		TI:        {Probability: 1},
+	}, rules)
+
+	rules, err = Parse("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, spec := range []string{"docker", "docker:2", "docker:x", "docker:0.1:soon", "dns:0.1", "docker:0.1:1s:x"} {
+		_, err = Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	assert.NoError(t, Configure("", 1))
+	assert.False(t, Enabled(Docker))
+
+	err := Configure("docker:1", 1)
+	if available {
+		assert.NoError(t, err)
+		assert.True(t, Enabled(Docker))
+		assert.NoError(t, Configure("", 1))
+	} else {
+		assert.Error(t, err)
+		assert.False(t, Enabled(Docker))
+	}
+}
+
+func TestInjectDeterministic(t *testing.T) {
+	draw := func() []bool {
+		setRules(t, map[string]Rule{Docker: {Probability: 0.5}}, 42)
+		var out []bool
+		for i := 0; i < 20; i++ {
+			out = append(out, Inject(context.Background(), Docker) != nil)
+		}
+		return out
+	}
+	first := draw()
+	assert.Equal(t, first, draw())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+
+	// targets without a rule are never affected
+	assert.NoError(t, Inject(context.Background(), TI))
+}
+
+func TestInjectDelay(t *testing.T) {
+	setRules(t, map[string]Rule{LogStream: {Delay: time.Hour}}, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Inject(ctx, LogStream), context.DeadlineExceeded)
+}
+
+func TestHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{}
+	assert.Same(t, c, HTTPClient(TI, c))
+
+	setRules(t, map[string]Rule{TI: {Probability: 1}}, 1)
+	resp, err := HTTPClient(TI, c).Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	setRules(t, map[string]Rule{TI: {Probability: 0}}, 1)
+	resp, err = HTTPClient(TI, c).Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,9 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !faultinject
+
+package fault
+
+const available = false
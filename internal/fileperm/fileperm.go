@@ -0,0 +1,56 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package fileperm provides the umask applied to the modes of the files and
+// directories created by the engine, eg. the host volumes and the step
+// files. Unlike the umask of the process it also applies to the modes set
+// with chmod.
+package fileperm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// DefaultUmask is the umask of the engine if none is configured, the files
+// and directories are not writable by the group and the other users.
+const DefaultUmask os.FileMode = 0o022
+
+var umask atomic.Uint32
+
+func init() {
+	SetUmask(DefaultUmask)
+}
+
+// SetUmask sets the umask of the engine, DefaultUmask by default.
+func SetUmask(mask os.FileMode) {
+	umask.Store(uint32(mask.Perm()))
+}
+
+// Umask returns the umask of the engine.
+func Umask() os.FileMode {
+	return os.FileMode(umask.Load())
+}
+
+// Mode returns the mode with the umask of the engine applied.
+func Mode(mode os.FileMode) os.FileMode {
+	return Apply(mode, Umask())
+}
+
+// Apply returns the mode with the umask applied, the type and special
+// bits of the mode are kept.
+func Apply(mode, mask os.FileMode) os.FileMode {
+	return mode &^ mask.Perm()
+}
+
+// Parse parses an octal umask, eg. 0027 or 027.
+func Parse(s string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0o777 {
+		return 0, fmt.Errorf("invalid umask %q", s)
+	}
+	return os.FileMode(v), nil
+}
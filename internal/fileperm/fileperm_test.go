@@ -0,0 +1,34 @@
+package fileperm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]os.FileMode{"0027": 0o027, "022": 0o022, "0": 0, "777": 0o777} {
+		got, err := Parse(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "0028", "1000", "-1", "u=rwx"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMode(t *testing.T) {
+	defer SetUmask(DefaultUmask)
+	assert.Equal(t, os.FileMode(0o755), Mode(0o777))
+
+	SetUmask(0)
+	assert.Equal(t, os.FileMode(0o777), Mode(0o777))
+
+	SetUmask(0o027)
+	assert.Equal(t, os.FileMode(0o750), Mode(0o777))
+	assert.Equal(t, os.FileMode(0o640), Mode(0o644))
+	assert.Equal(t, os.ModeDir|0o750, Mode(os.ModeDir|0o777))
+	assert.Equal(t, os.FileMode(0o700), Apply(0o777, 0o077))
+}
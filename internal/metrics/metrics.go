@@ -0,0 +1,260 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package metrics provides the counters, gauges and histograms of the
+// engine, written in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets are the buckets, in seconds, of the durations from the
+// log service requests to the steps.
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// Status returns the status label of an operation: succeeded, or failed
+// if err is not nil.
+func Status(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+var (
+	mu         sync.Mutex
+	collectors []collector
+)
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func register(c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// Write writes the registered metrics to w.
+func Write(w io.Writer) error {
+	mu.Lock()
+	cs := append([]collector{}, collectors...)
+	mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// desc is the name, the help and the label names of a metric, and its
+// series by label values.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]interface{}
+}
+
+func newDesc(name, help, kind string, labels []string) desc {
+	return desc{name: name, help: help, kind: kind, labels: labels, series: map[string]interface{}{}}
+}
+
+// get returns the series of the label values, created with newSeries if
+// it does not exist. It needs to be called with mu held.
+func (d *desc) get(values []string, newSeries func() interface{}) interface{} {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s needs %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := d.series[key]
+	if !ok {
+		s = newSeries()
+		d.series[key] = s
+	}
+	return s
+}
+
+// each calls fn with the label pairs of the series, sorted by label values.
+func (d *desc) each(w *bufio.Writer, fn func(labels string, s interface{})) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+	keys := make([]string, 0, len(d.series))
+	for k := range d.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var values []string
+		if len(d.labels) > 0 {
+			values = strings.Split(k, "\xff")
+		}
+		fn(labelPairs(d.labels, values), d.series[k])
+	}
+}
+
+// Counter is a counter partitioned by label values.
+type Counter struct {
+	desc
+}
+
+// NewCounter registers a new counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: newDesc(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+// Add adds v to the counter of the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(values, func() interface{} { return new(float64) }).(*float64) += v
+}
+
+// Inc increments the counter of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.each(w, func(labels string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(*s.(*float64)))
+	})
+}
+
+// Gauge is a gauge partitioned by label values.
+type Gauge struct {
+	desc
+}
+
+// NewGauge registers a new gauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: newDesc(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+// Add adds v, which can be negative, to the gauge of the label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(values, func() interface{} { return new(float64) }).(*float64) += v
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(values, func() interface{} { return new(float64) }).(*float64) = v
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.each(w, func(labels string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(*s.(*float64)))
+	})
+}
+
+// Histogram is a histogram partitioned by label values.
+type Histogram struct {
+	desc
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // the observations of each bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a new histogram with the upper bounds of the
+// buckets, sorted in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: newDesc(name, help, "histogram", labels), buckets: buckets}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(values, func() interface{} { return &histogram{counts: make([]uint64, len(h.buckets))} }).(*histogram)
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.each(w, func(labels string, v interface{}) {
+		s := v.(*histogram)
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	})
+}
+
+func labelPairs(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeValue(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+var (
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_steps_total", "The steps executed.", "kind", "status")
+	g := NewGauge("test_steps_in_flight", "The steps running.")
+	h := NewHistogram("test_step_duration_seconds", "The duration of the steps.", []float64{1, 10}, "kind")
+	NewCounter("test_unused_total", "Not written without series.")
+
+	c.Inc("run", "succeeded")
+	c.Inc("run", "succeeded")
+	c.Inc("run", `fail"ed`)
+	g.Add(2)
+	g.Add(-1)
+	h.Observe(0.5, "run")
+	h.Observe(1, "run")
+	h.Observe(20, "run")
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf))
+	assert.Equal(t, `# HELP test_steps_total The steps executed.
+# TYPE test_steps_total counter
+test_steps_total{kind="run",status="fail\"ed"} 1
+test_steps_total{kind="run",status="succeeded"} 2
+# HELP test_steps_in_flight The steps running.
+# TYPE test_steps_in_flight gauge
+test_steps_in_flight 1
+# HELP test_step_duration_seconds The duration of the steps.
+# TYPE test_step_duration_seconds histogram
+test_step_duration_seconds_bucket{kind="run",le="1"} 2
+test_step_duration_seconds_bucket{kind="run",le="10"} 2
+test_step_duration_seconds_bucket{kind="run",le="+Inf"} 3
+test_step_duration_seconds_sum{kind="run"} 21.5
+test_step_duration_seconds_count{kind="run"} 3
+`, buf.String())
+}
+
+func TestLabelValues(t *testing.T) {
+	c := NewCounter("test_labels_total", "Labels.", "kind")
+	assert.Panics(t, func() { c.Inc() })
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package nudges fetches the catalog of the known failure patterns of the
+// steps, and their resolutions, from the pipeline service so that the
+// catalog is updated without a new release of the engine.
+package nudges
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/harness/lite-engine/logstream"
+)
+
+const (
+	// SignatureHeader is the header of the base64 ed25519 signature of
+	// the catalog.
+	SignatureHeader = "X-Signature"
+	// DefaultTTL is the duration the catalog is used before it is fetched
+	// again.
+	DefaultTTL = time.Hour
+
+	maxCatalogSize = 1 << 20
+)
+
+var (
+	errSignature        = errors.New("invalid signature of the nudges catalog")
+	errMissingSignature = errors.New("the nudges catalog is not signed")
+	errInsecure         = errors.New("the nudges catalog needs to be an https url")
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+type (
+	// Catalog is the document of the nudges.
+	Catalog struct {
+		Nudges []Entry `json:"nudges"`
+	}
+
+	// Entry is a nudge of the catalog: the lines of the logs matching the
+	// search regular expression fail the step with the error and the
+	// resolution.
+	Entry struct {
+		Search     string `json:"search"`
+		Resolution string `json:"resolution"`
+		Error      string `json:"error"`
+	}
+)
+
+// Validate returns the issues of the catalog configuration. The catalog is
+// fetched over https and verified with the public key.
+func Validate(cfg *api.NudgeCatalog) []string {
+	var issues []string
+	if !secure(cfg.URL) {
+		issues = append(issues, errInsecure.Error())
+	}
+	if _, err := publicKey(cfg.PublicKey); err != nil {
+		issues = append(issues, err.Error())
+	}
+	return issues
+}
+
+func secure(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// cached is a catalog fetched.
+type cached struct {
+	nudges  []logstream.Nudge
+	etag    string
+	fetched time.Time
+}
+
+// Fetcher fetches the catalogs and caches them for their ttl, the catalogs
+// are then revalidated with their etag.
+type Fetcher struct {
+	clock  clock.Clock
+	ttl    time.Duration
+	client *http.Client
+
+	mu     sync.Mutex
+	cached map[api.NudgeCatalog]*cached
+}
+
+// NewFetcher returns a fetcher caching the catalogs for the ttl.
+func NewFetcher(ttl time.Duration) *Fetcher {
+	return &Fetcher{clock: clock.Real, ttl: ttl, client: httpClient, cached: make(map[api.NudgeCatalog]*cached)}
+}
+
+// Default is the fetcher of the engine.
+var Default = NewFetcher(DefaultTTL)
+
+// Fetch returns the nudges of the catalog. The catalog fetched last is
+// returned with the error if it cannot be fetched again, eg. if the
+// pipeline service is unreachable. The catalog is fetched without holding
+// the lock of the cache, the setups of the other stages do not wait for it.
+func (f *Fetcher) Fetch(ctx context.Context, cfg *api.NudgeCatalog) ([]logstream.Nudge, error) {
+	f.mu.Lock()
+	c := f.cached[*cfg]
+	f.mu.Unlock()
+	if c != nil && f.clock.Since(c.fetched) < f.ttl {
+		return c.nudges, nil
+	}
+	etag := ""
+	if c != nil {
+		etag = c.etag
+	}
+	next, err := fetch(ctx, f.client, cfg, etag)
+	if err != nil {
+		if c != nil {
+			return c.nudges, err
+		}
+		return nil, err
+	}
+	if next == nil { // not modified
+		next = &cached{nudges: c.nudges, etag: c.etag}
+	}
+	next.fetched = f.clock.Now()
+	f.mu.Lock()
+	f.cached[*cfg] = next
+	f.mu.Unlock()
+	return next.nudges, nil
+}
+
+// fetch returns the catalog, nil if it was not modified since the etag.
+func fetch(ctx context.Context, client *http.Client, cfg *api.NudgeCatalog, etag string) (*cached, error) {
+	if !secure(cfg.URL) {
+		return nil, errInsecure
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("cannot fetch the nudges catalog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, nil
+	}
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		return nil, fmt.Errorf("cannot fetch the nudges catalog: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the nudges catalog: %w", err)
+	}
+	if len(data) > maxCatalogSize {
+		return nil, fmt.Errorf("the nudges catalog is larger than %d bytes", maxCatalogSize)
+	}
+	if err := verify(cfg.PublicKey, data, resp.Header.Get(SignatureHeader)); err != nil {
+		return nil, err
+	}
+	nudges, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &cached{nudges: nudges, etag: resp.Header.Get("ETag")}, nil
+}
+
+// parse returns the nudges of the catalog, the entries with an invalid
+// search expression are skipped.
+func parse(data []byte) ([]logstream.Nudge, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("cannot decode the nudges catalog: %w", err)
+	}
+	nudges := make([]logstream.Nudge, 0, len(c.Nudges))
+	for _, e := range c.Nudges {
+		if e.Search == "" {
+			continue
+		}
+		if _, err := regexp.Compile(e.Search); err != nil {
+			continue
+		}
+		nudges = append(nudges, logstream.NewNudge(e.Search, e.Resolution, errors.New(e.Error)))
+	}
+	return nudges, nil
+}
+
+func publicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("the public key of the nudges catalog needs to be a base64 ed25519 public key")
+	}
+	return key, nil
+}
+
+// verify checks the base64 ed25519 signature of the catalog.
+func verify(key string, data []byte, signature string) error {
+	pub, err := publicKey(key)
+	if err != nil {
+		return err
+	}
+	if signature == "" {
+		return errMissingSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(pub, data, sig) {
+		return errSignature
+	}
+	return nil
+}
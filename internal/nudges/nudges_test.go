@@ -0,0 +1,118 @@
+package nudges
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+const catalog = `{"nudges":[
+	{"search":"ENOSPC","resolution":"Increase the disk of the stage","error":"no space left on device"},
+	{"search":"(unclosed","resolution":"skipped","error":"invalid"}
+]}`
+
+func TestValidate(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(pub)
+	assert.Empty(t, Validate(&api.NudgeCatalog{URL: "https://app.harness.io/nudges.json", PublicKey: key}))
+	assert.Equal(t, []string{
+		"the nudges catalog needs to be an https url",
+		"the public key of the nudges catalog needs to be a base64 ed25519 public key",
+	}, Validate(&api.NudgeCatalog{URL: "http://app.harness.io/nudges.json"}))
+}
+
+func TestFetch(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(catalog)))
+
+	requests, revalidated := 0, 0
+	fail := false
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case fail:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set(SignatureHeader, signature)
+			w.Write([]byte(catalog)) //nolint:errcheck
+		}
+	}))
+	defer srv.Close()
+
+	fake := clock.NewFake(time.Now())
+	f := NewFetcher(time.Hour)
+	f.clock = fake
+	f.client = srv.Client()
+	cfg := &api.NudgeCatalog{URL: srv.URL, PublicKey: base64.StdEncoding.EncodeToString(pub)}
+
+	nudges, err := f.Fetch(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Len(t, nudges, 1)
+	assert.Equal(t, "ENOSPC", nudges[0].GetSearch())
+	assert.Equal(t, "Increase the disk of the stage", nudges[0].GetResolution())
+	assert.EqualError(t, nudges[0].GetError(), "no space left on device")
+
+	// cached for the ttl, then revalidated
+	_, err = f.Fetch(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	fake.Advance(time.Hour)
+	nudges, err = f.Fetch(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Len(t, nudges, 1)
+	assert.Equal(t, 1, revalidated)
+
+	// the catalog fetched last is kept if the service fails
+	fail = true
+	fake.Advance(time.Hour)
+	nudges, err = f.Fetch(context.Background(), cfg)
+	assert.EqualError(t, err, "cannot fetch the nudges catalog: 502 Bad Gateway")
+	assert.Len(t, nudges, 1)
+}
+
+func TestFetchInvalidSignature(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, other, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(other, []byte(catalog)))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/unsigned" {
+			w.Header().Set(SignatureHeader, signature)
+		}
+		w.Write([]byte(catalog)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(time.Hour)
+	f.client = srv.Client()
+	key := base64.StdEncoding.EncodeToString(pub)
+	nudges, err := f.Fetch(context.Background(), &api.NudgeCatalog{URL: srv.URL, PublicKey: key})
+	assert.Equal(t, errSignature, err)
+	assert.Empty(t, nudges)
+
+	nudges, err = f.Fetch(context.Background(), &api.NudgeCatalog{URL: srv.URL + "/unsigned", PublicKey: key})
+	assert.Equal(t, errMissingSignature, err)
+	assert.Empty(t, nudges)
+}
+
+func TestFetchInsecure(t *testing.T) {
+	_, err := NewFetcher(time.Hour).Fetch(context.Background(), &api.NudgeCatalog{URL: "http://app.harness.io/nudges.json"})
+	assert.Equal(t, errInsecure, err)
+}
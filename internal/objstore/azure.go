@@ -0,0 +1,203 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+)
+
+const azureVersion = "2021-08-06"
+
+// container is an azure blob storage container, the requests are signed
+// with the shared key of the account or authorized by a shared access
+// signature.
+type container struct {
+	cfg      *api.Storage
+	endpoint *url.URL
+	key      []byte // decoded account key
+	now      func() time.Time
+}
+
+func newContainer(cfg *api.Storage) (*container, error) {
+	c := &container{cfg: cfg, now: time.Now}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.Account)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.endpoint = u
+	if cfg.AccountKey != "" {
+		if c.key, err = base64.StdEncoding.DecodeString(cfg.AccountKey); err != nil {
+			return nil, fmt.Errorf("invalid azure account key: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *container) url(name string) *url.URL {
+	u := *c.endpoint
+	setPath(&u, c.cfg.Bucket+"/"+objectName(c.cfg.Prefix, name))
+	return &u
+}
+
+func (c *container) URL(name string) string {
+	return c.url(name).String()
+}
+
+func (c *container) request(ctx context.Context, method, name string, query url.Values, body io.Reader, size int64,
+	contentType string) (*http.Request, error) {
+	u := c.url(name)
+	params := []string{strings.TrimPrefix(c.cfg.SASToken, "?"), query.Encode()}
+	u.RawQuery = strings.Trim(strings.Join(params, "&"), "&")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Ms-Version", azureVersion)
+	req.Header.Set("X-Ms-Date", c.now().UTC().Format(http.TimeFormat))
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+		if query == nil {
+			req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+		}
+	}
+	c.sign(req)
+	return req, nil
+}
+
+// sign signs the request with the shared key of the account, if set.
+func (c *container) sign(req *http.Request) {
+	if c.key != nil {
+		signature := base64.StdEncoding.EncodeToString(hmacSHA256(c.key, sharedKeyString(req, c.cfg.Account)))
+		req.Header.Set("Authorization", "SharedKey "+c.cfg.Account+":"+signature)
+	}
+}
+
+func (c *container) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := c.request(ctx, http.MethodGet, name, nil, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return get(req)
+}
+
+func (c *container) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	if size > maxPutSize {
+		return c.putBlocks(ctx, name, r, size, contentType)
+	}
+	req, err := c.request(ctx, http.MethodPut, name, nil, io.NopCloser(r), size, contentType)
+	if err != nil {
+		return err
+	}
+	return put(req)
+}
+
+// putBlocks uploads the blob block by block and commits the block list, the
+// uncommitted blocks are garbage collected by the service.
+func (c *container) putBlocks(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	ids, err := putParts(ctx, r, size, func(ctx context.Context, n int, part io.Reader, size int64) (string, error) {
+		// the ids of the blocks of a blob have the same length
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", n)))
+		query := url.Values{"comp": {"block"}, "blockid": {id}}
+		req, err := c.request(ctx, http.MethodPut, name, query, part, size, "application/octet-stream")
+		if err != nil {
+			return "", err
+		}
+		return id, put(req)
+	})
+	if err != nil {
+		return err
+	}
+	list := struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: ids}
+	body, err := xml.Marshal(list)
+	if err != nil {
+		return err
+	}
+	req, err := c.request(ctx, http.MethodPut, name, url.Values{"comp": {"blocklist"}}, bytes.NewReader(body),
+		int64(len(body)), "application/xml")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Ms-Blob-Content-Type", contentType)
+	c.sign(req) // with the content type of the blob
+	return put(req)
+}
+
+func (c *container) Exists(ctx context.Context, name string) (bool, error) {
+	req, err := c.request(ctx, http.MethodHead, name, nil, nil, 0, "")
+	if err != nil {
+		return false, err
+	}
+	return exists(req)
+}
+
+// sharedKeyString returns the string signed with the shared key of the
+// account for the request.
+func sharedKeyString(req *http.Request, account string) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	var b strings.Builder
+	for _, v := range []string{req.Method, h.Get("Content-Encoding"), h.Get("Content-Language"), length,
+		h.Get("Content-MD5"), h.Get("Content-Type"), "", h.Get("If-Modified-Since"), h.Get("If-Match"),
+		h.Get("If-None-Match"), h.Get("If-Unmodified-Since"), h.Get("Range")} {
+		b.WriteString(v + "\n")
+	}
+
+	var names []string
+	for k := range h {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+
+	b.WriteString("/" + account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		values := query[k]
+		sort.Strings(values)
+		b.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(values, ","))
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,59 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedKeyString(t *testing.T) {
+	c, err := newContainer(&api.Storage{Kind: api.StorageAzure, Account: "ci", Bucket: "artifacts",
+		AccountKey: base64.StdEncoding.EncodeToString([]byte("key"))})
+	require.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	req, err := c.request(context.Background(), http.MethodPut, "builds/42/app.tar", nil, bytes.NewReader([]byte("app")), 3, "application/x-tar")
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://ci.blob.core.windows.net/artifacts/builds/42/app.tar", req.URL.String())
+	assert.Equal(t, "PUT\n\n\n3\n\napplication/x-tar\n\n\n\n\n\n\n"+
+		"x-ms-blob-type:BlockBlob\nx-ms-date:Tue, 02 Jan 2024 03:04:05 GMT\nx-ms-version:2021-08-06\n"+
+		"/ci/artifacts/builds/42/app.tar", sharedKeyString(req, "ci"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "SharedKey ci:"))
+}
+
+func TestContainer_SASToken(t *testing.T) {
+	var query, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, auth = r.URL.RawQuery, r.Header.Get("Authorization")
+		assert.Equal(t, "BlockBlob", r.Header.Get("X-Ms-Blob-Type"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	s, err := New(&api.Storage{Kind: api.StorageAzure, Endpoint: srv.URL + "/ci", Bucket: "artifacts", SASToken: "?sv=2021&sig=secret"})
+	require.NoError(t, err)
+	require.NoError(t, s.Put(context.Background(), "app.tar", bytes.NewReader([]byte("app")), 3, "application/x-tar"))
+	assert.Equal(t, "sv=2021&sig=secret", query)
+	assert.Empty(t, auth)
+	assert.Equal(t, srv.URL+"/ci/artifacts/app.tar", s.URL("app.tar"), "the url does not hold the signature")
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate(&api.Storage{Kind: api.StorageAzure, Account: "ci", Bucket: "artifacts"}, "storage"))
+	assert.Equal(t, []string{
+		"storage bucket needs to be set",
+		"storage account needs to be set",
+		"storage account_key and sas_token cannot both be set",
+	}, Validate(&api.Storage{Kind: api.StorageAzure, AccountKey: "a2V5", SASToken: "sig=x"}, "storage"))
+	assert.Equal(t, []string{"storage path needs to be an absolute path", "storage endpoint needs to be an http or https url"},
+		Validate(&api.Storage{Kind: api.StorageLocal, Path: "cache", Endpoint: "minio:9000"}, "storage"))
+	assert.Equal(t, []string{`unsupported storage "ftp"`}, Validate(&api.Storage{Kind: "ftp"}, "storage"))
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/safepath"
+)
+
+const dirPerm = 0700
+
+// local stores the objects in a directory of the host, eg. a volume shared
+// by the stages of the host.
+type local struct {
+	dir    string
+	prefix string
+}
+
+func (l *local) path(name string) (string, error) {
+	return safepath.Confine(l.URL(name), l.dir)
+}
+
+func (l *local) URL(name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(objectName(l.prefix, name)))
+}
+
+func (l *local) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	path, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Put writes the object to a temporary file renamed once complete, so that
+// the concurrent readers never read a partial object.
+func (l *local) Put(_ context.Context, name string, r io.Reader, _ int64, _ string) error {
+	path, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), fileperm.Mode(dirPerm)); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".object-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *local) Exists(_ context.Context, name string) (bool, error) {
+	path, err := l.path(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// the objects larger than maxPutSize are uploaded in parts, a single PUT is
+// limited to 5 GiB by s3 and to 5000 MiB by azure.
+var (
+	maxPutSize int64 = 5000 << 20
+	partSize   int64 = 256 << 20
+)
+
+// the maximum number of parts of an object, for s3 and azure.
+const maxParts = 10000
+
+// partSizeFor returns the size of the parts of an object of the size.
+func partSizeFor(size int64) int64 {
+	if n := (size + maxParts - 1) / maxParts; n > partSize {
+		return n
+	}
+	return partSize
+}
+
+// putParts reads the object of the size from r and uploads it part by part
+// with putPart, the parts are numbered from 1. It returns the ids of the
+// uploaded parts in order.
+func putParts(ctx context.Context, r io.Reader, size int64,
+	putPart func(ctx context.Context, n int, part io.Reader, size int64) (string, error)) ([]string, error) {
+	var ids []string
+	chunk := partSizeFor(size)
+	for n, offset := 1, int64(0); offset < size; n++ {
+		length := chunk
+		if size-offset < length {
+			length = size - offset
+		}
+		id, err := putPart(ctx, n, io.NopCloser(io.LimitReader(r, length)), length)
+		if err != nil {
+			return nil, fmt.Errorf("cannot upload the part %d of the object: %w", n, err)
+		}
+		ids = append(ids, id)
+		offset += length
+	}
+	return ids, nil
+}
@@ -0,0 +1,147 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withPartSizes(t *testing.T, maxPut, part int64) {
+	prevMax, prevPart := maxPutSize, partSize
+	maxPutSize, partSize = maxPut, part
+	t.Cleanup(func() { maxPutSize, partSize = prevMax, prevPart })
+}
+
+// multipartAPI serves the multipart uploads of s3 and the blocks of azure.
+type multipartAPI struct {
+	mu      sync.Mutex
+	parts   map[string][]byte
+	objects map[string][]byte
+	aborted bool
+	fail    string // the part number failing to upload, if set
+}
+
+func (m *multipartAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := r.URL.Query()
+	data, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>up1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Get("uploadId") == "up1":
+		if q.Get("partNumber") == m.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		m.parts[q.Get("partNumber")] = data
+		w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "up1":
+		var complete struct {
+			Parts []struct {
+				PartNumber string
+				ETag       string
+			} `xml:"Part"`
+		}
+		_ = xml.Unmarshal(data, &complete)
+		var object []byte
+		for _, p := range complete.Parts {
+			if p.ETag != `"etag-`+p.PartNumber+`"` {
+				fmt.Fprint(w, `<Error><Code>InvalidPart</Code><Message>invalid etag</Message></Error>`)
+				return
+			}
+			object = append(object, m.parts[p.PartNumber]...)
+		}
+		m.objects[r.URL.Path] = object
+		fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Get("uploadId") == "up1":
+		m.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && q.Get("comp") == "block":
+		m.parts[q.Get("blockid")] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && q.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string
+		}
+		_ = xml.Unmarshal(data, &list)
+		var object []byte
+		for _, id := range list.Latest {
+			object = append(object, m.parts[id]...)
+		}
+		m.objects[r.URL.Path] = object
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newMultipartAPI(t *testing.T) (*multipartAPI, string) {
+	m := &multipartAPI{parts: make(map[string][]byte), objects: make(map[string][]byte)}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return m, srv.URL
+}
+
+func TestBucketMultipart(t *testing.T) {
+	withPartSizes(t, 8, 4)
+	m, endpoint := newMultipartAPI(t)
+	b, err := New(&api.Storage{Kind: api.StorageS3, Endpoint: endpoint, PathStyle: true, Bucket: "ci-cache",
+		AccessKey: "key", SecretKey: "secret"})
+	require.NoError(t, err)
+
+	object := "0123456789"
+	require.NoError(t, b.Put(context.Background(), "go.tar.zst", strings.NewReader(object), int64(len(object)), "application/zstd"))
+	assert.Equal(t, object, string(m.objects["/ci-cache/go.tar.zst"]))
+	assert.Len(t, m.parts, 3)
+	assert.False(t, m.aborted)
+}
+
+func TestBucketMultipartAbort(t *testing.T) {
+	withPartSizes(t, 8, 4)
+	m, endpoint := newMultipartAPI(t)
+	m.fail = "2"
+	b, err := New(&api.Storage{Kind: api.StorageS3, Endpoint: endpoint, PathStyle: true, Bucket: "ci-cache"})
+	require.NoError(t, err)
+
+	err = b.Put(context.Background(), "go.tar.zst", strings.NewReader("0123456789"), 10, "application/zstd")
+	assert.ErrorContains(t, err, "cannot upload the part 2 of the object")
+	assert.True(t, m.aborted)
+	assert.Empty(t, m.objects)
+}
+
+func TestContainerBlocks(t *testing.T) {
+	withPartSizes(t, 8, 4)
+	m, endpoint := newMultipartAPI(t)
+	s, err := New(&api.Storage{Kind: api.StorageAzure, Endpoint: endpoint + "/ci", Bucket: "artifacts",
+		AccountKey: base64.StdEncoding.EncodeToString([]byte("key")), Account: "ci"})
+	require.NoError(t, err)
+
+	object := "0123456789"
+	require.NoError(t, s.Put(context.Background(), "app.tar", bytes.NewReader([]byte(object)), int64(len(object)), "application/x-tar"))
+	assert.Equal(t, object, string(m.objects["/ci/artifacts/app.tar"]))
+	var ids []string
+	for id := range m.parts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	assert.Equal(t, []string{"MDAwMDAwMDE=", "MDAwMDAwMDI=", "MDAwMDAwMDM="}, ids)
+}
+
+func TestPartSizeFor(t *testing.T) {
+	assert.Equal(t, partSize, partSizeFor(1<<30))
+	assert.Equal(t, int64(5<<40)/maxParts+1, partSizeFor(5<<40))
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package objstore reads and writes the objects of a storage of the steps,
+// eg. their caches and their uploaded artifacts: a directory of the host,
+// an s3 compatible bucket or an azure blob storage container. The requests
+// are signed in the engine, without the sdks of the clouds.
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/api"
+)
+
+// ErrNotFound is returned if an object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Store reads and writes the objects of a storage by name, a slash
+// separated path relative to the prefix of the storage.
+type Store interface {
+	// Get returns the content of the object, ErrNotFound if it does not
+	// exist.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put writes the object of the size.
+	Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error
+	// Exists returns true if the object exists.
+	Exists(ctx context.Context, name string) (bool, error)
+	// URL returns the location of the object, without the credentials.
+	URL(name string) string
+}
+
+var httpClient = &http.Client{}
+
+// New returns the store of the storage.
+func New(cfg *api.Storage) (Store, error) {
+	switch cfg.Kind {
+	case api.StorageLocal:
+		return &local{dir: cfg.Path, prefix: cfg.Prefix}, nil
+	case api.StorageS3, api.StorageGCS:
+		return newBucket(cfg)
+	case api.StorageAzure:
+		return newContainer(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported storage %q", cfg.Kind)
+	}
+}
+
+// Validate returns the issues of the storage configuration, prefixed with
+// what the storage is for, eg. cache backend.
+func Validate(cfg *api.Storage, what string) []string {
+	var issues []string
+	switch cfg.Kind {
+	case api.StorageLocal:
+		if !filepath.IsAbs(cfg.Path) {
+			issues = append(issues, what+" path needs to be an absolute path")
+		}
+	case api.StorageS3, api.StorageGCS:
+		if cfg.Bucket == "" {
+			issues = append(issues, what+" bucket needs to be set")
+		}
+	case api.StorageAzure:
+		if cfg.Bucket == "" {
+			issues = append(issues, what+" bucket needs to be set")
+		}
+		if cfg.Account == "" && cfg.Endpoint == "" {
+			issues = append(issues, what+" account needs to be set")
+		}
+		if cfg.AccountKey != "" && cfg.SASToken != "" {
+			issues = append(issues, what+" account_key and sas_token cannot both be set")
+		}
+	default:
+		return []string{fmt.Sprintf("unsupported %s %q", what, cfg.Kind)}
+	}
+	if cfg.Endpoint != "" && !isHTTP(cfg.Endpoint) {
+		issues = append(issues, what+" endpoint needs to be an http or https url")
+	}
+	return issues
+}
+
+// do sends the request, the error does not hold the url.
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := httpClient.Do(req)
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	return resp, err
+}
+
+// get returns the body of the response of the GET request.
+func get(req *http.Request) (io.ReadCloser, error) {
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot download the object: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// put sends the PUT request.
+func put(req *http.Request) error {
+	resp, err := send(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sendXML sends a request of an upload and decodes the xml of the response.
+func sendXML(req *http.Request, v interface{}) error {
+	resp, err := send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// send sends a request of an upload and returns the response if successful,
+// its body is closed by the caller.
+func send(req *http.Request) (*http.Response, error) {
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot upload the object: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// exists sends the HEAD request.
+func exists(req *http.Request) (bool, error) {
+	resp, err := do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode/100 == 2: //nolint:gomnd
+		return true, nil
+	default:
+		return false, fmt.Errorf("cannot check the object: %s", resp.Status)
+	}
+}
+
+func isHTTP(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,230 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/awssig"
+)
+
+const (
+	gcsEndpoint   = "https://storage.googleapis.com"
+	defaultRegion = "us-east-1"
+)
+
+// bucket is an s3 compatible bucket, the requests are signed with the
+// signature version 4. The gcs buckets are accessed with their HMAC keys
+// through the interoperable XML api.
+type bucket struct {
+	cfg      *api.Storage
+	endpoint *url.URL
+	region   string
+	now      func() time.Time
+}
+
+func newBucket(cfg *api.Storage) (*bucket, error) {
+	b := &bucket{cfg: cfg, region: cfg.Region, now: time.Now}
+	endpoint := cfg.Endpoint
+	switch {
+	case endpoint != "":
+	case cfg.Kind == api.StorageGCS:
+		endpoint = gcsEndpoint
+	default:
+		region := cfg.Region
+		if region == "" {
+			region = defaultRegion
+		}
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	b.endpoint = u
+	if b.region == "" {
+		b.region = defaultRegion
+		if cfg.Kind == api.StorageGCS {
+			b.region = "auto"
+		}
+	}
+	return b, nil
+}
+
+// url returns the url of the object, in the path style or the virtual
+// hosted style.
+func (b *bucket) url(name string) *url.URL {
+	object := objectName(b.cfg.Prefix, name)
+	u := *b.endpoint
+	if b.cfg.PathStyle || b.cfg.Kind == api.StorageGCS {
+		object = b.cfg.Bucket + "/" + object
+	} else {
+		u.Host = b.cfg.Bucket + "." + u.Host
+	}
+	setPath(&u, object)
+	return &u
+}
+
+func (b *bucket) URL(name string) string {
+	return b.url(name).String()
+}
+
+func (b *bucket) request(ctx context.Context, method, name string, query url.Values, body io.Reader, size int64,
+	contentType string) (*http.Request, error) {
+	u := b.url(name)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	if b.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.cfg.SessionToken)
+	}
+	if b.cfg.AccessKey != "" {
+		awssig.Sign(req, b.cfg.AccessKey, b.cfg.SecretKey, b.region, "s3", awssig.UnsignedPayload, b.now())
+	}
+	return req, nil
+}
+
+func (b *bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := b.request(ctx, http.MethodGet, name, nil, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return get(req)
+}
+
+func (b *bucket) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	if size > maxPutSize {
+		return b.putMultipart(ctx, name, r, size, contentType)
+	}
+	req, err := b.request(ctx, http.MethodPut, name, nil, io.NopCloser(r), size, contentType)
+	if err != nil {
+		return err
+	}
+	return put(req)
+}
+
+// putMultipart uploads the object with a multipart upload, aborted if a
+// part cannot be uploaded.
+func (b *bucket) putMultipart(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	req, err := b.request(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	var upload struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err = sendXML(req, &upload); err != nil {
+		return err
+	}
+
+	etags, err := putParts(ctx, r, size, func(ctx context.Context, n int, part io.Reader, size int64) (string, error) {
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {upload.UploadID}}
+		req, err := b.request(ctx, http.MethodPut, name, query, part, size, "application/octet-stream") //nolint:govet
+		if err != nil {
+			return "", err
+		}
+		resp, err := send(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.Header.Get("ETag"), nil
+	})
+	if err == nil {
+		err = b.completeMultipart(ctx, name, upload.UploadID, etags)
+	}
+	if err != nil {
+		// the parts uploaded are billed until the upload is aborted
+		if req, aerr := b.request(context.Background(), http.MethodDelete, name, url.Values{"uploadId": {upload.UploadID}}, nil, 0, ""); aerr == nil {
+			if resp, aerr := do(req); aerr == nil {
+				resp.Body.Close()
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// completeMultipart assembles the parts of the multipart upload.
+func (b *bucket) completeMultipart(ctx context.Context, name, uploadID string, etags []string) error {
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for i, etag := range etags {
+		complete.Parts = append(complete.Parts, part{PartNumber: i + 1, ETag: etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	req, err := b.request(ctx, http.MethodPost, name, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body),
+		int64(len(body)), "application/xml")
+	if err != nil {
+		return err
+	}
+	// the completion may fail after the response status is sent
+	var result struct {
+		XMLName xml.Name
+		Message string
+	}
+	if err = sendXML(req, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("cannot complete the upload of the object: %s", result.Message)
+	}
+	return nil
+}
+
+func (b *bucket) Exists(ctx context.Context, name string) (bool, error) {
+	req, err := b.request(ctx, http.MethodHead, name, nil, nil, 0, "")
+	if err != nil {
+		return false, err
+	}
+	return exists(req)
+}
+
+// objectName returns the name of the object in the bucket or the container.
+func objectName(prefix, name string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(prefix, "/")+"/"+name, "/")
+}
+
+// setPath appends the object to the path of the url. All the characters
+// but the unreserved ones are escaped, as in the canonical requests.
+func setPath(u *url.URL, object string) {
+	var escaped strings.Builder
+	for _, c := range []byte(object) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	rawBase := strings.TrimSuffix(u.EscapedPath(), "/")
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + object
+	u.RawPath = rawBase + "/" + escaped.String()
+}
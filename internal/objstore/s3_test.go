@@ -0,0 +1,79 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type objects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string
+}
+
+func (o *objects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.auth = append(o.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		o.objects[r.URL.Path] = data
+	case http.MethodGet, http.MethodHead:
+		data, ok := o.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	o := &objects{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+	b, err := New(&api.Storage{Kind: api.StorageS3, Endpoint: srv.URL, PathStyle: true,
+		Bucket: "ci-cache", Prefix: "lite-engine/", AccessKey: "key", SecretKey: "secret"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = b.Get(ctx, "go/v1.tar.zst")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, b.Put(ctx, "go/v1.tar.zst", bytes.NewReader([]byte("archive")), 7, "application/zstd"))
+	ok, err := b.Exists(ctx, "go/v1.tar.zst")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	rc, err := b.Get(ctx, "go/v1.tar.zst")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "archive", string(data))
+
+	assert.Contains(t, o.objects, "/ci-cache/lite-engine/go/v1.tar.zst")
+	for _, auth := range o.auth {
+		assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/"), auth)
+	}
+}
+
+func TestBucketURL(t *testing.T) {
+	s3, err := newBucket(&api.Storage{Kind: api.StorageS3, Bucket: "ci-cache", Region: "eu-west-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ci-cache.s3.eu-west-1.amazonaws.com/go/v1.tar.zst", s3.URL("go/v1.tar.zst"))
+	assert.Equal(t, "https://ci-cache.s3.eu-west-1.amazonaws.com/reports/test%20%281%29.html", s3.URL("reports/test (1).html"))
+
+	gcs, err := newBucket(&api.Storage{Kind: api.StorageGCS, Bucket: "ci-cache", Prefix: "caches"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://storage.googleapis.com/ci-cache/caches/go/v1.tar.zst", gcs.URL("go/v1.tar.zst"))
+	assert.Equal(t, "auto", gcs.region)
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package retry provides context aware retries with jittered exponential
+// backoff, along with counters of the retries performed per operation.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+const (
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 60 * time.Second
+	defaultMultiplier      = 1.5
+)
+
+// Policy configures the retries of an operation. The zero value retries
+// until the context is done, starting with an interval of 500ms.
+type Policy struct {
+	InitialInterval time.Duration // interval before the first retry
+	MaxInterval     time.Duration // upper bound of the interval between retries
+	Multiplier      float64       // growth factor of the interval, 1 for a constant interval
+	Jitter          float64       // randomization factor of the interval, between 0 and 1
+	MaxAttempts     int           // maximum number of attempts, 0 for unlimited
+	MaxElapsedTime  time.Duration // maximum time spent retrying, 0 for unlimited
+	Clock           clock.Clock   // clock measuring the intervals, nil for the wall clock
+}
+
+// Exponential returns the policy used by most call sites, retrying with
+// exponential backoff for at most maxElapsedTime (0 for unlimited).
+func Exponential(maxElapsedTime time.Duration) Policy {
+	return Policy{
+		InitialInterval: defaultInitialInterval,
+		MaxInterval:     defaultMaxInterval,
+		Multiplier:      defaultMultiplier,
+		Jitter:          0.5, //nolint:gomnd
+		MaxElapsedTime:  maxElapsedTime,
+	}
+}
+
+// Constant returns a policy making at most attempts attempts, waiting
+// interval between each of them.
+func Constant(attempts int, interval time.Duration) Policy {
+	return Policy{
+		InitialInterval: interval,
+		Multiplier:      1,
+		MaxAttempts:     attempts,
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err to stop retrying. Do returns the wrapped error.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the policy is
+// exhausted or the context is done. The attempts are recorded under name.
+// The error of the last attempt is returned.
+func Do(ctx context.Context, name string, p Policy, fn func(ctx context.Context) error) error {
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.Real
+	}
+	start := clk.Now()
+	interval := p.InitialInterval
+	if interval <= 0 {
+		interval = defaultInitialInterval
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		record(name, attempt, err)
+		if err == nil {
+			return nil
+		}
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			return perr.err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+
+		wait := jitter(interval, p.Jitter)
+		if p.MaxElapsedTime > 0 && clk.Since(start)+wait > p.MaxElapsedTime {
+			return err
+		}
+		t := clk.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C():
+		}
+		interval = next(interval, p)
+	}
+}
+
+func next(interval time.Duration, p Policy) time.Duration {
+	if p.Multiplier > 1 {
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+	return interval
+}
+
+func jitter(interval time.Duration, factor float64) time.Duration {
+	if factor <= 0 {
+		return interval
+	}
+	if factor > 1 {
+		factor = 1
+	}
+	delta := factor * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*(2*delta+1)) //nolint:gosec
+}
+
+// Stat holds the counters of an operation.
+type Stat struct {
+	Calls    int64 `json:"calls"`    // number of calls of Do
+	Retries  int64 `json:"retries"`  // number of attempts after the first one
+	Failures int64 `json:"failures"` // number of failed attempts
+}
+
+var (
+	mu    sync.Mutex
+	stats = map[string]*Stat{}
+)
+
+func record(name string, attempt int, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok := stats[name]
+	if !ok {
+		s = &Stat{}
+		stats[name] = s
+	}
+	if attempt == 1 {
+		s.Calls++
+	} else {
+		s.Retries++
+	}
+	if err != nil {
+		s.Failures++
+	}
+}
+
+// Stats returns a snapshot of the counters of each operation.
+func Stats() map[string]Stat {
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := make(map[string]Stat, len(stats))
+	for name, s := range stats {
+		out[name] = *s
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	calls := 0
+	err := Do(context.Background(), "test_succeeds", Constant(5, time.Millisecond), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFailed
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, Stat{Calls: 1, Retries: 2, Failures: 2}, Stats()["test_succeeds"])
+
+	calls = 0
+	err = Do(context.Background(), "test_exhausted", Constant(2, time.Millisecond), func(context.Context) error {
+		calls++
+		return errFailed
+	})
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	err = Do(context.Background(), "test_permanent", Constant(5, time.Millisecond), func(context.Context) error {
+		calls++
+		return Permanent(errFailed)
+	})
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = Do(ctx, "test_context", Exponential(0), func(context.Context) error {
+		return errFailed
+	})
+	assert.Equal(t, errFailed, err)
+	assert.NotNil(t, ctx.Err())
+
+	start := time.Now()
+	err = Do(context.Background(), "test_elapsed", Policy{InitialInterval: 10 * time.Millisecond, MaxElapsedTime: 30 * time.Millisecond},
+		func(context.Context) error { return errFailed })
+	assert.Equal(t, errFailed, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(100*time.Millisecond, 0.5)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 150*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, jitter(time.Second, 0))
+}
+
+func TestDoFakeClock(t *testing.T) {
+	errFailed := errors.New("failed")
+	clk := clock.NewFake(time.Unix(0, 0))
+	p := Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     4 * time.Second,
+		Multiplier:      2,
+		MaxElapsedTime:  10 * time.Second,
+		Clock:           clk,
+	}
+
+	var calls []time.Duration
+	done := make(chan error)
+	go func() {
+		done <- Do(context.Background(), "test_fake_clock", p, func(context.Context) error {
+			calls = append(calls, clk.Since(time.Unix(0, 0)))
+			return errFailed
+		})
+	}()
+	// the attempts wait 1s, 2s and 4s, the next wait of 4s exceeds the
+	// maximum elapsed time.
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		clk.BlockUntil(1)
+		clk.Advance(d)
+	}
+	assert.Equal(t, errFailed, <-done)
+	assert.Equal(t, []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}, calls)
+}
+
+func TestDoFakeClockCanceled(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Do(ctx, "test_fake_clock_canceled", Policy{InitialInterval: time.Hour, Clock: clk},
+			func(context.Context) error { return errors.New("failed") })
+	}()
+	clk.BlockUntil(1)
+	cancel()
+	assert.EqualError(t, <-done, "failed")
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package safepath provides helpers to make sure that paths provided by
+// a step resolve inside the directories the step is allowed to access.
+package safepath
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+var unconfined atomic.Bool
+
+// AllowUnconfined disables the confinement checks of ConfineInput. This is
+// an escape hatch for setups which legitimately read the variable files and
+// the reports of the steps from arbitrary locations.
+func AllowUnconfined(allow bool) {
+	unconfined.Store(allow)
+}
+
+// ConfineInput is Confine for the files a step names for the engine to read:
+// the output and secret variable files and the test reports. Unlike Confine,
+// it is disabled by AllowUnconfined.
+func ConfineInput(path string, roots ...string) (string, error) {
+	if unconfined.Load() {
+		return path, nil
+	}
+	return Confine(path, roots...)
+}
+
+// Confine returns the canonical form of the path with all symlinks resolved.
+// It returns an error if the path does not resolve inside one of the roots.
+// Empty roots are ignored. It is always enforced, eg. for the archives
+// extracted and the files served by the engine.
+func Confine(path string, roots ...string) (string, error) {
+	resolved, err := resolve(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		r, err := resolve(root)
+		if err != nil {
+			continue
+		}
+		if within(r, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path %q resolves outside of the allowed directories", path)
+}
+
+// resolve returns the absolute path with symlinks evaluated. Paths which
+// do not exist yet are resolved using their longest existing prefix.
+func resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var rest []string
+	for p := abs; ; {
+		r, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{r}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+// within returns true if path is the root or is nested inside it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,46 @@
+package safepath
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfine(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600))
+	assert.Nil(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")))
+
+	tests := []struct {
+		Name    string
+		Path    string
+		WantErr bool
+	}{
+		{Name: "inside_root", Path: filepath.Join(root, "output.env")},
+		{Name: "nested_missing_dirs", Path: filepath.Join(root, "a", "b", "output.env")},
+		{Name: "dot_dot_escape", Path: filepath.Join(root, "..", filepath.Base(outside), "secret"), WantErr: true},
+		{Name: "symlink_escape", Path: filepath.Join(root, "link"), WantErr: true},
+		{Name: "absolute_outside", Path: "/etc/passwd", WantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := Confine(tc.Path, "", root)
+			assert.Equal(t, tc.WantErr, err != nil)
+		})
+	}
+
+	_, err := ConfineInput("/etc/passwd", root)
+	assert.NotNil(t, err)
+
+	// the escape hatch only applies to the inputs of the steps
+	AllowUnconfined(true)
+	defer AllowUnconfined(false)
+	_, err = ConfineInput("/etc/passwd", root)
+	assert.Nil(t, err)
+	_, err = Confine("/etc/passwd", root)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,194 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sealed opens the secrets of the requests sealed with the public
+// key of the engine, so that they do not transit the delegate task queue
+// in plaintext. The secrets are sealed with NaCl anonymous boxes, eg.
+// libsodium crypto_box_seal, and only opened in the engine memory.
+package sealed
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harness/lite-engine/internal/fileperm"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const keyPerm = 0600
+
+var (
+	errNoKey  = errors.New("the engine has no key to open the sealed secrets")
+	errSealed = errors.New("cannot open the sealed secret")
+)
+
+// Key is the curve25519 key pair of the engine.
+type Key struct {
+	public, private *[32]byte
+}
+
+// Generate generates a new key pair.
+func Generate() (*Key, error) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{public: public, private: private}, nil
+}
+
+// Load loads the base64 private key from the file at path, which is created
+// with a new key if it does not exist, so that the public key is kept
+// across the restarts of the engine.
+func Load(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		k, gerr := Generate()
+		if gerr != nil {
+			return nil, gerr
+		}
+		if err = os.MkdirAll(filepath.Dir(path), fileperm.Mode(os.ModePerm)); err != nil {
+			return nil, err
+		}
+		return k, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(k.private[:])+"\n"), keyPerm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	pub, err := curve25519.X25519(b, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	public, private := new([32]byte), new([32]byte)
+	copy(public[:], pub)
+	copy(private[:], b)
+	return &Key{public: public, private: private}, nil
+}
+
+// PublicKey returns the base64 public key.
+func (k *Key) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.public[:])
+}
+
+// Open returns the plaintext of the base64 sealed box.
+func (k *Key) Open(sealed string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", errSealed
+	}
+	out, ok := box.OpenAnonymous(nil, b, k.public, k.private)
+	if !ok {
+		return "", errSealed
+	}
+	return string(out), nil
+}
+
+// Seal returns the base64 sealed box of the plaintext, as the runners do.
+func Seal(publicKey, plaintext string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(b) != 32 {
+		return "", errors.New("invalid public key")
+	}
+	recipient := new([32]byte)
+	copy(recipient[:], b)
+	out, err := box.SealAnonymous(nil, []byte(plaintext), recipient, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+var (
+	mu  sync.RWMutex
+	key *Key
+)
+
+// Configure sets the key of the engine, loaded from the file at path or
+// generated if path is not set.
+func Configure(path string) error {
+	var (
+		k   *Key
+		err error
+	)
+	if path == "" {
+		k, err = Generate()
+	} else {
+		k, err = Load(path)
+	}
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	key = k
+	mu.Unlock()
+	return nil
+}
+
+// PublicKey returns the public key of the engine, empty if not configured.
+func PublicKey() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if key == nil {
+		return ""
+	}
+	return key.PublicKey()
+}
+
+// SealValue seals the plaintext with the public key of the engine, eg. to
+// keep a value on disk which only the engine, or an engine restarted with
+// the same key file, opens.
+func SealValue(plaintext string) (string, error) {
+	pub := PublicKey()
+	if pub == "" {
+		return "", errNoKey
+	}
+	return Seal(pub, plaintext)
+}
+
+// OpenValue opens a value sealed with the public key of the engine.
+func OpenValue(sealed string) (string, error) {
+	mu.RLock()
+	k := key
+	mu.RUnlock()
+	if k == nil {
+		return "", errNoKey
+	}
+	return k.Open(sealed)
+}
+
+// OpenEnvs returns the opened values of the sealed envs. The keys of the
+// envs which cannot be opened are returned as issues, without the values.
+func OpenEnvs(envs map[string]string) (opened map[string]string, issues []string) {
+	if len(envs) == 0 {
+		return nil, nil
+	}
+	mu.RLock()
+	k := key
+	mu.RUnlock()
+	if k == nil {
+		return nil, []string{errNoKey.Error()}
+	}
+	opened = make(map[string]string, len(envs))
+	for name, v := range envs {
+		s, err := k.Open(v)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		opened[name] = s
+	}
+	sort.Strings(issues)
+	return opened, issues
+}
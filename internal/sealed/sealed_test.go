@@ -0,0 +1,79 @@
+package sealed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+	k, err := Generate()
+	require.NoError(t, err)
+	s, err := Seal(k.PublicKey(), "p@ssw0rd")
+	require.NoError(t, err)
+	got, err := k.Open(s)
+	require.NoError(t, err)
+	assert.Equal(t, "p@ssw0rd", got)
+
+	other, _ := Generate()
+	_, err = other.Open(s)
+	assert.Equal(t, errSealed, err)
+	_, err = k.Open("not base64")
+	assert.Equal(t, errSealed, err)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "sealed.key")
+	k, err := Load(path)
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(keyPerm), fi.Mode().Perm())
+
+	// the key is kept across the restarts
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, k.PublicKey(), loaded.PublicKey())
+
+	require.NoError(t, os.WriteFile(path, []byte("invalid"), keyPerm))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestOpenEnvs(t *testing.T) {
+	mu.Lock()
+	key = nil
+	mu.Unlock()
+	_, issues := OpenEnvs(map[string]string{"TOKEN": "x"})
+	assert.Equal(t, []string{errNoKey.Error()}, issues)
+
+	require.NoError(t, Configure(""))
+	token, _ := Seal(PublicKey(), "secret-token")
+	opened, issues := OpenEnvs(map[string]string{"TOKEN": token, "PASSWORD": "invalid"})
+	assert.Equal(t, map[string]string{"TOKEN": "secret-token"}, opened)
+	assert.Equal(t, []string{"PASSWORD: " + errSealed.Error()}, issues)
+}
+
+func TestSealValue(t *testing.T) {
+	mu.Lock()
+	key = nil
+	mu.Unlock()
+	_, err := SealValue("request")
+	assert.Equal(t, errNoKey, err)
+
+	require.NoError(t, Configure(""))
+	s, err := SealValue("request")
+	require.NoError(t, err)
+	assert.NotContains(t, s, "request")
+	got, err := OpenValue(s)
+	require.NoError(t, err)
+	assert.Equal(t, "request", got)
+
+	// a restarted engine with a new key cannot open it
+	require.NoError(t, Configure(""))
+	_, err = OpenValue(s)
+	assert.Equal(t, errSealed, err)
+}
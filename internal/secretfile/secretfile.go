@@ -0,0 +1,226 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package secretfile reads the secrets of the files mounted on the host by
+// an external agent, eg. a vault agent or the secrets store csi driver, so
+// that they are masked in the logs. The directories are watched, the
+// secrets rendered or rotated during the stage are masked as soon as they
+// are written.
+package secretfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+const (
+	// DefaultInterval is the interval the files are checked for the updates
+	// not notified, eg. on the network filesystems.
+	DefaultInterval = 5 * time.Second
+	// maxFileSize is the size above which a file is not a secret, eg. a
+	// binary left in the directory.
+	maxFileSize = 64 << 10
+)
+
+// envLine matches the lines of the files rendered as env files, eg.
+// DB_PASSWORD="secret", the values are masked in addition to the lines.
+var envLine = regexp.MustCompile(`^(?:export\s+)?[A-Za-z_][A-Za-z0-9_]*=(.*)$`)
+
+// Validate returns the issues of the paths of the secret files.
+func Validate(paths []string) []string {
+	var issues []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			issues = append(issues, fmt.Sprintf("secret file %q needs to be an absolute path", p))
+		}
+	}
+	return issues
+}
+
+// file is the state of a file read.
+type file struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watcher reads the secrets of the files and of the files of the
+// directories, and reads them again when they are updated.
+type Watcher struct {
+	paths []string
+	clock clock.Clock
+
+	mu    sync.Mutex
+	files map[string]file
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New returns a watcher of the files and directories.
+func New(paths []string) *Watcher {
+	return &Watcher{paths: paths, clock: clock.Real, files: make(map[string]file)}
+}
+
+// Scan returns the secrets of the files created or updated since the
+// previous scan. The paths which do not exist yet are skipped, eg. the
+// files not rendered yet by the agent.
+func (w *Watcher) Scan() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var secrets []string
+	for _, p := range w.paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			secrets = append(secrets, w.read(p, info)...)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			logrus.WithError(err).WithField("path", p).Warnln("secretfile: cannot read the directory")
+			continue
+		}
+		for _, e := range entries {
+			// the hidden entries are the internals of the mounts, eg. the
+			// ..data directory of the kubernetes secret volumes
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			name := filepath.Join(p, e.Name())
+			// the entries may be symlinks to the files
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				secrets = append(secrets, w.read(name, info)...)
+			}
+		}
+	}
+	return secrets
+}
+
+// read returns the secrets of the file if it was updated since it was
+// last read.
+func (w *Watcher) read(name string, info os.FileInfo) []string {
+	state := file{size: info.Size(), modTime: info.ModTime()}
+	if prev, ok := w.files[name]; ok && prev == state {
+		return nil
+	}
+	w.files[name] = state
+	if info.Size() > maxFileSize {
+		logrus.WithField("path", name).Warnln("secretfile: the file is too large to be a secret")
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		logrus.WithError(err).WithField("path", name).Warnln("secretfile: cannot read the file")
+		delete(w.files, name)
+		return nil
+	}
+	return parse(string(data))
+}
+
+// parse returns the secrets of the content of a file: the content, and
+// the values of the lines of an env file.
+func parse(content string) []string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+	secrets := []string{content}
+	for _, line := range strings.Split(content, "\n") {
+		m := envLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if v := strings.Trim(m[1], `"'`); v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+// Start scans the files on the notifications of their directories, and
+// at the interval, until Stop. The secrets of the files created or updated
+// are passed to add.
+func (w *Watcher) Start(interval time.Duration, add func(secrets []string)) {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	notify := w.notify()
+	go func() {
+		defer close(w.done)
+		var events <-chan fsnotify.Event
+		if notify != nil {
+			defer notify.Close()
+			events = notify.Events
+		}
+		for {
+			select {
+			case <-w.stop:
+				return
+			case _, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+			case <-w.clock.After(interval):
+			}
+			if secrets := w.Scan(); len(secrets) > 0 {
+				add(secrets)
+			}
+		}
+	}()
+}
+
+// notify returns a watcher of the directories of the paths, the parent
+// directories of the files as the agents rename the files they render.
+// It returns nil if the directories cannot be watched, the files are then
+// only scanned at the interval.
+func (w *Watcher) notify() *fsnotify.Watcher {
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.WithError(err).Warnln("secretfile: cannot watch the secret files")
+		return nil
+	}
+	watched := 0
+	for _, p := range w.paths {
+		dir := p
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			dir = filepath.Dir(p)
+		}
+		if err := notify.Add(dir); err != nil {
+			logrus.WithError(err).WithField("path", dir).Warnln("secretfile: cannot watch the directory")
+			continue
+		}
+		watched++
+	}
+	if watched == 0 {
+		notify.Close()
+		return nil
+	}
+	go func() {
+		for err := range notify.Errors {
+			logrus.WithError(err).Warnln("secretfile: cannot watch the secret files")
+		}
+	}()
+	return notify
+}
+
+// Stop stops the scans of Start.
+func (w *Watcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
@@ -0,0 +1,78 @@
+package secretfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate([]string{"/vault/secrets"}))
+	assert.Equal(t, []string{`secret file "secrets/db" needs to be an absolute path`}, Validate([]string{"secrets/db"}))
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	secrets := filepath.Join(dir, "secrets")
+	require.NoError(t, os.MkdirAll(filepath.Join(secrets, "..data"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "..data", "token"), []byte("hidden-token"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(secrets, "..data", "token"), filepath.Join(secrets, "token")))
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "db.env"), []byte("export DB_USER=admin\nDB_PASSWORD=\"hunter22\"\n"), 0600))
+	single := filepath.Join(dir, "api-key")
+	require.NoError(t, os.WriteFile(single, []byte("api-key-value\n"), 0600))
+
+	w := New([]string{secrets, single, filepath.Join(dir, "missing")})
+	assert.ElementsMatch(t, []string{
+		"export DB_USER=admin\nDB_PASSWORD=\"hunter22\"", "admin", "hunter22",
+		"hidden-token",
+		"api-key-value",
+	}, w.Scan())
+	assert.Empty(t, w.Scan())
+
+	// the rotated and the rendered files are read again
+	require.NoError(t, os.WriteFile(single, []byte("rotated-api-key-value\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "missing"), []byte("rendered"), 0600))
+	assert.ElementsMatch(t, []string{"rotated-api-key-value", "rendered"}, w.Scan())
+}
+
+func TestStart(t *testing.T) {
+	dir := t.TempDir()
+	fake := clock.NewFake(time.Now())
+	w := New([]string{dir})
+	w.clock = fake
+	assert.Empty(t, w.Scan())
+
+	added := make(chan []string, 1)
+	w.Start(DefaultInterval, func(secrets []string) { added <- secrets })
+	defer w.Stop()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("vault-token"), 0600))
+	fake.BlockUntil(1)
+	fake.Advance(DefaultInterval)
+	assert.Equal(t, []string{"vault-token"}, <-added)
+}
+
+func TestStartNotify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db")
+	w := New([]string{file})
+
+	added := make(chan []string, 1)
+	w.Start(time.Hour, func(secrets []string) { added <- secrets })
+	defer w.Stop()
+
+	// the file is rendered after the start, it is read on its notification
+	require.NoError(t, os.WriteFile(file, []byte("db-password"), 0600))
+	select {
+	case secrets := <-added:
+		assert.Equal(t, []string{"db-password"}, secrets)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the secret file is not read on its notification")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package tarball writes and extracts the tar archives of the paths of a
+// directory, eg. the checkpoints and the caches of the steps. The archives
+// are compressed by the callers.
+package tarball
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/safepath"
+)
+
+const dirPerm = 0700
+
+// Write writes the tar archive of the regular files, the directories and the
+// symlinks of the paths, relative to the directory. The symlinks are not
+// followed. The paths which do not exist are skipped.
+func Write(w io.Writer, dir string, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, p := range paths {
+		root := filepath.Join(dir, filepath.FromSlash(p))
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() && !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+				return nil // the devices, pipes and sockets are not archived
+			}
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			return addFile(tw, path, filepath.ToSlash(rel), info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addFile(tw *tar.Writer, path, name string, info fs.FileInfo) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			if os.IsNotExist(err) {
+				return nil // removed meanwhile
+			}
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() || link != "" {
+		return tw.WriteHeader(hdr)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // removed meanwhile
+		}
+		return err
+	}
+	defer f.Close()
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// the file may grow meanwhile, only the size of the header is copied
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// Extract extracts the regular files, the directories and the symlinks of the
+// tar archive in the directory, the entries and the link targets resolving
+// outside of it are rejected. The symlinks already in the directory, or
+// extracted before, are resolved so that no entry is written through a link
+// pointing outside of it.
+func Extract(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !Local(hdr.Name) {
+			return fmt.Errorf("illegal path in archive: %s", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+			// the files are written to the resolved path, not through the links
+			if target, err = safepath.Confine(target, dir); err != nil {
+				return err
+			}
+			if hdr.Typeflag == tar.TypeDir {
+				err = os.MkdirAll(target, fileperm.Mode(mode.Perm()|dirPerm))
+			} else {
+				err = writeFile(target, tr, mode.Perm())
+			}
+		case tar.TypeSymlink:
+			// the symlink replaces the file at the path, only its parent is resolved
+			parent, cerr := safepath.Confine(filepath.Dir(target), dir)
+			if cerr != nil {
+				return cerr
+			}
+			target = filepath.Join(parent, filepath.Base(target))
+			if !linkInside(target, hdr.Linkname, dir) {
+				return fmt.Errorf("illegal link in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			err = writeSymlink(target, hdr.Linkname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), fileperm.Mode(dirPerm)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileperm.Mode(perm))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// linkInside returns true if the target of the symlink at the path resolves
+// inside the directory.
+func linkInside(path, link, dir string) bool {
+	resolved := link
+	if !filepath.IsAbs(link) {
+		resolved = filepath.Join(filepath.Dir(path), link)
+	}
+	_, err := safepath.Confine(resolved, dir)
+	return err == nil
+}
+
+// writeSymlink creates the symlink in place of the file at the path.
+func writeSymlink(path, link string) error {
+	if err := os.MkdirAll(filepath.Dir(path), fileperm.Mode(dirPerm)); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(link, path)
+}
+
+// Local returns true if the slash separated path is relative and does not
+// go up, eg. models/checkpoints.
+func Local(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract_IllegalPath(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0o600}))
+	require.NoError(t, tw.Close())
+	assert.EqualError(t, Extract(&buf, t.TempDir()), "illegal path in archive: ../escape")
+}
+
+func TestWriteExtract_Symlinks(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "node_modules", "eslint", "bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "node_modules", "eslint", "bin", "eslint.js"), []byte("lint"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "node_modules", ".bin"), 0o755))
+	require.NoError(t, os.Symlink("../eslint/bin/eslint.js", filepath.Join(src, "node_modules", ".bin", "eslint")))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, src, []string{"node_modules"}))
+	dst := t.TempDir()
+	require.NoError(t, Extract(&buf, dst))
+
+	link, err := os.Readlink(filepath.Join(dst, "node_modules", ".bin", "eslint"))
+	require.NoError(t, err)
+	assert.Equal(t, "../eslint/bin/eslint.js", link)
+	data, err := os.ReadFile(filepath.Join(dst, "node_modules", ".bin", "eslint"))
+	require.NoError(t, err)
+	assert.Equal(t, "lint", string(data))
+}
+
+func TestExtract_IllegalLink(t *testing.T) {
+	for _, link := range []string{"/etc/passwd", "../../etc/passwd"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "venv/passwd", Typeflag: tar.TypeSymlink, Linkname: link}))
+		require.NoError(t, tw.Close())
+		dir := t.TempDir()
+		assert.EqualError(t, Extract(&buf, dir), "illegal link in archive: venv/passwd -> "+link)
+		_, err := os.Lstat(filepath.Join(dir, "venv", "passwd"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestExtract_ThroughLink(t *testing.T) {
+	// the escape hatch of the step inputs does not apply to the archives
+	safepath.AllowUnconfined(true)
+	defer safepath.AllowUnconfined(false)
+
+	outside := t.TempDir()
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "a")))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/pwned", Typeflag: tar.TypeReg, Mode: 0o600, Size: 5}))
+	_, err := tw.Write([]byte("owned"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	assert.Error(t, Extract(&buf, dir))
+	_, err = os.Lstat(filepath.Join(outside, "pwned"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtract_LinkThenFile(t *testing.T) {
+	safepath.AllowUnconfined(true)
+	defer safepath.AllowUnconfined(false)
+
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/pwned", Typeflag: tar.TypeReg, Mode: 0o600}))
+	require.NoError(t, tw.Close())
+
+	assert.EqualError(t, Extract(&buf, t.TempDir()), "illegal link in archive: a -> "+outside)
+	_, err := os.Lstat(filepath.Join(outside, "pwned"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLocal(t *testing.T) {
+	assert.True(t, Local("models/checkpoints"))
+	assert.False(t, Local(""))
+	assert.False(t, Local("/data"))
+	assert.False(t, Local("models/../../data"))
+}
@@ -10,12 +10,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/harness/lite-engine/internal/metrics"
 	"github.com/harness/lite-engine/logstream"
 	"github.com/harness/lite-engine/logstream/remote"
 	"github.com/harness/lite-engine/osstats"
@@ -27,29 +29,57 @@ const (
 	defaultLevel       = "info"
 	defaultLimit       = 5242880 // 5MB
 	flushThresholdTime = 10 * time.Minute
+
+	// defaultPendingLimit is the number of lines waiting to be streamed
+	// above which the log service is considered to fall behind.
+	defaultPendingLimit = 5000
+	droppedLevel        = "warn"
+	droppedField        = "lines_dropped" // the field of the marker of the lines dropped
+
+	defaultWorkers = 1
+	queueFactor    = 2 // the batches queued per upload worker
 )
 
+// priorityPattern matches the lines kept when the lines waiting to be
+// streamed are dropped.
+var priorityPattern = regexp.MustCompile(`(?i)\b(error|fatal|panic|exception|fail(ed|ure)?)\b`)
+
 // Writer is an io.Writer that sends logs to the server.
 type Writer struct {
-	mu sync.Mutex
+	mu      sync.Mutex
+	flushMu sync.Mutex // serializes the flushes, mu is released while writing
+	sinkMu  sync.Mutex // serializes the writes to the sinks
+	wg      sync.WaitGroup
 
 	client logstream.Client // client
+	sinks  []logstream.Sink // the destinations of the lines in addition to the client
 
 	key  string // Unique key to identify in storage
 	name string // Human readable name of the key
 
-	num    int
-	now    time.Time
-	size   int
-	limit  int
-	opened bool // whether the stream has been successfully opened
-	nudges []logstream.Nudge
-	errs   []error
-
-	interval      time.Duration
-	printToStdout bool // if logs should be written to both the log service and stdout
+	num   int
+	now   time.Time
+	size  int
+	limit int
+	// pendingLimit is the number of lines waiting to be streamed above
+	// which the informational lines are dropped, see prioritize.
+	pendingLimit int
+	dropped      int // the lines dropped from the pending lines
+	nudges       []logstream.Nudge
+	errs         []error
+
+	// queue holds the batches of lines written to the log service by the
+	// upload workers, it is created once the stream is opened.
+	queue     chan []*logstream.Line
+	batchSize int // the lines of a batch, all the buffered lines if not positive
+	workers   int
+
+	interval      time.Duration // guarded by mu, the flusher reads it
+	printToStdout bool          // if logs should be written to both the log service and stdout
+	structured    bool          // if the level and the fields of the JSON lines are parsed
 	pending       []*logstream.Line
 	history       []*logstream.Line
+	sinkLines     []*logstream.Line // the lines waiting to be written to the sinks
 	prev          []byte
 
 	closed            bool
@@ -68,7 +98,9 @@ func New(client logstream.Client, key, name string, nudges []logstream.Nudge, pr
 		now:               time.Now(),
 		printToStdout:     printToStdout,
 		limit:             defaultLimit,
+		pendingLimit:      defaultPendingLimit,
 		interval:          defaultInterval,
+		workers:           defaultWorkers,
 		nudges:            nudges,
 		close:             make(chan struct{}),
 		ready:             make(chan struct{}, 1),
@@ -84,11 +116,57 @@ func (b *Writer) SetLimit(limit int) {
 	b.limit = limit
 }
 
+// SetPendingLimit sets the number of lines waiting to be streamed above
+// which the informational lines are dropped from the stream, the lines are
+// never dropped if not positive.
+func (b *Writer) SetPendingLimit(limit int) {
+	b.pendingLimit = limit
+}
+
+// SetStructured sets whether the lines written as JSON objects are parsed,
+// their level and fields are then forwarded to the log service.
+func (b *Writer) SetStructured(structured bool) {
+	b.structured = structured
+}
+
+// SetSinks sets the destinations of the lines in addition to the log
+// service. The sinks receive every line written, even if the stream could
+// not be opened or the lines were dropped from the stream.
+func (b *Writer) SetSinks(sinks []logstream.Sink) {
+	b.sinks = sinks
+}
+
+// SetBatchSize sets the number of lines written to the log service at
+// once, the lines buffered are flushed as soon as a batch is full.
+func (b *Writer) SetBatchSize(size int) {
+	b.batchSize = size
+}
+
+// SetUploadWorkers sets the number of batches written to the log service
+// concurrently, one by default. The batches of concurrent workers can reach
+// the log service out of order. It needs to be set before the stream is
+// opened.
+func (b *Writer) SetUploadWorkers(workers int) {
+	if workers > 0 {
+		b.workers = workers
+	}
+}
+
 // SetInterval sets the Writer flusher interval.
 func (b *Writer) SetInterval(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.interval = interval
 }
 
+// flushInterval returns the flusher interval, it may be set while the
+// flusher runs.
+func (b *Writer) flushInterval() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.interval
+}
+
 // Write uploads the live log stream to the server.
 func (b *Writer) Write(p []byte) (n int, err error) {
 	var res []byte
@@ -127,6 +205,11 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 			Timestamp:   time.Now(),
 			ElaspedTime: int64(time.Since(b.now).Seconds()),
 		}
+		if b.structured {
+			if level, fields, ok := parseStructured(part); ok {
+				line.Level, line.Fields = level, fields
+			}
+		}
 
 		jsonLine, _ := getLineBytes(line)
 
@@ -154,11 +237,17 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 		if !b.stopped() {
 			b.mu.Lock()
 			b.pending = append(b.pending, line)
+			if b.pendingLimit > 0 && len(b.pending) > b.pendingLimit {
+				b.pending = b.prioritize(b.pending, b.pendingLimit)
+			}
 			b.mu.Unlock()
 		}
 
 		b.mu.Lock()
 		b.history = append(b.history, line)
+		if len(b.sinks) > 0 {
+			b.sinkLines = append(b.sinkLines, line)
+		}
 		b.mu.Unlock()
 	}
 
@@ -179,10 +268,47 @@ func (b *Writer) Open() error {
 		return err
 	}
 	logrus.WithField("name", b.name).Infoln("successfully opened log stream")
-	b.opened = true
+	b.flushMu.Lock()
+	if !b.stopped() {
+		b.startWorkers()
+	}
+	b.flushMu.Unlock()
 	return nil
 }
 
+// startWorkers starts the workers writing the queued batches of lines to
+// the log service.
+func (b *Writer) startWorkers() {
+	queue := make(chan []*logstream.Line, queueFactor*b.workers)
+	b.queue = queue
+	for i := 0; i < b.workers; i++ {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for lines := range queue {
+				stats.queued.Add(-1)
+				b.send(lines)
+			}
+		}()
+	}
+}
+
+// send writes a batch of lines to the log service. The errors are logged,
+// log streams are ephemeral and are considered low priority.
+func (b *Writer) send(lines []*logstream.Line) {
+	start := time.Now()
+	err := b.client.Write(context.Background(), b.key, lines)
+	logRequestDuration.Observe(time.Since(start).Seconds(), "write", metrics.Status(err))
+	if err != nil {
+		stats.failed.Add(1)
+		logrus.WithError(err).WithField("key", b.key).WithField("num_lines", len(lines)).
+			Errorln("failed to flush lines")
+		return
+	}
+	stats.batches.Add(1)
+	stats.lines.Add(int64(len(lines)))
+}
+
 // Close closes the writer and uploads the full contents to
 // the server.
 func (b *Writer) Close() error {
@@ -191,8 +317,9 @@ func (b *Writer) Close() error {
 		if len(b.prev) > 0 {
 			b.Write([]byte("\n")) //nolint:errcheck
 		}
-		b.flush()
 	}
+	b.drain()
+	b.closeSinks()
 
 	b.checkErrInLogs()
 
@@ -213,18 +340,46 @@ func (b *Writer) Close() error {
 
 // upload uploads the full log history to the server.
 func (b *Writer) upload() error {
-	return b.client.Upload(context.Background(), b.key, b.history)
+	start := time.Now()
+	err := b.client.Upload(context.Background(), b.key, b.history)
+	logRequestDuration.Observe(time.Since(start).Seconds(), "upload", metrics.Status(err))
+	return err
 }
 
-// flush batch uploads all buffered logs to the server.
-func (b *Writer) flush() error {
-	if !b.opened {
-		return nil
+// flush queues the buffered lines in batches to be written to the log
+// service. The lines which do not fit in the queue are buffered again and
+// the lines written meanwhile are buffered, see prioritize if the server
+// falls behind.
+func (b *Writer) flush() {
+	b.flushSinks()
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.enqueue(false)
+}
+
+// drain queues all the buffered lines, waiting for room in the queue, and
+// waits until the workers wrote them.
+func (b *Writer) drain() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.enqueue(true)
+	if b.queue != nil {
+		close(b.queue)
+		b.queue = nil
+		b.wg.Wait()
+	}
+}
+
+// enqueue queues the buffered lines, it needs to be called with flushMu
+// held.
+func (b *Writer) enqueue(wait bool) {
+	if b.queue == nil {
+		return
 	}
 	b.mu.Lock()
-	defer b.mu.Unlock()
 	lines := b.copy()
 	b.clear()
+	b.mu.Unlock()
 	if len(lines) == 0 {
 		// print stats if no logs for 10 min
 		thresholdTime := time.Now().Add(-flushThresholdTime)
@@ -233,17 +388,76 @@ func (b *Writer) flush() error {
 			// reset lastFlushTime if stats were dumped
 			b.lastFlushTime = time.Now()
 		}
-		return nil
+		return
 	}
 	// reset lastFlushTime if logs are found
 	b.lastFlushTime = time.Now()
-	err := b.client.Write(context.Background(), b.key, lines)
-	if err != nil {
-		logrus.WithError(err).WithField("key", b.key).WithField("num_lines", len(lines)).
-			Errorln("failed to flush lines")
-		return err
+	for len(lines) > 0 {
+		n := len(lines)
+		if b.batchSize > 0 && n > b.batchSize {
+			n = b.batchSize
+		}
+		if wait {
+			b.queue <- lines[:n]
+		} else {
+			select {
+			case b.queue <- lines[:n]:
+			default:
+				// the log service falls behind, the lines left are
+				// buffered again in front of the lines written meanwhile.
+				stats.stalls.Add(1)
+				b.mu.Lock()
+				b.pending = append(lines, b.pending...)
+				if b.pendingLimit > 0 && len(b.pending) > b.pendingLimit {
+					b.pending = b.prioritize(b.pending, b.pendingLimit)
+				}
+				b.mu.Unlock()
+				return
+			}
+		}
+		stats.queued.Add(1)
+		lines = lines[n:]
+	}
+	b.mu.Lock()
+	b.dropped = 0
+	b.mu.Unlock()
+}
+
+// flushSinks writes the lines buffered to the sinks. The errors of the
+// sinks are logged, they never fail the step.
+func (b *Writer) flushSinks() {
+	if len(b.sinks) == 0 {
+		return
+	}
+	b.sinkMu.Lock()
+	defer b.sinkMu.Unlock()
+	b.mu.Lock()
+	lines := b.sinkLines
+	b.sinkLines = nil
+	b.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	for _, sink := range b.sinks {
+		if err := sink.Write(context.Background(), b.key, lines); err != nil {
+			logrus.WithError(err).WithField("key", b.key).WithField("num_lines", len(lines)).
+				Errorln("failed to write lines to the log sink")
+		}
+	}
+}
+
+// closeSinks writes the lines left to the sinks and closes them.
+func (b *Writer) closeSinks() {
+	if len(b.sinks) == 0 {
+		return
+	}
+	b.flushSinks()
+	for _, sink := range b.sinks {
+		if err := sink.Close(context.Background(), b.key); err != nil {
+			logrus.WithError(err).WithField("key", b.key).
+				Errorln("failed to close the log sink")
+		}
 	}
-	return nil
 }
 
 func (b *Writer) Error() error {
@@ -253,6 +467,46 @@ func (b *Writer) Error() error {
 	return b.errs[len(b.errs)-1]
 }
 
+// prioritize drops the informational lines of the buffered lines so that
+// at most limit lines are kept, when the log service falls behind. The last
+// half of the lines, the tail of the step, and the older lines matching
+// priorityPattern or of the error levels are kept, the dropped lines are replaced with a marker.
+// The whole log is still uploaded once the step completes.
+func (b *Writer) prioritize(lines []*logstream.Line, limit int) []*logstream.Line {
+	tail := limit / 2 //nolint:gomnd
+	older := lines[:len(lines)-tail]
+	kept := make([]*logstream.Line, 0, limit)
+	var last *logstream.Line
+	for _, line := range older {
+		switch {
+		case line.Fields[droppedField] != "": // the marker of the previous lines dropped
+			last = line
+		case len(kept) < limit-tail-1 && (isPriorityLevel(line.Level) || priorityPattern.MatchString(line.Message)):
+			kept = append(kept, line)
+		default:
+			b.dropped++
+			stats.dropped.Add(1)
+			last = line
+		}
+	}
+	if last != nil {
+		marker := fmt.Sprintf("... %d log lines dropped from the live log, the log service is falling behind. "+
+			"The full log is uploaded once the step completes ...", b.dropped)
+		if !b.trimNewLineSuffix {
+			marker += "\n"
+		}
+		kept = append(kept, &logstream.Line{
+			Level:       droppedLevel,
+			Message:     marker,
+			Number:      last.Number,
+			Timestamp:   last.Timestamp,
+			ElaspedTime: last.ElaspedTime,
+			Fields:      map[string]string{droppedField: strconv.Itoa(b.dropped)},
+		})
+	}
+	return append(kept, lines[len(lines)-tail:]...)
+}
+
 // copy returns a copy of the buffered lines.
 func (b *Writer) copy() []*logstream.Line {
 	return append(b.pending[:0:0], b.pending...)
@@ -284,30 +538,37 @@ func (b *Writer) stopped() bool {
 
 // Start starts a periodic loop to flush logs to the live stream
 func (b *Writer) Start() {
-	intervalTimer := time.NewTimer(b.interval)
+	intervalTimer := time.NewTimer(b.flushInterval())
 	for {
 		select {
 		case <-b.close:
 			return
 		case <-b.ready:
-			intervalTimer.Reset(b.interval)
+			if b.full() {
+				b.flush()
+				continue
+			}
+			intervalTimer.Reset(b.flushInterval())
 			select {
 			case <-b.close:
 				return
 			case <-intervalTimer.C:
-				// we intentionally ignore errors. log streams
-				// are ephemeral and are considered low priority
-				err := b.flush()
-				// Write the error to help with debugging
-				if err != nil {
-					logrus.WithField("key", b.key).WithError(err).
-						Errorln("errored while trying to flush lines")
-				}
+				b.flush()
 			}
 		}
 	}
 }
 
+// full returns true if the buffered lines fill a batch.
+func (b *Writer) full() bool {
+	if b.batchSize <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) >= b.batchSize
+}
+
 func (b *Writer) checkErrInLogs() {
 	size := len(b.history)
 	// Check last 10 log lines for errors. TODO(Shubham): see if this can be made better
@@ -7,6 +7,7 @@ package livelog
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -107,3 +108,174 @@ func (m *mockClient) Write(ctx context.Context, key string, lines []*logstream.L
 	m.lines = append(m.lines, lines...)
 	return nil
 }
+
+func TestLineWriterPrioritize(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false, true)
+	w.SetPendingLimit(6)
+	for i := 0; i < 12; i++ {
+		msg := fmt.Sprintf("line %d\n", i)
+		if i == 2 {
+			msg = "ERROR: connection refused\n"
+		}
+		_, _ = w.Write([]byte(msg))
+	}
+
+	if len(w.pending) > 6 {
+		t.Errorf("expected at most 6 pending lines, got %d", len(w.pending))
+	}
+	if w.pending[0].Message != "ERROR: connection refused" {
+		t.Errorf("expected the error line to be kept, got %q", w.pending[0].Message)
+	}
+	markers := 0
+	for _, line := range w.pending {
+		if line.Level == droppedLevel {
+			markers++
+		}
+	}
+	if markers != 1 {
+		t.Errorf("expected a single truncation marker, got %d", markers)
+	}
+	if last := w.pending[len(w.pending)-1]; last.Message != "line 11" {
+		t.Errorf("expected the tail to be kept, got %q", last.Message)
+	}
+	if len(w.history) != 12 {
+		t.Errorf("expected the whole history to be kept, got %d lines", len(w.history))
+	}
+	w.Close()
+}
+
+type mockSink struct {
+	mu     sync.Mutex
+	lines  []*logstream.Line
+	closed []string
+}
+
+func (m *mockSink) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lines = append(m.lines, lines...)
+	return nil
+}
+
+func (m *mockSink) Close(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = append(m.closed, key)
+	return nil
+}
+
+func TestLineWriterSinks(t *testing.T) {
+	client := new(mockClient)
+	sink := new(mockSink)
+	w := New(client, "key", "1", nil, false, true)
+	w.SetSinks([]logstream.Sink{sink})
+	w.SetPendingLimit(2)
+	// the stream is not opened, the sink still receives every line
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+	}
+	w.Close()
+
+	if len(client.lines) != 0 {
+		t.Errorf("expected no line streamed, got %d", len(client.lines))
+	}
+	if len(sink.lines) != 5 {
+		t.Fatalf("expected 5 lines written to the sink, got %d", len(sink.lines))
+	}
+	for i, line := range sink.lines {
+		if want := fmt.Sprintf("line %d", i); line.Message != want {
+			t.Errorf("expected %q, got %q", want, line.Message)
+		}
+	}
+	if len(sink.closed) != 1 || sink.closed[0] != "key" {
+		t.Errorf("expected the sink to be closed once, got %v", sink.closed)
+	}
+}
+
+type batchClient struct {
+	mockClient
+	mu      sync.Mutex
+	batches [][]*logstream.Line
+	block   chan struct{}
+}
+
+func (m *batchClient) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, lines)
+	return nil
+}
+
+func TestLineWriterBatches(t *testing.T) {
+	client := new(batchClient)
+	w := New(client, "key", "1", nil, false, true)
+	w.SetInterval(time.Hour)
+	w.SetBatchSize(2)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+	}
+	w.Close()
+
+	var sizes []int
+	n := 0
+	for _, batch := range client.batches {
+		sizes = append(sizes, len(batch))
+		for _, line := range batch {
+			if want := fmt.Sprintf("line %d", n); line.Message != want {
+				t.Errorf("expected %q, got %q", want, line.Message)
+			}
+			n++
+		}
+	}
+	if fmt.Sprint(sizes) != "[2 2 1]" {
+		t.Errorf("expected batches of 2 lines, got %v", sizes)
+	}
+}
+
+func TestLineWriterBackpressure(t *testing.T) {
+	client := &batchClient{block: make(chan struct{})}
+	w := New(client, "key", "1", nil, false, true)
+	w.SetInterval(time.Hour)
+	w.SetBatchSize(1)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	before := Stats()
+	// the worker blocks on the first batch, the queue holds the next two
+	// batches and the lines left are buffered again.
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		w.flush()
+	}
+	w.mu.Lock()
+	pending := len(w.pending)
+	w.mu.Unlock()
+	if pending == 0 {
+		t.Error("expected the lines to be buffered while the log service is blocked")
+	}
+	if stalls := Stats().Stalls - before.Stalls; stalls == 0 {
+		t.Error("expected the stalls to be counted")
+	}
+
+	close(client.block)
+	w.Close()
+	n := 0
+	for _, batch := range client.batches {
+		for _, line := range batch {
+			if want := fmt.Sprintf("line %d", n); line.Message != want {
+				t.Errorf("expected %q, got %q", want, line.Message)
+			}
+			n++
+		}
+	}
+	if n != 5 {
+		t.Errorf("expected 5 lines streamed, got %d", n)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"sync/atomic"
+
+	"github.com/harness/lite-engine/internal/metrics"
+)
+
+var logRequestDuration = metrics.NewHistogram("lite_engine_log_request_duration_seconds",
+	"The duration of the log service requests, by operation, write or upload, and status.",
+	metrics.DurationBuckets, "operation", "status")
+
+// Counters are the counters of the log streams of the engine, they tell
+// whether the log service falls behind the steps.
+type Counters struct {
+	Batches int64 // the batches of lines written to the log service
+	Lines   int64 // the lines written to the log service
+	Failed  int64 // the batches which could not be written
+	Stalls  int64 // the flushes which found the queue of batches full
+	Dropped int64 // the lines dropped from the live logs
+	Queued  int64 // the batches waiting for an upload worker
+}
+
+var stats struct {
+	batches, lines, failed, stalls, dropped, queued atomic.Int64
+}
+
+// Stats returns the counters of the log streams of the engine.
+func Stats() Counters {
+	return Counters{
+		Batches: stats.batches.Load(),
+		Lines:   stats.lines.Load(),
+		Failed:  stats.failed.Load(),
+		Stalls:  stats.stalls.Load(),
+		Dropped: stats.dropped.Load(),
+		Queued:  stats.queued.Load(),
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+const (
+	maxFields     = 32  // the fields kept of a structured line
+	maxFieldLimit = 256 // the length of the values of the fields
+)
+
+// levelKeys are the keys of the level of the structured lines, in order of
+// preference.
+var levelKeys = []string{"level", "lvl", "severity", "loglevel"}
+
+// levels maps the levels of the common logging libraries to the levels of
+// the log service.
+var levels = map[string]string{
+	"trace":     "debug",
+	"debug":     "debug",
+	"info":      "info",
+	"notice":    "info",
+	"warn":      "warn",
+	"warning":   "warn",
+	"err":       "error",
+	"error":     "error",
+	"crit":      "fatal",
+	"critical":  "fatal",
+	"alert":     "fatal",
+	"emerg":     "fatal",
+	"emergency": "fatal",
+	"fatal":     "fatal",
+	"panic":     "fatal",
+}
+
+// numericLevels maps the numeric levels of pino and bunyan.
+var numericLevels = map[float64]string{
+	10: "debug",
+	20: "debug",
+	30: "info",
+	40: "warn",
+	50: "error",
+	60: "fatal",
+}
+
+// parseStructured returns the level and the fields of a line written as a
+// JSON object, eg. by logrus, zap, pino or structlog. The fields are the
+// keys of the object other than the level, the values other than strings
+// are kept as JSON. It returns false if the line is not a JSON object.
+func parseStructured(msg string) (level string, fields map[string]string, ok bool) {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, "{") || !strings.HasSuffix(msg, "}") {
+		return "", nil, false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &obj); err != nil {
+		return "", nil, false
+	}
+
+	level = defaultLevel
+	levelKey := ""
+	for _, k := range levelKeys {
+		if raw, found := lookup(obj, k); found {
+			if l, known := parseLevel(obj[raw]); known {
+				level, levelKey = l, raw
+				break
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		if k != levelKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > maxFields {
+		keys = keys[:maxFields]
+	}
+	fields = make(map[string]string, len(keys))
+	for _, k := range keys {
+		var s string
+		if err := json.Unmarshal(obj[k], &s); err != nil {
+			s = string(obj[k])
+		}
+		fields[k] = truncate(s, maxFieldLimit)
+	}
+	return level, fields, true
+}
+
+// lookup returns the key of the object matching k regardless of its case.
+func lookup(obj map[string]json.RawMessage, k string) (string, bool) {
+	if _, ok := obj[k]; ok {
+		return k, true
+	}
+	for key := range obj {
+		if strings.EqualFold(key, k) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func parseLevel(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		l, ok := levels[strings.ToLower(strings.TrimSpace(s))]
+		return l, ok
+	}
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		l, ok := numericLevels[n]
+		return l, ok
+	}
+	return "", false
+}
+
+// isPriorityLevel returns true if the lines of the level are kept when the
+// live log falls behind.
+func isPriorityLevel(level string) bool {
+	return level == "error" || level == "fatal"
+}
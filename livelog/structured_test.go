@@ -0,0 +1,120 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStructured(t *testing.T) {
+	tests := []struct {
+		line   string
+		ok     bool
+		level  string
+		fields map[string]string
+	}{
+		{line: "plain text\n"},
+		{line: "{not json}\n"},
+		{line: `["a", "b"]`},
+		{
+			line:   `{"level":"warning","msg":"disk almost full","free":1024,"tags":["a"]}` + "\n",
+			ok:     true,
+			level:  "warn",
+			fields: map[string]string{"msg": "disk almost full", "free": "1024", "tags": `["a"]`},
+		},
+		{
+			line:   `{"Severity":"ERROR","message":"boom"}`,
+			ok:     true,
+			level:  "error",
+			fields: map[string]string{"message": "boom"},
+		},
+		{
+			line:   `{"level":50,"msg":"pino"}`,
+			ok:     true,
+			level:  "error",
+			fields: map[string]string{"msg": "pino"},
+		},
+		{
+			line:   `{"level":"verbose","msg":"unknown level"}`,
+			ok:     true,
+			level:  defaultLevel,
+			fields: map[string]string{"level": "verbose", "msg": "unknown level"},
+		},
+	}
+	for _, test := range tests {
+		level, fields, ok := parseStructured(test.line)
+		assert.Equal(t, test.ok, ok, test.line)
+		assert.Equal(t, test.level, level, test.line)
+		if test.ok {
+			assert.Equal(t, test.fields, fields, test.line)
+		}
+	}
+}
+
+func TestParseStructuredLimits(t *testing.T) {
+	var parts []string
+	for i := 0; i < maxFields+10; i++ {
+		parts = append(parts, fmt.Sprintf(`"k%02d":"v"`, i))
+	}
+	parts = append(parts, fmt.Sprintf(`"a":%q`, strings.Repeat("x", 2*maxFieldLimit)))
+	_, fields, ok := parseStructured("{" + strings.Join(parts, ",") + "}")
+	assert.True(t, ok)
+	assert.Len(t, fields, maxFields)
+	assert.True(t, strings.HasSuffix(fields["a"], "... (log line truncated)"))
+}
+
+func TestLineWriterStructured(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false, true)
+	w.SetStructured(true)
+	_, _ = w.Write([]byte(`{"level":"error","msg":"failed","step":"build"}` + "\nplain\n"))
+	w.Close()
+
+	if assert.Len(t, client.uploaded, 2) {
+		assert.Equal(t, "error", client.uploaded[0].Level)
+		assert.Equal(t, map[string]string{"msg": "failed", "step": "build"}, client.uploaded[0].Fields)
+		assert.Equal(t, `{"level":"error","msg":"failed","step":"build"}`, client.uploaded[0].Message)
+		assert.Equal(t, defaultLevel, client.uploaded[1].Level)
+		assert.Nil(t, client.uploaded[1].Fields)
+	}
+
+	// the lines are not parsed unless enabled
+	client = new(mockClient)
+	w = New(client, "1", "1", nil, false, true)
+	_, _ = w.Write([]byte(`{"level":"error","msg":"failed"}` + "\n"))
+	w.Close()
+	if assert.Len(t, client.uploaded, 1) {
+		assert.Equal(t, defaultLevel, client.uploaded[0].Level)
+		assert.Nil(t, client.uploaded[0].Fields)
+	}
+}
+
+func TestLineWriterPrioritizeStructured(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, "1", "1", nil, false, true)
+	w.SetStructured(true)
+	w.SetPendingLimit(6)
+	for i := 0; i < 12; i++ {
+		msg := fmt.Sprintf(`{"level":"warn","msg":"line %d"}`+"\n", i)
+		if i == 2 {
+			msg = `{"level":"error","msg":"refused"}` + "\n"
+		}
+		_, _ = w.Write([]byte(msg))
+	}
+
+	assert.Equal(t, "error", w.pending[0].Level)
+	markers := 0
+	for _, line := range w.pending {
+		if line.Fields[droppedField] != "" {
+			markers++
+		}
+	}
+	assert.Equal(t, 1, markers)
+	w.Close()
+}
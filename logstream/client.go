@@ -4,7 +4,10 @@
 
 package logstream
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 // Client defines a log service client.
 type Client interface {
@@ -20,3 +23,21 @@ type Client interface {
 	// Write writes logs to the data stream.
 	Write(ctx context.Context, key string, lines []*Line) error
 }
+
+// BlobUploader is implemented by the clients which can upload arbitrary
+// files, eg. test attachments, next to the logs.
+type BlobUploader interface {
+	// UploadBlob uploads the content of the reader and returns the link to it.
+	UploadBlob(ctx context.Context, key string, r io.Reader) (string, error)
+}
+
+// Sink defines a destination of the logs in addition to the log service,
+// eg. a local file or a log aggregator. A sink receives every line
+// written, regardless of the lines dropped from the log service stream.
+type Sink interface {
+	// Write writes the lines of the log stream.
+	Write(ctx context.Context, key string, lines []*Line) error
+
+	// Close closes the log stream, no lines are written after.
+	Close(ctx context.Context, key string) error
+}
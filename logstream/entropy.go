@@ -0,0 +1,148 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// DefaultEntropyMinLength is the length of the shortest string masked
+	// by the entropy detector.
+	DefaultEntropyMinLength = 24
+	// DefaultEntropyThreshold is the entropy, in bits per character, above
+	// which a string is masked by the entropy detector.
+	DefaultEntropyThreshold = 4.0
+)
+
+// tokenChars are the characters of the base64 and base64url encodings,
+// without the padding.
+var tokenChars = func() (t [256]bool) {
+	for c := 'A'; c <= 'Z'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+	}
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for _, c := range "+/_-" {
+		t[c] = true
+	}
+	return t
+}()
+
+// EntropyDetector masks the strings which look like credentials but match
+// no known format: the runs of base64 characters of at least MinLength,
+// mixing upper case letters, lower case letters and digits, whose Shannon
+// entropy is above Threshold bits per character. The hex strings, eg. the
+// commit shas and the image digests, are never masked. The runs with a /
+// are split on the / - and _ separators of the paths and the urls, and
+// their parts are masked instead.
+type EntropyDetector struct {
+	MinLength int
+	Threshold float64
+}
+
+// NewEntropyDetector returns a detector with the min length and threshold,
+// the defaults if not positive.
+func NewEntropyDetector(minLength int, threshold float64) *EntropyDetector {
+	if minLength <= 0 {
+		minLength = DefaultEntropyMinLength
+	}
+	if threshold <= 0 {
+		threshold = DefaultEntropyThreshold
+	}
+	return &EntropyDetector{MinLength: minLength, Threshold: threshold}
+}
+
+// Mask masks the high entropy strings of s.
+func (d *EntropyDetector) Mask(s string) string {
+	var b strings.Builder
+	last := 0
+	mask := func(start, end int) {
+		if end-start < d.MinLength || !d.isSecret(s[start:end]) {
+			return
+		}
+		if last == 0 {
+			b.Grow(len(s))
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(maskedStr)
+		last = end
+	}
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && tokenChars[s[i]] {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= d.MinLength {
+			if strings.IndexByte(s[start:i], '/') == -1 {
+				mask(start, i)
+			} else {
+				// a path or a url
+				part := start
+				for j := start; j <= i; j++ {
+					if j == i || strings.IndexByte("/-_", s[j]) != -1 {
+						mask(part, j)
+						part = j + 1
+					}
+				}
+			}
+		}
+		start = -1
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func (d *EntropyDetector) isSecret(token string) bool {
+	var upper, lower, digit bool
+	for i := 0; i < len(token); i++ {
+		switch c := token[i]; {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && entropy(token) > d.Threshold
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// NewEntropyMasker returns a writer that wraps w and masks the high entropy
+// strings detected.
+func NewEntropyMasker(w Writer, d *EntropyDetector) Writer {
+	if d == nil {
+		return w
+	}
+	return NewMasker(w, d.Mask)
+}
@@ -45,7 +45,12 @@ func (f *FileStore) Upload(_ context.Context, key string, lines []*logstream.Lin
 
 // Open opens the data stream.
 func (f *FileStore) Open(_ context.Context, key string) error {
-	file, err := os.Create(path.Join(f.relPath, key))
+	name := path.Join(f.relPath, key)
+	// log keys can contain slashes
+	if err := os.MkdirAll(path.Dir(name), 0700); err != nil { //nolint:gomnd
+		return err
+	}
+	file, err := os.Create(name)
 	if err != nil {
 		return err
 	}
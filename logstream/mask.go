@@ -0,0 +1,53 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import "regexp"
+
+// NewMaskedWriter returns a writer that wraps w and masks the secrets, and
+// the secrets of the set, then the matches of the patterns and the high
+// entropy strings if the detector is set. The secrets are masked first, a
+// pattern matching a part of a secret would leave the rest of it.
+func NewMaskedWriter(w Writer, set *Secrets, secrets []string, patterns []*regexp.Regexp, d *EntropyDetector) Writer {
+	w = NewEntropyMasker(w, d)
+	w = NewPatternMasker(w, patterns)
+	return NewSecretsReplacer(w, set, secrets)
+}
+
+// masker wraps a stream writer and masks the data written with a function.
+type masker struct {
+	w    Writer
+	mask func(string) string
+}
+
+// NewMasker returns a writer that wraps w and writes the data masked by
+// the function, eg. MaskPatterns.
+func NewMasker(w Writer, mask func(string) string) Writer {
+	return &masker{w: w, mask: mask}
+}
+
+// Write writes p to the base writer, masked.
+func (m *masker) Write(p []byte) (n int, err error) {
+	_, err = m.w.Write([]byte(m.mask(string(p))))
+	return len(p), err
+}
+
+// Open opens the base writer.
+func (m *masker) Open() error {
+	return m.w.Open()
+}
+
+func (m *masker) Start() {
+	m.w.Start()
+}
+
+// Close closes the base writer.
+func (m *masker) Close() error {
+	return m.w.Close()
+}
+
+func (m *masker) Error() error {
+	return m.w.Error()
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LoadPatterns returns the mask patterns and the patterns of the file, if
+// set. The file has a pattern per line, the blank lines and the lines
+// starting with # are skipped.
+func LoadPatterns(patterns []string, file string) ([]string, error) {
+	out := append([]string{}, patterns...)
+	if file == "" {
+		return out, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the mask patterns file: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, sc.Err()
+}
+
+// CompilePatterns compiles the mask patterns and returns the issues of the
+// patterns which cannot be compiled, or which match the empty string and
+// would mask every line.
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, []string) {
+	var res []*regexp.Regexp
+	var issues []string
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		switch {
+		case err != nil:
+			issues = append(issues, fmt.Sprintf("invalid mask pattern %q: %s", p, err))
+		case re.MatchString(""):
+			issues = append(issues, fmt.Sprintf("mask pattern %q matches the empty string", p))
+		default:
+			res = append(res, re)
+		}
+	}
+	return res, issues
+}
+
+// ValidatePatterns returns the issues of the mask patterns and of the
+// patterns of the file.
+func ValidatePatterns(patterns []string, file string) []string {
+	all, err := LoadPatterns(patterns, file)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	_, issues := CompilePatterns(all)
+	return issues
+}
+
+// MaskPatterns masks the matches of the patterns in s. The submatches are
+// masked instead of the whole match if the pattern has groups, eg. only
+// the value of <password>(.*?)</password>.
+func MaskPatterns(s string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		s = maskPattern(s, re)
+	}
+	return s
+}
+
+func maskPattern(s string, re *regexp.Regexp) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, maskedStr)
+	}
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		for i := 2; i < len(m); i += 2 {
+			// the groups not matched and the groups nested in a group
+			// already masked are skipped
+			if m[i] < 0 || m[i] < last {
+				continue
+			}
+			b.WriteString(s[last:m[i]])
+			b.WriteString(maskedStr)
+			last = m[i+1]
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// NewPatternMasker returns a writer that wraps w and masks the matches of
+// the patterns, see MaskPatterns.
+func NewPatternMasker(w Writer, patterns []*regexp.Regexp) Writer {
+	if len(patterns) == 0 {
+		return w
+	}
+	return NewMasker(w, func(s string) string {
+		return MaskPatterns(s, patterns)
+	})
+}
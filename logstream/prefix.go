@@ -0,0 +1,62 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// prefixColors are the ansi colors of the prefixes: red, green, yellow,
+// blue, magenta and cyan.
+var prefixColors = []int{31, 32, 33, 34, 35, 36}
+
+// prefixWriter writes a prefix at the start of each line.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	inLine bool
+}
+
+// NewPrefixWriter returns a writer that prefixes each line written to w.
+func NewPrefixWriter(w io.Writer, prefix string) io.Writer {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+// Write writes p to the base writer, with the prefix inserted at the start
+// of each line.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	buf := new(bytes.Buffer)
+	for len(b) > 0 {
+		if !p.inLine {
+			buf.Write(p.prefix)
+			p.inLine = true
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			buf.Write(b)
+			break
+		}
+		buf.Write(b[:i+1])
+		b = b[i+1:]
+		p.inLine = false
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Colorize returns the text in an ansi color picked from the text, so that
+// the same text is always in the same color.
+func Colorize(text string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(text))
+	color := prefixColors[h.Sum32()%uint32(len(prefixColors))]
+	return fmt.Sprintf("\u001b[%dm%s\u001b[0m", color, text)
+}
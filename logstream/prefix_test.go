@@ -0,0 +1,35 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewPrefixWriter(buf, "[test] ")
+	for _, s := range []string{"first line\nsec", "ond line\n", "\nlast"} {
+		n, err := w.Write([]byte(s))
+		if err != nil || n != len(s) {
+			t.Errorf("Want %d bytes written, got %d, %v", len(s), n, err)
+		}
+	}
+	if got, want := buf.String(), "[test] first line\n[test] second line\n[test] \n[test] last"; got != want {
+		t.Errorf("Want prefixed output %q, got %q", want, got)
+	}
+}
+
+func TestColorize(t *testing.T) {
+	got := Colorize("[test]")
+	if got != Colorize("[test]") {
+		t.Errorf("Want the same color for the same text")
+	}
+	if !strings.HasPrefix(got, "\u001b[3") || !strings.HasSuffix(got, "[test]\u001b[0m") {
+		t.Errorf("Want ansi colored text, got %q", got)
+	}
+}
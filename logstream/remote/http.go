@@ -6,6 +6,7 @@ package remote
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -15,9 +16,10 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/sirupsen/logrus"
 
+	"github.com/harness/lite-engine/internal/fault"
+	"github.com/harness/lite-engine/internal/retry"
 	"github.com/harness/lite-engine/logstream"
 )
 
@@ -28,6 +30,7 @@ const (
 )
 
 var _ logstream.Client = (*HTTPClient)(nil)
+var _ logstream.BlobUploader = (*HTTPClient)(nil)
 
 // defaultClient is the default http.Client.
 var defaultClient = &http.Client{
@@ -58,6 +61,9 @@ func NewHTTPClient(endpoint, accountID, token string, indirectUpload, skipverify
 			},
 		}
 	}
+	if fault.Enabled(fault.LogStream) {
+		client.Client = fault.HTTPClient(fault.LogStream, client.client())
+	}
 	return client
 }
 
@@ -69,6 +75,12 @@ type HTTPClient struct {
 	AccountID      string
 	SkipVerify     bool
 	IndirectUpload bool
+	Compress       bool // gzip the logs uploaded through the log service
+}
+
+// gzipBody is a gzip compressed request body.
+type gzipBody struct {
+	*bytes.Buffer
 }
 
 // UploadFile uploads the file directly to data store or via log service
@@ -87,7 +99,15 @@ func (c *HTTPClient) Upload(ctx context.Context, key string, lines []*logstream.
 	if c.IndirectUpload {
 		logrus.WithField("key", key).
 			Infoln("uploading logs through log service as indirectUpload is specified as true")
-		err := c.uploadToRemoteStorage(ctx, key, data)
+		var body io.Reader = data
+		if c.Compress {
+			compressed, err := compress(data.Bytes())
+			if err != nil {
+				return err
+			}
+			body = compressed
+		}
+		err := c.uploadToRemoteStorage(ctx, key, body)
 		if err != nil {
 			logrus.WithError(err).WithField("key", key).
 				Errorln("failed to upload logs through log service")
@@ -113,6 +133,25 @@ func (c *HTTPClient) Upload(ctx context.Context, key string, lines []*logstream.
 	return nil
 }
 
+// UploadBlob uploads the content of the reader to the data store and returns
+// the log service link to download it.
+func (c *HTTPClient) UploadBlob(ctx context.Context, key string, r io.Reader) (string, error) {
+	if c.IndirectUpload {
+		if err := c.uploadToRemoteStorage(ctx, key, r); err != nil {
+			return "", err
+		}
+	} else {
+		link, err := c.uploadLink(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if err := c.uploadUsingLink(ctx, link.Value, r); err != nil {
+			return "", err
+		}
+	}
+	return c.Endpoint + fmt.Sprintf(blobEndpoint, c.AccountID, key), nil
+}
+
 // uploadToRemoteStorage uploads the file to remote storage.
 func (c *HTTPClient) uploadToRemoteStorage(ctx context.Context, key string, r io.Reader) error {
 	path := fmt.Sprintf(blobEndpoint, c.AccountID, key)
@@ -172,9 +211,9 @@ func (c *HTTPClient) Write(ctx context.Context, key string, lines []*logstream.L
 	return err
 }
 
-func (c *HTTPClient) retry(ctx context.Context, method, path string, in, out interface{}, isOpen bool, b backoff.BackOff) (*http.Response, error) {
-	for {
-		var res *http.Response
+func (c *HTTPClient) retry(ctx context.Context, method, path string, in, out interface{}, isOpen bool, p retry.Policy) (*http.Response, error) {
+	var res *http.Response
+	err := retry.Do(ctx, "log_service", p, func(ctx context.Context) error {
 		var err error
 		if !isOpen {
 			res, err = c.do(ctx, method, path, in, out)
@@ -185,35 +224,30 @@ func (c *HTTPClient) retry(ctx context.Context, method, path string, in, out int
 		// do not retry on Canceled or DeadlineExceeded
 		if cerr := ctx.Err(); cerr != nil {
 			logrus.WithError(cerr).WithField("path", path).Errorln("http: context canceled")
-			return res, cerr
+			return retry.Permanent(cerr)
 		}
 
-		duration := b.NextBackOff()
-
 		if res != nil {
 			// Check the response code. We retry on 5xx-range
 			// responses to allow the server time to recover, as
 			// 5xx's are typically not permanent errors and may
 			// relate to outages on the server side.
-
 			if res.StatusCode >= 500 { //nolint:gomnd
 				logrus.WithError(err).WithField("path", path).Warnln("http: log-service server error: reconnect and retry")
-				if duration == backoff.Stop {
-					return nil, err
+				if err == nil {
+					err = fmt.Errorf("log-service server error: %s", res.Status)
 				}
-				time.Sleep(duration)
-				continue
+				res.Body.Close()
+				res = nil
+				return err
 			}
 		} else if err != nil {
 			logrus.WithError(err).WithField("path", path).Warnln("http: request error. Retrying ...")
-			if duration == backoff.Stop {
-				return nil, err
-			}
-			time.Sleep(duration)
-			continue
+			return err
 		}
-		return res, err
-	}
+		return retry.Permanent(err)
+	})
+	return res, err
 }
 
 // do is a helper function that posts a signed http request with
@@ -297,9 +331,25 @@ func (c *HTTPClient) open(ctx context.Context, path, method string, body io.Read
 		return nil, err
 	}
 	req.Header.Add("X-Harness-Token", c.Token)
+	if _, ok := body.(*gzipBody); ok {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	return c.client().Do(req)
 }
 
+// compress returns the gzip compressed body of the data.
+func compress(data []byte) (*gzipBody, error) {
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &gzipBody{buf}, nil
+}
+
 // client is a helper function that returns the default client
 // if a custom client is not defined.
 func (c *HTTPClient) client() *http.Client {
@@ -309,14 +359,12 @@ func (c *HTTPClient) client() *http.Client {
 	return c.Client
 }
 
-func createInfiniteBackoff() *backoff.ExponentialBackOff {
+func createInfiniteBackoff() retry.Policy {
 	return createBackoff(0)
 }
 
-func createBackoff(maxElapsedTime time.Duration) *backoff.ExponentialBackOff {
-	exp := backoff.NewExponentialBackOff()
-	exp.MaxElapsedTime = maxElapsedTime
-	return exp
+func createBackoff(maxElapsedTime time.Duration) retry.Policy {
+	return retry.Exponential(maxElapsedTime)
 }
 
 func convertLines(lines []*logstream.Line) []*Line {
@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+func TestUploadCompressed(t *testing.T) {
+	var encoding, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		var rd io.Reader = r.Body
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			rd = zr
+		}
+		data, _ := io.ReadAll(rd)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, "account", "token", true, false)
+	c.Compress = true
+	lines := []*logstream.Line{{Number: 0, Level: "info", Message: "hello"}}
+	require.NoError(t, c.Upload(context.Background(), "key", lines))
+	assert.Equal(t, "gzip", encoding)
+	assert.Contains(t, body, `"out":"hello"`)
+
+	c.Compress = false
+	require.NoError(t, c.Upload(context.Background(), "key", lines))
+	assert.Empty(t, encoding)
+	assert.Contains(t, body, `"out":"hello"`)
+}
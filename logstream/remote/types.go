@@ -42,5 +42,6 @@ func ConvertToRemote(l *logstream.Line) *Line {
 		Message:   l.Message,
 		Number:    l.Number,
 		Timestamp: l.Timestamp,
+		Args:      l.Fields,
 	}
 }
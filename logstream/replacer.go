@@ -20,6 +20,26 @@ type replacer struct {
 
 // NewReplacer returns a replacer that wraps io.Writer w.
 func NewReplacer(w Writer, secrets []string) Writer {
+	r := secretReplacer(secrets)
+	if r == nil {
+		return w
+	}
+	return &replacer{
+		w: w,
+		r: r,
+	}
+}
+
+// Redact masks the secrets in s.
+func Redact(s string, secrets []string) string {
+	r := secretReplacer(secrets)
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+func secretReplacer(secrets []string) *strings.Replacer {
 	var oldnew []string
 	for _, secret := range secrets {
 		if secret == "" {
@@ -38,12 +58,9 @@ func NewReplacer(w Writer, secrets []string) Writer {
 		}
 	}
 	if len(oldnew) == 0 {
-		return w
-	}
-	return &replacer{
-		w: w,
-		r: strings.NewReplacer(oldnew...),
+		return nil
 	}
+	return strings.NewReplacer(oldnew...)
 }
 
 // Write writes p to the base writer. The method scans for any
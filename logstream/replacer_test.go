@@ -5,6 +5,8 @@
 package logstream
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -72,3 +74,85 @@ func TestReplaceMultilineJson(t *testing.T) {
 type nopCloser struct {
 	Writer
 }
+
+func TestRedact(t *testing.T) {
+	if got, want := Redact("token=correct-horse-batter-staple", []string{"correct-horse-batter-staple", "x"}), "token=**************"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+	if got, want := Redact("token=x", nil), "token=x"; got != want {
+		t.Errorf("Want string %s, got %s", want, got)
+	}
+}
+
+func TestSecretsReplacer(t *testing.T) {
+	set := NewSecrets([]string{"stage-secret"})
+
+	sw := &nopWriter{}
+	w := NewSecretsReplacer(&nopCloser{sw}, set, []string{"step-secret"})
+	_, _ = w.Write([]byte("stage-secret step-secret vault-secret"))
+	if n := set.Add("vault-secret", "stage-secret"); n != 1 {
+		t.Errorf("Want 1 secret added, got %d", n)
+	}
+	_, _ = w.Write([]byte("stage-secret step-secret vault-secret"))
+	w.Close()
+
+	if got, want := sw.data[0], "************** ************** vault-secret"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+	if got, want := sw.data[1], "************** ************** **************"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+}
+
+func TestPatternMasker(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "patterns")
+	if err := os.WriteFile(file, []byte("# account numbers\n\nACCT-[0-9]+\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := LoadPatterns([]string{`<password>(.*?)</password>`}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, issues := CompilePatterns(patterns)
+	if len(issues) > 0 {
+		t.Fatal(issues)
+	}
+
+	sw := &nopWriter{}
+	w := NewPatternMasker(&nopCloser{sw}, compiled)
+	_, _ = w.Write([]byte("<user>octocat</user><password>hunter2</password> ACCT-1234 <password></password>"))
+	w.Close()
+
+	if got, want := sw.data[0], "<user>octocat</user><password>**************</password> ************** <password>**************</password>"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+}
+
+func TestMaskedWriterSecretOverlap(t *testing.T) {
+	// the pattern matches the prefix of the secret
+	compiled, issues := CompilePatterns([]string{`token=[a-z]+`})
+	if len(issues) > 0 {
+		t.Fatal(issues)
+	}
+	sw := &nopWriter{}
+	w := NewMaskedWriter(&nopCloser{sw}, nil, []string{"token=abc123XYZ"}, compiled, nil)
+	_, _ = w.Write([]byte("auth token=abc123XYZ token=other"))
+	w.Close()
+
+	if got, want := sw.data[0], "auth ************** **************"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	issues := ValidatePatterns([]string{"(unclosed", "a*", "token=[a-z]+"}, "")
+	if len(issues) != 2 {
+		t.Fatalf("Want 2 issues, got %v", issues)
+	}
+	if got, want := issues[1], `mask pattern "a*" matches the empty string`; got != want {
+		t.Errorf("Want issue %s, got %s", want, got)
+	}
+	if issues := ValidatePatterns(nil, "/nonexistent/patterns"); len(issues) != 1 {
+		t.Errorf("Want the missing file reported, got %v", issues)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package logstream
+
+import (
+	"strings"
+	"sync"
+)
+
+// Secrets is a set of secrets which grows during the stage, eg. when the
+// secret files mounted by an agent are updated. The writers of
+// NewSecretsReplacer mask the secrets added after they were created.
+type Secrets struct {
+	mu      sync.RWMutex
+	values  []string
+	seen    map[string]bool
+	version int
+}
+
+// NewSecrets returns the set of the secrets.
+func NewSecrets(secrets []string) *Secrets {
+	s := &Secrets{seen: make(map[string]bool)}
+	s.Add(secrets...)
+	return s
+}
+
+// Add adds the secrets to the set and returns the number of secrets which
+// were not in the set.
+func (s *Secrets) Add(secrets ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	for _, secret := range secrets {
+		if secret == "" || s.seen[secret] {
+			continue
+		}
+		s.seen[secret] = true
+		s.values = append(s.values, secret)
+		added++
+	}
+	if added > 0 {
+		s.version++
+	}
+	return added
+}
+
+// Values returns a copy of the secrets of the set.
+func (s *Secrets) Values() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.values...)
+}
+
+// snapshot returns the secrets of the set and the version of the set.
+func (s *Secrets) snapshot() ([]string, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values, s.version
+}
+
+// secretsReplacer masks the secrets of a set, the replacer is rebuilt when
+// secrets are added to the set.
+type secretsReplacer struct {
+	w       Writer
+	set     *Secrets
+	secrets []string // the secrets of the writer in addition to the set
+
+	mu      sync.Mutex
+	version int
+	r       *strings.Replacer
+}
+
+// NewSecretsReplacer returns a replacer that wraps io.Writer w and masks
+// the secrets, and the secrets of the set including the ones added later.
+func NewSecretsReplacer(w Writer, set *Secrets, secrets []string) Writer {
+	if set == nil {
+		return NewReplacer(w, secrets)
+	}
+	r := &secretsReplacer{w: w, set: set, secrets: secrets, version: -1}
+	r.replacer()
+	return r
+}
+
+// replacer returns the replacer of the current secrets, nil if there are
+// no secrets to mask.
+func (r *secretsReplacer) replacer() *strings.Replacer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values, version := r.set.snapshot()
+	if version != r.version {
+		r.r = secretReplacer(append(append([]string{}, values...), r.secrets...))
+		r.version = version
+	}
+	return r.r
+}
+
+// Write writes p to the base writer, the secrets masked.
+func (r *secretsReplacer) Write(p []byte) (n int, err error) {
+	if rep := r.replacer(); rep != nil {
+		_, err = r.w.Write([]byte(rep.Replace(string(p))))
+		return len(p), err
+	}
+	return r.w.Write(p)
+}
+
+// Open opens the base writer.
+func (r *secretsReplacer) Open() error {
+	return r.w.Open()
+}
+
+func (r *secretsReplacer) Start() {
+	r.w.Start()
+}
+
+// Close closes the base writer.
+func (r *secretsReplacer) Close() error {
+	return r.w.Close()
+}
+
+func (r *secretsReplacer) Error() error {
+	return r.w.Error()
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/awssig"
+	"github.com/harness/lite-engine/logstream"
+)
+
+const (
+	defaultRegion = "us-east-1"
+
+	// the limits of a PutLogEvents batch, an event counts 26 bytes more
+	// than its message.
+	maxBatchEvents = 10000
+	maxBatchSize   = 1 << 20
+	eventOverhead  = 26
+)
+
+// cloudwatch puts the lines to a CloudWatch Logs log group, a log stream
+// is created per log key.
+type cloudwatch struct {
+	cfg      *api.LogSink
+	region   string
+	endpoint string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	created map[string]bool // the log streams created
+}
+
+type inputLogEvent struct {
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func newCloudWatch(cfg *api.LogSink) *cloudwatch {
+	s := &cloudwatch{cfg: cfg, region: cfg.Region, endpoint: cfg.Endpoint, now: time.Now, created: map[string]bool{}}
+	if s.region == "" {
+		s.region = defaultRegion
+	}
+	if s.endpoint == "" {
+		s.endpoint = fmt.Sprintf("https://logs.%s.amazonaws.com", s.region)
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/") + "/"
+	return s
+}
+
+func (s *cloudwatch) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	stream := streamName(key)
+	if err := s.createStream(ctx, stream); err != nil {
+		return err
+	}
+	var events []inputLogEvent
+	size := 0
+	for _, line := range lines {
+		msg := message(line)
+		if msg == "" {
+			continue // the events cannot be empty
+		}
+		if len(events) == maxBatchEvents || size+len(msg)+eventOverhead > maxBatchSize {
+			if err := s.putEvents(ctx, stream, events); err != nil {
+				return err
+			}
+			events, size = nil, 0
+		}
+		events = append(events, inputLogEvent{Message: msg, Timestamp: line.Timestamp.UnixNano() / int64(time.Millisecond)})
+		size += len(msg) + eventOverhead
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return s.putEvents(ctx, stream, events)
+}
+
+func (s *cloudwatch) Close(_ context.Context, _ string) error {
+	return nil
+}
+
+// createStream creates the log stream once, it may already exist, eg. if
+// the step is retried.
+func (s *cloudwatch) createStream(ctx context.Context, stream string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created[stream] {
+		return nil
+	}
+	err := s.call(ctx, "CreateLogStream", map[string]string{
+		"logGroupName":  s.cfg.LogGroup,
+		"logStreamName": stream,
+	})
+	var serr *statusError
+	if err != nil && !(errors.As(err, &serr) && strings.Contains(serr.msg, "ResourceAlreadyExistsException")) {
+		return fmt.Errorf("failed to create the cloudwatch log stream: %w", err)
+	}
+	s.created[stream] = true
+	return nil
+}
+
+func (s *cloudwatch) putEvents(ctx context.Context, stream string, events []inputLogEvent) error {
+	err := s.call(ctx, "PutLogEvents", map[string]interface{}{
+		"logGroupName":  s.cfg.LogGroup,
+		"logStreamName": stream,
+		"logEvents":     events,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put the logs to cloudwatch: %w", err)
+	}
+	return nil
+}
+
+// call sends the request of the action of the CloudWatch Logs api, signed
+// with the keys if set.
+func (s *cloudwatch) call(ctx context.Context, action string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+	if s.cfg.AccessKey != "" {
+		awssig.Sign(req, s.cfg.AccessKey, s.cfg.SecretKey, s.region, "logs", awssig.HexSHA256(body), s.now())
+	}
+	return do(req)
+}
+
+// streamName returns the name of the log stream of the log key, the names
+// cannot contain colons nor asterisks.
+func streamName(key string) string {
+	return strings.NewReplacer(":", "_", "*", "_").Replace(key)
+}
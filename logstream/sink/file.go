@@ -0,0 +1,130 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+const (
+	defaultMaxSize  = 10 << 20 // 10MiB
+	defaultMaxFiles = 5
+)
+
+// entry is a line of the file sink.
+type entry struct {
+	Time    time.Time         `json:"time"`
+	Key     string            `json:"key"`
+	Level   string            `json:"level"`
+	Number  int               `json:"pos"`
+	Message string            `json:"out"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// file writes the lines of all the log streams as JSON lines to a file,
+// the file is rotated to path.1, path.2... once it exceeds its max size.
+type file struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func newFile(cfg *api.LogSink) *file {
+	s := &file{path: cfg.Path, maxSize: cfg.MaxSize, maxFiles: cfg.MaxFiles}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultMaxSize
+	}
+	if s.maxFiles <= 0 {
+		s.maxFiles = defaultMaxFiles
+	}
+	return s
+}
+
+func (s *file) Write(_ context.Context, key string, lines []*logstream.Line) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := enc.Encode(&entry{
+			Time:    line.Timestamp,
+			Key:     key,
+			Level:   line.Level,
+			Number:  line.Number,
+			Message: message(line),
+			Fields:  line.Fields,
+		}); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f != nil && s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// Close keeps the file open, the file is shared by the log streams.
+func (s *file) Close(_ context.Context, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Sync()
+}
+
+func (s *file) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil { //nolint:gomnd
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// rotate renames the file to path.1, the rotated files are shifted and the
+// oldest removed so that at most maxFiles are kept.
+func (s *file) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f, s.size = nil, 0
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	return os.Rename(s.path, s.path+".1")
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// loki pushes the lines to a Grafana Loki server, a stream per log key and
+// level.
+type loki struct {
+	cfg *api.LogSink
+	url string
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLoki(cfg *api.LogSink) *loki {
+	return &loki{cfg: cfg, url: strings.TrimSuffix(cfg.URL, "/") + lokiPushPath}
+}
+
+func (s *loki) Write(ctx context.Context, key string, lines []*logstream.Line) error {
+	streams := map[string]*lokiStream{}
+	var push lokiPush
+	for _, line := range lines {
+		stream, ok := streams[line.Level]
+		if !ok {
+			labels := make(map[string]string, len(s.cfg.Labels)+2) //nolint:gomnd
+			for k, v := range s.cfg.Labels {
+				labels[k] = v
+			}
+			labels["key"] = key
+			labels["level"] = line.Level
+			stream = &lokiStream{Stream: labels}
+			streams[line.Level] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(line.Timestamp.UnixNano(), 10), message(line)})
+	}
+	body, err := json.Marshal(&push)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+	}
+	switch {
+	case s.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	case s.cfg.Username != "" || s.cfg.Password != "":
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	if err := do(req); err != nil {
+		return fmt.Errorf("failed to push the logs to loki: %w", err)
+	}
+	return nil
+}
+
+func (s *loki) Close(_ context.Context, _ string) error {
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sink writes the step logs to destinations other than the log
+// service, eg. a rotating file on the host, the stdout of the engine, a
+// Grafana Loki server or a CloudWatch Logs log group, so that the logs can
+// be collected by the tooling of the infrastructure.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// New returns the sink of the configuration.
+func New(cfg *api.LogSink) (logstream.Sink, error) {
+	switch cfg.Kind {
+	case api.LogSinkFile:
+		return newFile(cfg), nil
+	case api.LogSinkStdout:
+		return newStdout(), nil
+	case api.LogSinkLoki:
+		return newLoki(cfg), nil
+	case api.LogSinkCloudWatch:
+		return newCloudWatch(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported log sink %q", cfg.Kind)
+	}
+}
+
+// Validate returns the issues of the sinks configuration.
+func Validate(sinks []api.LogSink) []string {
+	var issues []string
+	for i := range sinks {
+		cfg := &sinks[i]
+		what := fmt.Sprintf("log sink %d", i)
+		switch cfg.Kind {
+		case api.LogSinkFile:
+			if !filepath.IsAbs(cfg.Path) {
+				issues = append(issues, what+" path needs to be an absolute path")
+			}
+			if cfg.MaxSize < 0 || cfg.MaxFiles < 0 {
+				issues = append(issues, what+" max_size and max_files cannot be negative")
+			}
+		case api.LogSinkStdout:
+		case api.LogSinkLoki:
+			if !isHTTP(cfg.URL) {
+				issues = append(issues, what+" url needs to be an http or https url")
+			}
+			if cfg.Token != "" && (cfg.Username != "" || cfg.Password != "") {
+				issues = append(issues, what+" token and username cannot both be set")
+			}
+		case api.LogSinkCloudWatch:
+			if cfg.LogGroup == "" {
+				issues = append(issues, what+" log_group needs to be set")
+			}
+			if (cfg.AccessKey == "") != (cfg.SecretKey == "") {
+				issues = append(issues, what+" access_key and secret_key need to be both set")
+			}
+			if cfg.Endpoint != "" && !isHTTP(cfg.Endpoint) {
+				issues = append(issues, what+" endpoint needs to be an http or https url")
+			}
+		default:
+			issues = append(issues, fmt.Sprintf("unsupported %s %q", what, cfg.Kind))
+		}
+	}
+	return issues
+}
+
+// message returns the message of the line without its line ending, the
+// lines of the log streams may keep it.
+func message(line *logstream.Line) string {
+	return strings.TrimRight(line.Message, "\r\n")
+}
+
+func isHTTP(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// do sends the request and returns an error if it is not successful, the
+// error does not hold the url.
+func do(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:gomnd
+		return &statusError{status: resp.Status, msg: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+// statusError is the error of an unsuccessful response.
+type statusError struct {
+	status string
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	if e.msg == "" {
+		return e.status
+	}
+	return e.status + ": " + e.msg
+}
@@ -0,0 +1,186 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+var ts = time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func lines(msgs ...string) []*logstream.Line {
+	out := make([]*logstream.Line, len(msgs))
+	for i, msg := range msgs {
+		level := "info"
+		if strings.HasPrefix(msg, "ERROR") {
+			level = "error"
+		}
+		out[i] = &logstream.Line{Level: level, Message: msg + "\n", Number: i, Timestamp: ts.Add(time.Duration(i) * time.Millisecond)}
+	}
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	issues := Validate([]api.LogSink{
+		{Kind: api.LogSinkFile, Path: "relative/steps.log"},
+		{Kind: api.LogSinkStdout},
+		{Kind: api.LogSinkLoki, URL: "loki:3100"},
+		{Kind: api.LogSinkCloudWatch, AccessKey: "key"},
+		{Kind: "syslog"},
+	})
+	assert.Equal(t, []string{
+		"log sink 0 path needs to be an absolute path",
+		"log sink 2 url needs to be an http or https url",
+		"log sink 3 log_group needs to be set",
+		"log sink 3 access_key and secret_key need to be both set",
+		`unsupported log sink 4 "syslog"`,
+	}, issues)
+	assert.Empty(t, Validate([]api.LogSink{{Kind: api.LogSinkLoki, URL: "http://loki:3100"}}))
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "steps.log")
+	s, err := New(&api.LogSink{Kind: api.LogSinkFile, Path: path, MaxSize: 300, MaxFiles: 2})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.Write(context.Background(), fmt.Sprintf("step%d", i), lines("hello", "world")))
+	}
+	require.NoError(t, s.Close(context.Background(), "step3"))
+
+	// each write is about 200 bytes, the file is rotated on every write
+	// and the oldest file is removed
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+	for i, name := range []string{path + ".2", path + ".1", path} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		var e entry
+		require.NoError(t, json.NewDecoder(bytes.NewReader(data)).Decode(&e))
+		assert.Equal(t, fmt.Sprintf("step%d", i+1), e.Key)
+		assert.Equal(t, "hello", e.Message)
+		assert.Equal(t, "info", e.Level)
+	}
+}
+
+func TestStdout(t *testing.T) {
+	var buf bytes.Buffer
+	s := &stdout{w: &buf}
+	require.NoError(t, s.Write(context.Background(), "step1", lines("hello", "ERROR boom")))
+	assert.Equal(t, "2022-05-01T12:00:00Z step1 [info] hello\n2022-05-01T12:00:00Z step1 [error] ERROR boom\n", buf.String())
+}
+
+func TestLoki(t *testing.T) {
+	var push lokiPush
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "user:pass", user+":"+pass)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&push))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s, err := New(&api.LogSink{Kind: api.LogSinkLoki, URL: srv.URL + "/", TenantID: "tenant",
+		Username: "user", Password: "pass", Labels: map[string]string{"env": "ci"}})
+	require.NoError(t, err)
+	require.NoError(t, s.Write(context.Background(), "step1", lines("hello", "ERROR boom", "world")))
+
+	require.Len(t, push.Streams, 2)
+	assert.Equal(t, map[string]string{"env": "ci", "key": "step1", "level": "info"}, push.Streams[0].Stream)
+	assert.Equal(t, [][2]string{
+		{fmt.Sprint(ts.UnixNano()), "hello"},
+		{fmt.Sprint(ts.Add(2 * time.Millisecond).UnixNano()), "world"},
+	}, push.Streams[0].Values)
+	assert.Equal(t, "error", push.Streams[1].Stream["level"])
+	assert.Equal(t, [][2]string{{fmt.Sprint(ts.Add(time.Millisecond).UnixNano()), "ERROR boom"}}, push.Streams[1].Values)
+}
+
+func TestLokiError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s, _ := New(&api.LogSink{Kind: api.LogSinkLoki, URL: srv.URL})
+	err := s.Write(context.Background(), "step1", lines("hello"))
+	assert.EqualError(t, err, "failed to push the logs to loki: 400 Bad Request: entry too far behind")
+}
+
+func TestCloudWatch(t *testing.T) {
+	var actions []string
+	var events []inputLogEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+		actions = append(actions, action)
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=key/20220501/eu-west-1/logs/aws4_request")
+		var in struct {
+			LogGroupName  string          `json:"logGroupName"`
+			LogStreamName string          `json:"logStreamName"`
+			LogEvents     []inputLogEvent `json:"logEvents"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		assert.Equal(t, "ci", in.LogGroupName)
+		assert.Equal(t, "stage_step1", in.LogStreamName)
+		if action == "CreateLogStream" {
+			// the stream exists, eg. the step is retried
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"__type":"ResourceAlreadyExistsException"}`) //nolint:errcheck
+			return
+		}
+		events = append(events, in.LogEvents...)
+		io.WriteString(w, `{}`) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	s := newCloudWatch(&api.LogSink{Kind: api.LogSinkCloudWatch, LogGroup: "ci", Region: "eu-west-1",
+		Endpoint: srv.URL, AccessKey: "key", SecretKey: "secret"})
+	s.now = func() time.Time { return ts }
+	require.NoError(t, s.Write(context.Background(), "stage:step1", lines("hello", "")))
+	require.NoError(t, s.Write(context.Background(), "stage:step1", lines("world")))
+
+	assert.Equal(t, []string{"CreateLogStream", "PutLogEvents", "PutLogEvents"}, actions)
+	assert.Equal(t, []inputLogEvent{
+		{Message: "hello", Timestamp: ts.UnixNano() / int64(time.Millisecond)},
+		{Message: "world", Timestamp: ts.UnixNano() / int64(time.Millisecond)},
+	}, events)
+}
+
+func TestCloudWatchBatches(t *testing.T) {
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") == "Logs_20140328.PutLogEvents" {
+			var in struct {
+				LogEvents []inputLogEvent `json:"logEvents"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			batches = append(batches, len(in.LogEvents))
+		}
+		io.WriteString(w, `{}`) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	msgs := make([]string, maxBatchEvents+10)
+	for i := range msgs {
+		msgs[i] = "line"
+	}
+	s := newCloudWatch(&api.LogSink{Kind: api.LogSinkCloudWatch, LogGroup: "ci", Endpoint: srv.URL})
+	require.NoError(t, s.Write(context.Background(), "step1", lines(msgs...)))
+	assert.Equal(t, []int{maxBatchEvents, 10}, batches)
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/logstream"
+)
+
+// stdout writes the lines to the stdout of the engine, prefixed with their
+// log key, eg. for the log collectors of the containers.
+type stdout struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newStdout() *stdout {
+	return &stdout{w: os.Stdout}
+}
+
+func (s *stdout) Write(_ context.Context, key string, lines []*logstream.Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := bufio.NewWriter(s.w)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s %s [%s] %s\n", line.Timestamp.UTC().Format(time.RFC3339), key, line.Level, message(line))
+	}
+	return w.Flush()
+}
+
+func (s *stdout) Close(_ context.Context, _ string) error {
+	return nil
+}
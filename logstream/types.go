@@ -12,4 +12,5 @@ type Line struct {
 	ElaspedTime int64
 	Number      int
 	Timestamp   time.Time
+	Fields      map[string]string // the fields of a structured line, eg. a JSON line
 }
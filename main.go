@@ -8,6 +8,10 @@ import (
 	"github.com/harness/lite-engine/cli"
 
 	_ "github.com/harness/godotenv/v3"
+
+	// the timezones of the step clocks are validated on hosts without a
+	// timezone database, eg. windows or minimal images.
+	_ "time/tzdata"
 )
 
 func main() {
@@ -0,0 +1,175 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package notify posts the test summaries of the steps to the chat webhook
+// of the stage, eg. a Slack or a Microsoft Teams incoming webhook, so that
+// a pipeline needs no notification step.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+)
+
+// The kinds of webhooks.
+const (
+	KindSlack = "slack"
+	KindTeams = "teams"
+)
+
+// MaxFailures is the number of failed tests listed in a message.
+const MaxFailures = 5
+
+const (
+	maxMessageLength = 200
+	// the theme colors of the teams cards
+	colorFailed = "D13438"
+	colorPassed = "2EB67D"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Summary is the result of the tests of a step.
+type Summary struct {
+	Title      string // eg. the pipeline, the build, the stage and the step
+	Total      int
+	Passed     int
+	Failed     int
+	Skipped    int
+	DurationMs int64
+	Failures   []Failure // the first failed tests
+}
+
+// Failure is a failed test.
+type Failure struct {
+	Name    string
+	Message string
+}
+
+// Validate returns the issues of the webhook configuration.
+func Validate(cfg *api.Notify) []string {
+	var issues []string
+	if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		issues = append(issues, "the notification webhook needs to be an http or https url")
+	}
+	switch cfg.Kind {
+	case "", KindSlack, KindTeams:
+	default:
+		issues = append(issues, fmt.Sprintf("unsupported notification kind %q", cfg.Kind))
+	}
+	return issues
+}
+
+// Publish posts the summary to the webhook, the secrets masked. Nothing is
+// posted if the configuration only notifies the failures and no test
+// failed.
+func Publish(ctx context.Context, cfg *api.Notify, s *Summary, secrets []string) error {
+	if cfg.OnlyFailures && s.Failed == 0 {
+		return nil
+	}
+	body, err := payload(cfg.Kind, s, secrets)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// the url holds the token of the webhook
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("failed to post the test summary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 { //nolint:gomnd
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:gomnd
+		return fmt.Errorf("the webhook rejected the test summary: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// payload returns the message of the webhook kind.
+func payload(kind string, s *Summary, secrets []string) ([]byte, error) {
+	title := logstream.Redact(s.Title, secrets)
+	text := text(s, secrets)
+	if kind == KindTeams {
+		color := colorPassed
+		if s.Failed > 0 {
+			color = colorFailed
+		}
+		// the markdown of the cards needs blank lines between the lines
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    title,
+			"themeColor": color,
+			"title":      title,
+			"text":       strings.ReplaceAll(text, "\n", "\n\n"),
+		})
+	}
+	return json.Marshal(map[string]string{"text": "*" + title + "*\n" + text})
+}
+
+// text returns the totals and the first failures of the summary, the
+// secrets masked.
+func text(s *Summary, secrets []string) string {
+	var sb strings.Builder
+	status := "passed"
+	if s.Failed > 0 {
+		status = "failed"
+	}
+	fmt.Fprintf(&sb, "Tests %s: %d failed, %d passed, %d skipped of %d in %.1fs",
+		status, s.Failed, s.Passed, s.Skipped, s.Total, float64(s.DurationMs)/1000) //nolint:gomnd
+	for i, f := range s.Failures {
+		if i == MaxFailures {
+			break
+		}
+		sb.WriteString("\n• " + logstream.Redact(f.Name, secrets))
+		// the secrets are masked before the message is truncated, a
+		// truncated secret would not be masked
+		if msg := firstLine(logstream.Redact(f.Message, secrets)); msg != "" {
+			sb.WriteString(": " + msg)
+		}
+	}
+	if more := s.Failed - min(len(s.Failures), MaxFailures); more > 0 {
+		fmt.Fprintf(&sb, "\nand %d more failed tests", more)
+	}
+	return sb.String()
+}
+
+// firstLine returns the first line of the message, truncated on a rune
+// boundary.
+func firstLine(msg string) string {
+	msg, _, _ = strings.Cut(strings.TrimSpace(msg), "\n")
+	if len(msg) > maxMessageLength {
+		n := maxMessageLength
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n] + "..."
+	}
+	return msg
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
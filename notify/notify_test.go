@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	var bodies []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := map[string]string{}
+		assert.NoError(t, json.Unmarshal(data, &body))
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	failed := &Summary{
+		Title:      "deploy / 42 / build / test",
+		Total:      12,
+		Passed:     9,
+		Failed:     2,
+		Skipped:    1,
+		DurationMs: 1500,
+		Failures: []Failure{
+			{Name: "api.TestLogin", Message: "token s3cr3t-token rejected\nat login.go:12"},
+			{Name: "api.TestLogout"},
+		},
+	}
+	ctx := context.Background()
+	assert.NoError(t, Publish(ctx, &api.Notify{WebhookURL: srv.URL}, failed, []string{"s3cr3t-token"}))
+	assert.Equal(t, "*deploy / 42 / build / test*\nTests failed: 2 failed, 9 passed, 1 skipped of 12 in 1.5s\n"+
+		"• api.TestLogin: token ************** rejected\n• api.TestLogout", bodies[0]["text"])
+
+	assert.NoError(t, Publish(ctx, &api.Notify{WebhookURL: srv.URL, Kind: KindTeams}, failed, nil))
+	assert.Equal(t, "MessageCard", bodies[1]["@type"])
+	assert.Equal(t, colorFailed, bodies[1]["themeColor"])
+	assert.Equal(t, "deploy / 42 / build / test", bodies[1]["title"])
+
+	// the summaries without failures are not posted
+	passed := &Summary{Title: "test", Total: 3, Passed: 3}
+	assert.NoError(t, Publish(ctx, &api.Notify{WebhookURL: srv.URL, OnlyFailures: true}, passed, nil))
+	assert.Len(t, bodies, 2)
+}
+
+func TestPublishRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	err := Publish(context.Background(), &api.Notify{WebhookURL: srv.URL}, &Summary{Total: 1, Passed: 1}, nil)
+	assert.EqualError(t, err, "the webhook rejected the test summary: 403 Forbidden: invalid_token")
+}
+
+func TestText(t *testing.T) {
+	s := &Summary{Title: "test", Total: 10, Failed: 8, Passed: 2, DurationMs: 100}
+	for i := 0; i < 8; i++ {
+		s.Failures = append(s.Failures, Failure{Name: "TestCase"})
+	}
+	assert.Contains(t, text(s, nil), "\nand 3 more failed tests")
+}
+
+func TestTextRedacted(t *testing.T) {
+	// the secret straddles the truncation of the message
+	secret := "hunter2-secret"
+	msg := strings.Repeat("é", (maxMessageLength-5)/2) + " " + secret + " failed"
+	s := &Summary{Total: 1, Failed: 1, Failures: []Failure{{Name: "TestLogin " + secret, Message: msg}}}
+	got := text(s, []string{secret})
+	assert.NotContains(t, got, "hunt")
+	assert.Contains(t, got, "TestLogin **************")
+}
+
+func TestFirstLine(t *testing.T) {
+	msg := firstLine("a" + strings.Repeat("é", maxMessageLength))
+	assert.True(t, utf8.ValidString(msg))
+	assert.True(t, strings.HasSuffix(msg, "é..."))
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate(&api.Notify{WebhookURL: "https://hooks.slack.com/services/T/B/x"}))
+	assert.Len(t, Validate(&api.Notify{WebhookURL: "hooks.slack.com/services"}), 1)
+	assert.Len(t, Validate(&api.Notify{WebhookURL: "https://example.com", Kind: "discord"}), 1)
+}
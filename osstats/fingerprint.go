@@ -0,0 +1,95 @@
+package osstats
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+const runtimeProbeTimeout = 5 * time.Second
+
+// runtimeProbes are the commands printing the version of the language
+// runtimes reported in the host fingerprint.
+var runtimeProbes = map[string][]string{
+	"java":   {"java", "-version"},
+	"python": {"python3", "--version"},
+	"node":   {"node", "--version"},
+	"go":     {"go", "version"},
+	"ruby":   {"ruby", "--version"},
+	"dotnet": {"dotnet", "--version"},
+}
+
+var (
+	fingerprintOnce sync.Once
+	fingerprint     spec.HostFingerprint
+)
+
+// Fingerprint returns a copy of the fingerprint of the host. It is computed
+// on the first call only since the runtime probes are slow and the host does
+// not change while the engine is running. Details which cannot be determined
+// are left empty.
+func Fingerprint() *spec.HostFingerprint {
+	fingerprintOnce.Do(func() {
+		// not bound to the request which triggered it: the result is kept
+		// for all the following ones.
+		fingerprint = *computeFingerprint(context.Background())
+	})
+	fp := fingerprint
+	return &fp
+}
+
+func computeFingerprint(ctx context.Context) *spec.HostFingerprint {
+	fp := &spec.HostFingerprint{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		CPUCores: runtime.NumCPU(),
+	}
+	if info, err := host.InfoWithContext(ctx); err == nil {
+		fp.Platform = info.Platform
+		fp.PlatformVersion = info.PlatformVersion
+		fp.KernelVersion = info.KernelVersion
+	}
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		fp.TotalMemMB = formatMB(vm.Total)
+	}
+	fp.Runtimes = probeRuntimes(ctx, runtimeProbes)
+	return fp
+}
+
+// probeRuntimes runs the probes concurrently and returns the first line of
+// the output of the probes which succeeded.
+func probeRuntimes(ctx context.Context, probes map[string][]string) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, runtimeProbeTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	versions := make(map[string]string)
+	for name, args := range probes {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, args []string) {
+			defer wg.Done()
+			// java prints its version to stderr.
+			out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput() //nolint:gosec
+			if err != nil {
+				return
+			}
+			line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+			mu.Lock()
+			versions[name] = strings.TrimSpace(line)
+			mu.Unlock()
+		}(name, args)
+	}
+	wg.Wait()
+	return versions
+}
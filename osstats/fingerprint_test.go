@@ -0,0 +1,17 @@
+package osstats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeRuntimes(t *testing.T) {
+	versions := probeRuntimes(context.Background(), map[string][]string{
+		"sh":      {"sh", "-c", "echo 'sh 1.0'; echo extra"},
+		"failing": {"sh", "-c", "exit 1"},
+		"missing": {"lite-engine-missing-runtime", "--version"},
+	})
+	assert.Equal(t, map[string]string{"sh": "sh 1.0"}, versions)
+}
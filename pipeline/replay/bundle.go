@@ -0,0 +1,228 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package replay records the step executions into bundles which can be
+// re-executed locally to reproduce the failures of a pipeline.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/logstream"
+)
+
+// BundleVersion is the version of the bundle format.
+const BundleVersion = 1
+
+const bundlePerm = 0600
+
+type (
+	// Bundle is the record of a step execution. The secrets are redacted
+	// from the requests and the environment.
+	Bundle struct {
+		Version int                   `json:"version"`
+		Setup   *api.SetupRequest     `json:"setup,omitempty"`
+		Step    *api.StartStepRequest `json:"step"`
+		// Env is the environment of the step, the stage variables overridden
+		// by the step variables.
+		Env     map[string]string `json:"env,omitempty"`
+		Images  []Image           `json:"images,omitempty"`
+		Result  *Result           `json:"result,omitempty"`
+		Reports []Report          `json:"reports,omitempty"`
+	}
+
+	// Image is an image used by the step with its repository digest.
+	Image struct {
+		Name   string `json:"name"`
+		Digest string `json:"digest,omitempty"`
+	}
+
+	// Result is the outcome of the recorded execution.
+	Result struct {
+		StartedAt  time.Time `json:"started_at"`
+		DurationMs int64     `json:"duration_ms"`
+		Exited     bool      `json:"exited"`
+		ExitCode   int       `json:"exit_code"`
+		OOMKilled  bool      `json:"oom_killed,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}
+
+	// Report is a report uploaded by the step.
+	Report struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+)
+
+// WriteBundle writes the bundle to the file at path.
+func WriteBundle(path string, b *Bundle) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), fileperm.Mode(os.ModePerm)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, bundlePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadBundle reads the bundle from the file at path.
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Bundle)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("cannot decode bundle %s: %w", path, err)
+	}
+	if b.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if b.Step == nil {
+		return nil, fmt.Errorf("bundle %s has no step", path)
+	}
+	return b, nil
+}
+
+// redactSetup returns a copy of the setup request without the secrets, the
+// key of the secret outputs, the credentials of the log and ti services and
+// of the registries, and the token of the notification webhook.
+func redactSetup(s *api.SetupRequest) *api.SetupRequest {
+	c := *s
+	c.Secrets = nil
+	c.SealedEnvs = nil
+	c.OutputKey = ""
+	c.Envs = redactMap(s.Envs, s.Secrets)
+	c.LogConfig.Token = ""
+	c.LogConfig.Sinks = redactSinks(c.LogConfig.Sinks)
+	c.TIConfig.Token = ""
+	if s.Notify != nil {
+		n := *s.Notify
+		n.WebhookURL = redactURL(n.WebhookURL)
+		c.Notify = &n
+	}
+	if s.Registries != nil {
+		c.Registries = make([]*api.Registry, len(s.Registries))
+		for i, r := range s.Registries {
+			if r == nil {
+				continue
+			}
+			v := *r
+			v.Password, v.ClientKey = "", ""
+			c.Registries[i] = &v
+		}
+	}
+	return &c
+}
+
+// redactStep returns a copy of the step request without the secrets and
+// credentials.
+func redactStep(r *api.StartStepRequest, secrets []string) *api.StartStepRequest {
+	secrets = append(append([]string{}, secrets...), r.Secrets...)
+	c := *r
+	c.Secrets = nil
+	c.SealedEnvs = nil
+	c.Envs = redactMap(r.Envs, secrets)
+	c.Run.Command = redactSlice(r.Run.Command, secrets)
+	c.RunTest.PreCommand = logstream.Redact(r.RunTest.PreCommand, secrets)
+	c.RunTest.PostCommand = logstream.Redact(r.RunTest.PostCommand, secrets)
+	c.RunTestsV2.Command = redactSlice(r.RunTestsV2.Command, secrets)
+	c.LogConfig.Token = ""
+	c.LogConfig.Sinks = redactSinks(c.LogConfig.Sinks)
+	c.TIConfig.Token = ""
+	c.StepStatus.Token = ""
+	c.Auth = nil
+	c.Upload.Storage = redactStorage(r.Upload.Storage)
+	c.Cache.Backend = redactStorage(r.Cache.Backend)
+	if r.Audit.Storage != nil {
+		s := redactStorage(*r.Audit.Storage)
+		c.Audit.Storage = &s
+	}
+	if r.Checkpoint != nil {
+		// the urls may be pre-signed
+		cp := *r.Checkpoint
+		cp.UploadURL, cp.DownloadURL, cp.Headers = "", "", nil
+		c.Checkpoint = &cp
+	}
+	return &c
+}
+
+// redactURL returns the scheme and the host of the url, its path and query
+// may carry a token.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// redactStorage returns the storage without its credentials.
+func redactStorage(s api.Storage) api.Storage {
+	s.AccessKey, s.SecretKey, s.SessionToken = "", "", ""
+	s.AccountKey, s.SASToken = "", ""
+	return s
+}
+
+// env returns the redacted environment of the step, the stage variables
+// overridden by the step variables.
+func env(stage map[string]string, r *api.StartStepRequest, secrets []string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range stage {
+		merged[k] = v
+	}
+	for k, v := range r.Envs {
+		merged[k] = v
+	}
+	return redactMap(merged, append(append([]string{}, secrets...), r.Secrets...))
+}
+
+// redactSinks returns the log sinks without their credentials.
+func redactSinks(sinks []api.LogSink) []api.LogSink {
+	if sinks == nil {
+		return nil
+	}
+	out := make([]api.LogSink, len(sinks))
+	for i, v := range sinks {
+		v.Password, v.Token = "", ""
+		v.AccessKey, v.SecretKey, v.SessionToken = "", "", ""
+		out[i] = v
+	}
+	return out
+}
+
+func redactMap(m map[string]string, secrets []string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = logstream.Redact(v, secrets)
+	}
+	return out
+}
+
+func redactSlice(s, secrets []string) []string {
+	if s == nil {
+		return nil
+	}
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = logstream.Redact(v, secrets)
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/mattn/go-zglob"
+	"github.com/sirupsen/logrus"
+)
+
+// ImageInspector returns the repository digest of a local image.
+type ImageInspector interface {
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+// Recorder is a lifecycle hook writing a bundle of each step execution
+// to a directory.
+type Recorder struct {
+	lifecycle.BaseHook
+
+	dir    string
+	images ImageInspector
+
+	mu      sync.Mutex
+	setup   *api.SetupRequest
+	secrets []string
+	started map[string]time.Time
+}
+
+var _ lifecycle.StepLifecycleHook = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder writing the bundles to dir. The images
+// are not pinned to their digests if images is nil.
+func NewRecorder(dir string, images ImageInspector) *Recorder {
+	return &Recorder{
+		dir:     dir,
+		images:  images,
+		started: make(map[string]time.Time),
+	}
+}
+
+func (c *Recorder) Name() string { return "recorder" }
+
+func (c *Recorder) OnSetup(_ context.Context, r *api.SetupRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setup = redactSetup(r)
+	c.secrets = r.Secrets
+	return nil
+}
+
+func (c *Recorder) OnStepStart(_ context.Context, r *api.StartStepRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started[r.ID] = time.Now()
+	return nil
+}
+
+func (c *Recorder) OnStepEnd(ctx context.Context, r *api.StartStepRequest, res *lifecycle.StepResult) error {
+	c.mu.Lock()
+	setup, secrets := c.setup, c.secrets
+	started, ok := c.started[r.ID]
+	delete(c.started, r.ID)
+	c.mu.Unlock()
+	if !ok {
+		started = time.Now().Add(-res.Duration)
+	}
+
+	b := &Bundle{
+		Version: BundleVersion,
+		Setup:   setup,
+		Step:    redactStep(r, secrets),
+		Result: &Result{
+			StartedAt:  started,
+			DurationMs: res.Duration.Milliseconds(),
+			Exited:     res.Exited,
+			ExitCode:   res.ExitCode,
+			OOMKilled:  res.OOMKilled,
+		},
+		Reports: reports(r),
+	}
+	var stage map[string]string
+	if setup != nil {
+		stage = setup.Envs
+	}
+	b.Env = env(stage, r, secrets)
+	if res.Err != nil {
+		b.Result.Error = res.Err.Error()
+	}
+	if r.Image != "" {
+		img := Image{Name: r.Image}
+		if c.images != nil {
+			digest, err := c.images.ImageDigest(ctx, r.Image)
+			if err != nil {
+				logrus.WithContext(ctx).WithError(err).WithField("image", r.Image).
+					Warnln("cannot inspect the image of the recorded step")
+			}
+			img.Digest = digest
+		}
+		b.Images = append(b.Images, img)
+	}
+	return WriteBundle(filepath.Join(c.dir, bundleName(r.ID, started)), b)
+}
+
+// bundleName returns the file name of the bundle of a step execution.
+func bundleName(id string, started time.Time) string {
+	id = strings.NewReplacer("/", "_", `\`, "_").Replace(id)
+	return fmt.Sprintf("%s-%s.json", id, started.UTC().Format("20060102T150405"))
+}
+
+// reports returns the digests of the test and quality reports of the step.
+func reports(r *api.StartStepRequest) []Report {
+	paths := append([]string{}, r.TestReport.Junit.Paths...)
+	for _, q := range r.TestReport.Quality {
+		paths = append(paths, q.Paths...)
+	}
+
+	var out []Report
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(r.WorkingDir, p)
+		}
+		matches, err := zglob.Glob(p)
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			if report, err := digest(m); err == nil {
+				out = append(out, report)
+			}
+		}
+	}
+	return out
+}
+
+func digest(path string) (Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Report{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Report{}, err
+	}
+	return Report{Path: path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,112 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeImages map[string]string
+
+func (f fakeImages) ImageDigest(_ context.Context, image string) (string, error) {
+	return f[image], nil
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "report.xml"), []byte("<testsuite/>"), 0600))
+
+	c := NewRecorder(dir, fakeImages{"golang:1.20": "golang@sha256:abc"})
+	ctx := context.Background()
+	require.NoError(t, c.OnSetup(ctx, &api.SetupRequest{
+		Envs:    map[string]string{"CI": "true", "TOKEN": "stage-secret"},
+		Secrets: []string{"stage-secret"},
+		LogConfig: api.LogConfig{Token: "log-token", Sinks: []api.LogSink{
+			{Kind: api.LogSinkLoki, URL: "https://loki.example.com", Password: "loki-password"},
+		}},
+		Registries: []*api.Registry{{Address: "registry.example.com", Username: "ci", Password: "registry-password", ClientKey: "client-key"}},
+		OutputKey:  "b3V0cHV0LWtleS1vdXRwdXQta2V5LW91dHB1dC1rZXk=",
+		Notify:     &api.Notify{WebhookURL: "https://hooks.slack.com/services/T000/B000/webhook-token"},
+	}))
+	r := &api.StartStepRequest{
+		ID:         "step1",
+		Image:      "golang:1.20",
+		WorkingDir: workDir,
+		Envs:       map[string]string{"PASSWORD": "step-secret", "CI": "false"},
+		Secrets:    []string{"step-secret"},
+		Run:        api.RunConfig{Command: []string{"echo stage-secret"}},
+		TestReport: api.TestReport{Junit: api.JunitReport{Paths: []string{"*.xml"}}},
+	}
+	require.NoError(t, c.OnStepStart(ctx, r))
+	require.NoError(t, c.OnStepEnd(ctx, r, &lifecycle.StepResult{Exited: true, ExitCode: 2, Err: errors.New("failed"), Duration: time.Second}))
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "step1-*.json"))
+	require.Len(t, matches, 1)
+	b, err := ReadBundle(matches[0])
+	require.NoError(t, err)
+	raw, err := os.ReadFile(matches[0])
+	require.NoError(t, err)
+	for _, secret := range []string{"stage-secret", "step-secret", "log-token", "loki-password", "registry-password",
+		"client-key", "b3V0cHV0LWtleS1vdXRwdXQta2V5LW91dHB1dC1rZXk=", "webhook-token"} {
+		assert.NotContains(t, string(raw), secret)
+	}
+
+	assert.Equal(t, BundleVersion, b.Version)
+	assert.Empty(t, b.Setup.Secrets)
+	assert.Empty(t, b.Setup.LogConfig.Token)
+	assert.Equal(t, []api.LogSink{{Kind: api.LogSinkLoki, URL: "https://loki.example.com"}}, b.Setup.LogConfig.Sinks)
+	assert.Equal(t, "**************", b.Setup.Envs["TOKEN"])
+	assert.Equal(t, []*api.Registry{{Address: "registry.example.com", Username: "ci"}}, b.Setup.Registries)
+	assert.Equal(t, "https://hooks.slack.com", b.Setup.Notify.WebhookURL)
+	assert.Empty(t, b.Step.Secrets)
+	assert.Equal(t, []string{"echo **************"}, b.Step.Run.Command)
+	assert.Equal(t, map[string]string{"CI": "false", "TOKEN": "**************", "PASSWORD": "**************"}, b.Env)
+	assert.Equal(t, []Image{{Name: "golang:1.20", Digest: "golang@sha256:abc"}}, b.Images)
+	assert.Equal(t, 2, b.Result.ExitCode)
+	assert.Equal(t, int64(1000), b.Result.DurationMs)
+	assert.Equal(t, "failed", b.Result.Error)
+	require.Len(t, b.Reports, 1)
+	assert.Equal(t, int64(12), b.Reports[0].Size)
+	assert.Len(t, b.Reports[0].SHA256, 64)
+
+	// the request of the step is not modified
+	assert.Equal(t, []string{"step-secret"}, r.Secrets)
+	assert.Equal(t, "step-secret", r.Envs["PASSWORD"])
+}
+
+func TestRedactStep(t *testing.T) {
+	storage := api.Storage{Kind: api.StorageS3, Bucket: "artifacts", AccessKey: "AKIA", SecretKey: "secret", SessionToken: "session"}
+	r := &api.StartStepRequest{ID: "step1", Upload: api.UploadConfig{Paths: []string{"dist/*"}, Storage: storage},
+		Cache: api.CacheConfig{Key: "go", Backend: api.Storage{Kind: api.StorageAzure, Account: "ci", AccountKey: "key", SASToken: "sas"}},
+		Checkpoint: &api.Checkpoint{Paths: []string{"out"}, UploadURL: "https://storage.example.com/cp?sig=x",
+			Headers: map[string]string{"Authorization": "Bearer token"}},
+		Audit: api.AuditConfig{Storage: &storage}}
+	c := redactStep(r, nil)
+	assert.Equal(t, api.Storage{Kind: api.StorageS3, Bucket: "artifacts"}, c.Upload.Storage)
+	assert.Equal(t, api.Storage{Kind: api.StorageAzure, Account: "ci"}, c.Cache.Backend)
+	assert.Equal(t, &api.Checkpoint{Paths: []string{"out"}}, c.Checkpoint)
+	assert.Equal(t, &api.Storage{Kind: api.StorageS3, Bucket: "artifacts"}, c.Audit.Storage)
+	assert.Equal(t, "Bearer token", r.Checkpoint.Headers["Authorization"])
+	assert.Equal(t, "secret", r.Upload.Storage.SecretKey)
+	assert.Equal(t, "secret", r.Audit.Storage.SecretKey)
+}
+
+func TestReadBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "step": {}}`), 0600))
+	_, err := ReadBundle(path)
+	assert.ErrorContains(t, err, "unsupported bundle version")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 1}`), 0600))
+	_, err = ReadBundle(path)
+	assert.ErrorContains(t, err, "no step")
+}
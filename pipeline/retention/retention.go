@@ -0,0 +1,395 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package retention keeps the reports and the artifacts of the steps on
+// the host, so that they can be fetched from the engine when their upload
+// failed, until the VM is recycled.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-zglob"
+	"github.com/sirupsen/logrus"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/audit"
+	"github.com/harness/lite-engine/engine/lifecycle"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/internal/tarball"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/ti/instrumentation"
+)
+
+const (
+	hookName     = "retention"
+	manifestName = "entry.json" // the manifest of an entry, its mtime is the last use of the entry
+	filesDir     = "files"      // the directory of the files of an entry
+	tmpPrefix    = ".tmp-"      // the directories the files are copied to before they are retained
+	dirPerm      = 0700
+	filePerm     = 0600
+)
+
+// ErrNotFound is returned when the entry or the file is not retained.
+var ErrNotFound = errors.New("artifact not found")
+
+// Store is a lifecycle hook copying the test and quality reports and the
+// uploaded files of each step to a directory. The total size of the files
+// is bounded, the entries least recently retained or fetched are evicted
+// first.
+type Store struct {
+	lifecycle.BaseHook
+
+	dir     string
+	maxSize int64
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	size    int64
+}
+
+// entry is an entry retained.
+type entry struct {
+	api.ArtifactEntry
+	used time.Time
+}
+
+var _ lifecycle.StepLifecycleHook = (*Store)(nil)
+
+// New returns a store of at most maxSize bytes in dir, with the entries
+// retained by the previous runs of the engine.
+func New(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, maxSize: maxSize, now: time.Now, entries: make(map[string]*entry)}
+	dirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(d.Name(), tmpPrefix) {
+			_ = os.RemoveAll(filepath.Join(dir, d.Name()))
+			continue
+		}
+		manifest := filepath.Join(dir, d.Name(), manifestName)
+		info, err := os.Stat(manifest)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			continue
+		}
+		e := &entry{used: info.ModTime()}
+		if err := json.Unmarshal(data, &e.ArtifactEntry); err != nil || e.Name != d.Name() {
+			continue
+		}
+		s.entries[e.Name] = e
+		s.size += e.Size
+	}
+	s.evict(0)
+	return s, nil
+}
+
+// Registered returns the store registered as a lifecycle hook, nil if the
+// retention is disabled.
+func Registered() *Store {
+	s, _ := lifecycle.Lookup(hookName).(*Store)
+	return s
+}
+
+func (s *Store) Name() string { return hookName }
+
+// OnStepEnd copies the reports and the uploaded files of the step. The
+// debug bundle of the step is removed from the shared volume once it is
+// retained. The files are copied without the lock held, to a temporary
+// directory renamed to the entry once the room for it is made.
+func (s *Store) OnStepEnd(_ context.Context, r *api.StartStepRequest, _ *lifecycle.StepResult) error {
+	files := collect(r)
+	if len(files) == 0 {
+		return nil
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total > s.maxSize {
+		return fmt.Errorf("the artifacts of the step exceed the retention size: %d bytes", total)
+	}
+
+	tmpDir, err := os.MkdirTemp(s.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	e := &entry{}
+	e.StepID = r.ID
+	bundle, retainedBundle := instrumentation.DebugBundleFile(r.ID), false
+	if resolved, err := filepath.EvalSymlinks(bundle); err == nil {
+		bundle = resolved // the files are collected with their resolved path
+	}
+	for _, f := range files {
+		n, err := copyFile(f.path, filepath.Join(tmpDir, filesDir, filepath.FromSlash(f.rel)))
+		if err != nil {
+			logrus.WithError(err).WithField("path", f.path).Warnln("retention: cannot retain the file")
+			continue
+		}
+		retainedBundle = retainedBundle || f.path == bundle
+		e.Files = append(e.Files, &api.ArtifactFile{Path: f.rel, Size: n})
+		e.Size += n
+	}
+	if len(e.Files) == 0 || e.Size > s.maxSize {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(e.Size)
+	now := s.now()
+	e.used = now
+	e.Name = s.entryName(r.ID, now)
+	e.RetainedAt = now
+	data, err := json.Marshal(&e.ArtifactEntry)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, manifestName), data, filePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, filepath.Join(s.dir, e.Name)); err != nil {
+		return err
+	}
+	s.entries[e.Name] = e
+	s.size += e.Size
+	if retainedBundle {
+		_ = os.Remove(bundle)
+	}
+	return nil
+}
+
+// entryName returns a name unique in the store for the entry of the step.
+func (s *Store) entryName(id string, now time.Time) string {
+	id = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, id)
+	base := fmt.Sprintf("%s-%s", strings.TrimLeft(id, "."), now.UTC().Format("20060102T150405"))
+	name := base
+	for i := 2; s.entries[name] != nil; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+// evict removes the entries least recently used until the size of the
+// store leaves room for n bytes. It is called with the lock held.
+func (s *Store) evict(n int64) {
+	if s.size+n <= s.maxSize {
+		return
+	}
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if s.size+n <= s.maxSize {
+			return
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, e.Name)); err != nil {
+			logrus.WithError(err).WithField("entry", e.Name).Warnln("retention: cannot evict the entry")
+			continue
+		}
+		delete(s.entries, e.Name)
+		s.size -= e.Size
+	}
+}
+
+// List returns the entries of the step, or all the entries if not set,
+// the most recent first.
+func (s *Store) List(stepID string) []*api.ArtifactEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*api.ArtifactEntry{}
+	for _, e := range s.entries {
+		if stepID == "" || e.StepID == stepID {
+			c := e.ArtifactEntry
+			out = append(out, &c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].RetainedAt.Equal(out[j].RetainedAt) {
+			return out[i].RetainedAt.After(out[j].RetainedAt)
+		}
+		return out[i].Name > out[j].Name
+	})
+	return out
+}
+
+// Has returns true if the entry is retained.
+func (s *Store) Has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[name] != nil
+}
+
+// Open opens the retained file of the entry.
+func (s *Store) Open(name, path string) (*os.File, error) {
+	e, err := s.use(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range e.Files {
+		if f.Path == path {
+			return os.Open(filepath.Join(s.dir, e.Name, filesDir, filepath.FromSlash(f.Path)))
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// WriteArchive writes the tar.gz archive of the files of the entry.
+func (s *Store) WriteArchive(w io.Writer, name string) error {
+	e, err := s.use(name)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(e.Files))
+	for i, f := range e.Files {
+		paths[i] = f.Path
+	}
+	gz := gzip.NewWriter(w)
+	if err := tarball.Write(gz, filepath.Join(s.dir, e.Name, filesDir), paths); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// use returns a copy of the entry and marks it as used, so that it is
+// evicted last.
+func (s *Store) use(name string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[name]
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	e.used = s.now()
+	manifest := filepath.Join(s.dir, e.Name, manifestName)
+	if err := os.Chtimes(manifest, e.used, e.used); err != nil {
+		logrus.WithError(err).WithField("entry", e.Name).Warnln("retention: cannot mark the entry as used")
+	}
+	c := *e
+	return &c, nil
+}
+
+// file is a file of a step to retain.
+type file struct {
+	path string // the path on the host
+	rel  string // the slash separated path in the entry
+	size int64
+}
+
+// collect returns the test and quality reports of the step, the files of an
+// upload step, the findings report of an audit step and the debug bundle
+// of the test selection. The files outside of the working directory, the
+// scratch directory and the shared volume of the step are not retained.
+func collect(r *api.StartStepRequest) []file {
+	globs := append([]string{}, r.TestReport.Junit.Paths...)
+	for _, q := range r.TestReport.Quality {
+		globs = append(globs, q.Paths...)
+	}
+	if r.Kind == api.Upload {
+		globs = append(globs, r.Upload.Paths...)
+	}
+	if r.Kind == api.Audit {
+		report := r.Audit.Report
+		if report == "" {
+			report = audit.DefaultReport
+		}
+		globs = append(globs, report)
+	}
+	if r.RunTest.DebugBundle || r.RunTestsV2.DebugBundle {
+		globs = append(globs, instrumentation.DebugBundleFile(r.ID))
+	}
+
+	var files []file
+	seen := make(map[string]bool)
+	for _, g := range globs {
+		if !filepath.IsAbs(g) {
+			g = filepath.Join(r.WorkingDir, g)
+		}
+		matches, err := zglob.Glob(g)
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			resolved, err := safepath.Confine(m, r.WorkingDir, r.ScratchDir, pipeline.SharedVolPath)
+			if err != nil {
+				logrus.WithError(err).WithField("step", r.ID).Warnln("retention: the file is not retained")
+				continue
+			}
+			info, err := os.Stat(resolved)
+			if err != nil || !info.Mode().IsRegular() || seen[resolved] {
+				continue
+			}
+			seen[resolved] = true
+			files = append(files, file{path: resolved, rel: relPath(r.WorkingDir, m), size: info.Size()})
+		}
+	}
+	return files
+}
+
+// relPath returns the path of the file relative to the working directory,
+// the files outside of it are kept under their absolute path.
+func relPath(workDir, path string) string {
+	if workDir != "" {
+		if rel, err := filepath.Rel(workDir, path); err == nil && tarball.Local(rel) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	vol := filepath.VolumeName(path)
+	rel := strings.TrimLeft(filepath.ToSlash(path[len(vol):]), "/")
+	if vol != "" {
+		rel = strings.TrimSuffix(vol, ":") + "/" + rel
+	}
+	return rel
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	if err = os.MkdirAll(filepath.Dir(dst), dirPerm); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
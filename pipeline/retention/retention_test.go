@@ -0,0 +1,139 @@
+package retention
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/lifecycle"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func step(id, workDir string) *api.StartStepRequest {
+	return &api.StartStepRequest{
+		ID:         id,
+		WorkingDir: workDir,
+		TestReport: api.TestReport{Junit: api.JunitReport{Paths: []string{"reports/*.xml"}}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	workDir := t.TempDir()
+	writeFile(t, filepath.Join(workDir, "reports", "unit.xml"), strings.Repeat("u", 40))
+	writeFile(t, filepath.Join(workDir, "reports", "it.xml"), "integration test")
+
+	dir := t.TempDir()
+	s, err := New(dir, 100)
+	require.NoError(t, err)
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.OnStepEnd(context.Background(), step("build", workDir), &lifecycle.StepResult{}))
+	entries := s.List("")
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "build-20220501T120000", e.Name)
+	assert.Equal(t, "build", e.StepID)
+	assert.Equal(t, int64(56), e.Size)
+	assert.ElementsMatch(t, []*api.ArtifactFile{{Path: "reports/it.xml", Size: 16}, {Path: "reports/unit.xml", Size: 40}}, e.Files)
+
+	f, err := s.Open(e.Name, "reports/unit.xml")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, strings.Repeat("u", 40), string(data))
+	_, err = s.Open(e.Name, "../entry.json")
+	assert.Equal(t, ErrNotFound, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteArchive(&buf, e.Name))
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.ElementsMatch(t, []string{"reports/it.xml", "reports/unit.xml"}, names)
+
+	// the entries are kept across the restarts of the engine
+	s, err = New(dir, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []*api.ArtifactEntry{e}, s.List("build"))
+	assert.Empty(t, s.List("test"))
+}
+
+func TestStoreEviction(t *testing.T) {
+	workDir := t.TempDir()
+	writeFile(t, filepath.Join(workDir, "reports", "unit.xml"), strings.Repeat("u", 40))
+
+	s, err := New(t.TempDir(), 100)
+	require.NoError(t, err)
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, id := range []string{"one", "two"} {
+		require.NoError(t, s.OnStepEnd(context.Background(), step(id, workDir), &lifecycle.StepResult{}))
+	}
+	// the entry fetched is evicted last
+	one := s.List("one")[0].Name
+	assert.True(t, s.Has(one))
+	require.NoError(t, s.WriteArchive(io.Discard, one))
+
+	require.NoError(t, s.OnStepEnd(context.Background(), step("three", workDir), &lifecycle.StepResult{}))
+	assert.Len(t, s.List("one"), 1)
+	assert.Empty(t, s.List("two"))
+	assert.Len(t, s.List("three"), 1)
+
+	// the artifacts larger than the store are not retained
+	writeFile(t, filepath.Join(workDir, "reports", "large.xml"), strings.Repeat("l", 200))
+	assert.Error(t, s.OnStepEnd(context.Background(), step("four", workDir), &lifecycle.StepResult{}))
+	assert.Len(t, s.List(""), 2)
+}
+
+func TestRelPath(t *testing.T) {
+	assert.Equal(t, "reports/unit.xml", relPath("/harness", "/harness/reports/unit.xml"))
+	assert.Equal(t, "tmp/reports/unit.xml", relPath("/harness", "/tmp/reports/unit.xml"))
+	assert.Equal(t, "tmp/unit.xml", relPath("", "/tmp/unit.xml"))
+}
+
+func TestStoreConfined(t *testing.T) {
+	workDir, outside := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(workDir, "reports", "unit.xml"), "unit test")
+	writeFile(t, filepath.Join(outside, "secret.xml"), "secret")
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.xml"), filepath.Join(workDir, "reports", "link.xml")))
+
+	s, err := New(t.TempDir(), 100)
+	require.NoError(t, err)
+	r := step("build", workDir)
+	r.TestReport.Quality = []api.QualityReport{{Paths: []string{filepath.Join(outside, "*.xml")}}}
+	require.NoError(t, s.OnStepEnd(context.Background(), r, &lifecycle.StepResult{}))
+
+	// the files outside of the directories of the step are not retained
+	entries := s.List("build")
+	require.Len(t, entries, 1)
+	assert.Equal(t, []*api.ArtifactFile{{Path: "reports/unit.xml", Size: 9}}, entries[0].Files)
+}
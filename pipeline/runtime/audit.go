@@ -0,0 +1,96 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/audit"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/harness/lite-engine/ti/report"
+	"github.com/sirupsen/logrus"
+)
+
+// executeAuditStep audits the lockfiles of the working directory and writes
+// the findings report, uploaded as the artifact of the step if the storage
+// is set. The counts of the findings by severity are set as the outputs,
+// the step fails on the findings of the fail on severity or more severe.
+func executeAuditStep(ctx context.Context, r *api.StartStepRequest, out io.Writer) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	log := logrus.New()
+	log.Out = out
+	cfg := &r.Audit
+
+	result, err := audit.Run(ctx, r.WorkingDir, cfg.Lockfiles, cfg.URL)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	if len(result.Lockfiles) == 0 {
+		log.Warnln("no lockfile found to audit")
+	} else {
+		log.Infof("Audited %d packages of %s", result.Packages, strings.Join(result.Lockfiles, ", "))
+	}
+	for _, f := range result.Findings {
+		log.Infof("%s %s %s@%s (%s): %s", f.Severity, f.ID, f.Name, f.Version, f.Lockfile, f.Summary)
+	}
+
+	name := cfg.Report
+	if name == "" {
+		name = audit.DefaultReport
+	}
+	file := filepath.Join(r.WorkingDir, filepath.FromSlash(name))
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	if err = os.WriteFile(file, data, artifactFilePerm); err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+
+	var artifact []byte
+	if cfg.Storage != nil {
+		store, err := objstore.New(cfg.Storage)
+		if err != nil {
+			return nil, nil, nil, nil, nil, "", err
+		}
+		key := path.Join(cfg.Target, name)
+		if err = uploadFile(ctx, store, key, file); err != nil {
+			return nil, nil, nil, nil, nil, "", err
+		}
+		log.Infof("Uploaded the findings report %s", name)
+		artifact, err = addFileArtifacts(r.ID, []report.FileArtifact{{Name: name, URL: store.URL(key)}}, out)
+		if err != nil {
+			return nil, nil, nil, nil, nil, "", err
+		}
+	}
+
+	outputs := make(map[string]string)
+	var outputsV2 []*api.OutputV2
+	total := 0
+	for _, s := range audit.Severities {
+		key := strings.ToLower(string(s))
+		outputs[key] = strconv.Itoa(result.Counts[s])
+		outputsV2 = append(outputsV2, &api.OutputV2{Key: key, Value: outputs[key], Type: api.OutputTypeString})
+		total += result.Counts[s]
+	}
+	outputs["total"] = strconv.Itoa(total)
+	outputsV2 = append(outputsV2, &api.OutputV2{Key: "total", Value: outputs["total"], Type: api.OutputTypeString})
+
+	state := &runtime.State{Exited: true}
+	if result.Exceeds(cfg.FailOn) {
+		log.Errorf("Found vulnerabilities of severity %s or more severe", strings.ToUpper(cfg.FailOn))
+		state.ExitCode = 1
+	}
+	return state, outputs, nil, artifact, outputsV2, "", nil
+}
@@ -0,0 +1,51 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteAuditStep(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/querybatch" {
+			_, _ = w.Write([]byte(`{"results": [{"vulns": [{"id": "GHSA-x"}]}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": "GHSA-x", "database_specific": {"severity": "HIGH"}}`))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("django==3.2.0\n"), 0o600))
+
+	r := &api.StartStepRequest{ID: "audit-test", Kind: api.Audit, WorkingDir: dir,
+		Audit: api.AuditConfig{URL: srv.URL, FailOn: "critical", Report: "reports/audit.json"}}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "reports"), 0o755))
+	state, outputs, _, artifact, outputsV2, _, err := executeAuditStep(context.Background(), r, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 0, state.ExitCode)
+	assert.Nil(t, artifact)
+	assert.Equal(t, map[string]string{"critical": "0", "high": "1", "medium": "0", "low": "0", "unknown": "0", "total": "1"}, outputs)
+	assert.Len(t, outputsV2, 6)
+
+	data, err := os.ReadFile(filepath.Join(dir, "reports", "audit.json"))
+	require.NoError(t, err)
+	var report audit.Report
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "django", report.Findings[0].Name)
+
+	r.Audit.FailOn = "high"
+	state, _, _, _, _, _, err = executeAuditStep(context.Background(), r, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.ExitCode)
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+// stageBudget tracks the budget of the stage set up, the wall clock since
+// the setup and the sum of the durations of its steps.
+type stageBudget struct {
+	mu       sync.Mutex
+	deadline time.Time     // the end of the wall clock budget, none if zero
+	max      time.Duration // the sum of the step durations, unlimited if zero
+	used     time.Duration
+}
+
+var currentBudget = new(stageBudget)
+
+// SetStageBudget sets the budget of the stage set up, it is unlimited if
+// b is nil.
+func SetStageBudget(b *api.StageBudget) {
+	s := new(stageBudget)
+	if b != nil {
+		if b.MaxDuration > 0 {
+			s.deadline = clk.Now().Add(time.Duration(b.MaxDuration) * time.Second)
+		}
+		s.max = time.Duration(b.MaxStepDuration) * time.Second
+	}
+	currentBudget.mu.Lock()
+	defer currentBudget.mu.Unlock()
+	currentBudget.deadline, currentBudget.max, currentBudget.used = s.deadline, s.max, 0
+}
+
+// ValidateStageBudget returns the issues of the budget of a stage.
+func ValidateStageBudget(b *api.StageBudget) []string {
+	if b == nil || (b.MaxDuration >= 0 && b.MaxStepDuration >= 0) {
+		return nil
+	}
+	return []string{"the max duration and max step duration cannot be negative"}
+}
+
+// check returns an error if the budget is exhausted.
+func (b *stageBudget) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.remaining(); ok {
+		return nil
+	}
+	return b.err()
+}
+
+// remaining returns the time left of the budget, false if it is exhausted
+// and a negative duration if it is unlimited. It needs to be called with
+// mu held.
+func (b *stageBudget) remaining() (time.Duration, bool) {
+	left := time.Duration(-1)
+	if !b.deadline.IsZero() {
+		left = b.deadline.Sub(clk.Now())
+		if left <= 0 {
+			return 0, false
+		}
+	}
+	if b.max > 0 {
+		steps := b.max - b.used
+		if steps <= 0 {
+			return 0, false
+		}
+		if left < 0 || steps < left {
+			left = steps
+		}
+	}
+	return left, true
+}
+
+func (b *stageBudget) err() error {
+	if !b.deadline.IsZero() && !clk.Now().Before(b.deadline) {
+		return &errors.BudgetExceededError{Msg: "the stage exceeded its max duration, it does not start new steps"}
+	}
+	return &errors.BudgetExceededError{Msg: fmt.Sprintf(
+		"the steps of the stage exceeded their max duration of %s, it does not start new steps", b.max)}
+}
+
+// context returns the context of a step, canceled once the time left of
+// the budget when the step starts elapsed. The steps running in parallel
+// can then overrun the sum of the step durations, never the wall clock.
+func (b *stageBudget) context(parent context.Context) (context.Context, context.CancelFunc) {
+	b.mu.Lock()
+	left, _ := b.remaining()
+	b.mu.Unlock()
+	if left < 0 {
+		return context.WithCancel(parent)
+	}
+	return clock.WithTimeout(parent, clk, left)
+}
+
+// add adds the duration of a step to the budget.
+func (b *stageBudget) add(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += d
+}
+
+// exceeded returns the error of a step stopped by the budget, if any.
+func (b *stageBudget) exceeded(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err()
+}
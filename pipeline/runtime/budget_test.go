@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageBudget(t *testing.T) {
+	fake := useFakeClock(t)
+	t.Cleanup(func() { SetStageBudget(nil) })
+
+	// unlimited
+	SetStageBudget(nil)
+	assert.Nil(t, currentBudget.check())
+	ctx, cancel := currentBudget.context(context.Background())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	// the step durations are summed up
+	SetStageBudget(&api.StageBudget{MaxDuration: 3600, MaxStepDuration: 60})
+	currentBudget.add(40 * time.Second)
+	assert.Nil(t, currentBudget.check())
+	ctx, cancel = currentBudget.context(context.Background())
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	assert.Equal(t, fake.Now().Add(20*time.Second), deadline)
+	fake.Advance(20 * time.Second)
+	assert.Error(t, currentBudget.exceeded(ctx))
+	currentBudget.add(20 * time.Second)
+	err := currentBudget.check()
+	assert.IsType(t, &errors.BudgetExceededError{}, err)
+	assert.Contains(t, err.Error(), "max duration of 1m0s")
+
+	// the wall clock since the setup
+	SetStageBudget(&api.StageBudget{MaxDuration: 60})
+	ctx, cancel = currentBudget.context(context.Background())
+	defer cancel()
+	assert.Nil(t, currentBudget.exceeded(ctx))
+	fake.Advance(time.Minute)
+	assert.Equal(t, "the stage exceeded its max duration, it does not start new steps", currentBudget.check().Error())
+	assert.Error(t, currentBudget.exceeded(ctx))
+
+	// a new stage resets the budget
+	SetStageBudget(&api.StageBudget{MaxStepDuration: 60})
+	assert.Nil(t, currentBudget.check())
+}
+
+func TestStartStepBudgetExceeded(t *testing.T) {
+	fake := useFakeClock(t)
+	t.Cleanup(func() { SetStageBudget(nil) })
+	SetStageBudget(&api.StageBudget{MaxDuration: 1})
+	fake.Advance(time.Second)
+
+	e := NewStepExecutor(nil)
+	r := &api.StartStepRequest{ID: "step", Run: api.RunConfig{Command: []string{"echo"}}, Image: "alpine"}
+	assert.IsType(t, &errors.BudgetExceededError{}, e.StartStep(context.Background(), r))
+	assert.IsType(t, &errors.BudgetExceededError{}, e.StartStepWithStatusUpdate(context.Background(), r))
+	assert.Equal(t, 0, e.RunningSteps())
+}
+
+func TestValidateStageBudget(t *testing.T) {
+	assert.Empty(t, ValidateStageBudget(nil))
+	assert.Empty(t, ValidateStageBudget(&api.StageBudget{MaxDuration: 60}))
+	assert.Len(t, ValidateStageBudget(&api.StageBudget{MaxStepDuration: -1}), 1)
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/cache"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	cacheHitOutput  = "cache_hit"
+	cacheKeyOutput  = "cache_key"
+	cacheSizeOutput = "cache_size"
+)
+
+// executeCacheStep restores or saves the cache of the step in the engine.
+// The failures of the backend are logged as warnings and do not fail the
+// step, a missing cache only slows the build down. The keys which cannot be
+// evaluated fail the step.
+func executeCacheStep(ctx context.Context, r *api.StartStepRequest, out io.Writer) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	log := logrus.New()
+	log.Out = out
+	cfg := &r.Cache
+
+	key, err := cache.Key(cfg.Key, r.WorkingDir, r.Envs)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", fmt.Errorf("cannot evaluate the cache key: %w", err)
+	}
+	b, err := objstore.New(&cfg.Backend)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+
+	outputs := map[string]string{cacheKeyOutput: key}
+	start := time.Now()
+	if r.Kind == api.CacheRestore {
+		keys := []string{key}
+		for _, t := range cfg.RestoreKeys {
+			k, kerr := cache.Key(t, r.WorkingDir, r.Envs)
+			if kerr != nil {
+				return nil, nil, nil, nil, nil, "", fmt.Errorf("cannot evaluate the cache restore key: %w", kerr)
+			}
+			keys = append(keys, k)
+		}
+		restored, rerr := cache.Restore(ctx, b, keys, r.WorkingDir)
+		switch {
+		case rerr != nil:
+			log.WithError(rerr).Warnln("cannot restore the cache")
+		case restored == "":
+			log.Infof("No cache found for the key %s", key)
+		default:
+			log.Infof("Restored the cache %s in %s", restored, time.Since(start).Round(time.Millisecond))
+			outputs[cacheKeyOutput] = restored
+		}
+		outputs[cacheHitOutput] = strconv.FormatBool(rerr == nil && restored == key)
+	} else {
+		saveCache(ctx, b, key, r, log, outputs)
+	}
+	return &runtime.State{Exited: true}, outputs, nil, nil, cacheOutputsV2(outputs), "", nil
+}
+
+func saveCache(ctx context.Context, b objstore.Store, key string, r *api.StartStepRequest, log *logrus.Logger, outputs map[string]string) {
+	start := time.Now()
+	if !r.Cache.Override {
+		exists, err := cache.Exists(ctx, b, key)
+		if err != nil {
+			log.WithError(err).Warnln("cannot check the cache")
+			return
+		}
+		if exists {
+			log.Infof("The cache %s exists, it is not saved", key)
+			return
+		}
+	}
+	size, err := cache.Save(ctx, b, key, r.WorkingDir, r.Cache.Paths)
+	if err != nil {
+		log.WithError(err).Warnln("cannot save the cache")
+		return
+	}
+	log.Infof("Saved the cache %s of %d bytes in %s", key, size, time.Since(start).Round(time.Millisecond))
+	outputs[cacheSizeOutput] = strconv.FormatInt(size, 10)
+}
+
+func cacheOutputsV2(outputs map[string]string) []*api.OutputV2 {
+	var outputsV2 []*api.OutputV2
+	for _, name := range []string{cacheHitOutput, cacheKeyOutput, cacheSizeOutput} {
+		if v, ok := outputs[name]; ok {
+			outputsV2 = append(outputsV2, &api.OutputV2{Key: name, Value: v, Type: api.OutputTypeString})
+		}
+	}
+	return outputsV2
+}
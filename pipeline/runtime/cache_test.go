@@ -0,0 +1,51 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCacheStep(t *testing.T) {
+	backend := api.Storage{Kind: api.StorageLocal, Path: t.TempDir()}
+	ctx := context.Background()
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "go.sum"), []byte("a v1.0.0"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, ".cache", "go"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, ".cache", "go", "mod"), []byte("module"), 0o600))
+	save := &api.StartStepRequest{Kind: api.CacheSave, WorkingDir: src, Cache: api.CacheConfig{
+		Key: `go-{{ checksum "go.sum" }}`, Paths: []string{".cache/go"}, Backend: backend}}
+	state, outputs, _, _, _, _, err := executeCacheStep(ctx, save, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 0, state.ExitCode)
+	assert.Contains(t, outputs, cacheSizeOutput)
+	key := outputs[cacheKeyOutput]
+
+	// the existing cache is not saved again
+	_, outputs, _, _, _, _, err = executeCacheStep(ctx, save, io.Discard)
+	require.NoError(t, err)
+	assert.NotContains(t, outputs, cacheSizeOutput)
+
+	dst := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "go.sum"), []byte("a v1.1.0"), 0o600))
+	restore := &api.StartStepRequest{Kind: api.CacheRestore, WorkingDir: dst, Cache: api.CacheConfig{
+		Key: `go-{{ checksum "go.sum" }}`, RestoreKeys: []string{key}, Backend: backend}}
+	_, outputs, _, _, outputsV2, _, err := executeCacheStep(ctx, restore, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{cacheHitOutput: "false", cacheKeyOutput: key}, outputs)
+	assert.Len(t, outputsV2, 2)
+	data, err := os.ReadFile(filepath.Join(dst, ".cache", "go", "mod"))
+	require.NoError(t, err)
+	assert.Equal(t, "module", string(data))
+
+	restore.Cache.Key = `go-{{ checksum "go.mod" }}`
+	_, _, _, _, _, _, err = executeCacheStep(ctx, restore, io.Discard)
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/charset"
+	"golang.org/x/text/encoding"
+)
+
+// withCharset transcodes the output of the command from the encoding to
+// UTF-8, so the logs of the tools writing in a legacy encoding are
+// readable.
+func withCharset(f RunFunc, enc encoding.Encoding) RunFunc {
+	return func(ctx context.Context, step *spec.Step, output io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+		w := charset.NewWriter(output, enc)
+		defer w.Close()
+		return f(ctx, step, w, isDrone, isHosted)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/checkpoint"
+	"github.com/sirupsen/logrus"
+)
+
+const finalSnapshotTimeout = 10 * time.Minute
+
+// startCheckpoint restores the last checkpoint of the step and snapshots
+// its checkpoint paths until the returned function is called. The function
+// takes a last snapshot if the step failed, for its retry to resume from.
+func startCheckpoint(ctx context.Context, r *api.StartStepRequest, log *logrus.Logger) func(success bool) {
+	cfg := r.Checkpoint
+	if cfg == nil {
+		return func(bool) {}
+	}
+	if ok, err := checkpoint.Restore(ctx, cfg, r.WorkingDir); err != nil {
+		log.WithError(err).Warnln("Failed to restore the checkpoint, starting from zero")
+	} else if ok {
+		log.Infoln("Restored the checkpoint")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the step output is not written to concurrently, the failures are
+		// logged by the engine
+		checkpoint.Run(ctx, cfg, r.WorkingDir, logrus.WithField("step", r.ID))
+	}()
+	return func(success bool) {
+		cancel()
+		<-done
+		if success {
+			return
+		}
+		// the context of the step is done if it timed out
+		ctx, cancel := context.WithTimeout(context.Background(), finalSnapshotTimeout)
+		defer cancel()
+		if err := checkpoint.Snapshot(ctx, cfg, r.WorkingDir); err != nil {
+			log.WithError(err).Warnln("Failed to snapshot the checkpoint")
+			return
+		}
+		log.Infoln("Saved the checkpoint for the retry of the step")
+	}
+}
@@ -18,11 +18,14 @@ import (
 	v3 "github.com/harness/godotenv/v3"
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/safepath"
 	"github.com/harness/lite-engine/livelog"
 	"github.com/harness/lite-engine/logstream"
 	"github.com/harness/lite-engine/logstream/remote"
 	"github.com/harness/lite-engine/logstream/stdout"
+	"github.com/harness/lite-engine/pipeline"
 	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/instrumentation"
 	ti "github.com/harness/ti-client/types"
 	"github.com/sirupsen/logrus"
 )
@@ -31,9 +34,11 @@ const (
 	ciNewVersionGodotEnv = "CI_NEW_VERSION_GODOTENV"
 )
 
+// getNudges returns the nudges of the engine and of the catalog of the
+// stage, if any.
 func getNudges() []logstream.Nudge {
 	// <search-term> <resolution> <error-msg>
-	return []logstream.Nudge{
+	nudges := []logstream.Nudge{
 		logstream.NewNudge("[Kk]illed", "Increase memory resources for the step", errors.New("out of memory")),
 		logstream.NewNudge(".*git.* SSL certificate problem",
 			"Set sslVerify to false in CI codebase properties", errors.New("SSL certificate error")),
@@ -41,66 +46,57 @@ func getNudges() []logstream.Nudge {
 			"Setup dind if it's not running. If dind is running, privileged should be set to true",
 			errors.New("could not connect to the docker daemon")),
 	}
+	return append(nudges, pipeline.GetState().GetNudges()...)
 }
 
-func getOutputVarCmd(entrypoint, outputVars []string, outputFile string) string {
-	isPsh := IsPowershell(entrypoint)
-	isPython := isPython(entrypoint)
-
+func getOutputVarCmd(shell api.Shell, outputVars []string, outputFile string) string {
 	cmd := ""
-	if isPsh {
+	switch shell {
+	case api.ShellPwsh, api.ShellPowershell:
 		cmd += fmt.Sprintf("\nNew-Item %s", outputFile)
-	} else if isPython {
+	case api.ShellPython:
 		cmd += "\nimport os\n"
 	}
 	for _, o := range outputVars {
-		if isPsh {
-			cmd += fmt.Sprintf("\n$val = \"%s=$Env:%s\" \nAdd-Content -Path %s -Value $val", o, o, outputFile)
-		} else if isPython {
-			cmd += fmt.Sprintf("with open('%s', 'a') as out_file:\n\tout_file.write('%s=' + os.getenv('%s') + '\\n')\n", outputFile, o, o)
-		} else {
-			cmd += fmt.Sprintf("\necho \"%s=$%s\" >> %s", o, o, outputFile)
-		}
+		cmd += getOutputCmd(shell, o, o, outputFile, false)
 	}
 
 	return cmd
 }
 
-func getOutputsCmd(entrypoint []string, outputVars []*api.OutputV2, outputFile string) string {
-	isPsh := IsPowershell(entrypoint)
-	isPython := isPython(entrypoint)
-
+func getOutputsCmd(shell api.Shell, outputVars []*api.OutputV2, outputFile string) string {
 	cmd := ""
-	if isPsh {
+	switch shell {
+	case api.ShellPwsh, api.ShellPowershell:
 		cmd += fmt.Sprintf("\nNew-Item %s", outputFile)
-	} else if isPython {
+	case api.ShellPython:
 		cmd += "\nimport os\n"
 	}
 	for _, o := range outputVars {
-		if isPsh {
-			cmd += fmt.Sprintf("\n$val = \"%s=$Env:%s\" \nAdd-Content -Path %s -Value $val", o.Key, o.Value, outputFile)
-		} else if isPython {
-			cmd += fmt.Sprintf("with open('%s', 'a') as out_file:\n\tout_file.write('%s=' + os.getenv('%s') + '\\n')\n", outputFile, o.Key, o.Value)
-		} else {
-			cmd += fmt.Sprintf("\necho \"%s='$%s'\" >> %s", o.Key, o.Value, outputFile)
-		}
+		cmd += getOutputCmd(shell, o.Key, o.Value, outputFile, true)
 	}
 
 	return cmd
 }
 
-func IsPowershell(entrypoint []string) bool {
-	if len(entrypoint) > 0 && (entrypoint[0] == "powershell" || entrypoint[0] == "pwsh") {
-		return true
-	}
-	return false
-}
-
-func isPython(entrypoint []string) bool {
-	if len(entrypoint) > 0 && (entrypoint[0] == "python3") {
-		return true
+// getOutputCmd returns the command which appends the value of the env variable
+// to the output file as key=value.
+func getOutputCmd(shell api.Shell, key, env, outputFile string, quote bool) string {
+	switch shell {
+	case api.ShellPwsh, api.ShellPowershell:
+		return fmt.Sprintf("\n$val = \"%s=$Env:%s\" \nAdd-Content -Path %s -Value $val", key, env, outputFile)
+	case api.ShellPython:
+		// raw string literal so that windows paths are not treated as escape sequences
+		return fmt.Sprintf("with open(r'%s', 'a') as out_file:\n\tout_file.write('%s=' + os.getenv('%s', '') + '\\n')\n", outputFile, key, env)
+	case api.ShellCmd:
+		// cmd only executes the first line of a multi-line command
+		return fmt.Sprintf(" & echo %s=%%%s%%>>\"%s\"", key, env, outputFile)
+	default:
+		if quote {
+			return fmt.Sprintf("\necho \"%s='${%s}'\" >> %s", key, env, outputFile)
+		}
+		return fmt.Sprintf("\necho \"%s=${%s}\" >> %s", key, env, outputFile)
 	}
-	return false
 }
 
 // Fetches variable in env file exported by the step.
@@ -140,6 +136,23 @@ func fetchExportedVarsFromEnvFile(envFile string, out io.Writer, useCINewGodotEn
 	return env, nil
 }
 
+// Fetches variables from an env file which must resolve inside the directories
+// the step is allowed to expose to the engine.
+func fetchConfinedVarsFromEnvFile(r *api.StartStepRequest, envFile string, out io.Writer, useCINewGodotEnvVersion bool) (map[string]string, error) {
+	if err := confineStepFile(r, envFile); err != nil {
+		return nil, err
+	}
+	return fetchExportedVarsFromEnvFile(envFile, out, useCINewGodotEnvVersion)
+}
+
+// confineStepFile returns an error if the file does not resolve inside the workspace,
+// the shared volume or the scratch directory of the step. This prevents a step from
+// reading arbitrary host files through the engine, eg. using a symlink.
+func confineStepFile(r *api.StartStepRequest, path string) error {
+	_, err := safepath.ConfineInput(path, pipeline.SharedVolPath, r.WorkingDir, r.ScratchDir)
+	return err
+}
+
 func fetchArtifactDataFromArtifactFile(artifactFile string, out io.Writer) ([]byte, error) {
 	log := logrus.New()
 	log.Out = out
@@ -156,6 +169,18 @@ func fetchArtifactDataFromArtifactFile(artifactFile string, out io.Writer) ([]by
 	return content, nil
 }
 
+// setTestDeadline sets the deadline of the tests in the step environment
+// if the step has a timeout, so that the test frameworks can stop before it.
+func setTestDeadline(r *api.StartStepRequest, start time.Time) {
+	if r.Timeout <= 0 {
+		return
+	}
+	if r.Envs == nil {
+		r.Envs = make(map[string]string)
+	}
+	instrumentation.InjectDeadline(r.Envs, start.Add(time.Second*time.Duration(r.Timeout)), time.Now())
+}
+
 // setTiEnvVariables sets the environment variables required for TI
 func setTiEnvVariables(step *spec.Step, config *tiCfg.Cfg) {
 	if config == nil {
@@ -180,7 +205,9 @@ func setTiEnvVariables(step *spec.Step, config *tiCfg.Cfg) {
 
 func getLogServiceClient(cfg api.LogConfig) logstream.Client {
 	if cfg.URL != "" {
-		return remote.NewHTTPClient(cfg.URL, cfg.AccountID, cfg.Token, cfg.IndirectUpload, false)
+		client := remote.NewHTTPClient(cfg.URL, cfg.AccountID, cfg.Token, cfg.IndirectUpload, false)
+		client.Compress = cfg.CompressUpload
+		return client
 	}
 	return stdout.New()
 }
@@ -192,17 +219,38 @@ func GetReplacer(
 ) logstream.Writer {
 	client := getLogServiceClient(cfg)
 	wc := livelog.New(client, logKey, name, []logstream.Nudge{}, false, cfg.TrimNewLineSuffix)
-	return logstream.NewReplacer(wc, secrets)
+	if cfg.MaxPendingLines > 0 {
+		wc.SetPendingLimit(cfg.MaxPendingLines)
+	}
+	setBatching(wc, &cfg)
+	wc.SetStructured(cfg.StructuredLogs)
+	patterns, _ := logstream.LoadPatterns(cfg.MaskPatterns, cfg.MaskPatternsFile)
+	compiled, _ := logstream.CompilePatterns(patterns)
+	var detector *logstream.EntropyDetector
+	if cfg.MaskHighEntropy {
+		detector = logstream.NewEntropyDetector(cfg.HighEntropyMinLength, cfg.HighEntropyThreshold)
+	}
+	return logstream.NewMaskedWriter(wc, nil, secrets, compiled, detector)
+}
+
+// setBatching sets the batches of lines the writer streams to the log
+// service.
+func setBatching(wc *livelog.Writer, cfg *api.LogConfig) {
+	wc.SetBatchSize(cfg.BatchSize)
+	wc.SetUploadWorkers(cfg.UploadWorkers)
+	if cfg.FlushIntervalMs > 0 {
+		wc.SetInterval(time.Duration(cfg.FlushIntervalMs) * time.Millisecond)
+	}
 }
 
 func waitForZipUnlock(timeout time.Duration, tiConfig *tiCfg.Cfg) error {
-	deadline := time.Now().Add(timeout)
+	deadline := clk.Now().Add(timeout)
 	for {
-		time.Sleep(time.Second * 1)
+		clk.Sleep(time.Second * 1)
 		if !tiConfig.IsZipLocked() {
 			return nil
 		}
-		if time.Now().After(deadline) {
+		if clk.Now().After(deadline) {
 			return fmt.Errorf("timeout waiting for agent download")
 		}
 	}
@@ -38,9 +38,22 @@ func toStep(r *api.StartStepRequest) *spec.Step {
 		Pull:         r.Pull,
 		ShmSize:      r.ShmSize,
 		User:         r.User,
+		GroupAdd:     r.GroupAdd,
+		HostUser:     r.HostUser,
 		Volumes:      r.Volumes,
 		WorkingDir:   r.WorkingDir,
 		Files:        r.Files,
 		SoftStop:     r.SoftStop,
+		Clock:        r.Clock,
+		Umask:        r.Umask,
+		OCIRuntime:   r.OCIRuntime,
+
+		SecurityContext: r.SecurityContext,
+		GPUs:            r.GPUs,
+		Isolation:       r.Isolation,
+		Platform:        r.Platform,
+		WorkspaceClone:  r.WorkspaceClone,
+		WarmContainer:   r.WarmContainer,
+		IsolatedHome:    r.IsolatedHome,
 	}
 }
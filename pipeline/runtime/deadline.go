@@ -0,0 +1,151 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/internal/clock"
+)
+
+// stepDeadlines are the deadlines of the running steps. They are suspended
+// while the stage is paused and extended by the pause on resume, so that
+// a step does not time out because the VM hibernated.
+var stepDeadlines = &deadlines{set: make(map[*pausableCtx]struct{})}
+
+type deadlines struct {
+	mu     sync.Mutex
+	paused bool
+	set    map[*pausableCtx]struct{}
+}
+
+// PauseDeadlines suspends the deadlines of the running steps, eg. while the
+// step containers of the stage are paused.
+func PauseDeadlines() {
+	stepDeadlines.mu.Lock()
+	defer stepDeadlines.mu.Unlock()
+	if stepDeadlines.paused {
+		return
+	}
+	stepDeadlines.paused = true
+	now := clk.Now()
+	for p := range stepDeadlines.set {
+		p.pause(now)
+	}
+}
+
+// ResumeDeadlines extends the deadlines of the running steps by the time
+// they were suspended and restarts them.
+func ResumeDeadlines() {
+	stepDeadlines.mu.Lock()
+	defer stepDeadlines.mu.Unlock()
+	if !stepDeadlines.paused {
+		return
+	}
+	stepDeadlines.paused = false
+	now := clk.Now()
+	for p := range stepDeadlines.set {
+		p.resume(now)
+	}
+}
+
+// withStepTimeout is clock.WithTimeout with the timeout suspended while the
+// stage is paused.
+func withStepTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return withStepDeadline(parent, clk.Now().Add(timeout))
+}
+
+// withStepDeadline is clock.WithDeadline with the deadline suspended while
+// the stage is paused.
+func withStepDeadline(parent context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	p := &pausableCtx{Context: ctx, cancel: cancel, deadline: deadline}
+	stepDeadlines.mu.Lock()
+	stepDeadlines.set[p] = struct{}{}
+	p.mu.Lock()
+	if stepDeadlines.paused {
+		p.pausedAt = clk.Now()
+	} else {
+		p.start()
+	}
+	p.mu.Unlock()
+	stepDeadlines.mu.Unlock()
+	return p, func() {
+		stepDeadlines.mu.Lock()
+		delete(stepDeadlines.set, p)
+		stepDeadlines.mu.Unlock()
+		p.mu.Lock()
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// pausableCtx is a context canceled at its deadline, the deadline is
+// suspended while the stage is paused.
+type pausableCtx struct {
+	context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    clock.Timer // nil while the deadline is suspended
+	pausedAt time.Time
+	expired  bool
+}
+
+func (p *pausableCtx) start() {
+	p.timer = clk.AfterFunc(p.deadline.Sub(clk.Now()), func() {
+		p.mu.Lock()
+		p.expired = true
+		p.mu.Unlock()
+		p.cancel()
+	})
+}
+
+func (p *pausableCtx) pause(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// the timer already fired if it cannot be stopped
+	if p.timer != nil && p.timer.Stop() {
+		p.timer = nil
+		p.pausedAt = now
+	}
+}
+
+func (p *pausableCtx) resume(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil || p.pausedAt.IsZero() {
+		return
+	}
+	p.deadline = p.deadline.Add(now.Sub(p.pausedAt))
+	p.pausedAt = time.Time{}
+	p.start()
+}
+
+func (p *pausableCtx) Deadline() (time.Time, bool) {
+	p.mu.Lock()
+	deadline := p.deadline
+	p.mu.Unlock()
+	if parent, ok := p.Context.Deadline(); ok && parent.Before(deadline) {
+		return parent, true
+	}
+	return deadline, true
+}
+
+func (p *pausableCtx) Err() error {
+	err := p.Context.Err()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == context.Canceled && p.expired {
+		return context.DeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepDeadlinePaused(t *testing.T) {
+	fake := useFakeClock(t)
+	start := fake.Now()
+	ctx, cancel := withStepTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fake.Advance(4 * time.Second)
+	PauseDeadlines()
+	fake.Advance(time.Hour)
+	assert.NoError(t, ctx.Err())
+
+	// the deadline is extended by the pause
+	ResumeDeadlines()
+	deadline, _ := ctx.Deadline()
+	assert.Equal(t, start.Add(time.Hour+10*time.Second), deadline)
+	fake.Advance(5 * time.Second)
+	assert.NoError(t, ctx.Err())
+	fake.Advance(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestStepDeadlineStartedPaused(t *testing.T) {
+	fake := useFakeClock(t)
+	PauseDeadlines()
+	ctx, cancel := withStepTimeout(context.Background(), time.Second)
+	defer cancel()
+	fake.Advance(time.Minute)
+	assert.NoError(t, ctx.Err())
+
+	ResumeDeadlines()
+	fake.Advance(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
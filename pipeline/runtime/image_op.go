@@ -0,0 +1,67 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// executeImageOpStep copies, inspects or tags the source image of the step
+// with the registries of the stage. The digest and the media type of the
+// image, and its platforms once inspected, are set as the outputs.
+func executeImageOpStep(ctx context.Context, r *api.StartStepRequest, out io.Writer) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	log := logrus.New()
+	log.Out = out
+	cfg := &r.ImageOp
+
+	client, err := registry.New(pipeline.GetState().GetRegistries(), log)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	var img *registry.Image
+	switch cfg.Operation {
+	case api.ImageInspect:
+		if img, err = client.Inspect(ctx, cfg.Source); err == nil {
+			log.Infof("Inspected %s: %s %s", cfg.Source, img.Digest, strings.Join(img.Platforms, ", "))
+		}
+	case api.ImageTag:
+		if img, err = client.Tag(ctx, cfg.Source, cfg.Targets); err == nil {
+			log.Infof("Tagged %s with %s", cfg.Source, strings.Join(cfg.Targets, ", "))
+		}
+	default:
+		for _, target := range cfg.Targets {
+			if img, err = client.Copy(ctx, cfg.Source, target); err != nil {
+				err = fmt.Errorf("cannot copy %s to %s: %w", cfg.Source, target, err)
+				break
+			}
+			log.Infof("Copied %s to %s", cfg.Source, target)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+
+	outputs := map[string]string{"digest": img.Digest, "media_type": img.MediaType}
+	if cfg.Operation == api.ImageInspect {
+		outputs["platforms"] = strings.Join(img.Platforms, ",")
+	}
+	var outputsV2 []*api.OutputV2
+	for _, key := range []string{"digest", "media_type", "platforms"} {
+		if v, ok := outputs[key]; ok {
+			outputsV2 = append(outputsV2, &api.OutputV2{Key: key, Value: v, Type: api.OutputTypeString})
+		}
+	}
+	return &runtime.State{Exited: true}, outputs, nil, nil, outputsV2, "", nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/ti/testsplitter"
+)
+
+var (
+	logPrefixEnabled bool
+	logPrefixColor   bool
+)
+
+// SetLogPrefix configures the prefixing of the log lines of the steps
+// executed in drone mode with the step and shard identifiers, so that the
+// interleaved output of parallel steps is readable.
+func SetLogPrefix(enabled, color bool) {
+	logPrefixEnabled = enabled
+	logPrefixColor = color
+}
+
+// logPrefix returns the prefix of the log lines of the step, eg. [test 2/4]
+// for the second of four shards of the test step.
+func logPrefix(r *api.StartStepRequest) string {
+	name := r.Name
+	if name == "" {
+		name = r.ID
+	}
+	index, ierr := strconv.Atoi(r.Envs[testsplitter.CurrentIndexEnv])
+	total, terr := strconv.Atoi(r.Envs[testsplitter.NumSplitsEnv])
+	if ierr == nil && terr == nil && total > 1 {
+		name = fmt.Sprintf("%s %d/%d", name, index+1, total)
+	}
+	prefix := "[" + name + "]"
+	if logPrefixColor {
+		prefix = logstream.Colorize(prefix)
+	}
+	return prefix + " "
+}
+
+// prefixOutput returns the writer of the step output, prefixing the lines if enabled.
+func prefixOutput(r *api.StartStepRequest, w io.Writer) io.Writer {
+	if !logPrefixEnabled {
+		return w
+	}
+	return logstream.NewPrefixWriter(w, logPrefix(r))
+}
@@ -0,0 +1,28 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogPrefix(t *testing.T) {
+	defer SetLogPrefix(false, false)
+
+	r := &api.StartStepRequest{ID: "step1", Name: "test", Envs: map[string]string{"HARNESS_NODE_INDEX": "1", "HARNESS_NODE_TOTAL": "4"}}
+	buf := new(bytes.Buffer)
+	_, _ = prefixOutput(r, buf).Write([]byte("ok\n"))
+	assert.Equal(t, "ok\n", buf.String())
+
+	SetLogPrefix(true, false)
+	buf.Reset()
+	_, _ = prefixOutput(r, buf).Write([]byte("ok\n"))
+	assert.Equal(t, "[test 2/4] ok\n", buf.String())
+
+	assert.Equal(t, "[step1] ", logPrefix(&api.StartStepRequest{ID: "step1"}))
+
+	SetLogPrefix(true, true)
+	assert.Contains(t, logPrefix(r), "\u001b[")
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	osruntime "runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/instrumentation"
+	"github.com/harness/lite-engine/ti/report"
+	"github.com/harness/lite-engine/version"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reproManifestEnv     = "HARNESS_REPRO_MANIFEST"
+	reproManifestName    = "reproducibility-manifest.json"
+	reproManifestVersion = 1
+	reproManifestPerm    = 0600
+)
+
+// the tools whose version is detected in the steps, with the command
+// printing it.
+var detectedTools = [][2]string{
+	{"go", "go version"},
+	{"java", "java -version"},
+	{"node", "node --version"},
+	{"npm", "npm --version"},
+	{"python3", "python3 --version"},
+	{"ruby", "ruby --version"},
+	{"dotnet", "dotnet --version"},
+	{"mvn", "mvn --version"},
+	{"terraform", "terraform version"},
+	{"gcc", "gcc --version"},
+}
+
+// ImageInspector returns the repository digest of a local image.
+type ImageInspector interface {
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+var imageInspector ImageInspector
+
+// SetImageInspector sets the inspector pinning the images of the steps to
+// their digests in the reproducibility manifests.
+func SetImageInspector(i ImageInspector) {
+	imageInspector = i
+}
+
+// reproManifest records what a step execution depends on, so that a failing
+// run can be reproduced later on.
+type reproManifest struct {
+	Version         int               `json:"version"`
+	Step            string            `json:"step"`
+	Image           string            `json:"image,omitempty"`
+	ImageDigest     string            `json:"image_digest,omitempty"`
+	Platform        string            `json:"platform"`
+	EngineVersion   string            `json:"engine_version"`
+	EnvHash         string            `json:"env_hash"` // of the resolved environment, with the secrets redacted
+	EnvKeys         []string          `json:"env_keys"`
+	Tools           map[string]string `json:"tools,omitempty"`
+	Agents          map[string]string `json:"agents,omitempty"`
+	TISelectionHash string            `json:"ti_selection_hash,omitempty"`
+	ExitCode        int               `json:"exit_code"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+func reproManifestEnabled(envs map[string]string) bool {
+	return envs[reproManifestEnv] == trueValue
+}
+
+func getToolsFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-tools.env", pipeline.SharedVolPath, stepID)
+}
+
+func getReproManifestFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-%s", pipeline.SharedVolPath, stepID, reproManifestName)
+}
+
+// withReproManifest runs the step and attaches its reproducibility manifest
+// to the artifact of the step.
+func withReproManifest(ctx context.Context, f RunFunc, r *api.StartStepRequest, tiConfig *tiCfg.Cfg,
+	execute func(RunFunc) (*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error)) (
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	var envs map[string]string
+	exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err := execute(
+		func(ctx context.Context, step *spec.Step, output io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+			_ = os.Remove(getToolsFile(step.ID))
+			if shell := resolveShell("", step.Entrypoint); len(step.Entrypoint) != 0 && len(step.Command) != 0 &&
+				(shell == api.ShellSh || shell == api.ShellBash) {
+				step.Command = append([]string{getDetectToolsCmd(getToolsFile(step.ID)) + step.Command[0]}, step.Command[1:]...)
+			}
+			state, err := f(ctx, step, output, isDrone, isHosted)
+			envs = step.Envs // resolved by the engine
+			return state, err
+		})
+	if envs == nil { // the step did not run
+		return exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err
+	}
+
+	m := newReproManifest(ctx, r, envs, exited)
+	data, merr := json.MarshalIndent(m, "", "  ")
+	if merr != nil {
+		return exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err
+	}
+	if werr := os.WriteFile(getReproManifestFile(r.ID), data, reproManifestPerm); werr != nil {
+		logrus.WithContext(ctx).WithError(werr).WithField("step", r.Name).Warnln("failed to write the reproducibility manifest")
+	}
+	if artifact, merr = report.UploadArtifactFile(ctx, tiConfig, r.Name, reproManifestName, data, artifact); merr != nil {
+		logrus.WithContext(ctx).WithError(merr).WithField("step", r.Name).Warnln("failed to upload the reproducibility manifest")
+	}
+	return exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err
+}
+
+func newReproManifest(ctx context.Context, r *api.StartStepRequest, envs map[string]string, exited *runtime.State) *reproManifest {
+	m := &reproManifest{
+		Version:       reproManifestVersion,
+		Step:          r.Name,
+		Image:         r.Image,
+		Platform:      osruntime.GOOS + "/" + osruntime.GOARCH,
+		EngineVersion: version.Version,
+		Tools:         readDetectedTools(getToolsFile(r.ID)),
+		CreatedAt:     time.Now().UTC(),
+	}
+	m.EnvHash, m.EnvKeys = hashEnv(envs, append(append([]string{}, pipeline.GetState().GetSecrets()...), r.Secrets...))
+	if exited != nil {
+		m.ExitCode = exited.ExitCode
+	}
+	if r.Image != "" && imageInspector != nil {
+		digest, err := imageInspector.ImageDigest(ctx, r.Image)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("image", r.Image).Warnln("cannot inspect the image of the step")
+		}
+		m.ImageDigest = digest
+	}
+	if rec := instrumentation.ReadRecord(r.Name); rec != nil {
+		m.Agents = rec.Agents
+		m.TISelectionHash = rec.SelectionHash
+	}
+	return m
+}
+
+// hashEnv returns the hash of the environment and its sorted keys. The
+// secrets are redacted from the values before hashing.
+func hashEnv(envs map[string]string, secrets []string) (hash string, keys []string) {
+	keys = make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\x00", k, logstream.Redact(envs[k], secrets))
+	}
+	return hex.EncodeToString(h.Sum(nil)), keys
+}
+
+// getDetectToolsCmd returns the shell command writing the versions of the
+// tools installed in the step to file. It never fails the step.
+func getDetectToolsCmd(file string) string {
+	var sb strings.Builder
+	sb.WriteString("( ")
+	for _, t := range detectedTools {
+		fmt.Fprintf(&sb, "command -v %s >/dev/null 2>&1 && echo \"%s=$(%s 2>&1 | head -n 1)\" >> '%s'; ", t[0], t[0], t[1], file)
+	}
+	sb.WriteString(") 2>/dev/null || true\n")
+	return sb.String()
+}
+
+func readDetectedTools(file string) map[string]string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	tools := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), "="); ok {
+			tools[k] = strings.TrimSpace(v)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,41 @@
+package runtime
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashEnv(t *testing.T) {
+	hash, keys := hashEnv(map[string]string{"B": "2", "A": "token s3cr3t"}, []string{"s3cr3t"})
+	assert.Equal(t, []string{"A", "B"}, keys)
+
+	redacted, _ := hashEnv(map[string]string{"A": "token **************", "B": "2"}, nil)
+	other, _ := hashEnv(map[string]string{"A": "token s3cr3t", "B": "3"}, []string{"s3cr3t"})
+	assert.Equal(t, redacted, hash, "the secrets are redacted before hashing")
+	assert.NotEqual(t, hash, other)
+}
+
+func TestDetectTools(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	assert.NoError(t, os.Mkdir(bin, 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "go"), []byte("#!/bin/sh\necho go version go1.21.0 linux/amd64\n"), 0700)) //nolint:gosec
+	file := filepath.Join(dir, "tools.env")
+
+	cmd := exec.Command("sh", "-c", getDetectToolsCmd(file)+"exit 3")
+	cmd.Env = []string{"PATH=" + bin + ":/usr/bin:/bin"}
+	err := cmd.Run()
+	exitErr, ok := err.(*exec.ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, exitErr.ExitCode(), "the exit code of the step is kept")
+
+	tools := readDetectedTools(file)
+	assert.Equal(t, "go version go1.21.0 linux/amd64", tools["go"])
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultProbeInterval = time.Second
+	defaultProbeTimeout  = time.Minute
+	probeAttemptTimeout  = 5 * time.Second
+	defaultProbeHost     = "localhost"
+)
+
+// ContainerExecer runs commands in the running containers of the steps.
+type ContainerExecer interface {
+	Exec(ctx context.Context, stepID string, command []string, output io.Writer) (int, error)
+	// ContainerIP returns the address of the container of the step on the
+	// network of the stage, empty if it has none.
+	ContainerIP(ctx context.Context, stepID string) (string, error)
+	// Kill kills the container of the step.
+	Kill(ctx context.Context, stepID string) error
+}
+
+var containerExecer ContainerExecer
+
+// SetContainerExecer sets the engine running the readiness probes of the
+// container steps.
+func SetContainerExecer(e ContainerExecer) {
+	containerExecer = e
+}
+
+// waitReady probes the detached step until it is ready. It returns a
+// readiness error if the step is not ready once the probe timed out or if
+// the step exited before, once exited is closed.
+func waitReady(ctx context.Context, r *api.StartStepRequest, out io.Writer, exited <-chan struct{}) error {
+	p := r.Readiness
+	interval, timeout := defaultProbeInterval, defaultProbeTimeout
+	if p.Interval > 0 {
+		interval = time.Second * time.Duration(p.Interval)
+	}
+	if p.Timeout > 0 {
+		timeout = time.Second * time.Duration(p.Timeout)
+	}
+	log := logrus.New()
+	log.Out = out
+
+	ctx, cancel := clock.WithTimeout(ctx, clk, timeout)
+	defer cancel()
+	start := clk.Now()
+	for {
+		err := probe(ctx, r)
+		if err == nil {
+			log.Infof("The step is ready after %s", clk.Since(start).Round(time.Millisecond))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return withStage(api.StepErrorStageReadiness, false,
+				fmt.Errorf("step %s is not ready after %s: %w", r.ID, clk.Since(start).Round(time.Second), err))
+		case <-exited:
+			return withStage(api.StepErrorStageReadiness, false,
+				fmt.Errorf("step %s exited before it was ready: %w", r.ID, err))
+		case <-clk.After(interval):
+		}
+	}
+}
+
+// probe checks the readiness of the step once.
+func probe(ctx context.Context, r *api.StartStepRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, probeAttemptTimeout)
+	defer cancel()
+	p := r.Readiness
+	switch {
+	case p.TCP != nil:
+		host, err := probeHost(ctx, r, p.TCP.Host)
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(p.TCP.Port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case p.HTTP != nil:
+		host, err := probeHost(ctx, r, p.HTTP.Host)
+		if err != nil {
+			return err
+		}
+		return probeHTTP(ctx, p.HTTP, host)
+	default:
+		return probeCommand(ctx, r)
+	}
+}
+
+func probeHTTP(ctx context.Context, p *api.HTTPProbe, host string) error {
+	scheme := p.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(p.Port)), Path: p.Path}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s returned %s", u.String(), resp.Status)
+	}
+	return nil
+}
+
+// probeCommand runs the command in the container of the step, or on the
+// host for the host steps.
+func probeCommand(ctx context.Context, r *api.StartStepRequest) error {
+	command := r.Readiness.Command
+	var code int
+	if r.Image != "" {
+		if containerExecer == nil {
+			return errors.New("commands cannot be run in the containers of the steps")
+		}
+		var err error
+		if code, err = containerExecer.Exec(ctx, r.ID, command, io.Discard); err != nil {
+			return err
+		}
+	} else {
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec
+		cmd.Dir = r.WorkingDir
+		cmd.Env = os.Environ()
+		for k, v := range r.Envs {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) && err != nil {
+			return err
+		}
+		code = cmd.ProcessState.ExitCode()
+	}
+	if code != 0 {
+		return fmt.Errorf("the command exited with code %d", code)
+	}
+	return nil
+}
+
+// probeHost returns the host probed: the host of the probe if set, the
+// address of the container of a container step on the network of the stage,
+// the ports of the services are not published on the engine host, localhost
+// otherwise.
+func probeHost(ctx context.Context, r *api.StartStepRequest, host string) (string, error) {
+	if host != "" {
+		return host, nil
+	}
+	if r.Image != "" && containerExecer != nil {
+		ip, err := containerExecer.ContainerIP(ctx, r.ID)
+		if err != nil || ip != "" {
+			return ip, err
+		}
+	}
+	return defaultProbeHost, nil
+}
+
+// killNotReady kills the container of a container step which is not ready,
+// the process of a host step is stopped with the context of the step.
+func killNotReady(r *api.StartStepRequest) {
+	if r.Image == "" || containerExecer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeAttemptTimeout)
+	defer cancel()
+	if err := containerExecer.Kill(ctx, r.ID); err != nil {
+		logrus.WithError(err).WithField("step_id", r.ID).Warnln("failed to kill the step which is not ready")
+	}
+}
@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	r := &api.StartStepRequest{Readiness: &api.ReadinessProbe{TCP: &api.TCPProbe{Host: "127.0.0.1", Port: port}}}
+	assert.NoError(t, probe(ctx, r))
+	l.Close()
+	assert.Error(t, probe(ctx, r))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ = strconv.Atoi(u.Port())
+	r.Readiness = &api.ReadinessProbe{HTTP: &api.HTTPProbe{Host: u.Hostname(), Port: port, Path: "/ready"}}
+	assert.NoError(t, probe(ctx, r))
+	r.Readiness.HTTP.Path = "/"
+	assert.EqualError(t, probe(ctx, r), srv.URL+"/ returned 503 Service Unavailable")
+
+	r.Readiness = &api.ReadinessProbe{Command: []string{"sh", "-c", `test "$SERVICE" = up`}}
+	r.Envs = map[string]string{"SERVICE": "up"}
+	assert.NoError(t, probe(ctx, r))
+	r.Envs["SERVICE"] = "down"
+	assert.EqualError(t, probe(ctx, r), "the command exited with code 1")
+}
+
+func TestWaitReady(t *testing.T) {
+	r := &api.StartStepRequest{ID: "db", Readiness: &api.ReadinessProbe{Command: []string{"false"}, Timeout: 1}}
+	err := waitReady(context.Background(), r, io.Discard, nil)
+	var serr *stageError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, api.StepErrorStageReadiness, serr.stage)
+	assert.Contains(t, err.Error(), "step db is not ready after 1s")
+}
+
+func TestWaitReadyFakeClock(t *testing.T) {
+	fake := useFakeClock(t)
+	r := &api.StartStepRequest{ID: "db", Readiness: &api.ReadinessProbe{Command: []string{"false"}, Interval: 10, Timeout: 30}}
+	done := make(chan error)
+	go func() { done <- waitReady(context.Background(), r, io.Discard, nil) }()
+	// the probe timeout and the interval between the probes
+	for i := 0; i < 3; i++ {
+		fake.BlockUntil(2)
+		fake.Advance(10 * time.Second)
+	}
+	assert.Contains(t, (<-done).Error(), "step db is not ready after 30s")
+}
+
+func TestWaitReadyExited(t *testing.T) {
+	r := &api.StartStepRequest{ID: "db", Readiness: &api.ReadinessProbe{Command: []string{"false"}, Timeout: 60}}
+	exited := make(chan struct{})
+	close(exited)
+	err := waitReady(context.Background(), r, io.Discard, exited)
+	assert.ErrorContains(t, err, "step db exited before it was ready")
+}
+
+// fakeContainers is the engine of the container steps of the probes.
+type fakeContainers struct {
+	ip     string
+	killed []string
+}
+
+func (f *fakeContainers) Exec(context.Context, string, []string, io.Writer) (int, error) {
+	return 1, nil
+}
+
+func (f *fakeContainers) ContainerIP(context.Context, string) (string, error) {
+	return f.ip, nil
+}
+
+func (f *fakeContainers) Kill(_ context.Context, stepID string) error {
+	f.killed = append(f.killed, stepID)
+	return nil
+}
+
+func TestProbeContainerIP(t *testing.T) {
+	fake := &fakeContainers{ip: "127.0.0.1"}
+	SetContainerExecer(fake)
+	defer SetContainerExecer(nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// the port of the service container is not published on the host
+	r := &api.StartStepRequest{ID: "db", Image: "postgres", Readiness: &api.ReadinessProbe{TCP: &api.TCPProbe{Port: l.Addr().(*net.TCPAddr).Port}}}
+	host, err := probeHost(context.Background(), r, "")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+	assert.NoError(t, probe(context.Background(), r))
+
+	fake.ip = ""
+	host, err = probeHost(context.Background(), r, "")
+	require.NoError(t, err)
+	assert.Equal(t, defaultProbeHost, host)
+
+	killNotReady(r)
+	assert.Equal(t, []string{"db"}, fake.killed)
+	killNotReady(&api.StartStepRequest{ID: "host"})
+	assert.Equal(t, []string{"db"}, fake.killed)
+}
@@ -31,6 +31,13 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 	step := toStep(r)
 	step.Command = r.Run.Command
 	step.Entrypoint = r.Run.Entrypoint
+	shell := resolveShell(r.Run.Shell, r.Run.Entrypoint)
+	if len(r.Run.Sequence) > 0 {
+		step.Command = []string{getSequenceCmd(r.Run.Sequence, getSequenceStatusFile(step.ID))}
+	}
+	if (r.Run.Shell != "" || len(r.Run.Sequence) > 0) && len(step.Entrypoint) == 0 && len(step.Command) > 0 {
+		step.Entrypoint = shellEntrypoint(shell)
+	}
 	setTiEnvVariables(step, tiConfig)
 
 	optimizationState := types.DISABLED
@@ -61,9 +68,9 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 		step.Envs["DRONE_OUTPUT"] = outputFile
 
 		if len(r.Outputs) > 0 {
-			step.Command[0] += getOutputsCmd(step.Entrypoint, r.Outputs, outputFile)
+			step.Command[0] += getOutputsCmd(shell, r.Outputs, outputFile)
 		} else if len(r.OutputVars) > 0 {
-			step.Command[0] += getOutputVarCmd(step.Entrypoint, r.OutputVars, outputFile)
+			step.Command[0] += getOutputVarCmd(shell, r.OutputVars, outputFile)
 		}
 	}
 
@@ -94,18 +101,35 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 	// stageRuntimeID is only passed for dlite
 	isHosted := r.StageRuntimeID != ""
 
+	stopCheckpoint := startCheckpoint(ctx, r, log)
 	exited, err := f(ctx, step, out, r.LogDrone, isHosted)
+	stopCheckpoint(checkStepSuccess(exited, err))
 	timeTakenMs := time.Since(start).Milliseconds()
 
+	// the reports of a step run in a workspace clone are in the clone
+	workingDir := r.WorkingDir
+	if step.CloneWorkingDir != "" {
+		workingDir = step.CloneWorkingDir
+	}
+
 	reportStart := time.Now()
-	if rerr := report.ParseAndUploadTests(ctx, r.TestReport, r.WorkingDir, step.Name, log, reportStart, tiConfig, r.Envs); rerr != nil {
+	if rerr := report.ParseAndUploadTests(ctx, r.TestReport, workingDir, step.Name, step.ID, log, reportStart, tiConfig, r.Envs, r.Secrets); rerr != nil {
 		logrus.WithContext(ctx).WithError(rerr).WithField("step", step.Name).Errorln("failed to upload report")
 		log.Errorf("Failed to upload report. Time taken: %s", time.Since(reportStart))
+		recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, rerr))
+	}
+	if qerr := report.ParseAndUploadQuality(ctx, r.TestReport.Quality, workingDir, step.Name, step.ID, log, tiConfig); qerr != nil {
+		logrus.WithContext(ctx).WithError(qerr).WithField("step", step.Name).Errorln("failed to upload quality report")
+		recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, qerr))
+	}
+	if serr := report.CollectSarif(ctx, r.TestReport.Sarif, workingDir, step.ID, log, tiConfig); serr != nil {
+		logrus.WithContext(ctx).WithError(serr).WithField("step", step.Name).Errorln("failed to collect the SARIF files")
+		recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, serr))
 	}
 
 	// Parse and upload savings to TI
 	if tiConfig.GetParseSavings() {
-		optimizationState = savings.ParseAndUploadSavings(ctx, r.WorkingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs)
+		optimizationState = savings.ParseAndUploadSavings(ctx, workingDir, log, step.Name, checkStepSuccess(exited, err), timeTakenMs, tiConfig, r.Envs)
 	}
 
 	useCINewGodotEnvVersion := false
@@ -113,22 +137,31 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 		useCINewGodotEnvVersion = true
 	}
 
-	exportEnvs, _ := fetchExportedVarsFromEnvFile(exportEnvFile, out, useCINewGodotEnvVersion)
+	exportEnvs, _ := fetchConfinedVarsFromEnvFile(r, exportEnvFile, out, useCINewGodotEnvVersion)
 	artifact, _ := fetchArtifactDataFromArtifactFile(artifactFile, out)
+	artifact = report.AddAttachmentsToArtifact(step.ID, artifact)
+	artifact = report.AddSarifToArtifact(step.ID, artifact)
 	summaryOutputs := make(map[string]string)
 
 	if r.TestReport.Junit.Paths != nil && len(r.TestReport.Junit.Paths) > 0 {
-		reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, summaryOutputs, log, r.Envs)
+		reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, step.ID, summaryOutputs, log, r.Envs)
 
 		if reportSaveErr == nil && report.TestSummaryAsOutputEnabled(r.Envs) {
 			log.Infof("Test summary set as output variables")
 		}
 	}
+	if len(r.TestReport.Quality) > 0 {
+		report.SaveQualitySummaryToOutputs(step.ID, summaryOutputs)
+	}
+	if r.TestReport.Sarif != nil {
+		report.SaveSarifSummaryToOutputs(step.ID, summaryOutputs)
+	}
+	summaryOutputs = report.GetSummaryOutputs(summaryOutputs, r.Envs)
 	summaryOutputsV2 := report.GetSummaryOutputsV2(summaryOutputs, r.Envs)
 
 	if exited != nil && exited.Exited && exited.ExitCode == 0 {
-		outputs, err := fetchExportedVarsFromEnvFile(outputFile, out, useCINewGodotEnvVersion) //nolint:govet
-		if report.TestSummaryAsOutputEnabled(r.Envs) {
+		outputs, err := fetchConfinedVarsFromEnvFile(r, outputFile, out, useCINewGodotEnvVersion) //nolint:govet
+		if len(summaryOutputs) > 0 {
 			if outputs == nil {
 				outputs = make(map[string]string)
 			}
@@ -151,18 +184,14 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 					})
 				}
 			}
-			if report.TestSummaryAsOutputEnabled(r.Envs) {
-				outputsV2 = append(outputsV2, summaryOutputsV2...)
-			}
+			outputsV2 = append(outputsV2, summaryOutputsV2...)
 		} else {
 			if len(r.OutputVars) > 0 {
 				// only return err when output vars are expected
 				finalErr = err
 			}
-			if report.TestSummaryAsOutputEnabled(r.Envs) {
-				for k, v := range summaryOutputs {
-					outputs[k] = v
-				}
+			for k, v := range summaryOutputs {
+				outputs[k] = v
 			}
 			for key, value := range outputs {
 				output := &api.OutputV2{
@@ -176,7 +205,7 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 
 		// checking exported secrets from plugins if any
 		if _, err := os.Stat(outputSecretsFile); err == nil {
-			secrets, err := fetchExportedVarsFromEnvFile(outputSecretsFile, out, useCINewGodotEnvVersion)
+			secrets, err := fetchConfinedVarsFromEnvFile(r, outputSecretsFile, out, useCINewGodotEnvVersion)
 			if err != nil {
 				log.WithError(err).Errorln("error encountered while fetching output secrets from env File")
 			}
@@ -192,7 +221,7 @@ func executeRunStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out
 
 		return exited, outputs, exportEnvs, artifact, outputsV2, string(optimizationState), finalErr
 	}
-	if len(summaryOutputsV2) == 0 || !report.TestSummaryAsOutputEnabled(r.Envs) {
+	if len(summaryOutputsV2) == 0 {
 		return exited, nil, exportEnvs, artifact, nil, string(optimizationState), err
 	}
 	// even if the step failed, we still want to return the summary outputs
@@ -8,6 +8,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/drone/runner-go/pipeline/runtime"
@@ -16,6 +18,7 @@ import (
 	"github.com/harness/lite-engine/ti/callgraph"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 	"github.com/harness/lite-engine/ti/instrumentation"
+	"github.com/harness/lite-engine/ti/instrumentation/external"
 	"github.com/harness/lite-engine/ti/report"
 	"github.com/harness/lite-engine/ti/savings"
 	"github.com/harness/ti-client/types"
@@ -32,6 +35,64 @@ var (
 	collectTestReportsFn = report.ParseAndUploadTests
 )
 
+// writeTIDebugBundle writes the debug bundle of the test selection of the
+// step with its final command, if it is enabled. It is retained with the
+// reports of the step.
+func writeTIDebugBundle(ctx context.Context, r *api.StartStepRequest, command string, tiConfig *tiCfg.Cfg, log *logrus.Logger) {
+	instrumentation.CaptureDebug(ctx, func(b *instrumentation.DebugBundle) { b.Command = command })
+	secrets := append(append([]string{}, pipeline.GetState().GetSecrets()...), r.Secrets...)
+	path, err := instrumentation.WriteDebugBundle(ctx, tiConfig, secrets)
+	if err != nil {
+		log.WithError(err).Warnln("could not write the test intelligence debug bundle")
+	} else if path != "" {
+		log.Infoln(fmt.Sprintf("Test Intelligence debug bundle written to %s", path))
+	}
+}
+
+// containerRunnerExec returns the exec running the external test runner of
+// the container step in a container of the step image, the runner binary
+// of the image is not on the host. The request and the response are files
+// of the shared volume.
+func containerRunnerExec(f RunFunc, r *api.StartStepRequest) external.Exec {
+	calls := 0
+	return func(ctx context.Context, binary, workspace string, stdin []byte, stderr io.Writer) ([]byte, error) {
+		calls++
+		id := fmt.Sprintf("%s-ti-runner-%d", r.ID, calls)
+		reqFile := fmt.Sprintf("%s/%s-request.json", pipeline.SharedVolPath, id)
+		respFile := fmt.Sprintf("%s/%s-response.json", pipeline.SharedVolPath, id)
+		defer os.Remove(reqFile)
+		defer os.Remove(respFile)
+		// readable by the user of the container
+		if err := os.WriteFile(reqFile, stdin, 0644); err != nil { //nolint:gosec,gomnd
+			return nil, err
+		}
+
+		step := toStep(r)
+		step.ID = id
+		step.Name = id
+		step.Detach = false
+		step.PortBindings = nil
+		step.WarmContainer = ""
+		step.WorkspaceClone = false
+		step.WorkingDir = workspace
+		step.Entrypoint = []string{"sh", "-c"}
+		step.Command = []string{fmt.Sprintf("%s < %s > %s", shellQuote(binary), reqFile, respFile)}
+		state, err := f(ctx, step, stderr, false, false)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil && state.ExitCode != 0 {
+			return nil, fmt.Errorf("exit code %d", state.ExitCode)
+		}
+		return os.ReadFile(respFile)
+	}
+}
+
+// shellQuote quotes s for a posix shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func executeRunTestStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) ( //nolint:gocritic,gocyclo
 	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
 	log := &logrus.Logger{
@@ -44,8 +105,17 @@ func executeRunTestStep(ctx context.Context, f RunFunc, r *api.StartStepRequest,
 
 	start := time.Now()
 	optimizationState := types.DISABLED
-	cmd, err := instrumentation.GetCmd(ctx, &r.RunTest, r.Name, r.WorkingDir, log, r.Envs, tiConfig)
+	setTestDeadline(r, start)
+	if r.RunTest.DebugBundle {
+		ctx = instrumentation.EnableDebugBundle(ctx, r.ID)
+	}
+	var runnerExec external.Exec
+	if r.Image != "" {
+		runnerExec = containerRunnerExec(f, r)
+	}
+	cmd, err := instrumentation.GetCmd(ctx, &r.RunTest, r.Name, r.WorkingDir, log, r.Envs, runnerExec, tiConfig)
 	if err != nil {
+		writeTIDebugBundle(ctx, r, "", tiConfig, log)
 		return nil, nil, nil, nil, nil, string(optimizationState), err
 	}
 
@@ -64,20 +134,21 @@ func executeRunTestStep(ctx context.Context, f RunFunc, r *api.StartStepRequest,
 
 	outputFile := fmt.Sprintf("%s/%s-output.env", pipeline.SharedVolPath, step.ID)
 	if len(r.Outputs) > 0 {
-		step.Command[0] += getOutputsCmd(step.Entrypoint, r.Outputs, outputFile)
+		step.Command[0] += getOutputsCmd(resolveShell("", step.Entrypoint), r.Outputs, outputFile)
 	} else if len(r.OutputVars) > 0 {
-		step.Command[0] += getOutputVarCmd(step.Entrypoint, r.OutputVars, outputFile)
+		step.Command[0] += getOutputVarCmd(resolveShell("", step.Entrypoint), r.OutputVars, outputFile)
 	}
 
 	artifactFile := fmt.Sprintf("%s/%s-artifact", pipeline.SharedVolPath, step.ID)
 	step.Envs["PLUGIN_ARTIFACT_FILE"] = artifactFile
 
+	writeTIDebugBundle(ctx, r, step.Command[0], tiConfig, log)
 	exited, err := f(ctx, step, out, false, false)
 	timeTakenMs := time.Since(start).Milliseconds()
-	collectionErr := collectRunTestData(ctx, log, r, start, step.Name, tiConfig)
+	collectionErr := postProcessingError(ctx, collectRunTestData(ctx, log, r, start, step.Name, tiConfig))
 	if err == nil {
 		// Fail the step if run was successful but error during collection
-		err = collectionErr
+		err = withStage(api.StepErrorStageCgUpload, true, collectionErr)
 	}
 
 	// Parse and upload savings to TI
@@ -89,15 +160,16 @@ func executeRunTestStep(ctx context.Context, f RunFunc, r *api.StartStepRequest,
 	if val, ok := step.Envs[ciNewVersionGodotEnv]; ok && val == trueValue {
 		useCINewGodotEnvVersion = true
 	}
-	exportEnvs, _ := fetchExportedVarsFromEnvFile(exportEnvFile, out, useCINewGodotEnvVersion)
+	exportEnvs, _ := fetchConfinedVarsFromEnvFile(r, exportEnvFile, out, useCINewGodotEnvVersion)
 	artifact, _ := fetchArtifactDataFromArtifactFile(artifactFile, out)
+	artifact = report.AddAttachmentsToArtifact(step.ID, artifact)
 
-	outputs, fetchErr := fetchExportedVarsFromEnvFile(outputFile, out, useCINewGodotEnvVersion) //nolint:govet
+	outputs, fetchErr := fetchConfinedVarsFromEnvFile(r, outputFile, out, useCINewGodotEnvVersion) //nolint:govet
 	if outputs == nil {
 		outputs = make(map[string]string)
 	}
 	summaryOutputs := make(map[string]string)
-	reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, summaryOutputs, log, r.Envs)
+	reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, step.ID, summaryOutputs, log, r.Envs)
 	if reportSaveErr != nil {
 		log.Warnf("Error while saving report summary to outputs %s", reportSaveErr.Error())
 	}
@@ -163,9 +235,10 @@ func collectRunTestData(ctx context.Context, log *logrus.Logger, r *api.StartSte
 	}
 
 	reportStart := time.Now()
-	crErr := collectTestReportsFn(ctx, r.TestReport, r.WorkingDir, stepName, log, reportStart, tiConfig, r.Envs)
+	crErr := collectTestReportsFn(ctx, r.TestReport, r.WorkingDir, stepName, r.ID, log, reportStart, tiConfig, r.Envs, r.Secrets)
 	if crErr != nil {
 		log.WithField("error", crErr).Errorln(fmt.Sprintf("Failed to upload report. Time taken: %s", time.Since(reportStart)))
+		recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, crErr))
 	}
 	return cgErr
 }
@@ -1,12 +1,20 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/drone/runner-go/pipeline/runtime"
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -58,7 +66,7 @@ func Test_CollectRunTestData(t *testing.T) {
 			collectCgFn = func(ctx context.Context, stepID string, timeMs int64, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, dir string) error {
 				return tc.cgErr
 			}
-			collectTestReportsFn = func(ctx context.Context, report api.TestReport, workDir, stepID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string) error {
+			collectTestReportsFn = func(ctx context.Context, report api.TestReport, workDir, stepID, annotationID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string, secrets []string) error {
 				return tc.crErr
 			}
 			err := collectRunTestData(ctx, log, &apiReq, time.Now(), stepName, &tiConfig)
@@ -66,3 +74,78 @@ func Test_CollectRunTestData(t *testing.T) {
 		})
 	}
 }
+
+func TestContainerRunnerExec(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	var steps []*spec.Step
+	// answers the request as the runner in the step container would
+	f := func(ctx context.Context, step *spec.Step, out io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+		steps = append(steps, step)
+		args := strings.Fields(step.Command[0]) // 'binary' < request > response
+		req, err := os.ReadFile(args[2])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprint(out, "runner log")
+		return &runtime.State{Exited: true}, os.WriteFile(args[4], append([]byte("response to "), req...), 0600)
+	}
+	r := &api.StartStepRequest{ID: "step", Name: "test", Image: "lua", WorkingDir: "/harness", PortBindings: map[string]string{"80": "80"}}
+
+	var stderr bytes.Buffer
+	out, err := containerRunnerExec(f, r)(context.Background(), "./runner", "/harness", []byte("request"), &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "response to request", string(out))
+	assert.Equal(t, "runner log", stderr.String())
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "step-ti-runner-1", steps[0].ID)
+	assert.Equal(t, "lua", steps[0].Image)
+	assert.Equal(t, []string{"sh", "-c"}, steps[0].Entrypoint)
+	assert.Equal(t, "'./runner' <", steps[0].Command[0][:12])
+	assert.Nil(t, steps[0].PortBindings)
+	assert.NoFileExists(t, pipeline.SharedVolPath+"/step-ti-runner-1-request.json")
+	assert.NoFileExists(t, pipeline.SharedVolPath+"/step-ti-runner-1-response.json")
+}
+
+func TestRunTestsPostProcessingOverrun(t *testing.T) {
+	fake := useFakeClock(t)
+	oldCollectCgFn := collectCgFn
+	defer func() { collectCgFn = oldCollectCgFn }()
+	oldCollectTestReportsFn := collectTestReportsFn
+	defer func() { collectTestReportsFn = oldCollectTestReportsFn }()
+
+	uploading := make(chan struct{})
+	collectCgFn = func(ctx context.Context, stepID string, timeMs int64, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, dir string) error {
+		close(uploading)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	collectTestReportsFn = func(ctx context.Context, report api.TestReport, workDir, stepID, annotationID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string, secrets []string) error {
+		return nil
+	}
+	f := func(context.Context, *spec.Step, io.Writer, bool, bool) (*runtime.State, error) {
+		return &runtime.State{Exited: true}, nil
+	}
+	r := &api.StartStepRequest{ID: "runtests-overrun", Kind: api.RunTest, Envs: map[string]string{}, WorkingDir: t.TempDir(),
+		Timeout: 600, PostProcessingTimeout: 60,
+		RunTest: api.RunTestConfig{Language: "python", BuildTool: "pytest", Args: "test"}}
+	tiConfig := tiCfg.New("app.harness.io", "", "", "", "", "",
+		"", "", "", "", "", "", "", "",
+		"", false, false)
+
+	errs := &stepErrors{}
+	done := make(chan error)
+	go func() {
+		_, _, _, _, _, _, err := executeStepHelper(withStepErrors(context.Background(), errs), r, f, logstream.NopWriter(), &tiConfig)
+		done <- err
+	}()
+	<-uploading
+	fake.Advance(time.Minute)
+
+	// the upload canceled by the post-processing budget does not fail the step
+	assert.NoError(t, <-done)
+	if assert.Len(t, errs.list(), 1) {
+		assert.Equal(t, api.StepErrorStagePostProcessing, errs.list()[0].Stage)
+	}
+}
@@ -6,6 +6,7 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/drone/runner-go/pipeline/runtime"
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/fileperm"
 	"github.com/harness/lite-engine/internal/filesystem"
 	"github.com/harness/lite-engine/pipeline"
 	tiCfg "github.com/harness/lite-engine/ti/config"
@@ -25,6 +27,7 @@ import (
 	"github.com/harness/lite-engine/ti/instrumentation/python"
 	"github.com/harness/lite-engine/ti/instrumentation/ruby"
 	"github.com/harness/lite-engine/ti/report"
+	"github.com/harness/lite-engine/ti/report/parser/junit"
 	"github.com/harness/lite-engine/ti/savings"
 	filter "github.com/harness/lite-engine/ti/testsfilteration"
 	"github.com/harness/ti-client/types"
@@ -36,8 +39,9 @@ const (
 	javaAgentV2Arg          = "-javaagent:%s=%s"
 	javaAgentV2Jar          = "java-agent.jar"
 	javaAgentV2Path         = "/java/v2/"
-	filterV2Dir             = "%s/ti/v2/filter"
-	configV2Dir             = "%s/ti/v2/java/config"
+	filterV2Dir             = "%s/ti/v2/filter"      // the filter files of the engines without attempt directories
+	configV2Dir             = "%s/ti/v2/java/config" // the java config files of the engines without attempt directories
+	attemptsV2Dir           = "%s/ti/v2/attempts/split_%d"
 	waitTimeoutInSec        = 30
 	agentV2LinkLength       = 3
 	dotNetAgentLinkIndex    = 3
@@ -46,7 +50,7 @@ const (
 	dotNetAgentV2LibWin     = "net-agent.dll"
 	dotNetAgentV2Zip        = "dotnet-agent.zip"
 	dotNetAgentV2Path       = "/dotnet/v2/"
-	dotNetConfigV2Dir       = "%s/ti/v2/dotnet/config"
+	dotNetConfigV2Dir       = "%s/ti/v2/dotnet/config" // the dotnet config files of the engines without attempt directories
 )
 
 //nolint:gocritic,gocyclo
@@ -56,12 +60,17 @@ func executeRunTestsV2Step(ctx context.Context, f RunFunc, r *api.StartStepReque
 	log := logrus.New()
 	log.Out = out
 	optimizationState := types.DISABLED
+	setTestDeadline(r, start)
 	step := toStep(r)
 	setTiEnvVariables(step, tiConfig)
 	step.Entrypoint = r.RunTestsV2.Entrypoint
 
-	preCmd, err := SetupRunTestV2(ctx, &r.RunTestsV2, step.Name, r.WorkingDir, log, r.Envs, tiConfig)
+	if r.RunTestsV2.DebugBundle {
+		ctx = instrumentation.EnableDebugBundle(ctx, r.ID)
+	}
+	preCmd, err := SetupRunTestV2(ctx, &r.RunTestsV2, step.Name, r.ID, r.WorkingDir, log, r.Envs, tiConfig)
 	if err != nil {
+		writeTIDebugBundle(ctx, r, "", tiConfig, log)
 		return nil, nil, nil, nil, nil, string(optimizationState), err
 	}
 	command := r.RunTestsV2.Command[0]
@@ -81,9 +90,9 @@ func executeRunTestsV2Step(ctx context.Context, f RunFunc, r *api.StartStepReque
 	step.Envs["DRONE_OUTPUT"] = outputFile
 
 	if len(r.Outputs) > 0 {
-		step.Command[0] += getOutputsCmd(step.Entrypoint, r.Outputs, outputFile)
+		step.Command[0] += getOutputsCmd(resolveShell("", step.Entrypoint), r.Outputs, outputFile)
 	} else if len(r.OutputVars) > 0 {
-		step.Command[0] += getOutputVarCmd(step.Entrypoint, r.OutputVars, outputFile)
+		step.Command[0] += getOutputVarCmd(resolveShell("", step.Entrypoint), r.OutputVars, outputFile)
 	}
 
 	artifactFile := fmt.Sprintf("%s/%s-artifact", pipeline.SharedVolPath, step.ID)
@@ -93,11 +102,12 @@ func executeRunTestsV2Step(ctx context.Context, f RunFunc, r *api.StartStepReque
 		step.Envs["PLUGIN_METADATA_FILE"] = fmt.Sprintf("%s/%s-%s", pipeline.SharedVolPath, step.ID, metadataFile)
 	}
 
+	writeTIDebugBundle(ctx, r, step.Command[0], tiConfig, log)
 	exited, err := f(ctx, step, out, r.LogDrone, false)
 	timeTakenMs := time.Since(start).Milliseconds()
-	collectionErr := collectTestReportsAndCg(ctx, log, r, start, step.Name, tiConfig)
+	collectionErr := postProcessingError(ctx, collectTestReportsAndCg(ctx, log, r, start, step.Name, tiConfig))
 	if err == nil {
-		err = collectionErr
+		err = withStage(api.StepErrorStageCgUpload, true, collectionErr)
 	}
 
 	if tiConfig.GetParseSavings() {
@@ -109,17 +119,18 @@ func executeRunTestsV2Step(ctx context.Context, f RunFunc, r *api.StartStepReque
 		useCINewGodotEnvVersion = true
 	}
 
-	exportEnvs, _ := fetchExportedVarsFromEnvFile(exportEnvFile, out, useCINewGodotEnvVersion)
+	exportEnvs, _ := fetchConfinedVarsFromEnvFile(r, exportEnvFile, out, useCINewGodotEnvVersion)
 	artifact, _ := fetchArtifactDataFromArtifactFile(artifactFile, out)
+	artifact = report.AddAttachmentsToArtifact(step.ID, artifact)
 
 	summaryOutputs := make(map[string]string)
-	reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, summaryOutputs, log, r.Envs)
+	reportSaveErr := report.SaveReportSummaryToOutputs(ctx, tiConfig, step.Name, step.ID, summaryOutputs, log, r.Envs)
 	if reportSaveErr != nil {
 		log.Errorf("Error while saving report summary to outputs %s", reportSaveErr.Error())
 	}
 	summaryOutputsV2 := report.GetSummaryOutputsV2(summaryOutputs, r.Envs)
 	if exited != nil && exited.Exited && exited.ExitCode == 0 {
-		outputs, err := fetchExportedVarsFromEnvFile(outputFile, out, useCINewGodotEnvVersion) //nolint:govet
+		outputs, err := fetchConfinedVarsFromEnvFile(r, outputFile, out, useCINewGodotEnvVersion) //nolint:govet
 		if report.TestSummaryAsOutputEnabled(r.Envs) {
 			if outputs == nil {
 				outputs = make(map[string]string)
@@ -162,7 +173,10 @@ func executeRunTestsV2Step(ctx context.Context, f RunFunc, r *api.StartStepReque
 	return exited, nil, exportEnvs, artifact, nil, string(optimizationState), err
 }
 
-func SetupRunTestV2(ctx context.Context, config *api.RunTestsV2Config, stepID, workspace string, log *logrus.Logger, envs map[string]string, tiConfig *tiCfg.Cfg) (string, error) {
+// SetupRunTestV2 installs the agents and writes the filter and config files of
+// the attempt of the step, identified by attemptID.
+func SetupRunTestV2(ctx context.Context, config *api.RunTestsV2Config, stepID, attemptID, workspace string, log *logrus.Logger,
+	envs map[string]string, tiConfig *tiCfg.Cfg) (string, error) {
 	agentPaths := make(map[string]string)
 	fs := filesystem.New()
 	tmpFilePath := tiConfig.GetDataDir()
@@ -181,6 +195,11 @@ func SetupRunTestV2(ctx context.Context, config *api.RunTestsV2Config, stepID, w
 		if len(links) < agentV2LinkLength {
 			return preCmd, fmt.Errorf("error: Could not get agent V2 links from TI")
 		}
+		agents := map[string]string{"java": links[0].URL, "python": links[1].URL, "ruby": links[2].URL}
+		if len(links) > dotNetAgentLinkIndex {
+			agents["dotnet"] = links[dotNetAgentLinkIndex].URL
+		}
+		instrumentation.RecordAgents(stepID, agents)
 
 		err = downloadJavaAgent(ctx, tmpFilePath, links[0].URL, fs, log)
 		if err != nil {
@@ -208,8 +227,9 @@ func SetupRunTestV2(ctx context.Context, config *api.RunTestsV2Config, stepID, w
 				log.Warningln(".net agent installation failed. Continuing without .net support.")
 			}
 		}
-		isPsh := IsPowershell(config.Entrypoint)
-		preCmd, filterfilePath, err = getPreCmd(workspace, tmpFilePath, fs, log, envs, agentPaths, isPsh, tiConfig)
+		isPsh := isPowershell(resolveShell("", config.Entrypoint))
+		packages := packageFilter{include: config.InstrPackages, exclude: config.ExcludePackages}
+		preCmd, filterfilePath, err = getPreCmd(workspace, tmpFilePath, attemptID, fs, log, envs, agentPaths, isPsh, tiConfig, packages)
 		if err != nil || pythonArtifactDir == "" {
 			return preCmd, fmt.Errorf("failed to set config file or env variable to inject agent, %s", err)
 		}
@@ -217,6 +237,7 @@ func SetupRunTestV2(ctx context.Context, config *api.RunTestsV2Config, stepID, w
 		if err != nil {
 			return preCmd, fmt.Errorf("error while creating filter file %s", err)
 		}
+		instrumentation.CaptureDebugFile(ctx, filterfilePath)
 	}
 	return preCmd, nil
 }
@@ -260,6 +281,7 @@ func getTestsSelection(ctx context.Context, fs filesystem.FileSystem, stepID, wo
 			return selection, false // TI selected all the tests to be run
 		}
 	}
+	instrumentation.CaptureDebug(ctx, func(b *instrumentation.DebugBundle) { b.ChangedFiles = files })
 	filesWithpkg := java.ReadPkgs(log, fs, workspace, files)
 	testGlobs := sanitizeTestGlobsV2(runV2Config.TestGlobs)
 	selection, err = instrumentation.SelectTests(ctx, workspace, filesWithpkg, runOnlySelectedTests, stepID, testGlobs, fs, tiConfig)
@@ -284,7 +306,7 @@ func getTestsSelection(ctx context.Context, fs filesystem.FileSystem, stepID, wo
 
 func createOutDir(tmpDir string, fs filesystem.FileSystem, log *logrus.Logger) (string, error) {
 	outDir := fmt.Sprintf(outDir, tmpDir)
-	err := fs.MkdirAll(outDir, os.ModePerm)
+	err := fs.MkdirAll(outDir, fileperm.Mode(os.ModePerm))
 	if err != nil {
 		log.WithError(err).Errorln(fmt.Sprintf("could not create nested Output directory %s", outDir))
 		return "", err
@@ -292,31 +314,81 @@ func createOutDir(tmpDir string, fs filesystem.FileSystem, log *logrus.Logger) (
 	return outDir, nil
 }
 
-func getFilterFilePath(tmpDir string, splitIdx int) string {
-	filterFileDir := fmt.Sprintf(filterV2Dir, tmpDir)
+// prepareAttemptDir returns the directory of the filter and config files of
+// the attempt of the step for the split index, eg.
+// /tmp/engine/ti/v2/attempts/split_1/<attempt id>. The files of the previous
+// attempts for the split index are removed, so that a retried shard does
+// not pick up the stale selection of a previous attempt.
+func prepareAttemptDir(tmpDir, attemptID string, splitIdx int, fs filesystem.FileSystem, log *logrus.Logger) (string, error) {
+	splitDir := fmt.Sprintf(attemptsV2Dir, tmpDir, splitIdx)
+	if err := os.RemoveAll(splitDir); err != nil {
+		log.WithError(err).Warnln(fmt.Sprintf("could not remove the files of the previous attempts in %s", splitDir))
+	}
+	for _, stale := range []string{
+		fmt.Sprintf("%s/filter_%d", fmt.Sprintf(filterV2Dir, tmpDir), splitIdx),
+		fmt.Sprintf("%s/config_%d.ini", fmt.Sprintf(configV2Dir, tmpDir), splitIdx),
+		fmt.Sprintf("%s/config_%d.json", fmt.Sprintf(dotNetConfigV2Dir, tmpDir), splitIdx),
+	} {
+		if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).Warnln(fmt.Sprintf("could not remove the stale file %s", stale))
+		}
+	}
+	dir := filepath.Join(splitDir, attemptDirName(attemptID))
+	if err := fs.MkdirAll(dir, fileperm.Mode(os.ModePerm)); err != nil {
+		log.WithError(err).Errorln(fmt.Sprintf("could not create the attempt directory %s", dir))
+		return "", err
+	}
+	return dir, nil
+}
 
-	// filterfilePath will look like /tmp/engine/ti/v2/filter/filter_1...
-	filterfilePath := fmt.Sprintf("%s/filter_%d", filterFileDir, splitIdx)
+// attemptDirName returns the attempt id usable as a directory name.
+func attemptDirName(attemptID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, attemptID)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "default"
+	}
+	return name
+}
 
-	return filterfilePath
+func getFilterFilePath(dir string, splitIdx int) string {
+	// filterfilePath will look like /tmp/engine/ti/v2/attempts/split_1/<attempt id>/filter_1
+	return fmt.Sprintf("%s/filter_%d", dir, splitIdx)
 }
 
-func createJavaConfigFile(tmpDir string, fs filesystem.FileSystem, log *logrus.Logger, filterfilePath, outDir string, splitIdx int) (string, error) {
-	iniFileDir := fmt.Sprintf(configV2Dir, tmpDir)
-	err := fs.MkdirAll(iniFileDir, os.ModePerm)
+// packageFilter is the allow and deny lists of the packages instrumented by
+// the java and .net agents. The agents infer the packages from the sources
+// if the allow list is empty.
+type packageFilter struct {
+	include []string
+	exclude []string
+}
+
+func createJavaConfigFile(dir string, fs filesystem.FileSystem, log *logrus.Logger, filterfilePath, outDir string, splitIdx int, packages packageFilter) (string, error) {
+	err := fs.MkdirAll(dir, fileperm.Mode(os.ModePerm))
 	if err != nil {
-		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", iniFileDir))
+		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", dir))
 		return "", err
 	}
 	// create file paths with splitidx for splitting
-	iniFile := fmt.Sprintf("%s/config_%d.ini", iniFileDir, splitIdx)
+	iniFile := fmt.Sprintf("%s/config_%d.ini", dir, splitIdx)
 
 	data := fmt.Sprintf(`outDir: %s
 	logLevel: 0
 	logConsole: false
 	writeTo: JSON
-	packageInference: true
-	filterFile: %s`, outDir, filterfilePath)
+	packageInference: %t
+	filterFile: %s`, outDir, len(packages.include) == 0, filterfilePath)
+	if len(packages.include) > 0 {
+		data += fmt.Sprintf("\n\tinstrPackages: %s", strings.Join(packages.include, ","))
+	}
+	if len(packages.exclude) > 0 {
+		data += fmt.Sprintf("\n\texcludePackages: %s", strings.Join(packages.exclude, ","))
+	}
 
 	log.Infof("Writing to %s with config:\n%s", iniFile, data)
 	f, err := fs.Create(iniFile)
@@ -335,15 +407,14 @@ func createJavaConfigFile(tmpDir string, fs filesystem.FileSystem, log *logrus.L
 	return iniFile, nil // path of config.ini file
 }
 
-func createDotNetConfigFile(tmpDir string, fs filesystem.FileSystem, log *logrus.Logger, filterfilePath, outDir string, splitIdx int) (string, error) {
-	jsonFileDir := fmt.Sprintf(dotNetConfigV2Dir, tmpDir)
-	err := fs.MkdirAll(jsonFileDir, os.ModePerm)
+func createDotNetConfigFile(dir string, fs filesystem.FileSystem, log *logrus.Logger, filterfilePath, outDir string, splitIdx int, packages packageFilter) (string, error) {
+	err := fs.MkdirAll(dir, fileperm.Mode(os.ModePerm))
 	if err != nil {
-		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", jsonFileDir))
+		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", dir))
 		return "", err
 	}
 	// create file paths with splitidx for splitting
-	jsonFile := fmt.Sprintf("%s/config_%d.json", jsonFileDir, splitIdx)
+	jsonFile := fmt.Sprintf("%s/config_%d.json", dir, splitIdx)
 
 	data := fmt.Sprintf(`{
 		"logging":{
@@ -352,8 +423,8 @@ func createDotNetConfigFile(tmpDir string, fs filesystem.FileSystem, log *logrus
 			"file": "%s/log"
 		},
 		"outdir": "%s",
-		"filterFile": "%s"
-	}`, outDir, outDir, filterfilePath)
+		"filterFile": "%s"%s
+	}`, outDir, outDir, filterfilePath, packages.dotNetConfig())
 
 	log.Infof("Writing to %s with config:\n%s", jsonFile, data)
 	f, err := fs.Create(jsonFile)
@@ -372,10 +443,27 @@ func createDotNetConfigFile(tmpDir string, fs filesystem.FileSystem, log *logrus
 	return jsonFile, nil // path of config.json file
 }
 
+// dotNetConfig returns the entries of the lists for the config of the .net
+// agent, the namespaces being the packages.
+func (p packageFilter) dotNetConfig() string {
+	var out string
+	for _, l := range []struct {
+		key  string
+		list []string
+	}{{"instrPackages", p.include}, {"excludePackages", p.exclude}} {
+		if len(l.list) == 0 {
+			continue
+		}
+		data, _ := json.Marshal(l.list)
+		out += fmt.Sprintf(",\n\t\t%q: %s", l.key, data)
+	}
+	return out
+}
+
 // Here we are setting up env var to invoke agant along with creating config file and .bazelrc file
 //
 //nolint:funlen,gocyclo,lll
-func getPreCmd(workspace, tmpFilePath string, fs filesystem.FileSystem, log *logrus.Logger, envs, agentPaths map[string]string, isPsh bool, tiConfig *tiCfg.Cfg) (preCmd, filterFilePath string, err error) {
+func getPreCmd(workspace, tmpFilePath, attemptID string, fs filesystem.FileSystem, log *logrus.Logger, envs, agentPaths map[string]string, isPsh bool, tiConfig *tiCfg.Cfg, packages packageFilter) (preCmd, filterFilePath string, err error) {
 	splitIdx := 0
 	if instrumentation.IsParallelismEnabled(envs) {
 		log.Infoln("Initializing settings for test splitting and parallelism")
@@ -388,7 +476,11 @@ func getPreCmd(workspace, tmpFilePath string, fs filesystem.FileSystem, log *log
 		return "", "", err
 	}
 
-	filterFilePath = getFilterFilePath(tmpFilePath, splitIdx)
+	attemptDir, err := prepareAttemptDir(tmpFilePath, attemptID, splitIdx, fs, log)
+	if err != nil {
+		return "", "", err
+	}
+	filterFilePath = getFilterFilePath(attemptDir, splitIdx)
 
 	envs["TI"] = "1"
 	envs["TI_V2"] = "1"
@@ -396,7 +488,7 @@ func getPreCmd(workspace, tmpFilePath string, fs filesystem.FileSystem, log *log
 	envs["TI_FILTER_FILE_PATH"] = filterFilePath
 
 	// Java
-	iniFilePath, err := createJavaConfigFile(tmpFilePath, fs, log, filterFilePath, outDir, splitIdx)
+	iniFilePath, err := createJavaConfigFile(attemptDir, fs, log, filterFilePath, outDir, splitIdx, packages)
 	if err != nil {
 		log.WithError(err).Errorln(fmt.Sprintf("could not create java agent config file in path %s", iniFilePath))
 		return "", "", err
@@ -491,7 +583,7 @@ func getPreCmd(workspace, tmpFilePath string, fs filesystem.FileSystem, log *log
 
 	// .Net
 	if _, exists := agentPaths["dotnet"]; exists {
-		dotNetJSONFilePath, err := createDotNetConfigFile(tmpFilePath, fs, log, filterFilePath, outDir, splitIdx)
+		dotNetJSONFilePath, err := createDotNetConfigFile(attemptDir, fs, log, filterFilePath, outDir, splitIdx, packages)
 		if err != nil {
 			log.WithError(err).Errorln(fmt.Sprintf("could not create dotnet agent config file in path %s", dotNetJSONFilePath))
 			return "", "", err
@@ -578,6 +670,8 @@ func createSelectedTestFile(ctx context.Context, fs filesystem.FileSystem, stepI
 	tiConfig *tiCfg.Cfg, tmpFilepath string, envs map[string]string, runV2Config *api.RunTestsV2Config, filterFilePath string) error {
 	isManualExecution := instrumentation.IsManualExecution(tiConfig)
 	resp, isFilterFilePresent := getTestsSelection(ctx, fs, stepID, workspace, log, isManualExecution, tiConfig, envs, runV2Config)
+	instrumentation.RecordSelection(ctx, stepID, &resp)
+	instrumentation.CompareSelection(tiConfig, stepID, &resp, log)
 	if tiConfig.GetParseSavings() {
 		if isFilterFilePresent {
 			// TI selected subset of tests
@@ -590,7 +684,7 @@ func createSelectedTestFile(ctx context.Context, fs filesystem.FileSystem, stepI
 
 	filterFileDir := fmt.Sprintf(filterV2Dir, tmpFilepath)
 
-	err := fs.MkdirAll(filterFileDir, os.ModePerm)
+	err := fs.MkdirAll(filterFileDir, fileperm.Mode(os.ModePerm))
 	if err != nil {
 		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", filterFileDir))
 		return err
@@ -656,14 +750,22 @@ func collectTestReportsAndCg(ctx context.Context, log *logrus.Logger, r *api.Sta
 	}
 
 	if len(r.TestReport.Junit.Paths) == 0 {
-		// If there are no paths specified, set Paths[0] to include all XML files and all TRX files
-		r.TestReport.Junit.Paths = []string{"**/*.xml", "**/*.trx"}
+		// If there are no paths specified, use the default paths of the language
+		// and skip the XML files which are known not to be test reports
+		paths, ok := junit.DefaultPaths(r.TestReport.Junit.Language)
+		if !ok {
+			log.Warnln(fmt.Sprintf("no default test report paths for language %q, collecting all the XML and TRX files", r.TestReport.Junit.Language))
+			paths, _ = junit.DefaultPaths(junit.PresetAll)
+		}
+		r.TestReport.Junit.Paths = paths
+		r.TestReport.Junit.Ignore = append(r.TestReport.Junit.Ignore, junit.DefaultIgnores...)
 	}
 
 	reportStart := time.Now()
-	crErr := collectTestReportsFn(ctx, r.TestReport, r.WorkingDir, stepName, log, reportStart, tiConfig, r.Envs)
+	crErr := collectTestReportsFn(ctx, r.TestReport, r.WorkingDir, stepName, r.ID, log, reportStart, tiConfig, r.Envs, r.Secrets)
 	if crErr != nil {
 		log.WithField("error", crErr).Errorln(fmt.Sprintf("Failed to upload report. Time taken: %s", time.Since(reportStart)))
+		recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, crErr))
 	}
 	return cgErr
 }
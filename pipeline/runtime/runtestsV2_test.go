@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
@@ -62,7 +63,7 @@ func Test_CollectRunTestsV2Data(t *testing.T) {
 			collectCgFn = func(ctx context.Context, stepID string, timeMs int64, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, dir string) error {
 				return tc.cgErr
 			}
-			collectTestReportsFn = func(ctx context.Context, report api.TestReport, workDir, stepID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string) error {
+			collectTestReportsFn = func(ctx context.Context, report api.TestReport, workDir, stepID, annotationID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string, secrets []string) error {
 				return tc.crErr
 			}
 			err := collectTestReportsAndCg(ctx, log, &apiReq, time.Now(), stepName, &tiConfig)
@@ -137,6 +138,7 @@ func Test_getPreCmd(t *testing.T) {
 	type args struct {
 		workspace   string
 		tmpFilePath string
+		attemptID   string
 		fs          filesystem.FileSystem
 		tiConfig    *tiCfg.Cfg
 		log         *logrus.Logger
@@ -154,7 +156,7 @@ func Test_getPreCmd(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := getPreCmd(tt.args.workspace, tt.args.tmpFilePath, tt.args.fs, tt.args.log, tt.args.envs, tt.args.agentPaths, false, tt.args.tiConfig)
+			got, got1, err := getPreCmd(tt.args.workspace, tt.args.tmpFilePath, tt.args.attemptID, tt.args.fs, tt.args.log, tt.args.envs, tt.args.agentPaths, false, tt.args.tiConfig, packageFilter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getPreCmd() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -189,7 +191,7 @@ func Test_createJavaConfigFile(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := createJavaConfigFile(tt.args.tmpDir, tt.args.fs, tt.args.log, tt.args.filterFilePath, tt.args.outDir, tt.args.splitIdx)
+			got, err := createJavaConfigFile(tt.args.tmpDir, tt.args.fs, tt.args.log, tt.args.filterFilePath, tt.args.outDir, tt.args.splitIdx, packageFilter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("createJavaConfigFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -201,6 +203,65 @@ func Test_createJavaConfigFile(t *testing.T) {
 	}
 }
 
+func Test_createConfigFilesPackages(t *testing.T) {
+	fs := filesystem.New()
+	log := logrus.New()
+	dir := t.TempDir()
+
+	// the packages are inferred without an allow list
+	ini, err := createJavaConfigFile(dir, fs, log, "/filter_0", "/out", 0, packageFilter{})
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(ini)
+	assert.Contains(t, string(data), "packageInference: true")
+	assert.NotContains(t, string(data), "instrPackages")
+
+	packages := packageFilter{include: []string{"com.acme.billing", "com.acme.ledger"}, exclude: []string{"com.acme.billing.generated"}}
+	ini, err = createJavaConfigFile(dir, fs, log, "/filter_0", "/out", 0, packages)
+	assert.NoError(t, err)
+	data, _ = os.ReadFile(ini)
+	assert.Contains(t, string(data), "packageInference: false")
+	assert.Contains(t, string(data), "instrPackages: com.acme.billing,com.acme.ledger")
+	assert.Contains(t, string(data), "excludePackages: com.acme.billing.generated")
+
+	jsonFile, err := createDotNetConfigFile(dir, fs, log, "/filter_0", "/out", 0, packages)
+	assert.NoError(t, err)
+	data, _ = os.ReadFile(jsonFile)
+	var cfg struct {
+		OutDir          string   `json:"outdir"`
+		InstrPackages   []string `json:"instrPackages"`
+		ExcludePackages []string `json:"excludePackages"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &cfg))
+	assert.Equal(t, "/out", cfg.OutDir)
+	assert.Equal(t, packages.include, cfg.InstrPackages)
+	assert.Equal(t, packages.exclude, cfg.ExcludePackages)
+}
+
+func Test_prepareAttemptDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := filesystem.New()
+	log := logrus.New()
+
+	previous, err := prepareAttemptDir(tmpDir, "step-1", 2, fs, log)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(getFilterFilePath(previous, 2), []byte("pkg.Test"), 0o600))
+
+	other, err := prepareAttemptDir(tmpDir, "step-1", 3, fs, log)
+	assert.NoError(t, err)
+
+	legacy := fmt.Sprintf(filterV2Dir, tmpDir)
+	assert.NoError(t, os.MkdirAll(legacy, os.ModePerm))
+	assert.NoError(t, os.WriteFile(legacy+"/filter_2", []byte("pkg.Test"), 0o600))
+
+	current, err := prepareAttemptDir(tmpDir, "step/1:retry", 2, fs, log)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(attemptsV2Dir, tmpDir, 2)+"/step_1_retry", current)
+	assert.DirExists(t, current)
+	assert.NoDirExists(t, previous)
+	assert.NoFileExists(t, legacy+"/filter_2")
+	assert.DirExists(t, other)
+}
+
 func Test_getTestsSelection(t *testing.T) {
 	type args struct {
 		ctx         context.Context
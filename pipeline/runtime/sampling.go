@@ -0,0 +1,100 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/harness/lite-engine/api"
+)
+
+// telemetrySampling decides which steps of the stage set up return their
+// telemetry.
+type telemetrySampling struct {
+	mu      sync.Mutex
+	percent float64
+	salt    uint64 // varies the sampled steps between the stages
+}
+
+const maxPercent = 100
+
+var currentSampling = &telemetrySampling{percent: maxPercent}
+
+// SetTelemetrySampling sets the sampling of the telemetry of the stage set
+// up for its account and pipeline, all the steps are sampled if s is nil.
+func SetTelemetrySampling(s *api.TelemetrySampling, accountID, pipelineID string) {
+	percent := float64(maxPercent)
+	if s != nil {
+		if s.Percent != nil {
+			percent = *s.Percent
+		}
+		if p, ok := s.Accounts[accountID]; ok && accountID != "" {
+			percent = p
+		}
+		if p, ok := s.Pipelines[pipelineID]; ok && pipelineID != "" {
+			percent = p
+		}
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	currentSampling.mu.Lock()
+	defer currentSampling.mu.Unlock()
+	currentSampling.percent, currentSampling.salt = percent, binary.LittleEndian.Uint64(b[:])
+}
+
+// ValidateTelemetrySampling returns the issues of the sampling of the
+// telemetry of a stage.
+func ValidateTelemetrySampling(s *api.TelemetrySampling) []string {
+	if s == nil {
+		return nil
+	}
+	var issues []string
+	check := func(name string, p float64) {
+		if p < 0 || p > maxPercent {
+			issues = append(issues, fmt.Sprintf("the percentage of %s must be between 0 and 100", name))
+		}
+	}
+	if s.Percent != nil {
+		check("the default", *s.Percent)
+	}
+	for _, id := range sortedKeys(s.Accounts) {
+		check(fmt.Sprintf("the account %s", id), s.Accounts[id])
+	}
+	for _, id := range sortedKeys(s.Pipelines) {
+		check(fmt.Sprintf("the pipeline %s", id), s.Pipelines[id])
+	}
+	return issues
+}
+
+// sample returns whether the step returns its telemetry. The decision is
+// the same for all the polls of the step.
+func (s *telemetrySampling) sample(id string, failed bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case failed || s.percent >= maxPercent:
+		return true
+	case s.percent <= 0:
+		return false
+	}
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, s.salt)
+	_, _ = h.Write([]byte(id))
+	return float64(h.Sum64()%(maxPercent*maxPercent)) < s.percent*maxPercent
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,50 @@
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelemetrySampling(t *testing.T) {
+	t.Cleanup(func() { SetTelemetrySampling(nil, "", "") })
+	percent := func(p float64) *float64 { return &p }
+
+	// all the steps are sampled by default
+	SetTelemetrySampling(nil, "acct", "pipe")
+	assert.True(t, currentSampling.sample("step", false))
+
+	// the pipeline takes precedence over the account and the default
+	cfg := &api.TelemetrySampling{Percent: percent(50), Accounts: map[string]float64{"acct": 100},
+		Pipelines: map[string]float64{"pipe": 0}}
+	SetTelemetrySampling(cfg, "acct", "pipe")
+	assert.False(t, currentSampling.sample("step", false))
+	assert.True(t, currentSampling.sample("step", true), "the failed steps are always sampled")
+	SetTelemetrySampling(cfg, "acct", "other")
+	assert.True(t, currentSampling.sample("step", false))
+
+	// the decision is stable for a step, about the percentage of the steps
+	SetTelemetrySampling(cfg, "other", "other")
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("step-%d", i)
+		s := currentSampling.sample(id, false)
+		assert.Equal(t, s, currentSampling.sample(id, false))
+		if s {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 500, sampled, 100)
+}
+
+func TestValidateTelemetrySampling(t *testing.T) {
+	p := float64(-1)
+	assert.Nil(t, ValidateTelemetrySampling(nil))
+	assert.Equal(t, []string{
+		"the percentage of the default must be between 0 and 100",
+		"the percentage of the pipeline b must be between 0 and 100",
+	}, ValidateTelemetrySampling(&api.TelemetrySampling{Percent: &p, Accounts: map[string]float64{"a": 100},
+		Pipelines: map[string]float64{"b": 101}}))
+}
@@ -0,0 +1,36 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/envelope"
+	"github.com/sirupsen/logrus"
+)
+
+// sealSecretOutputs encrypts the values of the secret outputs of the step
+// with the key, nothing is done if the key is not set. The secret values are
+// removed from the plain output variables. A value which cannot be
+// encrypted is not returned.
+func sealSecretOutputs(status *StepStatus, key []byte) {
+	if key == nil {
+		return
+	}
+	for _, o := range status.OutputV2 {
+		if o.Type != api.OutputTypeSecret || o.Encrypted {
+			continue
+		}
+		if v, ok := status.Outputs[o.Key]; ok && v == o.Value {
+			delete(status.Outputs, o.Key)
+		}
+		sealed, err := envelope.Seal(key, o.Key, o.Value)
+		if err != nil {
+			logrus.WithError(err).WithField("key", o.Key).Errorln("failed to encrypt the secret output, dropping its value")
+			o.Value = ""
+			continue
+		}
+		o.Value, o.Encrypted = sealed, true
+	}
+}
@@ -0,0 +1,40 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealSecretOutputs(t *testing.T) {
+	key := make([]byte, envelope.KeySize)
+	status := StepStatus{
+		Outputs: map[string]string{"token": "s3cr3t", "name": "build"},
+		OutputV2: []*api.OutputV2{
+			{Key: "token", Value: "s3cr3t", Type: api.OutputTypeSecret},
+			{Key: "name", Value: "build", Type: api.OutputTypeString},
+		},
+	}
+	sealSecretOutputs(&status, key)
+
+	assert.Equal(t, map[string]string{"name": "build"}, status.Outputs)
+	assert.True(t, status.OutputV2[0].Encrypted)
+	value, err := envelope.Open(key, "token", status.OutputV2[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+	assert.Equal(t, &api.OutputV2{Key: "name", Value: "build", Type: api.OutputTypeString}, status.OutputV2[1])
+}
+
+func TestSealSecretOutputs_NoKey(t *testing.T) {
+	status := StepStatus{
+		Outputs:  map[string]string{"token": "s3cr3t"},
+		OutputV2: []*api.OutputV2{{Key: "token", Value: "s3cr3t", Type: api.OutputTypeSecret}},
+	}
+	sealSecretOutputs(&status, nil)
+	assert.Equal(t, "s3cr3t", status.Outputs["token"])
+	assert.Equal(t, "s3cr3t", status.OutputV2[0].Value)
+	assert.False(t, status.OutputV2[0].Encrypted)
+}
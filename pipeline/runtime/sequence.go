@@ -0,0 +1,101 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+)
+
+const (
+	sequenceStatusFields = 4
+	msPerSecond          = 1000
+
+	// sequenceNowFunc prints the unix time in milliseconds, or in seconds
+	// followed by 000 where date does not support %N, eg. busybox or BSD.
+	sequenceNowFunc = `__harness_now() {
+  __harness_t=$(date +%s%3N)
+  case "$__harness_t" in
+    *[!0-9]*) echo "$(date +%s)000" ;;
+    *) echo "$__harness_t" ;;
+  esac
+}
+`
+)
+
+func getSequenceStatusFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-commands.status", pipeline.SharedVolPath, stepID)
+}
+
+// getSequenceCmd returns a script which executes each command of the sequence
+// in its own subshell and appends "<index> <exit code> <start> <end>" to the
+// status file once the command finishes, with the times in milliseconds. A
+// failing command stops the sequence unless it is marked to continue on error.
+func getSequenceCmd(sequence []*api.RunCommand, statusFile string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "__harness_status='%s'\n", statusFile)
+	sb.WriteString(": > \"$__harness_status\"\n")
+	sb.WriteString(sequenceNowFunc)
+	for i, c := range sequence {
+		sb.WriteString("__harness_start=$(__harness_now)\n")
+		fmt.Fprintf(&sb, "(\n%s\n)\n", c.Command)
+		sb.WriteString("__harness_rc=$?\n")
+		fmt.Fprintf(&sb, "echo \"%d $__harness_rc $__harness_start $(__harness_now)\" >> \"$__harness_status\"\n", i)
+		if !c.ContinueOnError {
+			sb.WriteString("if [ $__harness_rc -ne 0 ]; then exit $__harness_rc; fi\n")
+		}
+	}
+	return sb.String()
+}
+
+// fetchSequenceStatus reads the status file written by the sequence script
+// and removes it. Commands which have no entry in the file were never
+// executed.
+func fetchSequenceStatus(sequence []*api.RunCommand, statusFile string) []*api.CommandStatus {
+	if len(sequence) == 0 {
+		return nil
+	}
+
+	status := make([]*api.CommandStatus, len(sequence))
+	for i, c := range sequence {
+		status[i] = &api.CommandStatus{Index: i, Command: c.Command, Skipped: true}
+	}
+
+	f, err := os.Open(statusFile)
+	if err != nil {
+		return status
+	}
+	defer os.Remove(statusFile)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var idx, exitCode int
+		var start, end int64
+		n, _ := fmt.Sscanf(scanner.Text(), "%d %d %d %d", &idx, &exitCode, &start, &end)
+		if n != sequenceStatusFields || idx < 0 || idx >= len(status) {
+			continue
+		}
+		status[idx].Skipped = false
+		status[idx].ExitCode = exitCode
+		status[idx].StartedAt = start / msPerSecond
+		status[idx].DurationMs = end - start
+	}
+	return status
+}
+
+// getCommandStatus returns the per command status for a step executing a
+// sequence of commands, or nil otherwise.
+func getCommandStatus(r *api.StartStepRequest) []*api.CommandStatus {
+	if r.Kind != api.Run || len(r.Run.Sequence) == 0 {
+		return nil
+	}
+	return fetchSequenceStatus(r.Run.Sequence, getSequenceStatusFile(r.ID))
+}
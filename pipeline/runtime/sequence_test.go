@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	tests := []struct {
+		Name     string
+		Sequence []*api.RunCommand
+		ExitCode int
+		Status   []int // exit code of each command, -1 if skipped
+	}{
+		{
+			Name:     "all_succeed",
+			Sequence: []*api.RunCommand{{Command: "echo one"}, {Command: "echo two"}},
+			Status:   []int{0, 0},
+		},
+		{
+			Name:     "failure_stops_sequence",
+			Sequence: []*api.RunCommand{{Command: "exit 3"}, {Command: "echo two"}},
+			ExitCode: 3,
+			Status:   []int{3, -1},
+		},
+		{
+			Name:     "continue_on_error",
+			Sequence: []*api.RunCommand{{Command: "false", ContinueOnError: true}, {Command: "echo two"}},
+			Status:   []int{1, 0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			statusFile := filepath.Join(t.TempDir(), "status")
+			cmd := exec.Command("sh", "-c", getSequenceCmd(tc.Sequence, statusFile))
+			err := cmd.Run()
+			if tc.ExitCode == 0 {
+				assert.Nil(t, err)
+			} else if exitErr, ok := err.(*exec.ExitError); assert.True(t, ok) {
+				assert.Equal(t, tc.ExitCode, exitErr.ExitCode())
+			}
+
+			status := fetchSequenceStatus(tc.Sequence, statusFile)
+			assert.NoFileExists(t, statusFile)
+			assert.Len(t, status, len(tc.Status))
+			for i, want := range tc.Status {
+				assert.Equal(t, tc.Sequence[i].Command, status[i].Command)
+				if want == -1 {
+					assert.True(t, status[i].Skipped)
+					continue
+				}
+				assert.False(t, status[i].Skipped)
+				assert.Equal(t, want, status[i].ExitCode)
+			}
+		})
+	}
+}
+
+func TestSequenceCmdDuration(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	sequence := []*api.RunCommand{{Command: "sleep 0.3"}}
+	statusFile := filepath.Join(t.TempDir(), "status")
+	before := time.Now().Unix()
+	assert.Nil(t, exec.Command("sh", "-c", getSequenceCmd(sequence, statusFile)).Run())
+
+	status := fetchSequenceStatus(sequence, statusFile)
+	assert.Len(t, status, 1)
+	assert.InDelta(t, before, status[0].StartedAt, 1)
+	assert.GreaterOrEqual(t, status[0].DurationMs, int64(250))
+	assert.Less(t, status[0].DurationMs, int64(5000))
+}
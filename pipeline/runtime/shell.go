@@ -0,0 +1,87 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+)
+
+// resolveShell returns the shell used to execute the step commands. An explicitly
+// configured shell takes precedence, otherwise it is inferred from the entrypoint.
+func resolveShell(shell api.Shell, entrypoint []string) api.Shell {
+	if shell != "" {
+		return shell
+	}
+	if len(entrypoint) == 0 {
+		return api.ShellSh
+	}
+
+	// entrypoint can be a full path on windows eg. C:\Windows\System32\cmd.exe
+	bin := strings.ToLower(entrypoint[0])
+	if i := strings.LastIndexAny(bin, `/\`); i >= 0 {
+		bin = bin[i+1:]
+	}
+	bin = strings.TrimSuffix(bin, filepath.Ext(bin))
+
+	switch bin {
+	case "pwsh":
+		return api.ShellPwsh
+	case "powershell":
+		return api.ShellPowershell
+	case "cmd":
+		return api.ShellCmd
+	case "python", "python3":
+		return api.ShellPython
+	case "bash":
+		return api.ShellBash
+	default:
+		return api.ShellSh
+	}
+}
+
+// shellEntrypoint returns the entrypoint which wraps the step commands
+// for the given shell.
+func shellEntrypoint(shell api.Shell) []string {
+	switch shell {
+	case api.ShellBash:
+		return []string{"bash", "-c"}
+	case api.ShellPwsh:
+		return []string{"pwsh", "-Command"}
+	case api.ShellPowershell:
+		return []string{"powershell", "-Command"}
+	case api.ShellCmd:
+		return []string{"cmd", "/S", "/C"}
+	case api.ShellPython:
+		return []string{"python3", "-c"}
+	default:
+		return []string{"sh", "-c"}
+	}
+}
+
+func isPowershell(shell api.Shell) bool {
+	return shell == api.ShellPwsh || shell == api.ShellPowershell
+}
+
+// withUmask sets the umask of the step in its command, for the sh and bash
+// steps only. The umask is formatted from its parsed value, never copied
+// from the request into the script.
+func withUmask(f RunFunc, umask os.FileMode) RunFunc {
+	return func(ctx context.Context, step *spec.Step, output io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+		if shell := resolveShell("", step.Entrypoint); len(step.Entrypoint) != 0 && len(step.Command) != 0 &&
+			(shell == api.ShellSh || shell == api.ShellBash) {
+			step.Command = append([]string{fmt.Sprintf("umask %04o\n", umask.Perm()) + step.Command[0]}, step.Command[1:]...)
+		}
+		return f(ctx, step, output, isDrone, isHosted)
+	}
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestResolveShell(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Shell      api.Shell
+		Entrypoint []string
+		Want       api.Shell
+	}{
+		{Name: "explicit_shell", Shell: api.ShellBash, Entrypoint: []string{"pwsh", "-Command"}, Want: api.ShellBash},
+		{Name: "empty_entrypoint", Want: api.ShellSh},
+		{Name: "sh", Entrypoint: []string{"sh", "-c"}, Want: api.ShellSh},
+		{Name: "bash_full_path", Entrypoint: []string{"/bin/bash", "-c"}, Want: api.ShellBash},
+		{Name: "pwsh", Entrypoint: []string{"pwsh", "-Command"}, Want: api.ShellPwsh},
+		{Name: "powershell_exe", Entrypoint: []string{`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`}, Want: api.ShellPowershell},
+		{Name: "cmd", Entrypoint: []string{"cmd.exe", "/C"}, Want: api.ShellCmd},
+		{Name: "python3", Entrypoint: []string{"python3", "-c"}, Want: api.ShellPython},
+		{Name: "unknown", Entrypoint: []string{"/docker-entrypoint.sh"}, Want: api.ShellSh},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, resolveShell(tc.Shell, tc.Entrypoint))
+		})
+	}
+}
+
+func TestGetOutputsCmd(t *testing.T) {
+	outputs := []*api.OutputV2{{Key: "foo", Value: "FOO"}}
+	tests := []struct {
+		Name  string
+		Shell api.Shell
+		Want  string
+	}{
+		{
+			Name:  "sh",
+			Shell: api.ShellSh,
+			Want:  "\necho \"foo='${FOO}'\" >> /tmp/out.env",
+		},
+		{
+			Name:  "pwsh",
+			Shell: api.ShellPwsh,
+			Want:  "\nNew-Item /tmp/out.env\n$val = \"foo=$Env:FOO\" \nAdd-Content -Path /tmp/out.env -Value $val",
+		},
+		{
+			Name:  "python",
+			Shell: api.ShellPython,
+			Want:  "\nimport os\nwith open(r'/tmp/out.env', 'a') as out_file:\n\tout_file.write('foo=' + os.getenv('FOO', '') + '\\n')\n",
+		},
+		{
+			Name:  "cmd",
+			Shell: api.ShellCmd,
+			Want:  " & echo foo=%FOO%>>\"/tmp/out.env\"",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, getOutputsCmd(tc.Shell, outputs, "/tmp/out.env"))
+		})
+	}
+}
+
+func TestWithUmask(t *testing.T) {
+	var got []string
+	f := withUmask(func(ctx context.Context, step *spec.Step, output io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+		got = step.Command
+		return nil, nil
+	}, 0o027)
+
+	_, _ = f(context.Background(), &spec.Step{Entrypoint: []string{"sh", "-c"}, Command: []string{"touch a"}}, io.Discard, false, false)
+	assert.Equal(t, []string{"umask 0027\ntouch a"}, got)
+
+	_, _ = f(context.Background(), &spec.Step{Entrypoint: []string{"pwsh", "-Command"}, Command: []string{"New-Item a"}}, io.Discard, false, false)
+	assert.Equal(t, []string{"New-Item a"}, got)
+}
+
+func TestWithCharset(t *testing.T) {
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("ビルド成功\n"))
+	require.NoError(t, err)
+	f := func(_ context.Context, _ *spec.Step, output io.Writer, _, _ bool) (*runtime.State, error) {
+		// the engines write the output in chunks of any size
+		_, _ = output.Write(sjis[:3])
+		_, _ = output.Write(sjis[3:])
+		return &runtime.State{Exited: true}, nil
+	}
+	var out bytes.Buffer
+	_, err = withCharset(f, japanese.ShiftJIS)(context.Background(), &spec.Step{}, &out, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, "ビルド成功\n", out.String())
+}
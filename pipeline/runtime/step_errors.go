@@ -0,0 +1,82 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/harness/lite-engine/api"
+)
+
+// stageError is an error annotated with the part of the step execution
+// it occurred in.
+type stageError struct {
+	stage     api.StepErrorStage
+	retryable bool
+	err       error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+func withStage(stage api.StepErrorStage, retryable bool, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{stage: stage, retryable: retryable, err: err}
+}
+
+// stepErrors records the errors of a step execution, including the ones
+// which do not fail the step.
+type stepErrors struct {
+	mu   sync.Mutex
+	errs []*api.StepError
+}
+
+type stepErrorsKey struct{}
+
+func withStepErrors(ctx context.Context, errs *stepErrors) context.Context {
+	return context.WithValue(ctx, stepErrorsKey{}, errs)
+}
+
+func stepErrorsFromContext(ctx context.Context) *stepErrors {
+	errs, _ := ctx.Value(stepErrorsKey{}).(*stepErrors)
+	return errs
+}
+
+// recordStepError records err under its stage. Errors which are not stage
+// errors are attributed to the run stage.
+func recordStepError(ctx context.Context, err error) {
+	errs := stepErrorsFromContext(ctx)
+	if errs == nil || err == nil {
+		return
+	}
+
+	errs.mu.Lock()
+	errs.errs = append(errs.errs, newStepError(err))
+	errs.mu.Unlock()
+}
+
+// newStepError returns the api error of err, under the run stage if err is
+// not a stage error.
+func newStepError(err error) *api.StepError {
+	stepErr := &api.StepError{Stage: api.StepErrorStageRun, Message: err.Error()}
+	var serr *stageError
+	if errors.As(err, &serr) {
+		stepErr.Stage, stepErr.Retryable = serr.stage, serr.retryable
+	}
+	return stepErr
+}
+
+func (s *stepErrors) list() []*api.StepError {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*api.StepError(nil), s.errs...)
+}
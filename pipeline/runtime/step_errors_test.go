@@ -0,0 +1,85 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/logstream"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepErrors(t *testing.T) {
+	errs := &stepErrors{}
+	ctx := withStepErrors(context.Background(), errs)
+
+	recordStepError(ctx, errors.New("engine error"))
+	recordStepError(ctx, withStage(api.StepErrorStageReportUpload, true, errors.New("report upload failed")))
+	recordStepError(ctx, withStage(api.StepErrorStageCgUpload, true, nil))
+	recordStepError(context.Background(), errors.New("not recorded"))
+
+	status := StepStatus{
+		State:   &runtime.State{Exited: true, ExitCode: 2},
+		StepErr: errors.New("engine error"),
+		Errors:  errs.list(),
+	}
+	assert.Equal(t, []*api.StepError{
+		{Stage: api.StepErrorStageRun, Message: "engine error"},
+		{Stage: api.StepErrorStageReportUpload, Message: "report upload failed", Retryable: true},
+		{Stage: api.StepErrorStageRun, Message: "exit status 2"},
+	}, convertStatus(status).Errors)
+
+	status = StepStatus{StepErr: errors.New("context deadline exceeded")}
+	assert.Equal(t, []*api.StepError{
+		{Stage: api.StepErrorStageRun, Message: "context deadline exceeded"},
+	}, convertStatus(status).Errors)
+
+	// the error failing the step comes first, even if it was not recorded
+	status = StepStatus{
+		StepErr: withStage(api.StepErrorStagePostProcessing, false, errors.New("post processing failed")),
+		Errors:  []*api.StepError{{Stage: api.StepErrorStageReportUpload, Message: "report upload failed", Retryable: true}},
+	}
+	assert.Equal(t, []*api.StepError{
+		{Stage: api.StepErrorStagePostProcessing, Message: "post processing failed"},
+		{Stage: api.StepErrorStageReportUpload, Message: "report upload failed", Retryable: true},
+	}, convertStatus(status).Errors)
+
+	// a recorded step error is moved first
+	status = StepStatus{
+		StepErr: errors.New("engine error"),
+		Errors: []*api.StepError{
+			{Stage: api.StepErrorStageReportUpload, Message: "report upload failed", Retryable: true},
+			{Stage: api.StepErrorStageLogClose, Message: "engine error"},
+		},
+	}
+	assert.Equal(t, []*api.StepError{
+		{Stage: api.StepErrorStageLogClose, Message: "engine error"},
+		{Stage: api.StepErrorStageReportUpload, Message: "report upload failed", Retryable: true},
+	}, convertStatus(status).Errors)
+}
+
+func TestExecuteStepHelperErrors(t *testing.T) {
+	errs := &stepErrors{}
+	ctx := withStepErrors(context.Background(), errs)
+	r := &api.StartStepRequest{ID: "step-errors", Kind: api.Run, Envs: map[string]string{},
+		Run: api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh}}
+	f := func(context.Context, *spec.Step, io.Writer, bool, bool) (*runtime.State, error) {
+		return nil, errors.New("boom")
+	}
+
+	tiConfig := tiCfg.New("app.harness.io", "", "", "", "", "",
+		"", "", "", "", "", "", "", "",
+		"", false, false)
+
+	state, _, _, _, _, _, err := executeStepHelper(ctx, r, f, logstream.NopWriter(), &tiConfig)
+	assert.Error(t, err)
+	status := StepStatus{State: state, StepErr: err, Errors: errs.list()}
+	assert.Equal(t, []*api.StepError{
+		{Stage: api.StepErrorStageRun, Message: "boom"},
+	}, convertStatus(status).Errors)
+}
@@ -5,21 +5,31 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/engine"
+	"github.com/harness/lite-engine/engine/lifecycle"
 	"github.com/harness/lite-engine/engine/spec"
 	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/internal/charset"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/retry"
 	"github.com/harness/lite-engine/livelog"
 	"github.com/harness/lite-engine/logstream"
 	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/ti"
 	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/instrumentation"
 	"github.com/harness/lite-engine/ti/report"
 
 	"github.com/drone/runner-go/pipeline/runtime"
@@ -43,6 +53,12 @@ type StepStatus struct {
 	Artifact          []byte
 	OutputV2          []*api.OutputV2
 	OptimizationState string
+	CommandStatus     []*api.CommandStatus
+	Errors            []*api.StepError
+	Annotations       []*api.Annotation
+	Telemetry         *api.TelemetryData
+	Restored          *api.PollStepResponse // the response of a step completed before the engine restarted
+	LogKey            string                // the log key claimed by the step
 }
 
 const (
@@ -51,14 +67,38 @@ const (
 	Complete
 	defaultStepTimeout = 10 * time.Hour // default step timeout
 	stepStatusUpdate   = "DLITE_CI_VM_EXECUTE_TASK_V2"
+
+	sendStatusAttempts      = 3
+	sendStatusRetryInterval = 10 * time.Second
+	drainPollInterval       = 100 * time.Millisecond
 )
 
+var errDraining = &errors.UnavailableError{Msg: "the engine is draining, it does not start new steps"}
+
+// clk measures the timeouts, polls and retries of the steps, it is a fake
+// clock in tests.
+var clk = clock.Real
+
 type StepExecutor struct {
 	engine     *engine.Engine
 	mu         sync.Mutex
 	stepStatus map[string]StepStatus
 	stepLog    map[string]*StepLog
 	stepWaitCh map[string][]chan StepStatus
+
+	// the engine does not start new steps once draining, it shuts down
+	// once drained is closed.
+	draining  bool
+	inFlight  int // steps started and not completed yet
+	drained   chan struct{}
+	drainOnce sync.Once
+
+	// the state of the steps is kept in stateDir, if set, to re-attach to
+	// their containers once the engine restarted.
+	stateDir   string
+	reattacher StepReattacher
+	persisted  map[string]*persistedStep
+	stateMu    sync.Mutex // serializes the writes of the state
 }
 
 func NewStepExecutor(engine *engine.Engine) *StepExecutor {
@@ -68,6 +108,7 @@ func NewStepExecutor(engine *engine.Engine) *StepExecutor {
 		stepWaitCh: make(map[string][]chan StepStatus),
 		stepLog:    make(map[string]*StepLog),
 		stepStatus: make(map[string]StepStatus),
+		drained:    make(chan struct{}),
 	}
 }
 
@@ -75,40 +116,101 @@ func (e *StepExecutor) StartStep(ctx context.Context, r *api.StartStepRequest) e
 	if r.ID == "" {
 		return &errors.BadRequestError{Msg: "ID needs to be set"}
 	}
+	if err := validateStartStepRequest(r); err != nil {
+		return err
+	}
 
 	e.mu.Lock()
-	_, ok := e.stepStatus[r.ID]
+	s, ok := e.stepStatus[r.ID]
+	if !ok {
+		if err := currentBudget.check(); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+	}
 	if ok {
+		// a duplicate request writes to the log key claimed by the step
+		if s.LogKey != "" {
+			r.LogKey = s.LogKey
+		}
 		e.mu.Unlock()
 		return nil
 	}
+	if e.draining {
+		e.mu.Unlock()
+		return errDraining
+	}
 
-	e.stepStatus[r.ID] = StepStatus{Status: Running}
+	claimLogKey(r)
+	e.stepStatus[r.ID] = StepStatus{Status: Running, LogKey: r.LogKey}
+	e.inFlight++
 	e.mu.Unlock()
 
+	e.trackStep(r, false)
+
 	go func() {
 		wr := getLogStreamWriter(r)
-		state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(ctx, r, wr)
+		errs := &stepErrors{}
+		state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(withStepErrors(ctx, errs), r, wr)
 		status := StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Envs: envs,
-			Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState}
-		e.mu.Lock()
-		e.stepStatus[r.ID] = status
-		channels := e.stepWaitCh[r.ID]
-		e.mu.Unlock()
-
-		for _, ch := range channels {
-			ch <- status
+			Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, CommandStatus: getCommandStatus(r),
+			Errors: errs.list(), Annotations: getAnnotations(r), Telemetry: e.stepTelemetry(r, !checkStepSuccess(state, stepErr))}
+		sealSecretOutputs(&status, pipeline.GetState().GetOutputKey())
+		if _, ok := pipeline.Standalone(); ok {
+			writeStandaloneResult(r, convertStatus(status))
 		}
+		e.finishStep(r.ID, status)
 	}()
 	return nil
 }
 
+// finishStep sets the status of the completed step and notifies the
+// pending polls.
+func (e *StepExecutor) finishStep(id string, status StepStatus) { //nolint:gocritic
+	e.mu.Lock()
+	if status.LogKey == "" {
+		status.LogKey = e.stepStatus[id].LogKey
+	}
+	e.stepStatus[id] = status
+	channels := e.stepWaitCh[id]
+	e.inFlight--
+	if s, ok := e.persisted[id]; ok {
+		s.Result = convertStatus(status)
+	}
+	e.mu.Unlock()
+	e.saveState()
+
+	for _, ch := range channels {
+		ch <- status
+	}
+}
+
 func (e *StepExecutor) StartStepWithStatusUpdate(ctx context.Context, r *api.StartStepRequest) error {
 	if r.ID == "" {
 		return &errors.BadRequestError{Msg: "ID needs to be set"}
 	}
+	if err := validateStartStepRequest(r); err != nil {
+		return err
+	}
+	if err := currentBudget.check(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	if e.draining {
+		e.mu.Unlock()
+		return errDraining
+	}
+	e.inFlight++
+	e.mu.Unlock()
+	claimLogKey(r)
+	e.trackStep(r, true)
 
 	go func() {
+		defer func() {
+			e.mu.Lock()
+			e.inFlight--
+			e.mu.Unlock()
+		}()
 		done := make(chan api.VMTaskExecutionResponse, 1)
 		var resp api.VMTaskExecutionResponse
 		var wr logstream.Writer
@@ -118,9 +220,12 @@ func (e *StepExecutor) StartStepWithStatusUpdate(ctx context.Context, r *api.Sta
 				setPrevStepExportEnvs(r)
 			}
 			wr = getLogStreamWriter(r)
-			state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(ctx, r, wr)
+			errs := &stepErrors{}
+			state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(withStepErrors(ctx, errs), r, wr)
 			status := StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Envs: envs,
-				Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState}
+				Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, CommandStatus: getCommandStatus(r),
+				Errors: errs.list(), Annotations: getAnnotations(r), Telemetry: e.stepTelemetry(r, !checkStepSuccess(state, stepErr))}
+			sealSecretOutputs(&status, pipeline.GetState().GetOutputKey())
 			pollResponse := convertStatus(status)
 			if r.StageRuntimeID != "" && len(pollResponse.Envs) > 0 {
 				pipeline.GetEnvState().Add(r.StageRuntimeID, pollResponse.Envs)
@@ -132,14 +237,16 @@ func (e *StepExecutor) StartStepWithStatusUpdate(ctx context.Context, r *api.Sta
 		select {
 		case resp = <-done:
 			e.sendStepStatus(r, &resp)
+			e.untrackStep(r.ID)
 			return
-		case <-time.After(defaultStepTimeout):
+		case <-clk.After(defaultStepTimeout):
 			// close the log stream if timeout
 			if wr != nil {
 				wr.Close()
 			}
 			resp = api.VMTaskExecutionResponse{CommandExecutionStatus: api.Timeout, ErrorMessage: "step timed out"}
 			e.sendStepStatus(r, &resp)
+			e.untrackStep(r.ID)
 			return
 		}
 	}()
@@ -176,7 +283,62 @@ func (e *StepExecutor) PollStep(ctx context.Context, r *api.PollStepRequest) (*a
 	return convertStatus(status), nil
 }
 
-func (e *StepExecutor) StreamOutput(ctx context.Context, r *api.StreamOutputRequest) (oldOut []byte, newOut <-chan []byte, err error) {
+// RunningSteps returns the number of steps which are still executing.
+func (e *StepExecutor) RunningSteps() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := 0
+	for _, s := range e.stepStatus {
+		if s.Status == Running {
+			n++
+		}
+	}
+	return n
+}
+
+// Drain stops the executor from starting new steps and waits for the
+// running steps to complete, their logs and reports uploaded, until ctx is
+// done. It returns the number of steps still running.
+func (e *StepExecutor) Drain(ctx context.Context) int {
+	e.mu.Lock()
+	e.draining = true
+	e.mu.Unlock()
+	for {
+		e.mu.Lock()
+		n := e.inFlight
+		e.mu.Unlock()
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return n
+		case <-clk.After(drainPollInterval):
+		}
+	}
+}
+
+// Resume starts the new steps again after a drain, eg. once the restart of
+// the engine failed.
+func (e *StepExecutor) Resume() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.draining = false
+}
+
+// Shutdown requests the engine to shut down, once drained.
+func (e *StepExecutor) Shutdown() {
+	e.drainOnce.Do(func() { close(e.drained) })
+}
+
+// Drained returns a channel closed once the engine is requested to shut
+// down.
+func (e *StepExecutor) Drained() <-chan struct{} {
+	return e.drained
+}
+
+func (e *StepExecutor) StreamOutput(ctx context.Context, r *api.StreamOutputRequest) (oldOut io.Reader, newOut <-chan []byte, err error) {
 	id := r.ID
 	if id == "" {
 		err = &errors.BadRequestError{Msg: "ID needs to be set"}
@@ -186,24 +348,35 @@ func (e *StepExecutor) StreamOutput(ctx context.Context, r *api.StreamOutputRequ
 	var stepLog *StepLog
 
 	// the runner will call this function just before the call to start step, so we wait a while for the step to start
-	for ts := time.Now(); ; {
+	for ts := clk.Now(); ; {
 		e.mu.Lock()
 		stepLog = e.stepLog[id]
+		running := e.stepStatus[id].Status == Running
 		e.mu.Unlock()
 
 		if stepLog != nil {
 			break
 		}
 
+		// the output of a step run before the engine restarted is only
+		// in its ring buffer.
+		if !running && logBufferEnabled() {
+			if data, berr := readPersistedLog(id, r.Offset); berr == nil {
+				ch := make(chan []byte)
+				close(ch)
+				return bytes.NewReader(data), ch, nil
+			}
+		}
+
 		const timeoutDelay = 5 * time.Second
-		if time.Since(ts) >= timeoutDelay {
+		if clk.Since(ts) >= timeoutDelay {
 			err = &errors.BadRequestError{Msg: "Step has not started"}
 			return
 		}
 
 		const retryDelay = 100 * time.Millisecond
 		select {
-		case <-time.After(retryDelay):
+		case <-clk.After(retryDelay):
 		case <-ctx.Done():
 			err = ctx.Err()
 			return
@@ -212,7 +385,7 @@ func (e *StepExecutor) StreamOutput(ctx context.Context, r *api.StreamOutputRequ
 
 	// subscribe to new data messages, and unsubscribe when the request context finished or when the step is done
 	chData := make(chan []byte)
-	oldOut, err = stepLog.Subscribe(chData, r.Offset)
+	oldOut, err = stepLog.SubscribeReader(chData, r.Offset)
 	if err != nil {
 		return
 	}
@@ -237,12 +410,15 @@ func (e *StepExecutor) executeStepDrone(r *api.StartStepRequest) (*runtime.State
 	ctx := context.Background()
 	var cancel context.CancelFunc
 	if r.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
+		ctx, cancel = withStepTimeout(ctx, time.Second*time.Duration(r.Timeout))
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
 
 	stepLog := NewStepLog(ctx) // step output will terminate when the ctx is canceled
+	if logBufferEnabled() {
+		stepLog.persist(r.ID)
+	}
 
 	logr := logrus.WithContext(ctx).
 		WithField("id", r.ID).
@@ -257,7 +433,7 @@ func (e *StepExecutor) executeStepDrone(r *api.StartStepRequest) (*runtime.State
 
 		r.Kind = api.Run // only this kind is supported
 
-		exited, _, _, _, _, _, err := run(ctx, e.engine.Run, r, stepLog, pipeline.GetState().GetTIConfig())
+		exited, _, _, _, _, _, err := run(ctx, e.engine.Run, r, prefixOutput(r, stepLog), pipeline.GetState().GetTIConfig())
 		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
 			logr.WithError(err).Warnln("step execution canceled")
 			return nil, ctx.Err()
@@ -294,15 +470,21 @@ func (e *StepExecutor) executeStep(ctx context.Context, r *api.StartStepRequest,
 		state, err := e.executeStepDrone(r)
 		return state, nil, nil, nil, nil, "", err
 	}
-	// If TI Config has been passed in the step request, use that insetad of relying on the one in the pipeline state
-	var tiConfig *tiCfg.Cfg
+	if r.WorkspaceClone && !r.Detach && e.engine != nil {
+		// the reports are collected from the clone by the helper
+		defer e.engine.ReleaseClone(r.ID)
+	}
+	return executeStepHelper(ctx, r, e.engine.Run, wr, stepTiConfig(r))
+}
+
+// stepTiConfig returns the TI config of the step request if set, the one of
+// the pipeline state otherwise.
+func stepTiConfig(r *api.StartStepRequest) *tiCfg.Cfg {
 	if r.TIConfig.URL != "" {
-		g := getTiCfg(&r.TIConfig)
-		tiConfig = &g
-	} else {
-		tiConfig = pipeline.GetState().GetTIConfig()
+		g := ti.NewConfig(&r.TIConfig)
+		return &g
 	}
-	return executeStepHelper(ctx, r, e.engine.Run, wr, tiConfig)
+	return pipeline.GetState().GetTIConfig()
 }
 
 // executeStepHelper is a helper function which is used both by this step executor as well as the
@@ -318,33 +500,72 @@ func executeStepHelper( //nolint:gocritic
 	// if the step is configured as a daemon, it is detached
 	// from the main process and executed separately.
 	// We do here only for non-container step.
+	errs := stepErrorsFromContext(ctx)
+	start := clk.Now()
+	lifecycle.StepStart(context.Background(), r)
 	if r.Detach && r.Image == "" {
+		// the step is stopped if it does not become ready.
+		stepCtx, stop := context.WithCancel(withStepErrors(context.Background(), errs))
+		// the output is closed once the step exited and the readiness of
+		// the step, writing to it, is known.
+		stepExited, readinessDone := make(chan struct{}), make(chan struct{})
 		go func() {
-			ctx = context.Background()
+			defer stop()
+			ctx := stepCtx
 			var cancel context.CancelFunc
 			if r.Timeout > 0 {
-				ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
+				ctx, cancel = withStepTimeout(ctx, time.Second*time.Duration(r.Timeout))
 				defer cancel()
 			}
-			run(ctx, f, r, wr, tiCfg) //nolint:errcheck
+			exited, _, _, _, _, _, err := run(ctx, f, r, wr, tiCfg)
+			close(stepExited)
+			<-readinessDone
 			wr.Close()
+			lifecycle.StepEnd(context.Background(), r, stepResult(exited, err, clk.Since(start)))
 		}()
+		defer close(readinessDone)
+		if r.Readiness != nil {
+			if err := waitReady(stepCtx, r, wr, stepExited); err != nil {
+				stop()
+				recordStepError(stepCtx, err)
+				return nil, nil, nil, nil, nil, "", err
+			}
+		}
 		return &runtime.State{Exited: false}, nil, nil, nil, nil, "", nil
 	}
 
 	var result error
 
-	ctx = context.Background()
+	// the step is stopped like a step which timed out once the budget of
+	// the stage is exhausted.
+	stageCtx, stopStage := currentBudget.context(withStepErrors(context.Background(), errs))
+	defer stopStage()
+	defer func() { currentBudget.add(clk.Since(start)) }()
+	ctx = stageCtx
 	var cancel context.CancelFunc
-	if r.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(r.Timeout))
+	var budget *timeoutBudget
+	if r.Timeout > 0 && r.PostProcessingTimeout > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		budget = newTimeoutBudget(r, cancel)
+		defer budget.stop()
+		ctx = withTimeoutBudget(ctx, budget)
+		f = budget.wrap(f)
+	} else if r.Timeout > 0 {
+		ctx, cancel = withStepTimeout(ctx, time.Second*time.Duration(r.Timeout))
 		defer cancel()
 	}
 
 	exited, outputs, envs, artifact, outputV2, optimizationState, err :=
 		run(ctx, f, r, wr, tiCfg)
+	if err == nil && r.Detach && r.Readiness != nil && exited != nil && !exited.Exited {
+		if err = waitReady(ctx, r, wr, nil); err != nil {
+			killNotReady(r)
+		}
+	}
 	if err != nil {
 		result = multierror.Append(result, err)
+		recordStepError(ctx, err)
 	}
 
 	// if err is not nill or it's not a detach step then always close the stream
@@ -353,14 +574,19 @@ func executeStepHelper( //nolint:gocritic
 		// full log buffer is uploaded to the remote server.
 		if err = wr.Close(); err != nil {
 			result = multierror.Append(result, err)
+			recordStepError(ctx, withStage(api.StepErrorStageLogClose, true, err))
 		}
 	}
 
 	// if the context was canceled and returns a canceled or
 	// DeadlineExceeded error this indicates the step was timed out.
-	switch ctx.Err() {
-	case context.Canceled, context.DeadlineExceeded:
-		return nil, nil, nil, nil, nil, "", ctx.Err()
+	if err := timeoutError(ctx, r, budget); err != nil {
+		if berr := currentBudget.exceeded(stageCtx); berr != nil {
+			err = berr
+			recordStepError(ctx, err)
+		}
+		lifecycle.StepEnd(context.Background(), r, stepResult(nil, err, clk.Since(start)))
+		return nil, nil, nil, nil, nil, "", err
 	}
 
 	if exited != nil {
@@ -376,10 +602,55 @@ func executeStepHelper( //nolint:gocritic
 			logrus.WithContext(ctx).WithField("id", r.ID).Infof("received exit code %d\n", exited.ExitCode)
 		}
 	}
+	lifecycle.StepEnd(context.Background(), r, stepResult(exited, result, clk.Since(start)))
 	return exited, outputs, envs, artifact, outputV2, optimizationState, result
 }
 
+// writeStandaloneResult writes the result of the step to the results
+// directory of the standalone mode.
+func writeStandaloneResult(r *api.StartStepRequest, v interface{}) {
+	name := filepath.Join("steps", strings.ReplaceAll(r.ID, "/", "_")+".json")
+	if err := pipeline.WriteStandaloneResult(name, v); err != nil {
+		logrus.WithField("id", r.ID).WithError(err).Errorln("failed to write step result")
+		return
+	}
+	logrus.WithField("id", r.ID).Infoln("successfully wrote step result")
+}
+
+// stepResult returns the outcome of the step for the lifecycle hooks.
+func stepResult(exited *runtime.State, err error, d time.Duration) *lifecycle.StepResult {
+	res := &lifecycle.StepResult{Err: err, Duration: d}
+	if exited != nil {
+		res.Exited = exited.Exited
+		res.ExitCode = exited.ExitCode
+		res.OOMKilled = exited.OOMKilled
+	}
+	return res
+}
+
 func run(ctx context.Context, f RunFunc, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	if r.Umask != "" {
+		umask, err := fileperm.Parse(r.Umask)
+		if err != nil {
+			return nil, nil, nil, nil, nil, "", err
+		}
+		f = withUmask(f, umask)
+	}
+	// the output of a detached step is written once the step returned.
+	if enc, _ := charset.FromEnvs(r.Envs); enc != nil && !r.Detach {
+		f = withCharset(f, enc)
+	}
+	if reproManifestEnabled(r.Envs) {
+		return withReproManifest(ctx, f, r, tiConfig, func(f RunFunc) (*runtime.State, map[string]string,
+			map[string]string, []byte, []*api.OutputV2, string, error) {
+			return runKind(ctx, f, r, out, tiConfig)
+		})
+	}
+	return runKind(ctx, f, r, out, tiConfig)
+}
+
+func runKind(ctx context.Context, f RunFunc, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) ( //nolint:gocritic
 	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
 	if r.Kind == api.Run {
 		return executeRunStep(ctx, f, r, out, tiConfig)
@@ -387,21 +658,113 @@ func run(ctx context.Context, f RunFunc, r *api.StartStepRequest, out io.Writer,
 	if r.Kind == api.RunTestsV2 {
 		return executeRunTestsV2Step(ctx, f, r, out, tiConfig)
 	}
+	if r.Kind == api.Terraform {
+		return executeTerraformStep(ctx, f, r, out, tiConfig)
+	}
+	if r.Kind == api.CacheRestore || r.Kind == api.CacheSave {
+		return executeCacheStep(ctx, r, out)
+	}
+	if r.Kind == api.Upload {
+		return executeUploadStep(ctx, r, out)
+	}
+	if r.Kind == api.Audit {
+		return executeAuditStep(ctx, r, out)
+	}
+	if r.Kind == api.ImageOp {
+		return executeImageOpStep(ctx, r, out)
+	}
 	return executeRunTestStep(ctx, f, r, out, tiConfig)
 }
 
+// stepTelemetry returns the resources consumed by the container or the host
+// process of the step, the change of its test selection and its test duration
+// regressions, nil for the detached steps and the successful steps not sampled.
+func (e *StepExecutor) stepTelemetry(r *api.StartStepRequest, failed bool) *api.TelemetryData {
+	regressions := report.ReadRegressions(r.ID)
+	if e.engine == nil || r.Detach || !currentSampling.sample(r.ID, failed) {
+		return nil
+	}
+	var t *api.TelemetryData
+	if u := e.engine.StepUsage(r.ID); u != nil {
+		t = &api.TelemetryData{CPUSeconds: u.CPUSeconds, MemoryGBSeconds: u.MemoryGBSeconds, NetworkEgressGB: u.NetworkEgressGB,
+			PeakMemoryBytes: u.PeakMemoryBytes, IOReadBytes: u.IOReadBytes, IOWriteBytes: u.IOWriteBytes}
+	}
+	if rec := instrumentation.ReadRecord(r.ID); rec != nil && rec.SelectionDiff != nil {
+		if t == nil {
+			t = &api.TelemetryData{}
+		}
+		d := rec.SelectionDiff
+		t.TestSelection = &api.TestSelectionTelemetry{Selected: d.Selected, NewlySelected: len(d.NewlySelected),
+			NewlySkipped: len(d.NewlySkipped), SelectAll: d.SelectAll, PrevSelectAll: d.PrevSelectAll}
+	}
+	if len(regressions) > 0 {
+		if t == nil {
+			t = &api.TelemetryData{}
+		}
+		t.TestRegressions = regressions
+	}
+	return t
+}
+
+// getAnnotations returns the annotations generated for the step.
+func getAnnotations(r *api.StartStepRequest) []*api.Annotation {
+	var annotations []*api.Annotation
+	if report.TestSummaryAsOutputEnabled(r.Envs) {
+		if a := report.ReadAnnotation(r.ID); a != nil {
+			annotations = append(annotations, a)
+		}
+		if a := report.ReadQualityAnnotation(r.ID); a != nil {
+			annotations = append(annotations, a)
+		}
+	}
+	if report.RegressionAnnotationEnabled(r.Envs) {
+		if a := report.ReadRegressionAnnotation(r.ID); a != nil {
+			annotations = append(annotations, a)
+		}
+	}
+	if r.Kind == api.Terraform {
+		if a := readTerraformAnnotation(r.ID); a != nil {
+			annotations = append(annotations, a)
+		}
+	}
+	return annotations
+}
+
+// claimLogKey namespaces the log key of the step if another step of the
+// stage already wrote to it, eg. when the runner retries a step.
+func claimLogKey(r *api.StartStepRequest) {
+	if r.LogDrone || r.LogKey == "" {
+		return
+	}
+	key, collided := pipeline.GetState().ClaimLogKey(r.LogKey, r.ReuseLogKey)
+	if collided {
+		logrus.WithField("id", r.ID).WithField("log_key", r.LogKey).WithField("new_log_key", key).
+			Warnln("log key was already used by another step")
+	}
+	r.LogKey = key
+}
+
 func getLogStreamWriter(r *api.StartStepRequest) logstream.Writer {
 	if r.LogDrone {
 		return nil
 	}
 	pipelineState := pipeline.GetState()
-	secrets := append(pipelineState.GetSecrets(), r.Secrets...)
-
 	// Create a log stream for step logs
 	client := pipelineState.GetLogStreamClient()
 
-	wc := livelog.New(client, r.LogKey, r.Name, getNudges(), false, pipelineState.GetLogConfig().TrimNewLineSuffix)
-	wr := logstream.NewReplacer(wc, secrets)
+	logConfig := pipelineState.GetLogConfig()
+	wc := livelog.New(client, r.LogKey, r.Name, getNudges(), false, logConfig.TrimNewLineSuffix)
+	if logConfig.MaxPendingLines > 0 {
+		wc.SetPendingLimit(logConfig.MaxPendingLines)
+	}
+	setBatching(wc, logConfig)
+	wc.SetStructured(logConfig.StructuredLogs)
+	wc.SetSinks(pipelineState.GetLogSinks())
+	var detector *logstream.EntropyDetector
+	if logConfig.MaskHighEntropy {
+		detector = logstream.NewEntropyDetector(logConfig.HighEntropyMinLength, logConfig.HighEntropyThreshold)
+	}
+	wr := logstream.NewMaskedWriter(wc, pipelineState.GetSecretSet(), r.Secrets, pipelineState.GetMaskPatterns(), detector)
 	go wr.Open() //nolint:errcheck
 	return wr
 }
@@ -419,9 +782,23 @@ func setPrevStepExportEnvs(r *api.StartStepRequest) {
 }
 
 func (e *StepExecutor) sendStepStatus(r *api.StartStepRequest, response *api.VMTaskExecutionResponse) {
+	if response.LogKey == "" {
+		response.LogKey = r.LogKey
+	}
+	if _, ok := pipeline.Standalone(); ok {
+		writeStandaloneResult(r, response)
+		return
+	}
 	delegateClient := delegate.NewFromToken(r.StepStatus.Endpoint, r.StepStatus.AccountID, r.StepStatus.Token, true, "")
 
-	if err := e.sendStatus(r, delegateClient, response); err != nil {
+	// the delegate client retries transient errors itself, this covers longer outages.
+	p := retry.Constant(sendStatusAttempts, sendStatusRetryInterval)
+	p.Clock = clk
+	err := retry.Do(context.Background(), "delegate_send_status", p,
+		func(context.Context) error {
+			return e.sendStatus(r, delegateClient, response)
+		})
+	if err != nil {
 		logrus.WithField("id", r.ID).WithError(err).Errorln("failed to send step status")
 		return
 	}
@@ -493,6 +870,9 @@ func getRunnerTaskResponse(r *api.StartStepRequest, response *api.VMTaskExecutio
 }
 
 func convertStatus(status StepStatus) *api.PollStepResponse { //nolint:gocritic
+	if status.Restored != nil {
+		return status.Restored
+	}
 	r := &api.PollStepResponse{
 		Exited:            true,
 		Outputs:           status.Outputs,
@@ -500,6 +880,10 @@ func convertStatus(status StepStatus) *api.PollStepResponse { //nolint:gocritic
 		Artifact:          status.Artifact,
 		OutputV2:          status.OutputV2,
 		OptimizationState: status.OptimizationState,
+		CommandStatus:     status.CommandStatus,
+		Annotations:       status.Annotations,
+		LogKey:            status.LogKey,
+		Telemetry:         status.Telemetry,
 	}
 
 	stepErr := status.StepErr
@@ -522,15 +906,63 @@ func convertStatus(status StepStatus) *api.PollStepResponse { //nolint:gocritic
 	if stepErr != nil {
 		r.Error = stepErr.Error()
 	}
+	r.Errors = convertStepErrors(&status)
 	return r
 }
 
+// convertStepErrors returns the errors failing the step first, followed by
+// the other recorded errors of the step and the errors derived from its exit
+// state.
+func convertStepErrors(status *StepStatus) []*api.StepError {
+	var errs []*api.StepError
+	failing := make(map[*api.StepError]bool)
+	for _, err := range failingErrors(status.StepErr) {
+		stepErr := newStepError(err)
+		// prefer the recorded error, it keeps the stage of a wrapped error
+		for _, e := range status.Errors {
+			if !failing[e] && e.Message == stepErr.Message {
+				stepErr = e
+				break
+			}
+		}
+		failing[stepErr] = true
+		errs = append(errs, stepErr)
+	}
+	for _, e := range status.Errors {
+		if !failing[e] {
+			errs = append(errs, e)
+		}
+	}
+	if status.State != nil {
+		if status.State.OOMKilled {
+			errs = append(errs, &api.StepError{Stage: api.StepErrorStageRun, Message: "oom killed"})
+		} else if status.State.ExitCode != 0 {
+			errs = append(errs, &api.StepError{Stage: api.StepErrorStageRun, Message: fmt.Sprintf("exit status %d", status.State.ExitCode)})
+		}
+	}
+	return errs
+}
+
+// failingErrors returns the errors appended to the error failing the step.
+func failingErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if merr, ok := err.(*multierror.Error); ok { //nolint:errorlint
+		return merr.WrappedErrors()
+	}
+	return []error{err}
+}
+
 func convertPollResponse(r *api.PollStepResponse, envs map[string]string) api.VMTaskExecutionResponse {
 	if r.Error == "" {
-		return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Success, OutputVars: r.Outputs, Artifact: r.Artifact, Outputs: r.OutputV2, OptimizationState: r.OptimizationState}
+		return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Success, OutputVars: r.Outputs, Artifact: r.Artifact, Outputs: r.OutputV2, OptimizationState: r.OptimizationState,
+			CommandStatus: r.CommandStatus, Errors: r.Errors, Annotations: r.Annotations, Telemetry: r.Telemetry, LogKey: r.LogKey}
 	}
 	if report.TestSummaryAsOutputEnabled(envs) {
-		return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Failure, OutputVars: r.Outputs, Outputs: r.OutputV2, ErrorMessage: r.Error, OptimizationState: r.OptimizationState}
+		return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Failure, OutputVars: r.Outputs, Outputs: r.OutputV2, ErrorMessage: r.Error, OptimizationState: r.OptimizationState,
+			CommandStatus: r.CommandStatus, Errors: r.Errors, Annotations: r.Annotations, Telemetry: r.Telemetry, LogKey: r.LogKey}
 	}
-	return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Failure, ErrorMessage: r.Error, OptimizationState: r.OptimizationState}
+	return api.VMTaskExecutionResponse{CommandExecutionStatus: api.Failure, ErrorMessage: r.Error, OptimizationState: r.OptimizationState, CommandStatus: r.CommandStatus,
+		Errors: r.Errors, Annotations: r.Annotations, Telemetry: r.Telemetry, LogKey: r.LogKey}
 }
@@ -16,7 +16,7 @@ import (
 	"github.com/harness/lite-engine/pipeline"
 
 	"github.com/drone/runner-go/pipeline/runtime"
-	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti"
 )
 
 type StepExecutorStateless struct {
@@ -42,12 +42,18 @@ func (e *StepExecutorStateless) Run(
 	if r.ID == "" {
 		return api.VMTaskExecutionResponse{}, &errors.BadRequestError{Msg: "ID needs to be set"}
 	}
+	if err := validateStartStepRequest(r); err != nil {
+		return api.VMTaskExecutionResponse{}, err
+	}
 
 	e.stepStatus = StepStatus{Status: Running}
 
-	state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(ctx, r, cfg, writer)
+	errs := &stepErrors{}
+	state, outputs, envs, artifact, outputV2, optimizationState, stepErr := e.executeStep(withStepErrors(ctx, errs), r, cfg, writer)
 	e.stepStatus = StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Envs: envs,
-		Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState}
+		Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, CommandStatus: getCommandStatus(r),
+		Errors: errs.list(), Annotations: getAnnotations(r)}
+	sealSecretOutputs(&e.stepStatus, pipeline.GetState().GetOutputKey())
 	pollResponse := convertStatus(e.stepStatus)
 	return convertPollResponse(pollResponse, r.Envs), nil
 }
@@ -63,13 +69,7 @@ func (e *StepExecutorStateless) executeStep( //nolint:gocritic
 		return engine.RunStep(ctx, engine.Opts{}, step, output, cfg, isDrone, isHosted)
 	}
 	// Temporary: this should be removed once we have a better way of handling test intelligence.
-	tiConfig := getTiCfg(&r.TIConfig)
+	tiConfig := ti.NewConfig(&r.TIConfig)
 
 	return executeStepHelper(ctx, r, runFunc, writer, &tiConfig)
 }
-
-func getTiCfg(t *api.TIConfig) tiCfg.Cfg {
-	cfg := tiCfg.New(t.URL, t.Token, t.AccountID, t.OrgID, t.ProjectID, t.PipelineID, t.BuildID, t.StageID, t.Repo,
-		t.Sha, t.CommitLink, t.SourceBranch, t.TargetBranch, t.CommitBranch, pipeline.SharedVolPath, t.ParseSavings, false)
-	return cfg
-}
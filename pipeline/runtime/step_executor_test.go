@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepExecutorDrain(t *testing.T) {
+	e := NewStepExecutor(nil)
+	e.inFlight = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 1, e.Drain(ctx))
+
+	r := &api.StartStepRequest{ID: "step", Kind: api.Run, Run: api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh}}
+	assert.Equal(t, errDraining, e.StartStep(context.Background(), r))
+	r.StageRuntimeID = "stage"
+	assert.Equal(t, errDraining, e.StartStepWithStatusUpdate(context.Background(), r))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		e.mu.Lock()
+		e.inFlight--
+		e.mu.Unlock()
+	}()
+	assert.Equal(t, 0, e.Drain(context.Background()))
+
+	e.Resume()
+	assert.False(t, e.draining)
+}
+
+// useFakeClock makes the runtime measure its timeouts, polls and retries
+// with a fake clock for the duration of the test.
+func useFakeClock(t *testing.T) *clock.Fake {
+	fake := clock.NewFake(time.Unix(0, 0))
+	clk = fake
+	t.Cleanup(func() { clk = clock.Real })
+	return fake
+}
+
+func TestStepExecutorDrainTimeout(t *testing.T) {
+	fake := useFakeClock(t)
+	e := NewStepExecutor(nil)
+	e.inFlight = 1
+
+	ctx, cancel := clock.WithTimeout(context.Background(), fake, time.Second)
+	defer cancel()
+	done := make(chan int)
+	go func() { done <- e.Drain(ctx) }()
+	fake.BlockUntil(2) // the drain timeout and the poll
+	fake.Advance(time.Second)
+	assert.Equal(t, 1, <-done)
+
+	go func() { done <- e.Drain(context.Background()) }()
+	fake.BlockUntil(1)
+	e.mu.Lock()
+	e.inFlight--
+	e.mu.Unlock()
+	fake.Advance(drainPollInterval)
+	assert.Equal(t, 0, <-done)
+}
+
+func TestStreamOutputNotStarted(t *testing.T) {
+	fake := useFakeClock(t)
+	e := NewStepExecutor(nil)
+
+	done := make(chan error)
+	go func() {
+		_, _, err := e.StreamOutput(context.Background(), &api.StreamOutputRequest{ID: "step"})
+		done <- err
+	}()
+	// the step is polled every 100ms for 5s
+	for i := 0; i < 50; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(100 * time.Millisecond)
+	}
+	assert.EqualError(t, <-done, "Step has not started")
+}
+
+func TestStreamOutputCanceled(t *testing.T) {
+	fake := useFakeClock(t)
+	e := NewStepExecutor(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := e.StreamOutput(ctx, &api.StreamOutputRequest{ID: "step"})
+		done <- err
+	}()
+	fake.BlockUntil(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestStartStepDuplicateLogKey(t *testing.T) {
+	e := NewStepExecutor(nil)
+	e.stepStatus["step"] = StepStatus{Status: Running, LogKey: "key-attempt-2"}
+	e.inFlight = 1
+
+	// a duplicate request returns the log key claimed by the step
+	r := &api.StartStepRequest{ID: "step", Kind: api.Run, LogKey: "key", Run: api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh}}
+	assert.NoError(t, e.StartStep(context.Background(), r))
+	assert.Equal(t, "key-attempt-2", r.LogKey)
+
+	e.finishStep("step", StepStatus{Status: Complete})
+	resp, err := e.PollStep(context.Background(), &api.PollStepRequest{ID: "step"})
+	assert.NoError(t, err)
+	assert.Equal(t, "key-attempt-2", resp.LogKey)
+	assert.Equal(t, "key-attempt-2", convertPollResponse(resp, nil).LogKey)
+}
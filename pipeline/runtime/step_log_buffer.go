@@ -0,0 +1,195 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logBufferHeaderSize = 16 // the bytes written and the capacity of the buffer
+	logBufferPerm       = 0600
+)
+
+var (
+	// stepLogBufferDir is the directory of the on-disk ring buffers of the
+	// step output, so the output can be streamed after the engine restarts.
+	stepLogBufferDir string
+	// stepLogBufferSize is the capacity of the ring buffer of each step.
+	stepLogBufferSize int64
+)
+
+// SetStepLogBuffer keeps the last size bytes of the output of each step in
+// a ring buffer in dir, so the output of the steps can be streamed from any
+// offset still in the buffer, including by a restarted engine. The buffers
+// are disabled if dir is empty or size is not positive.
+func SetStepLogBuffer(dir string, size int64) {
+	stepLogBufferDir = dir
+	stepLogBufferSize = size
+}
+
+// clearLogBuffers removes the ring buffers of the steps, eg. once the stage
+// is destroyed.
+func clearLogBuffers() {
+	if stepLogBufferDir == "" {
+		return
+	}
+	entries, err := os.ReadDir(stepLogBufferDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".log" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(stepLogBufferDir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warnln("cannot remove the ring buffer of the step output")
+		}
+	}
+}
+
+func logBufferEnabled() bool {
+	return stepLogBufferDir != "" && stepLogBufferSize > 0
+}
+
+// logBufferPath returns the path of the ring buffer of the step.
+func logBufferPath(stepID string) string {
+	return filepath.Join(stepLogBufferDir, url.PathEscape(stepID)+".log")
+}
+
+// logBuffer is a size-capped ring buffer of the output of a step in a
+// file. The header holds the number of bytes written and the capacity,
+// the byte at offset o is stored at o modulo the capacity after the header.
+type logBuffer struct {
+	f       *os.File
+	size    int64
+	written int64
+}
+
+// createLogBuffer creates the ring buffer of the step, replacing the
+// buffer of a previous execution of the step.
+func createLogBuffer(stepID string) (*logBuffer, error) {
+	f, err := os.OpenFile(logBufferPath(stepID), os.O_RDWR|os.O_CREATE|os.O_TRUNC, logBufferPerm)
+	if err != nil {
+		return nil, err
+	}
+	b := &logBuffer{f: f, size: stepLogBufferSize}
+	if err = b.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// openLogBuffer opens the ring buffer of the step written by this or by a
+// previous engine.
+func openLogBuffer(stepID string) (*logBuffer, error) {
+	f, err := os.Open(logBufferPath(stepID))
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, logBufferHeaderSize)
+	if _, err = io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	b := &logBuffer{
+		f:       f,
+		written: int64(binary.LittleEndian.Uint64(header[:8])),
+		size:    int64(binary.LittleEndian.Uint64(header[8:])),
+	}
+	if b.size <= 0 {
+		f.Close()
+		return nil, errors.New("invalid step log buffer")
+	}
+	return b, nil
+}
+
+func (b *logBuffer) writeHeader() error {
+	header := make([]byte, logBufferHeaderSize)
+	binary.LittleEndian.PutUint64(header[:8], uint64(b.written))
+	binary.LittleEndian.PutUint64(header[8:], uint64(b.size))
+	_, err := b.f.WriteAt(header, 0)
+	return err
+}
+
+// Write appends the data to the buffer, overwriting the oldest data once
+// the buffer is full.
+func (b *logBuffer) Write(data []byte) error {
+	if int64(len(data)) > b.size {
+		b.written += int64(len(data)) - b.size
+		data = data[int64(len(data))-b.size:]
+	}
+	for len(data) > 0 {
+		pos := b.written % b.size
+		n := int64(len(data))
+		if n > b.size-pos {
+			n = b.size - pos
+		}
+		if _, err := b.f.WriteAt(data[:n], logBufferHeaderSize+pos); err != nil {
+			return err
+		}
+		b.written += n
+		data = data[n:]
+	}
+	return b.writeHeader()
+}
+
+// start returns the offset of the oldest data in the buffer.
+func (b *logBuffer) start() int64 {
+	if b.written > b.size {
+		return b.written - b.size
+	}
+	return 0
+}
+
+// ReadFrom returns the data of the buffer from the offset to the offset
+// end, the data before the start of the buffer is skipped.
+func (b *logBuffer) ReadFrom(offset, end int64) ([]byte, error) {
+	if offset > b.written || end > b.written {
+		return nil, fmt.Errorf("error: index 'offset' is out of bounds Offset=%d Total=%d", offset, b.written)
+	}
+	if start := b.start(); offset < start {
+		offset = start
+	}
+	out := make([]byte, 0, end-offset)
+	for offset < end {
+		pos := offset % b.size
+		n := end - offset
+		if n > b.size-pos {
+			n = b.size - pos
+		}
+		chunk := make([]byte, n)
+		if _, err := b.f.ReadAt(chunk, logBufferHeaderSize+pos); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+		offset += n
+	}
+	return out, nil
+}
+
+func (b *logBuffer) Close() error {
+	return b.f.Close()
+}
+
+// readPersistedLog returns the output of the step kept in its ring buffer
+// from the offset, eg. for a step run before the engine restarted.
+func readPersistedLog(stepID string, offset int) ([]byte, error) {
+	b, err := openLogBuffer(stepID)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	return b.ReadFrom(int64(offset), b.written)
+}
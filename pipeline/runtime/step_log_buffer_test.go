@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withStepLogBuffer(t *testing.T, size int64) {
+	prevDir, prevSize := stepLogBufferDir, stepLogBufferSize
+	SetStepLogBuffer(t.TempDir(), size)
+	t.Cleanup(func() { SetStepLogBuffer(prevDir, prevSize) })
+}
+
+func TestLogBuffer(t *testing.T) {
+	withStepLogBuffer(t, 8)
+
+	b, err := createLogBuffer("step/1")
+	require.NoError(t, err)
+	require.NoError(t, b.Write([]byte("abcde")))
+	require.NoError(t, b.Write([]byte("fghij")))
+	require.NoError(t, b.Close())
+
+	data, err := readPersistedLog("step/1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "cdefghij", string(data))
+	data, err = readPersistedLog("step/1", 6)
+	require.NoError(t, err)
+	assert.Equal(t, "ghij", string(data))
+	_, err = readPersistedLog("step/1", 11)
+	assert.Error(t, err)
+
+	// a write larger than the buffer keeps its end
+	b, err = createLogBuffer("step/1")
+	require.NoError(t, err)
+	require.NoError(t, b.Write([]byte("0123456789")))
+	require.NoError(t, b.Close())
+	data, err = readPersistedLog("step/1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "23456789", string(data))
+}
+
+func TestStepLogBuffer(t *testing.T) {
+	withStepLogBuffer(t, 64)
+	prev := stepLogRetention
+	stepLogRetention = 4
+	defer func() { stepLogRetention = prev }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewStepLog(ctx)
+	l.persist("step")
+	for _, s := range []string{"hello ", "world, ", "from the ", "buffer"} {
+		_, err := l.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	// concurrent readers at different offsets, older than the retention
+	for offset, want := range map[int]string{0: "hello world, from the buffer", 6: "world, from the buffer"} {
+		ch := make(chan []byte, 1)
+		r, err := l.SubscribeReader(ch, offset)
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+		l.Unsubscribe(ch)
+	}
+	cancel()
+
+	// the output is streamed by a restarted engine
+	e := NewStepExecutor(nil)
+	old, ch, err := e.StreamOutput(context.Background(), &api.StreamOutputRequest{ID: "step", Offset: 13})
+	require.NoError(t, err)
+	data, err := io.ReadAll(old)
+	require.NoError(t, err)
+	assert.Equal(t, "from the buffer", string(data))
+	_, open := <-ch
+	assert.False(t, open)
+}
+
+func TestClearLogBuffers(t *testing.T) {
+	withStepLogBuffer(t, 8)
+
+	b, err := createLogBuffer("step")
+	require.NoError(t, err)
+	require.NoError(t, b.Write([]byte("abc")))
+	require.NoError(t, b.Close())
+
+	NewStepExecutor(nil).ClearState()
+	_, err = readPersistedLog("step", 0)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -8,25 +8,43 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
+
+	"github.com/sirupsen/logrus"
 )
 
+// stepLogRetention is the number of bytes of the step output kept in
+// memory, the whole output is kept if zero.
+var stepLogRetention int
+
+// SetStepLogRetention configures the step output kept in memory for the
+// output streaming. If retention is set, only its last bytes are kept in
+// memory, the older output is streamed from the ring buffer of the step if
+// the buffers are enabled with SetStepLogBuffer.
+func SetStepLogRetention(retention int) {
+	stepLogRetention = retention
+}
+
 type StepLog struct {
 	mx          sync.Mutex
-	fullOutput  *bytes.Buffer
+	output      []byte // the output from the base offset
+	base        int
+	retention   int
+	buffer      *logBuffer // the ring buffer of the output on disk, while the step runs
+	bufferID    string     // the step of the ring buffer, if any
 	done        <-chan struct{}
 	subscribers map[chan []byte]struct{}
 }
 
 func NewStepLog(ctx context.Context) *StepLog {
-	l := &StepLog{
+	return &StepLog{
 		mx:          sync.Mutex{},
-		fullOutput:  &bytes.Buffer{},
+		retention:   stepLogRetention,
 		done:        ctx.Done(),
 		subscribers: make(map[chan []byte]struct{}),
 	}
-
-	return l
 }
 
 func (l *StepLog) Done() <-chan struct{} {
@@ -38,11 +56,25 @@ func (l *StepLog) Write(data []byte) (int, error) {
 
 	l.mx.Lock()
 
-	l.fullOutput.Write(data)
+	if l.buffer != nil {
+		if err := l.buffer.Write(data); err != nil {
+			logrus.WithError(err).Warnln("cannot write the step output to its ring buffer")
+			l.closeBuffer()
+		}
+	}
+
+	l.output = append(l.output, data...)
+
+	// the data sent to the subscribers is never overwritten, the output
+	// is copied to a new buffer once it is twice the retention.
+	data = l.output[len(l.output)-n:]
+	if l.retention > 0 && len(l.output) > 2*l.retention {
+		kept := make([]byte, l.retention, 2*l.retention)
+		copy(kept, l.output[len(l.output)-l.retention:])
+		l.base += len(l.output) - l.retention
+		l.output = kept
+	}
 
-	// replace byte buffer from which the data came before we write it to the subscriber channels
-	data = l.fullOutput.Bytes()
-	data = data[len(data)-n:]
 	for ch := range l.subscribers {
 		ch <- data
 	}
@@ -55,19 +87,35 @@ func (l *StepLog) Write(data []byte) (int, error) {
 // Subscribe returns the output log that has been created so far (from the offset position) and
 // it registers the ch channel to receive further data output.
 func (l *StepLog) Subscribe(ch chan []byte, offset int) (data []byte, err error) {
+	r, err := l.SubscribeReader(ch, offset)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// SubscribeReader is like Subscribe, but it returns a reader of the output
+// so the output older than the retention is read from the ring buffer. If
+// the output at offset is no longer available, it reads from the oldest
+// output kept in memory.
+func (l *StepLog) SubscribeReader(ch chan []byte, offset int) (io.Reader, error) {
 	l.mx.Lock()
-	data = l.fullOutput.Bytes()
-	l.subscribers[ch] = struct{}{}
-	l.mx.Unlock()
+	defer l.mx.Unlock()
 
-	if offset > len(data) {
-		data = nil
-		err = fmt.Errorf("error: index 'offset' is out of bounds Offset=%d Total=%d", offset, len(data))
-	} else {
-		data = data[offset:]
+	if total := l.base + len(l.output); offset > total {
+		return nil, fmt.Errorf("error: index 'offset' is out of bounds Offset=%d Total=%d", offset, total)
 	}
+	l.subscribers[ch] = struct{}{}
 
-	return
+	if offset >= l.base {
+		return bytes.NewReader(l.output[offset-l.base:]), nil
+	}
+	if data, err := l.readBuffer(offset); err == nil {
+		return io.MultiReader(bytes.NewReader(data), bytes.NewReader(l.output)), nil
+	}
+	logrus.WithField("offset", offset).WithField("base", l.base).
+		Warnln("step output at offset is no longer available, streaming the retained output")
+	return bytes.NewReader(l.output), nil
 }
 
 func (l *StepLog) Unsubscribe(ch chan []byte) {
@@ -75,3 +123,53 @@ func (l *StepLog) Unsubscribe(ch chan []byte) {
 	delete(l.subscribers, ch)
 	l.mx.Unlock()
 }
+
+// persist keeps the output of the step in its ring buffer on disk, until
+// the step completes.
+func (l *StepLog) persist(stepID string) {
+	b, err := createLogBuffer(stepID)
+	if err != nil {
+		logrus.WithError(err).Warnln("cannot create the ring buffer of the step output")
+		return
+	}
+	l.mx.Lock()
+	l.buffer, l.bufferID = b, stepID
+	l.mx.Unlock()
+	go func() {
+		<-l.done
+		l.mx.Lock()
+		l.closeBuffer()
+		l.mx.Unlock()
+	}()
+}
+
+// readBuffer returns the output from the offset to the output kept in
+// memory from the ring buffer, the caller must hold the lock.
+func (l *StepLog) readBuffer(offset int) ([]byte, error) {
+	if l.bufferID == "" {
+		return nil, os.ErrNotExist
+	}
+	b := l.buffer
+	if b == nil {
+		var err error
+		if b, err = openLogBuffer(l.bufferID); err != nil {
+			return nil, err
+		}
+		defer b.Close()
+	}
+	if start := b.start(); int64(offset) < start {
+		logrus.WithField("offset", offset).WithField("start", start).
+			Warnln("step output at offset is no longer in the ring buffer, streaming the buffered output")
+	}
+	return b.ReadFrom(int64(offset), int64(l.base))
+}
+
+// closeBuffer closes the ring buffer, its file is kept to stream the
+// output later on. The caller must hold the lock.
+func (l *StepLog) closeBuffer() {
+	if l.buffer == nil {
+		return
+	}
+	l.buffer.Close()
+	l.buffer = nil
+}
@@ -168,3 +168,44 @@ func TestStepLogStreaming(t *testing.T) {
 		}
 	}
 }
+
+func TestStepLogRetention(t *testing.T) {
+	SetStepLogRetention(10)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	stepLog := NewStepLog(ctx)
+	SetStepLogRetention(0)
+
+	var all bytes.Buffer
+	for i := 0; i < 50; i++ {
+		line := []byte{byte('a' + i%26)}
+		all.Write(line)
+		_, _ = stepLog.Write(line)
+	}
+	if n := len(stepLog.output); n > 20 {
+		t.Errorf("expected at most 20 bytes in memory, got %d", n)
+	}
+
+	// without a ring buffer, the retained output is streamed
+	ch := make(chan []byte)
+	oldData, err := stepLog.Subscribe(ch, 5)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	stepLog.Unsubscribe(ch)
+	if want := all.Bytes()[stepLog.base:]; !bytes.Equal(want, oldData) {
+		t.Errorf("expected the retained output %q, got %q", want, oldData)
+	}
+
+	// offsets within the retained output are served from memory
+	oldData, err = stepLog.Subscribe(ch, 45)
+	stepLog.Unsubscribe(ch)
+	if err != nil || !bytes.Equal(all.Bytes()[45:], oldData) {
+		t.Errorf("expected %q, got %q (%v)", all.Bytes()[45:], oldData, err)
+	}
+
+	if _, err = stepLog.Subscribe(ch, 51); err == nil {
+		t.Error("expected an out of bounds error")
+	}
+}
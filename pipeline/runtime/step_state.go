@@ -0,0 +1,364 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/sealed"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/ti"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	stepStateFile        = "steps.json"
+	stageStateFile       = "stage.json"
+	stepStateInterval    = 5 * time.Second
+	stepStatePermissions = 0600
+)
+
+var errEngineRestarted = errors.New("the engine restarted while the step was running")
+
+// StepReattacher re-attaches to the containers of the steps started before
+// the engine restarted.
+type StepReattacher interface {
+	StepContainer(stepID string) (id string, logOffset int64, ok bool)
+	Reattach(ctx context.Context, stepID, containerID string, logOffset int64, output io.Writer) (*runtime.State, error)
+	SaveState(stateFile string) error
+	RestoreState(stateFile string) error
+}
+
+// persistedStep is the state of a step kept in the state directory.
+type persistedStep struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name,omitempty"`
+	LogKey      string                `json:"log_key,omitempty"`
+	Container   bool                  `json:"container,omitempty"` // the step runs in a container, it can be re-attached
+	ContainerID string                `json:"container_id,omitempty"`
+	LogOffset   int64                 `json:"log_offset,omitempty"` // the bytes of the container logs already streamed
+	Result      *api.PollStepResponse `json:"result,omitempty"`     // set once the step completed
+	// Request is the request of a container step, its outputs, exported
+	// variables, artifact and reports are collected once re-attached. The
+	// status of a step sent to the delegate is sent with it. It holds the
+	// secrets and the credentials of the step, so it is only written
+	// sealed with the key of the engine: an engine restarted with another
+	// key only streams the logs of the container.
+	Request       *api.StartStepRequest `json:"-"`
+	SealedRequest string                `json:"sealed_request,omitempty"`
+	// Deadline is the time the step times out at, zero without a timeout.
+	Deadline time.Time `json:"deadline,omitempty"`
+	// StatusUpdate is set if the status of the step is sent to the
+	// delegate instead of polled.
+	StatusUpdate bool `json:"status_update,omitempty"`
+}
+
+// PersistState keeps the state of the steps in the directory, so that an
+// engine restarted in the middle of a stage answers the polls of its steps.
+// The state left by a previous engine is restored first: the results of
+// the completed steps are kept, the engine re-attaches to the containers
+// of the running steps, and the running steps outside of a container fail.
+// The state is written as the steps start and complete, and periodically
+// while they run.
+func (e *StepExecutor) PersistState(ctx context.Context, dir string, reattacher StepReattacher) error {
+	if err := os.MkdirAll(dir, fileperm.Mode(os.ModePerm)); err != nil {
+		return err
+	}
+	steps, err := readStepState(filepath.Join(dir, stepStateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	e.mu.Lock()
+	e.stateDir, e.reattacher = dir, reattacher
+	e.persisted = make(map[string]*persistedStep)
+	e.mu.Unlock()
+
+	if len(steps) > 0 {
+		if err = reattacher.RestoreState(filepath.Join(dir, stageStateFile)); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warnln("cannot restore the stage state, its resources may not be destroyed")
+		}
+	}
+	for _, s := range steps {
+		e.restoreStep(ctx, s)
+	}
+	go e.saveStatePeriodically(ctx)
+	return nil
+}
+
+// restoreStep restores a step of the state left by a previous engine.
+func (e *StepExecutor) restoreStep(ctx context.Context, s *persistedStep) {
+	if s.SealedRequest != "" {
+		var err error
+		if s.Request, err = openRequest(s.SealedRequest); err != nil {
+			logrus.WithError(err).WithField("id", s.ID).Warnln("cannot open the request of the step")
+		}
+	}
+	e.mu.Lock()
+	e.persisted[s.ID] = s
+	switch {
+	case s.Result != nil:
+		e.stepStatus[s.ID] = StepStatus{Status: Complete, Restored: s.Result}
+		e.mu.Unlock()
+		return
+	case !s.Container:
+		status := StepStatus{Status: Complete, StepErr: errEngineRestarted}
+		e.stepStatus[s.ID] = status
+		s.Result = convertStatus(status)
+		e.mu.Unlock()
+		logrus.WithField("id", s.ID).Warnln("the step was running outside of a container, it cannot be re-attached")
+		if s.StatusUpdate && s.Request != nil {
+			resp := convertPollResponse(s.Result, s.Request.Envs)
+			go e.sendStepStatus(s.Request, &resp)
+		}
+		return
+	}
+	e.stepStatus[s.ID] = StepStatus{Status: Running, LogKey: s.LogKey}
+	e.inFlight++
+	e.mu.Unlock()
+
+	logrus.WithField("id", s.ID).WithField("container", s.ContainerID).Infoln("re-attaching to the container of the step")
+	if s.Request == nil {
+		go func() {
+			wr := getLogStreamWriter(&api.StartStepRequest{ID: s.ID, Name: s.Name, LogKey: s.LogKey})
+			state, err := e.reattacher.Reattach(ctx, s.ID, s.ContainerID, s.LogOffset, wr)
+			wr.Close()
+			e.finishStep(s.ID, StepStatus{Status: Complete, State: state, StepErr: err})
+		}()
+		return
+	}
+
+	// the step is executed again with its container re-attached instead of
+	// created, so its results are collected like the results of a step
+	// which was not interrupted, and it times out at its deadline.
+	r := cloneRequest(s.Request)
+	if !s.Deadline.IsZero() {
+		r.Timeout = int(math.Ceil(s.Deadline.Sub(clk.Now()).Seconds()))
+		if r.Timeout <= 0 {
+			r.Timeout = 1
+		}
+	}
+	reattach := func(ctx context.Context, _ *spec.Step, output io.Writer, _, _ bool) (*runtime.State, error) {
+		return e.reattacher.Reattach(ctx, s.ID, s.ContainerID, s.LogOffset, output)
+	}
+	tiConfig := stepTiConfig(r)
+	if tiConfig.Empty() {
+		// the stage state is not restored with the steps
+		g := ti.NewConfig(&r.TIConfig)
+		tiConfig = &g
+	}
+	go func() {
+		wr := getLogStreamWriter(r)
+		errs := &stepErrors{}
+		state, outputs, envs, artifact, outputV2, optimizationState, stepErr :=
+			executeStepHelper(withStepErrors(ctx, errs), r, reattach, wr, tiConfig)
+		status := StepStatus{Status: Complete, State: state, StepErr: stepErr, Outputs: outputs, Envs: envs,
+			Artifact: artifact, OutputV2: outputV2, OptimizationState: optimizationState, CommandStatus: getCommandStatus(r),
+			Errors: errs.list(), Annotations: getAnnotations(r), Telemetry: e.stepTelemetry(r, !checkStepSuccess(state, stepErr))}
+		sealSecretOutputs(&status, pipeline.GetState().GetOutputKey())
+		if s.StatusUpdate {
+			pollResponse := convertStatus(status)
+			if r.StageRuntimeID != "" && len(pollResponse.Envs) > 0 {
+				pipeline.GetEnvState().Add(r.StageRuntimeID, pollResponse.Envs)
+			}
+			resp := convertPollResponse(pollResponse, r.Envs)
+			e.sendStepStatus(r, &resp)
+		}
+		e.finishStep(s.ID, status)
+	}()
+}
+
+// trackStep adds the step to the persisted state, with the request of a
+// container step and its deadline so that it can be re-attached.
+func (e *StepExecutor) trackStep(r *api.StartStepRequest, statusUpdate bool) {
+	e.mu.Lock()
+	if e.stateDir == "" {
+		e.mu.Unlock()
+		return
+	}
+	s := &persistedStep{ID: r.ID, Name: r.Name, LogKey: r.LogKey, Container: r.Image != "" && !r.LogDrone,
+		StatusUpdate: statusUpdate}
+	if s.Container || statusUpdate {
+		s.Request = cloneRequest(r)
+		if r.Timeout > 0 {
+			s.Deadline = clk.Now().Add(time.Duration(r.Timeout) * time.Second)
+		}
+	}
+	e.mu.Unlock()
+	if s.Request != nil {
+		var err error
+		if s.SealedRequest, err = sealRequest(s.Request); err != nil {
+			logrus.WithError(err).WithField("id", r.ID).Warnln("cannot seal the request of the step, it is not persisted")
+		}
+	}
+	e.mu.Lock()
+	e.persisted[r.ID] = s
+	e.mu.Unlock()
+	e.saveState()
+}
+
+// sealRequest returns the request sealed with the key of the engine.
+func sealRequest(r *api.StartStepRequest) (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return sealed.SealValue(string(data))
+}
+
+// openRequest returns the request sealed by sealRequest.
+func openRequest(s string) (*api.StartStepRequest, error) {
+	data, err := sealed.OpenValue(s)
+	if err != nil {
+		return nil, err
+	}
+	r := new(api.StartStepRequest)
+	if err := json.Unmarshal([]byte(data), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// untrackStep removes the step, whose status was sent, from the persisted
+// state.
+func (e *StepExecutor) untrackStep(id string) {
+	e.mu.Lock()
+	_, ok := e.persisted[id]
+	delete(e.persisted, id)
+	e.mu.Unlock()
+	if ok {
+		e.saveState()
+	}
+}
+
+// cloneRequest returns a deep copy of the request, the request of a running
+// step is modified by its execution.
+func cloneRequest(r *api.StartStepRequest) *api.StartStepRequest {
+	c := new(api.StartStepRequest)
+	data, err := json.Marshal(r)
+	if err == nil {
+		err = json.Unmarshal(data, c)
+	}
+	if err != nil {
+		v := *r
+		return &v
+	}
+	return c
+}
+
+// ClearState removes the persisted state of the steps and the ring buffers
+// of their output once the stage is destroyed, a restarted engine has
+// nothing to restore.
+func (e *StepExecutor) ClearState() {
+	clearLogBuffers()
+	e.mu.Lock()
+	dir := e.stateDir
+	if dir != "" {
+		e.persisted = make(map[string]*persistedStep)
+	}
+	e.mu.Unlock()
+	if dir == "" {
+		return
+	}
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	for _, name := range []string{stepStateFile, stageStateFile} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warnln("cannot remove the step state")
+		}
+	}
+}
+
+func (e *StepExecutor) saveStatePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(stepStateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.saveState()
+		}
+	}
+}
+
+// Checkpoint writes the state of the steps, eg. before the engine
+// re-executes itself, and reports whether the state is kept.
+func (e *StepExecutor) Checkpoint() bool {
+	e.mu.Lock()
+	kept := e.stateDir != ""
+	e.mu.Unlock()
+	if kept {
+		e.saveState()
+	}
+	return kept
+}
+
+// saveState writes the state of the steps, with the log offsets of the
+// running steps, and the state of the stage.
+func (e *StepExecutor) saveState() {
+	e.mu.Lock()
+	if e.stateDir == "" {
+		e.mu.Unlock()
+		return
+	}
+	dir := e.stateDir
+	steps := make([]*persistedStep, 0, len(e.persisted))
+	for _, s := range e.persisted {
+		c := *s
+		if c.Result == nil && c.Container {
+			if id, offset, ok := e.reattacher.StepContainer(c.ID); ok {
+				c.ContainerID, c.LogOffset = id, offset
+			}
+		}
+		steps = append(steps, &c)
+	}
+	e.mu.Unlock()
+	sort.Slice(steps, func(i, j int) bool { return steps[i].ID < steps[j].ID })
+
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	if err := e.reattacher.SaveState(filepath.Join(dir, stageStateFile)); err != nil {
+		logrus.WithError(err).Warnln("cannot write the stage state")
+	}
+	if err := writeStepState(filepath.Join(dir, stepStateFile), steps); err != nil {
+		logrus.WithError(err).Warnln("cannot write the step state")
+	}
+}
+
+func writeStepState(path string, steps []*persistedStep) error {
+	data, err := json.Marshal(steps)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, stepStatePermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readStepState(path string) ([]*persistedStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var steps []*persistedStep
+	if err = json.Unmarshal(data, &steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/sealed"
+	"github.com/harness/lite-engine/logstream/stdout"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReattacher struct {
+	mu         sync.Mutex
+	reattached map[string]int64
+	saved      int
+	exitCode   int
+	block      string // the step blocked until its context is done
+}
+
+func (f *fakeReattacher) StepContainer(stepID string) (id string, logOffset int64, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	off, ok := f.reattached[stepID]
+	return "ctr-" + stepID, off, ok
+}
+
+func (f *fakeReattacher) Reattach(ctx context.Context, stepID, containerID string, logOffset int64, output io.Writer) (*runtime.State, error) {
+	f.mu.Lock()
+	f.reattached[stepID] = logOffset
+	block, exitCode := f.block == stepID, f.exitCode
+	f.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, _ = output.Write([]byte("done\n"))
+	return &runtime.State{Exited: true, ExitCode: exitCode}, nil
+}
+
+func (f *fakeReattacher) SaveState(string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved++
+	return nil
+}
+
+func (f *fakeReattacher) RestoreState(string) error { return nil }
+
+func TestStepExecutorPersistState(t *testing.T) {
+	pipeline.GetState().SetLogStreamClient(stdout.New())
+	t.Cleanup(func() { pipeline.GetState().SetLogStreamClient(nil) })
+
+	dir := t.TempDir()
+	require.NoError(t, writeStepState(filepath.Join(dir, stepStateFile), []*persistedStep{
+		{ID: "build", Result: &api.PollStepResponse{Exited: true, Outputs: map[string]string{"k": "v"}}},
+		{ID: "db", Container: true, ContainerID: "abc", LogOffset: 42},
+		{ID: "host"},
+	}))
+
+	f := &fakeReattacher{reattached: make(map[string]int64), exitCode: 2}
+	e := NewStepExecutor(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, e.PersistState(ctx, dir, f))
+
+	resp, err := e.PollStep(ctx, &api.PollStepRequest{ID: "build"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"k": "v"}, resp.Outputs)
+
+	resp, err = e.PollStep(ctx, &api.PollStepRequest{ID: "db"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.ExitCode)
+	assert.Equal(t, int64(42), f.reattached["db"])
+
+	resp, err = e.PollStep(ctx, &api.PollStepRequest{ID: "host"})
+	require.NoError(t, err)
+	assert.Equal(t, errEngineRestarted.Error(), resp.Error)
+
+	steps, err := readStepState(filepath.Join(dir, stepStateFile))
+	require.NoError(t, err)
+	require.Len(t, steps, 3)
+	assert.Equal(t, "db", steps[1].ID)
+	assert.Equal(t, 2, steps[1].Result.ExitCode)
+	assert.Positive(t, f.saved)
+	_, err = os.Stat(filepath.Join(dir, stepStateFile+".tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStepExecutorReattachResults(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skip("the shared volume is not available")
+	}
+	pipeline.GetState().SetLogStreamClient(stdout.New())
+	t.Cleanup(func() { pipeline.GetState().SetLogStreamClient(nil) })
+
+	outputFile := filepath.Join(pipeline.SharedVolPath, "reattached-output.env")
+	require.NoError(t, os.WriteFile(outputFile, []byte("VERSION=1.2.3\n"), 0600))
+	t.Cleanup(func() { os.Remove(outputFile) })
+
+	require.NoError(t, sealed.Configure(""))
+	dir := t.TempDir()
+	run := api.RunConfig{Command: []string{"make"}, Entrypoint: []string{"sh", "-c"}}
+	reattached, err := sealRequest(&api.StartStepRequest{
+		ID: "reattached", Kind: api.Run, Image: "alpine", Run: run, OutputVars: []string{"VERSION"}})
+	require.NoError(t, err)
+	late, err := sealRequest(&api.StartStepRequest{ID: "late", Kind: api.Run, Image: "alpine", Run: run, Timeout: 3600})
+	require.NoError(t, err)
+	require.NoError(t, writeStepState(filepath.Join(dir, stepStateFile), []*persistedStep{
+		{ID: "reattached", Container: true, ContainerID: "abc", SealedRequest: reattached},
+		// the deadline passed while the engine restarted
+		{ID: "late", Container: true, ContainerID: "def", Deadline: time.Now().Add(-time.Minute), SealedRequest: late},
+	}))
+
+	f := &fakeReattacher{reattached: make(map[string]int64), block: "late"}
+	e := NewStepExecutor(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, e.PersistState(ctx, dir, f))
+
+	resp, err := e.PollStep(ctx, &api.PollStepRequest{ID: "reattached"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, resp.ExitCode)
+	assert.Equal(t, map[string]string{"VERSION": "1.2.3"}, resp.Outputs)
+
+	resp, err = e.PollStep(ctx, &api.PollStepRequest{ID: "late"})
+	require.NoError(t, err)
+	assert.Equal(t, context.DeadlineExceeded.Error(), resp.Error)
+
+	e.ClearState()
+	_, err = os.Stat(filepath.Join(dir, stepStateFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStepExecutorTrackStep(t *testing.T) {
+	require.NoError(t, sealed.Configure(""))
+	e := NewStepExecutor(nil)
+	e.trackStep(&api.StartStepRequest{ID: "untracked"}, false)
+	assert.Empty(t, e.persisted)
+
+	dir := t.TempDir()
+	require.NoError(t, e.PersistState(context.Background(), dir, &fakeReattacher{reattached: make(map[string]int64)}))
+	e.trackStep(&api.StartStepRequest{ID: "host", Timeout: 60}, false)
+	e.trackStep(&api.StartStepRequest{ID: "ctr", Image: "alpine", Timeout: 60, Secrets: []string{"step-secret"},
+		Envs: map[string]string{"TOKEN": "step-secret"}}, true)
+	assert.Nil(t, e.persisted["host"].Request)
+	assert.True(t, e.persisted["ctr"].StatusUpdate)
+	assert.Equal(t, "ctr", e.persisted["ctr"].Request.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), e.persisted["ctr"].Deadline, 5*time.Second)
+
+	// the request is only written sealed
+	data, err := os.ReadFile(filepath.Join(dir, stepStateFile))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "step-secret")
+	steps, err := readStepState(filepath.Join(dir, stepStateFile))
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	r, err := openRequest(steps[0].SealedRequest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"step-secret"}, r.Secrets)
+
+	e.untrackStep("ctr")
+	steps, err = readStepState(filepath.Join(dir, stepStateFile))
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.Equal(t, "host", steps[0].ID)
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	terraformSummaryContext = "terraform-summary"
+	terraformFilePerm       = 0600
+)
+
+func getTerraformResultFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-terraform.json", pipeline.SharedVolPath, stepID)
+}
+
+func getTerraformPlanFile(stepID string) string {
+	return fmt.Sprintf("%s/%s.tfplan", pipeline.SharedVolPath, stepID)
+}
+
+// getTerraformAnnotationFile returns the path of the summary annotation of
+// the terraform step.
+func getTerraformAnnotationFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-terraform-summary.json", pipeline.SharedVolPath, stepID)
+}
+
+// executeTerraformStep runs the terraform command of the step as a run step
+// and parses its machine readable result into the step outputs and a
+// summary annotation. The outputs are returned even if the step failed,
+// eg. the diagnostics of an invalid configuration.
+func executeTerraformStep(ctx context.Context, f RunFunc, r *api.StartStepRequest, out io.Writer, tiConfig *tiCfg.Cfg) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	resultFile := getTerraformResultFile(r.ID)
+	annotationFile := getTerraformAnnotationFile(r.ID)
+	_ = os.Remove(resultFile)
+	_ = os.Remove(annotationFile)
+
+	if r.Terraform.Dir != "" {
+		r.WorkingDir = filepath.Join(r.WorkingDir, r.Terraform.Dir)
+	}
+	r.Run = api.RunConfig{
+		Command:    []string{getTerraformCmd(&r.Terraform, resultFile, getTerraformPlanFile(r.ID))},
+		Entrypoint: r.Terraform.Entrypoint,
+	}
+	if len(r.Run.Entrypoint) == 0 {
+		// the terraform images have terraform as their entrypoint
+		r.Run.Entrypoint = shellEntrypoint(api.ShellSh)
+	}
+
+	exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err := executeRunStep(ctx, f, r, out, tiConfig)
+
+	command := terraformCommand(&r.Terraform)
+	summary, serr := readTerraformResult(command, resultFile)
+	// the plan file is kept for the apply of a later step
+	_ = os.Remove(resultFile)
+	_ = os.Remove(resultFile + ".rc")
+	if serr != nil {
+		logrus.WithContext(ctx).WithError(serr).WithField("step", r.Name).Warnln("failed to parse the terraform result")
+		return exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err
+	}
+	if command == api.TerraformPlan {
+		summary.outputs = append(summary.outputs, [2]string{"plan_file", getTerraformPlanFile(r.ID)})
+	}
+	if outputs == nil {
+		outputs = make(map[string]string)
+	}
+	for _, kv := range summary.outputs {
+		outputs[kv[0]] = kv[1]
+		outputsV2 = append(outputsV2, &api.OutputV2{Key: kv[0], Value: kv[1], Type: api.OutputTypeString})
+	}
+	if data, merr := json.Marshal(summary.annotation); merr == nil {
+		if werr := os.WriteFile(annotationFile, data, terraformFilePerm); werr != nil {
+			logrus.WithContext(ctx).WithError(werr).WithField("step", r.Name).Warnln("failed to write the terraform summary")
+		}
+	}
+	return exited, outputs, exportEnvs, artifact, outputsV2, optimizationState, err
+}
+
+// getTerraformCmd returns the script running the terraform command and
+// writing its json result to resultFile.
+func getTerraformCmd(c *api.TerraformConfig, resultFile, planFile string) string {
+	bin := c.Binary
+	if bin == "" {
+		bin = "terraform"
+	}
+	var sb strings.Builder
+	switch terraformCommand(c) {
+	case api.TerraformValidate:
+		fmt.Fprintf(&sb, "set -e\n%s init -backend=false -input=false\n", bin)
+		fmt.Fprintf(&sb, "set +e\n%s validate -json %s > '%s'\n", bin, c.Args, resultFile)
+		fmt.Fprintf(&sb, "__harness_rc=$?\ncat '%s'\nexit $__harness_rc\n", resultFile)
+	case api.TerraformTerratest:
+		args := c.Args
+		if args == "" {
+			args = "./..."
+		}
+		// the exit code of go test is kept across the pipe to tee
+		fmt.Fprintf(&sb, "{ go test -json %s; echo $? > '%s.rc'; } | tee '%s'\n", args, resultFile, resultFile)
+		fmt.Fprintf(&sb, "exit $(cat '%s.rc')\n", resultFile)
+	default:
+		fmt.Fprintf(&sb, "set -e\n%s init -input=false\n", bin)
+		fmt.Fprintf(&sb, "%s plan -input=false -out='%s' %s\n", bin, planFile, c.Args)
+		fmt.Fprintf(&sb, "%s show -json '%s' > '%s'\n", bin, planFile, resultFile)
+	}
+	return sb.String()
+}
+
+func terraformCommand(c *api.TerraformConfig) api.TerraformCommand {
+	if c.Command == "" {
+		return api.TerraformPlan
+	}
+	return c.Command
+}
+
+// readTerraformAnnotation returns the summary annotation of the terraform
+// step, if any. The annotation is read once, its file is removed.
+func readTerraformAnnotation(stepID string) *api.Annotation {
+	path := getTerraformAnnotationFile(stepID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_ = os.Remove(path)
+	a := new(api.Annotation)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil
+	}
+	return a
+}
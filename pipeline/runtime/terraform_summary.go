@@ -0,0 +1,260 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+)
+
+const (
+	maxTerraformItems     = 50 // resources, diagnostics or failed tests listed in the annotation
+	maxTestOutputLines    = 20
+	goTestActionPass      = "pass"
+	goTestActionFail      = "fail"
+	goTestActionSkip      = "skip"
+	goTestActionOutput    = "output"
+	terraformActionCreate = "create"
+	terraformActionUpdate = "update"
+	terraformActionDelete = "delete"
+)
+
+// terraformSummary is the result of a terraform step, its outputs are
+// ordered so the step outputs are stable.
+type terraformSummary struct {
+	outputs    [][2]string
+	annotation *api.Annotation
+}
+
+// readTerraformResult parses the json result of the terraform command.
+func readTerraformResult(command api.TerraformCommand, resultFile string) (*terraformSummary, error) {
+	data, err := os.ReadFile(resultFile)
+	if err != nil {
+		return nil, err
+	}
+	switch command {
+	case api.TerraformValidate:
+		return parseTerraformValidate(data)
+	case api.TerraformTerratest:
+		return parseGoTestEvents(data), nil
+	default:
+		return parseTerraformPlan(data)
+	}
+}
+
+type terraformPlan struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// parseTerraformPlan counts the resource changes of the plan like terraform
+// does, a replaced resource is both added and destroyed.
+func parseTerraformPlan(data []byte) (*terraformSummary, error) {
+	plan := new(terraformPlan)
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, err
+	}
+	var add, change, destroy int
+	var lines []string
+	for _, rc := range plan.ResourceChanges {
+		var symbol string
+		actions := strings.Join(rc.Change.Actions, ",")
+		switch actions {
+		case terraformActionCreate:
+			add++
+			symbol = "+"
+		case terraformActionUpdate:
+			change++
+			symbol = "~"
+		case terraformActionDelete:
+			destroy++
+			symbol = "-"
+		case "delete,create", "create,delete":
+			add++
+			destroy++
+			symbol = "-/+"
+		default: // no-op and read
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("| `%s` | `%s` |", symbol, rc.Address))
+	}
+
+	style := api.AnnotationStyleSuccess
+	if add+change+destroy > 0 {
+		style = api.AnnotationStyleInfo
+	}
+	var sb strings.Builder
+	sb.WriteString("### Terraform plan\n\n")
+	sb.WriteString("| To add | To change | To destroy |\n")
+	sb.WriteString("| --- | --- | --- |\n")
+	fmt.Fprintf(&sb, "| %d | %d | %d |\n", add, change, destroy)
+	if len(lines) > 0 {
+		sb.WriteString("\n| Action | Resource |\n| --- | --- |\n")
+		writeLimited(&sb, lines)
+	}
+	return &terraformSummary{
+		outputs: [][2]string{
+			{"resources_to_add", fmt.Sprint(add)},
+			{"resources_to_change", fmt.Sprint(change)},
+			{"resources_to_destroy", fmt.Sprint(destroy)},
+			{"has_changes", fmt.Sprint(add+change+destroy > 0)},
+		},
+		annotation: &api.Annotation{Context: terraformSummaryContext, Style: style, Markdown: sb.String()},
+	}, nil
+}
+
+type terraformValidation struct {
+	Valid        bool `json:"valid"`
+	ErrorCount   int  `json:"error_count"`
+	WarningCount int  `json:"warning_count"`
+	Diagnostics  []struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+		Range    *struct {
+			Filename string `json:"filename"`
+			Start    struct {
+				Line int `json:"line"`
+			} `json:"start"`
+		} `json:"range"`
+	} `json:"diagnostics"`
+}
+
+func parseTerraformValidate(data []byte) (*terraformSummary, error) {
+	v := new(terraformValidation)
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	style := api.AnnotationStyleSuccess
+	if !v.Valid {
+		style = api.AnnotationStyleError
+	}
+	var sb strings.Builder
+	sb.WriteString("### Terraform validate\n\n")
+	sb.WriteString("| Valid | Errors | Warnings |\n")
+	sb.WriteString("| --- | --- | --- |\n")
+	fmt.Fprintf(&sb, "| %t | %d | %d |\n", v.Valid, v.ErrorCount, v.WarningCount)
+	var lines []string
+	for _, d := range v.Diagnostics {
+		line := fmt.Sprintf("- **%s**: %s", d.Severity, d.Summary)
+		if d.Range != nil {
+			line += fmt.Sprintf(" (`%s:%d`)", d.Range.Filename, d.Range.Start.Line)
+		}
+		if d.Detail != "" {
+			line += "\n  " + strings.ReplaceAll(strings.TrimSpace(d.Detail), "\n", "\n  ")
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		sb.WriteString("\n#### Diagnostics\n\n")
+		writeLimited(&sb, lines)
+	}
+	return &terraformSummary{
+		outputs: [][2]string{
+			{"valid", fmt.Sprint(v.Valid)},
+			{"error_count", fmt.Sprint(v.ErrorCount)},
+			{"warning_count", fmt.Sprint(v.WarningCount)},
+		},
+		annotation: &api.Annotation{Context: terraformSummaryContext, Style: style, Markdown: sb.String()},
+	}, nil
+}
+
+type goTestEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"`
+	Output  string  `json:"Output"`
+}
+
+// parseGoTestEvents summarizes the test2json events of go test, the lines
+// which are not events, eg. the build errors, are skipped.
+func parseGoTestEvents(data []byte) *terraformSummary {
+	results := make(map[string]string)
+	output := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		e := new(goTestEvent)
+		if json.Unmarshal(scanner.Bytes(), e) != nil || e.Test == "" {
+			continue
+		}
+		name := e.Package + "." + e.Test
+		switch e.Action {
+		case goTestActionPass, goTestActionFail, goTestActionSkip:
+			results[name] = e.Action
+		case goTestActionOutput:
+			lines := append(output[name], strings.TrimRight(e.Output, "\n"))
+			if len(lines) > maxTestOutputLines {
+				lines = lines[1:]
+			}
+			output[name] = lines
+		}
+	}
+
+	var passed, failed, skipped int
+	var failures []string
+	for name, result := range results {
+		switch result {
+		case goTestActionPass:
+			passed++
+		case goTestActionFail:
+			failed++
+			failures = append(failures, name)
+		default:
+			skipped++
+		}
+	}
+	sort.Strings(failures)
+
+	style := api.AnnotationStyleSuccess
+	if failed > 0 {
+		style = api.AnnotationStyleError
+	}
+	var sb strings.Builder
+	sb.WriteString("### Terraform tests\n\n")
+	sb.WriteString("| Total | Passed | Failed | Skipped |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	fmt.Fprintf(&sb, "| %d | %d | %d | %d |\n", len(results), passed, failed, skipped)
+	if len(failures) > 0 {
+		var lines []string
+		for _, name := range failures {
+			lines = append(lines, fmt.Sprintf("- **%s**\n  ```\n  %s\n  ```", name, strings.Join(output[name], "\n  ")))
+		}
+		sb.WriteString("\n#### Failures\n\n")
+		writeLimited(&sb, lines)
+	}
+	return &terraformSummary{
+		outputs: [][2]string{
+			{"total_tests", fmt.Sprint(len(results))},
+			{"successful_tests", fmt.Sprint(passed)},
+			{"failed_tests", fmt.Sprint(failed)},
+			{"skipped_tests", fmt.Sprint(skipped)},
+		},
+		annotation: &api.Annotation{Context: terraformSummaryContext, Style: style, Markdown: sb.String()},
+	}
+}
+
+// writeLimited writes the lines, at most maxTerraformItems of them.
+func writeLimited(sb *strings.Builder, lines []string) {
+	for i, line := range lines {
+		if i == maxTerraformItems {
+			fmt.Fprintf(sb, "\n_and %d more_\n", len(lines)-maxTerraformItems)
+			return
+		}
+		sb.WriteString(line + "\n")
+	}
+}
@@ -0,0 +1,70 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func summaryOutputs(s *terraformSummary) map[string]string {
+	outputs := make(map[string]string)
+	for _, kv := range s.outputs {
+		outputs[kv[0]] = kv[1]
+	}
+	return outputs
+}
+
+func TestReadTerraformResult_Plan(t *testing.T) {
+	s, err := readTerraformResult(api.TerraformPlan, "testdata/terraform/plan.json")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"resources_to_add":     "2",
+		"resources_to_change":  "1",
+		"resources_to_destroy": "2",
+		"has_changes":          "true",
+	}, summaryOutputs(s))
+	assert.Equal(t, api.AnnotationStyleInfo, s.annotation.Style)
+	assert.Contains(t, s.annotation.Markdown, "| `-/+` | `aws_instance.db` |")
+	assert.NotContains(t, s.annotation.Markdown, "aws_vpc.main")
+}
+
+func TestReadTerraformResult_Validate(t *testing.T) {
+	s, err := readTerraformResult(api.TerraformValidate, "testdata/terraform/validate.json")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"valid":         "false",
+		"error_count":   "1",
+		"warning_count": "1",
+	}, summaryOutputs(s))
+	assert.Equal(t, api.AnnotationStyleError, s.annotation.Style)
+	assert.Contains(t, s.annotation.Markdown, "Unsupported argument (`main.tf:12`)")
+}
+
+func TestReadTerraformResult_Terratest(t *testing.T) {
+	s, err := readTerraformResult(api.TerraformTerratest, "testdata/terraform/terratest.json")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"total_tests":      "3",
+		"successful_tests": "1",
+		"failed_tests":     "1",
+		"skipped_tests":    "1",
+	}, summaryOutputs(s))
+	assert.Equal(t, api.AnnotationStyleError, s.annotation.Style)
+	assert.Contains(t, s.annotation.Markdown, "example/test.TestInstance")
+	assert.Contains(t, s.annotation.Markdown, "instance is not running")
+}
+
+func TestGetTerraformCmd(t *testing.T) {
+	cmd := getTerraformCmd(&api.TerraformConfig{Args: "-var-file=prod.tfvars"}, "/tmp/result.json", "/tmp/step.tfplan")
+	assert.Contains(t, cmd, "terraform plan -input=false -out='/tmp/step.tfplan' -var-file=prod.tfvars")
+	assert.Contains(t, cmd, "terraform show -json '/tmp/step.tfplan' > '/tmp/result.json'")
+
+	cmd = getTerraformCmd(&api.TerraformConfig{Command: api.TerraformValidate, Binary: "tofu"}, "/tmp/result.json", "")
+	assert.True(t, strings.HasPrefix(cmd, "set -e\ntofu init -backend=false"))
+	assert.Contains(t, cmd, "tofu validate -json")
+
+	cmd = getTerraformCmd(&api.TerraformConfig{Command: api.TerraformTerratest}, "/tmp/result.json", "")
+	assert.Contains(t, cmd, "go test -json ./...")
+}
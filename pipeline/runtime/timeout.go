@@ -0,0 +1,133 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/internal/clock"
+	"github.com/sirupsen/logrus"
+)
+
+// timeoutBudget splits the step timeout between the execution of the
+// command and the post-processing of its output, eg. the report parsing
+// and the call graph upload. The execution is bound to the step timeout
+// and the post-processing is canceled once its own budget elapsed after
+// the execution completed.
+type timeoutBudget struct {
+	deadline       time.Time
+	postProcessing time.Duration
+	cancel         context.CancelFunc
+
+	mu       sync.Mutex
+	timer    clock.Timer
+	timedOut bool
+	overran  bool
+}
+
+func newTimeoutBudget(r *api.StartStepRequest, cancel context.CancelFunc) *timeoutBudget {
+	return &timeoutBudget{
+		deadline:       clk.Now().Add(time.Second * time.Duration(r.Timeout)),
+		postProcessing: time.Second * time.Duration(r.PostProcessingTimeout),
+		cancel:         cancel,
+	}
+}
+
+// wrap returns the run function executing the command within the step timeout.
+func (b *timeoutBudget) wrap(f RunFunc) RunFunc {
+	return func(ctx context.Context, step *spec.Step, output io.Writer, isDrone, isHosted bool) (*runtime.State, error) {
+		b.mu.Lock()
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		b.mu.Unlock()
+
+		execCtx, cancel := withStepDeadline(ctx, b.deadline)
+		defer cancel()
+		exited, err := f(execCtx, step, output, isDrone, isHosted)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if execCtx.Err() == context.DeadlineExceeded {
+			b.timedOut = true
+		}
+		b.timer = clk.AfterFunc(b.postProcessing, func() {
+			b.mu.Lock()
+			b.overran = true
+			b.mu.Unlock()
+			b.cancel()
+		})
+		return exited, err
+	}
+}
+
+type timeoutBudgetKey struct{}
+
+// withTimeoutBudget returns the context of the post-processing of the step,
+// canceled by b once the post-processing budget elapsed.
+func withTimeoutBudget(ctx context.Context, b *timeoutBudget) context.Context {
+	return context.WithValue(ctx, timeoutBudgetKey{}, b)
+}
+
+// postProcessingError returns err, or nil if the post-processing of the
+// step overran its budget. The overrun is recorded as a warning by
+// timeoutError once the step completed, it does not fail the step.
+func postProcessingError(ctx context.Context, err error) error {
+	b, _ := ctx.Value(timeoutBudgetKey{}).(*timeoutBudget)
+	if err == nil || b == nil {
+		return err
+	}
+	b.mu.Lock()
+	overran := b.overran
+	b.mu.Unlock()
+	if !overran {
+		return err
+	}
+	logrus.WithContext(ctx).WithError(err).Warnln("post-processing of the step output canceled")
+	return nil
+}
+
+func (b *timeoutBudget) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// timeoutError returns the error of a step which timed out. If the step
+// has a post-processing budget, only the execution of the command can
+// time out the step, an overrun of the post-processing is recorded as a
+// warning.
+func timeoutError(ctx context.Context, r *api.StartStepRequest, b *timeoutBudget) error {
+	if b == nil {
+		switch ctx.Err() {
+		case context.Canceled, context.DeadlineExceeded:
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	b.mu.Lock()
+	timedOut, overran := b.timedOut, b.overran
+	b.mu.Unlock()
+	if timedOut {
+		return context.DeadlineExceeded
+	}
+	if overran {
+		err := fmt.Errorf("post-processing exceeded its timeout of %s", b.postProcessing)
+		logrus.WithContext(ctx).WithField("id", r.ID).WithError(err).
+			Warnln("post-processing of the step output canceled")
+		recordStepError(ctx, withStage(api.StepErrorStagePostProcessing, true, err))
+	}
+	return nil
+}
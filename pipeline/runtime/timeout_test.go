@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutBudget(t *testing.T) {
+	sleep := func(d time.Duration) RunFunc {
+		return func(ctx context.Context, _ *spec.Step, _ io.Writer, _, _ bool) (*runtime.State, error) {
+			select {
+			case <-time.After(d):
+				return &runtime.State{Exited: true}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	r := &api.StartStepRequest{ID: "step1"}
+
+	// post-processing overrun is a warning
+	errs := &stepErrors{}
+	ctx, cancel := context.WithCancel(withStepErrors(context.Background(), errs))
+	b := &timeoutBudget{deadline: time.Now().Add(time.Second), postProcessing: 10 * time.Millisecond, cancel: cancel}
+	_, err := b.wrap(sleep(time.Millisecond))(ctx, &spec.Step{}, io.Discard, false, false)
+	assert.Nil(t, err)
+	<-ctx.Done()
+	assert.Nil(t, timeoutError(ctx, r, b))
+	if assert.Len(t, errs.list(), 1) {
+		assert.Equal(t, api.StepErrorStagePostProcessing, errs.list()[0].Stage)
+	}
+
+	// execution overrun times out the step
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	b = &timeoutBudget{deadline: time.Now().Add(10 * time.Millisecond), postProcessing: time.Minute, cancel: cancel}
+	_, err = b.wrap(sleep(time.Minute))(ctx, &spec.Step{}, io.Discard, false, false)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, ctx.Err())
+	assert.ErrorIs(t, timeoutError(ctx, r, b), context.DeadlineExceeded)
+	b.stop()
+
+	// without a budget the step context decides
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, timeoutError(ctx, r, nil), context.DeadlineExceeded)
+}
+
+func TestTimeoutBudgetFakeClock(t *testing.T) {
+	fake := useFakeClock(t)
+	block := func(ctx context.Context, _ *spec.Step, _ io.Writer, _, _ bool) (*runtime.State, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	exit := func(context.Context, *spec.Step, io.Writer, bool, bool) (*runtime.State, error) {
+		return &runtime.State{Exited: true}, nil
+	}
+	r := &api.StartStepRequest{ID: "step1", Timeout: 600, PostProcessingTimeout: 60}
+
+	// the execution times out the step at the step timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newTimeoutBudget(r, cancel)
+	done := make(chan error)
+	go func() {
+		_, err := b.wrap(block)(ctx, &spec.Step{}, io.Discard, false, false)
+		done <- err
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(599 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("the step timed out before its timeout")
+	default:
+	}
+	fake.Advance(time.Second)
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.ErrorIs(t, timeoutError(ctx, r, b), context.DeadlineExceeded)
+	b.stop()
+
+	// the post-processing within its budget is not canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	b = newTimeoutBudget(r, cancel)
+	_, err := b.wrap(exit)(ctx, &spec.Step{}, io.Discard, false, false)
+	assert.NoError(t, err)
+	fake.Advance(59 * time.Second)
+	b.stop()
+	fake.Advance(time.Hour)
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, timeoutError(ctx, r, b))
+
+	// the post-processing is canceled once its budget elapsed
+	errs := &stepErrors{}
+	ctx, cancel = context.WithCancel(withStepErrors(context.Background(), errs))
+	defer cancel()
+	b = newTimeoutBudget(r, cancel)
+	_, err = b.wrap(exit)(ctx, &spec.Step{}, io.Discard, false, false)
+	assert.NoError(t, err)
+	fake.Advance(time.Minute)
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Nil(t, timeoutError(ctx, r, b))
+	if assert.Len(t, errs.list(), 1) {
+		assert.Equal(t, api.StepErrorStagePostProcessing, errs.list()[0].Stage)
+	}
+}
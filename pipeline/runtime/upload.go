@@ -0,0 +1,132 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/ti/report"
+	"github.com/mattn/go-zglob"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	artifactFilePerm   = 0600
+	defaultContentType = "application/octet-stream"
+)
+
+// executeUploadStep uploads the files of the working directory matching the
+// paths of the step to its storage, and sets their links as the artifact of
+// the step. The paths matching no file are logged, the failed uploads fail
+// the step.
+func executeUploadStep(ctx context.Context, r *api.StartStepRequest, out io.Writer) ( //nolint:gocritic
+	*runtime.State, map[string]string, map[string]string, []byte, []*api.OutputV2, string, error) {
+	log := logrus.New()
+	log.Out = out
+	cfg := &r.Upload
+
+	store, err := objstore.New(&cfg.Storage)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	files, err := uploadFiles(r.WorkingDir, cfg.Paths)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	if len(files) == 0 {
+		log.Warnln("no file matches the upload paths")
+		return &runtime.State{Exited: true}, nil, nil, nil, nil, "", nil
+	}
+
+	artifacts := make([]report.FileArtifact, 0, len(files))
+	for _, rel := range files {
+		name := path.Join(cfg.Target, rel)
+		if err = uploadFile(ctx, store, name, filepath.Join(r.WorkingDir, filepath.FromSlash(rel))); err != nil {
+			return nil, nil, nil, nil, nil, "", fmt.Errorf("cannot upload %s: %w", rel, err)
+		}
+		log.Infof("Uploaded %s", rel)
+		artifacts = append(artifacts, report.FileArtifact{Name: rel, URL: store.URL(name)})
+	}
+	log.Infof("Uploaded %d files", len(artifacts))
+
+	artifact, err := addFileArtifacts(r.ID, artifacts, out)
+	if err != nil {
+		return nil, nil, nil, nil, nil, "", err
+	}
+	return &runtime.State{Exited: true}, nil, nil, artifact, nil, "", nil
+}
+
+// addFileArtifacts adds the uploaded files to the artifact of the step and
+// returns it.
+func addFileArtifacts(stepID string, artifacts []report.FileArtifact, out io.Writer) ([]byte, error) {
+	artifactFile := fmt.Sprintf("%s/%s-artifact", pipeline.SharedVolPath, stepID)
+	artifact, _ := os.ReadFile(artifactFile)
+	if err := os.WriteFile(artifactFile, report.MergeFileArtifacts(artifact, artifacts), artifactFilePerm); err != nil {
+		return nil, err
+	}
+	return fetchArtifactDataFromArtifactFile(artifactFile, out)
+}
+
+// uploadFiles returns the sorted slash separated paths, relative to the
+// directory, of the regular files matching the globs. The files resolving
+// outside of the directory are skipped.
+func uploadFiles(dir string, globs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, g := range globs {
+		matches, err := zglob.Glob(filepath.Join(dir, g))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, m := range matches {
+			resolved, err := safepath.Confine(m, dir)
+			if err != nil {
+				continue
+			}
+			if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				continue
+			}
+			if rel = filepath.ToSlash(rel); !seen[rel] {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func uploadFile(ctx context.Context, store objstore.Store, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	return store.Put(ctx, name, f, info.Size(), contentType)
+}
@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteUploadStep(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	storage := t.TempDir()
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "reports", "unit"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "reports", "unit", "index.html"), []byte("<html>"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "reports", "coverage.out"), []byte("mode: set"), 0o600))
+
+	r := &api.StartStepRequest{ID: "upload-test", Kind: api.Upload, WorkingDir: src, Upload: api.UploadConfig{
+		Paths:   []string{"reports/**/*.html", "reports/*.out", "missing/*"},
+		Target:  "builds/42",
+		Storage: api.Storage{Kind: api.StorageLocal, Path: storage},
+	}}
+	defer os.Remove(filepath.Join(pipeline.SharedVolPath, "upload-test-artifact"))
+	state, _, _, artifact, _, _, err := executeUploadStep(context.Background(), r, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, 0, state.ExitCode)
+	assert.JSONEq(t, `{"kind":"fileUpload/v1","data":{"fileArtifacts":[
+		{"name":"reports/coverage.out","url":"`+filepath.Join(storage, "builds/42/reports/coverage.out")+`"},
+		{"name":"reports/unit/index.html","url":"`+filepath.Join(storage, "builds/42/reports/unit/index.html")+`"}]}}`, string(artifact))
+	data, err := os.ReadFile(filepath.Join(storage, "builds", "42", "reports", "unit", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<html>", string(data))
+}
+
+func TestUploadFiles(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("s"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "link")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "b.txt"), 0o755))
+
+	files, err := uploadFiles(dir, []string{"*", "a.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, files)
+}
@@ -0,0 +1,318 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/audit"
+	"github.com/harness/lite-engine/cache"
+	"github.com/harness/lite-engine/checkpoint"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/errors"
+	"github.com/harness/lite-engine/internal/charset"
+	"github.com/harness/lite-engine/internal/fileperm"
+	"github.com/harness/lite-engine/internal/objstore"
+	"github.com/harness/lite-engine/internal/tarball"
+	"github.com/harness/lite-engine/registry"
+)
+
+// packagePattern matches the packages of the instrumentation lists, eg.
+// com.acme.billing or Acme.Billing.*, which are joined with commas in the
+// config of the agents.
+var packagePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.*]*$`)
+
+// capabilityPattern matches the linux capabilities with or without their
+// CAP_ prefix, eg. NET_ADMIN, and ALL.
+var capabilityPattern = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+// validateStartStepRequest normalizes the step request and checks it for
+// combinations which can never execute successfully. All the issues found
+// are returned together as a single bad request error.
+func validateStartStepRequest(r *api.StartStepRequest) error {
+	var issues []string
+	if r.Timeout < 0 {
+		issues = append(issues, fmt.Sprintf("timeout cannot be negative: %d", r.Timeout))
+	}
+
+	hasOutputs := len(r.OutputVars) > 0 || len(r.Outputs) > 0
+	if hasOutputs && r.Detach {
+		issues = append(issues, "output variables cannot be set for a detached step")
+	}
+
+	if r.HostUser && r.User != "" {
+		issues = append(issues, "user and host_user cannot both be set")
+	}
+
+	if r.Clock != nil && r.Clock.Timezone != "" {
+		if _, err := time.LoadLocation(r.Clock.Timezone); err != nil {
+			issues = append(issues, fmt.Sprintf("invalid timezone %q", r.Clock.Timezone))
+		}
+	}
+
+	if r.Umask != "" {
+		if _, err := fileperm.Parse(r.Umask); err != nil {
+			issues = append(issues, err.Error())
+		}
+	}
+
+	if name := r.Envs[charset.Env]; name != "" {
+		if _, err := charset.Lookup(name); err != nil {
+			issues = append(issues, fmt.Sprintf("%s: %s", charset.Env, err))
+		}
+	}
+
+	if r.WorkspaceClone && r.Kind != api.Run {
+		issues = append(issues, "workspace_clone is only supported for run steps")
+	}
+
+	if r.WarmContainer != "" {
+		switch {
+		case r.Kind != api.RunTest && r.Kind != api.RunTestsV2:
+			issues = append(issues, "warm_container is only supported for run test steps")
+		case r.Image == "":
+			issues = append(issues, "warm_container is only supported for container steps")
+		case r.Detach || r.WorkspaceClone || r.IsolatedHome:
+			issues = append(issues, "warm_container cannot be set for detached steps or with workspace_clone or isolated_home")
+		}
+	}
+
+	if r.SecurityContext != nil {
+		issues = append(issues, validateSecurityContext(r)...)
+	}
+
+	if r.GPUs != nil {
+		issues = append(issues, validateGPUs(r)...)
+	}
+
+	if p := r.Platform; p != nil {
+		switch {
+		case r.Image == "":
+			issues = append(issues, "platform is only supported for container steps")
+		case p.OS == "" || p.Arch == "":
+			issues = append(issues, "platform os and arch need to be set")
+		}
+	}
+
+	switch r.Isolation {
+	case "", spec.IsolationDefault, spec.IsolationProcess, spec.IsolationHyperV, spec.IsolationHostProcess:
+		if r.Isolation != "" && r.Image == "" {
+			issues = append(issues, "isolation is only supported for container steps")
+		}
+	default:
+		issues = append(issues, fmt.Sprintf("unsupported isolation %q", r.Isolation))
+	}
+
+	if r.OCIRuntime != "" && r.Image == "" {
+		issues = append(issues, "oci_runtime is only supported for container steps")
+	}
+
+	if r.Readiness != nil {
+		if !r.Detach {
+			issues = append(issues, "readiness is only supported for detached steps")
+		}
+		issues = append(issues, validateReadinessProbe(r.Readiness)...)
+	}
+
+	if r.Checkpoint != nil {
+		switch {
+		case r.Kind != api.Run:
+			issues = append(issues, "checkpoint is only supported for run steps")
+		case r.WorkspaceClone:
+			issues = append(issues, "checkpoint and workspace_clone cannot both be set")
+		}
+		issues = append(issues, checkpoint.Validate(r.Checkpoint)...)
+	}
+
+	switch r.Kind {
+	case api.Run:
+		issues = append(issues, validateRunConfig(&r.Run, r.Image, hasOutputs)...)
+	case api.RunTest:
+		if hasOutputs && len(r.RunTest.Entrypoint) == 0 {
+			issues = append(issues, "output variables cannot be set for unset entrypoint")
+		}
+	case api.RunTestsV2:
+		if len(r.RunTestsV2.Command) == 0 {
+			issues = append(issues, "command needs to be set for run tests step")
+		}
+		if hasOutputs && len(r.RunTestsV2.Entrypoint) == 0 {
+			issues = append(issues, "output variables cannot be set for unset entrypoint")
+		}
+		for _, p := range append(append([]string{}, r.RunTestsV2.InstrPackages...), r.RunTestsV2.ExcludePackages...) {
+			if !packagePattern.MatchString(p) {
+				issues = append(issues, fmt.Sprintf("invalid instrumentation package %q", p))
+			}
+		}
+	case api.CacheRestore, api.CacheSave:
+		if r.Image != "" {
+			issues = append(issues, "cache steps run in the engine, image cannot be set")
+		}
+		issues = append(issues, cache.Validate(&r.Cache, r.Kind == api.CacheSave)...)
+	case api.Upload:
+		issues = append(issues, validateUploadConfig(&r.Upload, r.Image)...)
+	case api.Audit:
+		if r.Image != "" {
+			issues = append(issues, "audit steps run in the engine, image cannot be set")
+		}
+		issues = append(issues, audit.Validate(&r.Audit)...)
+		if r.Audit.Target != "" && !tarball.Local(r.Audit.Target) {
+			issues = append(issues, fmt.Sprintf("audit target %q needs to be a relative path", r.Audit.Target))
+		}
+		if r.Audit.Storage != nil {
+			issues = append(issues, objstore.Validate(r.Audit.Storage, "audit storage")...)
+		}
+	case api.ImageOp:
+		if r.Image != "" {
+			issues = append(issues, "image_op steps run in the engine, image cannot be set")
+		}
+		issues = append(issues, registry.ValidateOp(&r.ImageOp)...)
+	case api.Terraform:
+		switch r.Terraform.Command {
+		case "", api.TerraformValidate, api.TerraformPlan, api.TerraformTerratest:
+		default:
+			issues = append(issues, fmt.Sprintf("unsupported terraform command %q", r.Terraform.Command))
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return &errors.BadRequestError{Msg: "invalid step request", Issues: issues}
+}
+
+func validateReadinessProbe(p *api.ReadinessProbe) []string {
+	var issues []string
+	n := 0
+	if p.TCP != nil {
+		n++
+		issues = append(issues, validateProbePort(p.TCP.Port)...)
+	}
+	if p.HTTP != nil {
+		n++
+		issues = append(issues, validateProbePort(p.HTTP.Port)...)
+		if p.HTTP.Scheme != "" && p.HTTP.Scheme != "http" && p.HTTP.Scheme != "https" {
+			issues = append(issues, fmt.Sprintf("unsupported readiness scheme %q", p.HTTP.Scheme))
+		}
+	}
+	if len(p.Command) > 0 {
+		n++
+	}
+	if n != 1 {
+		issues = append(issues, "readiness needs one of tcp, http or command")
+	}
+	if p.Interval < 0 || p.Timeout < 0 {
+		issues = append(issues, "readiness interval and timeout cannot be negative")
+	}
+	return issues
+}
+
+func validateProbePort(port int) []string {
+	if port < 1 || port > 65535 {
+		return []string{fmt.Sprintf("invalid readiness port %d", port)}
+	}
+	return nil
+}
+
+func validateSecurityContext(r *api.StartStepRequest) []string {
+	var issues []string
+	if r.Image == "" {
+		issues = append(issues, "security_context is only supported for container steps")
+	}
+	if r.Privileged {
+		issues = append(issues, "security_context cannot be set for privileged steps")
+	}
+	for _, c := range append(append([]string{}, r.SecurityContext.CapAdd...), r.SecurityContext.CapDrop...) {
+		if !capabilityPattern.MatchString(c) {
+			issues = append(issues, fmt.Sprintf("invalid capability %q", c))
+		}
+	}
+	for _, p := range []string{r.SecurityContext.Seccomp, r.SecurityContext.AppArmor} {
+		if strings.ContainsAny(p, " \t\n,") {
+			issues = append(issues, fmt.Sprintf("invalid security profile %q", p))
+		}
+	}
+	return issues
+}
+
+func validateGPUs(r *api.StartStepRequest) []string {
+	var issues []string
+	if r.Image == "" {
+		issues = append(issues, "gpus are only supported for container steps")
+	}
+	switch {
+	case r.GPUs.Count < spec.GPUCountAll:
+		issues = append(issues, fmt.Sprintf("invalid gpu count %d", r.GPUs.Count))
+	case r.GPUs.Count != 0 && len(r.GPUs.DeviceIDs) > 0:
+		issues = append(issues, "gpu count and device_ids cannot be both set")
+	case r.GPUs.Count == 0 && len(r.GPUs.DeviceIDs) == 0:
+		issues = append(issues, "gpu count or device_ids need to be set")
+	}
+	return issues
+}
+
+func validateUploadConfig(c *api.UploadConfig, image string) []string {
+	var issues []string
+	if image != "" {
+		issues = append(issues, "upload steps run in the engine, image cannot be set")
+	}
+	if len(c.Paths) == 0 {
+		issues = append(issues, "upload paths need to be set")
+	}
+	for _, p := range c.Paths {
+		if !tarball.Local(p) {
+			issues = append(issues, fmt.Sprintf("upload path %q needs to be relative to the working directory", p))
+		}
+	}
+	if c.Target != "" && !tarball.Local(c.Target) {
+		issues = append(issues, fmt.Sprintf("upload target %q needs to be a relative path", c.Target))
+	}
+	return append(issues, objstore.Validate(&c.Storage, "upload storage")...)
+}
+
+func validateRunConfig(c *api.RunConfig, image string, hasOutputs bool) []string {
+	var issues []string
+
+	c.Shell = api.Shell(strings.ToLower(strings.TrimSpace(string(c.Shell))))
+	switch c.Shell {
+	case "", api.ShellSh, api.ShellBash, api.ShellPwsh, api.ShellPowershell, api.ShellCmd, api.ShellPython:
+	default:
+		issues = append(issues, fmt.Sprintf("unsupported shell %q", c.Shell))
+	}
+
+	if c.Shell != "" && len(c.Entrypoint) > 0 {
+		if inferred := resolveShell("", c.Entrypoint); inferred != c.Shell {
+			issues = append(issues, fmt.Sprintf("shell %q conflicts with entrypoint %q", c.Shell, c.Entrypoint[0]))
+		}
+	}
+
+	if len(c.Sequence) > 0 {
+		if len(c.Command) > 0 {
+			issues = append(issues, "command and sequence cannot both be set")
+		}
+		if shell := resolveShell(c.Shell, c.Entrypoint); shell != api.ShellSh && shell != api.ShellBash {
+			issues = append(issues, fmt.Sprintf("sequence is not supported for shell %q", shell))
+		}
+		for i, cmd := range c.Sequence {
+			if cmd == nil || strings.TrimSpace(cmd.Command) == "" {
+				issues = append(issues, fmt.Sprintf("command %d of the sequence is empty", i))
+			}
+		}
+	}
+
+	hasEntrypoint := len(c.Entrypoint) > 0 || c.Shell != "" || len(c.Sequence) > 0
+	hasCommand := len(c.Command) > 0 || len(c.Sequence) > 0
+	if hasOutputs && (!hasEntrypoint || !hasCommand) {
+		issues = append(issues, "output variables cannot be set for unset entrypoint or command")
+	}
+	// steps running directly on the host have no image entrypoint to fall back to.
+	if image == "" && !hasEntrypoint {
+		issues = append(issues, "entrypoint or shell needs to be set for a step running on the host")
+	}
+	return issues
+}
@@ -0,0 +1,316 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/engine/spec"
+	"github.com/harness/lite-engine/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStartStepRequest(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Request api.StartStepRequest
+		Issues  []string
+	}{
+		{
+			Name: "valid_container_step",
+			Request: api.StartStepRequest{
+				Image:      "alpine",
+				OutputVars: []string{"foo"},
+				Run:        api.RunConfig{Command: []string{"echo hi"}, Entrypoint: []string{"sh", "-c"}},
+			},
+		},
+		{
+			Name: "valid_host_step_with_shell",
+			Request: api.StartStepRequest{
+				Outputs: []*api.OutputV2{{Key: "foo", Value: "FOO"}},
+				Run:     api.RunConfig{Command: []string{"echo hi"}, Shell: "Bash"},
+			},
+		},
+		{
+			Name: "outputs_with_empty_command_and_detach",
+			Request: api.StartStepRequest{
+				Image:      "alpine",
+				Detach:     true,
+				OutputVars: []string{"foo"},
+				Run:        api.RunConfig{Entrypoint: []string{"sh", "-c"}},
+			},
+			Issues: []string{
+				"output variables cannot be set for a detached step",
+				"output variables cannot be set for unset entrypoint or command",
+			},
+		},
+		{
+			Name: "shell_conflicts_with_entrypoint",
+			Request: api.StartStepRequest{
+				Run: api.RunConfig{Command: []string{"echo hi"}, Entrypoint: []string{"pwsh", "-Command"}, Shell: api.ShellBash},
+			},
+			Issues: []string{`shell "bash" conflicts with entrypoint "pwsh"`},
+		},
+		{
+			Name: "unknown_shell_and_negative_timeout",
+			Request: api.StartStepRequest{
+				Timeout: -1,
+				Run:     api.RunConfig{Command: []string{"echo hi"}, Shell: "zsh"},
+			},
+			Issues: []string{"timeout cannot be negative: -1", `unsupported shell "zsh"`},
+		},
+		{
+			Name: "host_step_without_entrypoint",
+			Request: api.StartStepRequest{
+				Run: api.RunConfig{Command: []string{"echo hi"}},
+			},
+			Issues: []string{"entrypoint or shell needs to be set for a step running on the host"},
+		},
+		{
+			Name: "invalid_timezone",
+			Request: api.StartStepRequest{
+				Image: "alpine",
+				Clock: &spec.Clock{Timezone: "../etc/passwd"},
+				Run:   api.RunConfig{Command: []string{"date"}},
+			},
+			Issues: []string{`invalid timezone "../etc/passwd"`},
+		},
+		{
+			Name: "invalid_umask",
+			Request: api.StartStepRequest{
+				Image: "alpine",
+				Umask: "0099",
+				Run:   api.RunConfig{Command: []string{"touch a"}},
+			},
+			Issues: []string{`invalid umask "0099"`},
+		},
+		{
+			Name: "invalid_charset",
+			Request: api.StartStepRequest{
+				Image: "alpine",
+				Envs:  map[string]string{"HARNESS_OUTPUT_CHARSET": "klingon"},
+				Run:   api.RunConfig{Command: []string{"date"}},
+			},
+			Issues: []string{`HARNESS_OUTPUT_CHARSET: unknown charset "klingon"`},
+		},
+		{
+			Name: "invalid_instrumentation_package",
+			Request: api.StartStepRequest{
+				Kind: api.RunTestsV2,
+				RunTestsV2: api.RunTestsV2Config{
+					Command:         []string{"mvn test"},
+					InstrPackages:   []string{"com.acme.billing", "Acme.Billing.*"},
+					ExcludePackages: []string{"com.acme,com.other"},
+				},
+			},
+			Issues: []string{`invalid instrumentation package "com.acme,com.other"`},
+		},
+		{
+			Name: "workspace_clone_of_run_test",
+			Request: api.StartStepRequest{
+				Kind:           api.RunTest,
+				WorkspaceClone: true,
+			},
+			Issues: []string{"workspace_clone is only supported for run steps"},
+		},
+		{
+			Name: "warm_container_of_run",
+			Request: api.StartStepRequest{
+				Kind:          api.Run,
+				Image:         "gradle:8",
+				WarmContainer: "gradle",
+				Run:           api.RunConfig{Command: []string{"gradle test"}},
+			},
+			Issues: []string{"warm_container is only supported for run test steps"},
+		},
+		{
+			Name: "warm_container_on_host",
+			Request: api.StartStepRequest{
+				Kind:          api.RunTest,
+				WarmContainer: "gradle",
+			},
+			Issues: []string{"warm_container is only supported for container steps"},
+		},
+		{
+			Name: "warm_container_with_isolated_home",
+			Request: api.StartStepRequest{
+				Kind:          api.RunTest,
+				Image:         "gradle:8",
+				WarmContainer: "gradle",
+				IsolatedHome:  true,
+			},
+			Issues: []string{"warm_container cannot be set for detached steps or with workspace_clone or isolated_home"},
+		},
+		{
+			Name: "audit_with_image",
+			Request: api.StartStepRequest{
+				Kind:  api.Audit,
+				Image: "alpine",
+				Audit: api.AuditConfig{FailOn: "severe"},
+			},
+			Issues: []string{"audit steps run in the engine, image cannot be set", `unsupported audit severity "severe"`},
+		},
+		{
+			Name: "image_op_with_image",
+			Request: api.StartStepRequest{
+				Kind:    api.ImageOp,
+				Image:   "alpine",
+				ImageOp: api.ImageOpConfig{Operation: api.ImageTag, Source: "registry.example.com/app:1.0"},
+			},
+			Issues: []string{"image_op steps run in the engine, image cannot be set", "image_op targets need to be set to tag an image"},
+		},
+		{
+			Name: "security_context_of_privileged_host_step",
+			Request: api.StartStepRequest{
+				Kind:            api.Run,
+				Privileged:      true,
+				Run:             api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh},
+				SecurityContext: &spec.SecurityContext{CapDrop: []string{"ALL", "NET-RAW"}, Seccomp: "a b"},
+			},
+			Issues: []string{"security_context is only supported for container steps",
+				"security_context cannot be set for privileged steps", `invalid capability "NET-RAW"`, `invalid security profile "a b"`},
+		},
+		{
+			Name: "gpus_of_host_step",
+			Request: api.StartStepRequest{
+				Kind: api.Run,
+				Run:  api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh},
+				GPUs: &spec.GPUs{Count: 1, DeviceIDs: []string{"0"}},
+			},
+			Issues: []string{"gpus are only supported for container steps", "gpu count and device_ids cannot be both set"},
+		},
+		{
+			Name: "gpus_without_count",
+			Request: api.StartStepRequest{
+				Kind:  api.Run,
+				Image: "pytorch/pytorch",
+				Run:   api.RunConfig{Command: []string{"pytest"}},
+				GPUs:  &spec.GPUs{Driver: "nvidia"},
+			},
+			Issues: []string{"gpu count or device_ids need to be set"},
+		},
+		{
+			Name: "isolation_of_host_step",
+			Request: api.StartStepRequest{
+				Kind:      api.Run,
+				Run:       api.RunConfig{Command: []string{"make"}, Shell: api.ShellSh},
+				Isolation: spec.IsolationProcess,
+			},
+			Issues: []string{"isolation is only supported for container steps"},
+		},
+		{
+			Name: "platform_without_arch",
+			Request: api.StartStepRequest{
+				Kind:     api.Run,
+				Image:    "golang",
+				Run:      api.RunConfig{Command: []string{"go test ./..."}},
+				Platform: &spec.Platform{OS: "linux"},
+			},
+			Issues: []string{"platform os and arch need to be set"},
+		},
+		{
+			Name: "unsupported_isolation",
+			Request: api.StartStepRequest{
+				Kind:      api.Run,
+				Image:     "mcr.microsoft.com/windows/servercore",
+				Run:       api.RunConfig{Command: []string{"make"}},
+				Isolation: "vm",
+			},
+			Issues: []string{`unsupported isolation "vm"`},
+		},
+		{
+			Name: "cache_save_without_paths",
+			Request: api.StartStepRequest{
+				Kind:  api.CacheSave,
+				Image: "alpine",
+				Cache: api.CacheConfig{Key: "npm", Backend: api.Storage{Kind: api.StorageLocal, Path: "/cache"}},
+			},
+			Issues: []string{"cache steps run in the engine, image cannot be set", "cache paths need to be set"},
+		},
+		{
+			Name: "readiness_of_attached_step",
+			Request: api.StartStepRequest{
+				Kind:      api.Run,
+				Image:     "postgres",
+				Readiness: &api.ReadinessProbe{TCP: &api.TCPProbe{Port: 70000}, Command: []string{"pg_isready"}},
+			},
+			Issues: []string{
+				"readiness is only supported for detached steps",
+				"invalid readiness port 70000",
+				"readiness needs one of tcp, http or command",
+			},
+		},
+		{
+			Name: "upload_outside_working_dir",
+			Request: api.StartStepRequest{
+				Kind:   api.Upload,
+				Upload: api.UploadConfig{Paths: []string{"../secrets"}, Storage: api.Storage{Kind: api.StorageS3}},
+			},
+			Issues: []string{
+				`upload path "../secrets" needs to be relative to the working directory`,
+				"upload storage bucket needs to be set",
+			},
+		},
+		{
+			Name: "oci_runtime_of_host_step",
+			Request: api.StartStepRequest{
+				Kind:       api.Run,
+				OCIRuntime: "runsc",
+				Run:        api.RunConfig{Command: []string{"make"}, Entrypoint: []string{"sh", "-c"}},
+			},
+			Issues: []string{"oci_runtime is only supported for container steps"},
+		},
+		{
+			Name: "invalid_checkpoint",
+			Request: api.StartStepRequest{
+				Image: "alpine",
+				Run:   api.RunConfig{Command: []string{"python train.py"}},
+				Checkpoint: &api.Checkpoint{
+					Paths:     []string{"../models"},
+					UploadURL: "s3://bucket/ckpt.tar.gz",
+				},
+			},
+			Issues: []string{`checkpoint path "../models" needs to be relative to the working directory`,
+				"checkpoint upload_url needs to be an http or https url"},
+		},
+		{
+			Name: "user_with_host_user",
+			Request: api.StartStepRequest{
+				Image:    "alpine",
+				User:     "1000",
+				HostUser: true,
+				Run:      api.RunConfig{Command: []string{"id"}},
+			},
+			Issues: []string{"user and host_user cannot both be set"},
+		},
+		{
+			Name: "run_tests_v2_without_command",
+			Request: api.StartStepRequest{
+				Kind:  api.RunTestsV2,
+				Image: "maven",
+			},
+			Issues: []string{"command needs to be set for run tests step"},
+		},
+		{
+			Name: "unsupported_terraform_command",
+			Request: api.StartStepRequest{
+				Kind:      api.Terraform,
+				Image:     "hashicorp/terraform",
+				Terraform: api.TerraformConfig{Command: "apply"},
+			},
+			Issues: []string{`unsupported terraform command "apply"`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := validateStartStepRequest(&tc.Request)
+			if len(tc.Issues) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.IsType(t, &errors.BadRequestError{}, err) {
+				assert.Equal(t, tc.Issues, err.(*errors.BadRequestError).Issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	standaloneDirPerm  = 0700
+	standaloneFilePerm = 0600
+)
+
+var (
+	standaloneMu  sync.RWMutex
+	standaloneDir string
+)
+
+// EnableStandalone enables the standalone mode. The step results, logs and
+// test reports are written as files to the directory instead of being sent to
+// the delegate, the log service and the TI service.
+func EnableStandalone(dir string) error {
+	for _, sub := range []string{"", "logs", "steps", "reports"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), standaloneDirPerm); err != nil {
+			return err
+		}
+	}
+	standaloneMu.Lock()
+	defer standaloneMu.Unlock()
+	standaloneDir = dir
+	return nil
+}
+
+// Standalone returns the results directory of the standalone mode and
+// whether the mode is enabled.
+func Standalone() (string, bool) {
+	standaloneMu.RLock()
+	defer standaloneMu.RUnlock()
+	return standaloneDir, standaloneDir != ""
+}
+
+// WriteStandaloneResult writes the value as JSON to the file at the path
+// relative to the results directory of the standalone mode.
+func WriteStandaloneResult(name string, v interface{}) error {
+	dir, _ := Standalone()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, standaloneFilePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
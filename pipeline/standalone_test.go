@@ -0,0 +1,31 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandalone(t *testing.T) {
+	defer func() { standaloneDir = "" }()
+	_, ok := Standalone()
+	assert.False(t, ok)
+
+	dir := filepath.Join(t.TempDir(), "results")
+	require.NoError(t, EnableStandalone(dir))
+	got, ok := Standalone()
+	assert.True(t, ok)
+	assert.Equal(t, dir, got)
+	for _, sub := range []string{"logs", "steps", "reports"} {
+		assert.DirExists(t, filepath.Join(dir, sub))
+	}
+
+	require.NoError(t, WriteStandaloneResult(filepath.Join("steps", "step1.json"), map[string]string{"status": "ok"}))
+	data, err := os.ReadFile(filepath.Join(dir, "steps", "step1.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"ok"}`, string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "steps", "step1.json.tmp"))
+}
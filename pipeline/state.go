@@ -5,12 +5,20 @@
 package pipeline
 
 import (
+	"fmt"
+	"path/filepath"
+	"regexp"
 	"sync"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/egress"
+	"github.com/harness/lite-engine/internal/secretfile"
 	"github.com/harness/lite-engine/logstream"
 	"github.com/harness/lite-engine/logstream/filestore"
 	"github.com/harness/lite-engine/logstream/remote"
+	"github.com/harness/lite-engine/logstream/sink"
 	"github.com/harness/lite-engine/osstats"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 )
@@ -30,28 +38,135 @@ type State struct {
 	mu        sync.Mutex
 	logConfig api.LogConfig
 	tiConfig  tiCfg.Cfg
-	secrets   []string
+	secrets   *logstream.Secrets // grows with the secrets of the secret files
 
 	statsCollector *osstats.StatsCollector
+	egressProxy    *egress.Proxy
+	secretWatcher  *secretfile.Watcher
+	notify         *api.Notify
+	registries     []*api.Registry
+	nudges         []logstream.Nudge // the nudges of the catalog of the stage
+	outputKey      []byte
 	logClient      logstream.Client
+	logSinks       []logstream.Sink // built from the log config on first use
+	maskPatterns   []*regexp.Regexp // compiled from the log config on first use
+	logKeys        map[string]int   // number of steps which claimed each log key
 }
 
 func (s *State) Set(secrets []string, logConfig api.LogConfig, tiConfig tiCfg.Cfg, collector *osstats.StatsCollector) { //nolint:gocritic
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.secrets = secrets
+	s.secrets = logstream.NewSecrets(secrets)
 	s.logConfig = logConfig
+	s.logSinks = nil
+	s.maskPatterns = nil
 	s.tiConfig = tiConfig
 	s.statsCollector = collector
+	s.logKeys = make(map[string]int)
+}
+
+// ClaimLogKey reserves the log key for a step. If the key was already
+// claimed in the stage, a key with an attempt suffix is returned instead,
+// unless reuse is set. The second return value reports the collision.
+func (s *State) ClaimLogKey(key string, reuse bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logKeys == nil {
+		s.logKeys = make(map[string]int)
+	}
+	n := s.logKeys[key]
+	if n == 0 || reuse {
+		s.logKeys[key] = n + 1
+		return key, n > 0
+	}
+	for attempt := n + 1; ; attempt++ {
+		namespaced := fmt.Sprintf("%s-attempt-%d", key, attempt)
+		if s.logKeys[namespaced] == 0 {
+			s.logKeys[key] = attempt
+			s.logKeys[namespaced] = 1
+			return namespaced, true
+		}
+	}
 }
 
 func (s *State) GetSecrets() []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.secrets.Values()
+}
+
+// GetSecretSet returns the secrets of the stage, the log writers created
+// with it mask the secrets added during the stage.
+func (s *State) GetSecretSet() *logstream.Secrets {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secrets == nil {
+		s.secrets = logstream.NewSecrets(nil)
+	}
 	return s.secrets
 }
 
+// AddSecrets adds the secrets to the secrets of the stage, eg. the
+// secrets of the files mounted by an agent.
+func (s *State) AddSecrets(secrets ...string) int {
+	return s.GetSecretSet().Add(secrets...)
+}
+
+// WatchSecretFiles adds the secrets of the secret files, and of the files
+// of the secret directories, to the secrets of the stage and watches them
+// until StopSecretFiles, the secrets rendered or rotated are added too.
+func (s *State) WatchSecretFiles(paths []string) {
+	s.StopSecretFiles()
+	if len(paths) == 0 {
+		return
+	}
+	w := secretfile.New(paths)
+	if n := s.AddSecrets(w.Scan()...); n > 0 {
+		logrus.WithField("secrets", n).Infoln("masking the secrets of the secret files")
+	}
+	w.Start(secretfile.DefaultInterval, func(secrets []string) {
+		if n := s.AddSecrets(secrets...); n > 0 {
+			logrus.WithField("secrets", n).Infoln("masking the secrets of the updated secret files")
+		}
+	})
+
+	s.mu.Lock()
+	s.secretWatcher = w
+	s.mu.Unlock()
+}
+
+// StopSecretFiles stops watching the secret files, the secrets read are
+// still masked.
+func (s *State) StopSecretFiles() {
+	s.mu.Lock()
+	w := s.secretWatcher
+	s.secretWatcher = nil
+	s.mu.Unlock()
+
+	if w != nil {
+		w.Stop()
+	}
+}
+
+// SetNudges sets the nudges of the catalog of the stage, checked in the
+// logs of the steps in addition to the nudges of the engine.
+func (s *State) SetNudges(nudges []logstream.Nudge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nudges = nudges
+}
+
+func (s *State) GetNudges() []logstream.Nudge {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.nudges
+}
+
 func (s *State) GetStatsCollector() *osstats.StatsCollector {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -59,14 +174,81 @@ func (s *State) GetStatsCollector() *osstats.StatsCollector {
 	return s.statsCollector
 }
 
+// SetEgressProxy sets the egress proxy of the stage, nil if the stage has
+// none.
+func (s *State) SetEgressProxy(proxy *egress.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.egressProxy = proxy
+}
+
+func (s *State) GetEgressProxy() *egress.Proxy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.egressProxy
+}
+
+// SetNotify sets the webhook the test summaries of the stage are posted
+// to, nil if the stage has none.
+func (s *State) SetNotify(notify *api.Notify) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notify = notify
+}
+
+func (s *State) GetNotify() *api.Notify {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.notify
+}
+
+// SetRegistries sets the registries the image steps of the stage access.
+func (s *State) SetRegistries(registries []*api.Registry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.registries = registries
+}
+
+func (s *State) GetRegistries() []*api.Registry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.registries
+}
+
+// SetOutputKey sets the key the secret outputs of the steps are encrypted
+// with, nil if they are not encrypted.
+func (s *State) SetOutputKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outputKey = key
+}
+
+func (s *State) GetOutputKey() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.outputKey
+}
+
 func (s *State) GetLogStreamClient() logstream.Client {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.logClient == nil {
-		if s.logConfig.URL != "" {
-			s.logClient = remote.NewHTTPClient(s.logConfig.URL, s.logConfig.AccountID,
+		if dir, ok := Standalone(); ok {
+			s.logClient = filestore.New(filepath.Join(dir, "logs"))
+		} else if s.logConfig.URL != "" {
+			client := remote.NewHTTPClient(s.logConfig.URL, s.logConfig.AccountID,
 				s.logConfig.Token, s.logConfig.IndirectUpload, false)
+			client.Compress = s.logConfig.CompressUpload
+			s.logClient = client
 		} else {
 			s.logClient = filestore.New(SharedVolPath)
 		}
@@ -74,6 +256,57 @@ func (s *State) GetLogStreamClient() logstream.Client {
 	return s.logClient
 }
 
+// SetLogStreamClient overrides the client used to stream the step logs.
+func (s *State) SetLogStreamClient(client logstream.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logClient = client
+}
+
+// GetLogSinks returns the sinks of the step logs in addition to the log
+// service, the sinks which cannot be created are skipped.
+func (s *State) GetLogSinks() []logstream.Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logSinks == nil && len(s.logConfig.Sinks) > 0 {
+		s.logSinks = make([]logstream.Sink, 0, len(s.logConfig.Sinks))
+		for i := range s.logConfig.Sinks {
+			snk, err := sink.New(&s.logConfig.Sinks[i])
+			if err != nil {
+				logrus.WithError(err).Errorln("could not create the log sink")
+				continue
+			}
+			s.logSinks = append(s.logSinks, snk)
+		}
+	}
+	return s.logSinks
+}
+
+// GetMaskPatterns returns the patterns masked in the step logs, the
+// patterns which cannot be compiled are skipped.
+func (s *State) GetMaskPatterns() []*regexp.Regexp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maskPatterns == nil && (len(s.logConfig.MaskPatterns) > 0 || s.logConfig.MaskPatternsFile != "") {
+		patterns, err := logstream.LoadPatterns(s.logConfig.MaskPatterns, s.logConfig.MaskPatternsFile)
+		if err != nil {
+			logrus.WithError(err).Errorln("could not load the mask patterns")
+		}
+		var issues []string
+		s.maskPatterns, issues = logstream.CompilePatterns(patterns)
+		if len(issues) > 0 {
+			logrus.WithField("issues", issues).Errorln("could not compile the mask patterns")
+		}
+		if s.maskPatterns == nil {
+			s.maskPatterns = []*regexp.Regexp{}
+		}
+	}
+	return s.maskPatterns
+}
+
 func (s *State) GetTIConfig() *tiCfg.Cfg {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -95,7 +328,7 @@ func GetState() *State {
 			logConfig:      api.LogConfig{},
 			tiConfig:       tiCfg.Cfg{},
 			statsCollector: &osstats.StatsCollector{},
-			secrets:        make([]string, 0),
+			secrets:        logstream.NewSecrets(nil),
 			logClient:      nil,
 		}
 	})
@@ -0,0 +1,31 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimLogKey(t *testing.T) {
+	s := &State{}
+
+	key, collided := s.ClaimLogKey("step", false)
+	assert.Equal(t, "step", key)
+	assert.False(t, collided)
+
+	key, collided = s.ClaimLogKey("step", false)
+	assert.Equal(t, "step-attempt-2", key)
+	assert.True(t, collided)
+
+	key, _ = s.ClaimLogKey("step", false)
+	assert.Equal(t, "step-attempt-3", key)
+
+	key, collided = s.ClaimLogKey("step", true)
+	assert.Equal(t, "step", key)
+	assert.True(t, collided)
+
+	key, _ = s.ClaimLogKey("step-attempt-4", false)
+	assert.Equal(t, "step-attempt-4", key)
+	key, _ = s.ClaimLogKey("step", false)
+	assert.Equal(t, "step-attempt-5", key)
+}
@@ -0,0 +1,334 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/harness/lite-engine/api"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	pull     = "pull"
+	pullPush = "pull,push"
+
+	maxManifestSize = 4 << 20
+)
+
+// manifestTypes are the media types of the manifests accepted from the
+// registries, the schema1 manifests are not supported.
+var manifestTypes = strings.Join([]string{v1.MediaTypeImageIndex, manifestlist.MediaTypeManifestList,
+	v1.MediaTypeImageManifest, schema2.MediaTypeManifest}, ", ")
+
+// Image is the manifest of an image copied, inspected or tagged.
+type Image struct {
+	Digest    string   `json:"digest"`
+	MediaType string   `json:"media_type"`
+	Platforms []string `json:"platforms,omitempty"` // eg. linux/arm64/v8, set by the inspection
+}
+
+// ValidateOp returns the issues of the image operation of a step.
+func ValidateOp(cfg *api.ImageOpConfig) []string {
+	var issues []string
+	source, err := reference.ParseNormalizedNamed(cfg.Source)
+	if err != nil {
+		issues = append(issues, fmt.Sprintf("invalid image_op source %q", cfg.Source))
+	}
+	switch cfg.Operation {
+	case "", api.ImageCopy:
+		if len(cfg.Targets) == 0 {
+			issues = append(issues, "image_op targets need to be set to copy an image")
+		}
+		for _, t := range cfg.Targets {
+			if _, err := reference.ParseNormalizedNamed(t); err != nil {
+				issues = append(issues, fmt.Sprintf("invalid image_op target %q", t))
+			}
+		}
+	case api.ImageTag:
+		if len(cfg.Targets) == 0 {
+			issues = append(issues, "image_op targets need to be set to tag an image")
+		}
+		for _, t := range cfg.Targets {
+			if source == nil {
+				break
+			}
+			if _, err := reference.WithTag(reference.TrimNamed(source), t); err != nil {
+				issues = append(issues, fmt.Sprintf("invalid image_op tag %q", t))
+			}
+		}
+	case api.ImageInspect:
+		if len(cfg.Targets) != 0 {
+			issues = append(issues, "image_op targets cannot be set to inspect an image")
+		}
+	default:
+		issues = append(issues, fmt.Sprintf("unsupported image_op operation %q", cfg.Operation))
+	}
+	return issues
+}
+
+// manifest is a manifest of a repository, of an image or of an index of
+// images.
+type manifest struct {
+	mediaType string
+	digest    digest.Digest
+	payload   []byte
+	parsed    distribution.Manifest
+}
+
+// Inspect returns the manifest of the image and its platforms.
+func (c *Client) Inspect(ctx context.Context, source string) (*Image, error) {
+	img, err := parseImage(source)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.manifest(ctx, img, pull, img.ref)
+	if err != nil {
+		return nil, err
+	}
+	platforms, err := c.platforms(ctx, img, m)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Digest: m.digest.String(), MediaType: m.mediaType, Platforms: platforms}, nil
+}
+
+// Copy copies the image to the target with all its platforms. The blobs
+// of the image existing in the target repository are not copied again.
+func (c *Client) Copy(ctx context.Context, source, target string) (*Image, error) {
+	src, err := parseImage(source)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseImage(target)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.copyManifest(ctx, src, dst, src.ref, dst.ref)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Digest: m.digest.String(), MediaType: m.mediaType}, nil
+}
+
+// Tag pushes the manifest of the image with the tags in its repository.
+func (c *Client) Tag(ctx context.Context, source string, tags []string) (*Image, error) {
+	src, err := parseImage(source)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.manifest(ctx, src, pullPush, src.ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		dst := *src
+		dst.ref = tag
+		if err := c.putManifest(ctx, &dst, m); err != nil {
+			return nil, err
+		}
+	}
+	return &Image{Digest: m.digest.String(), MediaType: m.mediaType}, nil
+}
+
+// copyManifest copies the manifest of the source reference and its blobs,
+// or the manifests of an index, to the target reference.
+func (c *Client) copyManifest(ctx context.Context, src, dst *image, srcRef, dstRef string) (*manifest, error) {
+	m, err := c.manifest(ctx, src, pull, srcRef)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.parsed.(*manifestlist.DeserializedManifestList); ok {
+		for _, d := range m.parsed.References() {
+			if _, err := c.copyManifest(ctx, src, dst, d.Digest.String(), d.Digest.String()); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, d := range m.parsed.References() {
+			// the foreign layers are pulled from their urls
+			if len(d.URLs) > 0 {
+				continue
+			}
+			if err := c.copyBlob(ctx, src, dst, d); err != nil {
+				return nil, fmt.Errorf("cannot copy the blob %s of %s: %w", d.Digest, src, err)
+			}
+		}
+	}
+	target := *dst
+	target.ref = dstRef
+	return m, c.putManifest(ctx, &target, m)
+}
+
+// manifest returns the manifest of the reference of the repository of the
+// image.
+func (c *Client) manifest(ctx context.Context, img *image, actions, ref string) (*manifest, error) {
+	resp, err := c.do(ctx, img, actions, http.MethodGet, "/v2/"+img.repo+"/manifests/"+ref, nil,
+		http.Header{"Accept": {manifestTypes}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "" || mediaType == "application/json" || mediaType == "text/plain" {
+		var v struct {
+			MediaType string `json:"mediaType"`
+		}
+		_ = json.Unmarshal(payload, &v)
+		mediaType = v.MediaType
+	}
+	parsed, desc, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the manifest of %s: %w", img, err)
+	}
+	if strings.HasPrefix(ref, "sha256:") && desc.Digest.String() != ref {
+		return nil, fmt.Errorf("the manifest %s of %s has the digest %s", ref, img, desc.Digest)
+	}
+	return &manifest{mediaType: mediaType, digest: desc.Digest, payload: payload, parsed: parsed}, nil
+}
+
+// putManifest pushes the manifest to the reference of the image.
+func (c *Client) putManifest(ctx context.Context, img *image, m *manifest) error {
+	resp, err := c.do(ctx, img, pullPush, http.MethodPut, "/v2/"+img.repo+"/manifests/"+img.ref, bytes.NewReader(m.payload),
+		http.Header{"Content-Type": {m.mediaType}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	c.log.Infof("Pushed %s (%s)", img, m.digest)
+	return nil
+}
+
+// copyBlob uploads the blob of the source repository to the target
+// repository, unless the target repository already has it.
+func (c *Client) copyBlob(ctx context.Context, src, dst *image, d distribution.Descriptor) error {
+	resp, err := c.do(ctx, dst, pullPush, http.MethodHead, "/v2/"+dst.repo+"/blobs/"+d.Digest.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		c.log.Infof("Skipped the existing blob %s", d.Digest)
+		return nil
+	}
+
+	resp, err = c.do(ctx, dst, pullPush, http.MethodPost, "/v2/"+dst.repo+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", d.Digest.String())
+	location.RawQuery = q.Encode()
+
+	blob, err := c.do(ctx, src, pull, http.MethodGet, "/v2/"+src.repo+"/blobs/"+d.Digest.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer blob.Body.Close()
+	if blob.StatusCode != http.StatusOK {
+		return responseError(blob)
+	}
+	size := d.Size
+	if size == 0 {
+		size = blob.ContentLength
+	}
+	resp, err = c.do(ctx, dst, pullPush, http.MethodPut, location.String(), blob.Body, http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"Content-Length": {strconv.FormatInt(size, 10)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	c.log.Infof("Copied the blob %s (%d bytes)", d.Digest, size)
+	return nil
+}
+
+// platforms returns the platforms of the images of an index, or the
+// platform of the config of an image.
+func (c *Client) platforms(ctx context.Context, img *image, m *manifest) ([]string, error) {
+	var config distribution.Descriptor
+	switch p := m.parsed.(type) {
+	case *manifestlist.DeserializedManifestList:
+		var platforms []string
+		for _, d := range p.Manifests {
+			// the attestations of the images
+			if d.Platform.OS == "unknown" {
+				continue
+			}
+			platforms = append(platforms, formatPlatform(d.Platform.OS, d.Platform.Architecture, d.Platform.Variant))
+		}
+		return platforms, nil
+	case *schema2.DeserializedManifest:
+		config = p.Config
+	case *ocischema.DeserializedManifest:
+		config = p.Config
+	default:
+		return nil, nil
+	}
+
+	resp, err := c.do(ctx, img, pull, http.MethodGet, "/v2/"+img.repo+"/blobs/"+config.Digest.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var v struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&v); err != nil {
+		return nil, fmt.Errorf("cannot read the config of %s: %w", img, err)
+	}
+	if v.OS == "" {
+		return nil, nil
+	}
+	return []string{formatPlatform(v.OS, v.Architecture, v.Variant)}, nil
+}
+
+func formatPlatform(os, arch, variant string) string {
+	if variant != "" {
+		return os + "/" + arch + "/" + variant
+	}
+	return os + "/" + arch
+}
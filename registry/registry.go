@@ -0,0 +1,355 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package registry copies, inspects and tags the images of the container
+// registries from the engine, without docker or a docker cli in an image.
+// The registries are authenticated with the credentials and the client
+// certificates of the stage.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/harness/lite-engine/api"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dockerHub         = "docker.io"
+	dockerHubEndpoint = "registry-1.docker.io"
+	maxErrorBody      = 4 << 10
+)
+
+// dockerHubAliases are the addresses of the docker hub in the credentials.
+var dockerHubAliases = map[string]bool{
+	"index.docker.io":         true,
+	"registry-1.docker.io":    true,
+	"registry.hub.docker.com": true,
+}
+
+// Validate returns the issues of the registries of a stage.
+func Validate(registries []*api.Registry) []string {
+	var issues []string
+	seen := make(map[string]bool)
+	for _, r := range registries {
+		if r == nil || r.Address == "" {
+			issues = append(issues, "registry address needs to be set")
+			continue
+		}
+		host := Host(r.Address)
+		if seen[host] {
+			issues = append(issues, fmt.Sprintf("registry %s is set more than once", r.Address))
+		}
+		seen[host] = true
+		if _, err := tlsConfig(r); err != nil {
+			issues = append(issues, fmt.Sprintf("registry %s: %s", r.Address, err))
+		}
+	}
+	return issues
+}
+
+// Host returns the host of the address of a registry, eg. docker.io for
+// https://index.docker.io/v1/.
+func Host(address string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	if i := strings.Index(host, "/"); i != -1 {
+		host = host[:i]
+	}
+	if dockerHubAliases[host] {
+		return dockerHub
+	}
+	return host
+}
+
+// tlsConfig returns the tls configuration of the registry, nil if it has
+// neither a certificate authority nor a client certificate.
+func tlsConfig(r *api.Registry) (*tls.Config, error) {
+	if r.CACert == "" && r.ClientCert == "" && r.ClientKey == "" && !r.Insecure {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: r.Insecure} //nolint:gosec
+	if r.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(r.CACert)) {
+			return nil, fmt.Errorf("ca cert has no PEM certificate")
+		}
+		cfg.RootCAs = pool
+	}
+	if r.ClientCert != "" || r.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(r.ClientCert), []byte(r.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client cert and key: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Client is a client of the registries of a stage. The registries without
+// credentials are accessed anonymously.
+type Client struct {
+	registries map[string]*api.Registry // by host
+	clients    map[string]*http.Client  // by host, with the tls configuration of the registry
+	log        logrus.FieldLogger
+
+	mu    sync.Mutex
+	auths map[string]string // the authorization header by host, repository and actions
+	plain map[string]bool   // the insecure registries served over http
+}
+
+// New returns a client of the registries, logging the copied blobs and
+// the pushed manifests to the logger.
+func New(registries []*api.Registry, log logrus.FieldLogger) (*Client, error) {
+	c := &Client{
+		log:        log,
+		registries: make(map[string]*api.Registry),
+		clients:    make(map[string]*http.Client),
+		auths:      make(map[string]string),
+		plain:      make(map[string]bool),
+	}
+	for _, r := range registries {
+		cfg, err := tlsConfig(r)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s: %w", r.Address, err)
+		}
+		host := Host(r.Address)
+		c.registries[host] = r
+		if cfg != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = cfg
+			c.clients[host] = &http.Client{Transport: transport}
+		}
+	}
+	return c, nil
+}
+
+// image is a reference to an image of a repository.
+type image struct {
+	host string // of the registry, eg. docker.io
+	repo string // eg. library/alpine
+	ref  string // the tag or the digest
+}
+
+// parseImage parses the reference, latest if it has neither a tag nor a
+// digest.
+func parseImage(s string) (*image, error) {
+	named, err := reference.ParseNormalizedNamed(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %w", s, err)
+	}
+	img := &image{host: reference.Domain(named), repo: reference.Path(named), ref: "latest"}
+	if d, ok := named.(reference.Digested); ok {
+		img.ref = d.Digest().String()
+	} else if t, ok := named.(reference.Tagged); ok {
+		img.ref = t.Tag()
+	}
+	return img, nil
+}
+
+func (i *image) String() string {
+	if strings.HasPrefix(i.ref, "sha256:") {
+		return i.host + "/" + i.repo + "@" + i.ref
+	}
+	return i.host + "/" + i.repo + ":" + i.ref
+}
+
+// endpoint returns the url of the path of the registry of the image.
+func (c *Client) endpoint(img *image, path string) string {
+	host := img.host
+	if host == dockerHub {
+		host = dockerHubEndpoint
+	}
+	scheme := "https"
+	c.mu.Lock()
+	if c.plain[img.host] {
+		scheme = "http"
+	}
+	c.mu.Unlock()
+	return scheme + "://" + host + path
+}
+
+func (c *Client) httpClient(img *image) *http.Client {
+	if client, ok := c.clients[img.host]; ok {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// do sends the request to the registry of the image, authenticated for the
+// actions on its repository, eg. pull,push. The url is a path of the
+// registry or an absolute url, eg. the location of an upload. The request
+// is authenticated and sent again once if the registry challenges it and
+// its body is nil or a bytes.Reader, the other bodies are streamed once
+// with their Content-Length header.
+func (c *Client) do(ctx context.Context, img *image, actions, method, rawurl string, body io.Reader, header http.Header) (*http.Response, error) {
+	if strings.HasPrefix(rawurl, "/") {
+		rawurl = c.endpoint(img, rawurl)
+	}
+	key := img.host + "/" + img.repo + ":" + actions
+	for authenticated, fellBack := false, false; ; {
+		req, err := http.NewRequestWithContext(ctx, method, rawurl, body)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			req.ContentLength = n
+		}
+		c.mu.Lock()
+		auth := c.auths[key]
+		c.mu.Unlock()
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		resp, err := c.httpClient(img).Do(req)
+		if err != nil {
+			// an insecure registry served over http
+			if r := c.registries[img.host]; !fellBack && r != nil && r.Insecure && req.URL.Scheme == "https" &&
+				strings.Contains(err.Error(), "server gave HTTP response to HTTPS client") && rewind(body) {
+				c.mu.Lock()
+				c.plain[img.host] = true
+				c.mu.Unlock()
+				rawurl = "http" + strings.TrimPrefix(rawurl, "https")
+				fellBack = true
+				continue
+			}
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || authenticated || !rewind(body) {
+			return resp, nil
+		}
+		auth, err = c.authenticate(ctx, img, actions, resp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.auths[key] = auth
+		c.mu.Unlock()
+		authenticated = true
+	}
+}
+
+// rewind rewinds the body of a request to send it again, false if it
+// cannot be read again.
+func rewind(body io.Reader) bool {
+	switch b := body.(type) {
+	case nil:
+		return true
+	case *bytes.Reader:
+		_, err := b.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return false
+}
+
+// authenticate returns the authorization header answering the challenge
+// of the response, a bearer token of the token service of the registry or
+// the basic credentials of the registry.
+func (c *Client) authenticate(ctx context.Context, img *image, actions string, resp *http.Response) (string, error) {
+	var username, password string
+	if r := c.registries[img.host]; r != nil {
+		username, password = r.Username, r.Password
+	}
+	for _, ch := range challenge.ResponseChallenges(resp) {
+		switch ch.Scheme {
+		case "bearer":
+			token, err := c.token(ctx, img, ch.Parameters, "repository:"+img.repo+":"+actions, username, password)
+			if err != nil {
+				return "", fmt.Errorf("cannot authenticate to %s: %w", img.host, err)
+			}
+			return "Bearer " + token, nil
+		case "basic":
+			if username == "" && password == "" {
+				continue
+			}
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+		}
+	}
+	return "", fmt.Errorf("cannot authenticate to %s: %s", img.host, resp.Status)
+}
+
+// token returns a token of the token service of the challenge for the
+// scope, anonymous if the registry has no credentials.
+func (c *Client) token(ctx context.Context, img *image, params map[string]string, scope, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := c.httpClient(img).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return "", fmt.Errorf("the token service returned no token")
+	}
+	return t.Token, nil
+}
+
+// responseError returns the error of a failed response, with the first
+// error of the registry if the body has one.
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var e struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	msg := resp.Status
+	if json.Unmarshal(b, &e) == nil && len(e.Errors) > 0 {
+		msg = fmt.Sprintf("%s: %s", e.Errors[0].Code, e.Errors[0].Message)
+	} else if s := string(bytes.TrimSpace(b)); s != "" && !strings.HasPrefix(s, "<") {
+		msg = fmt.Sprintf("%s: %s", resp.Status, s)
+	}
+	return fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Path, msg)
+}
@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry is an in-memory registry authenticating the requests with
+// the bearer tokens of its token service.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	manifests map[string][]byte // by repository and reference
+	types     map[string]string // media type by repository and reference
+	blobs     map[string][]byte // by repository and digest
+	uploads   int
+	server    *httptest.Server
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	f := &fakeRegistry{manifests: map[string][]byte{}, types: map[string]string{}, blobs: map[string][]byte{}}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeRegistry) host() string {
+	return strings.TrimPrefix(f.server.URL, "https://")
+}
+
+func (f *fakeRegistry) caCert() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.server.Certificate().Raw}))
+}
+
+func (f *fakeRegistry) serve(w http.ResponseWriter, r *http.Request) { //nolint:gocyclo
+	if r.URL.Path == "/token" {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token": "token-%s"}`, strings.ReplaceAll(r.URL.Query().Get("scope"), ":", "-"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	var repo, kind, ref string
+	for _, k := range []string{"/manifests/", "/blobs/uploads/", "/blobs/"} {
+		if i := strings.Index(path, k); i != -1 {
+			repo, kind, ref = path[:i], strings.Trim(k, "/"), path[i+len(k):]
+			break
+		}
+	}
+	// the push token grants the pull
+	auth := r.Header.Get("Authorization")
+	push := r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodHead
+	if auth != "Bearer token-repository-"+repo+"-pull,push" && (push || auth != "Bearer token-repository-"+repo+"-pull") {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, f.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case kind == "manifests" && r.Method == http.MethodGet:
+		b, ok := f.manifests[repo+"@"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": [{"code": "MANIFEST_UNKNOWN", "message": "manifest unknown"}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[repo+"@"+ref])
+		w.Write(b) //nolint:errcheck
+	case kind == "manifests" && r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.putManifest(repo, ref, r.Header.Get("Content-Type"), b)
+		w.WriteHeader(http.StatusCreated)
+	case kind == "blobs" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		b, ok := f.blobs[repo+"@"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write(b) //nolint:errcheck
+		}
+	case kind == "blobs/uploads" && r.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case kind == "blobs/uploads" && r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		d := r.URL.Query().Get("digest")
+		if r.URL.Query().Get("state") != "x" || digest.FromBytes(b).String() != d || r.ContentLength != int64(len(b)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[repo+"@"+d] = b
+		f.uploads++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeRegistry) putManifest(repo, tag, mediaType string, b []byte) string {
+	d := digest.FromBytes(b).String()
+	for _, ref := range []string{tag, d} {
+		f.manifests[repo+"@"+ref] = b
+		f.types[repo+"@"+ref] = mediaType
+	}
+	return d
+}
+
+// pushImage pushes an image of the platform with a layer to the repository
+// and returns its descriptor.
+func (f *fakeRegistry) pushImage(repo, tag, arch string) v1.Descriptor {
+	config := []byte(fmt.Sprintf(`{"os": "linux", "architecture": %q}`, arch))
+	layer := []byte("layer of " + arch)
+	f.blobs[repo+"@"+digest.FromBytes(config).String()] = config
+	f.blobs[repo+"@"+digest.FromBytes(layer).String()] = layer
+	m, _ := json.Marshal(v1.Manifest{
+		MediaType: v1.MediaTypeImageManifest,
+		Config:    v1.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers:    []v1.Descriptor{{MediaType: v1.MediaTypeImageLayerGzip, Digest: digest.FromBytes(layer), Size: int64(len(layer))}},
+	})
+	m = append([]byte(`{"schemaVersion": 2,`), m[1:]...)
+	d := f.putManifest(repo, tag, v1.MediaTypeImageManifest, m)
+	return v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.Digest(d), Size: int64(len(m)),
+		Platform: &v1.Platform{OS: "linux", Architecture: arch}}
+}
+
+func newTestClient(t *testing.T, f *fakeRegistry) *Client {
+	log := logrus.New()
+	log.Out = io.Discard
+	c, err := New([]*api.Registry{{Address: "https://" + f.host(), Username: "user", Password: "pass", CACert: f.caCert()}}, log)
+	require.NoError(t, err)
+	return c
+}
+
+func TestCopy(t *testing.T) {
+	f := newFakeRegistry(t)
+	src := f.pushImage("app", "1.0", "amd64")
+	c := newTestClient(t, f)
+
+	img, err := c.Copy(context.Background(), f.host()+"/app:1.0", f.host()+"/release/app:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, &Image{Digest: src.Digest.String(), MediaType: v1.MediaTypeImageManifest}, img)
+	assert.Equal(t, f.manifests["app@1.0"], f.manifests["release/app@1.0"])
+	assert.Equal(t, 2, f.uploads)
+
+	// the blobs of the target are not copied again
+	_, err = c.Copy(context.Background(), f.host()+"/app@"+src.Digest.String(), f.host()+"/release/app:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.uploads)
+
+	_, err = c.Copy(context.Background(), f.host()+"/app:2.0", f.host()+"/release/app:2.0")
+	assert.EqualError(t, err, "GET /v2/app/manifests/2.0: MANIFEST_UNKNOWN: manifest unknown")
+}
+
+func TestCopyIndex(t *testing.T) {
+	f := newFakeRegistry(t)
+	index, _ := json.Marshal(v1.Index{
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{f.pushImage("app", "amd64", "amd64"), f.pushImage("app", "arm64", "arm64")},
+	})
+	index = append([]byte(`{"schemaVersion": 2,`), index[1:]...)
+	d := f.putManifest("app", "1.0", v1.MediaTypeImageIndex, index)
+	c := newTestClient(t, f)
+
+	img, err := c.Copy(context.Background(), f.host()+"/app:1.0", f.host()+"/mirror/app:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, d, img.Digest)
+	assert.Equal(t, 4, f.uploads)
+	assert.Equal(t, f.manifests["app@arm64"], f.manifests["mirror/app@"+digest.FromBytes(f.manifests["app@arm64"]).String()])
+
+	img, err = c.Inspect(context.Background(), f.host()+"/mirror/app:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, &Image{Digest: d, MediaType: v1.MediaTypeImageIndex, Platforms: []string{"linux/amd64", "linux/arm64"}}, img)
+}
+
+func TestInspectAndTag(t *testing.T) {
+	f := newFakeRegistry(t)
+	src := f.pushImage("app", "1.0", "arm64")
+	c := newTestClient(t, f)
+
+	img, err := c.Inspect(context.Background(), f.host()+"/app:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, &Image{Digest: src.Digest.String(), MediaType: v1.MediaTypeImageManifest, Platforms: []string{"linux/arm64"}}, img)
+
+	img, err = c.Tag(context.Background(), f.host()+"/app:1.0", []string{"stable", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, src.Digest.String(), img.Digest)
+	assert.Equal(t, f.manifests["app@1.0"], f.manifests["app@stable"])
+	assert.Equal(t, f.manifests["app@1.0"], f.manifests["app@1"])
+	assert.Equal(t, 0, f.uploads)
+}
+
+func TestAuthentication(t *testing.T) {
+	f := newFakeRegistry(t)
+	f.pushImage("app", "1.0", "amd64")
+
+	// the certificate of the registry is not trusted
+	c, err := New(nil, logrus.New())
+	require.NoError(t, err)
+	_, err = c.Inspect(context.Background(), f.host()+"/app:1.0")
+	assert.ErrorContains(t, err, "certificate")
+
+	c, err = New([]*api.Registry{{Address: f.host(), Username: "user", Password: "wrong", CACert: f.caCert()}}, logrus.New())
+	require.NoError(t, err)
+	_, err = c.Inspect(context.Background(), f.host()+"/app:1.0")
+	assert.EqualError(t, err, "cannot authenticate to "+f.host()+": GET /token: 401 Unauthorized")
+}
+
+func TestValidate(t *testing.T) {
+	assert.Empty(t, Validate([]*api.Registry{{Address: "https://index.docker.io/v1/", Username: "user"}, {Address: "registry.example.com"}}))
+	assert.Equal(t, []string{
+		"registry address needs to be set",
+		"registry docker.io is set more than once",
+		"registry registry.example.com: ca cert has no PEM certificate",
+		"registry registry.example.com:5000: invalid client cert and key: tls: failed to find any PEM data in certificate input",
+	}, Validate([]*api.Registry{
+		{Username: "user"},
+		{Address: "index.docker.io"},
+		{Address: "docker.io"},
+		{Address: "registry.example.com", CACert: "not a certificate"},
+		{Address: "registry.example.com:5000", ClientKey: "key"},
+	}))
+}
+
+func TestValidateOp(t *testing.T) {
+	tests := []struct {
+		cfg    api.ImageOpConfig
+		issues []string
+	}{
+		{cfg: api.ImageOpConfig{Source: "app:1.0", Targets: []string{"registry.example.com/app:1.0"}}},
+		{cfg: api.ImageOpConfig{Operation: api.ImageTag, Source: "app:1.0", Targets: []string{"stable"}}},
+		{cfg: api.ImageOpConfig{Operation: api.ImageInspect, Source: "app"}},
+		{
+			cfg:    api.ImageOpConfig{Source: "App", Targets: []string{"registry.example.com/app:1:0"}},
+			issues: []string{`invalid image_op source "App"`, `invalid image_op target "registry.example.com/app:1:0"`},
+		},
+		{
+			cfg:    api.ImageOpConfig{Operation: api.ImageTag, Source: "app:1.0", Targets: []string{"-stable"}},
+			issues: []string{`invalid image_op tag "-stable"`},
+		},
+		{cfg: api.ImageOpConfig{Source: "app"}, issues: []string{"image_op targets need to be set to copy an image"}},
+		{
+			cfg:    api.ImageOpConfig{Operation: api.ImageInspect, Source: "app", Targets: []string{"app:2"}},
+			issues: []string{"image_op targets cannot be set to inspect an image"},
+		},
+		{cfg: api.ImageOpConfig{Operation: "delete", Source: "app"}, issues: []string{`unsupported image_op operation "delete"`}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.issues, ValidateOp(&test.cfg), test.cfg)
+	}
+}
+
+func TestHost(t *testing.T) {
+	assert.Equal(t, "docker.io", Host("https://index.docker.io/v1/"))
+	assert.Equal(t, "docker.io", Host("registry-1.docker.io"))
+	assert.Equal(t, "registry.example.com:5000", Host("http://registry.example.com:5000"))
+}
+
+func TestParseImage(t *testing.T) {
+	img, err := parseImage("alpine")
+	assert.NoError(t, err)
+	assert.Equal(t, &image{host: "docker.io", repo: "library/alpine", ref: "latest"}, img)
+	assert.Equal(t, "docker.io/library/alpine:latest", img.String())
+
+	img, err = parseImage("registry.example.com:5000/team/app@sha256:" + strings.Repeat("a", 64))
+	assert.NoError(t, err)
+	assert.Equal(t, &image{host: "registry.example.com:5000", repo: "team/app", ref: "sha256:" + strings.Repeat("a", 64)}, img)
+	assert.Equal(t, "https://"+dockerHubEndpoint+"/v2/", (&Client{}).endpoint(&image{host: "docker.io"}, "/v2/"))
+}
@@ -17,6 +17,10 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// shutdownTimeout is the time the in-flight requests are given to complete
+// once the server shuts down.
+const shutdownTimeout = 10 * time.Second
+
 // A Server defines parameters for running an HTTPS/TLS server.
 type Server struct {
 	Addr           string // TCP address to listen on
@@ -61,14 +65,23 @@ func (s *Server) Start(ctx context.Context) error {
 
 	var g errgroup.Group
 	g.Go(func() error {
+		var err error
 		if s.Insecure {
-			return srv.ListenAndServe()
+			err = srv.ListenAndServe()
+		} else {
+			err = srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		}
+		if err == http.ErrServerClosed {
+			return ctx.Err() // shut down on request
 		}
-		return srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		return err
 	})
 	g.Go(func() error {
 		<-ctx.Done()
-		srv.Shutdown(ctx) //nolint: errcheck
+		// let the in-flight requests complete, eg. the drain response.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint: errcheck
 		return nil
 	})
 	return g.Wait()
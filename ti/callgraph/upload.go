@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/internal/metrics"
+	"github.com/harness/lite-engine/ti"
 	"github.com/harness/lite-engine/ti/avro"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 	"github.com/mattn/go-zglob"
@@ -36,7 +38,10 @@ func Upload(ctx context.Context, stepID string, timeMs int64, log *logrus.Logger
 	}
 
 	c := cfg.GetClient()
-	if cgErr := c.UploadCg(ctx, stepID, cfg.GetSourceBranch(), cfg.GetTargetBranch(), timeMs, encCg); cgErr != nil {
+	uploadStart := time.Now()
+	cgErr := c.UploadCg(ctx, stepID, cfg.GetSourceBranch(), cfg.GetTargetBranch(), timeMs, encCg)
+	ti.UploadDuration.Observe(time.Since(uploadStart).Seconds(), "callgraph", metrics.Status(cgErr))
+	if cgErr != nil {
 		return cgErr
 	}
 	log.Infoln(fmt.Sprintf("Successfully uploaded callgraph in %s time", time.Since(start)))
@@ -2,9 +2,11 @@ package config
 
 import (
 	"errors"
+	"net/http"
 	"sync"
 	"sync/atomic"
 
+	"github.com/harness/lite-engine/internal/fault"
 	"github.com/harness/ti-client/client"
 	"github.com/harness/ti-client/types"
 )
@@ -35,6 +37,13 @@ func New(endpoint, token, accountID, orgID, projectID, pipelineID, buildID, stag
 	sourceBranch, targetBranch, commitBranch, dataDir string, parseSavings, skipVerify bool) Cfg {
 	tiClient := client.NewHTTPClient(
 		endpoint, token, accountID, orgID, projectID, pipelineID, buildID, stageID, repo, sha, commitLink, skipVerify, "")
+	if fault.Enabled(fault.TI) {
+		base := tiClient.Client
+		if base == nil {
+			base = &http.Client{}
+		}
+		tiClient.Client = fault.HTTPClient(fault.TI, base)
+	}
 	cfg := Cfg{
 		mu:              &sync.Mutex{},
 		ziplocked:       1,
@@ -50,6 +59,12 @@ func New(endpoint, token, accountID, orgID, projectID, pipelineID, buildID, stag
 	return cfg
 }
 
+// Empty returns true if the config has no TI client, eg. before the stage
+// is set up.
+func (c *Cfg) Empty() bool {
+	return c.client == nil
+}
+
 func (c *Cfg) GetClient() client.Client {
 	return c.client
 }
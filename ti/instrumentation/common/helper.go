@@ -1,6 +1,8 @@
 package common
 
 import (
+	"time"
+
 	ti "github.com/harness/ti-client/types"
 	"github.com/mattn/go-zglob"
 )
@@ -41,6 +43,9 @@ type Node struct {
 // RunnerArgs to add additinal args for runner
 type RunnerArgs struct {
 	ModuleList []string
+	// TestTimeout is passed to the test frameworks supporting it so that they
+	// stop before the step times out. No timeout is set if 0.
+	TestTimeout time.Duration
 }
 
 // GetFiles gets list of all file paths matching a provided regex
@@ -40,6 +40,11 @@ func NewDotnetRunner(log *logrus.Logger, fs filesystem.FileSystem) *dotnetRunner
 	}
 }
 
+// YAMLConfig returns true, the agent reads a yaml config file.
+func (b *dotnetRunner) YAMLConfig() bool {
+	return true
+}
+
 func (b *dotnetRunner) AutoDetectPackages(workspace string) ([]string, error) {
 	return []string{}, nil
 }
@@ -35,6 +35,11 @@ func NewNunitConsoleRunner(log *logrus.Logger, fs filesystem.FileSystem) *nunitC
 	}
 }
 
+// YAMLConfig returns true, the agent reads a yaml config file.
+func (b *nunitConsoleRunner) YAMLConfig() bool {
+	return true
+}
+
 func (b *nunitConsoleRunner) AutoDetectPackages(workspace string) ([]string, error) {
 	return []string{}, nil
 }
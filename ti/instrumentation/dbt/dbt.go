@@ -0,0 +1,178 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package dbt selects and runs the dbt tests of a data pipeline. The tests
+// are selected from the changed models, seeds and snapshots and their
+// children, like the state:modified+ selector of dbt.
+package dbt
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dbtCmd = "dbt"
+	// RunResultsPath is the path of the results of the last dbt command,
+	// relative to the project directory.
+	RunResultsPath = "target/run_results.json"
+)
+
+// projectFiles configure the whole project, their changes select all the tests.
+var projectFiles = map[string]bool{
+	projectFile:        true,
+	"packages.yml":     true,
+	"dependencies.yml": true,
+	"package-lock.yml": true,
+	"selectors.yml":    true,
+	"profiles.yml":     true,
+}
+
+type dbtRunner struct {
+	fs  filesystem.FileSystem
+	log *logrus.Logger
+}
+
+func NewDbtRunner(log *logrus.Logger, fs filesystem.FileSystem) *dbtRunner { //nolint:revive
+	return &dbtRunner{
+		fs:  fs,
+		log: log,
+	}
+}
+
+func (r *dbtRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns a test per model of the project, the tests of a
+// model are run with `dbt test --select <model>`.
+func (r *dbtRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	p, err := readProject(r.fs, workspace)
+	if err != nil {
+		return nil, err
+	}
+	tests := make([]ti.RunnableTest, 0)
+	for _, dir := range p.ModelPaths {
+		files, err := common.GetFiles(filepath.Join(workspace, dir, "**", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if ext := strings.ToLower(filepath.Ext(file)); ext != ".sql" && ext != ".py" {
+				continue
+			}
+			tests = append(tests, ti.RunnableTest{Class: nodeName(filepath.ToSlash(file))})
+		}
+	}
+	return tests, nil
+}
+
+func (r *dbtRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+// GetTestGlobs returns no globs, the tests are selected by the dbt node
+// selectors rather than the test files.
+func (r *dbtRunner) GetTestGlobs() (includeGlobs, excludeGlobs []string) {
+	return []string{}, []string{}
+}
+
+func (r *dbtRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	if runAll {
+		return strings.TrimSpace(fmt.Sprintf("%s test %s", dbtCmd, userArgs)), nil
+	}
+	if len(tests) == 0 {
+		return "echo \"Skipping test run, received no tests to execute\"", nil
+	}
+	selectors := common.GetUniqueTestStrings(tests)
+	return strings.TrimSpace(fmt.Sprintf("%s test --select %s %s", dbtCmd, strings.Join(selectors, " "), userArgs)), nil
+}
+
+// SelectTests selects the tests of the nodes changed by the files and of
+// their children. All the tests are selected if a change may affect any
+// node, eg. a macro, or if a node is deleted, its children may break.
+func (r *dbtRunner) SelectTests(workspace string, files []ti.File) (ti.SelectTestsResp, error) {
+	p, err := readProject(r.fs, workspace)
+	if err != nil {
+		return ti.SelectTestsResp{}, err
+	}
+	all := ti.SelectTestsResp{SelectAll: true}
+	resp := ti.SelectTestsResp{}
+	selected := make(map[string]ti.Selection)
+	resources := append(append(append(append([]string{}, p.ModelPaths...), p.SeedPaths...), p.SnapshotPaths...), p.TestPaths...)
+	for _, f := range files {
+		file := strings.TrimPrefix(path.Clean(filepath.ToSlash(f.Name)), "./")
+		ext := strings.ToLower(path.Ext(file))
+		deleted := f.Status == ti.FileDeleted
+		switch {
+		case projectFiles[path.Base(file)] || in(file, p.MacroPaths):
+			r.log.Infoln(fmt.Sprintf("dbt: %s changes the whole project, selecting all the tests", file))
+			return all, nil
+		case (ext == ".yml" || ext == ".yaml") && in(file, resources):
+			if deleted {
+				r.log.Infoln(fmt.Sprintf("dbt: properties %s are deleted, selecting all the tests", file))
+				return all, nil
+			}
+			nodes, err := propertyNodes(r.fs, filepath.Join(workspace, filepath.FromSlash(file)))
+			if err != nil {
+				r.log.WithError(err).Warnln(fmt.Sprintf("dbt: cannot read properties %s, selecting all the tests", file))
+				return all, nil
+			}
+			for _, n := range nodes {
+				selectNode(selected, n+"+", ti.SelectSourceCode)
+			}
+		case ext == ".sql" && in(file, p.TestPaths):
+			if deleted {
+				continue
+			}
+			selection := ti.Selection(ti.SelectUpdatedTest)
+			if f.Status == ti.FileAdded {
+				selection = ti.SelectNewTest
+			}
+			selectNode(selected, nodeName(file), selection)
+		case (ext == ".sql" || ext == ".py") && in(file, p.ModelPaths),
+			ext == ".csv" && in(file, p.SeedPaths),
+			ext == ".sql" && in(file, p.SnapshotPaths):
+			if deleted {
+				r.log.Infoln(fmt.Sprintf("dbt: %s is deleted, selecting all the tests", file))
+				return all, nil
+			}
+			selectNode(selected, nodeName(file)+"+", ti.SelectSourceCode)
+		}
+	}
+
+	for selector, selection := range selected {
+		resp.Tests = append(resp.Tests, ti.RunnableTest{Class: selector, Selection: selection})
+		switch selection {
+		case ti.SelectNewTest:
+			resp.NewTests++
+		case ti.SelectUpdatedTest:
+			resp.UpdatedTests++
+		default:
+			resp.SrcCodeTests++
+		}
+	}
+	sort.Slice(resp.Tests, func(i, j int) bool { return resp.Tests[i].Class < resp.Tests[j].Class })
+	resp.SelectedTests = len(resp.Tests)
+	return resp, nil
+}
+
+// selectNode adds the node selector, a node selected by a source change
+// keeps this reason.
+func selectNode(selected map[string]ti.Selection, selector string, selection ti.Selection) {
+	if _, ok := selected[selector]; ok && selection != ti.SelectSourceCode {
+		return
+	}
+	selected[selector] = selection
+}
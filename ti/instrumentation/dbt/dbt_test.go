@@ -0,0 +1,99 @@
+package dbt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProject(t *testing.T) string {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"dbt_project.yml":           "name: jaffle_shop\nmodel-paths: [\"transform\"]\n",
+		"transform/orders.sql":      "select 1",
+		"transform/customers.py":    "def model(dbt, session): pass",
+		"transform/schema.yml":      "models:\n  - name: orders\n  - name: customers\nsources:\n  - name: raw\n    tables:\n      - name: payments\n",
+		"seeds/countries.csv":       "code\nfr\n",
+		"tests/assert_positive.sql": "select 1 where false",
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return workspace
+}
+
+func TestSelectTests(t *testing.T) {
+	workspace := newProject(t)
+	r := NewDbtRunner(logrus.New(), filesystem.New())
+
+	resp, err := r.SelectTests(workspace, []ti.File{
+		{Name: "transform/orders.sql", Status: ti.FileModified},
+		{Name: "seeds/countries.csv", Status: ti.FileAdded},
+		{Name: "tests/assert_positive.sql", Status: ti.FileAdded},
+		{Name: "README.md", Status: ti.FileModified},
+	})
+	assert.Nil(t, err)
+	assert.False(t, resp.SelectAll)
+	assert.Equal(t, []ti.RunnableTest{
+		{Class: "assert_positive", Selection: ti.SelectNewTest},
+		{Class: "countries+", Selection: ti.SelectSourceCode},
+		{Class: "orders+", Selection: ti.SelectSourceCode},
+	}, resp.Tests)
+	assert.Equal(t, 1, resp.NewTests)
+	assert.Equal(t, 2, resp.SrcCodeTests)
+
+	resp, err = r.SelectTests(workspace, []ti.File{{Name: "transform/schema.yml", Status: ti.FileModified}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"customers+", "orders+", "source:raw.payments+"}, common.GetUniqueTestStrings(resp.Tests))
+
+	// changes to the project configuration, the macros or a deleted model
+	// may affect any node
+	for _, f := range []ti.File{
+		{Name: "dbt_project.yml", Status: ti.FileModified},
+		{Name: "macros/cents_to_dollars.sql", Status: ti.FileAdded},
+		{Name: "transform/customers.py", Status: ti.FileDeleted},
+	} {
+		resp, err = r.SelectTests(workspace, []ti.File{f})
+		assert.Nil(t, err)
+		assert.True(t, resp.SelectAll, f.Name)
+	}
+
+	_, err = r.SelectTests(t.TempDir(), nil)
+	assert.Error(t, err)
+}
+
+func TestAutoDetectTests(t *testing.T) {
+	workspace := newProject(t)
+	r := NewDbtRunner(logrus.New(), filesystem.New())
+
+	tests, err := r.AutoDetectTests(context.Background(), workspace, nil)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"orders", "customers"}, common.GetUniqueTestStrings(tests))
+}
+
+func TestGetCmd(t *testing.T) {
+	r := NewDbtRunner(logrus.New(), filesystem.New())
+	ctx := context.Background()
+
+	cmd, err := r.GetCmd(ctx, nil, "--target ci", "", "", "", true, true, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "dbt test --target ci", cmd)
+
+	tests := []ti.RunnableTest{{Class: "orders+"}, {Class: "assert_positive"}, {Class: "orders+"}}
+	cmd, err = r.GetCmd(ctx, tests, "", "", "", "", false, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "dbt test --select orders+ assert_positive", cmd)
+
+	cmd, err = r.GetCmd(ctx, nil, "", "", "", "", false, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Contains(t, cmd, "Skipping test run")
+}
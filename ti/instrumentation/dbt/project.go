@@ -0,0 +1,114 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package dbt
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"gopkg.in/yaml.v2"
+)
+
+const projectFile = "dbt_project.yml"
+
+// project holds the resource paths of dbt_project.yml, relative to the
+// project directory.
+type project struct {
+	ModelPaths    []string `yaml:"model-paths"`
+	SeedPaths     []string `yaml:"seed-paths"`
+	SnapshotPaths []string `yaml:"snapshot-paths"`
+	TestPaths     []string `yaml:"test-paths"`
+	MacroPaths    []string `yaml:"macro-paths"`
+}
+
+// readProject reads dbt_project.yml of the workspace, with the default
+// paths of dbt for the paths which are not set.
+func readProject(fs filesystem.FileSystem, workspace string) (*project, error) {
+	p := new(project)
+	err := fs.ReadFile(filepath.Join(workspace, projectFile), func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return yaml.Unmarshal(data, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(p.ModelPaths) == 0 {
+		p.ModelPaths = []string{"models"}
+	}
+	if len(p.SeedPaths) == 0 {
+		p.SeedPaths = []string{"seeds"}
+	}
+	if len(p.SnapshotPaths) == 0 {
+		p.SnapshotPaths = []string{"snapshots"}
+	}
+	if len(p.TestPaths) == 0 {
+		p.TestPaths = []string{"tests"}
+	}
+	if len(p.MacroPaths) == 0 {
+		p.MacroPaths = []string{"macros"}
+	}
+	return p, nil
+}
+
+// in reports whether the slash separated file is in one of the directories.
+func in(file string, dirs []string) bool {
+	for _, dir := range dirs {
+		dir = strings.Trim(path.Clean(filepath.ToSlash(dir)), "/")
+		if strings.HasPrefix(file, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeName returns the name of the node defined in the file, the file name
+// without its extension.
+func nodeName(file string) string {
+	base := path.Base(file)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// propertyNodes returns the selectors of the nodes declared in a properties
+// file, eg. models/schema.yml. The tests of these nodes are declared in the
+// file so they are affected by its changes.
+func propertyNodes(fs filesystem.FileSystem, file string) ([]string, error) {
+	var props struct {
+		Models    []struct{ Name string } `yaml:"models"`
+		Seeds     []struct{ Name string } `yaml:"seeds"`
+		Snapshots []struct{ Name string } `yaml:"snapshots"`
+		Sources   []struct {
+			Name   string
+			Tables []struct{ Name string } `yaml:"tables"`
+		} `yaml:"sources"`
+	}
+	err := fs.ReadFile(file, func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return yaml.Unmarshal(data, &props)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, list := range [][]struct{ Name string }{props.Models, props.Seeds, props.Snapshots} {
+		for _, n := range list {
+			nodes = append(nodes, n.Name)
+		}
+	}
+	for _, s := range props.Sources {
+		for _, t := range s.Tables {
+			nodes = append(nodes, "source:"+s.Name+"."+t.Name)
+		}
+	}
+	return nodes, nil
+}
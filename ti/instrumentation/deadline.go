@@ -0,0 +1,50 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// TestDeadlineEnv is the unix time in seconds by which the tests need to complete.
+	TestDeadlineEnv = "HARNESS_TEST_DEADLINE"
+	// TestTimeoutEnv is the number of seconds the tests have left to run.
+	TestTimeoutEnv = "HARNESS_TEST_TIMEOUT_SECONDS"
+	// deadlineFlagsEnv enables the timeout flags of the test frameworks in the
+	// generated commands, eg. pytest --session-timeout which requires
+	// pytest-timeout 2.2 or later.
+	deadlineFlagsEnv = "HARNESS_TEST_DEADLINE_FLAGS"
+
+	// deadlineReserve is kept from the step timeout for the test frameworks to
+	// stop and write their reports.
+	deadlineReserve = 30 * time.Second
+)
+
+// InjectDeadline sets the deadline of the tests in the step environment, so
+// that the test frameworks can stop gracefully and still write their reports
+// before the step times out.
+func InjectDeadline(envs map[string]string, stepDeadline, now time.Time) {
+	timeout := stepDeadline.Sub(now) - deadlineReserve
+	if timeout < time.Second {
+		return
+	}
+	envs[TestDeadlineEnv] = strconv.FormatInt(now.Add(timeout).Unix(), 10)
+	envs[TestTimeoutEnv] = strconv.FormatInt(int64(timeout/time.Second), 10)
+}
+
+// testTimeout returns the timeout to pass to the test frameworks, or 0 if
+// the timeout flags are not enabled.
+func testTimeout(envs map[string]string) time.Duration {
+	if envs[deadlineFlagsEnv] != "true" {
+		return 0
+	}
+	secs, err := strconv.Atoi(envs[TestTimeoutEnv])
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,25 @@
+package instrumentation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectDeadline(t *testing.T) {
+	now := time.Unix(1000, 0)
+	envs := map[string]string{}
+	InjectDeadline(envs, now.Add(10*time.Minute), now)
+	assert.Equal(t, "570", envs[TestTimeoutEnv])
+	assert.Equal(t, "1570", envs[TestDeadlineEnv])
+	assert.Equal(t, time.Duration(0), testTimeout(envs))
+
+	envs[deadlineFlagsEnv] = "true"
+	assert.Equal(t, 570*time.Second, testTimeout(envs))
+
+	// no time left for the tests before the reserve
+	envs = map[string]string{}
+	InjectDeadline(envs, now.Add(20*time.Second), now)
+	assert.Empty(t, envs)
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/client"
+	ti "github.com/harness/ti-client/types"
+)
+
+// DebugBundle is the context of the test selection of a step, exported so
+// that the support can tell why the tests were selected or skipped.
+type DebugBundle struct {
+	StepID       string              `json:"step_id"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Config       *DebugConfig        `json:"config,omitempty"`
+	ChangedFiles []ti.File           `json:"changed_files,omitempty"`
+	Request      *ti.SelectTestsReq  `json:"request,omitempty"`  // the request to the TI service, with the ticonfig of the workspace
+	Response     *ti.SelectTestsResp `json:"response,omitempty"` // the response of the TI service
+	Error        string              `json:"error,omitempty"`    // the error of the selection, all the tests are run
+	Selection    *ti.SelectTestsResp `json:"selection,omitempty"`
+	Files        map[string]string   `json:"files,omitempty"` // the generated filter and config files by path
+	Command      string              `json:"command,omitempty"`
+}
+
+// DebugConfig is the test intelligence configuration of the stage, without
+// its token.
+type DebugConfig struct {
+	URL          string `json:"url,omitempty"`
+	AccountID    string `json:"account_id,omitempty"`
+	OrgID        string `json:"org_id,omitempty"`
+	ProjectID    string `json:"project_id,omitempty"`
+	PipelineID   string `json:"pipeline_id,omitempty"`
+	StageID      string `json:"stage_id,omitempty"`
+	BuildID      string `json:"build_id,omitempty"`
+	Sha          string `json:"sha,omitempty"`
+	SourceBranch string `json:"source_branch,omitempty"`
+	TargetBranch string `json:"target_branch,omitempty"`
+	IgnoreInstr  bool   `json:"ignore_instr,omitempty"`
+}
+
+type debugKey struct{}
+
+// debugCapture is the debug bundle captured in the context of a step
+// execution, nil once it is written.
+type debugCapture struct {
+	mu     sync.Mutex
+	bundle *DebugBundle
+}
+
+// DebugBundleFile is the file the debug bundle of the step is written to.
+func DebugBundleFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-ti-debug.json", pipeline.SharedVolPath, stepID)
+}
+
+// EnableDebugBundle returns a context capturing the selection context of
+// the step, by its id, until its debug bundle is written. The parallel
+// executions of steps with the same name capture their own bundles.
+func EnableDebugBundle(ctx context.Context, stepID string) context.Context {
+	return context.WithValue(ctx, debugKey{}, &debugCapture{bundle: &DebugBundle{StepID: stepID, CreatedAt: time.Now()}})
+}
+
+// CaptureDebug updates the debug bundle of the context, if it is enabled.
+func CaptureDebug(ctx context.Context, capture func(b *DebugBundle)) {
+	c, ok := ctx.Value(debugKey{}).(*debugCapture)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bundle != nil {
+		capture(c.bundle)
+	}
+}
+
+// CaptureDebugFile adds the content of the generated file to the debug
+// bundle of the context, if it is enabled.
+func CaptureDebugFile(ctx context.Context, path string) {
+	if path == "" {
+		return
+	}
+	CaptureDebug(ctx, func(b *DebugBundle) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		if b.Files == nil {
+			b.Files = make(map[string]string)
+		}
+		b.Files[path] = string(data)
+	})
+}
+
+// WriteDebugBundle writes the debug bundle of the context to the file of
+// its step, with the secrets and the TI token redacted, and stops
+// capturing. It returns the path of the file, empty if the debug bundle is
+// not enabled.
+func WriteDebugBundle(ctx context.Context, cfg *tiCfg.Cfg, secrets []string) (string, error) {
+	c, ok := ctx.Value(debugKey{}).(*debugCapture)
+	if !ok {
+		return "", nil
+	}
+	c.mu.Lock()
+	b := c.bundle
+	c.bundle = nil
+	c.mu.Unlock()
+	if b == nil {
+		return "", nil
+	}
+	// the configuration of the engine state is not set until the setup
+	if c, ok := cfg.GetClient().(*client.HTTPClient); ok && c != nil {
+		b.Config = &DebugConfig{URL: cfg.GetURL(), AccountID: cfg.GetAccountID(), OrgID: cfg.GetOrgID(),
+			ProjectID: cfg.GetProjectID(), PipelineID: cfg.GetPipelineID(), StageID: cfg.GetStageID(),
+			BuildID: cfg.GetBuildID(), Sha: cfg.GetSha(), SourceBranch: cfg.GetSourceBranch(),
+			TargetBranch: cfg.GetTargetBranch(), IgnoreInstr: cfg.GetIgnoreInstr()}
+		secrets = append(append([]string{}, secrets...), cfg.GetToken())
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := DebugBundleFile(b.StepID)
+	if err := os.WriteFile(path, []byte(logstream.Redact(string(data), secrets)), recordFilePerm); err != nil {
+		return "", err
+	}
+	return path, nil
+}
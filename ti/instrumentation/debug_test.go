@@ -0,0 +1,65 @@
+package instrumentation
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugBundle(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	cfg := tiCfg.New("https://ti.harness.io", "ti-token", "account", "org", "project", "pipeline", "1", "stage", "", "", "",
+		"feature", "main", "", "", false, false)
+	filter := filepath.Join(t.TempDir(), "filter_1")
+	assert.NoError(t, os.WriteFile(filter, []byte("io.harness.FooTest\n"), 0600))
+
+	// nothing is captured until the bundle is enabled
+	ctx := context.Background()
+	CaptureDebug(ctx, func(b *DebugBundle) { b.Command = "mvn test" })
+	path, err := WriteDebugBundle(ctx, &cfg, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	// the bundles of the executions are keyed by the step id
+	ctx = EnableDebugBundle(ctx, "step-unit-1")
+	other := EnableDebugBundle(context.Background(), "step-unit-2")
+	CaptureDebug(ctx, func(b *DebugBundle) { b.ChangedFiles = []ti.File{{Name: "src/Foo.java", Status: ti.FileModified}} })
+	CaptureDebug(other, func(b *DebugBundle) { b.Command = "mvn verify" })
+	CaptureDebugFile(ctx, filter)
+	RecordSelection(ctx, "unit", &ti.SelectTestsResp{Tests: []ti.RunnableTest{{Pkg: "io.harness", Class: "FooTest"}}})
+	CaptureDebug(ctx, func(b *DebugBundle) { b.Command = "mvn test -Dtoken=ti-token -Dpassword=s3cr3t" })
+	path, err = WriteDebugBundle(ctx, &cfg, []string{"s3cr3t"})
+	assert.NoError(t, err)
+	defer os.Remove(path)
+	defer os.Remove(recordFile("unit"))
+	assert.Equal(t, DebugBundleFile("step-unit-1"), path)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "ti-token")
+	assert.NotContains(t, string(data), "s3cr3t")
+	var b DebugBundle
+	assert.NoError(t, json.Unmarshal(data, &b))
+	assert.Equal(t, "account", b.Config.AccountID)
+	assert.Equal(t, "main", b.Config.TargetBranch)
+	assert.Equal(t, []ti.File{{Name: "src/Foo.java", Status: ti.FileModified}}, b.ChangedFiles)
+	assert.Equal(t, "io.harness.FooTest\n", b.Files[filter])
+	assert.Equal(t, "FooTest", b.Selection.Tests[0].Class)
+
+	assert.Equal(t, "step-unit-1", b.StepID)
+	assert.Contains(t, b.Command, "mvn test -Dtoken=")
+
+	// the bundle is written once
+	path, err = WriteDebugBundle(ctx, &cfg, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+}
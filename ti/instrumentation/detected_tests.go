@@ -0,0 +1,122 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	detectedTestsPerm = 0600
+	// detectWaitTimeout is how long a step waits for the tests detected by
+	// another step, a lock older than it is considered abandoned.
+	detectWaitTimeout  = 10 * time.Minute
+	detectPollInterval = 500 * time.Millisecond
+)
+
+// detectedTestsDir keeps the tests detected for the parallel steps.
+var detectedTestsDir = pipeline.SharedVolPath
+
+// cachedAutoDetect returns the tests of the workspace detected by detect.
+// The tests are cached on the shared volume by commit, workspace, runner
+// and test globs, so the parallel steps of a stage walk the workspace once:
+// the first step detects the tests while the others wait for its result.
+// The tests are not cached if the commit is not known.
+func cachedAutoDetect(ctx context.Context, cfg *tiCfg.Cfg, workspace, runner string, testGlobs []string, log *logrus.Logger,
+	detect func() ([]ti.RunnableTest, error)) ([]ti.RunnableTest, error) {
+	if cfg == nil || cfg.GetSha() == "" {
+		return detect()
+	}
+	key := detectedTestsKey(cfg.GetSha(), workspace, runner, testGlobs)
+	file := filepath.Join(detectedTestsDir, "detected-tests-"+key+".json")
+	lock := file + ".lock"
+
+	for start := time.Now(); ; {
+		if tests, err := readDetectedTests(file); err == nil {
+			log.Infoln(fmt.Sprintf("Using the %d tests detected by another parallel step", len(tests)))
+			return tests, nil
+		}
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, detectedTestsPerm)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return detect()
+		}
+		if info, serr := os.Stat(lock); serr == nil && time.Since(info.ModTime()) > detectWaitTimeout {
+			log.Warnln("the tests detection of another parallel step is abandoned, detecting the tests")
+			return detect()
+		}
+		if time.Since(start) > detectWaitTimeout {
+			log.Warnln("timed out waiting for the tests detected by another parallel step, detecting the tests")
+			return detect()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(detectPollInterval):
+		}
+	}
+
+	// the lock is released once the tests are written, the waiting steps
+	// detect the tests themselves if the detection failed.
+	defer os.Remove(lock)
+	tests, err := detect()
+	if err != nil || len(tests) == 0 {
+		return tests, err
+	}
+	if werr := writeDetectedTests(file, tests); werr != nil {
+		log.WithError(werr).Warnln("cannot share the detected tests with the parallel steps")
+	}
+	return tests, nil
+}
+
+// detectedTestsKey identifies the tests detected in the workspace at the
+// commit by the runner with the globs, in any order.
+func detectedTestsKey(sha, workspace, runner string, testGlobs []string) string {
+	globs := append([]string(nil), testGlobs...)
+	sort.Strings(globs)
+	h := sha256.Sum256([]byte(strings.Join([]string{sha, workspace, runner, strings.Join(globs, ",")}, "\n")))
+	return hex.EncodeToString(h[:])
+}
+
+func readDetectedTests(file string) ([]ti.RunnableTest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tests []ti.RunnableTest
+	if err = json.Unmarshal(data, &tests); err != nil {
+		return nil, err
+	}
+	return tests, nil
+}
+
+func writeDetectedTests(file string, tests []ti.RunnableTest) error {
+	data, err := json.Marshal(tests)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, detectedTestsPerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
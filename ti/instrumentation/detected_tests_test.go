@@ -0,0 +1,72 @@
+package instrumentation
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedAutoDetect(t *testing.T) {
+	prev := detectedTestsDir
+	detectedTestsDir = t.TempDir()
+	defer func() { detectedTestsDir = prev }()
+
+	cfg := tiCfg.New("", "", "account", "org", "project", "pipeline", "1", "stage", "", "abc123", "", "", "", "", "", false, false)
+	want := []ti.RunnableTest{{Pkg: "io.harness", Class: "ATest"}, {Pkg: "io.harness", Class: "BTest"}}
+	var walks int32
+	detect := func() ([]ti.RunnableTest, error) {
+		atomic.AddInt32(&walks, 1)
+		time.Sleep(50 * time.Millisecond)
+		return want, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tests, err := cachedAutoDetect(context.Background(), &cfg, "/harness", "maven", []string{"b/**", "a/**"}, logrus.New(), detect)
+			assert.NoError(t, err)
+			assert.Equal(t, want, tests)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), walks)
+
+	// the globs are part of the key, in any order
+	_, err := cachedAutoDetect(context.Background(), &cfg, "/harness", "maven", []string{"a/**", "b/**"}, logrus.New(), detect)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), walks)
+	_, err = cachedAutoDetect(context.Background(), &cfg, "/harness", "maven", []string{"a/**"}, logrus.New(), detect)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), walks)
+
+	entries, err := os.ReadDir(detectedTestsDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2) // no lock left
+}
+
+func TestCachedAutoDetectNoCommit(t *testing.T) {
+	prev := detectedTestsDir
+	detectedTestsDir = t.TempDir()
+	defer func() { detectedTestsDir = prev }()
+
+	cfg := tiCfg.New("", "", "", "", "", "", "", "", "", "", "", "", "", "", "", false, false)
+	var walks int
+	for i := 0; i < 2; i++ {
+		_, _ = cachedAutoDetect(context.Background(), &cfg, "/harness", "maven", nil, logrus.New(), func() ([]ti.RunnableTest, error) {
+			walks++
+			return []ti.RunnableTest{{Class: "ATest"}}, nil
+		})
+	}
+	assert.Equal(t, 2, walks)
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package external runs the tests of the frameworks which are not supported
+// by the engine with a runner shipped by the user, eg. in the step image.
+//
+// The runner is an executable called once per request with the request as
+// JSON on its stdin, it writes the response as JSON on its stdout and its
+// logs on its stderr. It is run in the workspace with the step variables.
+//
+//	{"type": "autodetect", "workspace": "/harness", "test_globs": ["**/*_spec.lua"]}
+//	{"tests": [{"pkg": "", "class": "spec/parser_spec.lua", "method": ""}]}
+//
+//	{"type": "select_tests", "workspace": "/harness", "tests": [...], "user_args": "-v", "run_all": false}
+//	{"command": "busted -v spec/parser_spec.lua"}
+//
+// The runner fails a request with an error in the response or a non zero
+// exit code. The tests are selected by the TI service and no agent is
+// installed.
+//
+// The runners of the container steps run in a container of the step image,
+// see Exec, the runners of the host steps run on the host with the step
+// variables only.
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+// RunnerEnv is the step variable with the path of the runner, relative to
+// the workspace or absolute.
+const RunnerEnv = "HARNESS_TI_RUNNER"
+
+// The request types.
+const (
+	RequestAutodetect  = "autodetect"
+	RequestSelectTests = "select_tests"
+)
+
+// Request is written to the stdin of the runner.
+type Request struct {
+	Type      string            `json:"type"`
+	Workspace string            `json:"workspace"`
+	TestGlobs []string          `json:"test_globs,omitempty"`
+	Tests     []ti.RunnableTest `json:"tests,omitempty"`
+	UserArgs  string            `json:"user_args,omitempty"`
+	RunAll    bool              `json:"run_all,omitempty"`
+	// TestTimeout is the time in seconds the tests should complete in, so
+	// that they stop before the step times out. No timeout if 0.
+	TestTimeout int64 `json:"test_timeout,omitempty"`
+}
+
+// Response is read from the stdout of the runner.
+type Response struct {
+	Tests   []ti.RunnableTest `json:"tests,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// Exec runs the runner binary in the workspace with the request on its
+// stdin, and returns its stdout. Its stderr is written to stderr.
+type Exec func(ctx context.Context, binary, workspace string, stdin []byte, stderr io.Writer) ([]byte, error)
+
+type externalRunner struct {
+	binary    string
+	exec      Exec
+	testGlobs []string
+	log       *logrus.Logger
+}
+
+// NewExternalRunner returns the runner running the binary with the exec,
+// on the host with the step variables if the exec is nil.
+func NewExternalRunner(log *logrus.Logger, binary string, testGlobs []string, envs map[string]string, exec Exec) *externalRunner { //nolint:revive
+	if exec == nil {
+		exec = HostExec(envs)
+	}
+	return &externalRunner{
+		binary:    binary,
+		exec:      exec,
+		testGlobs: testGlobs,
+		log:       log,
+	}
+}
+
+func (r *externalRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns the tests listed by the runner.
+func (r *externalRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	resp, err := r.call(ctx, &Request{Type: RequestAutodetect, Workspace: workspace, TestGlobs: testGlobs})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Tests == nil {
+		return []ti.RunnableTest{}, nil
+	}
+	return resp.Tests, nil
+}
+
+func (r *externalRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+func (r *externalRunner) GetTestGlobs() (includeGlobs, excludeGlobs []string) {
+	return r.testGlobs, []string{}
+}
+
+// GetCmd returns the command of the runner to run the selected tests.
+func (r *externalRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	resp, err := r.call(ctx, &Request{
+		Type:        RequestSelectTests,
+		Workspace:   workspace,
+		Tests:       tests,
+		UserArgs:    userArgs,
+		RunAll:      runAll,
+		TestTimeout: int64(runnerArgs.TestTimeout.Seconds()),
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(resp.Command) == "" {
+		return "", fmt.Errorf("test runner %s returned no command", r.binary)
+	}
+	return resp.Command, nil
+}
+
+// Agentless returns true, the external runners run the tests without the TI
+// agents.
+func (r *externalRunner) Agentless() bool {
+	return true
+}
+
+// call runs the runner with the request and decodes its response.
+func (r *externalRunner) call(ctx context.Context, req *Request) (*Response, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	stdout, err := r.exec(ctx, r.binary, req.Workspace, in, &stderr)
+	if s := strings.TrimSpace(stderr.String()); s != "" {
+		r.log.Infoln(fmt.Sprintf("test runner %s: %s", r.binary, s))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("test runner %s failed the %s request: %w", r.binary, req.Type, err)
+	}
+	resp := new(Response)
+	if err := json.Unmarshal(stdout, resp); err != nil {
+		return nil, fmt.Errorf("test runner %s returned an invalid %s response: %w", r.binary, req.Type, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("test runner %s: %s", r.binary, resp.Error)
+	}
+	return resp, nil
+}
+
+// HostExec returns the exec running the runner on the host, for the host
+// steps. The runner gets the step variables and not the environment of
+// the engine, the PATH of the engine is only set if the step has none.
+func HostExec(envs map[string]string) Exec {
+	return func(ctx context.Context, binary, workspace string, stdin []byte, stderr io.Writer) ([]byte, error) {
+		if !filepath.IsAbs(binary) && strings.ContainsRune(binary, filepath.Separator) {
+			binary = filepath.Join(workspace, binary)
+		}
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, binary) //nolint:gosec
+		cmd.Dir = workspace
+		cmd.Env = environ(envs)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		return stdout.Bytes(), err
+	}
+}
+
+// environ returns the step variables, with the PATH of the engine if they
+// have none.
+func environ(envs map[string]string) []string {
+	env := make([]string, 0, len(envs)+1)
+	for k, v := range envs {
+		env = append(env, k+"="+v)
+	}
+	if _, ok := envs["PATH"]; !ok {
+		env = append(env, "PATH="+os.Getenv("PATH"))
+	}
+	return env
+}
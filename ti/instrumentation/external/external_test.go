@@ -0,0 +1,74 @@
+package external
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// runner matches the requests of the engine to answer them.
+const runner = `#!/bin/sh
+echo "runner of $RUNNER_NAME" >&2
+req=$(cat)
+case "$req" in
+*'"type":"autodetect"'*) echo '{"tests":[{"pkg":"spec","class":"parser_spec.lua","method":""}]}' ;;
+*'"run_all":true'*) echo '{"command":"busted"}' ;;
+*'"class":"parser_spec.lua"'*'"test_timeout":60'*) echo '{"command":"busted spec/parser_spec.lua"}' ;;
+*'"user_args":"fail"'*) echo '{"error":"no tests"}' ;;
+*) echo '{}' ;;
+esac
+`
+
+func writeRunner(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "runner"), []byte(runner), 0o700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExternalRunner(t *testing.T) {
+	workspace := writeRunner(t)
+	ctx := context.Background()
+	r := NewExternalRunner(logrus.New(), "./runner", []string{"**/*_spec.lua"}, map[string]string{"RUNNER_NAME": "busted"}, nil)
+
+	tests, err := r.AutoDetectTests(ctx, workspace, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []ti.RunnableTest{{Pkg: "spec", Class: "parser_spec.lua"}}, tests)
+
+	cmd, err := r.GetCmd(ctx, tests, "", workspace, "", "", true, false, common.RunnerArgs{TestTimeout: time.Minute})
+	assert.Nil(t, err)
+	assert.Equal(t, "busted spec/parser_spec.lua", cmd)
+
+	cmd, err = r.GetCmd(ctx, nil, "", workspace, "", "", true, true, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "busted", cmd)
+
+	_, err = r.GetCmd(ctx, nil, "fail", workspace, "", "", true, false, common.RunnerArgs{})
+	assert.EqualError(t, err, "test runner ./runner: no tests")
+
+	_, err = r.GetCmd(ctx, nil, "", workspace, "", "", true, false, common.RunnerArgs{})
+	assert.EqualError(t, err, "test runner ./runner returned no command")
+}
+
+func TestExternalRunnerMissing(t *testing.T) {
+	r := NewExternalRunner(logrus.New(), "./missing", nil, nil, nil)
+	_, err := r.AutoDetectTests(context.Background(), t.TempDir(), nil)
+	assert.NotNil(t, err)
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("ENGINE_SECRET", "secret")
+	env := environ(map[string]string{"RUNNER_NAME": "busted"})
+	assert.Contains(t, env, "RUNNER_NAME=busted")
+	assert.Contains(t, env, "PATH="+os.Getenv("PATH"))
+	assert.NotContains(t, env, "ENGINE_SECRET=secret")
+	assert.Equal(t, []string{"PATH=/bin"}, environ(map[string]string{"PATH": "/bin"}))
+}
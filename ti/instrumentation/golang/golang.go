@@ -0,0 +1,239 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package golang selects and runs the go tests of a module by package. The
+// tests of the packages of the changed files are selected, with the tests
+// of the packages of the module depending on them.
+package golang
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const goTestCmd = "go test"
+
+// moduleFiles configure the whole module, their changes select all the tests.
+var moduleFiles = map[string]bool{
+	modFile:       true,
+	"go.sum":      true,
+	"go.work":     true,
+	"go.work.sum": true,
+}
+
+type goTestRunner struct {
+	fs  filesystem.FileSystem
+	log *logrus.Logger
+}
+
+func NewGoTestRunner(log *logrus.Logger, fs filesystem.FileSystem) *goTestRunner { //nolint:revive
+	return &goTestRunner{
+		fs:  fs,
+		log: log,
+	}
+}
+
+func (r *goTestRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns a test per package of the module with tests, the
+// tests of a package are run with `go test ./<package>`.
+func (r *goTestRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	module, err := readModulePath(r.fs, workspace)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := readPackages(workspace, module)
+	if err != nil {
+		return nil, err
+	}
+	tests := make([]ti.RunnableTest, 0)
+	for _, p := range pkgs {
+		if p.hasTests {
+			tests = append(tests, runnableTest(module, p.dir, ""))
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Class < tests[j].Class })
+	return tests, nil
+}
+
+func (r *goTestRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+// GetTestGlobs returns no globs, the tests are selected by package rather
+// than by test file.
+func (r *goTestRunner) GetTestGlobs() (includeGlobs, excludeGlobs []string) {
+	return []string{}, []string{}
+}
+
+func (r *goTestRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	args := []string{goTestCmd}
+	if runnerArgs.TestTimeout > 0 {
+		args = append(args, fmt.Sprintf("-timeout=%ds", int(runnerArgs.TestTimeout.Seconds())))
+	}
+	if userArgs = strings.TrimSpace(userArgs); userArgs != "" {
+		args = append(args, userArgs)
+	}
+	if runAll {
+		return strings.Join(append(args, "./..."), " "), nil
+	}
+	if len(tests) == 0 {
+		return "echo \"Skipping test run, received no tests to execute\"", nil
+	}
+	return strings.Join(append(args, common.GetUniqueTestStrings(tests)...), " "), nil
+}
+
+// SelectTests selects the tests of the packages of the changed files and of
+// the packages importing them, directly or not. All the tests are selected
+// if the dependencies of the module change or if a package is deleted.
+func (r *goTestRunner) SelectTests(workspace string, files []ti.File) (ti.SelectTestsResp, error) {
+	module, err := readModulePath(r.fs, workspace)
+	if err != nil {
+		return ti.SelectTestsResp{}, err
+	}
+	pkgs, err := readPackages(workspace, module)
+	if err != nil {
+		return ti.SelectTestsResp{}, err
+	}
+	all := ti.SelectTestsResp{SelectAll: true}
+
+	changed := make(map[string]bool)             // the packages with changed sources
+	testChanges := make(map[string]ti.Selection) // the packages with changed tests
+	for _, f := range files {
+		file := strings.TrimPrefix(path.Clean(filepath.ToSlash(f.Name)), "./")
+		if moduleFiles[path.Base(file)] && path.Dir(file) == "." {
+			r.log.Infoln(fmt.Sprintf("go: %s changes the whole module, selecting all the tests", file))
+			return all, nil
+		}
+		dir := path.Dir(file)
+		if path.Ext(file) != ".go" {
+			dir = packageDir(pkgs, file)
+		} else if _, ok := pkgs[dir]; !ok {
+			dir = ""
+		}
+		if dir == "" {
+			if path.Ext(file) == ".go" && f.Status == ti.FileDeleted {
+				r.log.Infoln(fmt.Sprintf("go: the package of %s is deleted, selecting all the tests", file))
+				return all, nil
+			}
+			continue
+		}
+		if strings.HasSuffix(file, "_test.go") {
+			if f.Status == ti.FileAdded {
+				selectPackage(testChanges, dir, ti.SelectNewTest)
+			} else {
+				selectPackage(testChanges, dir, ti.SelectUpdatedTest)
+			}
+			continue
+		}
+		changed[dir] = true
+	}
+
+	// the packages depending on the changed ones
+	affected := make(map[string]bool)
+	for dir := range changed {
+		affected[dir] = true
+	}
+	for added := true; added; {
+		added = false
+		for dir, p := range pkgs {
+			if affected[dir] {
+				continue
+			}
+			for imp := range p.imports {
+				if affected[imp] {
+					affected[dir] = true
+					added = true
+					break
+				}
+			}
+		}
+	}
+
+	selected := make(map[string]ti.Selection)
+	for dir, selection := range testChanges {
+		selected[dir] = selection
+	}
+	for dir, p := range pkgs {
+		if !p.hasTests {
+			continue
+		}
+		if affected[dir] {
+			selectPackage(selected, dir, ti.SelectSourceCode)
+			continue
+		}
+		for imp := range p.testImports {
+			if affected[imp] {
+				selectPackage(selected, dir, ti.SelectSourceCode)
+				break
+			}
+		}
+	}
+
+	resp := ti.SelectTestsResp{}
+	for _, p := range pkgs {
+		if p.hasTests {
+			resp.TotalTests++
+		}
+	}
+	for dir, selection := range selected {
+		test := runnableTest(module, dir, selection)
+		resp.Tests = append(resp.Tests, test)
+		switch selection {
+		case ti.SelectNewTest:
+			resp.NewTests++
+		case ti.SelectUpdatedTest:
+			resp.UpdatedTests++
+		default:
+			resp.SrcCodeTests++
+		}
+	}
+	sort.Slice(resp.Tests, func(i, j int) bool { return resp.Tests[i].Class < resp.Tests[j].Class })
+	resp.SelectedTests = len(resp.Tests)
+	return resp, nil
+}
+
+// packageDir returns the directory of the package of a file of the module
+// which is not a go file, the files of the subdirectories of a package
+// which are not packages, eg. testdata, belong to the package.
+func packageDir(pkgs map[string]*pkg, file string) string {
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		if _, ok := pkgs[dir]; ok {
+			return dir
+		}
+		if dir == "." {
+			return ""
+		}
+	}
+}
+
+// selectPackage adds the package, a package selected by a source change
+// keeps this reason.
+func selectPackage(selected map[string]ti.Selection, dir string, selection ti.Selection) {
+	if _, ok := selected[dir]; ok && selection != ti.SelectSourceCode {
+		return
+	}
+	selected[dir] = selection
+}
+
+// runnableTest returns the test of the package of the directory, its class
+// is the pattern of the package for go test.
+func runnableTest(module, dir string, selection ti.Selection) ti.RunnableTest {
+	if dir == "." {
+		return ti.RunnableTest{Pkg: module, Class: ".", Selection: selection}
+	}
+	return ti.RunnableTest{Pkg: module + "/" + dir, Class: "./" + dir, Selection: selection}
+}
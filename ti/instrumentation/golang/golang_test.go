@@ -0,0 +1,115 @@
+package golang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newModule(t *testing.T) string {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"go.mod":                          "module example.com/shop\n\ngo 1.19\n",
+		"main.go":                         "package main\n\nimport _ \"example.com/shop/api\"\n",
+		"api/api.go":                      "package api\n\nimport _ \"example.com/shop/store\"\n",
+		"api/api_test.go":                 "package api\n",
+		"store/store.go":                  "package store\n\nimport \"fmt\"\n",
+		"store/store_test.go":             "package store\n",
+		"store/testdata/orders.json":      "[]",
+		"money/money.go":                  "package money\n",
+		"money/money_test.go":             "package money\n\nimport _ \"example.com/shop/internal/fixtures\"\n",
+		"internal/fixtures/fixtures.go":   "package fixtures\n",
+		"vendor/example.com/x/x.go":       "package x\n",
+		"tools/go.mod":                    "module example.com/shop/tools\n",
+		"tools/lint/lint_test.go":         "package lint\n",
+		"docs/README.md":                  "# shop",
+		"internal/fixtures/data/cart.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return workspace
+}
+
+func TestSelectTests(t *testing.T) {
+	workspace := newModule(t)
+	r := NewGoTestRunner(logrus.New(), filesystem.New())
+
+	resp, err := r.SelectTests(workspace, []ti.File{
+		{Name: "store/store.go", Status: ti.FileModified},
+		{Name: "money/money_test.go", Status: ti.FileAdded},
+		{Name: "docs/README.md", Status: ti.FileModified},
+	})
+	assert.Nil(t, err)
+	assert.False(t, resp.SelectAll)
+	assert.Equal(t, []ti.RunnableTest{
+		{Pkg: "example.com/shop/api", Class: "./api", Selection: ti.SelectSourceCode},
+		{Pkg: "example.com/shop/money", Class: "./money", Selection: ti.SelectNewTest},
+		{Pkg: "example.com/shop/store", Class: "./store", Selection: ti.SelectSourceCode},
+	}, resp.Tests)
+	assert.Equal(t, 3, resp.TotalTests)
+	assert.Equal(t, 1, resp.NewTests)
+	assert.Equal(t, 2, resp.SrcCodeTests)
+
+	// the fixtures are imported by the tests of money only, the test data
+	// belongs to the package
+	resp, err = r.SelectTests(workspace, []ti.File{
+		{Name: "internal/fixtures/data/cart.txt", Status: ti.FileModified},
+		{Name: "store/testdata/orders.json", Status: ti.FileModified},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"./api", "./money", "./store"}, common.GetUniqueTestStrings(resp.Tests))
+
+	resp, err = r.SelectTests(workspace, []ti.File{{Name: "main.go", Status: ti.FileModified}})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Tests)
+
+	for _, f := range []ti.File{
+		{Name: "go.sum", Status: ti.FileModified},
+		{Name: "orders/orders.go", Status: ti.FileDeleted},
+	} {
+		resp, err = r.SelectTests(workspace, []ti.File{f})
+		assert.Nil(t, err)
+		assert.True(t, resp.SelectAll, f.Name)
+	}
+
+	_, err = r.SelectTests(t.TempDir(), nil)
+	assert.Error(t, err)
+}
+
+func TestAutoDetectTests(t *testing.T) {
+	workspace := newModule(t)
+	r := NewGoTestRunner(logrus.New(), filesystem.New())
+
+	tests, err := r.AutoDetectTests(context.Background(), workspace, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"./api", "./money", "./store"}, common.GetUniqueTestStrings(tests))
+}
+
+func TestGetCmd(t *testing.T) {
+	r := NewGoTestRunner(logrus.New(), filesystem.New())
+	ctx := context.Background()
+	tests := []ti.RunnableTest{{Class: "./api"}, {Class: "./store"}}
+
+	cmd, err := r.GetCmd(ctx, tests, "-race", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "go test -race ./api ./store", cmd)
+
+	cmd, err = r.GetCmd(ctx, tests, "", "", "", "", true, true, common.RunnerArgs{TestTimeout: time.Minute})
+	assert.Nil(t, err)
+	assert.Equal(t, "go test -timeout=60s ./...", cmd)
+
+	cmd, err = r.GetCmd(ctx, nil, "", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "echo \"Skipping test run, received no tests to execute\"", cmd)
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"bufio"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+)
+
+const modFile = "go.mod"
+
+// pkg is a package of the module.
+type pkg struct {
+	dir         string          // relative to the module, slash separated, "." for the root
+	hasTests    bool            // whether the package has _test.go files
+	imports     map[string]bool // the packages of the module imported by the package files
+	testImports map[string]bool // the packages of the module imported by the test files only
+}
+
+// readModulePath returns the module path of go.mod of the workspace.
+func readModulePath(fsys filesystem.FileSystem, workspace string) (string, error) {
+	var module string
+	err := fsys.ReadFile(filepath.Join(workspace, modFile), func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "module" {
+				module = strings.Trim(fields[1], `"`)
+				return nil
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	if module == "" {
+		return "", fmt.Errorf("no module path in %s", modFile)
+	}
+	return module, nil
+}
+
+// readPackages returns the packages of the module of the workspace by
+// directory. The vendor and testdata directories, the hidden ones and the
+// nested modules are skipped. The build constraints are ignored, the
+// imports of all the files are kept.
+func readPackages(workspace, module string) (map[string]*pkg, error) {
+	pkgs := make(map[string]*pkg)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if exists(filepath.Join(p, modFile)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(rel, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil //nolint:nilerr // the package fails to build, its tests are run if it changes
+		}
+		dir := path.Dir(rel)
+		pk := pkgs[dir]
+		if pk == nil {
+			pk = &pkg{dir: dir, imports: make(map[string]bool), testImports: make(map[string]bool)}
+			pkgs[dir] = pk
+		}
+		test := strings.HasSuffix(rel, "_test.go")
+		pk.hasTests = pk.hasTests || test
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			d, ok := moduleDir(module, imp)
+			if !ok {
+				continue
+			}
+			if test {
+				pk.testImports[d] = true
+			} else {
+				pk.imports[d] = true
+			}
+		}
+		return nil
+	})
+	return pkgs, err
+}
+
+// moduleDir returns the directory of a package of the module from its
+// import path.
+func moduleDir(module, importPath string) (string, bool) {
+	if importPath == module {
+		return ".", true
+	}
+	if strings.HasPrefix(importPath, module+"/") {
+		return strings.TrimPrefix(importPath, module+"/"), true
+	}
+	return "", false
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/harness/lite-engine/internal/filesystem"
 	tiCfg "github.com/harness/lite-engine/ti/config"
 	"github.com/harness/lite-engine/ti/instrumentation/common"
+	"github.com/harness/lite-engine/ti/instrumentation/dbt"
+	"github.com/harness/lite-engine/ti/instrumentation/external"
 	"github.com/harness/lite-engine/ti/instrumentation/java"
 	"github.com/harness/lite-engine/ti/instrumentation/python"
 	"github.com/harness/lite-engine/ti/instrumentation/ruby"
@@ -84,11 +86,19 @@ func getTestSelection(ctx context.Context, runner TestRunner, config *api.RunTes
 		}
 	}
 	files, moduleList, _ = checkForBazelOptimization(ctx, workspace, fs, log, files)
+	CaptureDebug(ctx, func(b *DebugBundle) { b.ChangedFiles = files })
 
 	// Call TI svc only when there is a chance of running selected tests
 	filesWithPkg := runner.ReadPackages(workspace, files)
 	testGlobs, excludeGlobs := runner.GetTestGlobs()
-	selection, err = SelectTests(ctx, workspace, filesWithPkg, config.RunOnlySelectedTests, stepID, testGlobs, fs, tiConfig)
+	if selector, ok := runner.(testSelector); ok {
+		selection, err = selector.SelectTests(workspace, filesWithPkg)
+		if err != nil {
+			CaptureDebug(ctx, func(b *DebugBundle) { b.Error = err.Error() })
+		}
+	} else {
+		selection, err = SelectTests(ctx, workspace, filesWithPkg, config.RunOnlySelectedTests, stepID, testGlobs, fs, tiConfig)
+	}
 	selection = filterTestsAfterSelection(selection, testGlobs, excludeGlobs)
 	if err != nil {
 		log.WithError(err).Errorln("There was some issue in trying to intelligently figure out tests to run. Running all the tests")
@@ -150,7 +160,9 @@ func ComputeSelectedTestsV2(ctx context.Context, runConfigV2 *api.RunTestsV2Conf
 		// For full runs, detect all the tests in the repo and split them
 		// If autodetect fails or detects no tests, we run all tests in step 0
 		var err error
-		tests, err = AutoDetectTests(ctx, workspace, testGlobs, log, envs, fs)
+		tests, err = cachedAutoDetect(ctx, tiConfig, workspace, "v2", testGlobs, log, func() ([]ti.RunnableTest, error) {
+			return AutoDetectTests(ctx, workspace, testGlobs, log, envs, fs)
+		})
 		if err != nil || len(tests) == 0 {
 			// AutoDetectTests output should be same across all the parallel steps. If one of the step
 			// receives error / no tests to run, all the other steps should have the same output
@@ -209,7 +221,9 @@ func computeSelectedTests(ctx context.Context, config *api.RunTestConfig, log *l
 		// If autodetect fails or detects no tests, we run all tests in step 0
 		var err error
 		testGlobs := sanitizeTestGlob(config.TestGlobs)
-		tests, err = runner.AutoDetectTests(ctx, workspace, testGlobs)
+		tests, err = cachedAutoDetect(ctx, tiConfig, workspace, fmt.Sprintf("%T", runner), testGlobs, log, func() ([]ti.RunnableTest, error) {
+			return runner.AutoDetectTests(ctx, workspace, testGlobs)
+		})
 		if err != nil || len(tests) == 0 {
 			// AutoDetectTests output should be same across all the parallel steps. If one of the step
 			// receives error / no tests to run, all the other steps should have the same output
@@ -246,7 +260,11 @@ func computeSelectedTests(ctx context.Context, config *api.RunTestConfig, log *l
 	config.RunOnlySelectedTests = true
 }
 
-func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace string, log *logrus.Logger, envs map[string]string, cfg *tiCfg.Cfg) (string, error) {
+// GetCmd returns the command running the selected tests of the step. The
+// external test runner of the step, if any, is run with the runner exec,
+// on the host if it is nil.
+func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace string, log *logrus.Logger, envs map[string]string,
+	runnerExec external.Exec, cfg *tiCfg.Cfg) (string, error) {
 	fs := filesystem.New()
 	tmpFilePath := cfg.GetDataDir()
 
@@ -266,7 +284,7 @@ func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace st
 	config.Language = strings.ToLower(config.Language)
 	config.BuildTool = strings.ToLower(config.BuildTool)
 	testGlobs := sanitizeTestGlob(config.TestGlobs)
-	runner, useYaml, err := getTiRunner(config.Language, config.BuildTool, log, fs, testGlobs, envs)
+	runner, useYaml, err := getTiRunner(config.Language, config.BuildTool, log, fs, testGlobs, envs, runnerExec)
 	if err != nil {
 		return "", err
 	}
@@ -276,8 +294,12 @@ func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace st
 	if !cfg.GetIgnoreInstr() {
 		// Get the tests and module test targets that need to be run if we are running selected tests
 		selection, modules = getTestSelection(ctx, runner, config, fs, stepID, workspace, log, isManual, cfg)
+		RecordSelection(ctx, stepID, &selection)
+		CompareSelection(cfg, stepID, &selection, log)
+	}
+	if needsAgent(runner) && !cfg.GetIgnoreInstr() {
 		// Install agent artifacts if not present
-		artifactDir, err = installAgents(ctx, tmpFilePath, config.Language, runtime.GOOS, runtime.GOARCH, config.BuildTool, fs, log, cfg)
+		artifactDir, err = installAgents(ctx, stepID, tmpFilePath, config.Language, runtime.GOOS, runtime.GOARCH, config.BuildTool, fs, log, cfg)
 		if err != nil {
 			return "", err
 		}
@@ -290,6 +312,7 @@ func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace st
 			if err != nil {
 				return "", err
 			}
+			CaptureDebugFile(ctx, iniFilePath)
 		} else {
 			config.PreCommand = fmt.Sprintf("export TI_OUTPUT_PATH=%s\n%s", getCgDir(tmpFilePath), config.PreCommand)
 		}
@@ -303,6 +326,7 @@ func GetCmd(ctx context.Context, config *api.RunTestConfig, stepID, workspace st
 	// set runnerArg for bazel runner
 	runnerArgs := common.RunnerArgs{}
 	runnerArgs.ModuleList = modules
+	runnerArgs.TestTimeout = testTimeout(envs)
 
 	testCmd, err := runner.GetCmd(ctx, selection.Tests, config.Args, workspace, iniFilePath, artifactDir, cfg.GetIgnoreInstr(), !config.RunOnlySelectedTests, runnerArgs)
 	if err != nil {
@@ -326,6 +350,11 @@ func InjectReportInformation(r *api.StartStepRequest) {
 			r.TestReport.Junit.Paths = []string{fmt.Sprintf("**/%s*", common.HarnessDefaultReportPath)}
 			r.TestReport.Kind = api.Junit
 		}
+	case "sql":
+		if strings.EqualFold(r.RunTest.BuildTool, "dbt") && len(r.TestReport.Junit.Paths) == 0 {
+			r.TestReport.Junit.Paths = []string{dbt.RunResultsPath}
+			r.TestReport.Kind = api.Junit
+		}
 	}
 }
 
@@ -24,6 +24,21 @@ var (
 	gradleCmd        = "gradle"
 )
 
+const (
+	deadlineInitScript = "harness-test-deadline.gradle"
+	// deadlineInitScriptContent bounds every test task by the time left to
+	// HARNESS_TEST_DEADLINE when it starts, so that the test tasks together
+	// stop before the step deadline.
+	deadlineInitScriptContent = `gradle.taskGraph.beforeTask { task ->
+  def deadline = System.getenv("HARNESS_TEST_DEADLINE")
+  if (deadline && task instanceof Test) {
+    def left = Long.parseLong(deadline) - System.currentTimeMillis().intdiv(1000)
+    task.timeout = java.time.Duration.ofSeconds(Math.max(1L, left))
+  }
+}
+`
+)
+
 type gradleRunner struct {
 	fs  filesystem.FileSystem
 	log *logrus.Logger
@@ -109,6 +124,13 @@ func (g *gradleRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, user
 	if orCmd != "" {
 		orCmd = "|| " + strings.TrimSpace(orCmd)
 	}
+	if runnerArgs.TestTimeout > 0 && agentInstallDir != "" {
+		script, err := g.writeDeadlineInitScript(agentInstallDir)
+		if err != nil {
+			return "", err
+		}
+		userArgs = strings.TrimSpace(fmt.Sprintf("%s -I %s", userArgs, script))
+	}
 
 	javaAgentPath := filepath.Join(agentInstallDir, JavaAgentJar)
 	agentArg := fmt.Sprintf(AgentArg, javaAgentPath, agentConfigPath)
@@ -140,3 +162,18 @@ func (g *gradleRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, user
 	}
 	return strings.TrimSpace(fmt.Sprintf("%s %s -DHARNESS_JAVA_AGENT=%s%s %s", gc, userArgs, agentArg, testStr, orCmd)), nil
 }
+
+// writeDeadlineInitScript writes the init script which bounds the gradle
+// test tasks by the test deadline and returns its path.
+func (g *gradleRunner) writeDeadlineInitScript(dir string) (string, error) {
+	path := filepath.Join(dir, deadlineInitScript)
+	f, err := g.fs.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the gradle init script: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(deadlineInitScriptContent); err != nil {
+		return "", fmt.Errorf("failed to write the gradle init script: %w", err)
+	}
+	return path, nil
+}
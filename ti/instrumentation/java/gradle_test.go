@@ -7,8 +7,10 @@ package java
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/harness/lite-engine/internal/filesystem"
@@ -166,3 +168,23 @@ func TestGetGradleCmd(t *testing.T) { //nolint:funlen
 		})
 	}
 }
+
+func TestGetGradleCmdDeadline(t *testing.T) {
+	ctrl, ctx := gomock.WithContext(context.Background(), t)
+	defer ctrl.Finish()
+
+	installDir := t.TempDir()
+	script := filepath.Join(installDir, deadlineInitScript)
+	fs := filesystem.NewMockFileSystem(ctrl)
+	fs.EXPECT().Stat("/path/to/workspace/gradlew").Return(nil, nil)
+	fs.EXPECT().Create(script).DoAndReturn(os.Create)
+
+	runner := NewGradleRunner(logrus.New(), fs)
+	got, err := runner.GetCmd(ctx, nil, "test || true", "/path/to/workspace", "/test/tmp/config.ini", installDir, true, true, common.RunnerArgs{TestTimeout: 90 * time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, "./gradlew test -I "+script, got)
+
+	b, err := os.ReadFile(script)
+	assert.Nil(t, err)
+	assert.Equal(t, deadlineInitScriptContent, string(b))
+}
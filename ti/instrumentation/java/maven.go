@@ -60,6 +60,10 @@ func (m *mavenRunner) GetTestGlobs() (testGlobs, excludeGlobs []string) {
 
 func (m *mavenRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
 	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	if runnerArgs.TestTimeout > 0 {
+		// prepended as the user args can end with a shell expression, eg. || true
+		userArgs = fmt.Sprintf("-Dsurefire.timeout=%d %s", int(runnerArgs.TestTimeout.Seconds()), userArgs)
+	}
 	// Agent arg
 	inputUserArgs := userArgs
 	javaAgentPath := filepath.Join(agentInstallDir, JavaAgentJar)
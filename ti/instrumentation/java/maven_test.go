@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -167,4 +168,8 @@ func TestMaven_GetCmd(t *testing.T) { //nolint:funlen
 			assert.Equal(t, tc.want, got)
 		})
 	}
+
+	got, err := runner.GetCmd(ctx, nil, "test || true", "/path/to/workspace", "/test/tmp/config.ini", "/install/dir/java/", true, true, common.RunnerArgs{TestTimeout: 90 * time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, "mvn -Dsurefire.timeout=90 test || true", got)
 }
@@ -0,0 +1,88 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package nodejs runs the javascript and typescript tests of jest and mocha.
+// The tests are the test files, they are selected by the TI service from the
+// changed files and run without agent.
+package nodejs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/mattn/go-zglob"
+)
+
+const (
+	npxCmd = "npx"
+	exts   = "{js,jsx,mjs,cjs,ts,tsx,mts,cts}"
+)
+
+var (
+	// the default testMatch of jest
+	defaultJestGlobs = []string{"**/__tests__/**/*." + exts, "**/*.{spec,test}." + exts}
+	// the default spec of mocha, with the test files of the other folders
+	defaultMochaGlobs = []string{"test/**/*." + exts, "**/*.{spec,test}." + exts}
+	excludeGlobs      = []string{"**/node_modules/**"}
+)
+
+// getGlobs returns the globs if set, the default globs of the runner
+// otherwise.
+func getGlobs(testGlobs, defaults []string) (includeGlobs, excludes []string) {
+	if len(testGlobs) == 0 {
+		testGlobs = defaults
+	}
+	return testGlobs, excludeGlobs
+}
+
+// detectTests returns the test files of the workspace matching the globs,
+// relative to the workspace. The node_modules and hidden directories are
+// skipped.
+func detectTests(workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	tests := make([]ti.RunnableTest, 0)
+	err := filepath.WalkDir(workspace, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != workspace && (name == "node_modules" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(workspace, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, glob := range testGlobs {
+			if matched, _ := zglob.Match(glob, rel); matched {
+				tests = append(tests, ti.RunnableTest{Class: rel})
+				break
+			}
+		}
+		return nil
+	})
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Class < tests[j].Class })
+	return tests, err
+}
+
+// pathPattern returns the regular expression of jest matching the test
+// files, eg. `(^|/)(src/a\.test\.js|src/b\.test\.js)$`.
+func pathPattern(files []string) string {
+	quoted := make([]string, len(files))
+	for i, f := range files {
+		quoted[i] = regexp.QuoteMeta(strings.TrimPrefix(f, "./"))
+	}
+	return "(^|/)(" + strings.Join(quoted, "|") + ")$"
+}
+
+// shellQuote quotes s for a posix shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
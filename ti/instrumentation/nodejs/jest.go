@@ -0,0 +1,70 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package nodejs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const jestCmd = "jest"
+
+type jestRunner struct {
+	fs        filesystem.FileSystem
+	log       *logrus.Logger
+	testGlobs []string
+}
+
+func NewJestRunner(log *logrus.Logger, fs filesystem.FileSystem, testGlobs []string) *jestRunner { //nolint:revive
+	return &jestRunner{
+		fs:        fs,
+		log:       log,
+		testGlobs: testGlobs,
+	}
+}
+
+func (m *jestRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns the test files of the workspace, the default
+// testMatch of jest if no globs are set.
+func (m *jestRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	testGlobs, _ = getGlobs(testGlobs, defaultJestGlobs)
+	return detectTests(workspace, testGlobs)
+}
+
+func (m *jestRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+func (m *jestRunner) GetTestGlobs() (includeGlobs, excludeGlobs []string) {
+	return getGlobs(m.testGlobs, defaultJestGlobs)
+}
+
+// GetCmd returns the jest command running the selected test files, they are
+// matched with --testPathPattern.
+func (m *jestRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	if runAll {
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", npxCmd, jestCmd, userArgs)), nil
+	}
+	if len(tests) == 0 {
+		return "echo \"Skipping test run, received no tests to execute\"", nil
+	}
+	pattern := pathPattern(common.GetUniqueTestStrings(tests))
+	return strings.TrimSpace(fmt.Sprintf("%s %s --testPathPattern %s %s", npxCmd, jestCmd, shellQuote(pattern), userArgs)), nil
+}
+
+// Agentless returns true, the tests are selected from the test files only.
+func (m *jestRunner) Agentless() bool {
+	return true
+}
@@ -0,0 +1,73 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProject(t *testing.T) string {
+	workspace := t.TempDir()
+	for _, name := range []string{
+		"package.json",
+		"src/cart.ts",
+		"src/cart.test.ts",
+		"src/__tests__/checkout.jsx",
+		"test/api.js",
+		"lib/price.spec.mjs",
+		"node_modules/left-pad/index.test.js",
+		".cache/old.test.js",
+	} {
+		path := filepath.Join(workspace, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, nil, 0600))
+	}
+	return workspace
+}
+
+func TestJestAutoDetectTests(t *testing.T) {
+	workspace := newProject(t)
+	r := NewJestRunner(logrus.New(), filesystem.New(), nil)
+
+	tests, err := r.AutoDetectTests(context.Background(), workspace, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"lib/price.spec.mjs", "src/__tests__/checkout.jsx", "src/cart.test.ts"}, common.GetUniqueTestStrings(tests))
+
+	tests, err = r.AutoDetectTests(context.Background(), workspace, []string{"src/**/*.ts"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"src/cart.test.ts", "src/cart.ts"}, common.GetUniqueTestStrings(tests))
+}
+
+func TestJestGetCmd(t *testing.T) {
+	r := NewJestRunner(logrus.New(), filesystem.New(), nil)
+	ctx := context.Background()
+	tests := []ti.RunnableTest{{Class: "src/cart.test.ts"}, {Class: "src/__tests__/checkout.jsx"}}
+
+	cmd, err := r.GetCmd(ctx, tests, "--ci", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, `npx jest --testPathPattern '(^|/)(src/cart\.test\.ts|src/__tests__/checkout\.jsx)$' --ci`, cmd)
+
+	cmd, err = r.GetCmd(ctx, tests, "--ci", "", "", "", true, true, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "npx jest --ci", cmd)
+
+	cmd, err = r.GetCmd(ctx, nil, "", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "echo \"Skipping test run, received no tests to execute\"", cmd)
+}
+
+func TestPathPattern(t *testing.T) {
+	re := regexp.MustCompile(pathPattern([]string{"./src/cart.test.ts", "a+b.test.js"}))
+	assert.True(t, re.MatchString("/harness/src/cart.test.ts"))
+	assert.True(t, re.MatchString("a+b.test.js"))
+	assert.False(t, re.MatchString("/harness/src/cart.test.tsx"))
+	assert.False(t, re.MatchString("/harness/src/xcart.test.ts"))
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package nodejs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const mochaCmd = "mocha"
+
+type mochaRunner struct {
+	fs        filesystem.FileSystem
+	log       *logrus.Logger
+	testGlobs []string
+}
+
+func NewMochaRunner(log *logrus.Logger, fs filesystem.FileSystem, testGlobs []string) *mochaRunner { //nolint:revive
+	return &mochaRunner{
+		fs:        fs,
+		log:       log,
+		testGlobs: testGlobs,
+	}
+}
+
+func (m *mochaRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns the test files of the workspace, the files of the
+// test folder and the spec and test files if no globs are set.
+func (m *mochaRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	testGlobs, _ = getGlobs(testGlobs, defaultMochaGlobs)
+	return detectTests(workspace, testGlobs)
+}
+
+func (m *mochaRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+func (m *mochaRunner) GetTestGlobs() (includeGlobs, excludeGlobs []string) {
+	return getGlobs(m.testGlobs, defaultMochaGlobs)
+}
+
+// GetCmd returns the mocha command running the selected test files, they
+// replace the spec of the mocha config.
+func (m *mochaRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	if runAll {
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", npxCmd, mochaCmd, userArgs)), nil
+	}
+	if len(tests) == 0 {
+		return "echo \"Skipping test run, received no tests to execute\"", nil
+	}
+	files := common.GetUniqueTestStrings(tests)
+	for i, f := range files {
+		files[i] = shellQuote(f)
+	}
+	return fmt.Sprintf("%s %s", strings.TrimSpace(fmt.Sprintf("%s %s %s", npxCmd, mochaCmd, userArgs)), strings.Join(files, " ")), nil
+}
+
+// Agentless returns true, the tests are selected from the test files only.
+func (m *mochaRunner) Agentless() bool {
+	return true
+}
@@ -0,0 +1,35 @@
+package nodejs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMochaAutoDetectTests(t *testing.T) {
+	workspace := newProject(t)
+	r := NewMochaRunner(logrus.New(), filesystem.New(), nil)
+
+	tests, err := r.AutoDetectTests(context.Background(), workspace, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"lib/price.spec.mjs", "src/cart.test.ts", "test/api.js"}, common.GetUniqueTestStrings(tests))
+}
+
+func TestMochaGetCmd(t *testing.T) {
+	r := NewMochaRunner(logrus.New(), filesystem.New(), nil)
+	ctx := context.Background()
+	tests := []ti.RunnableTest{{Class: "test/api.js"}, {Class: "test/it's.js"}}
+
+	cmd, err := r.GetCmd(ctx, tests, "--reporter dot", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, `npx mocha --reporter dot 'test/api.js' 'test/it'\''s.js'`, cmd)
+
+	cmd, err = r.GetCmd(ctx, tests, "", "", "", "", true, true, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "npx mocha", cmd)
+}
@@ -60,6 +60,10 @@ func (m *pytestRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, user
 	if userArgs == "" {
 		userArgs = fmt.Sprintf("--junitxml='%s${HARNESS_NODE_INDEX}' -o junit_family='xunit1'", common.HarnessDefaultReportPath)
 	}
+	if runnerArgs.TestTimeout > 0 {
+		// bounds the whole session, requires pytest-timeout 2.2 or later
+		userArgs = fmt.Sprintf("--session-timeout=%d %s", int(runnerArgs.TestTimeout.Seconds()), userArgs)
+	}
 
 	scriptPath, testHarness, err := UnzipAndGetTestInfo(agentInstallDir, ignoreInstr, pytestCmd, userArgs, m.log)
 	if err != nil {
@@ -0,0 +1,102 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/harness/lite-engine/pipeline"
+	ti "github.com/harness/ti-client/types"
+)
+
+const recordFilePerm = 0600
+
+// Record is the test intelligence state of a step execution, which the
+// reproducibility manifest of the step refers to.
+type Record struct {
+	SelectionHash string            `json:"selection_hash,omitempty"`
+	SelectionDiff *SelectionDiff    `json:"selection_diff,omitempty"` // since the previous run of the step
+	Agents        map[string]string `json:"agents,omitempty"`         // the download links of the agents by name
+}
+
+var recordMu sync.Mutex
+
+func recordFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-ti-record.json", pipeline.SharedVolPath, stepID)
+}
+
+// ReadRecord returns the test intelligence record of the step, nil if the
+// step did not use test intelligence.
+func ReadRecord(stepID string) *Record {
+	data, err := os.ReadFile(recordFile(stepID))
+	if err != nil {
+		return nil
+	}
+	r := new(Record)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil
+	}
+	return r
+}
+
+// RecordSelection records the hash of the tests selected for the step, and
+// the selection in the debug bundle of the context.
+func RecordSelection(ctx context.Context, stepID string, selection *ti.SelectTestsResp) {
+	updateRecord(stepID, func(r *Record) { r.SelectionHash = selectionHash(selection) })
+	CaptureDebug(ctx, func(b *DebugBundle) {
+		s := *selection
+		b.Selection = &s
+	})
+}
+
+// RecordAgents records the download links of the agents installed for the step.
+func RecordAgents(stepID string, links map[string]string) {
+	updateRecord(stepID, func(r *Record) {
+		if r.Agents == nil {
+			r.Agents = make(map[string]string)
+		}
+		for name, link := range links {
+			r.Agents[name] = link
+		}
+	})
+}
+
+func updateRecord(stepID string, update func(*Record)) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	r := ReadRecord(stepID)
+	if r == nil {
+		r = new(Record)
+	}
+	update(r)
+	if data, err := json.Marshal(r); err == nil {
+		_ = os.WriteFile(recordFile(stepID), data, recordFilePerm)
+	}
+}
+
+// selectionHash returns a hash of the selected tests which does not depend
+// on the order they were returned in.
+func selectionHash(selection *ti.SelectTestsResp) string {
+	if selection.SelectAll {
+		return "all"
+	}
+	tests := make([]string, 0, len(selection.Tests))
+	for _, t := range selection.Tests {
+		tests = append(tests, fmt.Sprintf("%s\x00%s\x00%s\x00%s", t.Pkg, t.Class, t.Method, t.Autodetect.Rule))
+	}
+	sort.Strings(tests)
+	h := sha256.New()
+	for _, t := range tests {
+		h.Write([]byte(t + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
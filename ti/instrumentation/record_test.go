@@ -0,0 +1,18 @@
+package instrumentation
+
+import (
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectionHash(t *testing.T) {
+	a := ti.RunnableTest{Pkg: "io.harness", Class: "FooTest", Method: "*"}
+	b := ti.RunnableTest{Pkg: "io.harness", Class: "BarTest", Method: "*"}
+
+	hash := selectionHash(&ti.SelectTestsResp{Tests: []ti.RunnableTest{a, b}})
+	assert.Equal(t, hash, selectionHash(&ti.SelectTestsResp{Tests: []ti.RunnableTest{b, a}}), "the order does not matter")
+	assert.NotEqual(t, hash, selectionHash(&ti.SelectTestsResp{Tests: []ti.RunnableTest{a}}))
+	assert.Equal(t, "all", selectionHash(&ti.SelectTestsResp{SelectAll: true}))
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/csharp"
+	"github.com/harness/lite-engine/ti/instrumentation/dbt"
+	"github.com/harness/lite-engine/ti/instrumentation/external"
+	"github.com/harness/lite-engine/ti/instrumentation/golang"
+	"github.com/harness/lite-engine/ti/instrumentation/java"
+	"github.com/harness/lite-engine/ti/instrumentation/nodejs"
+	"github.com/harness/lite-engine/ti/instrumentation/python"
+	"github.com/harness/lite-engine/ti/instrumentation/ruby"
+	"github.com/harness/lite-engine/ti/instrumentation/rust"
+	"github.com/sirupsen/logrus"
+)
+
+// RunnerOpts are the parameters of the step the test runners are created
+// with.
+type RunnerOpts struct {
+	Log       *logrus.Logger
+	FS        filesystem.FileSystem
+	TestGlobs []string
+	Envs      map[string]string
+}
+
+// RunnerFactory returns the test runner of a step.
+type RunnerFactory func(opts *RunnerOpts) TestRunner
+
+// yamlConfigRunner is implemented by the runners whose agent reads a yaml
+// config file rather than an ini one.
+type yamlConfigRunner interface {
+	YAMLConfig() bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]map[string]RunnerFactory) // language -> build tool -> factory
+)
+
+// RegisterRunner registers the test runner of the build tool of a language,
+// eg. from the init function of the package of the runner:
+//
+//	func init() {
+//		instrumentation.RegisterRunner("elixir", "mix", func(o *instrumentation.RunnerOpts) instrumentation.TestRunner {
+//			return NewMixRunner(o.Log, o.FS)
+//		})
+//	}
+//
+// The language and build tool are case insensitive. A later registration
+// replaces the runner of the same language and build tool. A runner
+// implementing SelectTests(workspace, files) selects the tests itself,
+// otherwise the tests are selected by the TI service and the agents of the
+// language are installed.
+func RegisterRunner(language, buildTool string, factory RunnerFactory) {
+	language, buildTool = strings.ToLower(language), strings.ToLower(buildTool)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registry[language] == nil {
+		registry[language] = make(map[string]RunnerFactory)
+	}
+	registry[language][buildTool] = factory
+}
+
+// RegisteredRunners returns the build tools of the registered runners by
+// language.
+func RegisteredRunners() map[string][]string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	runners := make(map[string][]string, len(registry))
+	for language, tools := range registry {
+		for tool := range tools {
+			runners[language] = append(runners[language], tool)
+		}
+		sort.Strings(runners[language])
+	}
+	return runners
+}
+
+// getTiRunner returns the registered runner of the language and build tool,
+// and whether its agent reads a yaml config file. The external runner of
+// the step is returned if set, whatever the language and build tool, run
+// with the exec or on the host if it is nil.
+func getTiRunner(language, buildTool string, log *logrus.Logger, fs filesystem.FileSystem, testGlobs []string, envs map[string]string,
+	runnerExec external.Exec) (TestRunner, bool, error) {
+	if binary := envs[external.RunnerEnv]; binary != "" {
+		return external.NewExternalRunner(log, binary, testGlobs, envs, runnerExec), false, nil
+	}
+	language, buildTool = strings.ToLower(language), strings.ToLower(buildTool)
+	registryMu.RLock()
+	tools, ok := registry[language]
+	factory := tools[buildTool]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, false, fmt.Errorf("language %s is not supported", language)
+	}
+	if factory == nil {
+		return nil, false, fmt.Errorf("build tool: %s is not supported for %s", buildTool, language)
+	}
+	runner := factory(&RunnerOpts{Log: log, FS: fs, TestGlobs: testGlobs, Envs: envs})
+	y, ok := runner.(yamlConfigRunner)
+	return runner, ok && y.YAMLConfig(), nil
+}
+
+// the runners shipped with the engine.
+func init() {
+	for _, language := range []string{"java", "kotlin", "scala"} {
+		RegisterRunner(language, "maven", func(o *RunnerOpts) TestRunner { return java.NewMavenRunner(o.Log, o.FS) })
+		RegisterRunner(language, "gradle", func(o *RunnerOpts) TestRunner { return java.NewGradleRunner(o.Log, o.FS) })
+		RegisterRunner(language, "bazel", func(o *RunnerOpts) TestRunner { return java.NewBazelRunner(o.Log, o.FS) })
+	}
+	RegisterRunner("scala", "sbt", func(o *RunnerOpts) TestRunner { return java.NewSBTRunner(o.Log, o.FS) })
+	RegisterRunner("csharp", "dotnet", func(o *RunnerOpts) TestRunner { return csharp.NewDotnetRunner(o.Log, o.FS) })
+	RegisterRunner("csharp", "nunitconsole", func(o *RunnerOpts) TestRunner { return csharp.NewNunitConsoleRunner(o.Log, o.FS) })
+	RegisterRunner("python", "pytest", func(o *RunnerOpts) TestRunner { return python.NewPytestRunner(o.Log, o.FS, o.TestGlobs) })
+	RegisterRunner("python", "unittest", func(o *RunnerOpts) TestRunner { return python.NewUnittestRunner(o.Log, o.FS, o.TestGlobs) })
+	for _, language := range []string{"javascript", "typescript"} {
+		RegisterRunner(language, "jest", func(o *RunnerOpts) TestRunner { return nodejs.NewJestRunner(o.Log, o.FS, o.TestGlobs) })
+		RegisterRunner(language, "mocha", func(o *RunnerOpts) TestRunner { return nodejs.NewMochaRunner(o.Log, o.FS, o.TestGlobs) })
+	}
+	RegisterRunner("go", "gotest", func(o *RunnerOpts) TestRunner { return golang.NewGoTestRunner(o.Log, o.FS) })
+	RegisterRunner("rust", "cargo", func(o *RunnerOpts) TestRunner { return rust.NewCargoRunner(o.Log, o.FS, o.TestGlobs) })
+	RegisterRunner("sql", "dbt", func(o *RunnerOpts) TestRunner { return dbt.NewDbtRunner(o.Log, o.FS) })
+	RegisterRunner("ruby", "rspec", func(o *RunnerOpts) TestRunner { return ruby.NewRubyRunner(o.Log, o.FS, o.TestGlobs, o.Envs) })
+}
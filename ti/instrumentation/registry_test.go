@@ -0,0 +1,59 @@
+package instrumentation
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/external"
+	mocks "github.com/harness/lite-engine/ti/instrumentation/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTiRunner(t *testing.T) {
+	log := logrus.New()
+	fs := filesystem.New()
+
+	_, useYaml, err := getTiRunner("Scala", "SBT", log, fs, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, useYaml)
+
+	_, useYaml, err = getTiRunner("csharp", "dotnet", log, fs, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, useYaml)
+
+	_, _, err = getTiRunner("java", "sbt", log, fs, nil, nil, nil)
+	assert.EqualError(t, err, "build tool: sbt is not supported for java")
+
+	_, _, err = getTiRunner("cobol", "make", log, fs, nil, nil, nil)
+	assert.EqualError(t, err, "language cobol is not supported")
+
+	r, _, err := getTiRunner("cobol", "make", log, fs, nil, map[string]string{external.RunnerEnv: "./ti-runner"}, nil)
+	assert.NoError(t, err)
+	assert.False(t, needsAgent(r))
+}
+
+func TestRegisterRunner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "elixir")
+		registryMu.Unlock()
+	}()
+
+	runner := mocks.NewMockTestRunner(ctrl)
+	var got *RunnerOpts
+	RegisterRunner("Elixir", "Mix", func(o *RunnerOpts) TestRunner {
+		got = o
+		return runner
+	})
+	assert.Equal(t, []string{"mix"}, RegisteredRunners()["elixir"])
+
+	r, useYaml, err := getTiRunner("elixir", "mix", logrus.New(), nil, []string{"test/**/*_test.exs"}, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, useYaml)
+	assert.Equal(t, runner, r)
+	assert.Equal(t, []string{"test/**/*_test.exs"}, got.TestGlobs)
+}
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/harness/lite-engine/internal/fileperm"
 	ti "github.com/harness/ti-client/types"
 	"github.com/mattn/go-zglob"
 
@@ -249,7 +250,7 @@ func prepend(lineToAdd, fileName string) error {
 	}
 
 	newContent := []byte(lineToAdd + "\n" + string(fileData))
-	err = os.WriteFile(fileName, newContent, os.ModePerm)
+	err = os.WriteFile(fileName, newContent, fileperm.Mode(os.ModePerm))
 	if err != nil {
 		return err
 	}
@@ -41,3 +41,26 @@ type TestRunner interface {
 	// Return Include and exclude globs
 	GetTestGlobs() ([]string, []string)
 }
+
+// testSelector is implemented by the runners which select the tests of the
+// changed files themselves rather than with the TI service, eg. dbt which
+// selects the tests from the graph of the project. These runners need no
+// agent.
+type testSelector interface {
+	SelectTests(workspace string, files []ti.File) (ti.SelectTestsResp, error)
+}
+
+// agentlessRunner is implemented by the runners which run the tests without
+// the TI agents, eg. the external runners.
+type agentlessRunner interface {
+	Agentless() bool
+}
+
+// needsAgent returns whether the agents are installed for the runner.
+func needsAgent(runner TestRunner) bool {
+	if _, ok := runner.(testSelector); ok {
+		return false
+	}
+	a, ok := runner.(agentlessRunner)
+	return !ok || !a.Agentless()
+}
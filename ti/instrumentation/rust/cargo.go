@@ -0,0 +1,179 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package rust runs the tests of the rust crates with cargo test. The tests
+// are the test functions found in the sources, they are split between the
+// parallel steps by source file and run without agent, the tests are not
+// selected from a call graph.
+package rust
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const cargoTestCmd = "cargo test"
+
+var (
+	defaultGlobs = []string{"**/*.rs"}
+	excludeGlobs = []string{"**/target/**"}
+)
+
+type cargoRunner struct {
+	fs        filesystem.FileSystem
+	log       *logrus.Logger
+	testGlobs []string
+}
+
+func NewCargoRunner(log *logrus.Logger, fs filesystem.FileSystem, testGlobs []string) *cargoRunner { //nolint:revive
+	return &cargoRunner{
+		fs:        fs,
+		log:       log,
+		testGlobs: testGlobs,
+	}
+}
+
+func (r *cargoRunner) AutoDetectPackages(workspace string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AutoDetectTests returns the test functions of the crates of the workspace,
+// the tests of the sources matching the globs if set.
+func (r *cargoRunner) AutoDetectTests(ctx context.Context, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	if len(testGlobs) == 0 {
+		testGlobs = defaultGlobs
+	}
+	return detectTests(r.fs, workspace, testGlobs)
+}
+
+func (r *cargoRunner) ReadPackages(workspace string, files []ti.File) []ti.File {
+	return files
+}
+
+func (r *cargoRunner) GetTestGlobs() (includeGlobs, excludes []string) {
+	if len(r.testGlobs) == 0 {
+		return defaultGlobs, excludeGlobs
+	}
+	return r.testGlobs, excludeGlobs
+}
+
+// GetCmd returns the cargo commands running the selected tests, one per
+// package and target with the exact names of the tests, eg.
+//
+//	cargo test -p parser --lib -- --exact lexer::tests::empty && cargo test -p parser --test cli -- --exact help
+//
+// The user arguments after -- are passed to the test binaries. All the tests
+// are run if a test has no target, eg. a test selected by the TI service.
+func (r *cargoRunner) GetCmd(ctx context.Context, tests []ti.RunnableTest, userArgs, workspace,
+	agentConfigPath, agentInstallDir string, ignoreInstr, runAll bool, runnerArgs common.RunnerArgs) (string, error) {
+	cargoArgs, testArgs := splitArgs(userArgs)
+	if !runAll && len(tests) == 0 {
+		return "echo \"Skipping test run, received no tests to execute\"", nil
+	}
+	type group struct {
+		pkg, target string
+		names       []string
+	}
+	var groups []*group
+	byTarget := make(map[string]*group)
+	for _, t := range tests {
+		if runAll {
+			break
+		}
+		if t.Autodetect.Rule == "" || t.Method == "" {
+			r.log.Infoln(fmt.Sprintf("cargo: no target for the test %s %s, running all the tests", t.Pkg, t.Class))
+			runAll = true
+			break
+		}
+		key := t.Pkg + " " + t.Autodetect.Rule
+		g := byTarget[key]
+		if g == nil {
+			g = &group{pkg: t.Pkg, target: t.Autodetect.Rule}
+			byTarget[key] = g
+			groups = append(groups, g)
+		}
+		g.names = append(g.names, t.Method)
+	}
+	if runAll {
+		return join(cargoTestCmd, cargoArgs, dashes(testArgs)), nil
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].pkg != groups[j].pkg {
+			return groups[i].pkg < groups[j].pkg
+		}
+		return groups[i].target < groups[j].target
+	})
+	cmds := make([]string, 0, len(groups))
+	for _, g := range groups {
+		cmds = append(cmds, join(cargoTestCmd, "-p "+g.pkg, targetFlag(g.target), cargoArgs,
+			"--", testArgs, "--exact", strings.Join(unique(g.names), " ")))
+	}
+	return strings.Join(cmds, " && "), nil
+}
+
+// Agentless returns true, the tests are found in the sources.
+func (r *cargoRunner) Agentless() bool {
+	return true
+}
+
+// targetFlag returns the flag of cargo selecting the target.
+func targetFlag(target string) string {
+	switch {
+	case strings.HasPrefix(target, targetBin):
+		return "--bin " + strings.TrimPrefix(target, targetBin)
+	case strings.HasPrefix(target, targetTest):
+		return "--test " + strings.TrimPrefix(target, targetTest)
+	}
+	return "--lib"
+}
+
+// splitArgs splits the user arguments in the arguments of cargo and the
+// ones of the test binaries, after --.
+func splitArgs(userArgs string) (cargoArgs, testArgs string) {
+	fields := strings.Fields(userArgs)
+	for i, f := range fields {
+		if f == "--" {
+			return strings.Join(fields[:i], " "), strings.Join(fields[i+1:], " ")
+		}
+	}
+	return strings.Join(fields, " "), ""
+}
+
+func dashes(testArgs string) string {
+	if testArgs == "" {
+		return ""
+	}
+	return "-- " + testArgs
+}
+
+// join joins the non empty parts of a command.
+func join(parts ...string) string {
+	nonEmpty := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+func unique(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := names[:0]
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package rust
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	"github.com/harness/lite-engine/ti/instrumentation/common"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWorkspace(t *testing.T) string {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"Cargo.toml":                      "[workspace]\nmembers = [\"parser\", \"cli\"]\n",
+		"parser/Cargo.toml":               "[package]\nname = \"parser\"\nversion = \"0.1.0\"\n\n[dependencies]\nname = \"x\"\n",
+		"parser/src/lib.rs":               "mod lexer;\n#[test]\nfn parses() {}\n",
+		"parser/src/lexer/mod.rs":         "#[cfg(test)]\nmod tests {\n    #[test]\n    fn empty() {}\n}\n",
+		"parser/tests/cli.rs":             "#[test]\nfn help() {}\n",
+		"parser/tests/common/mod.rs":      "#[test]\nfn shared() {}\n",
+		"parser/tests/golden/main.rs":     "mod cases;\n",
+		"parser/tests/golden/cases.rs":    "#[test]\nfn matches() {}\n",
+		"parser/benches/bench.rs":         "#[test]\nfn bench() {}\n",
+		"parser/target/debug/build/x.rs":  "#[test]\nfn generated() {}\n",
+		"cli/Cargo.toml":                  "[package]\nname = 'cli'\n",
+		"cli/src/main.rs":                 "mod args;\n",
+		"cli/src/args.rs":                 "#[test]\nfn parses_flags() {}\n",
+		"cli/src/bin/gen.rs":              "#[test]\nfn generates() {}\n",
+		"cli/src/bin/serve/main.rs":       "mod routes;\n",
+		"cli/src/bin/serve/routes.rs":     "#[test]\nfn routes() {}\n",
+		"docs/example.rs":                 "#[test]\nfn orphan() {}\n",
+		".cargo/registry/src/dep/lib.rs":  "#[test]\nfn dependency() {}\n",
+		"parser/vendor/dep/src/lib.rs":    "#[test]\nfn vendored() {}\n",
+		"parser/vendor/dep/Cargo.toml":    "[package]\nname = \"dep\"\n",
+		"parser/src/lexer/testdata/a.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return workspace
+}
+
+func runnable(pkg, class, method, target string) ti.RunnableTest {
+	test := ti.RunnableTest{Pkg: pkg, Class: class, Method: method}
+	test.Autodetect.Rule = target
+	return test
+}
+
+func TestAutoDetectTests(t *testing.T) {
+	workspace := newWorkspace(t)
+	r := NewCargoRunner(logrus.New(), filesystem.New(), nil)
+
+	tests, err := r.AutoDetectTests(context.Background(), workspace, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []ti.RunnableTest{
+		runnable("cli", "cli/src/args.rs", "args::parses_flags", "bin:cli"),
+		runnable("cli", "cli/src/bin/gen.rs", "generates", "bin:gen"),
+		runnable("cli", "cli/src/bin/serve/routes.rs", "routes::routes", "bin:serve"),
+		runnable("parser", "parser/src/lexer/mod.rs", "lexer::tests::empty", "lib"),
+		runnable("parser", "parser/src/lib.rs", "parses", "lib"),
+		runnable("parser", "parser/tests/cli.rs", "help", "test:cli"),
+		runnable("parser", "parser/tests/golden/cases.rs", "cases::matches", "test:golden"),
+	}, tests)
+
+	tests, err = r.AutoDetectTests(context.Background(), workspace, []string{"parser/tests/**/*.rs"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"parser/tests/cli.rs", "parser/tests/golden/cases.rs"}, common.GetUniqueTestStrings(tests))
+}
+
+func TestGetCmd(t *testing.T) {
+	r := NewCargoRunner(logrus.New(), filesystem.New(), nil)
+	ctx := context.Background()
+	tests := []ti.RunnableTest{
+		runnable("parser", "parser/tests/cli.rs", "help", "test:cli"),
+		runnable("parser", "parser/src/lexer/mod.rs", "lexer::tests::empty", "lib"),
+		runnable("parser", "parser/src/lib.rs", "parses", "lib"),
+		runnable("cli", "cli/src/bin/gen.rs", "generates", "bin:gen"),
+	}
+
+	cmd, err := r.GetCmd(ctx, tests, "--release -- --nocapture", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "cargo test -p cli --bin gen --release -- --nocapture --exact generates && "+
+		"cargo test -p parser --lib --release -- --nocapture --exact lexer::tests::empty parses && "+
+		"cargo test -p parser --test cli --release -- --nocapture --exact help", cmd)
+
+	cmd, err = r.GetCmd(ctx, tests, "--release -- --nocapture", "", "", "", true, true, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "cargo test --release -- --nocapture", cmd)
+
+	cmd, err = r.GetCmd(ctx, append(tests, ti.RunnableTest{Pkg: "parser", Class: "lexer"}), "", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "cargo test", cmd)
+
+	cmd, err = r.GetCmd(ctx, nil, "", "", "", "", true, false, common.RunnerArgs{})
+	assert.Nil(t, err)
+	assert.Equal(t, "echo \"Skipping test run, received no tests to execute\"", cmd)
+}
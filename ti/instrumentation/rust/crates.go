@@ -0,0 +1,206 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package rust
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/filesystem"
+	ti "github.com/harness/ti-client/types"
+	"github.com/mattn/go-zglob"
+)
+
+const manifestFile = "Cargo.toml"
+
+// The targets of the tests, the target of a test is its Autodetect.Rule.
+const (
+	targetLib  = "lib"
+	targetBin  = "bin:"  // followed by the name of the binary
+	targetTest = "test:" // followed by the name of the integration test
+)
+
+// crate is a package of the workspace.
+type crate struct {
+	name string
+	dir  string // relative to the workspace, slash separated
+}
+
+// detectTests returns the test functions of the crates of the workspace in
+// the files matching the globs. The targets are inferred from the
+// conventional layout of cargo, the targets with a custom path are not
+// found.
+func detectTests(fsys filesystem.FileSystem, workspace string, testGlobs []string) ([]ti.RunnableTest, error) {
+	var crates []crate
+	var sources []string
+	err := filepath.WalkDir(workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if name := d.Name(); rel != "." && (name == "target" || name == "vendor" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.Name() == manifestFile:
+			name, err := readPackageName(fsys, p)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				crates = append(crates, crate{name: name, dir: path.Dir(rel)})
+			}
+		case strings.HasSuffix(rel, ".rs") && matchAny(testGlobs, rel):
+			sources = append(sources, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make([]ti.RunnableTest, 0)
+	for _, file := range sources {
+		c, ok := crateOf(crates, file)
+		if !ok {
+			continue
+		}
+		target, module, ok := targetOf(workspace, c, file)
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range parseTests(string(data)) {
+			if module != "" {
+				name = module + "::" + name
+			}
+			test := ti.RunnableTest{Pkg: c.name, Class: file, Method: name}
+			test.Autodetect.Rule = target
+			tests = append(tests, test)
+		}
+	}
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].Class < tests[j].Class })
+	return tests, nil
+}
+
+// readPackageName returns the name of the package of the manifest, empty
+// for a virtual manifest.
+func readPackageName(fsys filesystem.FileSystem, manifest string) (string, error) {
+	var name string
+	err := fsys.ReadFile(manifest, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		section := ""
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(line, "[] ")
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if section == "package" && ok && strings.TrimSpace(key) == "name" {
+				name = strings.Trim(strings.TrimSpace(value), `"'`)
+				return nil
+			}
+		}
+		return scanner.Err()
+	})
+	return name, err
+}
+
+// crateOf returns the crate of the file, the one of the closest manifest.
+func crateOf(crates []crate, file string) (crate, bool) {
+	var found crate
+	longest := -1
+	for _, c := range crates {
+		n := 0 // the root crate holds all the files
+		if c.dir != "." {
+			if !strings.HasPrefix(file, c.dir+"/") {
+				continue
+			}
+			n = len(c.dir)
+		}
+		if n > longest {
+			found, longest = c, n
+		}
+	}
+	return found, longest >= 0
+}
+
+// targetOf returns the target of a source file of the crate and the path of
+// the module of the file in the target. The files of the benches, the
+// examples and the build scripts have no tests run by cargo test.
+func targetOf(workspace string, c crate, file string) (target, module string, ok bool) {
+	rel := file
+	if c.dir != "." {
+		rel = strings.TrimPrefix(file, c.dir+"/")
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(workspace, filepath.FromSlash(c.dir), filepath.FromSlash(name)))
+		return err == nil
+	}
+	switch {
+	case strings.HasPrefix(rel, "src/bin/"):
+		name, rest, nested := strings.Cut(strings.TrimPrefix(rel, "src/bin/"), "/")
+		if !nested {
+			return targetBin + strings.TrimSuffix(name, ".rs"), "", true
+		}
+		return targetBin + name, modulePath(rest), true
+	case strings.HasPrefix(rel, "src/"):
+		if rel == "src/main.rs" || !exists("src/lib.rs") {
+			return targetBin + c.name, modulePath(strings.TrimPrefix(rel, "src/")), true
+		}
+		return targetLib, modulePath(strings.TrimPrefix(rel, "src/")), true
+	case strings.HasPrefix(rel, "tests/"):
+		name, rest, nested := strings.Cut(strings.TrimPrefix(rel, "tests/"), "/")
+		if !nested {
+			return targetTest + strings.TrimSuffix(name, ".rs"), "", true
+		}
+		// the other directories hold the modules shared by the tests
+		if !exists("tests/" + name + "/main.rs") {
+			return "", "", false
+		}
+		return targetTest + name, modulePath(rest), true
+	}
+	return "", "", false
+}
+
+// modulePath returns the path of the module of a file relative to the root
+// directory of its target, eg. parser::lexer for parser/lexer.rs, empty for
+// the root file of the target.
+func modulePath(file string) string {
+	parts := strings.Split(strings.TrimSuffix(file, ".rs"), "/")
+	switch last := parts[len(parts)-1]; {
+	case len(parts) == 1 && (last == "lib" || last == "main"):
+		return ""
+	case last == "mod":
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, "::")
+}
+
+func matchAny(globs []string, file string) bool {
+	for _, glob := range globs {
+		if matched, _ := zglob.Match(glob, file); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package rust
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTests returns the paths of the test functions of a rust source file
+// relative to the module of the file, eg. tests::parses_empty_input. The
+// functions with a #[test] attribute or an attribute ending with ::test, eg.
+// #[tokio::test], are tests. The source is tokenized only, the tests in the
+// macros are not found.
+func parseTests(src string) []string {
+	type scope struct {
+		name  string
+		depth int // the depth of the braces the module is declared at
+	}
+	var (
+		tests    []string
+		mods     []scope
+		depth    int
+		testAttr bool
+	)
+	toks := tokenize(src)
+	for i := 0; i < len(toks); i++ {
+		switch toks[i] {
+		case "#":
+			j := i + 1
+			if j < len(toks) && toks[j] == "!" {
+				j++
+			}
+			if j >= len(toks) || toks[j] != "[" {
+				continue
+			}
+			var path strings.Builder
+			for k := j + 1; k < len(toks) && (toks[k] == "::" || isIdent(toks[k])); k++ {
+				path.WriteString(toks[k])
+			}
+			if p := path.String(); p == "test" || strings.HasSuffix(p, "::test") {
+				testAttr = true
+			}
+			i = closingBracket(toks, j)
+		case "mod":
+			if i+2 < len(toks) && isIdent(toks[i+1]) && toks[i+2] == "{" {
+				mods = append(mods, scope{name: toks[i+1], depth: depth})
+			}
+		case "fn":
+			if testAttr && i+1 < len(toks) && isIdent(toks[i+1]) {
+				names := make([]string, 0, len(mods)+1)
+				for _, m := range mods {
+					names = append(names, m.name)
+				}
+				tests = append(tests, strings.Join(append(names, toks[i+1]), "::"))
+			}
+			testAttr = false
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if n := len(mods); n > 0 && mods[n-1].depth == depth {
+				mods = mods[:n-1]
+			}
+		}
+	}
+	return tests
+}
+
+// closingBracket returns the index of the bracket closing the one at i.
+func closingBracket(toks []string, i int) int {
+	depth := 0
+	for ; i < len(toks); i++ {
+		switch toks[i] {
+		case "[":
+			depth++
+		case "]":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// tokenize splits the source in identifiers, ::, and punctuation, the
+// comments and the literals are skipped.
+func tokenize(src string) []string {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(src)
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			i = skipBlockComment(src, i)
+		case c == '"':
+			i = skipString(src, i)
+		case c == '\'':
+			i = skipChar(src, i)
+		case isIdentByte(c):
+			j := i
+			for j < len(src) && isIdentByte(src[j]) {
+				j++
+			}
+			word := src[i:j]
+			switch {
+			case (word == "r" || word == "br") && j < len(src) && (src[j] == '"' || src[j] == '#') && isRawString(src, j):
+				i = skipRawString(src, j)
+			case word == "b" && j < len(src) && src[j] == '"':
+				i = skipString(src, j)
+			case word == "b" && j < len(src) && src[j] == '\'':
+				i = skipChar(src, j)
+			default:
+				toks = append(toks, word)
+				i = j
+			}
+		case strings.HasPrefix(src[i:], "::"):
+			toks = append(toks, "::")
+			i += 2
+		default:
+			toks = append(toks, src[i:i+1])
+			i++
+		}
+	}
+	return toks
+}
+
+func skipBlockComment(src string, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch {
+		case strings.HasPrefix(src[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(src[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// skipString returns the index after the string starting with the quote
+// at i.
+func skipString(src string, i int) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
+
+// skipChar returns the index after the character literal starting at i, or
+// after the quote of a lifetime.
+func skipChar(src string, i int) int {
+	if i+1 < len(src) && src[i+1] == '\\' {
+		if end := strings.IndexByte(src[i+2:], '\''); end >= 0 {
+			return i + 2 + end + 1
+		}
+		return len(src)
+	}
+	_, size := utf8.DecodeRuneInString(src[i+1:])
+	if j := i + 1 + size; j < len(src) && src[j] == '\'' {
+		return j + 1
+	}
+	return i + 1
+}
+
+// isRawString returns true if the hashes at i are followed by a quote.
+func isRawString(src string, i int) bool {
+	for i < len(src) && src[i] == '#' {
+		i++
+	}
+	return i < len(src) && src[i] == '"'
+}
+
+func skipRawString(src string, i int) int {
+	hashes := 0
+	for i < len(src) && src[i] == '#' {
+		hashes++
+		i++
+	}
+	end := strings.Index(src[i+1:], `"`+strings.Repeat("#", hashes))
+	if end < 0 {
+		return len(src)
+	}
+	return i + 1 + end + 1 + hashes
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isIdent(tok string) bool {
+	return tok != "" && isIdentByte(tok[0])
+}
@@ -0,0 +1,61 @@
+package rust
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTests(t *testing.T) {
+	src := `
+//! #[test] fn not_a_test() {}
+use std::fmt;
+
+/* #[test]
+   fn commented() {} */
+pub fn parse(s: &str) -> Result<(), String> {
+    let _brace = '{';
+    let _raw = r#"} #[test] fn in_raw() {}"#;
+    let _s = "}\" {";
+    Ok(())
+}
+
+fn longest<'a>(a: &'a str, _b: &'a str) -> &'a str { a }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_empty_input() {
+        assert!(parse("").is_ok());
+    }
+
+    #[test]
+    #[should_panic(expected = "}")]
+    fn panics() { panic!("}") }
+
+    fn helper() {}
+
+    mod nested {
+        #[tokio::test]
+        async fn runs_async() {}
+    }
+
+    #[test_case(1)]
+    fn not_a_libtest_test(_n: u8) {}
+}
+
+#[test]
+fn top_level() {}
+`
+	assert.Equal(t, []string{"tests::parses_empty_input", "tests::panics", "tests::nested::runs_async", "top_level"}, parseTests(src))
+}
+
+func TestModulePath(t *testing.T) {
+	assert.Equal(t, "", modulePath("lib.rs"))
+	assert.Equal(t, "", modulePath("main.rs"))
+	assert.Equal(t, "parser", modulePath("parser.rs"))
+	assert.Equal(t, "parser", modulePath("parser/mod.rs"))
+	assert.Equal(t, "parser::lexer", modulePath("parser/lexer.rs"))
+}
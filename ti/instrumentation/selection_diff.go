@@ -0,0 +1,195 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package instrumentation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/fileperm"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	selectionDirPerm = 0700
+	maxDiffLogTests  = 50 // tests listed in the logs per change
+)
+
+var selectionDir string
+
+// SetSelectionDir sets the directory the last test selection of the steps
+// is kept in, to compare the selections of consecutive runs. The selections
+// are not compared if dir is empty.
+func SetSelectionDir(dir string) {
+	selectionDir = dir
+}
+
+// SelectionDiff is the change of the tests selected for a step since its
+// previous run.
+type SelectionDiff struct {
+	SelectAll     bool     `json:"select_all,omitempty"`
+	PrevSelectAll bool     `json:"prev_select_all,omitempty"`
+	Selected      int      `json:"selected"`
+	NewlySelected []string `json:"newly_selected,omitempty"`
+	NewlySkipped  []string `json:"newly_skipped,omitempty"`
+}
+
+// storedSelection is the selection of a step kept for its next run.
+type storedSelection struct {
+	SelectAll bool     `json:"select_all,omitempty"`
+	Tests     []string `json:"tests,omitempty"`
+	Build     string   `json:"build,omitempty"`
+}
+
+// CompareSelection logs and records the change of the tests selected for
+// the step since the previous run of the step of the pipeline, and keeps
+// the selection for the next run. Nothing is logged on the first run.
+func CompareSelection(cfg *tiCfg.Cfg, stepID string, selection *ti.SelectTestsResp, log *logrus.Logger) {
+	if selectionDir == "" {
+		return
+	}
+	file := filepath.Join(selectionDir, selectionKey(cfg, stepID)+".json")
+	cur := storedSelection{SelectAll: selection.SelectAll, Tests: selectedTests(selection), Build: cfg.GetBuildID()}
+	prev, err := readSelection(file)
+	if err == nil {
+		diff := diffSelection(prev, &cur)
+		logSelectionDiff(log, prev.Build, diff)
+		updateRecord(stepID, func(r *Record) { r.SelectionDiff = diff })
+	}
+	if err = writeSelection(file, &cur); err != nil {
+		log.WithError(err).Warnln("cannot keep the test selection for the next run")
+	}
+}
+
+// selectionKey identifies the step of the pipeline across its runs.
+func selectionKey(cfg *tiCfg.Cfg, stepID string) string {
+	h := sha256.Sum256([]byte(strings.Join([]string{cfg.GetAccountID(), cfg.GetOrgID(), cfg.GetProjectID(),
+		cfg.GetPipelineID(), cfg.GetStageID(), stepID}, "/")))
+	return hex.EncodeToString(h[:])
+}
+
+func selectedTests(selection *ti.SelectTestsResp) []string {
+	if selection.SelectAll {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var tests []string
+	for _, t := range selection.Tests {
+		name := t.Class
+		if t.Pkg != "" {
+			name = t.Pkg + "." + name
+		}
+		if t.Method != "" && t.Method != "*" {
+			name += "#" + t.Method
+		}
+		if !seen[name] {
+			seen[name] = true
+			tests = append(tests, name)
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+// diffSelection returns the change between the selections. The tests are
+// not listed if one of the runs selected all the tests.
+func diffSelection(prev, cur *storedSelection) *SelectionDiff {
+	d := &SelectionDiff{SelectAll: cur.SelectAll, PrevSelectAll: prev.SelectAll, Selected: len(cur.Tests)}
+	if cur.SelectAll || prev.SelectAll {
+		return d
+	}
+	before := make(map[string]bool, len(prev.Tests))
+	for _, t := range prev.Tests {
+		before[t] = true
+	}
+	now := make(map[string]bool, len(cur.Tests))
+	for _, t := range cur.Tests {
+		now[t] = true
+		if !before[t] {
+			d.NewlySelected = append(d.NewlySelected, t)
+		}
+	}
+	for _, t := range prev.Tests {
+		if !now[t] {
+			d.NewlySkipped = append(d.NewlySkipped, t)
+		}
+	}
+	return d
+}
+
+func logSelectionDiff(log *logrus.Logger, prevBuild string, d *SelectionDiff) {
+	switch {
+	case d.SelectAll && d.PrevSelectAll:
+		log.Infoln(fmt.Sprintf("Test Intelligence selected all the tests, as in the previous run %s", prevBuild))
+		return
+	case d.SelectAll:
+		log.Infoln(fmt.Sprintf("Test Intelligence selected all the tests, the previous run %s ran a subset", prevBuild))
+		return
+	case d.PrevSelectAll:
+		log.Infoln(fmt.Sprintf("Test Intelligence selected %d tests, the previous run %s ran all the tests", d.Selected, prevBuild))
+		return
+	}
+	log.Infoln(fmt.Sprintf("Test Intelligence selected %d tests, %d newly selected and %d newly skipped since the previous run %s",
+		d.Selected, len(d.NewlySelected), len(d.NewlySkipped), prevBuild))
+	logTests(log, "Newly selected", d.NewlySelected)
+	logTests(log, "Newly skipped", d.NewlySkipped)
+}
+
+func logTests(log *logrus.Logger, what string, tests []string) {
+	if len(tests) == 0 {
+		return
+	}
+	listed := tests
+	if len(listed) > maxDiffLogTests {
+		listed = listed[:maxDiffLogTests]
+	}
+	msg := fmt.Sprintf("%s: %s", what, strings.Join(listed, ", "))
+	if len(tests) > len(listed) {
+		msg += fmt.Sprintf(" and %d more", len(tests)-len(listed))
+	}
+	log.Infoln(msg)
+}
+
+func readSelection(file string) (*storedSelection, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(storedSelection)
+	return s, json.Unmarshal(data, s)
+}
+
+// writeSelection writes the selection to a temporary file renamed once
+// complete, the steps of parallel stages may share the directory.
+func writeSelection(file string, s *storedSelection) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), fileperm.Mode(selectionDirPerm)); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(file), ".selection-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
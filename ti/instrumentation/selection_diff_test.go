@@ -0,0 +1,44 @@
+package instrumentation
+
+import (
+	"bytes"
+	"testing"
+
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSelection(t *testing.T) {
+	prev := &storedSelection{Tests: []string{"a.FooTest", "a.BarTest#testBar"}}
+	cur := &storedSelection{Tests: []string{"a.FooTest", "a.BazTest"}}
+	assert.Equal(t, &SelectionDiff{Selected: 2, NewlySelected: []string{"a.BazTest"}, NewlySkipped: []string{"a.BarTest#testBar"}},
+		diffSelection(prev, cur))
+	assert.Equal(t, &SelectionDiff{SelectAll: true}, diffSelection(prev, &storedSelection{SelectAll: true}))
+}
+
+func TestCompareSelection(t *testing.T) {
+	SetSelectionDir(t.TempDir())
+	defer SetSelectionDir("")
+	var out bytes.Buffer
+	log := logrus.New()
+	log.Out = &out
+	cfg := tiCfg.New("", "", "account", "org", "project", "pipeline", "1", "stage", "", "", "", "", "", "", "", false, false)
+
+	CompareSelection(&cfg, "step", &ti.SelectTestsResp{Tests: []ti.RunnableTest{
+		{Pkg: "io.harness", Class: "FooTest", Method: "*"}, {Pkg: "io.harness", Class: "BarTest", Method: "*"}}}, log)
+	assert.Empty(t, out.String(), "nothing to compare on the first run")
+
+	cfg = tiCfg.New("", "", "account", "org", "project", "pipeline", "2", "stage", "", "", "", "", "", "", "", false, false)
+	CompareSelection(&cfg, "step", &ti.SelectTestsResp{Tests: []ti.RunnableTest{
+		{Pkg: "io.harness", Class: "FooTest", Method: "*"}, {Pkg: "io.harness", Class: "BazTest", Method: "testBaz"}}}, log)
+	assert.Contains(t, out.String(), "Test Intelligence selected 2 tests, 1 newly selected and 1 newly skipped since the previous run 1")
+	assert.Contains(t, out.String(), "Newly selected: io.harness.BazTest#testBaz")
+	assert.Contains(t, out.String(), "Newly skipped: io.harness.BarTest")
+
+	// the selections of the other steps are kept apart
+	out.Reset()
+	CompareSelection(&cfg, "other", &ti.SelectTestsResp{SelectAll: true}, log)
+	assert.Empty(t, out.String())
+}
@@ -17,12 +17,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/harness/lite-engine/internal/fileperm"
 	"github.com/harness/lite-engine/internal/filesystem"
 	tiCfg "github.com/harness/lite-engine/ti/config"
-	"github.com/harness/lite-engine/ti/instrumentation/csharp"
-	"github.com/harness/lite-engine/ti/instrumentation/java"
-	"github.com/harness/lite-engine/ti/instrumentation/python"
-	"github.com/harness/lite-engine/ti/instrumentation/ruby"
 	"github.com/harness/lite-engine/ti/testsplitter"
 	ti "github.com/harness/ti-client/types"
 	"github.com/mattn/go-zglob"
@@ -31,9 +28,19 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// FileRename is a file renamed between the compared commits, with the
+// percentage of its content left unchanged.
+type FileRename struct {
+	Old        string
+	New        string
+	Similarity int
+}
+
 var (
-	diffFilesCmdPR   = []string{"diff", "--name-status", "--diff-filter=MADR", "HEAD@{1}", "HEAD", "-1"}
-	diffFilesCmdPush = []string{"diff", "--name-status", "--diff-filter=MADR"}
+	// the renames are detected with the default similarity of git, 50%,
+	// whatever the diff.renames setting of the repository.
+	diffFilesCmdPR   = []string{"diff", "--name-status", "-M", "--diff-filter=MADR", "HEAD@{1}", "HEAD", "-1"}
+	diffFilesCmdPush = []string{"diff", "--name-status", "-M", "--diff-filter=MADR"}
 	bazelCmd         = "bazel"
 	execCmdCtx       = exec.CommandContext
 )
@@ -49,59 +56,6 @@ const (
 	harnessStageTotal = "HARNESS_STAGE_TOTAL"
 )
 
-func getTiRunner(language, buildTool string, log *logrus.Logger, fs filesystem.FileSystem, testGlobs []string, envs map[string]string) (TestRunner, bool, error) {
-	var runner TestRunner
-	var useYaml bool
-	switch strings.ToLower(language) {
-	case "scala", "java", "kotlin":
-		useYaml = false
-		switch buildTool {
-		case "maven":
-			runner = java.NewMavenRunner(log, fs)
-		case "gradle":
-			runner = java.NewGradleRunner(log, fs)
-		case "bazel":
-			runner = java.NewBazelRunner(log, fs)
-		case "sbt":
-			if language != "scala" {
-				return runner, useYaml, fmt.Errorf("build tool: SBT is not supported for non-Scala languages")
-			}
-			runner = java.NewSBTRunner(log, fs)
-		default:
-			return runner, useYaml, fmt.Errorf("build tool: %s is not supported for Java", buildTool)
-		}
-	case "csharp":
-		useYaml = true
-		switch buildTool {
-		case "dotnet":
-			runner = csharp.NewDotnetRunner(log, fs)
-		case "nunitconsole":
-			runner = csharp.NewNunitConsoleRunner(log, fs)
-		default:
-			return runner, useYaml, fmt.Errorf("could not figure out the build tool: %s", buildTool)
-		}
-	case "python":
-		switch buildTool {
-		case "pytest":
-			runner = python.NewPytestRunner(log, fs, testGlobs)
-		case "unittest":
-			runner = python.NewUnittestRunner(log, fs, testGlobs)
-		default:
-			return runner, useYaml, fmt.Errorf("could not figure out the build tool: %s", buildTool)
-		}
-	case "ruby":
-		switch buildTool {
-		case "rspec":
-			runner = ruby.NewRubyRunner(log, fs, testGlobs, envs)
-		default:
-			return runner, useYaml, fmt.Errorf("could not figure out the build tool: %s", buildTool)
-		}
-	default:
-		return runner, useYaml, fmt.Errorf("language %s is not suported", language)
-	}
-	return runner, useYaml, nil
-}
-
 func GetCommitInfo(ctx context.Context, stepID string, cfg *tiCfg.Cfg) (string, error) {
 	c := cfg.GetClient()
 	branch := cfg.GetSourceBranch()
@@ -239,16 +193,34 @@ func getChangedFiles(ctx context.Context, workspace string, log *logrus.Logger,
 		return nil, err
 	}
 
+	res, renames := parseChangedFiles(string(out), log)
+	for _, r := range renames {
+		log.Infoln(fmt.Sprintf("%s was renamed to %s (%d%% similar)", r.Old, r.New, r.Similarity))
+	}
+	return res, nil
+}
+
+// parseChangedFiles parses the output of git diff --name-status. A renamed
+// file is reported as deleted under its old name, so that the tests
+// depending on it are still found, and as modified under its new name, so
+// that a moved test is not taken for a new one. The lines which cannot be
+// parsed are logged and skipped.
+func parseChangedFiles(out string, log *logrus.Logger) ([]ti.File, []FileRename) {
 	res := []ti.File{}
+	var renames []FileRename
 
-	for _, l := range strings.Split(string(out), "\n") {
-		t := strings.Fields(l)
-		// t looks like:
+	for _, l := range strings.Split(out, "\n") {
+		// the fields are separated by tabs, the names may hold spaces. t looks like:
 		// <M/A/D file_name> for modified/added/deleted files
 		// <RXYZ old_file new_file> for renamed files where XYZ denotes %age similarity
-		if len(t) == 0 {
+		t := strings.Split(strings.TrimRight(l, "\r"), "\t")
+		if t[0] == "" {
 			break
 		}
+		if len(t) < 2 { //nolint:gomnd
+			log.WithField("line", l).Errorln("cannot parse the changed file")
+			continue
+		}
 
 		if t[0][0] == 'M' {
 			res = append(res, ti.File{Status: ti.FileModified, Name: t[1]})
@@ -256,16 +228,23 @@ func getChangedFiles(ctx context.Context, workspace string, log *logrus.Logger,
 			res = append(res, ti.File{Status: ti.FileAdded, Name: t[1]})
 		} else if t[0][0] == 'D' {
 			res = append(res, ti.File{Status: ti.FileDeleted, Name: t[1]})
-		} else if t[0][0] == 'R' {
-			res = append(res, ti.File{Status: ti.FileDeleted, Name: t[1]}) //nolint:gocritic
-			res = append(res, ti.File{Status: ti.FileAdded, Name: t[2]})
+		} else if t[0][0] == 'R' { //nolint:gocritic
+			if len(t) != 3 { //nolint:gomnd
+				log.WithField("line", l).Errorln("cannot parse the renamed file")
+				continue
+			}
+			similarity, _ := strconv.Atoi(t[0][1:])
+			res = append(res,
+				ti.File{Status: ti.FileDeleted, Name: t[1]},
+				ti.File{Status: ti.FileModified, Name: t[2]})
+			renames = append(renames, FileRename{Old: t[1], New: t[2], Similarity: similarity})
 		} else {
 			// Log the error, don't error out for now
-			log.WithError(err).WithField("status", t[0]).WithField("file", t[1]).Errorln("unsupported file status")
-			return res, nil
+			log.WithField("status", t[0]).WithField("line", l).Errorln("unsupported file status")
+			continue
 		}
 	}
-	return res, nil
+	return res, renames
 }
 
 // addBazelFilesToChangedFiles takes a list of files and removes bazel build files and adds java files listed in target src globs
@@ -430,7 +409,14 @@ func SelectTests(ctx context.Context, workspace string, files []ti.File, runSele
 	}
 	req := &ti.SelectTestsReq{SelectAll: !runSelected, Files: files, TiConfig: tiConfigYaml, TestGlobs: testGlobs}
 	c := cfg.GetClient()
-	return c.SelectTests(ctx, stepID, cfg.GetSourceBranch(), cfg.GetTargetBranch(), req)
+	resp, err := c.SelectTests(ctx, stepID, cfg.GetSourceBranch(), cfg.GetTargetBranch(), req)
+	CaptureDebug(ctx, func(b *DebugBundle) {
+		b.Request, b.Response = req, &resp
+		if err != nil {
+			b.Error = err.Error()
+		}
+	})
+	return resp, err
 }
 
 func filterTestsAfterSelection(selection ti.SelectTestsResp, testGlobs, excludeGlobs []string) ti.SelectTestsResp {
@@ -475,7 +461,7 @@ func formatTests(tests []ti.RunnableTest) string {
 func DownloadFile(ctx context.Context, path, url string, fs filesystem.FileSystem) error {
 	// Create the nested directory if it doesn't exist
 	dir := filepath.Dir(path)
-	if err := fs.MkdirAll(dir, os.ModePerm); err != nil {
+	if err := fs.MkdirAll(dir, fileperm.Mode(os.ModePerm)); err != nil {
 		return fmt.Errorf("could not create nested directory: %s", err)
 	}
 	// Create the file
@@ -526,7 +512,7 @@ func GetV2AgentDownloadLinks(ctx context.Context, config *tiCfg.Cfg, useQAEnv bo
 
 // installAgents checks if the required artifacts are installed for the language
 // and if not, installs them. It returns back the directory where all the agents are installed.
-func installAgents(ctx context.Context, baseDir, language, os, arch, framework string,
+func installAgents(ctx context.Context, stepID, baseDir, language, os, arch, framework string,
 	fs filesystem.FileSystem, log *logrus.Logger, config *tiCfg.Cfg) (string, error) {
 	// Get download links from TI service
 	c := config.GetClient()
@@ -538,6 +524,8 @@ func installAgents(ctx context.Context, baseDir, language, os, arch, framework s
 	}
 
 	var installDir string // directory where all the agents are installed
+	agents := make(map[string]string)
+	defer RecordAgents(stepID, agents)
 
 	// Install the Artifacts
 	for idx, l := range links {
@@ -554,6 +542,7 @@ func installAgents(ctx context.Context, baseDir, language, os, arch, framework s
 			log.WithError(err).Printf("could not download %s to path %s\n", l.URL, installDir)
 			return "", err
 		}
+		agents[filepath.Base(l.RelPath)] = l.URL
 	}
 
 	return installDir, nil
@@ -570,7 +559,7 @@ func createConfigFile(runner TestRunner, packages, annotations, workspace, tmpDi
 	fs filesystem.FileSystem, log *logrus.Logger, yaml bool) (string, error) {
 	// Create config file
 	dir := getCgDir(tmpDir)
-	err := fs.MkdirAll(dir, os.ModePerm)
+	err := fs.MkdirAll(dir, fileperm.Mode(os.ModePerm))
 	if err != nil {
 		log.WithError(err).Errorln(fmt.Sprintf("could not create nested directory %s", dir))
 		return "", err
@@ -66,3 +66,29 @@ func TestGetV2AgentDownloadLinks(t *testing.T) {
 		})
 	}
 }
+
+func TestParseChangedFiles(t *testing.T) {
+	out := "M\tsrc/main/A.java\n" +
+		"R100\tsrc/test/old/ATest.java\tsrc/test/new/ATest.java\n" +
+		"R060\tsrc/main/B.java\tsrc/main/C.java\n" +
+		"R090\tsrc/main/My Page.java\n" +
+		"R090\tsrc/main/My Page.java\tsrc/main/Page.java\n" +
+		"X\tsrc/main/E.java\n" +
+		"A\tsrc/main/D.java\n"
+	files, renames := parseChangedFiles(out, logrus.New())
+	assert.Equal(t, []ti.File{
+		{Status: ti.FileModified, Name: "src/main/A.java"},
+		{Status: ti.FileDeleted, Name: "src/test/old/ATest.java"},
+		{Status: ti.FileModified, Name: "src/test/new/ATest.java"},
+		{Status: ti.FileDeleted, Name: "src/main/B.java"},
+		{Status: ti.FileModified, Name: "src/main/C.java"},
+		{Status: ti.FileDeleted, Name: "src/main/My Page.java"},
+		{Status: ti.FileModified, Name: "src/main/Page.java"},
+		{Status: ti.FileAdded, Name: "src/main/D.java"},
+	}, files)
+	assert.Equal(t, []FileRename{
+		{Old: "src/test/old/ATest.java", New: "src/test/new/ATest.java", Similarity: 100},
+		{Old: "src/main/B.java", New: "src/main/C.java", Similarity: 60},
+		{Old: "src/main/My Page.java", New: "src/main/Page.java", Similarity: 90},
+	}, renames)
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/ti-client/types"
+)
+
+const (
+	aggregatesOutputKey = "test_aggregates"
+	maxAggregates       = 10
+)
+
+// Aggregate holds the test counts of a suite or package.
+type Aggregate struct {
+	Name       string `json:"name"`
+	Total      int    `json:"total"`
+	Failed     int    `json:"failed"`
+	Skipped    int    `json:"skipped"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Aggregates are the per suite and per package test counts of a step.
+type Aggregates struct {
+	TopFailingPackages []*Aggregate `json:"top_failing_packages"`
+	SlowestSuites      []*Aggregate `json:"slowest_suites"`
+}
+
+func aggregatesFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-test-aggregates.json", pipeline.SharedVolPath, stepID)
+}
+
+// writeAggregates writes the aggregates of the tests of the step.
+func writeAggregates(stepID string, tests []*types.TestCase) error {
+	data, err := json.Marshal(aggregate(tests))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(aggregatesFile(stepID), data, annotationFilePerm)
+}
+
+// readAggregates returns the aggregates of the tests of the step. They are
+// read once.
+func readAggregates(stepID string) (string, bool) {
+	data, err := os.ReadFile(aggregatesFile(stepID))
+	if err != nil {
+		return "", false
+	}
+	_ = os.Remove(aggregatesFile(stepID))
+	return string(data), true
+}
+
+// aggregate returns the packages with the most failed tests and the slowest suites.
+func aggregate(tests []*types.TestCase) *Aggregates {
+	packages := map[string]*Aggregate{}
+	suites := map[string]*Aggregate{}
+	for _, t := range tests {
+		add(packages, packageName(t), t)
+		add(suites, t.SuiteName, t)
+	}
+
+	failing := values(packages)
+	failing = filter(failing, func(a *Aggregate) bool { return a.Failed > 0 })
+	sort.SliceStable(failing, func(i, j int) bool { return failing[i].Failed > failing[j].Failed })
+
+	slowest := values(suites)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].DurationMs > slowest[j].DurationMs })
+
+	return &Aggregates{
+		TopFailingPackages: limit(failing),
+		SlowestSuites:      limit(slowest),
+	}
+}
+
+func add(m map[string]*Aggregate, name string, t *types.TestCase) {
+	a, ok := m[name]
+	if !ok {
+		a = &Aggregate{Name: name}
+		m[name] = a
+	}
+	a.Total++
+	a.DurationMs += t.DurationMs
+	switch t.Result.Status {
+	case types.StatusFailed, types.StatusError:
+		a.Failed++
+	case types.StatusSkipped:
+		a.Skipped++
+	}
+}
+
+// packageName returns the package of the test class eg. io.harness for
+// io.harness.FooTest, or the directory of the test file otherwise.
+func packageName(t *types.TestCase) string {
+	if i := strings.LastIndex(t.ClassName, "."); i > 0 {
+		return t.ClassName[:i]
+	}
+	if t.FileName != "" {
+		return filepath.Dir(t.FileName)
+	}
+	return t.ClassName
+}
+
+// values returns the aggregates sorted by name so that ties keep a stable order.
+func values(m map[string]*Aggregate) []*Aggregate {
+	out := make([]*Aggregate, 0, len(m))
+	for _, a := range m {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func filter(in []*Aggregate, keep func(*Aggregate) bool) []*Aggregate {
+	out := in[:0]
+	for _, a := range in {
+		if keep(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func limit(in []*Aggregate) []*Aggregate {
+	if len(in) > maxAggregates {
+		return in[:maxAggregates]
+	}
+	return in
+}
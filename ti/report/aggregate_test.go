@@ -0,0 +1,56 @@
+package report
+
+import (
+	"os"
+	"testing"
+
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	failed := types.Result{Status: types.StatusFailed}
+	passed := types.Result{Status: types.StatusPassed}
+	tests := []*types.TestCase{
+		{Name: "a", ClassName: "io.harness.FooTest", SuiteName: "foo", DurationMs: 10, Result: failed},
+		{Name: "b", ClassName: "io.harness.FooTest", SuiteName: "foo", DurationMs: 10, Result: passed},
+		{Name: "c", ClassName: "io.harness.api.BarTest", SuiteName: "bar", DurationMs: 100, Result: failed},
+		{Name: "d", ClassName: "io.harness.api.BazTest", SuiteName: "baz", DurationMs: 5, Result: failed},
+		{Name: "e", ClassName: "test_main", FileName: "tests/test_main.py", SuiteName: "pytest", DurationMs: 1, Result: passed},
+	}
+
+	got := aggregate(tests)
+	assert.Equal(t, []*Aggregate{
+		{Name: "io.harness.api", Total: 2, Failed: 2, DurationMs: 105},
+		{Name: "io.harness", Total: 2, Failed: 1, DurationMs: 20},
+	}, got.TopFailingPackages)
+	assert.Equal(t, []string{"bar", "foo", "baz", "pytest"}, names(got.SlowestSuites))
+}
+
+func names(aggregates []*Aggregate) []string {
+	var out []string
+	for _, a := range aggregates {
+		out = append(out, a.Name)
+	}
+	return out
+}
+
+func TestReadAggregates(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	failed := []*types.TestCase{{Name: "a", ClassName: "io.harness.FooTest", SuiteName: "foo", Result: types.Result{Status: types.StatusFailed}}}
+	assert.NoError(t, writeAggregates("step-aggregates-1", failed))
+	assert.NoError(t, writeAggregates("step-aggregates-2", nil))
+
+	// the aggregates are kept by step and read once
+	got, ok := readAggregates("step-aggregates-1")
+	assert.True(t, ok)
+	assert.Contains(t, got, "io.harness")
+	_, ok = readAggregates("step-aggregates-1")
+	assert.False(t, ok)
+	got, ok = readAggregates("step-aggregates-2")
+	assert.True(t, ok)
+	assert.NotContains(t, got, "io.harness")
+}
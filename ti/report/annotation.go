@@ -0,0 +1,149 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/ti-client/types"
+)
+
+const (
+	maxAnnotatedFailures = 20
+	maxSlowestTests      = 10
+	maxMessageLength     = 500
+	annotationFilePerm   = 0600
+	testSummaryContext   = "test-summary"
+)
+
+// AnnotationFile returns the path of the test summary annotation of a step.
+func AnnotationFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-test-summary.json", pipeline.SharedVolPath, stepID)
+}
+
+// writeAnnotation writes the test summary annotation of the step.
+func writeAnnotation(stepID string, tests []*types.TestCase) error {
+	style := api.AnnotationStyleSuccess
+	for _, t := range tests {
+		if t.Result.Status == types.StatusFailed || t.Result.Status == types.StatusError {
+			style = api.AnnotationStyleError
+			break
+		}
+	}
+	data, err := json.Marshal(&api.Annotation{
+		Context:  testSummaryContext,
+		Style:    style,
+		Markdown: SummaryMarkdown(tests),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(AnnotationFile(stepID), data, annotationFilePerm)
+}
+
+// ReadAnnotation returns the test summary annotation of the step, if any.
+// The annotation is read once, its file is removed.
+func ReadAnnotation(stepID string) *api.Annotation {
+	return readAnnotation(AnnotationFile(stepID))
+}
+
+func readAnnotation(path string) *api.Annotation {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_ = os.Remove(path)
+	a := new(api.Annotation)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil
+	}
+	return a
+}
+
+// SummaryMarkdown returns a markdown summary of the tests with the totals,
+// the failed tests along with their messages and the slowest tests.
+func SummaryMarkdown(tests []*types.TestCase) string {
+	var passed, failed, skipped int
+	var durationMs int64
+	var failures []*types.TestCase
+	for _, t := range tests {
+		durationMs += t.DurationMs
+		switch t.Result.Status {
+		case types.StatusFailed, types.StatusError:
+			failed++
+			failures = append(failures, t)
+		case types.StatusSkipped:
+			skipped++
+		default:
+			passed++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("### Test summary\n\n")
+	sb.WriteString("| Total | Passed | Failed | Skipped | Duration |\n")
+	sb.WriteString("| --- | --- | --- | --- | --- |\n")
+	fmt.Fprintf(&sb, "| %d | %d | %d | %d | %.2fs |\n", len(tests), passed, failed, skipped, float64(durationMs)/1000) //nolint:gomnd
+
+	if len(failures) > 0 {
+		sb.WriteString("\n#### Failures\n\n")
+		for i, t := range failures {
+			if i == maxAnnotatedFailures {
+				fmt.Fprintf(&sb, "\n_and %d more_\n", len(failures)-maxAnnotatedFailures)
+				break
+			}
+			fmt.Fprintf(&sb, "- **%s**\n", markdownEscape(testName(t)))
+			if msg := strings.TrimSpace(t.Result.Message); msg != "" {
+				msg = truncate(msg, maxMessageLength)
+				fmt.Fprintf(&sb, "  ```\n  %s\n  ```\n", strings.ReplaceAll(msg, "\n", "\n  "))
+			}
+		}
+	}
+
+	slowest := append([]*types.TestCase(nil), tests...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].DurationMs > slowest[j].DurationMs })
+	if len(slowest) > maxSlowestTests {
+		slowest = slowest[:maxSlowestTests]
+	}
+	if len(slowest) > 0 {
+		sb.WriteString("\n#### Slowest tests\n\n")
+		sb.WriteString("| Test | Duration |\n")
+		sb.WriteString("| --- | --- |\n")
+		for _, t := range slowest {
+			fmt.Fprintf(&sb, "| %s | %dms |\n", markdownEscape(testName(t)), t.DurationMs)
+		}
+	}
+	return sb.String()
+}
+
+func testName(t *types.TestCase) string {
+	if t.ClassName == "" {
+		return t.Name
+	}
+	return t.ClassName + "." + t.Name
+}
+
+// truncate returns the first n bytes of s, cut on a rune boundary, with an
+// ellipsis if s is longer.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`").Replace(s)
+}
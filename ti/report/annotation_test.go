@@ -0,0 +1,51 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryMarkdown(t *testing.T) {
+	tests := []*types.TestCase{
+		{Name: "testAdd", ClassName: "Calc", DurationMs: 20, Result: types.Result{Status: types.StatusPassed}},
+		{Name: "testDiv", ClassName: "Calc", DurationMs: 1500,
+			Result: types.Result{Status: types.StatusFailed, Message: "expected 2\nbut was 3"}},
+		{Name: "test_pipe|name", DurationMs: 5, Result: types.Result{Status: types.StatusSkipped}},
+	}
+
+	md := SummaryMarkdown(tests)
+	assert.Contains(t, md, "| 3 | 1 | 1 | 1 | 1.52s |")
+	assert.Contains(t, md, "- **Calc.testDiv**\n  ```\n  expected 2\n  but was 3\n  ```\n")
+	assert.Contains(t, md, "| test\\_pipe\\|name | 5ms |")
+	// slowest tests are listed first
+	assert.Less(t, strings.Index(md, "| Calc.testDiv | 1500ms |"), strings.Index(md, "| Calc.testAdd | 20ms |"))
+
+	md = SummaryMarkdown(tests[:1])
+	assert.NotContains(t, md, "Failures")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	// the 2 bytes rune is not split
+	got := truncate("abcdé", 5)
+	assert.Equal(t, "abcd...", got)
+	assert.True(t, utf8.ValidString(got))
+}
+
+func TestReadAnnotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "step-test-summary.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"context": "test-summary", "style": "success"}`), annotationFilePerm))
+	a := readAnnotation(path)
+	if assert.NotNil(t, a) {
+		assert.Equal(t, "test-summary", a.Context)
+	}
+	// the annotation is read once
+	assert.NoFileExists(t, path)
+	assert.Nil(t, readAnnotation(path))
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/report/parser/junit"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	attachmentsEnv           = "HARNESS_JUNIT_ATTACHMENTS"
+	attachmentMaxSizeEnv     = "HARNESS_JUNIT_ATTACHMENT_MAX_SIZE"
+	defaultAttachmentMaxSize = 10 << 20 // 10 MiB
+	maxAttachments           = 100
+	fileUploadArtifactKind   = "fileUpload/v1"
+)
+
+// Attachment is a file referenced by a test case with the
+// [[ATTACHMENT|path]] convention.
+type Attachment struct {
+	Test string `json:"test"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// fileUploadArtifact is the format of the artifact file of the steps
+// uploading files.
+type fileUploadArtifact struct {
+	Kind string `json:"kind"`
+	Data struct {
+		FileArtifacts []FileArtifact `json:"fileArtifacts"`
+	} `json:"data"`
+}
+
+// FileArtifact is an uploaded file of the artifact of a step.
+type FileArtifact struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func attachmentsEnabled(envs map[string]string) bool {
+	return envs[attachmentsEnv] == "true"
+}
+
+func attachmentMaxSize(envs map[string]string) int64 {
+	if v, err := strconv.ParseInt(envs[attachmentMaxSizeEnv], 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultAttachmentMaxSize
+}
+
+func attachmentsFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-test-attachments.json", pipeline.SharedVolPath, stepID)
+}
+
+// uploadAttachments uploads the files attached to the tests through the log
+// service and records their links for the artifact of the step, keyed by
+// the annotationID. Attachments which do not resolve inside one of the roots
+// or exceed the size limit are skipped.
+func uploadAttachments(ctx context.Context, stepID, annotationID, workDir string, roots []string, tests []*types.TestCase,
+	tiConfig *tiCfg.Cfg, log *logrus.Logger, envs map[string]string) error {
+	uploader, ok := pipeline.GetState().GetLogStreamClient().(logstream.BlobUploader)
+	if !ok {
+		log.Warnln("test attachments are not supported by the log service client, skipping them")
+		return nil
+	}
+	prefix := blobKey(tiConfig, stepID, "attachments")
+	maxSize := attachmentMaxSize(envs)
+
+	var attachments []*Attachment
+	seen := make(map[string]bool)
+	for _, t := range tests {
+		for _, p := range append(junit.Attachments(t.SystemOut), junit.Attachments(t.SystemErr)...) {
+			if len(attachments) == maxAttachments {
+				log.Warnln(fmt.Sprintf("only the first %d test attachments are uploaded", maxAttachments))
+				return writeAttachments(annotationID, attachments)
+			}
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(workDir, p)
+			}
+			path, err := safepath.Confine(p, roots...)
+			if err != nil {
+				log.WithError(err).WithField("path", p).Warnln("skipping test attachment")
+				continue
+			}
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			url, err := uploadAttachment(ctx, uploader, fmt.Sprintf("%s/%d-%s", prefix, len(attachments), filepath.Base(path)), path, maxSize)
+			if err != nil {
+				log.WithError(err).WithField("path", path).Warnln("failed to upload test attachment")
+				continue
+			}
+			attachments = append(attachments, &Attachment{Test: testName(t), Name: filepath.Base(path), URL: url})
+		}
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+	log.Infoln(fmt.Sprintf("Uploaded %d test attachments", len(attachments)))
+	return writeAttachments(annotationID, attachments)
+}
+
+// blobKey returns the key of a file of the step uploaded through the log service.
+func blobKey(tiConfig *tiCfg.Cfg, stepID, name string) string {
+	return strings.Join([]string{tiConfig.GetAccountID(), tiConfig.GetOrgID(), tiConfig.GetProjectID(),
+		tiConfig.GetPipelineID(), tiConfig.GetBuildID(), tiConfig.GetStageID(), stepID, name}, "/")
+}
+
+func uploadAttachment(ctx context.Context, uploader logstream.BlobUploader, key, path string, maxSize int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("not a regular file")
+	}
+	if info.Size() > maxSize {
+		return "", fmt.Errorf("size %d exceeds the limit of %d bytes", info.Size(), maxSize)
+	}
+	return uploader.UploadBlob(ctx, key, f)
+}
+
+func writeAttachments(stepID string, attachments []*Attachment) error {
+	data, err := json.Marshal(attachments)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(attachmentsFile(stepID), data, annotationFilePerm)
+}
+
+// AddAttachmentsToArtifact adds the links of the test attachments of the step
+// to its artifact. Artifacts of another kind are returned unchanged. The
+// attachments are read once.
+func AddAttachmentsToArtifact(stepID string, artifact []byte) []byte {
+	data, err := os.ReadFile(attachmentsFile(stepID))
+	if err != nil {
+		return artifact
+	}
+	_ = os.Remove(attachmentsFile(stepID))
+	var attachments []*Attachment
+	if err := json.Unmarshal(data, &attachments); err != nil {
+		return artifact
+	}
+	return mergeAttachments(artifact, attachments)
+}
+
+func mergeAttachments(artifact []byte, attachments []*Attachment) []byte {
+	files := make([]FileArtifact, 0, len(attachments))
+	for _, at := range attachments {
+		files = append(files, FileArtifact{Name: at.Test + "/" + at.Name, URL: at.URL})
+	}
+	return MergeFileArtifacts(artifact, files)
+}
+
+// UploadArtifactFile uploads a file generated for the step through the log
+// service and adds its link to the artifact of the step.
+func UploadArtifactFile(ctx context.Context, tiConfig *tiCfg.Cfg, stepID, name string, data []byte, artifact []byte) ([]byte, error) {
+	uploader, ok := pipeline.GetState().GetLogStreamClient().(logstream.BlobUploader)
+	if !ok {
+		return artifact, errors.New("file uploads are not supported by the log service client")
+	}
+	url, err := uploader.UploadBlob(ctx, blobKey(tiConfig, stepID, name), bytes.NewReader(data))
+	if err != nil {
+		return artifact, err
+	}
+	return MergeFileArtifacts(artifact, []FileArtifact{{Name: name, URL: url}}), nil
+}
+
+// MergeFileArtifacts adds the files to the file upload artifact of the step.
+// Artifacts of another kind are returned unchanged.
+func MergeFileArtifacts(artifact []byte, files []FileArtifact) []byte {
+	if len(files) == 0 {
+		return artifact
+	}
+	a := fileUploadArtifact{Kind: fileUploadArtifactKind}
+	if len(artifact) > 0 {
+		if err := json.Unmarshal(artifact, &a); err != nil || a.Kind != fileUploadArtifactKind {
+			return artifact
+		}
+	}
+	a.Data.FileArtifacts = append(a.Data.FileArtifacts, files...)
+	out, err := json.Marshal(&a)
+	if err != nil {
+		return artifact
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package report
+
+import (
+	"os"
+	"testing"
+
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeAttachments(t *testing.T) {
+	attachments := []*Attachment{{Test: "LoginTest.testLogin", Name: "login.png", URL: "https://log.svc/blob?key=1"}}
+
+	assert.JSONEq(t, `{"kind":"fileUpload/v1","data":{"fileArtifacts":[
+		{"name":"LoginTest.testLogin/login.png","url":"https://log.svc/blob?key=1"}]}}`,
+		string(mergeAttachments(nil, attachments)))
+
+	existing := []byte(`{"kind":"fileUpload/v1","data":{"fileArtifacts":[{"name":"report.html","url":"https://s3/report.html"}]}}`)
+	assert.JSONEq(t, `{"kind":"fileUpload/v1","data":{"fileArtifacts":[
+		{"name":"report.html","url":"https://s3/report.html"},
+		{"name":"LoginTest.testLogin/login.png","url":"https://log.svc/blob?key=1"}]}}`,
+		string(mergeAttachments(existing, attachments)))
+
+	// artifacts of other kinds are not modified
+	docker := []byte(`{"kind":"dockerArtifact/v1","data":{}}`)
+	assert.Equal(t, docker, mergeAttachments(docker, attachments))
+	assert.Equal(t, existing, mergeAttachments(existing, nil))
+}
+
+func TestAddAttachmentsToArtifact(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	attachments := []*Attachment{{Test: "LoginTest.testLogin", Name: "login.png", URL: "https://log.svc/blob?key=1"}}
+	assert.NoError(t, writeAttachments("step-attachments-1", attachments))
+
+	// the attachments are kept by step and read once
+	assert.Nil(t, AddAttachmentsToArtifact("step-attachments-2", nil))
+	assert.Equal(t, mergeAttachments(nil, attachments), AddAttachmentsToArtifact("step-attachments-1", nil))
+	assert.Nil(t, AddAttachmentsToArtifact("step-attachments-1", nil))
+}
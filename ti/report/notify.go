@@ -0,0 +1,75 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"context"
+	"strings"
+
+	"github.com/harness/lite-engine/notify"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+// notifyTests posts the summary of the tests of the step to the webhook of
+// the stage if set. A failure is only logged.
+func notifyTests(ctx context.Context, stepID string, tests []*types.TestCase, tiConfig *tiCfg.Cfg, log *logrus.Logger, secrets []string) {
+	publishSummary(ctx, summarize(stepID, tests, tiConfig), log, secrets)
+}
+
+// publishSummary posts the summary to the webhook of the stage if set, the
+// secrets of the stage and of the step masked. A failure is only logged.
+func publishSummary(ctx context.Context, s *notify.Summary, log *logrus.Logger, secrets []string) {
+	state := pipeline.GetState()
+	cfg := state.GetNotify()
+	if cfg == nil {
+		return
+	}
+	if err := notify.Publish(ctx, cfg, s, append(state.GetSecrets(), secrets...)); err != nil {
+		log.WithError(err).Warnln("failed to post the test summary")
+		return
+	}
+	log.Infoln("Posted the test summary")
+}
+
+// summarize returns the summary of the tests posted to the webhook.
+func summarize(stepID string, tests []*types.TestCase, tiConfig *tiCfg.Cfg) *notify.Summary {
+	s := newSummary(stepID, tiConfig)
+	addToSummary(s, tests)
+	return s
+}
+
+// newSummary returns the summary of the step without tests.
+func newSummary(stepID string, tiConfig *tiCfg.Cfg) *notify.Summary {
+	var title []string
+	for _, part := range []string{tiConfig.GetPipelineID(), tiConfig.GetBuildID(), tiConfig.GetStageID(), stepID} {
+		if part != "" {
+			title = append(title, part)
+		}
+	}
+	return &notify.Summary{Title: strings.Join(title, " / ")}
+}
+
+// addToSummary adds the tests to the summary, only the first failures are
+// kept.
+func addToSummary(s *notify.Summary, tests []*types.TestCase) {
+	s.Total += len(tests)
+	for _, t := range tests {
+		s.DurationMs += t.DurationMs
+		switch t.Result.Status {
+		case types.StatusFailed, types.StatusError:
+			s.Failed++
+			if len(s.Failures) < notify.MaxFailures {
+				s.Failures = append(s.Failures, notify.Failure{Name: testName(t), Message: t.Result.Message})
+			}
+		case types.StatusSkipped:
+			s.Skipped++
+		default:
+			s.Passed++
+		}
+	}
+}
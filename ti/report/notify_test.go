@@ -0,0 +1,42 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/notify"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	tiConfig := tiCfg.New("app.harness.io", "", "", "", "", "deploy", "42", "build", "", "", "", "", "", "", "", false, false)
+	tests := []*types.TestCase{
+		{Name: "TestLogin", ClassName: "api", DurationMs: 100, Result: types.Result{Status: types.StatusFailed, Message: "boom"}},
+		{Name: "TestLogout", ClassName: "api", DurationMs: 50, Result: types.Result{Status: types.StatusPassed}},
+		{Name: "TestSlow", DurationMs: 0, Result: types.Result{Status: types.StatusSkipped}},
+	}
+
+	s := summarize("test", tests, &tiConfig)
+	assert.Equal(t, "deploy / 42 / build / test", s.Title)
+	assert.Equal(t, 3, s.Total)
+	assert.Equal(t, 1, s.Passed)
+	assert.Equal(t, 1, s.Failed)
+	assert.Equal(t, 1, s.Skipped)
+	assert.Equal(t, int64(150), s.DurationMs)
+	assert.Equal(t, "api.TestLogin", s.Failures[0].Name)
+}
+
+func TestAddToSummary_Batches(t *testing.T) {
+	s := &notify.Summary{}
+	for i := 0; i < 3; i++ {
+		batch := make([]*types.TestCase, 4)
+		for j := range batch {
+			batch[j] = &types.TestCase{Name: "TestCase", Result: types.Result{Status: types.StatusFailed}}
+		}
+		addToSummary(s, batch)
+	}
+	assert.Equal(t, 12, s.Total)
+	assert.Equal(t, 12, s.Failed)
+	assert.Len(t, s.Failures, notify.MaxFailures)
+}
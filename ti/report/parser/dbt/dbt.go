@@ -0,0 +1,96 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package dbt parses the dbt run results into test cases.
+package dbt
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+)
+
+// RunResultsFile is the name of the file dbt writes the results of a
+// command to.
+const RunResultsFile = "run_results.json"
+
+const suiteName = "dbt"
+
+type runResults struct {
+	Results []struct {
+		UniqueID      string  `json:"unique_id"`
+		Status        string  `json:"status"`
+		ExecutionTime float64 `json:"execution_time"`
+		Message       string  `json:"message"`
+	} `json:"results"`
+}
+
+// IsRunResults reports whether the file holds dbt run results.
+func IsRunResults(file string) bool {
+	return filepath.Base(file) == RunResultsFile
+}
+
+// ParseRunResults returns the test cases of the dbt tests in the run
+// results file, the results of the other nodes, eg. the models built by
+// `dbt build`, are skipped.
+func ParseRunResults(file string) ([]*ti.TestCase, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	results := new(runResults)
+	if err = json.Unmarshal(data, results); err != nil {
+		return nil, err
+	}
+	var tests []*ti.TestCase
+	for _, r := range results.Results {
+		class, name, ok := testName(r.UniqueID)
+		if !ok {
+			continue
+		}
+		tests = append(tests, &ti.TestCase{
+			Name:       name,
+			ClassName:  class,
+			SuiteName:  suiteName,
+			Result:     result(r.Status, r.Message),
+			DurationMs: int64(r.ExecutionTime * 1000), //nolint:gomnd
+		})
+	}
+	return tests, nil
+}
+
+// testName returns the class and name of the test node, eg. the package
+// and name of test.jaffle_shop.unique_orders_order_id.fed79b3a6e or the
+// model and name of unit_test.jaffle_shop.orders.test_order_total.
+func testName(id string) (class, name string, ok bool) {
+	parts := strings.Split(id, ".")
+	switch {
+	case parts[0] == "test" && len(parts) >= 3:
+		return parts[1], parts[2], true
+	case parts[0] == "unit_test" && len(parts) >= 4:
+		return parts[2], parts[3], true
+	default:
+		return "", "", false
+	}
+}
+
+// result maps the dbt status of a test, a test with a warn severity which
+// found failures passes with its message.
+func result(status, message string) ti.Result {
+	switch strings.ToLower(status) {
+	case "fail":
+		return ti.Result{Status: ti.StatusFailed, Message: message}
+	case "error", "runtime error":
+		return ti.Result{Status: ti.StatusError, Message: message}
+	case "skipped":
+		return ti.Result{Status: ti.StatusSkipped, Message: message}
+	case "warn":
+		return ti.Result{Status: ti.StatusPassed, Message: message}
+	default:
+		return ti.Result{Status: ti.StatusPassed}
+	}
+}
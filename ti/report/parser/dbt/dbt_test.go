@@ -0,0 +1,39 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package dbt
+
+import (
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRunResults(t *testing.T) {
+	tests, err := ParseRunResults("testdata/run_results.json")
+	assert.Nil(t, err)
+	assert.Len(t, tests, 5)
+
+	assert.Equal(t, &ti.TestCase{
+		Name:       "unique_orders_order_id",
+		ClassName:  "jaffle_shop",
+		SuiteName:  "dbt",
+		Result:     ti.Result{Status: ti.StatusPassed},
+		DurationMs: 52,
+	}, tests[0])
+	assert.Equal(t, ti.Result{Status: ti.StatusFailed, Message: "Got 3 results, configured to fail if != 0"}, tests[1].Result)
+	assert.Equal(t, ti.Status(ti.StatusPassed), tests[2].Result.Status)
+	assert.Equal(t, "orders", tests[3].ClassName)
+	assert.Equal(t, "test_order_total", tests[3].Name)
+	assert.Equal(t, ti.Status(ti.StatusError), tests[3].Result.Status)
+	assert.Equal(t, ti.Status(ti.StatusSkipped), tests[4].Result.Status)
+}
+
+func TestParseRunResultsInvalid(t *testing.T) {
+	_, err := ParseRunResults("testdata/missing.json")
+	assert.Error(t, err)
+	assert.True(t, IsRunResults("target/run_results.json"))
+	assert.False(t, IsRunResults("target/manifest.json"))
+}
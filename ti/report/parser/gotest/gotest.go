@@ -0,0 +1,129 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package gotest parses the output of go test -json into test cases. The
+// class of a test is its package, the subtests are test cases too.
+package gotest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+)
+
+// event is a line of the output of go test -json, see go doc test2json.
+type event struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64 // seconds
+	Output  string
+}
+
+type key struct {
+	pkg, test string
+}
+
+// ParseFile returns the test cases of the go test -json output file.
+func ParseFile(file string) ([]*ti.TestCase, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse returns the test cases of the go test -json output. The lines which
+// are not events, eg. the build errors written to stderr, are skipped. A
+// package failing without failed tests, eg. which does not build or panics
+// outside of its tests, is an errored test case named after the package.
+func Parse(r io.Reader) ([]*ti.TestCase, error) {
+	var (
+		tests   []*ti.TestCase
+		outputs = make(map[key]*strings.Builder)
+		failed  = make(map[string]bool) // the packages with failed tests
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal(line, &e); err != nil || e.Action == "" {
+			continue
+		}
+		k := key{pkg: e.Package, test: e.Test}
+		switch e.Action {
+		case "output":
+			out := outputs[k]
+			if out == nil {
+				out = new(strings.Builder)
+				outputs[k] = out
+			}
+			out.WriteString(e.Output)
+		case "pass", "fail", "skip":
+			output := ""
+			if out := outputs[k]; out != nil {
+				output = out.String()
+				delete(outputs, k)
+			}
+			if e.Test == "" {
+				if e.Action == "fail" && !failed[e.Package] {
+					tests = append(tests, &ti.TestCase{
+						Name:       e.Package,
+						ClassName:  e.Package,
+						SuiteName:  e.Package,
+						DurationMs: int64(e.Elapsed * 1000), //nolint:gomnd
+						Result:     ti.Result{Status: ti.StatusError, Message: "the package failed", Desc: output},
+					})
+				}
+				continue
+			}
+			if e.Action == "fail" {
+				failed[e.Package] = true
+			}
+			tests = append(tests, convert(&e, output))
+		}
+	}
+	return tests, scanner.Err()
+}
+
+func convert(e *event, output string) *ti.TestCase {
+	t := &ti.TestCase{
+		Name:       e.Test,
+		ClassName:  e.Package,
+		SuiteName:  e.Package,
+		DurationMs: int64(e.Elapsed * 1000), //nolint:gomnd
+		SystemOut:  output,
+	}
+	switch e.Action {
+	case "pass":
+		t.Result = ti.Result{Status: ti.StatusPassed}
+	case "skip":
+		t.Result = ti.Result{Status: ti.StatusSkipped, Message: message(output, "--- SKIP")}
+	default:
+		t.Result = ti.Result{Status: ti.StatusFailed, Message: message(output, "--- FAIL"), Desc: output}
+	}
+	return t
+}
+
+// message returns the first line logged by the test, the lines of go test
+// itself are skipped.
+func message(output, result string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "=== ") || strings.HasPrefix(line, result) {
+			continue
+		}
+		return line
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package gotest
+
+import (
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFile(t *testing.T) {
+	tests, err := ParseFile("testdata/report.json")
+	require.NoError(t, err)
+	require.Len(t, tests, 5)
+
+	assert.Equal(t, "TestAdd", tests[0].Name)
+	assert.Equal(t, "example.com/calc", tests[0].ClassName)
+	assert.Equal(t, "example.com/calc", tests[0].SuiteName)
+	assert.Equal(t, int64(10), tests[0].DurationMs)
+	assert.Equal(t, ti.Result{Status: ti.StatusPassed}, tests[0].Result)
+
+	assert.Equal(t, "TestDiv/by_zero", tests[1].Name)
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[1].Result.Status)
+	assert.Equal(t, "calc_test.go:20: expected an error", tests[1].Result.Message)
+	assert.Contains(t, tests[1].Result.Desc, "--- FAIL: TestDiv/by_zero")
+
+	assert.Equal(t, "TestDiv", tests[2].Name)
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[2].Result.Status)
+
+	assert.Equal(t, "TestSlow", tests[3].Name)
+	assert.Equal(t, ti.Result{Status: ti.StatusSkipped, Message: "calc_test.go:30: skipping in short mode"}, tests[3].Result)
+
+	// the package failed without failed tests
+	assert.Equal(t, "example.com/broken", tests[4].Name)
+	assert.Equal(t, ti.Status(ti.StatusError), tests[4].Result.Status)
+	assert.Contains(t, tests[4].Result.Desc, "[build failed]")
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"regexp"
+	"strings"
+)
+
+// attachmentPattern matches the [[ATTACHMENT|path]] convention used by the
+// junit attachments plugin and selenium suites to reference files, eg.
+// screenshots, from the output of a test case.
+var attachmentPattern = regexp.MustCompile(`\[\[ATTACHMENT\|([^\]\r\n]+)\]\]`)
+
+// Attachments returns the paths of the files attached in the output of a test case.
+func Attachments(output string) []string {
+	var paths []string
+	for _, m := range attachmentPattern.FindAllStringSubmatch(output, -1) {
+		if p := strings.TrimSpace(m[1]); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// keepAttachments prepends the attachment references of the output which
+// were cut off when truncating it.
+func keepAttachments(output, truncated string) string {
+	if len(output) == len(truncated) {
+		return truncated
+	}
+	cut := len(output) - len(truncated)
+	var sb strings.Builder
+	for _, loc := range attachmentPattern.FindAllStringIndex(output, -1) {
+		if loc[0] >= cut {
+			break
+		}
+		sb.WriteString(output[loc[0]:loc[1]])
+		sb.WriteString("\n")
+	}
+	return sb.String() + truncated
+}
@@ -0,0 +1,29 @@
+package junit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+	out := "opening login page\n[[ATTACHMENT|/harness/screenshots/login.png]]\nclicked\n[[ATTACHMENT| target/page.html ]][[ATTACHMENT|]]"
+	assert.Equal(t, []string{"/harness/screenshots/login.png", "target/page.html"}, Attachments(out))
+	assert.Empty(t, Attachments("no attachments"))
+}
+
+func TestKeepAttachments(t *testing.T) {
+	out := "[[ATTACHMENT|a.png]]\n" + strings.Repeat("x", 100) + "\n[[ATTACHMENT|b.png]]"
+	l := limits{maxSize: 30}
+
+	got := keepAttachments(out, l.restrictLength(out))
+	assert.Equal(t, []string{"a.png", "b.png"}, Attachments(got))
+
+	// a reference cut in the middle is kept as well
+	l.maxSize = 10
+	got = keepAttachments(out, l.restrictLength(out))
+	assert.Equal(t, []string{"a.png", "b.png"}, Attachments(got))
+
+	assert.Equal(t, "short", keepAttachments("short", "short"))
+}
@@ -255,7 +255,7 @@ func TestExamplesInTheWild(t *testing.T) { //nolint:funlen
 		name := fmt.Sprintf("#%d - %s", index+1, test.title)
 
 		t.Run(name, func(t *testing.T) {
-			suites, err := IngestFile(test.filename, "Root Suite")
+			suites, err := IngestFile(test.filename, "Root Suite", nil)
 			require.NoError(t, err)
 			test.check(t, suites)
 		})
@@ -301,7 +301,7 @@ func TestCustomRootSuite(t *testing.T) {
 		name := fmt.Sprintf("#%d - %s", index+1, test.title)
 
 		t.Run(name, func(t *testing.T) {
-			suites, err := IngestFile(test.filename, "Custom Root Suite")
+			suites, err := IngestFile(test.filename, "Custom Root Suite", nil)
 			require.NoError(t, err)
 			test.check(t, suites)
 		})
@@ -13,28 +13,34 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/harness/lite-engine/internal/charset"
+	"golang.org/x/text/encoding"
 )
 
 // IngestFile will parse the given XML file and return a slice of all contained
-// JUnit test suite definitions.
-func IngestFile(filename, rootSuiteName string) ([]Suite, error) {
+// JUnit test suite definitions. The file is transcoded to UTF-8 from the
+// encoding of its declaration, or from the fallback encoding if any.
+func IngestFile(filename, rootSuiteName string, fallback encoding.Encoding) ([]Suite, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	return IngestReader(file, rootSuiteName, strings.HasSuffix(filename, ".trx"))
+	reader, err := charset.NewXMLReader(file, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return IngestReader(reader, rootSuiteName, strings.HasSuffix(filename, ".trx"))
 }
 
 // IngestReader will parse the given XML reader and return a slice of all
 // contained JUnit test suite definitions.
 func IngestReader(reader io.Reader, rootSuiteName string, trxFormat bool) ([]Suite, error) {
 	var (
-		suiteChan = make(chan Suite)
-		suites    = make([]Suite, 0)
-		nodes     []xmlNode
-		err       error
+		nodes []xmlNode
+		err   error
 	)
 
 	if trxFormat {
@@ -46,6 +52,15 @@ func IngestReader(reader io.Reader, rootSuiteName string, trxFormat bool) ([]Sui
 	if err != nil {
 		return nil, err
 	}
+	return ingestNodes(nodes, rootSuiteName), nil
+}
+
+// ingestNodes returns the test suites found in the graph of nodes.
+func ingestNodes(nodes []xmlNode, rootSuiteName string) []Suite {
+	var (
+		suiteChan = make(chan Suite)
+		suites    = make([]Suite, 0)
+	)
 
 	go func() {
 		findSuites(nodes, suiteChan, "", rootSuiteName)
@@ -55,8 +70,7 @@ func IngestReader(reader io.Reader, rootSuiteName string, trxFormat bool) ([]Sui
 	for suite := range suiteChan {
 		suites = append(suites, suite)
 	}
-
-	return suites, nil
+	return suites
 }
 
 // Ingest will parse the given XML data and return a slice of all contained
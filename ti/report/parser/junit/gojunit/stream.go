@@ -0,0 +1,90 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package gojunit
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+
+	"github.com/harness/lite-engine/internal/charset"
+	"golang.org/x/text/encoding"
+)
+
+// StreamFile parses the given XML file test case by test case, only one
+// test case is held in memory at a time. The function is called with the
+// name of the suite and the test case in the order of the document, it
+// stops the parsing by returning false. The test cases read before an error
+// are passed to the function. The TRX files are not supported. The file is
+// transcoded like in IngestFile.
+func StreamFile(filename, rootSuiteName string, fallback encoding.Encoding, fn func(suite string, test Test) bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := charset.NewXMLReader(file, fallback)
+	if err != nil {
+		return err
+	}
+	return StreamReader(reader, rootSuiteName, fn)
+}
+
+// StreamReader parses the given XML reader like StreamFile.
+func StreamReader(reader io.Reader, rootSuiteName string, fn func(suite string, test Test) bool) error {
+	type suite struct {
+		name     string
+		filename string // the file of the suite, the one of its parent if not set
+	}
+	var (
+		dec          = xml.NewDecoder(reader)
+		suites       []suite
+		rootFilename string // the file of the root suite, for the top-level suites
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "testsuite":
+				attrs := attrMap(t.Attr)
+				parent := rootFilename
+				if n := len(suites); n > 0 {
+					parent = suites[n-1].filename
+				}
+				suites = append(suites, suite{name: attrs["name"], filename: getFilename(attrs["file"], parent)})
+				if len(suites) == 1 && attrs["name"] == rootSuiteName {
+					rootFilename = attrs["file"]
+				}
+			case "testcase":
+				if len(suites) == 0 {
+					if err := dec.Skip(); err != nil {
+						return err
+					}
+					continue
+				}
+				var node xmlNode
+				if err := dec.DecodeElement(&node, &t); err != nil {
+					return err
+				}
+				s := suites[len(suites)-1]
+				if !fn(s.name, ingestTestcase(node, s.filename)) {
+					return nil
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "testsuite" && len(suites) > 0 {
+				suites = suites[:len(suites)-1]
+			}
+		}
+	}
+}
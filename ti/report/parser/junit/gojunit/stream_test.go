@@ -0,0 +1,80 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package gojunit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamedTest struct {
+	suite string
+	test  Test
+}
+
+func flatten(suites []Suite) []streamedTest {
+	var tests []streamedTest
+	for _, s := range suites { //nolint:gocritic
+		for _, t := range s.Tests { //nolint:gocritic
+			tests = append(tests, streamedTest{suite: s.Name, test: t})
+		}
+		tests = append(tests, flatten(s.Suites)...)
+	}
+	return tests
+}
+
+func TestStreamFile_SameAsIngest(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.xml")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		suites, err := IngestFile(file, "", nil)
+		require.NoError(t, err, file)
+		var got []streamedTest
+		err = StreamFile(file, "", nil, func(suite string, test Test) bool {
+			got = append(got, streamedTest{suite: suite, test: test})
+			return true
+		})
+		require.NoError(t, err, file)
+		want := flatten(suites)
+		require.Len(t, got, len(want), file)
+		for i := range want {
+			assert.Equal(t, want[i].suite, got[i].suite, file)
+			assert.Equal(t, want[i].test.Name, got[i].test.Name, file)
+			assert.Equal(t, want[i].test.Classname, got[i].test.Classname, file)
+			assert.Equal(t, want[i].test.Filename, got[i].test.Filename, file)
+			assert.Equal(t, want[i].test.Result.Status, got[i].test.Result.Status, file)
+		}
+	}
+}
+
+func TestStreamReader_Stop(t *testing.T) {
+	xml := `<testsuites>
+		<testsuite name="a"><testcase name="one"/><testcase name="two"/></testsuite>
+		<testsuite name="b"><testcase name="three"/></testsuite>
+	</testsuites>`
+	var names []string
+	err := StreamReader(strings.NewReader(xml), "", func(suite string, test Test) bool {
+		names = append(names, test.Name)
+		return len(names) < 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, names)
+}
+
+func TestStreamReader_Malformed(t *testing.T) {
+	xml := `<testsuite name="a"><testcase name="one"/><testcase name="two"`
+	var names []string
+	err := StreamReader(strings.NewReader(xml), "", func(suite string, test Test) bool {
+		names = append(names, test.Name)
+		return true
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"one"}, names)
+}
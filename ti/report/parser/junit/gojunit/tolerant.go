@@ -0,0 +1,247 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package gojunit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/harness/lite-engine/internal/charset"
+	"golang.org/x/text/encoding"
+)
+
+var (
+	cdataStartTag = []byte("<![CDATA[")
+	cdataEndTag   = []byte("]]>")
+	closingTag    = []byte("</")
+
+	// charRefPattern matches numeric character references, eg. &#27; for
+	// the escape character of colored console output.
+	charRefPattern = regexp.MustCompile(`&#([xX][0-9a-fA-F]+|[0-9]+);`)
+)
+
+// Status describes how a report file was parsed.
+type Status struct {
+	// Recovered is true if the file is malformed and the suites were
+	// recovered by the tolerant parser.
+	Recovered bool
+	// Sanitized is the number of illegal characters removed from the file.
+	Sanitized int
+	// Err is the error of the strict parser if the file was recovered.
+	Err error
+}
+
+// IngestFileTolerant parses the given XML file like IngestFile. If the file
+// is malformed, it removes the illegal characters, closes the unterminated
+// CDATA sections and returns the suites parsed up to the first unrecoverable
+// error instead of failing the whole file.
+func IngestFileTolerant(filename, rootSuiteName string, fallback encoding.Encoding) ([]Suite, Status, error) {
+	data, err := readFile(filename, fallback)
+	if err != nil {
+		return nil, Status{}, err
+	}
+	trxFormat := strings.HasSuffix(filename, ".trx")
+	suites, err := IngestReader(bytes.NewReader(data), rootSuiteName, trxFormat)
+	if err == nil || trxFormat {
+		return suites, Status{}, err
+	}
+
+	status := Status{Recovered: true, Err: err}
+	data, status.Sanitized = sanitize(data)
+	nodes, perr := parseTolerant(data)
+	if perr != nil && len(nodes) == 0 {
+		return nil, status, err
+	}
+	return ingestNodes(nodes, rootSuiteName), status, nil
+}
+
+// readFile returns the XML file transcoded to UTF-8.
+func readFile(filename string, fallback encoding.Encoding) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := charset.NewXMLReader(file, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// sanitize removes the characters which are not allowed in XML documents,
+// replaces invalid UTF-8 sequences and closes the CDATA sections which are
+// not terminated. It returns the sanitized data and the number of removed
+// or replaced characters.
+func sanitize(data []byte) ([]byte, int) {
+	count := 0
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			out = append(out, "\uFFFD"...)
+			count++
+		case !isXMLChar(r):
+			count++
+		default:
+			out = append(out, data[:size]...)
+		}
+		data = data[size:]
+	}
+
+	out = charRefPattern.ReplaceAllFunc(out, func(ref []byte) []byte {
+		s := string(ref[2 : len(ref)-1])
+		base := 10
+		if s[0] == 'x' || s[0] == 'X' {
+			s, base = s[1:], 16
+		}
+		if v, err := strconv.ParseInt(s, base, 32); err == nil && isXMLChar(rune(v)) {
+			return ref
+		}
+		count++
+		return nil
+	})
+	return closeCDATA(out), count
+}
+
+// isXMLChar returns whether the rune is allowed in XML 1.0 documents.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// closeCDATA terminates the CDATA sections which are not closed before the
+// next CDATA section or the end of the data, right before the closing tag
+// following them.
+func closeCDATA(data []byte) []byte {
+	var out []byte
+	for {
+		start := bytes.Index(data, cdataStartTag)
+		if start == -1 {
+			return append(out, data...)
+		}
+		start += len(cdataStartTag)
+		out = append(out, data[:start]...)
+		data = data[start:]
+
+		end := bytes.Index(data, cdataEndTag)
+		next := bytes.Index(data, cdataStartTag)
+		if end != -1 && (next == -1 || end < next) {
+			out = append(out, data[:end+len(cdataEndTag)]...)
+			data = data[end+len(cdataEndTag):]
+			continue
+		}
+		limit := len(data)
+		if next != -1 {
+			limit = next
+		}
+		closing := bytes.Index(data[:limit], closingTag)
+		if closing == -1 {
+			closing = limit
+		}
+		out = append(out, data[:closing]...)
+		out = append(out, cdataEndTag...)
+		data = data[closing:]
+	}
+}
+
+// parseTolerant builds the graph of nodes of the data token by token. Unlike
+// parse, it does not fail on mismatched tags and unknown entities. On an
+// unrecoverable error, the elements still open are closed and the nodes parsed
+// so far are returned along with the error. Test cases which are not
+// terminated are dropped.
+func parseTolerant(data []byte) ([]xmlNode, error) {
+	type frame struct {
+		node        xmlNode
+		start       int64
+		selfClosing bool
+	}
+
+	wrapped, err := io.ReadAll(reparentXML(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	dec := xml.NewDecoder(bytes.NewReader(wrapped))
+	dec.Strict = false
+
+	var (
+		stack []*frame
+		root  xmlNode
+		perr  error
+	)
+	closeFrame := func(f *frame) {
+		if len(stack) == 0 {
+			root = f.node
+			return
+		}
+		parent := &stack[len(stack)-1].node
+		parent.Nodes = append(parent.Nodes, f.node)
+	}
+
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				perr = err
+			}
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, &frame{
+				node:        xmlNode{XMLName: t.Name, Attrs: attrMap(t.Attr)},
+				start:       dec.InputOffset(),
+				selfClosing: bytes.HasSuffix(wrapped[offset:dec.InputOffset()], []byte("/>")),
+			})
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			// the decoder closes the elements left open by a mismatched
+			// end tag, eg. at the end of a truncated file
+			tag := wrapped[offset:dec.InputOffset()]
+			if f.node.XMLName.Local == "testcase" && !f.selfClosing &&
+				!(bytes.HasPrefix(tag, closingTag) && bytes.Contains(tag, []byte(t.Name.Local))) {
+				continue
+			}
+			f.node.Content = tolerantContent(wrapped[f.start:offset])
+			closeFrame(f)
+		}
+	}
+
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.node.XMLName.Local == "testcase" {
+			continue
+		}
+		closeFrame(f)
+	}
+	return root.Nodes, perr
+}
+
+// tolerantContent is extractContent which keeps the raw data of unmatched
+// CDATA tags.
+func tolerantContent(data []byte) []byte {
+	if content, err := extractContent(data); err == nil {
+		return content
+	}
+	return []byte(html.UnescapeString(string(data)))
+}
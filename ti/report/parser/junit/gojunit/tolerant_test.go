@@ -0,0 +1,94 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package gojunit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	out, n := sanitize([]byte("ok\x1b[31mred\x00 &#27;[0m &#x1B; &#65; \xff\ttab"))
+	assert.Equal(t, "ok[31mred [0m  &#65; �\ttab", string(out))
+	assert.Equal(t, 5, n)
+}
+
+func TestCloseCDATA(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"<a><![CDATA[x]]></a>", "<a><![CDATA[x]]></a>"},
+		{"<a><![CDATA[x</a>", "<a><![CDATA[x]]></a>"},
+		{"<a><![CDATA[x</a><b><![CDATA[y]]></b>", "<a><![CDATA[x]]></a><b><![CDATA[y]]></b>"},
+		{"<a><![CDATA[x", "<a><![CDATA[x]]>"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.out, string(closeCDATA([]byte(test.in))))
+	}
+}
+
+func TestIngestFileTolerant(t *testing.T) {
+	tests := []struct {
+		title     string
+		data      string
+		recovered bool
+		names     []string
+	}{
+		{
+			title: "valid",
+			data:  `<testsuite name="s"><testcase name="a"/><testcase name="b"/></testsuite>`,
+			names: []string{"a", "b"},
+		},
+		{
+			title:     "control characters",
+			data:      "<testsuite name=\"s\"><testcase name=\"a\"><system-out>\x1b[32mok</system-out></testcase></testsuite>",
+			recovered: true,
+			names:     []string{"a"},
+		},
+		{
+			title:     "unclosed cdata",
+			data:      `<testsuite name="s"><testcase name="a"><failure><![CDATA[boom</failure></testcase><testcase name="b"/></testsuite>`,
+			recovered: true,
+			names:     []string{"a", "b"},
+		},
+		{
+			title:     "truncated file",
+			data:      `<testsuite name="s"><testcase name="a"/><testcase name="b"><failure message="x">`,
+			recovered: true,
+			names:     []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "report.xml")
+			require.NoError(t, os.WriteFile(file, []byte(test.data), 0600))
+
+			suites, status, err := IngestFileTolerant(file, "Root Suite", nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.recovered, status.Recovered)
+			if test.recovered {
+				assert.Error(t, status.Err)
+			}
+			require.Len(t, suites, 1)
+			var names []string
+			for _, tc := range suites[0].Tests {
+				names = append(names, tc.Name)
+			}
+			assert.Equal(t, test.names, names)
+			if test.title == "unclosed cdata" {
+				assert.Equal(t, "boom", suites[0].Tests[0].Result.Desc)
+			}
+		})
+	}
+}
+
+func TestIngestFileTolerantFailure(t *testing.T) {
+	_, _, err := IngestFileTolerant(filepath.Join(t.TempDir(), "missing.xml"), "Root Suite", nil)
+	assert.Error(t, err)
+}
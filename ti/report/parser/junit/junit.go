@@ -9,20 +9,27 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/harness/lite-engine/internal/charset"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/ti/report/parser/dbt"
 	"github.com/harness/lite-engine/ti/report/parser/junit/gojunit"
 	ti "github.com/harness/ti-client/types"
 	"github.com/mattn/go-zglob"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
 )
 
 const (
-	strMaxSize = 8000 // Keep the last 8k characters in each field.
+	strMaxSize = 8000 // Default maximum number of characters of each field.
 )
 
 const defaultRootSuiteName = "Root Suite"
 const rootSuiteEnvVariableName = "HARNESS_JUNIT_ROOT_SUITE_NAME"
 
+// strictParsingEnv disables the recovery of malformed report files.
+const strictParsingEnv = "HARNESS_JUNIT_STRICT_PARSING"
+
 func getRootSuiteName(envs map[string]string) string {
 	if val, ok := envs[rootSuiteEnvVariableName]; ok {
 		return val
@@ -32,23 +39,98 @@ func getRootSuiteName(envs map[string]string) string {
 
 // ParseTests parses XMLs and writes relevant data to the channel
 func ParseTests(paths []string, log *logrus.Logger, envs map[string]string) []*ti.TestCase {
-	files := getFiles(paths, log)
+	return parseFiles(getFiles(paths, log), log, envs)
+}
+
+// ParseTestsConfined parses XMLs similar to ParseTests but skips the report files
+// which do not resolve inside one of the root directories or match one of the
+// ignore patterns.
+func ParseTestsConfined(paths, ignore, roots []string, log *logrus.Logger, envs map[string]string) []*ti.TestCase {
+	return parseFiles(confinedFiles(paths, ignore, roots, log), log, envs)
+}
+
+// ParseFilesConfined parses the report files selected like ParseTestsConfined
+// with parse, eg. the TAP reports. The fields of the test cases are truncated
+// like the ones of the JUnit reports.
+func ParseFilesConfined(paths, ignore, roots []string, log *logrus.Logger, envs map[string]string,
+	parse func(file string) ([]*ti.TestCase, error)) []*ti.TestCase {
+	files := confinedFiles(paths, ignore, roots, log)
+	log.Debugln(fmt.Sprintf("list of files to collect test reports from: %s", files))
+	if len(files) == 0 {
+		log.Errorln("could not find any files matching the provided report path")
+	}
+	fileMap := make(map[string]int)
+	l := getLimits(envs)
+	var tests []*ti.TestCase
+	for _, file := range files {
+		cases, err := parse(file)
+		if err != nil {
+			log.WithError(err).WithField("file", file).
+				Errorln(fmt.Sprintf("could not parse file %s, kept %d test cases", file, len(cases)))
+		}
+		for _, t := range cases {
+			t.Result.Message = l.truncateTrace(t.Result.Message)
+			t.Result.Desc = l.truncateTrace(t.Result.Desc)
+			t.SystemOut = l.restrictLength(t.SystemOut)
+			t.SystemErr = l.restrictLength(t.SystemErr)
+		}
+		tests = append(tests, cases...)
+		fileMap[file] = len(cases)
+	}
+	log.Infoln("Number of cases parsed in each file: ", fileMap)
+	log.WithField("num_cases", len(tests)).Infoln(fmt.Sprintf("Parsed %d test cases", len(tests)))
+	return tests
+}
 
+// confinedFiles returns the report files matching the paths which resolve
+// inside one of the root directories and match none of the ignore patterns.
+func confinedFiles(paths, ignore, roots []string, log *logrus.Logger) []string {
+	var files []string
+	for _, file := range filterIgnored(getFiles(paths, log), ignore, log) {
+		if _, err := safepath.ConfineInput(file, roots...); err != nil {
+			log.WithError(err).WithField("file", file).Warnln("skipping report file")
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func parseFiles(files []string, log *logrus.Logger, envs map[string]string) []*ti.TestCase {
 	log.Debugln(fmt.Sprintf("list of files to collect test reports from: %s", files))
 	if len(files) == 0 {
 		log.Errorln("could not find any files matching the provided report path")
 	}
 	fileMap := make(map[string]int)
 	totalTests := 0
+	l := getLimits(envs)
+	strict := envs[strictParsingEnv] == "true"
+	enc, _ := charset.FromEnvs(envs)
 	var tests []*ti.TestCase
 	for _, file := range files {
-		suites, err := gojunit.IngestFile(file, getRootSuiteName(envs))
+		if dbt.IsRunResults(file) {
+			cases, err := dbt.ParseRunResults(file)
+			if err != nil {
+				log.WithError(err).WithField("file", file).
+					Errorln(fmt.Sprintf("could not parse file %s", file))
+				continue
+			}
+			tests = append(tests, cases...)
+			totalTests += len(cases)
+			fileMap[file] = len(cases)
+			continue
+		}
+		suites, status, err := ingestFile(file, getRootSuiteName(envs), strict, enc)
 		if err != nil {
 			log.WithError(err).WithField("file", file).
 				Errorln(fmt.Sprintf("could not parse file %s", file))
 			continue
 		}
-		testsInFile := processTestSuites(&tests, suites)
+		testsInFile := processTestSuites(&tests, suites, l)
+		if status.Recovered {
+			log.WithError(status.Err).WithField("file", file).WithField("sanitized_chars", status.Sanitized).
+				Warnln(fmt.Sprintf("file %s is malformed, recovered %d test cases", file, testsInFile))
+		}
 		totalTests += testsInFile
 		fileMap[file] = testsInFile
 	}
@@ -57,19 +139,27 @@ func ParseTests(paths []string, log *logrus.Logger, envs map[string]string) []*t
 	return tests
 }
 
+func ingestFile(file, rootSuiteName string, strict bool, enc encoding.Encoding) ([]gojunit.Suite, gojunit.Status, error) {
+	if strict {
+		suites, err := gojunit.IngestFile(file, rootSuiteName, enc)
+		return suites, gojunit.Status{}, err
+	}
+	return gojunit.IngestFileTolerant(file, rootSuiteName, enc)
+}
+
 // processTestSuites recusively writes the test data from parsed data to the
 // input channel and returns the total number of tests written to the channel
-func processTestSuites(tests *[]*ti.TestCase, suites []gojunit.Suite) int {
+func processTestSuites(tests *[]*ti.TestCase, suites []gojunit.Suite, l limits) int {
 	totalTests := 0
 	for _, suite := range suites { //nolint:gocritic
 		for _, test := range suite.Tests { //nolint:gocritic
-			ct := convert(test, suite)
+			ct := convert(test, suite, l)
 			if ct.Name != "" {
 				*tests = append(*tests, ct)
 				totalTests++
 			}
 		}
-		totalTests += processTestSuites(tests, suite.Suites)
+		totalTests += processTestSuites(tests, suite.Suites, l)
 	}
 	return totalTests
 }
@@ -110,9 +200,9 @@ func uniqueItems(items []string) []string {
 }
 
 // convert combines relevant information in test cases and test suites and parses it to our custom format
-func convert(testCase gojunit.Test, testSuite gojunit.Suite) *ti.TestCase { //nolint:gocritic
-	testCase.Result.Desc = restrictLength(testCase.Result.Desc)
-	testCase.Result.Message = restrictLength(testCase.Result.Message)
+func convert(testCase gojunit.Test, testSuite gojunit.Suite, l limits) *ti.TestCase { //nolint:gocritic
+	testCase.Result.Desc = l.truncateTrace(testCase.Result.Desc)
+	testCase.Result.Message = l.truncateTrace(testCase.Result.Message)
 	return &ti.TestCase{
 		Name:       testCase.Name,
 		SuiteName:  testSuite.Name,
@@ -120,17 +210,9 @@ func convert(testCase gojunit.Test, testSuite gojunit.Suite) *ti.TestCase { //no
 		FileName:   testCase.Filename,
 		DurationMs: testCase.DurationMs,
 		Result:     testCase.Result,
-		SystemOut:  restrictLength(testCase.SystemOut),
-		SystemErr:  restrictLength(testCase.SystemErr),
-	}
-}
-
-// restrictLength trims string to last strMaxsize characters
-func restrictLength(s string) string {
-	if len(s) <= strMaxSize {
-		return s
+		SystemOut:  keepAttachments(testCase.SystemOut, l.restrictLength(testCase.SystemOut)),
+		SystemErr:  keepAttachments(testCase.SystemErr, l.restrictLength(testCase.SystemErr)),
 	}
-	return s[len(s)-strMaxSize:]
 }
 
 // expandTilde method expands the given file path to include the home directory
@@ -13,6 +13,7 @@ import (
 	ti "github.com/harness/ti-client/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/japanese"
 )
 
 var (
@@ -348,3 +349,30 @@ func Test_GetRootSuiteName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTests_Charset(t *testing.T) {
+	dir := t.TempDir()
+	declared, err := japanese.ShiftJIS.NewEncoder().String(`<?xml version="1.0" encoding="Shift_JIS"?>` +
+		`<testsuite name="スイート"><testcase classname="テスト" name="成功"/></testsuite>`)
+	assert.Nil(t, err)
+	undeclared, err := japanese.ShiftJIS.NewEncoder().String(`<testsuite name="スイート"><testcase classname="テスト" name="失敗"/></testsuite>`)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(dir+"/declared.xml", []byte(declared), 0600))
+	assert.Nil(t, os.WriteFile(dir+"/undeclared.xml", []byte(undeclared), 0600))
+
+	log := logrus.New()
+	log.Out = io.Discard
+	names := func(tests []*ti.TestCase) []string {
+		var out []string
+		for _, test := range tests {
+			out = append(out, test.ClassName+"."+test.Name)
+		}
+		return out
+	}
+	tests := ParseTests([]string{dir + "/declared.xml"}, log, map[string]string{})
+	assert.Equal(t, []string{"テスト.成功"}, names(tests))
+
+	// the files with no declaration are decoded with the charset of the step
+	tests = ParseTests([]string{dir + "/undeclared.xml"}, log, map[string]string{"LANG": "ja_JP.SJIS"})
+	assert.Equal(t, []string{"テスト.失敗"}, names(tests))
+}
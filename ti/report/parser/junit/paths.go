@@ -0,0 +1,111 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"strings"
+
+	"github.com/mattn/go-zglob"
+	"github.com/sirupsen/logrus"
+)
+
+// PresetAll matches all the XML and TRX files of the workspace.
+const PresetAll = "all"
+
+// presetPaths are the default report paths of the test frameworks of a language.
+var presetPaths = map[string][]string{
+	PresetAll: {"**/*.xml", "**/*.trx"},
+	"java": {
+		"**/surefire-reports/*.xml",
+		"**/failsafe-reports/*.xml",
+		"**/build/test-results/**/*.xml",
+		"**/bazel-testlogs/**/test.xml",
+	},
+	"scala": {"**/target/test-reports/*.xml", "**/surefire-reports/*.xml"},
+	"python": {
+		"**/*junit*.xml",
+		"**/test-results/**/*.xml",
+		"**/test-reports/**/*.xml",
+	},
+	"ruby": {"**/rspec*.xml", "**/*junit*.xml", "**/test-results/**/*.xml"},
+	"javascript": {
+		"**/*junit*.xml",
+		"**/junit-reports/**/*.xml",
+		"**/test-results/**/*.xml",
+		"**/reports/**/*.xml",
+	},
+	"go":     {"**/*junit*.xml", "**/test-results/**/*.xml"},
+	"csharp": {"**/*.trx", "**/TestResults/**/*.xml"},
+}
+
+var presetAliases = map[string]string{
+	"kotlin":     "java",
+	"typescript": "javascript",
+	"dotnet":     "csharp",
+}
+
+// DefaultIgnores are the XML files which are not test reports, eg. build
+// files or coverage and static analysis reports. They are ignored when
+// discovering the report files with the default paths.
+var DefaultIgnores = []string{
+	"**/node_modules/**",
+	"**/.git/**",
+	"**/.idea/**",
+	"**/pom.xml",
+	"**/AndroidManifest.xml",
+	"**/*coverage*.xml",
+	"**/jacoco*.xml",
+	"**/cobertura*.xml",
+	"**/clover*.xml",
+	"**/checkstyle*.xml",
+	"**/spotbugs*.xml",
+	"**/findbugs*.xml",
+	"**/pmd*.xml",
+	"**/lint-results*.xml",
+}
+
+// DefaultPaths returns the default report paths of the language. It returns
+// false if the language is unknown.
+func DefaultPaths(language string) ([]string, bool) {
+	language = strings.ToLower(language)
+	if language == "" {
+		language = PresetAll
+	}
+	if alias, ok := presetAliases[language]; ok {
+		language = alias
+	}
+	paths, ok := presetPaths[language]
+	return append([]string(nil), paths...), ok
+}
+
+// filterIgnored returns the files which do not match any of the ignore patterns.
+func filterIgnored(files, ignore []string, log *logrus.Logger) []string {
+	if len(ignore) == 0 {
+		return files
+	}
+	var result []string
+	for _, file := range files {
+		if pattern, ok := ignored(file, ignore); ok {
+			log.WithField("file", file).Debugln("ignoring report file matching " + pattern)
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+func ignored(file string, ignore []string) (string, bool) {
+	for _, pattern := range ignore {
+		p := pattern
+		// zglob does not match files in sub directories of dir/**
+		if strings.HasSuffix(p, "/**") {
+			p += "/*"
+		}
+		if ok, err := zglob.Match(p, file); err == nil && ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	paths, ok := DefaultPaths("")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"**/*.xml", "**/*.trx"}, paths)
+
+	paths, ok = DefaultPaths("Kotlin")
+	assert.True(t, ok)
+	assert.Contains(t, paths, "**/surefire-reports/*.xml")
+
+	_, ok = DefaultPaths("cobol")
+	assert.False(t, ok)
+}
+
+func TestFilterIgnored(t *testing.T) {
+	files := []string{
+		"/harness/target/surefire-reports/TEST-io.harness.FooTest.xml",
+		"/harness/pom.xml",
+		"/harness/target/site/jacoco/jacoco.xml",
+		"/harness/web/node_modules/pkg/junit.xml",
+		"/harness/coverage.xml",
+		"/harness/build/test-results/test/TEST-Bar.xml",
+	}
+	got := filterIgnored(files, DefaultIgnores, logrus.New())
+	assert.Equal(t, []string{
+		"/harness/target/surefire-reports/TEST-io.harness.FooTest.xml",
+		"/harness/build/test-results/test/TEST-Bar.xml",
+	}, got)
+
+	got = filterIgnored(files[:2], []string{"**/surefire-reports/**"}, logrus.New())
+	assert.Equal(t, []string{"/harness/pom.xml"}, got)
+	assert.Equal(t, files, filterIgnored(files, nil, logrus.New()))
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harness/lite-engine/internal/charset"
+	"github.com/harness/lite-engine/ti/report/parser/dbt"
+	"github.com/harness/lite-engine/ti/report/parser/junit/gojunit"
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultBatchSize is the number of test cases of a batch of the streaming
+// parser if not set.
+const DefaultBatchSize = 1000
+
+// StreamOptions bound the memory of the streaming parser.
+type StreamOptions struct {
+	BatchSize int // test cases per batch, DefaultBatchSize if not set
+	MaxTests  int // test cases parsed at most, no limit if not set
+}
+
+// StreamTestsConfined parses the report files of ParseTestsConfined test
+// case by test case and calls fn with the batches of test cases, so that
+// only a batch is held in memory. The parsing stops once MaxTests test
+// cases are parsed or at the first error of fn, which is returned. It
+// returns the number of test cases passed to fn.
+//
+// The malformed files are not recovered, the test cases read up to the
+// error are kept. The TRX and dbt files are parsed whole.
+func StreamTestsConfined(paths, ignore, roots []string, opts StreamOptions, log *logrus.Logger,
+	envs map[string]string, fn func([]*ti.TestCase) error) (int, error) {
+	files := confinedFiles(paths, ignore, roots, log)
+	log.Debugln(fmt.Sprintf("list of files to stream test reports from: %s", files))
+	if len(files) == 0 {
+		log.Errorln("could not find any files matching the provided report path")
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	l := getLimits(envs)
+
+	var (
+		batch   = make([]*ti.TestCase, 0, size)
+		total   int
+		fnErr   error
+		stopped bool
+	)
+	flush := func() {
+		if len(batch) == 0 || fnErr != nil {
+			return
+		}
+		fnErr = fn(batch)
+		batch = make([]*ti.TestCase, 0, size)
+	}
+	// add adds the test case to the batch, it returns false once the
+	// parsing stops.
+	add := func(t *ti.TestCase) bool {
+		if opts.MaxTests > 0 && total >= opts.MaxTests {
+			stopped = true
+			return false
+		}
+		batch = append(batch, t)
+		total++
+		if len(batch) == size {
+			flush()
+		}
+		return fnErr == nil
+	}
+
+	enc, _ := charset.FromEnvs(envs)
+	fileMap := make(map[string]int)
+	for _, file := range files {
+		if stopped || fnErr != nil {
+			break
+		}
+		start := total
+		var err error
+		switch {
+		case dbt.IsRunResults(file):
+			var cases []*ti.TestCase
+			if cases, err = dbt.ParseRunResults(file); err == nil {
+				for _, c := range cases {
+					if !add(c) {
+						break
+					}
+				}
+			}
+		case strings.HasSuffix(file, ".trx"):
+			var suites []gojunit.Suite
+			if suites, err = gojunit.IngestFile(file, getRootSuiteName(envs), enc); err == nil {
+				addSuites(suites, l, add)
+			}
+		default:
+			err = gojunit.StreamFile(file, getRootSuiteName(envs), enc, func(suite string, test gojunit.Test) bool {
+				ct := convert(test, gojunit.Suite{Name: suite}, l)
+				return ct.Name == "" || add(ct)
+			})
+		}
+		if err != nil {
+			log.WithError(err).WithField("file", file).
+				Errorln(fmt.Sprintf("could not parse file %s, kept %d test cases", file, total-start))
+		}
+		fileMap[file] = total - start
+	}
+	flush()
+	if stopped {
+		log.Warnln(fmt.Sprintf("Stopped parsing the test reports after %d test cases", opts.MaxTests))
+	}
+	log.Infoln("Number of cases parsed in each file: ", fileMap)
+	log.WithField("num_cases", total).Infoln(fmt.Sprintf("Parsed %d test cases", total))
+	return total, fnErr
+}
+
+// addSuites adds the test cases of the suites until add returns false.
+func addSuites(suites []gojunit.Suite, l limits, add func(*ti.TestCase) bool) bool {
+	for _, suite := range suites { //nolint:gocritic
+		for _, test := range suite.Tests { //nolint:gocritic
+			if ct := convert(test, suite, l); ct.Name != "" && !add(ct) {
+				return false
+			}
+		}
+		if !addSuites(suite.Suites, l, add) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamLogger() *logrus.Logger {
+	log := logrus.New()
+	log.Out = io.Discard
+	return log
+}
+
+func TestStreamTestsConfined_Batches(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	paths := []string{filepath.Join(root, "*.xml")}
+	log := streamLogger()
+	want := ParseTestsConfined(paths, nil, []string{root}, log, nil)
+	require.NotEmpty(t, want)
+
+	var batches [][]*ti.TestCase
+	var got []*ti.TestCase
+	total, err := StreamTestsConfined(paths, nil, []string{root}, StreamOptions{BatchSize: 2}, log, nil,
+		func(tests []*ti.TestCase) error {
+			batches = append(batches, tests)
+			got = append(got, tests...)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, len(want), total)
+	assert.ElementsMatch(t, want, got)
+	for _, b := range batches[:len(batches)-1] {
+		assert.Len(t, b, 2)
+	}
+}
+
+func TestStreamTestsConfined_MaxTests(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	var got int
+	total, err := StreamTestsConfined([]string{filepath.Join(root, "*.xml")}, nil, []string{root},
+		StreamOptions{BatchSize: 2, MaxTests: 3}, streamLogger(), nil, func(tests []*ti.TestCase) error {
+			got += len(tests)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 3, got)
+}
+
+func TestStreamTestsConfined_Error(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	calls := 0
+	_, err = StreamTestsConfined([]string{filepath.Join(root, "*.xml")}, nil, []string{root},
+		StreamOptions{BatchSize: 1}, streamLogger(), nil, func(tests []*ti.TestCase) error {
+			calls++
+			return errors.New("upload failed")
+		})
+	assert.EqualError(t, err, "upload failed")
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxFieldSizeEnvVariableName = "HARNESS_JUNIT_MAX_FIELD_SIZE"
+	headLinesEnvVariableName    = "HARNESS_JUNIT_STACKTRACE_HEAD_LINES"
+	tailLinesEnvVariableName    = "HARNESS_JUNIT_STACKTRACE_TAIL_LINES"
+
+	defaultHeadLines = 50
+	defaultTailLines = 20
+	maxFrameCycle    = 4 // longest sequence of frames collapsed when repeated
+)
+
+// limits controls the truncation of the test case fields.
+type limits struct {
+	maxSize   int // maximum number of characters of a field
+	headLines int // leading lines of a failure message kept when truncating
+	tailLines int // trailing lines of a failure message kept when truncating
+}
+
+func getLimits(envs map[string]string) limits {
+	return limits{
+		maxSize:   getPositiveInt(envs, maxFieldSizeEnvVariableName, strMaxSize),
+		headLines: getPositiveInt(envs, headLinesEnvVariableName, defaultHeadLines),
+		tailLines: getPositiveInt(envs, tailLinesEnvVariableName, defaultTailLines),
+	}
+}
+
+func getPositiveInt(envs map[string]string, key string, def int) int {
+	if v, err := strconv.Atoi(envs[key]); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// truncateTrace shortens a failure message or stack trace. Repeated frames
+// are collapsed, and if the trace is still too long only its first and last
+// lines are kept. The result is finally restricted to the maximum size,
+// keeping its beginning and end.
+func (l limits) truncateTrace(s string) string {
+	if len(s) <= l.maxSize && strings.Count(s, "\n") < l.headLines+l.tailLines {
+		return s
+	}
+
+	lines := collapseRepeated(strings.Split(s, "\n"))
+	if len(lines) > l.headLines+l.tailLines {
+		omitted := len(lines) - l.headLines - l.tailLines
+		kept := make([]string, 0, l.headLines+l.tailLines+1)
+		kept = append(kept, lines[:l.headLines]...)
+		kept = append(kept, fmt.Sprintf("... %d lines omitted ...", omitted))
+		kept = append(kept, lines[len(lines)-l.tailLines:]...)
+		lines = kept
+	}
+	s = strings.Join(lines, "\n")
+
+	if len(s) <= l.maxSize {
+		return s
+	}
+	marker := fmt.Sprintf("\n... %d characters omitted ...\n", len(s)-l.maxSize)
+	if len(marker) >= l.maxSize {
+		return s[len(s)-l.maxSize:]
+	}
+	keep := l.maxSize - len(marker)
+	head := runeStart(s, keep/2)     //nolint:gomnd
+	tail := len(s) - (keep - keep/2) //nolint:gomnd
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return s[:head] + marker + s[tail:]
+}
+
+// runeStart returns the largest index not greater than i at which a rune starts.
+func runeStart(s string, i int) int {
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// restrictLength trims the string to its last maxSize characters.
+func (l limits) restrictLength(s string) string {
+	if len(s) <= l.maxSize {
+		return s
+	}
+	return s[len(s)-l.maxSize:]
+}
+
+// collapseRepeated replaces consecutive repetitions of a sequence of up to
+// maxFrameCycle lines, as seen in stack traces of deep recursions, by a
+// single occurrence followed by the number of repetitions.
+func collapseRepeated(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		collapsed := false
+		for n := 1; n <= maxFrameCycle && i+2*n <= len(lines); n++ {
+			repeats := 1
+			for i+(repeats+1)*n <= len(lines) && equalLines(lines[i:i+n], lines[i+repeats*n:i+(repeats+1)*n]) {
+				repeats++
+			}
+			if repeats > 1 {
+				out = append(out, lines[i:i+n]...)
+				out = append(out, fmt.Sprintf("... repeated %d more times ...", repeats-1))
+				i += repeats * n
+				collapsed = true
+				break
+			}
+		}
+		if !collapsed {
+			out = append(out, lines[i])
+			i++
+		}
+	}
+	return out
+}
+
+func equalLines(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
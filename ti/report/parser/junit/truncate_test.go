@@ -0,0 +1,43 @@
+package junit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseRepeated(t *testing.T) {
+	lines := []string{"Error", "at a", "at b", "at c", "at b", "at c", "at b", "at c", "at d", "at d"}
+	assert.Equal(t, []string{
+		"Error", "at a", "at b", "at c", "... repeated 2 more times ...", "at d", "... repeated 1 more times ...",
+	}, collapseRepeated(lines))
+}
+
+func TestTruncateTrace(t *testing.T) {
+	l := limits{maxSize: 1000, headLines: 2, tailLines: 1}
+	assert.Equal(t, "short message", l.truncateTrace("short message"))
+
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("at frame%d", i))
+	}
+	assert.Equal(t, "at frame0\nat frame1\n... 7 lines omitted ...\nat frame9", l.truncateTrace(strings.Join(lines, "\n")))
+
+	l = limits{maxSize: 60, headLines: 50, tailLines: 20}
+	out := l.truncateTrace(strings.Repeat("a", 100) + strings.Repeat("b", 100))
+	assert.Len(t, out, 60)
+	assert.True(t, strings.HasPrefix(out, "aaa"))
+	assert.True(t, strings.HasSuffix(out, "bbb"))
+	assert.Contains(t, out, "characters omitted")
+}
+
+func TestGetLimits(t *testing.T) {
+	assert.Equal(t, limits{maxSize: strMaxSize, headLines: defaultHeadLines, tailLines: defaultTailLines}, getLimits(nil))
+	assert.Equal(t, limits{maxSize: 100, headLines: defaultHeadLines, tailLines: 5}, getLimits(map[string]string{
+		maxFieldSizeEnvVariableName: "100",
+		headLinesEnvVariableName:    "-1",
+		tailLinesEnvVariableName:    "5",
+	}))
+}
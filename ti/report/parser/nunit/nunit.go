@@ -0,0 +1,104 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package nunit parses the NUnit 3 XML reports into test cases. The suite of
+// a test is its assembly and its class is its fixture.
+package nunit
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+)
+
+type testSuite struct {
+	Type   string      `xml:"type,attr"`
+	Name   string      `xml:"name,attr"`
+	Suites []testSuite `xml:"test-suite"`
+	Cases  []testCase  `xml:"test-case"`
+}
+
+type testCase struct {
+	Name       string  `xml:"name,attr"`
+	MethodName string  `xml:"methodname,attr"`
+	ClassName  string  `xml:"classname,attr"`
+	Result     string  `xml:"result,attr"`
+	Label      string  `xml:"label,attr"`
+	Duration   float64 `xml:"duration,attr"` // seconds
+	Failure    struct {
+		Message    string `xml:"message"`
+		StackTrace string `xml:"stack-trace"`
+	} `xml:"failure"`
+	Reason struct {
+		Message string `xml:"message"`
+	} `xml:"reason"`
+	Output string `xml:"output"`
+}
+
+// ParseFile returns the test cases of the NUnit 3 report file.
+func ParseFile(file string) ([]*ti.TestCase, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse returns the test cases of the NUnit 3 report, the test-run document
+// or a single test-suite.
+func Parse(r io.Reader) ([]*ti.TestCase, error) {
+	var root testSuite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	var tests []*ti.TestCase
+	collect(&tests, &root, "")
+	return tests, nil
+}
+
+// collect adds the test cases of the suite and of its nested suites, the
+// assembly is the suite of the test cases.
+func collect(tests *[]*ti.TestCase, s *testSuite, assembly string) {
+	if s.Type == "Assembly" {
+		assembly = path.Base(strings.ReplaceAll(s.Name, `\`, "/"))
+	}
+	for i := range s.Cases {
+		*tests = append(*tests, convert(&s.Cases[i], assembly))
+	}
+	for i := range s.Suites {
+		collect(tests, &s.Suites[i], assembly)
+	}
+}
+
+func convert(c *testCase, assembly string) *ti.TestCase {
+	name := c.Name
+	if name == "" {
+		name = c.MethodName
+	}
+	t := &ti.TestCase{
+		Name:       name,
+		ClassName:  c.ClassName,
+		SuiteName:  assembly,
+		DurationMs: int64(c.Duration * 1000), //nolint:gomnd
+		SystemOut:  c.Output,
+	}
+	switch c.Result {
+	case "Failed":
+		status := ti.StatusFailed
+		if c.Label == "Error" {
+			status = ti.StatusError
+		}
+		t.Result = ti.Result{Status: ti.Status(status), Message: strings.TrimSpace(c.Failure.Message), Desc: strings.TrimSpace(c.Failure.StackTrace)}
+	case "Skipped", "Inconclusive":
+		t.Result = ti.Result{Status: ti.StatusSkipped, Message: strings.TrimSpace(c.Reason.Message)}
+	default: // Passed, Warning
+		t.Result = ti.Result{Status: ti.StatusPassed}
+	}
+	return t
+}
@@ -0,0 +1,39 @@
+package nunit
+
+import (
+	"strings"
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFile(t *testing.T) {
+	tests, err := ParseFile("testdata/nunit3.xml")
+	require.NoError(t, err)
+	require.Len(t, tests, 5)
+
+	for _, tc := range tests {
+		assert.Equal(t, "Calc.Tests.dll", tc.SuiteName)
+		assert.Equal(t, "Calc.CalculatorTests", tc.ClassName)
+	}
+	assert.Equal(t, "Adds", tests[0].Name)
+	assert.Equal(t, int64(12), tests[0].DurationMs)
+	assert.Equal(t, ti.Result{Status: ti.StatusPassed}, tests[0].Result)
+
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[1].Result.Status)
+	assert.Equal(t, "Expected: 2\n  But was:  3", tests[1].Result.Message)
+	assert.Contains(t, tests[1].Result.Desc, "CalculatorTests.cs:line 21")
+
+	assert.Equal(t, ti.Status(ti.StatusError), tests[2].Result.Status)
+	assert.Equal(t, "computing\n", tests[2].SystemOut)
+
+	assert.Equal(t, ti.Result{Status: ti.StatusSkipped, Message: "too slow"}, tests[3].Result)
+	assert.Equal(t, "Squares(2)", tests[4].Name)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("<test-run><test-suite>"))
+	assert.Error(t, err)
+}
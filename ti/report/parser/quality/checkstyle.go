@@ -0,0 +1,58 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package quality
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type checkstyleReport struct {
+	Files []struct {
+		Name   string `xml:"name,attr"`
+		Errors []struct {
+			Line     int    `xml:"line,attr"`
+			Column   int    `xml:"column,attr"`
+			Severity string `xml:"severity,attr"`
+			Message  string `xml:"message,attr"`
+			Source   string `xml:"source,attr"`
+		} `xml:"error"`
+	} `xml:"file"`
+}
+
+// parseCheckstyle parses checkstyle XML reports, which are also produced by
+// many other linters, eg. ktlint, detekt or golangci-lint.
+func parseCheckstyle(data []byte) ([]*Finding, error) {
+	var report checkstyleReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var findings []*Finding
+	for _, f := range report.Files {
+		for _, e := range f.Errors {
+			findings = append(findings, &Finding{
+				Tool:     Checkstyle,
+				Rule:     e.Source,
+				Severity: checkstyleSeverity(e.Severity),
+				File:     f.Name,
+				Line:     e.Line,
+				Column:   e.Column,
+				Message:  e.Message,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func checkstyleSeverity(s string) string {
+	switch strings.ToLower(s) {
+	case "error":
+		return SeverityError
+	case "warning":
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package quality
+
+import "encoding/json"
+
+type eslintResult struct {
+	FilePath string `json:"filePath"`
+	Messages []struct {
+		RuleID   string `json:"ruleId"`
+		Severity int    `json:"severity"`
+		Message  string `json:"message"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+	} `json:"messages"`
+}
+
+// parseESLint parses the output of the eslint json formatter.
+func parseESLint(data []byte) ([]*Finding, error) {
+	var results []eslintResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+	var findings []*Finding
+	for _, r := range results {
+		for _, m := range r.Messages {
+			severity := SeverityWarning
+			if m.Severity == 2 { //nolint:gomnd
+				severity = SeverityError
+			}
+			findings = append(findings, &Finding{
+				Tool:     ESLint,
+				Rule:     m.RuleID,
+				Severity: severity,
+				File:     r.FilePath,
+				Line:     m.Line,
+				Column:   m.Column,
+				Message:  m.Message,
+			})
+		}
+	}
+	return findings, nil
+}
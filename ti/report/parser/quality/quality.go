@@ -0,0 +1,79 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package quality parses the reports of static analysis tools into findings.
+package quality
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Supported report formats.
+const (
+	Checkstyle = "checkstyle"
+	ESLint     = "eslint"
+	SpotBugs   = "spotbugs"
+)
+
+// Severity levels of the findings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Finding is an issue reported by a static analysis tool.
+type Finding struct {
+	Tool     string `json:"tool"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ParseFile parses the report file in the given format. The format is
+// detected from the content of the file if empty.
+func ParseFile(path, format string) ([]*Finding, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, format)
+}
+
+// Parse parses the report in the given format. The format is detected from
+// the content of the report if empty.
+func Parse(data []byte, format string) ([]*Finding, error) {
+	if format == "" {
+		format = detect(data)
+	}
+	switch format {
+	case Checkstyle:
+		return parseCheckstyle(data)
+	case ESLint:
+		return parseESLint(data)
+	case SpotBugs:
+		return parseSpotBugs(data)
+	default:
+		return nil, fmt.Errorf("unknown quality report format %q", format)
+	}
+}
+
+// detect returns the format of the report from its content.
+func detect(data []byte) string {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		return ESLint
+	case bytes.Contains(data, []byte("<checkstyle")):
+		return Checkstyle
+	case bytes.Contains(data, []byte("<BugCollection")):
+		return SpotBugs
+	}
+	return ""
+}
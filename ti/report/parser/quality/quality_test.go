@@ -0,0 +1,89 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package quality
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		want   []*Finding
+	}{
+		{
+			name: "checkstyle",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="8.0">
+  <file name="src/Main.java">
+    <error line="12" column="5" severity="error" message="Missing javadoc." source="com.puppycrawl.tools.checkstyle.checks.javadoc.MissingJavadocMethodCheck"/>
+    <error line="20" severity="warning" message="Line is longer than 100 characters." source="LineLength"/>
+  </file>
+</checkstyle>`,
+			want: []*Finding{
+				{Tool: Checkstyle, Rule: "com.puppycrawl.tools.checkstyle.checks.javadoc.MissingJavadocMethodCheck", Severity: SeverityError,
+					File: "src/Main.java", Line: 12, Column: 5, Message: "Missing javadoc."},
+				{Tool: Checkstyle, Rule: "LineLength", Severity: SeverityWarning, File: "src/Main.java", Line: 20,
+					Message: "Line is longer than 100 characters."},
+			},
+		},
+		{
+			name: "eslint",
+			data: `[{"filePath":"/src/app.js","messages":[
+				{"ruleId":"no-unused-vars","severity":2,"message":"'x' is defined but never used.","line":1,"column":7},
+				{"ruleId":"semi","severity":1,"message":"Missing semicolon.","line":3,"column":10}]},
+				{"filePath":"/src/ok.js","messages":[]}]`,
+			want: []*Finding{
+				{Tool: ESLint, Rule: "no-unused-vars", Severity: SeverityError, File: "/src/app.js", Line: 1, Column: 7,
+					Message: "'x' is defined but never used."},
+				{Tool: ESLint, Rule: "semi", Severity: SeverityWarning, File: "/src/app.js", Line: 3, Column: 10,
+					Message: "Missing semicolon."},
+			},
+		},
+		{
+			name: "spotbugs",
+			data: `<BugCollection version="4.7.3">
+  <BugInstance type="NP_NULL_ON_SOME_PATH" priority="1" category="CORRECTNESS">
+    <ShortMessage>Possible null pointer dereference</ShortMessage>
+    <LongMessage>Possible null pointer dereference of value in Main.run()</LongMessage>
+    <Class classname="Main"><SourceLine classname="Main" sourcepath="Main.java" start="1" end="40"/></Class>
+    <SourceLine classname="Main" sourcepath="Main.java" start="17" end="17" primary="true"/>
+  </BugInstance>
+  <BugInstance type="DM_DEFAULT_ENCODING" priority="3" category="I18N">
+    <ShortMessage>Reliance on default encoding</ShortMessage>
+  </BugInstance>
+</BugCollection>`,
+			want: []*Finding{
+				{Tool: SpotBugs, Rule: "NP_NULL_ON_SOME_PATH", Severity: SeverityError, File: "Main.java", Line: 17,
+					Message: "Possible null pointer dereference of value in Main.run()"},
+				{Tool: SpotBugs, Rule: "DM_DEFAULT_ENCODING", Severity: SeverityInfo, Message: "Reliance on default encoding"},
+			},
+		},
+		{
+			name:   "explicit format",
+			format: ESLint,
+			data:   `[]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse([]byte(test.data), test.format)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	_, err := Parse([]byte(`<testsuites/>`), "")
+	assert.Error(t, err)
+	_, err = Parse([]byte(`[]`), "pmd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package quality
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type spotbugsReport struct {
+	Bugs []struct {
+		Type         string `xml:"type,attr"`
+		Priority     int    `xml:"priority,attr"`
+		ShortMessage string `xml:"ShortMessage"`
+		LongMessage  string `xml:"LongMessage"`
+		SourceLines  []struct {
+			SourcePath string `xml:"sourcepath,attr"`
+			Start      int    `xml:"start,attr"`
+			Primary    bool   `xml:"primary,attr"`
+		} `xml:"SourceLine"`
+	} `xml:"BugInstance"`
+}
+
+// parseSpotBugs parses SpotBugs (and FindBugs) XML reports generated with messages.
+func parseSpotBugs(data []byte) ([]*Finding, error) {
+	var report spotbugsReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var findings []*Finding
+	for _, b := range report.Bugs {
+		f := &Finding{
+			Tool:     SpotBugs,
+			Rule:     b.Type,
+			Severity: spotbugsSeverity(b.Priority),
+			Message:  strings.TrimSpace(b.LongMessage),
+		}
+		if f.Message == "" {
+			f.Message = strings.TrimSpace(b.ShortMessage)
+		}
+		for i, l := range b.SourceLines {
+			if i == 0 || l.Primary {
+				f.File, f.Line = l.SourcePath, l.Start
+			}
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// spotbugsSeverity maps the priority of the bugs: 1 is high, 2 is normal and 3 is low.
+func spotbugsSeverity(priority int) string {
+	switch priority {
+	case 1:
+		return SeverityError
+	case 2: //nolint:gomnd
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sarif validates, merges and summarizes SARIF 2.1.0 logs, the
+// results of static analysis and security scanning tools.
+package sarif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// Version is the supported version of the SARIF format.
+	Version = "2.1.0"
+	// Schema is the json schema of the merged logs.
+	Schema = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Levels of the results.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+	LevelNone    = "none"
+)
+
+// Log is a SARIF log. The runs are kept as is, so a merged log loses none
+// of the properties of the runs.
+type Log struct {
+	Schema  string            `json:"$schema,omitempty"`
+	Version string            `json:"version"`
+	Runs    []json.RawMessage `json:"runs"`
+}
+
+// run holds the properties of a run needed to count its results.
+type run struct {
+	Tool struct {
+		Driver struct {
+			Name string `json:"name"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []struct {
+		Level string `json:"level"`
+	} `json:"results"`
+}
+
+// Summary holds the counts of the results of a log by level.
+type Summary struct {
+	Total    int `json:"total"`
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+	Notes    int `json:"notes"` // the results of the note and none levels
+}
+
+// ParseFile parses and validates the SARIF file.
+func ParseFile(path string) (*Log, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the SARIF log: its version must be 2.1.0 and
+// each run must name its tool and have valid result levels.
+func Parse(data []byte) (*Log, error) {
+	l := new(Log)
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	if l.Version != Version {
+		return nil, fmt.Errorf("unsupported SARIF version %q", l.Version)
+	}
+	if l.Runs == nil {
+		return nil, errors.New("the SARIF log has no runs")
+	}
+	for i, raw := range l.Runs {
+		r := new(run)
+		if err := json.Unmarshal(raw, r); err != nil {
+			return nil, fmt.Errorf("run %d: %w", i, err)
+		}
+		if r.Tool.Driver.Name == "" {
+			return nil, fmt.Errorf("run %d: the tool has no name", i)
+		}
+		for _, res := range r.Results {
+			switch res.Level {
+			case "", LevelError, LevelWarning, LevelNote, LevelNone:
+			default:
+				return nil, fmt.Errorf("run %d: invalid result level %q", i, res.Level)
+			}
+		}
+	}
+	return l, nil
+}
+
+// Merge returns a log with the runs of all the logs.
+func Merge(logs []*Log) *Log {
+	merged := &Log{Schema: Schema, Version: Version, Runs: []json.RawMessage{}}
+	for _, l := range logs {
+		merged.Runs = append(merged.Runs, l.Runs...)
+	}
+	return merged
+}
+
+// Summarize counts the results of the log by level, a result with no level
+// is a warning. The log must be valid.
+func Summarize(l *Log) Summary {
+	var s Summary
+	for _, raw := range l.Runs {
+		r := new(run)
+		if err := json.Unmarshal(raw, r); err != nil {
+			continue
+		}
+		for _, res := range r.Results {
+			s.Total++
+			switch res.Level {
+			case LevelError:
+				s.Errors++
+			case LevelNote, LevelNone:
+				s.Notes++
+			default:
+				s.Warnings++
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sarif
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gosec = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "gosec", "rules": [{"id": "G101"}]}},
+    "results": [
+      {"ruleId": "G101", "level": "error", "message": {"text": "hardcoded credentials"}},
+      {"ruleId": "G104", "message": {"text": "errors unhandled"}}
+    ]
+  }]
+}`
+
+const semgrep = `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "semgrep"}},
+    "results": [{"ruleId": "x", "level": "note", "message": {"text": "style"}}]
+  }]
+}`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "valid", data: gosec},
+		{name: "not json", data: "<xml/>", err: "invalid character"},
+		{name: "version", data: `{"version": "1.0.0", "runs": []}`, err: `unsupported SARIF version "1.0.0"`},
+		{name: "no runs", data: `{"version": "2.1.0"}`, err: "the SARIF log has no runs"},
+		{name: "no tool", data: `{"version": "2.1.0", "runs": [{"results": []}]}`, err: "run 0: the tool has no name"},
+		{name: "level", data: `{"version": "2.1.0", "runs": [{"tool": {"driver": {"name": "x"}}, "results": [{"level": "fatal"}]}]}`,
+			err: `run 0: invalid result level "fatal"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.data))
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestMergeAndSummarize(t *testing.T) {
+	a, err := Parse([]byte(gosec))
+	require.NoError(t, err)
+	b, err := Parse([]byte(semgrep))
+	require.NoError(t, err)
+
+	merged := Merge([]*Log{a, b})
+	assert.Equal(t, Summary{Total: 3, Errors: 1, Warnings: 1, Notes: 1}, Summarize(merged))
+
+	// the merged log is valid and keeps the properties of the runs
+	data, err := json.Marshal(merged)
+	require.NoError(t, err)
+	again, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, Schema, again.Schema)
+	require.Len(t, again.Runs, 2)
+	assert.Contains(t, string(again.Runs[0]), `"rules":[{"id":"G101"}]`)
+}
@@ -0,0 +1,261 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package tap parses the Test Anything Protocol reports into test cases, eg.
+// the reports of prove, bats or node --test. The subtests of TAP 14 are
+// supported, their names are the class names of the tests they hold.
+package tap
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+)
+
+const (
+	subtestPrefix = "# Subtest:"
+	bailOut       = "Bail out!"
+	classSep      = " > "
+)
+
+// result is a test point of the report, an ok or not ok line.
+type result struct {
+	indent int
+	ok     bool
+	name   string
+	class  string // the names of the enclosing subtests
+	skip   bool   // the SKIP and TODO directives
+	reason string
+	yaml   []string // the lines of the diagnostic block
+	notes  []string // the comments following a failed test point, eg. of bats
+}
+
+type subtest struct {
+	indent int
+	name   string
+}
+
+// ParseFile returns the test cases of the TAP report file, the suite of the
+// tests is the name of the file.
+func ParseFile(file string) ([]*ti.TestCase, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+}
+
+// Parse returns the test cases of the TAP report. A test point is a test
+// case unless it is the result of a subtest holding test points. A bail
+// out is an errored test case.
+func Parse(r io.Reader, suite string) ([]*ti.TestCase, error) {
+	var (
+		tests    []*ti.TestCase
+		subtests []subtest
+		prev     = -1 // the indentation of the previous test point
+		last     *result
+		inYAML   bool
+	)
+	flush := func() {
+		if last == nil {
+			return
+		}
+		tests = append(tests, convert(last, suite))
+		last = nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		content := strings.TrimLeft(line, " \t")
+		indent := len(line) - len(content)
+		if inYAML {
+			if content == "..." {
+				inYAML = false
+			} else if last != nil {
+				last.yaml = append(last.yaml, content)
+			}
+			continue
+		}
+		switch {
+		case content == "---" && prev >= 0:
+			inYAML = true
+		case strings.HasPrefix(content, subtestPrefix):
+			subtests = popSubtests(subtests, indent)
+			subtests = append(subtests, subtest{indent: indent, name: strings.TrimSpace(strings.TrimPrefix(content, subtestPrefix))})
+		case strings.HasPrefix(content, "#"):
+			if last != nil && !last.ok {
+				last.notes = append(last.notes, strings.TrimSpace(strings.TrimPrefix(content, "#")))
+			}
+		case isPlan(content):
+			flush()
+		case strings.HasPrefix(content, bailOut):
+			flush()
+			tests = append(tests, &ti.TestCase{
+				Name:      bailOut,
+				SuiteName: suite,
+				Result:    ti.Result{Status: ti.StatusError, Message: strings.TrimSpace(strings.TrimPrefix(content, bailOut))},
+			})
+			return tests, nil
+		default:
+			res, ok := parseResult(content)
+			if !ok {
+				continue
+			}
+			flush()
+			res.indent = indent
+			var class []string
+			for _, s := range subtests {
+				if s.indent < indent {
+					class = append(class, s.name)
+				}
+			}
+			res.class = strings.Join(class, classSep)
+			// the test point of a subtest follows the test points it holds
+			if prev <= indent {
+				last = &res
+			}
+			// the subtests nested in the test point are complete
+			subtests = popSubtests(subtests, indent+1)
+			prev = indent
+		}
+	}
+	flush()
+	return tests, scanner.Err()
+}
+
+// isPlan returns true for the plan of the test points, eg. 1..4.
+func isPlan(line string) bool {
+	first, _, ok := strings.Cut(line, "..")
+	if !ok || first == "" {
+		return false
+	}
+	_, err := strconv.Atoi(first)
+	return err == nil
+}
+
+// popSubtests removes the subtests indented at least as the indentation.
+func popSubtests(subtests []subtest, indent int) []subtest {
+	for len(subtests) > 0 && subtests[len(subtests)-1].indent >= indent {
+		subtests = subtests[:len(subtests)-1]
+	}
+	return subtests
+}
+
+// parseResult parses a test point, eg.
+//
+//	not ok 3 - parses the empty input # TODO not implemented
+func parseResult(line string) (result, bool) {
+	var res result
+	switch {
+	case strings.HasPrefix(line, "ok"):
+		res.ok = true
+		line = line[len("ok"):]
+	case strings.HasPrefix(line, "not ok"):
+		line = line[len("not ok"):]
+	default:
+		return res, false
+	}
+	if line != "" && line[0] != ' ' && line[0] != '\t' {
+		return res, false
+	}
+	line = strings.TrimSpace(line)
+	number := ""
+	if i := strings.IndexFunc(line, func(r rune) bool { return r < '0' || r > '9' }); i != 0 {
+		if i < 0 {
+			i = len(line)
+		}
+		number, line = line[:i], strings.TrimSpace(line[i:])
+	}
+	if desc, directive, found := cutDirective(line); found {
+		line = desc
+		kind, reason, _ := strings.Cut(directive, " ")
+		if k := strings.ToUpper(kind); strings.HasPrefix(k, "SKIP") || strings.HasPrefix(k, "TODO") {
+			res.skip = true
+			res.reason = strings.TrimSpace(reason)
+		}
+	}
+	res.name = strings.TrimSpace(strings.TrimPrefix(line, "- "))
+	if res.name == "-" || res.name == "" {
+		res.name = "test " + number
+		if _, err := strconv.Atoi(number); err != nil {
+			res.name = "test"
+		}
+	}
+	return res, true
+}
+
+// cutDirective splits the description and the directive of a test point,
+// the escaped # are part of the description.
+func cutDirective(line string) (desc, directive string, found bool) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '#':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return line, "", false
+}
+
+func convert(res *result, suite string) *ti.TestCase {
+	t := &ti.TestCase{
+		Name:      strings.ReplaceAll(res.name, `\#`, "#"),
+		SuiteName: suite,
+		ClassName: res.class,
+	}
+	message, durationMs := diagnostic(res.yaml)
+	t.DurationMs = durationMs
+	switch {
+	case res.skip:
+		t.Result = ti.Result{Status: ti.StatusSkipped, Message: res.reason}
+	case res.ok:
+		t.Result = ti.Result{Status: ti.StatusPassed}
+	default:
+		desc := strings.Join(res.yaml, "\n")
+		if len(res.notes) > 0 {
+			desc = strings.Join(res.notes, "\n")
+			if message == "" {
+				message = res.notes[0]
+			}
+		}
+		t.Result = ti.Result{Status: ti.StatusFailed, Message: message, Desc: desc}
+	}
+	return t
+}
+
+// diagnostic returns the message and the duration of the diagnostic block
+// of a test point, eg.
+//
+//	---
+//	duration_ms: 1.5
+//	message: 'expected 2, got 3'
+//	...
+func diagnostic(lines []string) (message string, durationMs int64) {
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `'"`)
+		switch strings.TrimSpace(key) {
+		case "message", "error":
+			if message == "" && value != "|" && value != "|-" && value != ">" {
+				message = value
+			}
+		case "duration_ms":
+			if d, err := strconv.ParseFloat(value, 64); err == nil {
+				durationMs = int64(d)
+			}
+		}
+	}
+	return message, durationMs
+}
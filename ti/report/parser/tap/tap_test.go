@@ -0,0 +1,63 @@
+package tap
+
+import (
+	"strings"
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFile_Bats(t *testing.T) {
+	tests, err := ParseFile("testdata/bats.tap")
+	require.NoError(t, err)
+	require.Len(t, tests, 4)
+
+	assert.Equal(t, &ti.TestCase{Name: "addition using bc", SuiteName: "bats", Result: ti.Result{Status: ti.StatusPassed}}, tests[0])
+	assert.Equal(t, "addition using dc", tests[1].Name)
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[1].Result.Status)
+	assert.Equal(t, "(in test file test.bats, line 12)", tests[1].Result.Message)
+	assert.Contains(t, tests[1].Result.Desc, "failed")
+	assert.Equal(t, ti.Result{Status: ti.StatusSkipped, Message: "not on this platform"}, tests[2].Result)
+	assert.Equal(t, "escaped # hash", tests[3].Name)
+	assert.Equal(t, ti.Result{Status: ti.StatusSkipped, Message: "later"}, tests[3].Result)
+}
+
+func TestParseFile_Subtests(t *testing.T) {
+	tests, err := ParseFile("testdata/node.tap")
+	require.NoError(t, err)
+	require.Len(t, tests, 3)
+
+	assert.Equal(t, "adds", tests[0].Name)
+	assert.Equal(t, "math", tests[0].ClassName)
+	assert.Equal(t, int64(1), tests[0].DurationMs)
+	assert.Equal(t, ti.Status(ti.StatusPassed), tests[0].Result.Status)
+
+	assert.Equal(t, "divides", tests[1].Name)
+	assert.Equal(t, "math", tests[1].ClassName)
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[1].Result.Status)
+	assert.Equal(t, "Expected values to be strictly equal", tests[1].Result.Message)
+	assert.Equal(t, int64(3), tests[1].DurationMs)
+
+	assert.Equal(t, "top level", tests[2].Name)
+	assert.Equal(t, "", tests[2].ClassName)
+	assert.Equal(t, ti.Status(ti.StatusPassed), tests[2].Result.Status)
+}
+
+func TestParse_BailOut(t *testing.T) {
+	tap := "1..3\nok 1 - first\nBail out! database unavailable\nok 2 - second\n"
+	tests, err := Parse(strings.NewReader(tap), "db")
+	require.NoError(t, err)
+	require.Len(t, tests, 2)
+	assert.Equal(t, "first", tests[0].Name)
+	assert.Equal(t, ti.Result{Status: ti.StatusError, Message: "database unavailable"}, tests[1].Result)
+}
+
+func TestParse_NoDescription(t *testing.T) {
+	tests, err := Parse(strings.NewReader("ok 1\nnot ok\nokay\n"), "")
+	require.NoError(t, err)
+	require.Len(t, tests, 2)
+	assert.Equal(t, "test 1", tests[0].Name)
+	assert.Equal(t, "test", tests[1].Name)
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package xunit parses the xUnit.net v2 XML reports into test cases. The
+// suite of a test is its assembly and its class is its type.
+package xunit
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	ti "github.com/harness/ti-client/types"
+)
+
+type assembly struct {
+	Name        string       `xml:"name,attr"`
+	Collections []collection `xml:"collection"`
+}
+
+type collection struct {
+	Tests []test `xml:"test"`
+}
+
+type test struct {
+	Name    string  `xml:"name,attr"`
+	Type    string  `xml:"type,attr"`
+	Method  string  `xml:"method,attr"`
+	Result  string  `xml:"result,attr"`
+	Time    float64 `xml:"time,attr"` // seconds
+	Failure struct {
+		ExceptionType string `xml:"exception-type,attr"`
+		Message       string `xml:"message"`
+		StackTrace    string `xml:"stack-trace"`
+	} `xml:"failure"`
+	Reason string `xml:"reason"`
+	Output string `xml:"output"`
+}
+
+// ParseFile returns the test cases of the xUnit.net v2 report file.
+func ParseFile(file string) ([]*ti.TestCase, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse returns the test cases of the xUnit.net v2 report, the assemblies
+// document or a single assembly.
+func Parse(r io.Reader) ([]*ti.TestCase, error) {
+	var root struct {
+		XMLName    xml.Name
+		Assemblies []assembly `xml:"assembly"`
+		assembly
+	}
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	assemblies := root.Assemblies
+	if root.XMLName.Local == "assembly" {
+		assemblies = []assembly{root.assembly}
+	}
+	var tests []*ti.TestCase
+	for i := range assemblies {
+		suite := path.Base(strings.ReplaceAll(assemblies[i].Name, `\`, "/"))
+		for _, c := range assemblies[i].Collections {
+			for j := range c.Tests {
+				tests = append(tests, convert(&c.Tests[j], suite))
+			}
+		}
+	}
+	return tests, nil
+}
+
+func convert(t *test, suite string) *ti.TestCase {
+	// the display name holds the type by default, eg. Calc.Tests.Adds(a: 1)
+	name := strings.TrimPrefix(t.Name, t.Type+".")
+	if name == "" {
+		name = t.Method
+	}
+	tc := &ti.TestCase{
+		Name:       name,
+		ClassName:  t.Type,
+		SuiteName:  suite,
+		DurationMs: int64(t.Time * 1000), //nolint:gomnd
+		SystemOut:  t.Output,
+	}
+	switch t.Result {
+	case "Fail":
+		tc.Result = ti.Result{Status: ti.StatusFailed, Message: strings.TrimSpace(t.Failure.Message),
+			Type: t.Failure.ExceptionType, Desc: strings.TrimSpace(t.Failure.StackTrace)}
+	case "Skip", "NotRun":
+		tc.Result = ti.Result{Status: ti.StatusSkipped, Message: strings.TrimSpace(t.Reason)}
+	default:
+		tc.Result = ti.Result{Status: ti.StatusPassed}
+	}
+	return tc
+}
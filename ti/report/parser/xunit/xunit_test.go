@@ -0,0 +1,46 @@
+package xunit
+
+import (
+	"strings"
+	"testing"
+
+	ti "github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFile(t *testing.T) {
+	tests, err := ParseFile("testdata/xunit2.xml")
+	require.NoError(t, err)
+	require.Len(t, tests, 4)
+
+	for _, tc := range tests {
+		assert.Equal(t, "Calc.Tests.dll", tc.SuiteName)
+		assert.Equal(t, "Calc.CalculatorTests", tc.ClassName)
+	}
+	assert.Equal(t, "Adds", tests[0].Name)
+	assert.Equal(t, int64(12), tests[0].DurationMs)
+	assert.Equal(t, ti.Result{Status: ti.StatusPassed}, tests[0].Result)
+	assert.Equal(t, "Squares(value: 2)", tests[1].Name)
+
+	assert.Equal(t, "Divides", tests[2].Name)
+	assert.Equal(t, ti.Status(ti.StatusFailed), tests[2].Result.Status)
+	assert.Equal(t, "Xunit.Sdk.EqualException", tests[2].Result.Type)
+	assert.Equal(t, "Assert.Equal() Failure\nExpected: 2\nActual:   3", tests[2].Result.Message)
+	assert.Equal(t, "dividing\n", tests[2].SystemOut)
+
+	assert.Equal(t, "Slow test", tests[3].Name)
+	assert.Equal(t, ti.Result{Status: ti.StatusSkipped, Message: "too slow"}, tests[3].Result)
+}
+
+func TestParse_Assembly(t *testing.T) {
+	report := `<assembly name="C:\bin\Api.Tests.dll"><collection>
+		<test name="Api.Tests.Get" type="Api.Tests" method="Get" time="0.5" result="Pass" />
+	</collection></assembly>`
+	tests, err := Parse(strings.NewReader(report))
+	require.NoError(t, err)
+	require.Len(t, tests, 1)
+	assert.Equal(t, "Api.Tests.dll", tests[0].SuiteName)
+	assert.Equal(t, "Get", tests[0].Name)
+	assert.Equal(t, int64(500), tests[0].DurationMs)
+}
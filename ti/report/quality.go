@@ -0,0 +1,260 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/report/parser/quality"
+	"github.com/mattn/go-zglob"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	qualityContext        = "code-quality"
+	maxAnnotatedFindings  = 20
+	maxAnnotatedRules     = 10
+	qualityFindingsKey    = "quality_findings"
+	qualityErrorsKey      = "quality_errors"
+	qualityWarningsKey    = "quality_warnings"
+	qualityReportURLKey   = "quality_report_url"
+	qualityReportBlobName = "quality.json"
+)
+
+var qualityOutputKeys = []string{qualityFindingsKey, qualityErrorsKey, qualityWarningsKey, qualityReportURLKey}
+
+// QualitySummary holds the counts of the findings of the quality reports of a step.
+type QualitySummary struct {
+	Total    int    `json:"total"`
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+	Infos    int    `json:"infos"`
+	URL      string `json:"url,omitempty"`
+}
+
+func qualitySummaryFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-quality-summary.json", pipeline.SharedVolPath, stepID)
+}
+
+func qualityAnnotationFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-quality.json", pipeline.SharedVolPath, stepID)
+}
+
+// ParseAndUploadQuality parses the static analysis reports of the step and
+// uploads the findings through the log service. The counts of the findings are
+// saved for the outputs and the annotations of the step, keyed by the
+// annotationID, the id of the step.
+func ParseAndUploadQuality(ctx context.Context, reports []api.QualityReport, workDir, stepID, annotationID string, log *logrus.Logger,
+	tiConfig *tiCfg.Cfg) error {
+	_ = os.Remove(qualitySummaryFile(annotationID))
+	_ = os.Remove(qualityAnnotationFile(annotationID))
+	if len(reports) == 0 {
+		return nil
+	}
+
+	roots := reportRoots(workDir, tiConfig)
+	findings := []*quality.Finding{}
+	for _, r := range reports {
+		for _, file := range qualityFiles(r.Paths, workDir, log) {
+			if _, err := safepath.ConfineInput(file, roots...); err != nil {
+				log.WithError(err).WithField("file", file).Warnln("skipping quality report file")
+				continue
+			}
+			f, err := quality.ParseFile(file, r.Format)
+			if err != nil {
+				log.WithError(err).WithField("file", file).Errorln(fmt.Sprintf("could not parse quality report %s", file))
+				continue
+			}
+			findings = append(findings, f...)
+		}
+	}
+
+	summary := summarizeFindings(findings)
+	log.Infoln(fmt.Sprintf("Found %d code quality issues: %d errors, %d warnings", summary.Total, summary.Errors, summary.Warnings))
+
+	data, err := json.Marshal(findings)
+	if err != nil {
+		return err
+	}
+	if uploader, ok := pipeline.GetState().GetLogStreamClient().(logstream.BlobUploader); ok {
+		if summary.URL, err = uploader.UploadBlob(ctx, blobKey(tiConfig, stepID, qualityReportBlobName), bytes.NewReader(data)); err != nil {
+			log.WithError(err).Warnln("failed to upload the quality report")
+		}
+	}
+
+	if data, err = json.Marshal(summary); err != nil {
+		return err
+	}
+	if err = os.WriteFile(qualitySummaryFile(annotationID), data, annotationFilePerm); err != nil {
+		return err
+	}
+	style := api.AnnotationStyleSuccess
+	if summary.Errors > 0 {
+		style = api.AnnotationStyleError
+	} else if summary.Warnings > 0 {
+		style = api.AnnotationStyleInfo
+	}
+	if data, err = json.Marshal(&api.Annotation{Context: qualityContext, Style: style, Markdown: QualityMarkdown(findings)}); err != nil {
+		return err
+	}
+	return os.WriteFile(qualityAnnotationFile(annotationID), data, annotationFilePerm)
+}
+
+// qualityFiles returns the report files matching the paths, relative to the working directory.
+func qualityFiles(paths []string, workDir string, log *logrus.Logger) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(workDir, p)
+		}
+		matches, err := zglob.Glob(p)
+		if err != nil {
+			log.WithError(err).WithField("path", p).Warnln("errored while trying to resolve quality report path")
+			continue
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files
+}
+
+func summarizeFindings(findings []*quality.Finding) *QualitySummary {
+	s := &QualitySummary{Total: len(findings)}
+	for _, f := range findings {
+		switch f.Severity {
+		case quality.SeverityError:
+			s.Errors++
+		case quality.SeverityWarning:
+			s.Warnings++
+		default:
+			s.Infos++
+		}
+	}
+	return s
+}
+
+// SaveQualitySummaryToOutputs adds the counts of the findings of the quality
+// reports of the step to the outputs. The summary is read once.
+func SaveQualitySummaryToOutputs(stepID string, outputs map[string]string) {
+	path := qualitySummaryFile(stepID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_ = os.Remove(path)
+	s := new(QualitySummary)
+	if err := json.Unmarshal(data, s); err != nil {
+		return
+	}
+	outputs[qualityFindingsKey] = strconv.Itoa(s.Total)
+	outputs[qualityErrorsKey] = strconv.Itoa(s.Errors)
+	outputs[qualityWarningsKey] = strconv.Itoa(s.Warnings)
+	if s.URL != "" {
+		outputs[qualityReportURLKey] = s.URL
+	}
+}
+
+// ReadQualityAnnotation returns the code quality annotation of the step, if any.
+func ReadQualityAnnotation(stepID string) *api.Annotation {
+	return readAnnotation(qualityAnnotationFile(stepID))
+}
+
+// QualityMarkdown returns a markdown summary of the findings with the counts
+// per tool, the most frequent rules and the errors.
+func QualityMarkdown(findings []*quality.Finding) string {
+	type counts struct{ errors, warnings, infos int }
+	tools := map[string]*counts{}
+	rules := map[string]int{}
+	var errors []*quality.Finding
+	for _, f := range findings {
+		c, ok := tools[f.Tool]
+		if !ok {
+			c = &counts{}
+			tools[f.Tool] = c
+		}
+		switch f.Severity {
+		case quality.SeverityError:
+			c.errors++
+			errors = append(errors, f)
+		case quality.SeverityWarning:
+			c.warnings++
+		default:
+			c.infos++
+		}
+		if f.Rule != "" {
+			rules[f.Rule]++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("### Code quality\n\n")
+	if len(findings) == 0 {
+		sb.WriteString("No issues found.\n")
+		return sb.String()
+	}
+	sb.WriteString("| Tool | Errors | Warnings | Info |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := tools[name]
+		fmt.Fprintf(&sb, "| %s | %d | %d | %d |\n", name, c.errors, c.warnings, c.infos)
+	}
+
+	if len(rules) > 0 {
+		ids := make([]string, 0, len(rules))
+		for id := range rules {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if rules[ids[i]] != rules[ids[j]] {
+				return rules[ids[i]] > rules[ids[j]]
+			}
+			return ids[i] < ids[j]
+		})
+		if len(ids) > maxAnnotatedRules {
+			ids = ids[:maxAnnotatedRules]
+		}
+		sb.WriteString("\n#### Most frequent rules\n\n")
+		sb.WriteString("| Rule | Issues |\n")
+		sb.WriteString("| --- | --- |\n")
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "| %s | %d |\n", markdownEscape(id), rules[id])
+		}
+	}
+
+	if len(errors) > 0 {
+		sb.WriteString("\n#### Errors\n\n")
+		for i, f := range errors {
+			if i == maxAnnotatedFindings {
+				fmt.Fprintf(&sb, "\n_and %d more_\n", len(errors)-maxAnnotatedFindings)
+				break
+			}
+			fmt.Fprintf(&sb, "- `%s:%d` %s\n", f.File, f.Line, markdownEscape(f.Message))
+		}
+	}
+	return sb.String()
+}
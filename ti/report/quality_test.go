@@ -0,0 +1,25 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/ti/report/parser/quality"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityMarkdown(t *testing.T) {
+	findings := []*quality.Finding{
+		{Tool: quality.ESLint, Rule: "no_unused", Severity: quality.SeverityError, File: "app.js", Line: 1, Message: "'x' is unused"},
+		{Tool: quality.ESLint, Rule: "semi", Severity: quality.SeverityWarning, File: "app.js", Line: 3, Message: "Missing semicolon"},
+		{Tool: quality.ESLint, Rule: "semi", Severity: quality.SeverityWarning, File: "b.js", Line: 4, Message: "Missing semicolon"},
+		{Tool: quality.Checkstyle, Rule: "LineLength", Severity: quality.SeverityInfo, File: "Main.java", Line: 9, Message: "Line too long"},
+	}
+
+	md := QualityMarkdown(findings)
+	assert.Contains(t, md, "| checkstyle | 0 | 0 | 1 |\n| eslint | 1 | 2 | 0 |")
+	assert.Contains(t, md, "| semi | 2 |\n| LineLength | 1 |\n| no\\_unused | 1 |")
+	assert.Contains(t, md, "- `app.js:1` 'x' is unused")
+	assert.Contains(t, QualityMarkdown(nil), "No issues found.")
+
+	assert.Equal(t, &QualitySummary{Total: 4, Errors: 1, Warnings: 2, Infos: 1}, summarizeFindings(findings))
+}
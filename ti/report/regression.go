@@ -0,0 +1,193 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/ti-client/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	regressionPctEnv        = "HARNESS_TEST_DURATION_REGRESSION_PCT"
+	regressionMinMsEnv      = "HARNESS_TEST_DURATION_REGRESSION_MIN_MS"
+	regressionAnnotationEnv = "HARNESS_TEST_DURATION_REGRESSION_ANNOTATION"
+	defaultRegressionMinMs  = 1000
+	maxAnnotatedRegressions = 20
+	maxReportedRegressions  = 20
+	regressionContext       = "test-duration-regressions"
+)
+
+// regressionConfig returns the minimum increase in percent for a test to be
+// flagged and the minimum duration of the tests that are compared. The
+// comparison is disabled if the percentage is not set.
+func regressionConfig(envs map[string]string) (pct float64, minMs int64, ok bool) {
+	pct, err := strconv.ParseFloat(envs[regressionPctEnv], 64)
+	if err != nil || pct <= 0 {
+		return 0, 0, false
+	}
+	minMs = defaultRegressionMinMs
+	if v, err := strconv.ParseInt(envs[regressionMinMsEnv], 10, 64); err == nil && v >= 0 {
+		minMs = v
+	}
+	return pct, minMs, true
+}
+
+// RegressionAnnotationEnabled returns whether the test duration regressions
+// of the step are returned as an annotation.
+func RegressionAnnotationEnabled(envs map[string]string) bool {
+	_, _, ok := regressionConfig(envs)
+	return ok && envs[regressionAnnotationEnv] == "true"
+}
+
+func regressionAnnotationFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-test-regressions.json", pipeline.SharedVolPath, stepID)
+}
+
+// ReadRegressionAnnotation returns the test duration regressions annotation of the step, if any.
+func ReadRegressionAnnotation(stepID string) *api.Annotation {
+	return readAnnotation(regressionAnnotationFile(stepID))
+}
+
+func regressionsFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-test-regressions.telemetry.json", pipeline.SharedVolPath, stepID)
+}
+
+// ReadRegressions returns the test duration regressions of the step for its
+// telemetry, largest increase first, and removes them.
+func ReadRegressions(stepID string) []*api.TestRegression {
+	path := regressionsFile(stepID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_ = os.Remove(path)
+	var regressions []*api.TestRegression
+	if err := json.Unmarshal(data, &regressions); err != nil {
+		return nil
+	}
+	return regressions
+}
+
+// checkRegressions compares the durations of the tests against the historical
+// averages of the step and flags the ones that regressed. It must be called
+// before the tests are written so they are not part of the averages. The
+// regressions and their annotation are keyed by the annotationID.
+func checkRegressions(ctx context.Context, stepID, annotationID string, tests []*types.TestCase, tiConfig *tiCfg.Cfg, log *logrus.Logger, envs map[string]string) {
+	pct, minMs, ok := regressionConfig(envs)
+	if !ok {
+		return
+	}
+	res, err := tiConfig.GetClient().GetTestTimes(ctx, stepID, &types.GetTestTimesReq{IncludeTestCase: true})
+	if err != nil {
+		log.WithError(err).Warnln("failed to get the historical test durations")
+		return
+	}
+
+	regressions := findRegressions(tests, res.TestTimeMap, pct, minMs)
+	for _, r := range regressions {
+		logrus.WithContext(ctx).
+			WithField("step_id", stepID).
+			WithField("test", r.Name).
+			WithField("duration_ms", r.DurationMs).
+			WithField("historical_ms", r.HistoricalMs).
+			WithField("increase_pct", r.IncreasePct).
+			Infoln("test duration regression")
+	}
+	if len(regressions) > 0 {
+		log.Warnln(fmt.Sprintf("%d tests took more than %.0f%% longer than their historical average", len(regressions), pct))
+		if err := writeRegressions(annotationID, regressions); err != nil {
+			log.WithError(err).Warnln("failed to record the test duration regressions")
+		}
+	}
+
+	if envs[regressionAnnotationEnv] != "true" {
+		return
+	}
+	data, err := json.Marshal(&api.Annotation{
+		Context:  regressionContext,
+		Style:    api.AnnotationStyleInfo,
+		Markdown: regressionMarkdown(regressions, pct),
+	})
+	if err == nil {
+		err = os.WriteFile(regressionAnnotationFile(annotationID), data, annotationFilePerm)
+	}
+	if err != nil {
+		log.WithError(err).Warnln("failed to write the test duration regressions annotation")
+	}
+}
+
+// writeRegressions records the largest regressions for the telemetry of the step.
+func writeRegressions(stepID string, regressions []*api.TestRegression) error {
+	if len(regressions) > maxReportedRegressions {
+		regressions = regressions[:maxReportedRegressions]
+	}
+	data, err := json.Marshal(regressions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(regressionsFile(stepID), data, annotationFilePerm)
+}
+
+// findRegressions returns the tests that took at least pct percent longer than
+// their historical average, largest increase first. Tests shorter than minMs
+// and skipped tests are ignored.
+func findRegressions(tests []*types.TestCase, historical map[string]int, pct float64, minMs int64) []*api.TestRegression {
+	var regressions []*api.TestRegression
+	for _, t := range tests {
+		if t.Result.Status == types.StatusSkipped || t.DurationMs < minMs {
+			continue
+		}
+		hist, ok := historical[testName(t)]
+		if !ok {
+			hist = historical[t.Name]
+		}
+		if hist <= 0 {
+			continue
+		}
+		increase := float64(t.DurationMs-int64(hist)) * 100 / float64(hist) //nolint:gomnd
+		if increase < pct {
+			continue
+		}
+		regressions = append(regressions, &api.TestRegression{
+			Name:         testName(t),
+			DurationMs:   t.DurationMs,
+			HistoricalMs: int64(hist),
+			IncreasePct:  increase,
+		})
+	}
+	sort.SliceStable(regressions, func(i, j int) bool { return regressions[i].IncreasePct > regressions[j].IncreasePct })
+	return regressions
+}
+
+// regressionMarkdown returns a markdown table of the regressed tests.
+func regressionMarkdown(regressions []*api.TestRegression, pct float64) string {
+	var sb strings.Builder
+	sb.WriteString("### Test duration regressions\n\n")
+	if len(regressions) == 0 {
+		fmt.Fprintf(&sb, "No test took more than %.0f%% longer than its historical average.\n", pct)
+		return sb.String()
+	}
+	sb.WriteString("| Test | Duration | Average | Increase |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	for i, r := range regressions {
+		if i == maxAnnotatedRegressions {
+			fmt.Fprintf(&sb, "\n_and %d more_\n", len(regressions)-maxAnnotatedRegressions)
+			break
+		}
+		fmt.Fprintf(&sb, "| %s | %dms | %dms | +%.0f%% |\n", markdownEscape(r.Name), r.DurationMs, r.HistoricalMs, r.IncreasePct)
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRegressions(t *testing.T) {
+	tests := []*types.TestCase{
+		{Name: "testAdd", ClassName: "Calc", DurationMs: 3000},
+		{Name: "testDiv", ClassName: "Calc", DurationMs: 1200},
+		{Name: "testMul", ClassName: "Calc", DurationMs: 500},
+		{Name: "testSub", DurationMs: 4000},
+		{Name: "testMod", ClassName: "Calc", DurationMs: 5000, Result: types.Result{Status: types.StatusSkipped}},
+		{Name: "testNew", ClassName: "Calc", DurationMs: 5000},
+	}
+	historical := map[string]int{
+		"Calc.testAdd": 1000,
+		"Calc.testDiv": 1000,
+		"Calc.testMul": 100,
+		"testSub":      2000,
+		"Calc.testMod": 1000,
+	}
+
+	regressions := findRegressions(tests, historical, 50, 1000)
+	assert.Equal(t, []*api.TestRegression{
+		{Name: "Calc.testAdd", DurationMs: 3000, HistoricalMs: 1000, IncreasePct: 200},
+		{Name: "testSub", DurationMs: 4000, HistoricalMs: 2000, IncreasePct: 100},
+	}, regressions)
+
+	md := regressionMarkdown(regressions, 50)
+	assert.Contains(t, md, "| Calc.testAdd | 3000ms | 1000ms | +200% |")
+	assert.Contains(t, regressionMarkdown(nil, 50), "No test took more than 50% longer")
+}
+
+func TestRegressionConfig(t *testing.T) {
+	_, _, ok := regressionConfig(map[string]string{})
+	assert.False(t, ok)
+
+	pct, minMs, ok := regressionConfig(map[string]string{regressionPctEnv: "25"})
+	assert.True(t, ok)
+	assert.Equal(t, 25.0, pct)
+	assert.Equal(t, int64(defaultRegressionMinMs), minMs)
+
+	_, minMs, _ = regressionConfig(map[string]string{regressionPctEnv: "25", regressionMinMsEnv: "0"})
+	assert.Equal(t, int64(0), minMs)
+
+	assert.False(t, RegressionAnnotationEnabled(map[string]string{regressionAnnotationEnv: "true"}))
+	assert.True(t, RegressionAnnotationEnabled(map[string]string{regressionPctEnv: "25", regressionAnnotationEnv: "true"}))
+}
+
+func TestReadRegressions(t *testing.T) {
+	if _, err := os.Stat(pipeline.SharedVolPath); err != nil {
+		t.Skipf("shared volume %s is not available", pipeline.SharedVolPath)
+	}
+	regressions := make([]*api.TestRegression, maxReportedRegressions+5)
+	for i := range regressions {
+		regressions[i] = &api.TestRegression{Name: fmt.Sprintf("test%d", i), DurationMs: 2000, HistoricalMs: 1000, IncreasePct: 100}
+	}
+	assert.NoError(t, writeRegressions("step-regressions", regressions))
+
+	// the largest regressions are reported once
+	got := ReadRegressions("step-regressions")
+	assert.Equal(t, regressions[:maxReportedRegressions], got)
+	assert.Nil(t, ReadRegressions("step-regressions"))
+}
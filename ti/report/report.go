@@ -8,22 +8,61 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/metrics"
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/lite-engine/ti"
 	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/report/parser/gotest"
 	"github.com/harness/lite-engine/ti/report/parser/junit"
+	"github.com/harness/lite-engine/ti/report/parser/nunit"
+	"github.com/harness/lite-engine/ti/report/parser/tap"
+	"github.com/harness/lite-engine/ti/report/parser/xunit"
 	"github.com/harness/ti-client/types"
 	"github.com/sirupsen/logrus"
 )
 
-func ParseAndUploadTests(ctx context.Context, report api.TestReport, workDir, stepID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string) error {
-	if report.Kind != api.Junit {
+// uploadKind is the report type of the uploaded tests, the tests of all the
+// kinds of reports are converted to the JUnit test cases and summarized as
+// such.
+var uploadKind = strings.ToLower(api.Junit.String())
+
+// parsers are the parsers of the report files of the kinds of reports, the
+// JUnit files are parsed by ParseTestsConfined.
+var parsers = map[api.ReportType]func(file string) ([]*types.TestCase, error){
+	api.Junit:  nil,
+	api.Tap:    tap.ParseFile,
+	api.GoTest: gotest.ParseFile,
+	api.NUnit:  nunit.ParseFile,
+	api.XUnit:  xunit.ParseFile,
+}
+
+// ParseAndUploadTests parses the test reports of the step and uploads the
+// tests. The secrets of the step are masked in the summary posted to the
+// webhook of the stage, with the secrets of the stage. The test summary
+// annotation is keyed by the annotationID, the id of the step: unlike its
+// name, it is unique in the stage.
+func ParseAndUploadTests(ctx context.Context, report api.TestReport, workDir, stepID, annotationID string, log *logrus.Logger, start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string, secrets []string) error {
+	parse, ok := parsers[report.Kind]
+	if !ok {
 		return fmt.Errorf("unknown report type: %s", report.Kind)
 	}
 
+	annotate := TestSummaryAsOutputEnabled(envs)
+	if annotate {
+		// remove the summary of a previous execution of the step
+		_ = os.Remove(AnnotationFile(annotationID))
+		_ = os.Remove(aggregatesFile(annotationID))
+	}
+	_ = os.Remove(regressionAnnotationFile(annotationID))
+	_ = os.Remove(regressionsFile(annotationID))
+	_ = os.Remove(attachmentsFile(annotationID))
+
 	if len(report.Junit.Paths) == 0 {
 		return nil
 	}
@@ -38,15 +77,57 @@ func ParseAndUploadTests(ctx context.Context, report api.TestReport, workDir, st
 		}
 	}
 
-	tests := junit.ParseTests(report.Junit.Paths, log, envs)
+	// Report files are read by the engine so they need to resolve inside the workspace,
+	// the TI data directory or the shared volume.
+	roots := reportRoots(workDir, tiConfig)
+	if _, ok := pipeline.Standalone(); !ok && report.Junit.Streaming && report.Kind == api.Junit {
+		return streamAndUploadTests(ctx, report, roots, stepID, log, start, tiConfig, envs, secrets)
+	}
+	var tests []*types.TestCase
+	if parse == nil {
+		tests = junit.ParseTestsConfined(report.Junit.Paths, report.Junit.Ignore, roots, log, envs)
+	} else {
+		tests = junit.ParseFilesConfined(report.Junit.Paths, report.Junit.Ignore, roots, log, envs, parse)
+	}
+	if maxTests := report.Junit.MaxTests; maxTests > 0 && len(tests) > maxTests {
+		log.Warnln(fmt.Sprintf("Keeping the first %d of the %d parsed test cases", maxTests, len(tests)))
+		tests = tests[:maxTests]
+	}
 	if len(tests) == 0 {
 		return nil
 	}
+	if annotate {
+		if err := writeAnnotation(annotationID, tests); err != nil {
+			log.WithError(err).Warnln("failed to write the test summary annotation")
+		}
+		if err := writeAggregates(annotationID, tests); err != nil {
+			log.WithError(err).Warnln("failed to write the test aggregates")
+		}
+	}
+
+	notifyTests(ctx, stepID, tests, tiConfig, log, secrets)
+
+	if _, ok := pipeline.Standalone(); ok {
+		if err := pipeline.WriteStandaloneResult(standaloneReport(stepID), tests); err != nil {
+			return err
+		}
+		log.Infoln(fmt.Sprintf("Successfully wrote test reports in %s time", time.Since(start)))
+		return nil
+	}
+
+	checkRegressions(ctx, stepID, annotationID, tests, tiConfig, log, envs)
+	if attachmentsEnabled(envs) {
+		if err := uploadAttachments(ctx, stepID, annotationID, workDir, roots, tests, tiConfig, log, envs); err != nil {
+			log.WithError(err).Warnln("failed to record the test attachments")
+		}
+	}
 
 	startTime := time.Now()
 	logrus.WithContext(ctx).Infoln(fmt.Sprintf("Starting TI service request to write report for step %s", stepID))
 	c := tiConfig.GetClient()
-	if err := c.Write(ctx, stepID, strings.ToLower(report.Kind.String()), tests); err != nil {
+	err := c.Write(ctx, stepID, uploadKind, tests)
+	ti.UploadDuration.Observe(time.Since(startTime).Seconds(), "report", metrics.Status(err))
+	if err != nil {
 		return err
 	}
 	logrus.WithContext(ctx).Infoln(fmt.Sprintf("Completed TI service request to write report for step %s, took %.2f seconds", stepID, time.Since(startTime).Seconds()))
@@ -54,22 +135,67 @@ func ParseAndUploadTests(ctx context.Context, report api.TestReport, workDir, st
 	return nil
 }
 
-func SaveReportSummaryToOutputs(ctx context.Context, tiConfig *tiCfg.Cfg, stepID string, outputs map[string]string, log *logrus.Logger, envs map[string]string) error {
+// streamAndUploadTests parses the reports test case by test case and uploads
+// the tests by batches, only a batch is held in memory.
+func streamAndUploadTests(ctx context.Context, report api.TestReport, roots []string, stepID string, log *logrus.Logger,
+	start time.Time, tiConfig *tiCfg.Cfg, envs map[string]string, secrets []string) error {
+	c := tiConfig.GetClient()
+	summary := newSummary(stepID, tiConfig)
+	batches := 0
+	opts := junit.StreamOptions{BatchSize: report.Junit.BatchSize, MaxTests: report.Junit.MaxTests}
+	total, err := junit.StreamTestsConfined(report.Junit.Paths, report.Junit.Ignore, roots, opts, log, envs,
+		func(tests []*types.TestCase) error {
+			batches++
+			addToSummary(summary, tests)
+			logrus.WithContext(ctx).Infoln(fmt.Sprintf("Starting TI service request to write batch %d of the report for step %s", batches, stepID))
+			batchStart := time.Now()
+			err := c.Write(ctx, stepID, uploadKind, tests)
+			ti.UploadDuration.Observe(time.Since(batchStart).Seconds(), "report", metrics.Status(err))
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	publishSummary(ctx, summary, log, secrets)
+	log.Infoln(fmt.Sprintf("Successfully collected %d test cases in %d batches in %s time", total, batches, time.Since(start)))
+	return nil
+}
+
+// reportRoots returns the directories the report files need to resolve in.
+// The home directory of the engine is not one of them, it is shared by the
+// stages of the VM and holds the credentials of the engine.
+func reportRoots(workDir string, tiConfig *tiCfg.Cfg) []string {
+	return []string{workDir, tiConfig.GetDataDir(), pipeline.SharedVolPath}
+}
+
+// SaveReportSummaryToOutputs adds the test summary of the step to the
+// outputs. The aggregates of the tests are keyed by the annotationID, the id
+// of the step, like in ParseAndUploadTests.
+func SaveReportSummaryToOutputs(ctx context.Context, tiConfig *tiCfg.Cfg, stepID, annotationID string, outputs map[string]string, log *logrus.Logger, envs map[string]string) error {
 	if !TestSummaryAsOutputEnabled(envs) {
 		return nil
 	}
-	tiClient := tiConfig.GetClient()
-	summaryRequest := types.SummaryRequest{
-		AllStages:  false,
-		OrgID:      tiConfig.GetOrgID(),
-		ProjectID:  tiConfig.GetProjectID(),
-		PipelineID: tiConfig.GetPipelineID(),
-		BuildID:    tiConfig.GetBuildID(),
-		StageID:    tiConfig.GetStageID(),
-		StepID:     stepID,
-		ReportType: "junit",
-	}
-	response, err := tiClient.Summary(ctx, summaryRequest)
+	var response types.SummaryResponse
+	var err error
+	if _, ok := pipeline.Standalone(); ok {
+		response, err = standaloneSummary(stepID)
+	} else {
+		tiClient := tiConfig.GetClient()
+		summaryRequest := types.SummaryRequest{
+			AllStages:  false,
+			OrgID:      tiConfig.GetOrgID(),
+			ProjectID:  tiConfig.GetProjectID(),
+			PipelineID: tiConfig.GetPipelineID(),
+			BuildID:    tiConfig.GetBuildID(),
+			StageID:    tiConfig.GetStageID(),
+			StepID:     stepID,
+			ReportType: "junit",
+		}
+		response, err = tiClient.Summary(ctx, summaryRequest)
+	}
 	if err != nil {
 		return err
 	}
@@ -81,19 +207,44 @@ func SaveReportSummaryToOutputs(ctx context.Context, tiConfig *tiCfg.Cfg, stepID
 	outputs["failed_tests"] = fmt.Sprintf("%d", response.FailedTests)
 	outputs["skipped_tests"] = fmt.Sprintf("%d", response.SkippedTests)
 	outputs["duration_ms"] = fmt.Sprintf("%d", response.TimeMs)
+	if aggregates, ok := readAggregates(annotationID); ok {
+		outputs[aggregatesOutputKey] = aggregates
+	}
 	return nil
 }
 
+// GetSummaryOutputs returns the summary outputs set as outputs of the step.
+// The SARIF counts are set whenever the step collected SARIF files, the
+// others only if the test summary is enabled.
+func GetSummaryOutputs(outputs map[string]string, envs map[string]string) map[string]string {
+	if TestSummaryAsOutputEnabled(envs) {
+		return outputs
+	}
+	summary := make(map[string]string)
+	for _, key := range sarifOutputKeys {
+		if v, ok := outputs[key]; ok {
+			summary[key] = v
+		}
+	}
+	return summary
+}
+
 func GetSummaryOutputsV2(outputs map[string]string, envs map[string]string) []*api.OutputV2 {
 	outputsV2 := []*api.OutputV2{}
-	if !TestSummaryAsOutputEnabled(envs) {
-		return outputsV2
+	if TestSummaryAsOutputEnabled(envs) {
+		outputsV2 = checkAndAddSummary("total_tests", outputs, outputsV2)
+		outputsV2 = checkAndAddSummary("successful_tests", outputs, outputsV2)
+		outputsV2 = checkAndAddSummary("failed_tests", outputs, outputsV2)
+		outputsV2 = checkAndAddSummary("skipped_tests", outputs, outputsV2)
+		outputsV2 = checkAndAddSummary("duration_ms", outputs, outputsV2)
+		outputsV2 = checkAndAddSummary(aggregatesOutputKey, outputs, outputsV2)
+		for _, key := range qualityOutputKeys {
+			outputsV2 = checkAndAddSummary(key, outputs, outputsV2)
+		}
+	}
+	for _, key := range sarifOutputKeys {
+		outputsV2 = checkAndAddSummary(key, outputs, outputsV2)
 	}
-	outputsV2 = checkAndAddSummary("total_tests", outputs, outputsV2)
-	outputsV2 = checkAndAddSummary("successful_tests", outputs, outputsV2)
-	outputsV2 = checkAndAddSummary("failed_tests", outputs, outputsV2)
-	outputsV2 = checkAndAddSummary("skipped_tests", outputs, outputsV2)
-	outputsV2 = checkAndAddSummary("duration_ms", outputs, outputsV2)
 	return outputsV2
 }
 
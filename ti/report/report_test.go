@@ -0,0 +1,35 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportRoots(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	roots := reportRoots("/harness", &tiCfg.Cfg{})
+	assert.Contains(t, roots, "/harness")
+	assert.Contains(t, roots, pipeline.SharedVolPath)
+	assert.NotContains(t, roots, home)
+}
+
+func TestGetSummaryOutputs(t *testing.T) {
+	outputs := map[string]string{"total_tests": "3", sarifFindingsKey: "2", sarifErrorsKey: "1"}
+
+	// the SARIF counts are set without the test summary
+	assert.Equal(t, map[string]string{sarifFindingsKey: "2", sarifErrorsKey: "1"}, GetSummaryOutputs(outputs, nil))
+	var keys []string
+	for _, o := range GetSummaryOutputsV2(outputs, nil) {
+		keys = append(keys, o.Key)
+	}
+	assert.Equal(t, []string{sarifFindingsKey, sarifErrorsKey}, keys)
+
+	envs := map[string]string{"HARNESS_CI_TEST_SUMMARY_OUTPUT_FF": "true"}
+	assert.Equal(t, outputs, GetSummaryOutputs(outputs, envs))
+	assert.Len(t, GetSummaryOutputsV2(outputs, envs), 3)
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/safepath"
+	"github.com/harness/lite-engine/logstream"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+	"github.com/harness/lite-engine/ti/report/parser/sarif"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sarifFindingsKey    = "sarif_findings"
+	sarifErrorsKey      = "sarif_errors"
+	sarifWarningsKey    = "sarif_warnings"
+	sarifNotesKey       = "sarif_notes"
+	sarifReportURLKey   = "sarif_report_url"
+	sarifReportBlobName = "results.sarif"
+)
+
+var defaultSarifPaths = []string{"**/*.sarif", "**/*.sarif.json"}
+
+var sarifOutputKeys = []string{sarifFindingsKey, sarifErrorsKey, sarifWarningsKey, sarifNotesKey, sarifReportURLKey}
+
+// SarifSummary holds the counts of the results of the SARIF files of a step.
+type SarifSummary struct {
+	sarif.Summary
+	Files int    `json:"files"`
+	URL   string `json:"url,omitempty"`
+}
+
+func sarifSummaryFile(stepID string) string {
+	return fmt.Sprintf("%s/%s-sarif-summary.json", pipeline.SharedVolPath, stepID)
+}
+
+// CollectSarif validates and merges the SARIF files of the step, and
+// uploads the merged log through the log service. The invalid files are
+// skipped. The counts of the results are saved for the outputs of the step
+// and the link of the merged log for its artifact.
+func CollectSarif(ctx context.Context, cfg *api.SarifReport, workDir, stepID string, log *logrus.Logger,
+	tiConfig *tiCfg.Cfg) error {
+	_ = os.Remove(sarifSummaryFile(stepID))
+	if cfg == nil {
+		return nil
+	}
+	paths := cfg.Paths
+	if len(paths) == 0 {
+		paths = defaultSarifPaths
+	}
+
+	roots := reportRoots(workDir, tiConfig)
+	var logs []*sarif.Log
+	for _, file := range qualityFiles(paths, workDir, log) {
+		if _, err := safepath.ConfineInput(file, roots...); err != nil {
+			log.WithError(err).WithField("file", file).Warnln("skipping SARIF file")
+			continue
+		}
+		l, err := sarif.ParseFile(file)
+		if err != nil {
+			log.WithError(err).WithField("file", file).Errorln(fmt.Sprintf("invalid SARIF file %s", file))
+			continue
+		}
+		logs = append(logs, l)
+	}
+	if len(logs) == 0 {
+		log.Infoln("No SARIF file found")
+		return nil
+	}
+
+	merged := sarif.Merge(logs)
+	summary := &SarifSummary{Summary: sarif.Summarize(merged), Files: len(logs)}
+	log.Infoln(fmt.Sprintf("Found %d SARIF results in %d files: %d errors, %d warnings, %d notes",
+		summary.Total, summary.Files, summary.Errors, summary.Warnings, summary.Notes))
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if uploader, ok := pipeline.GetState().GetLogStreamClient().(logstream.BlobUploader); ok {
+		if summary.URL, err = uploader.UploadBlob(ctx, blobKey(tiConfig, stepID, sarifReportBlobName), bytes.NewReader(data)); err != nil {
+			log.WithError(err).Warnln("failed to upload the merged SARIF file")
+		}
+	}
+
+	if data, err = json.Marshal(summary); err != nil {
+		return err
+	}
+	return os.WriteFile(sarifSummaryFile(stepID), data, annotationFilePerm)
+}
+
+func readSarifSummary(stepID string) *SarifSummary {
+	data, err := os.ReadFile(sarifSummaryFile(stepID))
+	if err != nil {
+		return nil
+	}
+	s := new(SarifSummary)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil
+	}
+	return s
+}
+
+// SaveSarifSummaryToOutputs adds the counts of the SARIF results of the
+// step to the outputs. The summary is read once, after AddSarifToArtifact.
+func SaveSarifSummaryToOutputs(stepID string, outputs map[string]string) {
+	s := readSarifSummary(stepID)
+	if s == nil {
+		return
+	}
+	_ = os.Remove(sarifSummaryFile(stepID))
+	outputs[sarifFindingsKey] = strconv.Itoa(s.Total)
+	outputs[sarifErrorsKey] = strconv.Itoa(s.Errors)
+	outputs[sarifWarningsKey] = strconv.Itoa(s.Warnings)
+	outputs[sarifNotesKey] = strconv.Itoa(s.Notes)
+	if s.URL != "" {
+		outputs[sarifReportURLKey] = s.URL
+	}
+}
+
+// AddSarifToArtifact adds the link of the merged SARIF log of the step to
+// its artifact. Artifacts of another kind are returned unchanged.
+func AddSarifToArtifact(stepID string, artifact []byte) []byte {
+	s := readSarifSummary(stepID)
+	if s == nil || s.URL == "" {
+		return artifact
+	}
+	return MergeFileArtifacts(artifact, []FileArtifact{{Name: sarifReportBlobName, URL: s.URL}})
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/harness/lite-engine/pipeline"
+	"github.com/harness/ti-client/types"
+)
+
+// standaloneReport returns the path of the test report of the step relative
+// to the results directory of the standalone mode.
+func standaloneReport(stepID string) string {
+	return filepath.Join("reports", stepID+"-junit.json")
+}
+
+// standaloneSummary returns the summary of the test report of the step
+// written in standalone mode.
+func standaloneSummary(stepID string) (types.SummaryResponse, error) {
+	var summary types.SummaryResponse
+	dir, _ := pipeline.Standalone()
+	data, err := os.ReadFile(filepath.Join(dir, standaloneReport(stepID)))
+	if err != nil {
+		return summary, err
+	}
+	var tests []*types.TestCase
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return summary, err
+	}
+	return summarizeTests(tests), nil
+}
+
+func summarizeTests(tests []*types.TestCase) types.SummaryResponse {
+	var summary types.SummaryResponse
+	for _, t := range tests {
+		summary.TotalTests++
+		summary.TimeMs += t.DurationMs
+		switch t.Result.Status {
+		case types.StatusFailed, types.StatusError:
+			summary.FailedTests++
+		case types.StatusSkipped:
+			summary.SkippedTests++
+		default:
+			summary.SuccessfulTests++
+		}
+	}
+	return summary
+}
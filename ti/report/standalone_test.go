@@ -0,0 +1,19 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/harness/ti-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeTests(t *testing.T) {
+	tests := []*types.TestCase{
+		{Name: "a", DurationMs: 10, Result: types.Result{Status: types.StatusPassed}},
+		{Name: "b", DurationMs: 20, Result: types.Result{Status: types.StatusFailed}},
+		{Name: "c", DurationMs: 30, Result: types.Result{Status: types.StatusError}},
+		{Name: "d", Result: types.Result{Status: types.StatusSkipped}},
+	}
+	assert.Equal(t, types.SummaryResponse{TotalTests: 4, SuccessfulTests: 1, FailedTests: 2, SkippedTests: 1, TimeMs: 60},
+		summarizeTests(tests))
+}
@@ -3,3 +3,22 @@
 // that can be found in the LICENSE file.
 
 package ti
+
+import (
+	"github.com/harness/lite-engine/api"
+	"github.com/harness/lite-engine/internal/metrics"
+	"github.com/harness/lite-engine/pipeline"
+	tiCfg "github.com/harness/lite-engine/ti/config"
+)
+
+// UploadDuration is the duration of the uploads to the TI service, by kind,
+// report or callgraph, and status.
+var UploadDuration = metrics.NewHistogram("lite_engine_ti_upload_duration_seconds",
+	"The duration of the uploads to the TI service, by kind and status.", metrics.DurationBuckets, "kind", "status")
+
+// NewConfig returns the TI configuration of a setup or step request, with
+// its data in the shared volume.
+func NewConfig(t *api.TIConfig) tiCfg.Cfg {
+	return tiCfg.New(t.URL, t.Token, t.AccountID, t.OrgID, t.ProjectID, t.PipelineID, t.BuildID, t.StageID, t.Repo,
+		t.Sha, t.CommitLink, t.SourceBranch, t.TargetBranch, t.CommitBranch, pipeline.SharedVolPath, t.ParseSavings, false)
+}
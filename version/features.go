@@ -0,0 +1,146 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Features are the capabilities of the engine a runner can require at
+// setup. A feature is only added, never renamed or removed.
+var Features = []string{
+	"api_v2",
+	"command_sequences",
+	"shell_selection",
+	"env_passthrough",
+	"step_clock",
+	"structured_step_errors",
+	"lifecycle_hooks",
+	"post_processing_timeout",
+	"host_user",
+	"volume_seed",
+	"network_share",
+	"image_cache",
+	"pause_resume",
+	"resource_labels",
+	"kubernetes_backend",
+	"terraform_step",
+	"containerd_runtime",
+	"repro_manifest",
+	"step_telemetry",
+	"external_ti_runner",
+	"egress_proxy",
+	"file_umask",
+	"workspace_clone",
+	"test_notifications",
+	"junit_streaming",
+	"output_encryption",
+	"tap_gotest_reports",
+	"nunit_xunit_reports",
+	"log_prioritization",
+	"step_checkpoints",
+	"step_resource_usage",
+	"oci_runtimes",
+	"step_cache",
+	"step_upload",
+	"stage_timeline",
+	"step_readiness",
+	"ti_selection_diff",
+	"engine_drain",
+	"step_state",
+	"sarif_reports",
+	"shared_test_detection",
+	"step_log_buffer",
+	"structured_logs",
+	"output_charset",
+	"log_sinks",
+	"secret_files",
+	"instr_packages",
+	"mask_patterns",
+	"nudges_catalog",
+	"entropy_masking",
+	"artifact_retention",
+	"sealed_secrets",
+	"log_batching",
+	"prometheus_metrics",
+	"stage_budget",
+	"telemetry_sampling",
+	"user_namespace",
+	"warm_container",
+	"dependency_audit",
+	"security_context",
+	"gpus",
+	"isolated_home",
+	"ti_debug_bundle",
+	"windows_isolation",
+	"image_platform",
+	"image_op",
+}
+
+// Check returns the incompatibilities of the engine with a runner which
+// requires at least minVersion, if set, and the features.
+func Check(minVersion string, features []string) []string {
+	var issues []string
+	if minVersion != "" {
+		switch older, err := olderThan(Version, minVersion); {
+		case err != nil:
+			issues = append(issues, err.Error())
+		case older:
+			issues = append(issues, fmt.Sprintf("engine version %s is older than the required version %s", Version, minVersion))
+		}
+	}
+	supported := make(map[string]bool, len(Features))
+	for _, f := range Features {
+		supported[f] = true
+	}
+	var missing []string
+	for _, f := range features {
+		if !supported[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		issues = append(issues, fmt.Sprintf("engine version %s does not support the features: %s", Version, strings.Join(missing, ", ")))
+	}
+	return issues
+}
+
+// olderThan returns true if the version v is older than min.
+func olderThan(v, min string) (bool, error) {
+	a, err := parse(v)
+	if err != nil {
+		return false, err
+	}
+	b, err := parse(min)
+	if err != nil {
+		return false, err
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i], nil
+		}
+	}
+	return false, nil
+}
+
+// parse returns the major, minor and patch numbers of a version like
+// v1.2.3, the pre-release and build suffixes are ignored.
+func parse(v string) ([3]int, error) {
+	var out [3]int
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > len(out) {
+		return out, fmt.Errorf("invalid version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("invalid version %q", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
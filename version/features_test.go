@@ -0,0 +1,41 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	assert.Empty(t, Check("", nil))
+	assert.Empty(t, Check("0.0.1", []string{"api_v2", "image_cache"}))
+	assert.Empty(t, Check("v"+Version, nil))
+
+	issues := Check("999.0.0", []string{"api_v2", "teleport", "time_travel"})
+	assert.Equal(t, []string{
+		"engine version " + Version + " is older than the required version 999.0.0",
+		"engine version " + Version + " does not support the features: teleport, time_travel",
+	}, issues)
+
+	assert.Equal(t, []string{`invalid version "latest"`}, Check("latest", nil))
+}
+
+func TestOlderThan(t *testing.T) {
+	for _, tc := range []struct {
+		v, min string
+		older  bool
+	}{
+		{"0.5.70", "0.5.70", false},
+		{"0.5.70", "0.5.71", true},
+		{"0.5.70", "0.6", true},
+		{"0.5.70", "v0.5.9", false},
+		{"1.0.0-rc1", "1.0.0", false},
+		{"1.2.0", "1.10.0", true},
+	} {
+		older, err := olderThan(tc.v, tc.min)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.older, older, "%s < %s", tc.v, tc.min)
+	}
+	_, err := olderThan("1.2.3.4", "1.0")
+	assert.Error(t, err)
+}